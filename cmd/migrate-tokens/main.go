@@ -0,0 +1,49 @@
+// Command migrate-tokens encrypts Google OAuth tokens that are still stored as plaintext.
+// Run once after configuring TOKEN_ENCRYPTION_KEY_ID / TOKEN_ENCRYPTION_KEYS:
+//
+//	go run ./cmd/migrate-tokens
+//
+// Already-encrypted values (with the key-ID prefix) are skipped, so it is safe to re-run.
+package main
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/database"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"log"
+	"time"
+)
+
+func main() {
+	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	tokenCipher, err := utils.LoadTokenCipher(cfg.TokenEncryptionKeyID, cfg.TokenEncryptionKeys)
+	if err != nil {
+		log.Fatal("Invalid token encryption config:", err)
+	}
+	if tokenCipher == nil {
+		log.Fatal("TOKEN_ENCRYPTION_KEY_ID is not set; nothing to do")
+	}
+
+	mongodb, err := database.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+	defer mongodb.Disconnect()
+
+	userRepo := repository.NewUserRepository(mongodb.Database, tokenCipher)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	updated, err := userRepo.EncryptLegacyTokens(ctx)
+	if err != nil {
+		log.Fatalf("Migration failed after %d users: %v", updated, err)
+	}
+	log.Printf("Encrypted Google tokens for %d users", updated)
+}
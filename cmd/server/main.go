@@ -18,9 +18,9 @@ import (
 	"aiemailbox-be/config"
 	"aiemailbox-be/internal/database"
 	"aiemailbox-be/internal/handlers"
-	"aiemailbox-be/internal/middleware"
 	"aiemailbox-be/internal/repository"
 	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/utils"
 	"context"
 	"log"
 	"net/http"
@@ -29,17 +29,19 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/gin-gonic/gin"
-
 	_ "aiemailbox-be/docs"
-
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	jwtKeys, err := utils.LoadJWTKeys(cfg.JWTAlg, cfg.JWTSecret, cfg.JWTPrivateKeyPath, cfg.JWTPublicKeyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Connect to MongoDB
 	mongodb, err := database.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
@@ -48,115 +50,174 @@ func main() {
 	}
 	defer mongodb.Disconnect()
 
+	// Encryption at rest for stored Google tokens (nil when not configured)
+	tokenCipher, err := utils.LoadTokenCipher(cfg.TokenEncryptionKeyID, cfg.TokenEncryptionKeys)
+	if err != nil {
+		log.Fatal("Invalid token encryption config:", err)
+	}
+
 	// Initialize repositories
-	userRepo := repository.NewUserRepository(mongodb.Database)
+	userRepo := repository.NewUserRepository(mongodb.Database, tokenCipher)
 	emailRepo := repository.NewEmailRepository(mongodb.Database)
 	// Week 4: Kanban config repository
 	kanbanConfigRepo := repository.NewKanbanConfigRepository(mongodb.Database)
+	kanbanMoveRepo := repository.NewKanbanMoveRepository(mongodb.Database)
+	cardNoteRepo := repository.NewCardNoteRepository(mongodb.Database)
+	cardActivityRepo := repository.NewCardActivityRepository(mongodb.Database)
+	// Filing rules for newly synced emails
+	ruleRepo := repository.NewRuleRepository(mongodb.Database)
+	kanbanRuleRepo := repository.NewKanbanRuleRepository(mongodb.Database)
+	savedSearchRepo := repository.NewSavedSearchRepository(mongodb.Database)
+	searchHistoryRepo := repository.NewSearchHistoryRepository(mongodb.Database)
+	draftAutosaveRepo := repository.NewDraftAutosaveRepository(mongodb.Database)
 	// Statistics repository
 	statisticsRepo := repository.NewStatisticsRepository(mongodb.Database)
 
 	// Initialize services
 	gmailService := services.NewGmailService(cfg)
+	// Mailbox backend per linked account; only Gmail is implemented
+	mailProviders := services.NewMailProviders(gmailService)
 	// Summary service: read API key/provider/model from config (empty -> local extractor)
-	summaryService := services.NewSummaryService(emailRepo, cfg.LLMApiKey, cfg.LLMProvider, cfg.LLMModel)
+	// Shared LLM provider for AI features (nil without an API key: local fallbacks are used)
+	// Every provider call is metered per user (see GET /api/usage and LLM_MONTHLY_TOKEN_CAP)
+	usageMeter := services.NewUsageMeter(repository.NewLLMUsageRepository(mongodb.Database), int64(cfg.LLMMonthlyTokenCap))
+	llmProvider := usageMeter.Provider(services.NewLLMProvider(cfg.LLMProvider, cfg.LLMApiKey, cfg.LLMModel, nil))
+	actionItemService := services.NewActionItemService(emailRepo, llmProvider)
+	classificationService := services.NewClassificationService(llmProvider)
+	composeService := services.NewComposeService(llmProvider)
+	securityService := services.NewSecurityAnalysisService(llmProvider, cfg.SecurityLLMCheck)
+	categoryService := services.NewCategoryService(llmProvider, cfg.CategoryLLM)
+	queryTranslationService := services.NewQueryTranslationService(llmProvider)
+	ruleService := services.NewRuleService(ruleRepo, kanbanRuleRepo, savedSearchRepo, gmailService)
+	eventService := services.NewEventService(gmailService, userRepo, llmProvider)
+	summaryCacheRepo := repository.NewSummaryCacheRepository(mongodb.Database)
+	threadSummaryRepo := repository.NewThreadSummaryRepository(mongodb.Database)
+	// Summarizer prompt templates; seeds the default template
+	promptTemplateRepo := repository.NewPromptTemplateRepository(mongodb.Database)
+	promptTemplates := services.NewPromptTemplateStore(promptTemplateRepo)
+	summaryService := services.NewSummaryService(emailRepo, summaryCacheRepo, threadSummaryRepo, services.NewGmailThreadSource(gmailService, userRepo), llmProvider, promptTemplates)
 	// Week 4: Embedding service for semantic search
-	embeddingService := services.NewEmbeddingService(cfg)
+	embeddingService := usageMeter.Embeddings(services.NewEmbeddingService(cfg), cfg.EmbeddingProvider, cfg.EmbeddingModel)
+	searchService := services.NewSearchService(emailRepo, embeddingService, gmailService, services.VectorSearchConfig{
+		Enabled:       cfg.VectorSearchEnabled,
+		Index:         cfg.VectorSearchIndex,
+		NumCandidates: cfg.VectorSearchNumCandidates,
+	}, cfg.SemanticMinScore)
+	embeddingIndexer := services.NewEmbeddingIndexer(emailRepo, repository.NewEmbeddingIndexRepository(mongodb.Database), embeddingService, cfg.EmbeddingProvider, cfg.EmbeddingIndexBatchSize)
+
+	// Background work (syncs, workers) is cancelled when the server shuts down
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	backgroundTasks := services.NewBackgroundTasks(workerCtx, cfg.SyncTimeout)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(cfg, userRepo)
-	emailHandler := handlers.NewEmailHandler(gmailService, userRepo, emailRepo)
-	kanbanHandler := handlers.NewKanbanHandler(emailRepo, summaryService, cfg)
+	notificationRepo := repository.NewNotificationRepository(mongodb.Database)
+	authHandler := handlers.NewAuthHandler(cfg, jwtKeys, userRepo, notificationRepo)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo)
+	// Web Push alerts for the PWA (nil without a VAPID key pair)
+	pushSubscriptionRepo := repository.NewPushSubscriptionRepository(mongodb.Database)
+	pushService, err := services.NewPushService(cfg, pushSubscriptionRepo)
+	if err != nil {
+		log.Fatal("Invalid Web Push config:", err)
+	}
+	pushHandler := handlers.NewPushHandler(pushService, pushSubscriptionRepo)
+	// Outbound webhooks (nil unless WEBHOOKS_ENABLED)
+	webhookRepo := repository.NewWebhookRepository(mongodb.Database)
+	webhookDeliveryRepo := repository.NewWebhookDeliveryRepository(mongodb.Database)
+	webhookService := services.NewWebhookService(cfg, webhookRepo, webhookDeliveryRepo, emailRepo)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, webhookRepo, webhookDeliveryRepo)
+	// Auto-summarize queue (nil disables enqueueing and queue stats)
+	var summaryJobRepo *repository.SummaryJobRepository
+	if cfg.AutoSummarize {
+		summaryJobRepo = repository.NewSummaryJobRepository(mongodb.Database)
+	}
+
+	// Fetched emails are stored by a single worker off the request path
+	emailSyncService := services.NewEmailSyncService(emailRepo, userRepo, summaryJobRepo, classificationService, securityService, categoryService, ruleService, pushService, cfg.EmailSyncQueueSize, cfg.SyncTimeout)
+	emailSyncService.Start(workerCtx)
+
+	emailHandler := handlers.NewEmailHandler(gmailService, mailProviders, userRepo, emailRepo, emailSyncService, queryTranslationService, searchHistoryRepo)
+	kanbanHandler := handlers.NewKanbanHandler(emailRepo, kanbanMoveRepo, kanbanConfigRepo, cardNoteRepo, cardActivityRepo, userRepo, gmailService, summaryService, webhookService, cfg)
 	// Week 4: Search handler
-	searchHandler := handlers.NewSearchHandler(emailRepo, embeddingService, cfg)
+	searchHandler := handlers.NewSearchHandler(emailRepo, userRepo, searchHistoryRepo, searchService, embeddingIndexer, cfg)
 	// Week 4: Kanban config handler
-	kanbanConfigHandler := handlers.NewKanbanConfigHandler(kanbanConfigRepo, emailRepo, gmailService, cfg)
+	kanbanConfigHandler := handlers.NewKanbanConfigHandler(kanbanConfigRepo, emailRepo, gmailService, mailProviders, cfg, userRepo)
 	// Statistics handler
-	statisticsHandler := handlers.NewStatisticsHandler(statisticsRepo)
-
-	// Initialize Gin
-	r := gin.Default()
-
-	// Apply CORS middleware
-	r.Use(middleware.CORS(cfg))
-
-	// Public routes
-	public := r.Group("/api")
-	{
-		// Health check
-		public.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{
-				"status":   "ok",
-				"message":  "AI Email Box API is running",
-				"database": "MongoDB connected",
-			})
-		})
-
-		// Auth routes
-		auth := public.Group("/auth")
-		{
-			auth.POST("/signup", authHandler.Signup)
-			auth.POST("/login", authHandler.Login)
-			auth.POST("/google", authHandler.GoogleAuth)
-			auth.POST("/refresh", authHandler.RefreshToken)
-		}
-	}
+	statisticsHandler := handlers.NewStatisticsHandler(statisticsRepo, summaryJobRepo)
+	adminHandler := handlers.NewAdminHandler(emailRepo, summaryService, embeddingIndexer, cfg)
+	healthHandler := handlers.NewHealthHandler(mongodb, cfg)
+	aiUsageRepo := repository.NewAIUsageRepository(mongodb.Database)
+	aiHandler := handlers.NewAIHandler(emailRepo, actionItemService, composeService, summaryService, eventService, aiUsageRepo, cfg)
+	securityHandler := handlers.NewSecurityHandler(emailRepo, securityService)
+	draftHandler := handlers.NewDraftHandler(gmailService, userRepo, emailRepo, kanbanConfigRepo, draftAutosaveRepo)
+	usageHandler := handlers.NewUsageHandler(usageMeter)
+	promptTemplateHandler := handlers.NewPromptTemplateHandler(promptTemplateRepo, promptTemplates, cfg)
+	ruleHandler := handlers.NewRuleHandler(ruleRepo, emailRepo, ruleService)
+	kanbanRuleHandler := handlers.NewKanbanRuleHandler(kanbanRuleRepo, emailRepo)
+	savedSearchHandler := handlers.NewSavedSearchHandler(savedSearchRepo, userRepo, searchService)
+	gmailPushHandler := handlers.NewGmailPushHandler(cfg, gmailService, userRepo, emailHandler, backgroundTasks)
 
-	// Protected routes
-	protected := r.Group("/api")
-	protected.Use(middleware.AuthMiddleware(cfg))
-	{
-		// Auth protected routes
-		protected.POST("/auth/logout", authHandler.Logout)
-		protected.GET("/auth/me", authHandler.GetMe)
-
-		// Email routes
-		protected.GET("/mailboxes", emailHandler.GetMailboxes)
-		protected.GET("/mailboxes/:mailboxId/emails", emailHandler.GetEmails)
-		protected.GET("/emails/search", emailHandler.SearchEmails)
-		protected.GET("/emails/:emailId", emailHandler.GetEmailDetail)
-		protected.POST("/emails/:emailId/reply", emailHandler.ReplyEmail)
-		protected.POST("/emails/send", emailHandler.SendEmail)
-		protected.POST("/emails/:emailId/modify", emailHandler.ModifyEmail)
-		protected.GET("/attachments/:id", emailHandler.GetAttachment)
-
-		// Kanban routes
-		protected.GET("/kanban", kanbanHandler.GetKanban)
-		protected.GET("/kanban/meta", kanbanHandler.Meta)
-		protected.POST("/kanban/move", kanbanHandler.Move)
-		protected.POST("/kanban/snooze", kanbanHandler.Snooze)
-		protected.POST("/kanban/summarize", kanbanHandler.Summarize)
-
-		// Week 4: Search routes
-		protected.POST("/search/semantic", searchHandler.SemanticSearch)
-		protected.GET("/search/suggestions", searchHandler.GetSuggestions)
-		protected.POST("/search/generate-embeddings", searchHandler.GenerateEmbeddings)
-
-		// Week 4: Kanban configuration routes
-		protected.GET("/kanban/columns", kanbanConfigHandler.GetColumns)
-		protected.POST("/kanban/columns", kanbanConfigHandler.CreateColumn)
-		protected.PUT("/kanban/columns/:id", kanbanConfigHandler.UpdateColumn)
-		protected.DELETE("/kanban/columns/:id", kanbanConfigHandler.DeleteColumn)
-		protected.POST("/kanban/columns/reorder", kanbanConfigHandler.ReorderColumns)
-
-		// Week 4: Gmail labels route
-		protected.GET("/gmail/labels", kanbanConfigHandler.GetGmailLabels)
-
-		// Statistics routes
-		protected.GET("/statistics", statisticsHandler.GetStatistics)
-	}
-
-	// Swagger route
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	r := newRouter(cfg, jwtKeys, usageMeter, routeHandlers{
+		admin:          adminHandler,
+		ai:             aiHandler,
+		auth:           authHandler,
+		draft:          draftHandler,
+		email:          emailHandler,
+		gmailPush:      gmailPushHandler,
+		health:         healthHandler,
+		kanban:         kanbanHandler,
+		kanbanConfig:   kanbanConfigHandler,
+		kanbanRule:     kanbanRuleHandler,
+		notification:   notificationHandler,
+		promptTemplate: promptTemplateHandler,
+		push:           pushHandler,
+		rule:           ruleHandler,
+		savedSearch:    savedSearchHandler,
+		search:         searchHandler,
+		security:       securityHandler,
+		statistics:     statisticsHandler,
+		usage:          usageHandler,
+		webhook:        webhookHandler,
+	})
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
 	log.Printf("Connected to MongoDB: %s", cfg.MongoDBDatabase)
 	// Start snooze worker (runs in background) with configurable interval via SNOOZE_CHECK_INTERVAL
-	workerCtx, workerCancel := context.WithCancel(context.Background())
-
 	interval := cfg.SnoozeCheckInterval
-	services.StartSnoozeWorker(workerCtx, interval, emailRepo)
+	services.StartSnoozeWorker(workerCtx, interval, emailRepo, notificationRepo, pushService, webhookService)
+
+	// Archive old cards of columns with autoArchiveDays
+	if cfg.AutoArchiveInterval > 0 {
+		services.StartAutoArchiveWorker(workerCtx, cfg.AutoArchiveInterval, kanbanConfigRepo, emailRepo)
+	}
+
+	// Summarize newly synced emails in the background
+	if summaryJobRepo != nil {
+		services.StartSummaryWorker(workerCtx, cfg.SummaryJobInterval, cfg.AutoSummarizeMinChars, cfg.SummaryJobMaxAttempts, summaryJobRepo, emailRepo, summaryService, webhookService)
+	}
+
+	// Send queued outbound webhook deliveries
+	if webhookService != nil {
+		services.StartWebhookWorker(workerCtx, cfg.WebhookDeliveryInterval, webhookService)
+	}
+
+	// Prune stale cached emails and embeddings
+	if cfg.EmailRetention > 0 {
+		services.StartCleanupWorker(workerCtx, cfg.CleanupInterval, cfg.EmailRetention, emailRepo)
+	}
+
+	// Index subjects of emails synced before fuzzy search used trigrams
+	services.StartSearchGramBackfill(workerCtx, emailRepo)
+
+	// Embed synced emails for semantic search (needs an embedding API key or a local server)
+	if cfg.EmbeddingIndexInterval > 0 && cfg.EmbeddingConfigured() {
+		services.StartEmbeddingWorker(workerCtx, cfg.EmbeddingIndexInterval, embeddingIndexer)
+	}
+
+	// Renew Gmail push watches before they expire (only when a Pub/Sub topic is configured)
+	if cfg.GmailPubSubTopic != "" {
+		services.StartWatchRenewalWorker(workerCtx, cfg.GmailWatchRenewInterval, cfg.GmailWatchRenewMargin, userRepo, gmailService)
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -177,8 +238,14 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
-	// stop worker
+	// stop workers and cancel in-flight background syncs
 	workerCancel()
+	if !backgroundTasks.Wait(5 * time.Second) {
+		log.Println("Background tasks did not finish before shutdown timeout")
+	}
+	if !emailSyncService.Wait(5 * time.Second) {
+		log.Println("Email sync worker did not stop before shutdown timeout")
+	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/handlers"
+	"aiemailbox-be/internal/middleware"
+	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/utils"
+
+	"github.com/gin-gonic/gin"
+
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// routeHandlers are the handlers the API is served by
+type routeHandlers struct {
+	admin          *handlers.AdminHandler
+	ai             *handlers.AIHandler
+	auth           *handlers.AuthHandler
+	draft          *handlers.DraftHandler
+	email          *handlers.EmailHandler
+	gmailPush      *handlers.GmailPushHandler
+	health         *handlers.HealthHandler
+	kanban         *handlers.KanbanHandler
+	kanbanConfig   *handlers.KanbanConfigHandler
+	kanbanRule     *handlers.KanbanRuleHandler
+	notification   *handlers.NotificationHandler
+	promptTemplate *handlers.PromptTemplateHandler
+	push           *handlers.PushHandler
+	rule           *handlers.RuleHandler
+	savedSearch    *handlers.SavedSearchHandler
+	search         *handlers.SearchHandler
+	security       *handlers.SecurityHandler
+	statistics     *handlers.StatisticsHandler
+	usage          *handlers.UsageHandler
+	webhook        *handlers.WebhookHandler
+}
+
+// newRouter creates the Gin engine with the global middleware and every route
+func newRouter(cfg *config.Config, jwtKeys *utils.JWTKeys, usageMeter *services.UsageMeter, h routeHandlers) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Logger())
+	// Tag every request and turn handler panics into JSON 500s
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Recovery())
+
+	// Apply CORS middleware
+	r.Use(middleware.CORS(cfg))
+	// Only unauthenticated GETs may be cached; private data is never stored
+	r.Use(middleware.CacheControl(cfg))
+
+	// Public routes
+	public := r.Group("/api")
+	{
+		// Health check
+		public.GET("/health", h.health.Health)
+		// Kubernetes-style probes
+		public.GET("/live", h.health.Live)
+		public.GET("/ready", h.health.Ready)
+
+		// Auth routes
+		auth := public.Group("/auth")
+		{
+			auth.POST("/signup", h.auth.Signup)
+			auth.POST("/login", h.auth.Login)
+			auth.POST("/google", h.auth.GoogleAuth)
+			auth.POST("/refresh", h.auth.RefreshToken)
+		}
+
+		// Public keys for verifying access tokens elsewhere (RS256 only; empty for HS256)
+		public.GET("/auth/jwks", h.auth.JWKS)
+
+		// Gmail Pub/Sub push notifications (verified with GMAIL_WEBHOOK_TOKEN)
+		public.POST("/webhooks/gmail", h.gmailPush.Webhook)
+	}
+
+	// Protected routes
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthMiddleware(jwtKeys))
+	protected.Use(middleware.UsageScope())
+	// AI endpoints answer 402 once the user's monthly token cap is used up
+	tokenBudget := middleware.RequireTokenBudget(usageMeter)
+	{
+		// Auth protected routes
+		protected.POST("/auth/logout", h.auth.Logout)
+		protected.GET("/auth/me", h.auth.GetMe)
+		protected.PATCH("/auth/me/settings", h.auth.UpdateSettings)
+
+		// Notifications
+		protected.GET("/notifications", h.notification.ListNotifications)
+		protected.POST("/notifications/:id/read", h.notification.MarkNotificationRead)
+		// Web Push subscriptions
+		protected.GET("/push/vapid-public-key", h.push.GetVAPIDPublicKey)
+		protected.POST("/push/subscribe", h.push.Subscribe)
+		protected.DELETE("/push/subscribe", h.push.Unsubscribe)
+		// Outbound webhook
+		protected.GET("/settings/webhook", h.webhook.GetWebhook)
+		protected.PUT("/settings/webhook", h.webhook.SaveWebhook)
+		protected.DELETE("/settings/webhook", h.webhook.DeleteWebhook)
+		protected.POST("/settings/webhook/secret", h.webhook.RotateSecret)
+		protected.POST("/settings/webhook/test", h.webhook.TestWebhook)
+		protected.GET("/settings/webhook/deliveries", h.webhook.ListDeliveries)
+
+		// Email routes
+		protected.GET("/mailboxes", h.email.GetMailboxes)
+		protected.GET("/mailboxes/:mailboxId/emails", h.email.GetEmails)
+		protected.POST("/mailboxes/:mailboxId/mark-all-read", h.email.MarkAllRead)
+		protected.GET("/emails/search", h.email.SearchEmails)
+		protected.GET("/emails/trash", h.email.GetTrash)
+		protected.GET("/emails/:emailId", h.email.GetEmailDetail)
+		protected.GET("/emails/:emailId/attachments", h.email.ListAttachments)
+		protected.POST("/emails/:emailId/reply", h.email.ReplyEmail)
+		protected.POST("/emails/:emailId/forward", h.email.ForwardEmail)
+		protected.POST("/emails/send", h.email.SendEmail)
+		protected.POST("/emails/compose-assist", tokenBudget, h.ai.ComposeAssist)
+		protected.POST("/emails/:emailId/modify", h.email.ModifyEmail)
+		protected.POST("/emails/modify-batch", h.email.ModifyEmailsBatch)
+		protected.POST("/emails/batch-modify", h.email.ModifyEmailsBatch)
+		protected.POST("/emails/:emailId/restore", h.email.RestoreEmail)
+		protected.POST("/emails/:emailId/archive", h.email.ArchiveEmail)
+		protected.POST("/emails/:emailId/trash", h.email.TrashEmail)
+		protected.POST("/emails/:emailId/untrash", h.email.UntrashEmail)
+		protected.DELETE("/emails/:emailId", h.email.DeleteEmail)
+		protected.POST("/emails/:emailId/read", h.email.MarkRead)
+		protected.POST("/emails/:emailId/unread", h.email.MarkUnread)
+		protected.POST("/emails/:emailId/star", h.email.StarEmail)
+		protected.POST("/emails/:emailId/unstar", h.email.UnstarEmail)
+		protected.POST("/emails/:emailId/action-items", tokenBudget, h.ai.ExtractActionItems)
+		protected.GET("/emails/:emailId/security", h.security.GetSecurity)
+		protected.POST("/emails/:emailId/extract-event", tokenBudget, h.ai.ExtractEvent)
+		protected.GET("/attachments/:id", h.email.GetAttachment)
+
+		// Drafts
+		protected.GET("/drafts", h.draft.ListDrafts)
+		// Local autosave, promoted to a Gmail draft on an explicit save
+		protected.GET("/drafts/local", h.draft.ListLocalDrafts)
+		protected.GET("/drafts/local/:id", h.draft.GetLocalDraft)
+		protected.PUT("/drafts/local/:id", h.draft.AutosaveDraft)
+		protected.DELETE("/drafts/local/:id", h.draft.DeleteLocalDraft)
+		protected.POST("/drafts/local/:id/save", h.draft.SaveLocalDraft)
+		protected.POST("/drafts", h.draft.CreateDraft)
+		protected.GET("/drafts/:draftId", h.draft.GetDraft)
+		protected.PUT("/drafts/:draftId", h.draft.UpdateDraft)
+		protected.DELETE("/drafts/:draftId", h.draft.DeleteDraft)
+		protected.POST("/drafts/:draftId/send", h.draft.SendDraft)
+		protected.GET("/threads/:threadId/summary", tokenBudget, h.ai.ThreadSummary)
+		// Incremental Gmail sync (history API)
+		protected.POST("/sync", h.email.SyncMailbox)
+
+		// Kanban routes
+		protected.GET("/kanban", h.kanban.GetKanban)
+		protected.GET("/kanban/meta", h.kanban.Meta)
+		protected.POST("/kanban/move", h.kanban.Move)
+		protected.POST("/kanban/undo", h.kanban.Undo)
+		protected.POST("/kanban/bulk", h.kanban.Bulk)
+		protected.POST("/kanban/snooze", h.kanban.Snooze)
+		protected.POST("/kanban/summarize", tokenBudget, h.kanban.Summarize)
+		protected.POST("/kanban/summarize-batch", tokenBudget, h.kanban.SummarizeBatch)
+		protected.GET("/kanban/cards/:emailId/notes", h.kanban.ListCardNotes)
+		protected.POST("/kanban/cards/:emailId/notes", h.kanban.CreateCardNote)
+		protected.PUT("/kanban/cards/:emailId/notes/:noteId", h.kanban.UpdateCardNote)
+		protected.DELETE("/kanban/cards/:emailId/notes/:noteId", h.kanban.DeleteCardNote)
+		protected.GET("/kanban/cards/:emailId/activity", h.kanban.GetCardActivity)
+		protected.POST("/kanban/archive-done", h.kanban.ArchiveDone)
+		protected.GET("/kanban/archive", h.kanban.ListArchive)
+		protected.POST("/kanban/archive/:emailId/restore", h.kanban.RestoreArchived)
+
+		// Week 4: Search routes
+		protected.POST("/search", tokenBudget, h.search.HybridSearch)
+		protected.POST("/search/semantic", tokenBudget, h.search.SemanticSearch)
+		protected.GET("/search/suggestions", h.search.GetSuggestions)
+		protected.GET("/search/history", h.search.GetSearchHistory)
+		protected.DELETE("/search/history", h.search.ClearSearchHistory)
+		protected.POST("/search/generate-embeddings", tokenBudget, h.search.GenerateEmbeddings)
+		protected.GET("/search/index-status", h.search.IndexStatus)
+		// Saved searches; their actions file newly synced emails like rules
+		protected.GET("/search/saved", h.savedSearch.ListSavedSearches)
+		protected.POST("/search/saved", h.savedSearch.CreateSavedSearch)
+		protected.GET("/search/saved/:id", h.savedSearch.GetSavedSearch)
+		protected.PUT("/search/saved/:id", h.savedSearch.UpdateSavedSearch)
+		protected.DELETE("/search/saved/:id", h.savedSearch.DeleteSavedSearch)
+		protected.GET("/search/saved/:id/run", tokenBudget, h.savedSearch.RunSavedSearch)
+		// Smart folders: the same saved searches under the path the frontend pins them by
+		protected.GET("/saved-searches", h.savedSearch.ListSavedSearches)
+		protected.POST("/saved-searches", h.savedSearch.CreateSavedSearch)
+		protected.GET("/saved-searches/:id", h.savedSearch.GetSavedSearch)
+		protected.PUT("/saved-searches/:id", h.savedSearch.UpdateSavedSearch)
+		protected.DELETE("/saved-searches/:id", h.savedSearch.DeleteSavedSearch)
+		protected.GET("/saved-searches/:id/run", tokenBudget, h.savedSearch.RunSavedSearch)
+
+		// Week 4: Kanban configuration routes
+		protected.GET("/kanban/columns", h.kanbanConfig.GetColumns)
+		protected.POST("/kanban/columns", h.kanbanConfig.CreateColumn)
+		protected.PUT("/kanban/columns/:id", h.kanbanConfig.UpdateColumn)
+		protected.DELETE("/kanban/columns/:id", h.kanbanConfig.DeleteColumn)
+		protected.POST("/kanban/columns/reorder", h.kanbanConfig.ReorderColumns)
+		// Kanban rules place newly synced emails on the board
+		protected.GET("/kanban/rules", h.kanbanRule.ListKanbanRules)
+		protected.POST("/kanban/rules", h.kanbanRule.CreateKanbanRule)
+		protected.POST("/kanban/rules/dry-run", h.kanbanRule.DryRunKanbanRule)
+		protected.GET("/kanban/rules/:id", h.kanbanRule.GetKanbanRule)
+		protected.PUT("/kanban/rules/:id", h.kanbanRule.UpdateKanbanRule)
+		protected.DELETE("/kanban/rules/:id", h.kanbanRule.DeleteKanbanRule)
+
+		// Week 4: Gmail labels route
+		protected.GET("/gmail/labels", h.kanbanConfig.GetGmailLabels)
+		// Gmail push notifications
+		protected.POST("/gmail/watch", h.gmailPush.Watch)
+		protected.DELETE("/gmail/watch", h.gmailPush.Unwatch)
+
+		// Statistics routes
+		protected.GET("/statistics", h.statistics.GetStatistics)
+		// LLM token usage this month
+		protected.GET("/usage", h.usage.GetUsage)
+
+		// Summarizer prompt templates (own templates; admins also the default and ?userId=)
+		protected.GET("/settings/prompts", h.promptTemplate.ListTemplates)
+		protected.POST("/settings/prompts", h.promptTemplate.CreateTemplate)
+		protected.GET("/settings/prompts/:id", h.promptTemplate.GetTemplate)
+		protected.PUT("/settings/prompts/:id", h.promptTemplate.UpdateTemplate)
+		protected.DELETE("/settings/prompts/:id", h.promptTemplate.DeleteTemplate)
+		protected.POST("/settings/prompts/:id/activate", h.promptTemplate.ActivateTemplate)
+
+		// Filing rules for incoming emails
+		protected.GET("/rules", h.rule.ListRules)
+		protected.POST("/rules", h.rule.CreateRule)
+		protected.POST("/rules/test", h.rule.TestRules)
+		protected.GET("/rules/:id", h.rule.GetRule)
+		protected.PUT("/rules/:id", h.rule.UpdateRule)
+		protected.DELETE("/rules/:id", h.rule.DeleteRule)
+
+		// Admin routes
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireAdmin(cfg))
+		{
+			admin.POST("/cleanup", h.admin.Cleanup)
+			admin.GET("/metrics", h.admin.Metrics)
+		}
+
+		// Inspect extractive summarizer scoring (admins only)
+		if cfg.EnableDebugEndpoints {
+			protected.POST("/summary/debug", middleware.RequireAdmin(cfg), h.kanban.SummaryDebug)
+		}
+	}
+
+	// Standard JWKS location, same as /api/auth/jwks
+	r.GET("/.well-known/jwks.json", h.auth.JWKS)
+
+	// Swagger route
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	return r
+}
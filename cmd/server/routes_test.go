@@ -0,0 +1,117 @@
+package main
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/handlers"
+	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRouteHandlers builds every handler through its constructor, as main does, so a
+// constructor whose signature drifted from main.go fails to compile here too. Dependencies
+// are nil: nothing is called while routes are registered.
+func testRouteHandlers(cfg *config.Config, jwtKeys *utils.JWTKeys) routeHandlers {
+	emailHandler := handlers.NewEmailHandler(nil, nil, nil, nil, nil, nil, nil)
+	return routeHandlers{
+		admin:          handlers.NewAdminHandler(nil, nil, nil, cfg),
+		ai:             handlers.NewAIHandler(nil, nil, nil, nil, nil, nil, cfg),
+		auth:           handlers.NewAuthHandler(cfg, jwtKeys, nil, nil),
+		draft:          handlers.NewDraftHandler(nil, nil, nil, nil, nil),
+		email:          emailHandler,
+		gmailPush:      handlers.NewGmailPushHandler(cfg, nil, nil, emailHandler, services.NewBackgroundTasks(context.Background(), time.Minute)),
+		health:         handlers.NewHealthHandler(nil, cfg),
+		kanban:         handlers.NewKanbanHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, cfg),
+		kanbanConfig:   handlers.NewKanbanConfigHandler(nil, nil, nil, nil, cfg, nil),
+		kanbanRule:     handlers.NewKanbanRuleHandler(nil, nil),
+		notification:   handlers.NewNotificationHandler(nil),
+		promptTemplate: handlers.NewPromptTemplateHandler(nil, nil, cfg),
+		push:           handlers.NewPushHandler(nil, nil),
+		rule:           handlers.NewRuleHandler(nil, nil, nil),
+		savedSearch:    handlers.NewSavedSearchHandler(nil, nil, nil),
+		search:         handlers.NewSearchHandler(nil, nil, nil, nil, nil, cfg),
+		security:       handlers.NewSecurityHandler(nil, nil),
+		statistics:     handlers.NewStatisticsHandler(nil, nil),
+		usage:          handlers.NewUsageHandler(nil),
+		webhook:        handlers.NewWebhookHandler(nil, nil, nil),
+	}
+}
+
+func TestNewRouterRegistersRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, debug := range []bool{false, true} {
+		cfg := &config.Config{EnableDebugEndpoints: debug}
+		jwtKeys := utils.NewHS256Keys("test-secret")
+
+		// gin panics on conflicting or duplicate routes
+		r := newRouter(cfg, jwtKeys, services.NewUsageMeter(nil, 0), testRouteHandlers(cfg, jwtKeys))
+
+		routes := map[string]bool{}
+		for _, route := range r.Routes() {
+			if route.HandlerFunc == nil {
+				t.Errorf("%s %s has no handler", route.Method, route.Path)
+			}
+			routes[route.Method+" "+route.Path] = true
+		}
+		for _, want := range []string{
+			"GET /api/health",
+			"POST /api/auth/login",
+			"GET /.well-known/jwks.json",
+			"GET /api/emails/:emailId",
+			"DELETE /api/emails/:emailId",
+			"GET /api/drafts/local/:id",
+			"GET /api/drafts/:draftId",
+			"GET /api/kanban",
+			"POST /api/admin/cleanup",
+			"GET /swagger/*any",
+		} {
+			if !routes[want] {
+				t.Errorf("route %s not registered", want)
+			}
+		}
+		if got := routes["POST /api/summary/debug"]; got != debug {
+			t.Errorf("debug route registered = %v with EnableDebugEndpoints %v", got, debug)
+		}
+	}
+}
+
+func TestNewRouterProtectsAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{AdminEmails: []string{"admin@example.com"}}
+	jwtKeys := utils.NewHS256Keys("test-secret")
+	r := newRouter(cfg, jwtKeys, services.NewUsageMeter(nil, 0), testRouteHandlers(cfg, jwtKeys))
+
+	serve := func(method, path, token string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(http.MethodGet, "/api/kanban", ""); code != http.StatusUnauthorized {
+		t.Errorf("GET /api/kanban without a token = %d, want 401", code)
+	}
+	token, err := utils.GenerateAccessToken("u1", "user@example.com", jwtKeys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(http.MethodPost, "/api/admin/cleanup", token); code != http.StatusForbidden {
+		t.Errorf("POST /api/admin/cleanup as a non-admin = %d, want 403", code)
+	}
+
+	// The debug endpoint sits outside /api/admin but is still admin-only
+	cfg.EnableDebugEndpoints = true
+	r = newRouter(cfg, jwtKeys, services.NewUsageMeter(nil, 0), testRouteHandlers(cfg, jwtKeys))
+	if code := serve(http.MethodPost, "/api/summary/debug", token); code != http.StatusForbidden {
+		t.Errorf("POST /api/summary/debug as a non-admin = %d, want 403", code)
+	}
+}
@@ -1,36 +1,144 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// defaultJWTSecret is the insecure placeholder used when JWT_SECRET is unset
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 type Config struct {
+	Env                  string // "development" relaxes Validate; anything else is treated as production
 	Port                 string
 	JWTSecret            string
+	JWTAlg               string // HS256 (JWT_SECRET) or RS256 (PEM key files; the public key is optional)
+	JWTPrivateKeyPath    string
+	JWTPublicKeyPath     string
 	JWTAccessExpiration  time.Duration
 	JWTRefreshExpiration time.Duration
-	GoogleClientID       string
-	GoogleClientSecret   string
-	FrontendURL          string
-	MongoDBURI           string
-	MongoDBDatabase      string
+	// How long a rotated refresh token stays usable, so a retried refresh doesn't log the user out
+	JWTRefreshReuseWindow time.Duration
+	GoogleClientID        string
+	GoogleClientSecret    string
+	FrontendURL           string
+	AllowedOrigins        []string // CORS allowlist; entries may use a wildcard subdomain ("https://*.example.com")
+	MongoDBURI            string
+	MongoDBDatabase       string
 
 	// New fields for GA05
 	LLMApiKey           string
-	LLMProvider         string
+	LLMProvider         string // "openai" | "gemini" | "anthropic"
 	LLMModel            string // Configurable model for summarization
 	SnoozeCheckInterval time.Duration
-	KanbanColumns       []string
+	// Kanban moves kept per user for POST /api/kanban/undo, and how long each can be undone.
+	// A depth of 0 disables undo.
+	KanbanUndoDepth  int
+	KanbanUndoWindow time.Duration
+	// How often columns with autoArchiveDays are archived; 0 disables auto-archive
+	AutoArchiveInterval time.Duration
 
 	// Week 4: Embedding/Semantic Search config
 	EmbeddingProvider string // "openai" | "gemini" | "local"
 	EmbeddingAPIKey   string
 	EmbeddingModel    string
+	// OpenAI-compatible server for the "local" provider (Ollama, LM Studio, vLLM)
+	EmbeddingBaseURL string
+	// Background embedding indexer; 0 interval disables it. A batch size of 0 uses the
+	// provider default (OpenAI 64, Gemini 16)
+	EmbeddingIndexInterval  time.Duration
+	EmbeddingIndexBatchSize int
+	// Atlas Vector Search for semantic queries; only enable once the vector index on
+	// "embedding" (with "userId" as a filter field) exists, otherwise emails are scored in memory
+	VectorSearchEnabled       bool
+	VectorSearchIndex         string
+	VectorSearchNumCandidates int // nearest neighbours Atlas considers per query
+	// Semantic results with a lower cosine similarity are dropped (requests may override it)
+	SemanticMinScore float64
+
+	// Encryption at rest for stored Google tokens. Keys are "id:base64key" pairs; the active
+	// key encrypts new values, the others only decrypt (rotation). Empty disables encryption.
+	TokenEncryptionKeyID string
+	TokenEncryptionKeys  map[string]string
+
+	// Timeout for background syncs of fetched emails into Mongo
+	SyncTimeout time.Duration
+	// Batches of fetched emails waiting for the sync worker; further batches are dropped
+	EmailSyncQueueSize int
+
+	// Retention of cached emails; 0 disables the cleanup worker
+	EmailRetention  time.Duration
+	CleanupInterval time.Duration
+	// Emails of users allowed to call /api/admin/* endpoints
+	AdminEmails []string
+
+	// Cache-Control max-age for unauthenticated GETs (e.g. /api/health); 0 disables caching.
+	// Authenticated responses are always "private, no-store".
+	PublicCacheMaxAge time.Duration
+
+	// Gmail web root used for "open in Gmail" links; Workspace accounts may need
+	// "https://mail.google.com/a/<domain>/"
+	GmailWebURL string
+
+	// Fill Body/Preview with "[Attachment: name]" for emails that only carry attachments
+	AttachmentOnlyPlaceholder bool
+
+	// How long a user's Gmail label list (and the mailbox counts derived from it) is cached;
+	// 0 disables the cache
+	GmailLabelCacheTTL time.Duration
+
+	// Rate-limited Gmail calls (429, 403 rateLimitExceeded) are tried up to GmailRetryAttempts
+	// times in total, backing off exponentially up to GmailRetryMaxDelay between tries
+	GmailRetryAttempts int
+	GmailRetryMaxDelay time.Duration
+
+	// Dev-only endpoints (e.g. POST /api/summary/debug)
+	EnableDebugEndpoints bool
+
+	// Gmail push notifications (Pub/Sub watch)
+	GmailPubSubTopic        string        // e.g. "projects/<project>/topics/<topic>"; empty disables watch renewal
+	GmailWatchRenewInterval time.Duration // how often the renewal worker runs
+	GmailWatchRenewMargin   time.Duration // renew watches expiring within this window
+	// Shared secret the Pub/Sub push subscription sends as ?token= on POST /api/webhooks/gmail
+	GmailWebhookToken string
+
+	// Auto-summarize newly synced emails through a persistent job queue
+	AutoSummarize         bool
+	AutoSummarizeMinChars int           // shorter emails keep showing their preview
+	SummaryJobInterval    time.Duration // one queued summary per interval (LLM rate limit)
+	SummaryJobMaxAttempts int           // jobs are marked failed after this many attempts
+
+	// Per-user daily limit for POST /api/emails/compose-assist; 0 means unlimited
+	AIComposeDailyQuota int
+
+	// Also ask the LLM about emails the phishing heuristics flag (costs one request each)
+	SecurityLLMCheck bool
+
+	// Ask the LLM to categorize emails the category rules can't decide (costs one request each)
+	CategoryLLM bool
+
+	// Per-user monthly LLM + embedding token cap; AI endpoints answer 402 once it is used up.
+	// 0 means unlimited (usage is recorded either way)
+	LLMMonthlyTokenCap int
+
+	// Web Push (VAPID key pair, base64url: the uncompressed P-256 public key and the private
+	// scalar); push is disabled when either is empty
+	VAPIDPublicKey  string
+	VAPIDPrivateKey string
+	VAPIDSubject    string        // mailto: or https: contact sent to push services
+	WebPushTTL      time.Duration // how long push services keep a message for an offline browser
+
+	// Outbound webhooks (per-user URL + secret, signed POSTs on board events); off by default
+	WebhooksEnabled         bool
+	WebhookDeliveryInterval time.Duration // how often the delivery worker drains the queue
+	WebhookMaxAttempts      int           // deliveries are marked failed after this many attempts
+	WebhooksAllowPrivate    bool          // accept http and local/private receivers (local testing only)
 }
 
 func Load() *Config {
@@ -39,48 +147,126 @@ func Load() *Config {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	accessExp, _ := time.ParseDuration(getEnv("JWT_ACCESS_EXPIRATION", "15m"))
-	refreshExp, _ := time.ParseDuration(getEnv("JWT_REFRESH_EXPIRATION", "168h"))
+	accessExp := getDuration("JWT_ACCESS_EXPIRATION", 15*time.Minute)
+	refreshExp := getDuration("JWT_REFRESH_EXPIRATION", 168*time.Hour)
 
 	// new values
 	llmKey := getEnv("LLM_API_KEY", "")
 	llmProvider := getEnv("LLM_PROVIDER", "")
 	llmModel := getEnv("LLM_MODEL", "") // Empty defaults to internal default
 
-	snoozeIntervalStr := getEnv("SNOOZE_CHECK_INTERVAL", "1m")
-	snoozeInterval, err := time.ParseDuration(snoozeIntervalStr)
-	if err != nil {
-		snoozeInterval = time.Minute
-	}
-	kanbanColsRaw := getEnv("KANBAN_COLUMNS", "Inbox,To Do,In Progress,Done,Snoozed")
-	cols := []string{}
-	for _, p := range strings.Split(kanbanColsRaw, ",") {
-		if t := strings.TrimSpace(p); t != "" {
-			cols = append(cols, t)
+	// Intervals drive time.NewTicker, which panics on non-positive durations
+	snoozeInterval := getDuration("SNOOZE_CHECK_INTERVAL", time.Minute)
+	watchRenewInterval := getDuration("GMAIL_WATCH_RENEW_INTERVAL", time.Hour)
+	watchRenewMargin := getDuration("GMAIL_WATCH_RENEW_MARGIN", 24*time.Hour)
+
+	tokenKeys := map[string]string{}
+	for _, pair := range splitCSV(getEnv("TOKEN_ENCRYPTION_KEYS", "")) {
+		if id, key, ok := strings.Cut(pair, ":"); ok {
+			tokenKeys[strings.TrimSpace(id)] = strings.TrimSpace(key)
 		}
 	}
 
+	syncTimeout := getDuration("SYNC_TIMEOUT", time.Minute)
+
+	// Zero is meaningful for these (disables retention / public caching)
+	emailRetention := getOptionalDuration("EMAIL_RETENTION", 0)
+	labelCacheTTL := getOptionalDuration("GMAIL_LABEL_CACHE_TTL", 30*time.Second)
+	cleanupInterval := getDuration("CLEANUP_INTERVAL", 24*time.Hour)
+	publicCacheMaxAge := getOptionalDuration("PUBLIC_CACHE_MAX_AGE", 5*time.Minute)
+
+	// CORS allowlist falls back to the single frontend URL
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+	allowedOrigins := splitCSV(getEnv("ALLOWED_ORIGINS", ""))
+	if len(allowedOrigins) == 0 {
+		allowedOrigins = []string{frontendURL}
+	}
+
 	return &Config{
-		Port:                 getEnv("PORT", "8080"),
-		JWTSecret:            getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		JWTAccessExpiration:  accessExp,
-		JWTRefreshExpiration: refreshExp,
-		GoogleClientID:       getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret:   getEnv("GOOGLE_CLIENT_SECRET", ""),
-		FrontendURL:          getEnv("FRONTEND_URL", "http://localhost:3000"),
-		MongoDBURI:           getEnv("MONGODB_URI", ""),
-		MongoDBDatabase:      getEnv("MONGODB_DATABASE", "aiemailbox"),
+		Env:                   strings.ToLower(getEnv("APP_ENV", "production")),
+		Port:                  getEnv("PORT", "8080"),
+		JWTSecret:             getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTAlg:                strings.ToUpper(getEnv("JWT_ALG", "HS256")),
+		JWTPrivateKeyPath:     getEnv("JWT_PRIVATE_KEY_PATH", ""),
+		JWTPublicKeyPath:      getEnv("JWT_PUBLIC_KEY_PATH", ""),
+		JWTAccessExpiration:   accessExp,
+		JWTRefreshExpiration:  refreshExp,
+		JWTRefreshReuseWindow: getOptionalDuration("JWT_REFRESH_REUSE_WINDOW", 30*time.Second),
+		GoogleClientID:        getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:    getEnv("GOOGLE_CLIENT_SECRET", ""),
+		FrontendURL:           frontendURL,
+		AllowedOrigins:        allowedOrigins,
+		MongoDBURI:            getEnv("MONGODB_URI", ""),
+		MongoDBDatabase:       getEnv("MONGODB_DATABASE", "aiemailbox"),
 
 		LLMApiKey:           llmKey,
 		LLMProvider:         llmProvider,
 		LLMModel:            llmModel,
 		SnoozeCheckInterval: snoozeInterval,
-		KanbanColumns:       cols,
+		KanbanUndoDepth:     getInt("KANBAN_UNDO_DEPTH", 20),
+		KanbanUndoWindow:    getDuration("KANBAN_UNDO_WINDOW", 15*time.Minute),
+		AutoArchiveInterval: getOptionalDuration("AUTO_ARCHIVE_INTERVAL", time.Hour),
 
 		// Week 4: Embedding config
 		EmbeddingProvider: getEnv("EMBEDDING_PROVIDER", "openai"),
 		EmbeddingAPIKey:   getEnv("EMBEDDING_API_KEY", ""),
 		EmbeddingModel:    getEnv("EMBEDDING_MODEL", "text-embedding-ada-002"),
+		EmbeddingBaseURL:  getEnv("EMBEDDING_BASE_URL", "http://localhost:11434/v1"),
+
+		EmbeddingIndexInterval:  getOptionalDuration("EMBEDDING_INDEX_INTERVAL", time.Minute),
+		EmbeddingIndexBatchSize: getInt("EMBEDDING_INDEX_BATCH_SIZE", 0),
+
+		VectorSearchEnabled:       getEnv("ATLAS_VECTOR_SEARCH", "false") == "true",
+		VectorSearchIndex:         getEnv("ATLAS_VECTOR_INDEX", "email_embedding_index"),
+		VectorSearchNumCandidates: getInt("ATLAS_VECTOR_NUM_CANDIDATES", 200),
+		SemanticMinScore:          getFloat("SEMANTIC_MIN_SCORE", 0.25),
+
+		TokenEncryptionKeyID:      getEnv("TOKEN_ENCRYPTION_KEY_ID", ""),
+		TokenEncryptionKeys:       tokenKeys,
+		SyncTimeout:               syncTimeout,
+		EmailSyncQueueSize:        getInt("EMAIL_SYNC_QUEUE_SIZE", 100),
+		EmailRetention:            emailRetention,
+		CleanupInterval:           cleanupInterval,
+		AdminEmails:               splitCSV(getEnv("ADMIN_EMAILS", "")),
+		PublicCacheMaxAge:         publicCacheMaxAge,
+		GmailWebURL:               getEnv("GMAIL_WEB_URL", "https://mail.google.com/mail/u/0/"),
+		AttachmentOnlyPlaceholder: getEnv("ATTACHMENT_ONLY_PLACEHOLDER", "true") == "true",
+		GmailLabelCacheTTL:        labelCacheTTL,
+		GmailRetryAttempts:        max(getInt("GMAIL_RETRY_ATTEMPTS", 4), 1),
+		GmailRetryMaxDelay:        getDuration("GMAIL_RETRY_MAX_DELAY", 8*time.Second),
+		EnableDebugEndpoints:      getEnv("ENABLE_DEBUG_ENDPOINTS", "false") == "true",
+
+		// Gmail push notifications
+		GmailPubSubTopic:        getEnv("GMAIL_PUBSUB_TOPIC", ""),
+		GmailWatchRenewInterval: watchRenewInterval,
+		GmailWatchRenewMargin:   watchRenewMargin,
+		GmailWebhookToken:       getEnv("GMAIL_WEBHOOK_TOKEN", ""),
+
+		// Auto-summarize queue
+		AutoSummarize:         getEnv("AUTO_SUMMARIZE", "false") == "true",
+		AutoSummarizeMinChars: getInt("AUTO_SUMMARIZE_MIN_CHARS", 200),
+		SummaryJobInterval:    getDuration("SUMMARY_JOB_INTERVAL", 2*time.Second),
+		SummaryJobMaxAttempts: getInt("SUMMARY_JOB_MAX_ATTEMPTS", 3),
+
+		AIComposeDailyQuota: getInt("AI_COMPOSE_DAILY_QUOTA", 30),
+
+		SecurityLLMCheck: getEnv("SECURITY_LLM_CHECK", "false") == "true",
+
+		CategoryLLM: getEnv("CATEGORY_LLM", "false") == "true",
+
+		LLMMonthlyTokenCap: getInt("LLM_MONTHLY_TOKEN_CAP", 0),
+
+		// Web Push
+		VAPIDPublicKey:  getEnv("VAPID_PUBLIC_KEY", ""),
+		VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:    getEnv("VAPID_SUBJECT", ""),
+		WebPushTTL:      getOptionalDuration("WEB_PUSH_TTL", 24*time.Hour),
+
+		// Outbound webhooks
+		WebhooksEnabled:         getEnv("WEBHOOKS_ENABLED", "false") == "true",
+		WebhookDeliveryInterval: getDuration("WEBHOOK_DELIVERY_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts:      max(getInt("WEBHOOK_MAX_ATTEMPTS", 6), 1),
+		WebhooksAllowPrivate:    getEnv("WEBHOOKS_ALLOW_PRIVATE", "false") == "true",
 	}
 }
 
@@ -90,3 +276,165 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// IsDevelopment reports whether the server runs in development. Only an explicit
+// APP_ENV=development counts; an unset or unknown APP_ENV is treated as production.
+func (c *Config) IsDevelopment() bool {
+	return c.Env == "development"
+}
+
+// EmbeddingConfigured reports whether embeddings can be generated: the local provider needs no
+// API key
+func (c *Config) EmbeddingConfigured() bool {
+	return c.EmbeddingAPIKey != "" || strings.EqualFold(c.EmbeddingProvider, "local")
+}
+
+// WebPushConfigured reports whether a VAPID key pair is set
+func (c *Config) WebPushConfigured() bool {
+	return c.VAPIDPublicKey != "" && c.VAPIDPrivateKey != ""
+}
+
+// IsAdmin reports whether email is listed in AdminEmails (case-insensitive)
+func (c *Config) IsAdmin(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	for _, admin := range c.AdminEmails {
+		if strings.ToLower(admin) == email {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks required settings so the server fails fast instead of booting into a
+// broken or insecure state. Unless APP_ENV=development, missing secrets are errors.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.MongoDBURI == "" {
+		problems = append(problems, "MONGODB_URI is required")
+	}
+	switch c.JWTAlg {
+	case "HS256":
+	case "RS256":
+		if c.JWTPrivateKeyPath == "" {
+			problems = append(problems, "JWT_PRIVATE_KEY_PATH is required when JWT_ALG is RS256")
+		}
+	default:
+		problems = append(problems, "JWT_ALG must be HS256 or RS256")
+	}
+	// RS256 doesn't use the secret
+	hs256 := c.JWTAlg == "HS256"
+
+	if !c.IsDevelopment() {
+		if hs256 && (c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret) {
+			problems = append(problems, "JWT_SECRET must be set to a non-default value")
+		}
+		// Google auth routes are always registered
+		if c.GoogleClientID == "" || c.GoogleClientSecret == "" {
+			problems = append(problems, "GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET are required")
+		}
+		// The push webhook is public; without a secret anyone could trigger syncs
+		if c.GmailPubSubTopic != "" && c.GmailWebhookToken == "" {
+			problems = append(problems, "GMAIL_WEBHOOK_TOKEN is required when GMAIL_PUBSUB_TOPIC is set")
+		}
+		// Push services reject VAPID requests without a contact
+		if c.WebPushConfigured() && c.VAPIDSubject == "" {
+			problems = append(problems, "VAPID_SUBJECT is required when VAPID keys are set")
+		}
+	} else {
+		if hs256 && c.JWTSecret == defaultJWTSecret {
+			log.Println("WARNING: using the default JWT_SECRET; it is rejected unless APP_ENV=development")
+		}
+		if c.GoogleClientID == "" || c.GoogleClientSecret == "" {
+			log.Println("WARNING: Google OAuth credentials are not set; Google sign-in will fail")
+		}
+		if c.GmailPubSubTopic != "" && c.GmailWebhookToken == "" {
+			log.Println("WARNING: GMAIL_WEBHOOK_TOKEN is not set; Gmail push notifications will be rejected")
+		}
+		if c.WebPushConfigured() && c.VAPIDSubject == "" {
+			log.Println("WARNING: VAPID_SUBJECT is not set; push services may reject Web Push messages")
+		}
+	}
+
+	if c.WebhooksEnabled && c.WebhooksAllowPrivate {
+		log.Println("WARNING: WEBHOOKS_ALLOW_PRIVATE is set; webhooks may target plain http and internal addresses")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration (APP_ENV=%s): %s", c.Env, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// getDuration parses a positive Go duration, falling back to defaultValue (with a warning)
+// when the variable is unset, malformed, or not positive
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using default %s", key, raw, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getOptionalDuration is like getDuration but accepts 0 (used to disable a feature)
+func getOptionalDuration(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s=%q, using default %s", key, raw, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getInt parses a non-negative integer, falling back to defaultValue (with a warning)
+// when the variable is unset or malformed
+func getInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s=%q, using default %d", key, raw, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getFloat parses a float, falling back to defaultValue (with a warning) when the variable is
+// unset or malformed
+func getFloat(key string, defaultValue float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %g", key, raw, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// splitCSV splits a comma-separated value and drops empty entries
+func splitCSV(raw string) []string {
+	out := []string{}
+	for _, p := range strings.Split(raw, ",") {
+		if t := strings.TrimSpace(p); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
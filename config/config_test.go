@@ -0,0 +1,331 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppEnvDefaultsToProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_ALG", "")
+	t.Setenv("GOOGLE_CLIENT_ID", "")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "")
+
+	cfg := Load()
+	if cfg.Env != "production" || cfg.IsDevelopment() {
+		t.Fatalf("Env = %q, want production by default", cfg.Env)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted the default JWT_SECRET without APP_ENV")
+	}
+}
+
+func TestValidateByEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		wantErr bool
+	}{
+		{"development", false},
+		{"DEVELOPMENT", false},
+		{"production", true},
+		{"dev", true},
+		{"local", true},
+		{"staging", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.env)
+			t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+			t.Setenv("JWT_SECRET", "")
+			t.Setenv("JWT_ALG", "")
+
+			err := Load().Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// loadEnv sets every variable Load reads, so the test doesn't depend on the environment
+var loadEnv = map[string]string{
+	"APP_ENV":                     "Development",
+	"PORT":                        "9090",
+	"JWT_SECRET":                  "s3cret",
+	"JWT_ALG":                     "rs256",
+	"JWT_PRIVATE_KEY_PATH":        "/keys/private.pem",
+	"JWT_PUBLIC_KEY_PATH":         "/keys/public.pem",
+	"JWT_ACCESS_EXPIRATION":       "5m",
+	"JWT_REFRESH_EXPIRATION":      "72h",
+	"JWT_REFRESH_REUSE_WINDOW":    "0s",
+	"GOOGLE_CLIENT_ID":            "client-id",
+	"GOOGLE_CLIENT_SECRET":        "client-secret",
+	"FRONTEND_URL":                "https://app.example.com",
+	"ALLOWED_ORIGINS":             "https://app.example.com, https://*.example.com,",
+	"MONGODB_URI":                 "mongodb://db:27017",
+	"MONGODB_DATABASE":            "inbox",
+	"LLM_API_KEY":                 "llm-key",
+	"LLM_PROVIDER":                "gemini",
+	"LLM_MODEL":                   "gemini-1.5-flash",
+	"SNOOZE_CHECK_INTERVAL":       "30s",
+	"KANBAN_UNDO_DEPTH":           "5",
+	"KANBAN_UNDO_WINDOW":          "10m",
+	"AUTO_ARCHIVE_INTERVAL":       "0",
+	"EMBEDDING_PROVIDER":          "local",
+	"EMBEDDING_API_KEY":           "emb-key",
+	"EMBEDDING_MODEL":             "nomic-embed-text",
+	"EMBEDDING_BASE_URL":          "http://ollama:11434/v1",
+	"EMBEDDING_INDEX_INTERVAL":    "2m",
+	"EMBEDDING_INDEX_BATCH_SIZE":  "8",
+	"ATLAS_VECTOR_SEARCH":         "true",
+	"ATLAS_VECTOR_INDEX":          "vec",
+	"ATLAS_VECTOR_NUM_CANDIDATES": "50",
+	"SEMANTIC_MIN_SCORE":          "0.4",
+	"TOKEN_ENCRYPTION_KEY_ID":     "k2",
+	"TOKEN_ENCRYPTION_KEYS":       "k1:AAAA, k2 : BBBB, broken",
+	"SYNC_TIMEOUT":                "90s",
+	"EMAIL_SYNC_QUEUE_SIZE":       "10",
+	"EMAIL_RETENTION":             "720h",
+	"CLEANUP_INTERVAL":            "6h",
+	"ADMIN_EMAILS":                "root@example.com,ops@example.com",
+	"PUBLIC_CACHE_MAX_AGE":        "1m",
+	"GMAIL_WEB_URL":               "https://mail.google.com/a/example.com/",
+	"ATTACHMENT_ONLY_PLACEHOLDER": "false",
+	"GMAIL_LABEL_CACHE_TTL":       "0",
+	"GMAIL_RETRY_ATTEMPTS":        "2",
+	"GMAIL_RETRY_MAX_DELAY":       "3s",
+	"ENABLE_DEBUG_ENDPOINTS":      "true",
+	"GMAIL_PUBSUB_TOPIC":          "projects/p/topics/t",
+	"GMAIL_WATCH_RENEW_INTERVAL":  "2h",
+	"GMAIL_WATCH_RENEW_MARGIN":    "12h",
+	"GMAIL_WEBHOOK_TOKEN":         "push-token",
+	"AUTO_SUMMARIZE":              "true",
+	"AUTO_SUMMARIZE_MIN_CHARS":    "400",
+	"SUMMARY_JOB_INTERVAL":        "500ms",
+	"SUMMARY_JOB_MAX_ATTEMPTS":    "7",
+	"AI_COMPOSE_DAILY_QUOTA":      "0",
+	"SECURITY_LLM_CHECK":          "true",
+	"CATEGORY_LLM":                "true",
+	"LLM_MONTHLY_TOKEN_CAP":       "100000",
+	"VAPID_PUBLIC_KEY":            "vapid-public",
+	"VAPID_PRIVATE_KEY":           "vapid-private",
+	"VAPID_SUBJECT":               "mailto:ops@example.com",
+	"WEB_PUSH_TTL":                "1h",
+	"WEBHOOKS_ENABLED":            "true",
+	"WEBHOOK_DELIVERY_INTERVAL":   "10s",
+	"WEBHOOK_MAX_ATTEMPTS":        "3",
+	"WEBHOOKS_ALLOW_PRIVATE":      "true",
+}
+
+func TestLoadReadsEveryVariable(t *testing.T) {
+	for k, v := range loadEnv {
+		t.Setenv(k, v)
+	}
+	cfg := Load()
+
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"Env", cfg.Env, "development"},
+		{"Port", cfg.Port, "9090"},
+		{"JWTSecret", cfg.JWTSecret, "s3cret"},
+		{"JWTAlg", cfg.JWTAlg, "RS256"},
+		{"JWTPrivateKeyPath", cfg.JWTPrivateKeyPath, "/keys/private.pem"},
+		{"JWTPublicKeyPath", cfg.JWTPublicKeyPath, "/keys/public.pem"},
+		{"JWTAccessExpiration", cfg.JWTAccessExpiration, 5 * time.Minute},
+		{"JWTRefreshExpiration", cfg.JWTRefreshExpiration, 72 * time.Hour},
+		{"JWTRefreshReuseWindow", cfg.JWTRefreshReuseWindow, time.Duration(0)},
+		{"GoogleClientID", cfg.GoogleClientID, "client-id"},
+		{"GoogleClientSecret", cfg.GoogleClientSecret, "client-secret"},
+		{"FrontendURL", cfg.FrontendURL, "https://app.example.com"},
+		{"AllowedOrigins", cfg.AllowedOrigins, []string{"https://app.example.com", "https://*.example.com"}},
+		{"MongoDBURI", cfg.MongoDBURI, "mongodb://db:27017"},
+		{"MongoDBDatabase", cfg.MongoDBDatabase, "inbox"},
+		{"LLMApiKey", cfg.LLMApiKey, "llm-key"},
+		{"LLMProvider", cfg.LLMProvider, "gemini"},
+		{"LLMModel", cfg.LLMModel, "gemini-1.5-flash"},
+		{"SnoozeCheckInterval", cfg.SnoozeCheckInterval, 30 * time.Second},
+		{"KanbanUndoDepth", cfg.KanbanUndoDepth, 5},
+		{"KanbanUndoWindow", cfg.KanbanUndoWindow, 10 * time.Minute},
+		{"AutoArchiveInterval", cfg.AutoArchiveInterval, time.Duration(0)},
+		{"EmbeddingProvider", cfg.EmbeddingProvider, "local"},
+		{"EmbeddingAPIKey", cfg.EmbeddingAPIKey, "emb-key"},
+		{"EmbeddingModel", cfg.EmbeddingModel, "nomic-embed-text"},
+		{"EmbeddingBaseURL", cfg.EmbeddingBaseURL, "http://ollama:11434/v1"},
+		{"EmbeddingIndexInterval", cfg.EmbeddingIndexInterval, 2 * time.Minute},
+		{"EmbeddingIndexBatchSize", cfg.EmbeddingIndexBatchSize, 8},
+		{"VectorSearchEnabled", cfg.VectorSearchEnabled, true},
+		{"VectorSearchIndex", cfg.VectorSearchIndex, "vec"},
+		{"VectorSearchNumCandidates", cfg.VectorSearchNumCandidates, 50},
+		{"SemanticMinScore", cfg.SemanticMinScore, 0.4},
+		{"TokenEncryptionKeyID", cfg.TokenEncryptionKeyID, "k2"},
+		{"TokenEncryptionKeys", cfg.TokenEncryptionKeys, map[string]string{"k1": "AAAA", "k2": "BBBB"}},
+		{"SyncTimeout", cfg.SyncTimeout, 90 * time.Second},
+		{"EmailSyncQueueSize", cfg.EmailSyncQueueSize, 10},
+		{"EmailRetention", cfg.EmailRetention, 720 * time.Hour},
+		{"CleanupInterval", cfg.CleanupInterval, 6 * time.Hour},
+		{"AdminEmails", cfg.AdminEmails, []string{"root@example.com", "ops@example.com"}},
+		{"PublicCacheMaxAge", cfg.PublicCacheMaxAge, time.Minute},
+		{"GmailWebURL", cfg.GmailWebURL, "https://mail.google.com/a/example.com/"},
+		{"AttachmentOnlyPlaceholder", cfg.AttachmentOnlyPlaceholder, false},
+		{"GmailLabelCacheTTL", cfg.GmailLabelCacheTTL, time.Duration(0)},
+		{"GmailRetryAttempts", cfg.GmailRetryAttempts, 2},
+		{"GmailRetryMaxDelay", cfg.GmailRetryMaxDelay, 3 * time.Second},
+		{"EnableDebugEndpoints", cfg.EnableDebugEndpoints, true},
+		{"GmailPubSubTopic", cfg.GmailPubSubTopic, "projects/p/topics/t"},
+		{"GmailWatchRenewInterval", cfg.GmailWatchRenewInterval, 2 * time.Hour},
+		{"GmailWatchRenewMargin", cfg.GmailWatchRenewMargin, 12 * time.Hour},
+		{"GmailWebhookToken", cfg.GmailWebhookToken, "push-token"},
+		{"AutoSummarize", cfg.AutoSummarize, true},
+		{"AutoSummarizeMinChars", cfg.AutoSummarizeMinChars, 400},
+		{"SummaryJobInterval", cfg.SummaryJobInterval, 500 * time.Millisecond},
+		{"SummaryJobMaxAttempts", cfg.SummaryJobMaxAttempts, 7},
+		{"AIComposeDailyQuota", cfg.AIComposeDailyQuota, 0},
+		{"SecurityLLMCheck", cfg.SecurityLLMCheck, true},
+		{"CategoryLLM", cfg.CategoryLLM, true},
+		{"LLMMonthlyTokenCap", cfg.LLMMonthlyTokenCap, 100000},
+		{"VAPIDPublicKey", cfg.VAPIDPublicKey, "vapid-public"},
+		{"VAPIDPrivateKey", cfg.VAPIDPrivateKey, "vapid-private"},
+		{"VAPIDSubject", cfg.VAPIDSubject, "mailto:ops@example.com"},
+		{"WebPushTTL", cfg.WebPushTTL, time.Hour},
+		{"WebhooksEnabled", cfg.WebhooksEnabled, true},
+		{"WebhookDeliveryInterval", cfg.WebhookDeliveryInterval, 10 * time.Second},
+		{"WebhookMaxAttempts", cfg.WebhookMaxAttempts, 3},
+		{"WebhooksAllowPrivate", cfg.WebhooksAllowPrivate, true},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.field, tt.got, tt.want)
+		}
+	}
+	// Every field of Config is covered above
+	if n := reflect.TypeOf(*cfg).NumField(); n != len(tests) {
+		t.Errorf("checked %d fields, Config has %d", len(tests), n)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	for k := range loadEnv {
+		t.Setenv(k, "")
+	}
+	cfg := Load()
+
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"Env", cfg.Env, "production"},
+		{"Port", cfg.Port, "8080"},
+		{"JWTSecret", cfg.JWTSecret, defaultJWTSecret},
+		{"JWTAlg", cfg.JWTAlg, "HS256"},
+		{"JWTAccessExpiration", cfg.JWTAccessExpiration, 15 * time.Minute},
+		{"JWTRefreshExpiration", cfg.JWTRefreshExpiration, 168 * time.Hour},
+		{"AllowedOrigins", cfg.AllowedOrigins, []string{"http://localhost:3000"}},
+		{"EmbeddingProvider", cfg.EmbeddingProvider, "openai"},
+		{"SemanticMinScore", cfg.SemanticMinScore, 0.25},
+		{"TokenEncryptionKeys", cfg.TokenEncryptionKeys, map[string]string{}},
+		{"EmailRetention", cfg.EmailRetention, time.Duration(0)},
+		{"GmailLabelCacheTTL", cfg.GmailLabelCacheTTL, 30 * time.Second},
+		{"AttachmentOnlyPlaceholder", cfg.AttachmentOnlyPlaceholder, true},
+		{"AdminEmails", cfg.AdminEmails, []string{}},
+		{"GmailRetryAttempts", cfg.GmailRetryAttempts, 4},
+		{"AIComposeDailyQuota", cfg.AIComposeDailyQuota, 30},
+		{"WebhookMaxAttempts", cfg.WebhookMaxAttempts, 6},
+		{"WebhooksAllowPrivate", cfg.WebhooksAllowPrivate, false},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEnvHelpers(t *testing.T) {
+	t.Run("getDuration", func(t *testing.T) {
+		tests := []struct {
+			raw  string
+			want time.Duration
+		}{
+			{"", time.Minute},
+			{"90s", 90 * time.Second},
+			{"0", time.Minute},
+			{"-5s", time.Minute},
+			{"soon", time.Minute},
+		}
+		for _, tt := range tests {
+			t.Setenv("TEST_DURATION", tt.raw)
+			if got := getDuration("TEST_DURATION", time.Minute); got != tt.want {
+				t.Errorf("getDuration(%q) = %s, want %s", tt.raw, got, tt.want)
+			}
+		}
+	})
+	t.Run("getOptionalDuration", func(t *testing.T) {
+		tests := []struct {
+			raw  string
+			want time.Duration
+		}{
+			{"", time.Minute},
+			{"0", 0},
+			{"2h", 2 * time.Hour},
+			{"-1s", time.Minute},
+			{"never", time.Minute},
+		}
+		for _, tt := range tests {
+			t.Setenv("TEST_DURATION", tt.raw)
+			if got := getOptionalDuration("TEST_DURATION", time.Minute); got != tt.want {
+				t.Errorf("getOptionalDuration(%q) = %s, want %s", tt.raw, got, tt.want)
+			}
+		}
+	})
+	t.Run("getInt", func(t *testing.T) {
+		tests := []struct {
+			raw  string
+			want int
+		}{
+			{"", 20},
+			{"0", 0},
+			{"42", 42},
+			{"-3", 20},
+			{"4.5", 20},
+			{"many", 20},
+		}
+		for _, tt := range tests {
+			t.Setenv("TEST_INT", tt.raw)
+			if got := getInt("TEST_INT", 20); got != tt.want {
+				t.Errorf("getInt(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		}
+	})
+	t.Run("getFloat", func(t *testing.T) {
+		tests := []struct {
+			raw  string
+			want float64
+		}{
+			{"", 0.25},
+			{"0.5", 0.5},
+			{"-0.1", -0.1},
+			{"1e-2", 0.01},
+			{"half", 0.25},
+		}
+		for _, tt := range tests {
+			t.Setenv("TEST_FLOAT", tt.raw)
+			if got := getFloat("TEST_FLOAT", 0.25); got != tt.want {
+				t.Errorf("getFloat(%q) = %g, want %g", tt.raw, got, tt.want)
+			}
+		}
+	})
+	t.Run("splitCSV", func(t *testing.T) {
+		if got := splitCSV(" a, ,b,,c "); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("splitCSV = %q, want [a b c]", got)
+		}
+		if got := splitCSV(""); got == nil || len(got) != 0 {
+			t.Errorf("splitCSV(\"\") = %#v, want an empty slice", got)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler exposes maintenance endpoints restricted to admins
+type AdminHandler struct {
+	emailRepo *repository.EmailRepository
+	summary   services.SummaryService
+	indexer   *services.EmbeddingIndexer
+	cfg       *config.Config
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(emailRepo *repository.EmailRepository, summary services.SummaryService, indexer *services.EmbeddingIndexer, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{emailRepo: emailRepo, summary: summary, indexer: indexer, cfg: cfg}
+}
+
+// Cleanup godoc
+// @Summary Delete stale cached emails
+// @Description Runs the retention cleanup immediately and reports how many emails were deleted
+// @Tags admin
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/cleanup [post]
+func (h *AdminHandler) Cleanup(c *gin.Context) {
+	if h.cfg.EmailRetention <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email retention is disabled"})
+		return
+	}
+
+	cutoff := time.Now().Add(-h.cfg.EmailRetention)
+	deleted, err := h.emailRepo.DeleteStale(c.Request.Context(), cutoff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clean up emails: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted": deleted,
+		"cutoff":  cutoff,
+	})
+}
+
+// Metrics godoc
+// @Summary Server metrics
+// @Description Reports in-process counters since startup: summary cache hits and misses, and emails embedded vs. skipped because their content hash was unchanged
+// @Tags admin
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/metrics [get]
+func (h *AdminHandler) Metrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"summaryCache": h.summary.CacheStats(),
+		"embeddings":   h.indexer.Stats(),
+	})
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// featureCompose is the usage counter key for compose-assist
+const featureCompose = "compose"
+
+// AIHandler exposes LLM-backed features on individual emails and drafting
+type AIHandler struct {
+	emailRepo   *repository.EmailRepository
+	actionItems *services.ActionItemService
+	compose     *services.ComposeService
+	summary     services.SummaryService
+	events      *services.EventService
+	usage       *repository.AIUsageRepository
+	cfg         *config.Config
+}
+
+// NewAIHandler creates a new AI handler
+func NewAIHandler(emailRepo *repository.EmailRepository, actionItems *services.ActionItemService, compose *services.ComposeService, summary services.SummaryService, events *services.EventService, usage *repository.AIUsageRepository, cfg *config.Config) *AIHandler {
+	return &AIHandler{
+		emailRepo:   emailRepo,
+		actionItems: actionItems,
+		compose:     compose,
+		summary:     summary,
+		events:      events,
+		usage:       usage,
+		cfg:         cfg,
+	}
+}
+
+// ComposeAssistRequest asks for a new draft, or a refinement when previousDraft is set
+type ComposeAssistRequest struct {
+	Instructions  string `json:"instructions"`
+	Tone          string `json:"tone"` // neutral (default), formal, friendly, concise, casual
+	RecipientName string `json:"recipientName"`
+	ThreadContext string `json:"threadContext,omitempty"`
+	// Refine mode: the draft to revise and what to change ("make it shorter", "more formal")
+	PreviousDraft *services.ComposeDraft `json:"previousDraft,omitempty"`
+	Edit          string                 `json:"edit,omitempty"`
+}
+
+// ComposeAssistResponse is a generated draft plus the caller's quota state
+type ComposeAssistResponse struct {
+	Subject    string `json:"subject"`
+	Body       string `json:"body"`
+	Mode       string `json:"mode"` // "draft" or "refine"
+	UsedToday  int    `json:"usedToday"`
+	DailyQuota int    `json:"dailyQuota"` // 0 means unlimited
+}
+
+// ExtractEventRequest optionally gives the user's time zone for relative dates
+type ExtractEventRequest struct {
+	TimeZone string `json:"timezone"` // IANA name, e.g. "Asia/Ho_Chi_Minh"; default UTC
+}
+
+// ExtractEventResponse is the extracted event plus the same event as an .ics file
+type ExtractEventResponse struct {
+	Event  *models.CalendarEvent `json:"event"`
+	Source string                `json:"source"` // "ics" (invitation) or "llm" (email text)
+	ICS    string                `json:"ics"`
+}
+
+// ownedEmail loads an email and checks it belongs to the authenticated user, writing the
+// error response itself. Returns nil when the handler should stop.
+func (h *AIHandler) ownedEmail(c *gin.Context) *models.Email {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return nil
+	}
+
+	email, err := h.emailRepo.GetByID(c.Request.Context(), c.Param("emailId"))
+	if err != nil || email.UserID != userID.(string) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "Email not found",
+		})
+		return nil
+	}
+	return email
+}
+
+// ExtractActionItems godoc
+// @Summary      Extract action items from an email
+// @Description  Asks the configured LLM for the email's concrete tasks (title, optional due date and assignee), falling back to local extraction without an API key. The items are stored on the email and shown on its Kanban card.
+// @Tags         ai
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/action-items [post]
+func (h *AIHandler) ExtractActionItems(c *gin.Context) {
+	email := h.ownedEmail(c)
+	if email == nil {
+		return
+	}
+
+	items, err := h.actionItems.ExtractAndSave(c.Request.Context(), email.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "extraction_failed",
+			Message: "Failed to extract action items: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"emailId": email.ID, "actionItems": items})
+}
+
+// ComposeAssist godoc
+// @Summary      Draft or refine an email with AI
+// @Description  Generates a subject and body from instructions, tone, recipient and optional thread context. Passing previousDraft and edit refines an earlier draft instead. Each call counts against a per-user daily quota.
+// @Tags         ai
+// @Accept       json
+// @Produce      json
+// @Param        request  body      handlers.ComposeAssistRequest  true  "Compose request"
+// @Success      200  {object}  handlers.ComposeAssistResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      502  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/compose-assist [post]
+func (h *AIHandler) ComposeAssist(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req ComposeAssistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	in := services.ComposeInput{
+		Instructions:  req.Instructions,
+		Tone:          req.Tone,
+		RecipientName: req.RecipientName,
+		ThreadContext: req.ThreadContext,
+		PreviousDraft: req.PreviousDraft,
+		Edit:          req.Edit,
+	}
+	if err := in.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if !h.compose.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "llm_not_configured",
+			Message: "AI compose requires an LLM provider (LLM_API_KEY)",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	quota := h.cfg.AIComposeDailyQuota
+	used, err := h.usage.Reserve(ctx, userID.(string), featureCompose, quota)
+	if errors.Is(err, repository.ErrQuotaExceeded) {
+		// quotas reset at midnight UTC
+		now := time.Now().UTC()
+		reset := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		c.Header("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error:   "quota_exceeded",
+			Message: "Daily AI compose quota of " + strconv.Itoa(quota) + " requests reached",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to check AI usage: " + err.Error(),
+		})
+		return
+	}
+
+	draft, err := h.compose.Compose(ctx, in)
+	if err != nil {
+		// failed generations don't count against the quota
+		if rerr := h.usage.Release(context.WithoutCancel(ctx), userID.(string), featureCompose); rerr != nil {
+			log.Println("compose assist: failed to release quota:", rerr)
+		}
+		var capErr *services.UsageCapError
+		if errors.As(err, &capErr) {
+			c.JSON(http.StatusPaymentRequired, capErr.Response())
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "llm_error",
+			Message: "Failed to generate draft: " + err.Error(),
+		})
+		return
+	}
+
+	mode := "draft"
+	if in.PreviousDraft != nil {
+		mode = "refine"
+	}
+	c.JSON(http.StatusOK, ComposeAssistResponse{
+		Subject:    draft.Subject,
+		Body:       draft.Body,
+		Mode:       mode,
+		UsedToday:  used,
+		DailyQuota: quota,
+	})
+}
+
+// ThreadSummary godoc
+// @Summary      Summarize an email thread
+// @Description  Summarizes the whole conversation in chronological order. The summary is stored and only regenerated when new messages arrive in the thread.
+// @Tags         ai
+// @Produce      json
+// @Param        threadId  path      string  true  "Gmail thread ID"
+// @Success      200  {object}  models.ThreadSummary
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /threads/{threadId}/summary [get]
+func (h *AIHandler) ThreadSummary(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+
+	summary, err := h.summary.SummarizeThread(ctx, userID.(string), c.Param("threadId"))
+	if errors.Is(err, services.ErrThreadNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "thread_not_found",
+			Message: "Thread not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "summary_failed",
+			Message: "Failed to summarize thread: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ExtractEvent godoc
+// @Summary      Extract a calendar event from an email
+// @Description  Reads the email's calendar invitation (text/calendar part) or, without one, asks the LLM to find a meeting in the text, resolving relative dates in the given time zone. Returns the event as JSON and ICS; with format=ics the .ics file is downloaded instead. 422 means no unambiguous event was found.
+// @Tags         ai
+// @Accept       json
+// @Produce      json
+// @Param        emailId   path      string                        true   "Email ID"
+// @Param        format    query     string                        false  "json (default) or ics"
+// @Param        request   body      handlers.ExtractEventRequest  false  "Time zone"
+// @Success      200  {object}  handlers.ExtractEventResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      422  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/extract-event [post]
+func (h *AIHandler) ExtractEvent(c *gin.Context) {
+	email := h.ownedEmail(c)
+	if email == nil {
+		return
+	}
+
+	var req ExtractEventRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "Invalid request body",
+			})
+			return
+		}
+	}
+	loc := time.UTC
+	if req.TimeZone != "" {
+		l, err := time.LoadLocation(req.TimeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "Unknown time zone " + req.TimeZone,
+			})
+			return
+		}
+		loc = l
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	result, err := h.events.Extract(ctx, email, loc)
+	var noEvent *services.NoEventError
+	var capErr *services.UsageCapError
+	switch {
+	case errors.As(err, &capErr):
+		c.JSON(http.StatusPaymentRequired, capErr.Response())
+		return
+	case errors.As(err, &noEvent):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error:   "no_event",
+			Message: noEvent.Reason,
+		})
+		return
+	case errors.Is(err, services.ErrLLMNotConfigured):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error:   "no_event",
+			Message: "The email has no calendar invitation (reading events from the text requires an LLM provider)",
+		})
+		return
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "Email not found in Gmail",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "extraction_failed",
+			Message: "Failed to extract event: " + err.Error(),
+		})
+		return
+	}
+
+	ics := services.BuildICS(result.Event)
+	if c.Query("format") == "ics" {
+		c.Header("Content-Disposition", `attachment; filename="event.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+		return
+	}
+	c.JSON(http.StatusOK, ExtractEventResponse{Event: result.Event, Source: result.Source, ICS: ics})
+}
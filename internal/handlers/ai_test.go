@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// replyLLM is an LLM provider answering every request with reply, or err when set
+type replyLLM struct {
+	reply string
+	err   error
+}
+
+func (p *replyLLM) Name() string  { return "fake" }
+func (p *replyLLM) Model() string { return "fake-1" }
+
+func (p *replyLLM) Generate(context.Context, services.LLMRequest) (string, error) {
+	return p.reply, p.err
+}
+
+func TestComposeAssistQuota(t *testing.T) {
+	db := testutil.MongoDB(t)
+	usage := repository.NewAIUsageRepository(db)
+	cfg := &config.Config{AIComposeDailyQuota: 2}
+	llm := &replyLLM{reply: `{"subject":"Lunch","body":"Hi, lunch at 12?"}`}
+	h := NewAIHandler(nil, nil, services.NewComposeService(llm), nil, nil, usage, cfg)
+	const body = `{"instructions":"Invite Lan to lunch"}`
+
+	for i := 1; i <= 2; i++ {
+		w := serveJSON(h.ComposeAssist, "u1", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("call %d: status = %d, body %s", i, w.Code, w.Body)
+		}
+		var resp ComposeAssistResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.UsedToday != i || resp.DailyQuota != 2 || resp.Mode != "draft" || resp.Subject != "Lunch" {
+			t.Errorf("call %d: response = %+v", i, resp)
+		}
+	}
+
+	w := serveJSON(h.ComposeAssist, "u1", body)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("over quota: status = %d, Retry-After %q, want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	var errResp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil || errResp.Error != "quota_exceeded" {
+		t.Errorf("over quota: body %s", w.Body)
+	}
+
+	// Quotas are per user
+	if w := serveJSON(h.ComposeAssist, "u2", body); w.Code != http.StatusOK {
+		t.Errorf("other user: status = %d, want 200", w.Code)
+	}
+
+	// Failed generations give their reservation back
+	llm.err = errors.New("provider down")
+	if w := serveJSON(h.ComposeAssist, "u3", body); w.Code != http.StatusBadGateway {
+		t.Fatalf("failing provider: status = %d, want 502", w.Code)
+	}
+	llm.err = nil
+	for i := 1; i <= 2; i++ {
+		if w := serveJSON(h.ComposeAssist, "u3", body); w.Code != http.StatusOK {
+			t.Errorf("u3 call %d after a failure: status = %d, want 200", i, w.Code)
+		}
+	}
+
+	// Invalid requests are rejected before they count
+	if w := serveJSON(h.ComposeAssist, "u4", `{"instructions":" "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty instructions: status = %d, want 400", w.Code)
+	}
+	if n, err := usage.Reserve(context.Background(), "u4", featureCompose, 0); err != nil || n != 1 {
+		t.Errorf("u4 usage after a rejected request = %d (err %v), want it uncounted", n, err)
+	}
+}
+
+func TestComposeAssistWithoutProvider(t *testing.T) {
+	h := NewAIHandler(nil, nil, services.NewComposeService(nil), nil, nil, nil, &config.Config{})
+	if w := serveJSON(h.ComposeAssist, "u1", `{"instructions":"Say hi"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if w := serveJSON(h.ComposeAssist, "", `{"instructions":"Say hi"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: status = %d, want 401", w.Code)
+	}
+}
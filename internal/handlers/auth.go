@@ -7,6 +7,7 @@ import (
 	"aiemailbox-be/internal/utils"
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,18 +18,32 @@ import (
 	"google.golang.org/api/option"
 )
 
+// recentRefreshTokensKept caps the rotated refresh tokens still accepted within
+// JWT_REFRESH_REUSE_WINDOW
+const recentRefreshTokensKept = 5
+
 type AuthHandler struct {
-	cfg      *config.Config
-	userRepo *repository.UserRepository
+	cfg           *config.Config
+	jwtKeys       *utils.JWTKeys
+	userRepo      *repository.UserRepository
+	notifications *repository.NotificationRepository
 }
 
-func NewAuthHandler(cfg *config.Config, userRepo *repository.UserRepository) *AuthHandler {
+func NewAuthHandler(cfg *config.Config, jwtKeys *utils.JWTKeys, userRepo *repository.UserRepository, notifications *repository.NotificationRepository) *AuthHandler {
 	return &AuthHandler{
-		cfg:      cfg,
-		userRepo: userRepo,
+		cfg:           cfg,
+		jwtKeys:       jwtKeys,
+		userRepo:      userRepo,
+		notifications: notifications,
 	}
 }
 
+// MeResponse is the current user with their unread notification count
+type MeResponse struct {
+	*models.User
+	UnreadNotifications int64 `json:"unreadNotifications"`
+}
+
 // Signup handles email/password registration
 func (h *AuthHandler) Signup(c *gin.Context) {
 	var req models.SignupRequest
@@ -40,12 +55,27 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Check if user already exists
-	existingUser, err := h.userRepo.FindByEmail(ctx, req.Email)
-	if err == nil && existingUser != nil {
+	// Check if user already exists, under any provider and in any letter case: a Google
+	// account with the same address must not get a second, password-based account
+	existingUser, err := h.userRepo.FindByEmailFold(ctx, req.Email)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "server_error",
+			Message: "Failed to find user",
+		})
+		return
+	}
+	if existingUser != nil {
+		if existingUser.Provider != "email" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "user_exists",
+				Message: "An account with this email already exists; please use " + existingUser.Provider + " to sign in",
+			})
+			return
+		}
 		c.JSON(http.StatusConflict, models.ErrorResponse{
 			Error:   "user_exists",
 			Message: "User with this email already exists",
@@ -80,7 +110,7 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 	}
 
 	// Generate tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTAccessExpiration)
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTAccessExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -89,7 +119,7 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTRefreshExpiration)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTRefreshExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -127,7 +157,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Find user
@@ -167,7 +197,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Generate tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTAccessExpiration)
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTAccessExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -176,7 +206,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTRefreshExpiration)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTRefreshExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -232,7 +262,7 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 	// Note: The frontend might send "token" field name but contain the code.
 	// We should check if it looks like a code or ID token, but for this exercise we assume code flow.
 
-	token, err := conf.Exchange(context.Background(), req.Token)
+	token, err := conf.Exchange(c.Request.Context(), req.Token)
 	if err != nil {
 		// Fallback: Maybe it IS an ID Token (legacy flow)?
 		// For Track A, we MUST use code flow to get Refresh Token.
@@ -246,7 +276,7 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 	}
 
 	// Get User Info using the token
-	oauth2Service, err := googleOAuth2.NewService(context.Background(), option.WithTokenSource(conf.TokenSource(context.Background(), token)))
+	oauth2Service, err := googleOAuth2.NewService(c.Request.Context(), option.WithTokenSource(conf.TokenSource(c.Request.Context(), token)))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "google_auth_error",
@@ -264,7 +294,7 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Check if user exists
@@ -334,7 +364,7 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 	// Let's add a TODO to update the repo.
 
 	// Generate App Tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTAccessExpiration)
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTAccessExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -343,7 +373,7 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTRefreshExpiration)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTRefreshExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -386,10 +416,8 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	println("RefreshToken - Received token:", req.RefreshToken[:20]+"...")
-
 	// Validate refresh token
-	claims, err := utils.ValidateToken(req.RefreshToken, h.cfg.JWTSecret)
+	claims, err := utils.ValidateToken(req.RefreshToken, h.jwtKeys)
 	if err != nil {
 		println("RefreshToken - Token validation error:", err.Error())
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -399,8 +427,6 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	println("RefreshToken - Token validated, UserID:", claims.UserID, "TokenType:", claims.TokenType)
-
 	// Check if it's a refresh token
 	if claims.TokenType != "refresh" {
 		println("RefreshToken - Wrong token type:", claims.TokenType)
@@ -411,10 +437,9 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Find user and verify stored refresh token
 	user, err := h.userRepo.FindByID(ctx, claims.UserID)
 	if err != nil {
 		println("RefreshToken - User not found error:", err.Error(), "UserID:", claims.UserID)
@@ -425,22 +450,8 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	println("RefreshToken - User found:", user.ID.Hex(), "Email:", user.Email)
-	println("RefreshToken - Stored token:", user.RefreshToken[:20]+"...")
-	println("RefreshToken - Request token:", req.RefreshToken[:20]+"...")
-	println("RefreshToken - Tokens match:", user.RefreshToken == req.RefreshToken)
-
-	if user.RefreshToken != req.RefreshToken {
-		println("RefreshToken - Token mismatch!")
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error:   "invalid_refresh_token",
-			Message: "Refresh token not found or revoked",
-		})
-		return
-	}
-
 	// Generate new access token
-	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTAccessExpiration)
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTAccessExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -450,7 +461,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Generate new refresh token (rotation)
-	newRefreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.cfg.JWTSecret, h.cfg.JWTRefreshExpiration)
+	newRefreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email, h.jwtKeys, h.cfg.JWTRefreshExpiration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "token_generation_failed",
@@ -459,14 +470,23 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Update refresh token
-	if err := h.userRepo.UpdateRefreshToken(ctx, user.ID.Hex(), newRefreshToken); err != nil {
+	// Verify the stored refresh token (by hash) and rotate it in one update, so concurrent
+	// refreshes can't both replace the same token
+	rotated, err := h.userRepo.RotateRefreshToken(ctx, user.ID.Hex(), req.RefreshToken, newRefreshToken, h.cfg.JWTRefreshReuseWindow, recentRefreshTokensKept)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "server_error",
 			Message: "Failed to update refresh token",
 		})
 		return
 	}
+	if !rotated {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "invalid_refresh_token",
+			Message: "Refresh token not found or revoked",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"accessToken":  accessToken,
@@ -485,7 +505,7 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Revoke refresh token
@@ -513,7 +533,7 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -525,5 +545,76 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
+	unread, err := h.notifications.CountUnread(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "server_error",
+			Message: "Failed to count notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, MeResponse{User: user, UnreadNotifications: unread})
+}
+
+// UpdateSettings changes the current user's settings; omitted fields are left unchanged
+func (h *AuthHandler) UpdateSettings(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req models.UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if req.TimeZone != nil {
+		tz := strings.TrimSpace(*req.TimeZone)
+		// LoadLocation accepts "Local", which means the server's zone
+		if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "Unknown time zone " + tz,
+				Fields:  map[string]string{"timezone": "must be an IANA time zone name"},
+			})
+			return
+		}
+		req.TimeZone = &tz
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.userRepo.UpdateSettings(ctx, userID.(string), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "server_error",
+			Message: "Failed to update settings",
+		})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, user)
 }
+
+// JWKS publishes the public key access tokens are signed with, for services verifying them
+// on their own. With HS256 the key list is empty: the shared secret is never exposed.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.jwtKeys.JWKS())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSignupCrossProviderCollision(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	userRepo := repository.NewUserRepository(db, nil)
+	cfg := &config.Config{JWTAccessExpiration: time.Minute, JWTRefreshExpiration: time.Hour}
+	h := NewAuthHandler(cfg, utils.NewHS256Keys("test-secret"), userRepo, nil)
+
+	for _, u := range []*models.User{
+		{Email: "Bob@Example.com", Name: "Bob", Provider: "google", GoogleID: "g-bob"},
+		{Email: "carol@example.com", Name: "Carol", Provider: "email", Password: "hash"},
+	} {
+		if err := userRepo.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		email       string
+		wantCode    int
+		wantMessage string
+	}{
+		{"google account in another case", "bob@example.com", http.StatusConflict, "please use google to sign in"},
+		{"google account same case", "Bob@Example.com", http.StatusConflict, "please use google to sign in"},
+		{"email account in another case", "Carol@EXAMPLE.com", http.StatusConflict, "User with this email already exists"},
+		{"new address", "dave@example.com", http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"email":"` + tt.email + `","password":"secret123","name":"Someone"}`
+			w := serveJSON(h.Signup, "", body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusConflict {
+				return
+			}
+			var resp models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != "user_exists" || !strings.Contains(resp.Message, tt.wantMessage) {
+				t.Errorf("error = %+v, want user_exists mentioning %q", resp, tt.wantMessage)
+			}
+		})
+	}
+
+	n, err := db.Collection("users").CountDocuments(ctx, bson.M{})
+	if err != nil || n != 3 {
+		t.Errorf("users = %d (err %v), want the two existing accounts and dave", n, err)
+	}
+}
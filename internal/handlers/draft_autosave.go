@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// localDraftIDRE matches the client-generated IDs of local drafts (UUIDs, nanoids, ...)
+var localDraftIDRE = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ListLocalDrafts godoc
+// @Summary      List autosaved local drafts
+// @Description  Most recently saved first, e.g. to restore compose windows after the tab was closed
+// @Tags         drafts
+// @Produce      json
+// @Param        limit  query     int  false  "Max drafts (default 20, max 100)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/local [get]
+func (h *DraftHandler) ListLocalDrafts(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	limit := 20
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		limit = min(n, 100)
+	}
+	drafts, err := h.autosaves.List(c.Request.Context(), userID, limit)
+	if err != nil {
+		writeLocalDraftError(c, "Failed to list local drafts", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drafts": drafts})
+}
+
+// GetLocalDraft godoc
+// @Summary      Get an autosaved local draft
+// @Tags         drafts
+// @Produce      json
+// @Param        id   path      string  true  "Client-generated draft ID"
+// @Success      200  {object}  models.DraftAutosave
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/local/{id} [get]
+func (h *DraftHandler) GetLocalDraft(c *gin.Context) {
+	userID, clientID, ok := localDraftParams(c)
+	if !ok {
+		return
+	}
+	draft, err := h.autosaves.Get(c.Request.Context(), userID, clientID)
+	if err != nil {
+		writeLocalDraftError(c, "Failed to load local draft", err)
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// AutosaveDraft godoc
+// @Summary      Autosave a draft locally
+// @Description  Creates or replaces the local draft with the client-generated ID; nothing is sent to Gmail. Local drafts
+// @Description  expire 30 days after their last save.
+// @Tags         drafts
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                       true  "Client-generated draft ID"
+// @Param        request  body      models.DraftAutosaveRequest  true  "Draft content"
+// @Success      200  {object}  models.DraftAutosave
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/local/{id} [put]
+func (h *DraftHandler) AutosaveDraft(c *gin.Context) {
+	userID, clientID, ok := localDraftParams(c)
+	if !ok {
+		return
+	}
+	var req models.DraftAutosaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+		return
+	}
+	if len(req.Body) > models.DraftAutosaveMaxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "body_too_large",
+			Message: fmt.Sprintf("The body of a local draft is limited to %d KB", models.DraftAutosaveMaxBytes>>10),
+		})
+		return
+	}
+	draft, err := h.autosaves.Save(c.Request.Context(), userID, clientID, &req)
+	if err != nil {
+		writeLocalDraftError(c, "Failed to save local draft", err)
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// DeleteLocalDraft godoc
+// @Summary      Discard an autosaved local draft
+// @Description  The Gmail draft it was saved as, if any, is kept
+// @Tags         drafts
+// @Produce      json
+// @Param        id   path      string  true  "Client-generated draft ID"
+// @Success      200  {object}  map[string]bool
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/local/{id} [delete]
+func (h *DraftHandler) DeleteLocalDraft(c *gin.Context) {
+	userID, clientID, ok := localDraftParams(c)
+	if !ok {
+		return
+	}
+	if err := h.autosaves.Delete(c.Request.Context(), userID, clientID); err != nil {
+		writeLocalDraftError(c, "Failed to delete local draft", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// SaveLocalDraft godoc
+// @Summary      Save a local draft to Gmail
+// @Description  Creates a Gmail draft from the local one (201), or updates the Gmail draft an earlier save created (200),
+// @Description  keeping its attachments. The local draft is removed when the Gmail draft is sent or deleted.
+// @Tags         drafts
+// @Produce      json
+// @Param        id   path      string  true  "Client-generated draft ID"
+// @Success      200  {object}  models.Draft
+// @Success      201  {object}  models.Draft
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/local/{id}/save [post]
+func (h *DraftHandler) SaveLocalDraft(c *gin.Context) {
+	userID, clientID, ok := localDraftParams(c)
+	if !ok {
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	local, err := h.autosaves.Get(ctx, userID, clientID)
+	if err != nil {
+		writeLocalDraftError(c, "Failed to load local draft", err)
+		return
+	}
+
+	var draft *models.Draft
+	status := http.StatusOK
+	if local.GmailDraftID != "" {
+		draft, err = h.gmailService.UpdateDraft(ctx, user, local.GmailDraftID, local.DraftRequest())
+	}
+	// Never saved, or the Gmail draft was deleted since
+	if local.GmailDraftID == "" || errors.Is(err, services.ErrDraftNotFound) {
+		status = http.StatusCreated
+		draft, err = h.gmailService.CreateDraft(ctx, user, local.DraftRequest())
+	}
+	if err != nil {
+		h.draftError(c, "save draft", err)
+		return
+	}
+	h.saveCopy(ctx, user, draft)
+	if err := h.autosaves.SetGmailDraftID(ctx, userID, clientID, draft.ID); err != nil {
+		log.Printf("drafts: failed to link local draft %s to %s: %v", clientID, draft.ID, err)
+	}
+	c.JSON(status, draft)
+}
+
+// localDraftParams returns the user and the validated client-generated draft ID
+func localDraftParams(c *gin.Context) (userID, clientID string, ok bool) {
+	if userID, ok = ruleUser(c); !ok {
+		return "", "", false
+	}
+	clientID = c.Param("id")
+	if !localDraftIDRE.MatchString(clientID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "The draft ID must be 1 to 64 letters, digits, '-' or '_'",
+		})
+		return "", "", false
+	}
+	return userID, clientID, true
+}
+
+// writeLocalDraftError writes 404 for a missing local draft, 500 otherwise
+func writeLocalDraftError(c *gin.Context, message string, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "draft_not_found",
+			Message: "Local draft not found",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "database_error",
+		Message: message + ": " + err.Error(),
+	})
+}
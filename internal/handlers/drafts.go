@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DraftHandler manages the user's Gmail drafts, their local copies and autosaved local drafts
+type DraftHandler struct {
+	gmailService     *services.GmailService
+	userRepo         *repository.UserRepository
+	emailRepo        *repository.EmailRepository
+	kanbanConfigRepo *repository.KanbanConfigRepository
+	autosaves        *repository.DraftAutosaveRepository
+}
+
+// NewDraftHandler creates a new draft handler
+func NewDraftHandler(gmailService *services.GmailService, userRepo *repository.UserRepository, emailRepo *repository.EmailRepository, kanbanConfigRepo *repository.KanbanConfigRepository, autosaves *repository.DraftAutosaveRepository) *DraftHandler {
+	return &DraftHandler{
+		gmailService:     gmailService,
+		userRepo:         userRepo,
+		emailRepo:        emailRepo,
+		kanbanConfigRepo: kanbanConfigRepo,
+		autosaves:        autosaves,
+	}
+}
+
+// ListDrafts godoc
+// @Summary      List drafts
+// @Description  Returns one page of Gmail drafts without bodies
+// @Tags         drafts
+// @Produce      json
+// @Param        pageToken  query     string  false  "Token from the previous page"
+// @Param        limit      query     int     false  "Drafts per page (default 20, max 100)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts [get]
+func (h *DraftHandler) ListDrafts(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	drafts, next, err := h.gmailService.ListDrafts(ctx, user, c.Query("pageToken"), int64(limit))
+	if err != nil {
+		h.draftError(c, "list drafts", err)
+		return
+	}
+	if drafts == nil {
+		drafts = []*models.Draft{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"drafts": drafts, "nextPageToken": next})
+}
+
+// GetDraft godoc
+// @Summary      Get a draft
+// @Tags         drafts
+// @Produce      json
+// @Param        draftId   path      string  true  "Draft ID"
+// @Success      200  {object}  models.Draft
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/{draftId} [get]
+func (h *DraftHandler) GetDraft(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	draft, err := h.gmailService.GetDraft(ctx, user, c.Param("draftId"))
+	if err != nil {
+		h.draftError(c, "load draft", err)
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// CreateDraft godoc
+// @Summary      Save a new draft
+// @Description  Saves compose-in-progress as a Gmail draft, and a local copy (isDraft) that a board column mapped to the DRAFT label shows.
+// @Description  With inReplyTo (or threadId, replying to its latest message) the draft is threaded as a reply. Attachments are base64 in JSON, 32 MB in total.
+// @Tags         drafts
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.DraftRequest  true  "Draft content"
+// @Success      201  {object}  models.Draft
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts [post]
+func (h *DraftHandler) CreateDraft(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req models.DraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	draft, err := h.gmailService.CreateDraft(ctx, user, &req)
+	if err != nil {
+		h.draftError(c, "create draft", err)
+		return
+	}
+	h.saveCopy(ctx, user, draft)
+	c.JSON(http.StatusCreated, draft)
+}
+
+// UpdateDraft godoc
+// @Summary      Replace a draft
+// @Description  Overwrites the draft's recipients, subject and body. Without inReplyTo or threadId a reply draft stays in its thread;
+// @Description  without attachments the current ones are kept (an empty list removes them).
+// @Tags         drafts
+// @Accept       json
+// @Produce      json
+// @Param        draftId  path      string               true  "Draft ID"
+// @Param        request  body      models.DraftRequest  true  "Draft content"
+// @Success      200  {object}  models.Draft
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/{draftId} [put]
+func (h *DraftHandler) UpdateDraft(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req models.DraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	// Long enough to download and re-attach the draft's current attachments
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	draft, err := h.gmailService.UpdateDraft(ctx, user, c.Param("draftId"), &req)
+	if err != nil {
+		h.draftError(c, "update draft", err)
+		return
+	}
+	h.saveCopy(ctx, user, draft)
+	c.JSON(http.StatusOK, draft)
+}
+
+// SendDraft godoc
+// @Summary      Send a draft
+// @Tags         drafts
+// @Produce      json
+// @Param        draftId   path      string  true  "Draft ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/{draftId}/send [post]
+func (h *DraftHandler) SendDraft(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	draftID := c.Param("draftId")
+	messageID, err := h.gmailService.SendDraft(ctx, user, draftID)
+	if err != nil {
+		h.draftError(c, "send draft", err)
+		return
+	}
+	h.deleteCopy(ctx, user, draftID)
+	c.JSON(http.StatusOK, gin.H{"message": "Draft sent successfully", "messageId": messageID})
+}
+
+// DeleteDraft godoc
+// @Summary      Delete a draft
+// @Tags         drafts
+// @Produce      json
+// @Param        draftId   path      string  true  "Draft ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /drafts/{draftId} [delete]
+func (h *DraftHandler) DeleteDraft(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	draftID := c.Param("draftId")
+	if err := h.gmailService.DeleteDraft(ctx, user, draftID); err != nil {
+		h.draftError(c, "delete draft", err)
+		return
+	}
+	h.deleteCopy(ctx, user, draftID)
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted successfully"})
+}
+
+// saveCopy stores the draft's message locally. It goes to the board column mapped to the
+// DRAFT label, and stays off the board when there is none. Failures are only logged: Gmail
+// has the draft.
+func (h *DraftHandler) saveCopy(ctx context.Context, user *models.User, draft *models.Draft) {
+	if draft.Email == nil {
+		return
+	}
+	e := draft.Email
+	e.UserID = user.ID.Hex()
+	e.SkipBoard = true
+	columns, err := h.kanbanConfigRepo.GetColumns(ctx, e.UserID)
+	if err != nil {
+		log.Println("drafts: failed to load board columns:", err)
+	}
+	for _, col := range columns {
+		if col.GmailLabel == "DRAFT" {
+			e.Status, e.SkipBoard = models.EmailStatus(col.Key), false
+			break
+		}
+	}
+	if err := h.emailRepo.SaveDraftCopy(ctx, e); err != nil {
+		log.Printf("drafts: failed to store draft %s: %v", draft.ID, err)
+	}
+}
+
+// deleteCopy removes the local copy of a sent or deleted draft, and the autosaved draft it
+// was saved from; failures are only logged
+func (h *DraftHandler) deleteCopy(ctx context.Context, user *models.User, draftID string) {
+	if err := h.emailRepo.DeleteDraftCopies(ctx, user.ID.Hex(), draftID); err != nil {
+		log.Printf("drafts: failed to remove the copy of draft %s: %v", draftID, err)
+	}
+	if err := h.autosaves.DeleteByGmailDraft(ctx, user.ID.Hex(), draftID); err != nil {
+		log.Printf("drafts: failed to remove the local draft of %s: %v", draftID, err)
+	}
+}
+
+// draftError writes the response for a failed Gmail draft call
+func (h *DraftHandler) draftError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrAttachmentsTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "attachments_too_large",
+			Message: fmt.Sprintf("Attachments exceed the %d MB limit", services.MaxAttachmentBytes>>20),
+		})
+	case errors.Is(err, services.ErrDraftNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "draft_not_found",
+			Message: "Draft not found",
+		})
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "The message being replied to was not found",
+		})
+	case errors.Is(err, services.ErrGmailRateLimited):
+		c.JSON(mapGmailError(err))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "gmail_error",
+			Message: "Failed to " + action + ": " + err.Error(),
+		})
+	}
+}
+
+func (h *DraftHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return nil, false
+	}
+	return user, true
+}
@@ -6,30 +6,65 @@ import (
 	"aiemailbox-be/internal/services"
 	"aiemailbox-be/internal/utils"
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sahilm/fuzzy"
 	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/api/googleapi"
 )
 
 type EmailHandler struct {
 	gmailService *services.GmailService
+	mail         *services.MailProviders
 	userRepo     *repository.UserRepository
 	emailRepo    *repository.EmailRepository
+	syncer       *services.EmailSyncService
+	translator   *services.QueryTranslationService
+	history      *repository.SearchHistoryRepository
 }
 
-func NewEmailHandler(gmailService *services.GmailService, userRepo *repository.UserRepository, emailRepo *repository.EmailRepository) *EmailHandler {
+func NewEmailHandler(gmailService *services.GmailService, mail *services.MailProviders, userRepo *repository.UserRepository, emailRepo *repository.EmailRepository, syncer *services.EmailSyncService, translator *services.QueryTranslationService, history *repository.SearchHistoryRepository) *EmailHandler {
 	return &EmailHandler{
 		gmailService: gmailService,
+		mail:         mail,
 		userRepo:     userRepo,
 		emailRepo:    emailRepo,
+		syncer:       syncer,
+		translator:   translator,
+		history:      history,
 	}
 }
 
+// mailProvider returns the backend of user's linked mailbox, or writes 501 when no
+// implementation exists for it
+func (h *EmailHandler) mailProvider(c *gin.Context, user *models.User) (services.MailProvider, bool) {
+	provider, err := h.mail.For(user)
+	if err != nil {
+		c.JSON(http.StatusNotImplemented, models.ErrorResponse{
+			Error:   "unsupported_provider",
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	return provider, true
+}
+
+// syncToLocal hands fetched Gmail messages to the sync worker and returns immediately.
+// The write happens off the request path (and outlives it); everything else in the handlers
+// derives its context from c.Request.Context() so abandoned requests stop spending Gmail quota.
+func (h *EmailHandler) syncToLocal(userID string, emails []*models.Email) {
+	h.syncer.Enqueue(userID, emails)
+}
+
 // GetMailboxes returns all mailboxes for the authenticated user
 // GetMailboxes godoc
 // @Summary      Get mailboxes
@@ -51,7 +86,7 @@ func (h *EmailHandler) GetMailboxes(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -63,7 +98,12 @@ func (h *EmailHandler) GetMailboxes(c *gin.Context) {
 		return
 	}
 
-	mailboxes, err := h.gmailService.ListMailboxes(ctx, user)
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	mailboxes, err := provider.ListMailboxes(ctx, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "gmail_error",
@@ -91,6 +131,7 @@ func (h *EmailHandler) GetMailboxes(c *gin.Context) {
 // @Param        sortBy         query     string  false  "Sort field: date, subject, sender" default(date)
 // @Param        sortOrder      query     string  false  "Sort order: asc, desc" default(desc)
 // @Success      200  {object}  models.EmailListResponse
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
 // @Failure      500  {object}  models.ErrorResponse
 // @Security     ApiKeyAuth
@@ -117,7 +158,7 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 	sortBy := c.DefaultQuery("sortBy", "date")
 	sortOrder := c.DefaultQuery("sortOrder", "desc")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -129,7 +170,23 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 		return
 	}
 
-	emails, total, err := h.gmailService.ListEmails(ctx, user, mailboxID, page, perPage, unreadOnly, hasAttachmentsOnly, sortBy, sortOrder)
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	result, err := provider.ListEmails(ctx, user, mailboxID, page, perPage, unreadOnly, hasAttachmentsOnly, sortBy, sortOrder)
+	if errors.Is(err, services.ErrPageTooFar) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_page",
+			Message: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrGmailRateLimited) {
+		c.JSON(mapGmailError(err))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "gmail_error",
@@ -138,36 +195,18 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 		return
 	}
 
-	// Sync emails to database for Kanban
-	// Note: In a real app, this should be a background job or separate goroutine
-	// but here we do it inline for simplicity to ensure Kanban is populated.
-	// We run it in a goroutine so user doesn't wait too long, but context needs to be background then.
-	// Actually, let's do it synchronously to ensure data is there if they switch tabs immediately,
-	// or use a detached context.
-	go func(emails []*models.Email) {
-		syncCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-		defer cancel()
-		for _, e := range emails {
-			// Preserve existing status if exists, else default to Inbox
-			existing, err := h.emailRepo.GetByID(syncCtx, e.ID)
-			if err == nil && existing != nil {
-				e.Status = existing.Status
-				e.SnoozedUntil = existing.SnoozedUntil
-				e.Summary = existing.Summary
-			} else {
-				e.Status = models.StatusInbox
-			}
-			e.UserID = user.ID.Hex()
-			_ = h.emailRepo.UpsertEmail(syncCtx, e)
-		}
-	}(emails)
+	// Sync emails to database for Kanban (background, cancelled on shutdown).
+	// Sync a copy so the response isn't mutated concurrently.
+	h.syncToLocal(user.ID.Hex(), cloneEmails(result.Emails))
+	h.setCategories(ctx, result.Emails)
 
 	c.JSON(http.StatusOK, models.EmailListResponse{
-		Emails:      emails,
-		Total:       total, // This is estimate
-		Page:        page,
-		PerPage:     perPage,
-		HasNextPage: false, // Simplified for now
+		Emails:          result.Emails,
+		Total:           result.Total,
+		Page:            page,
+		PerPage:         perPage,
+		HasNextPage:     result.HasNextPage,
+		TotalIsEstimate: !result.TotalExact,
 	})
 }
 
@@ -178,7 +217,19 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 // @Tags         emails
 // @Produce      json
 // @Param        q           query     string  true  "Search query"
+// @Param        pageToken   query     string  false "Gmail page token"
+// @Param        cursor      query     string  false "Local results cursor (from nextCursor)"
+// @Param        limit       query     int     false "Local results page size"
+// @Param        category    query     string  false "Only emails of this category: newsletter, billing, personal, notification"
+// @Param        dateFrom    query     string  false "Received at or after (RFC3339 or YYYY-MM-DD)"
+// @Param        dateTo      query     string  false "Received before (RFC3339 or YYYY-MM-DD)"
+// @Param        sender      query     string  false "Sender address or name contains"
+// @Param        status      query     string  false "Kanban column"
+// @Param        mailboxId   query     string  false "Mailbox (Gmail label ID)"
+// @Param        isRead      query     bool    false "Read state"
+// @Param        hasAttachment query   bool    false "Has attachments"
 // @Success      200  {object}  []models.Email
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
 // @Failure      500  {object}  models.ErrorResponse
 // @Security     ApiKeyAuth
@@ -195,6 +246,19 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 
 	query := c.Query("q")
 	pageToken := c.Query("pageToken")
+	// Local results are paged independently of Gmail via an opaque cursor
+	localCursor := c.Query("cursor")
+	localLimit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if localLimit <= 0 || localLimit > 100 {
+		localLimit = 50
+	}
+	if _, err := repository.DecodeEmailCursor(localCursor); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_cursor",
+			Message: "Invalid pagination cursor",
+		})
+		return
+	}
 
 	if query == "" {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
@@ -203,8 +267,25 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 		})
 		return
 	}
+	category := models.EmailCategory(strings.ToLower(strings.TrimSpace(c.Query("category"))))
+	if category != "" && !models.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_category",
+			Message: "Category must be newsletter, billing, personal or notification",
+		})
+		return
+	}
+	filters, problems := searchFiltersFromQuery(c)
+	if problems != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_filters",
+			Message: "Invalid search filters",
+			Fields:  problems,
+		})
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -216,8 +297,28 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 		return
 	}
 
+	// Smart mode: Gmail gets the query rewritten with operators. The operators (dates, senders)
+	// can't be applied to the local search, so only Gmail is searched.
+	smart := c.Query("mode") == "smart"
+	gmailQuery := query
+	var translation *services.QueryTranslation
+	if smart {
+		translation = h.translator.Translate(ctx, query)
+		gmailQuery = translation.Query
+	}
+	gmailQuery += services.GmailFilterOperators(filters)
+
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
 	// 1. Gmail API Search (Primary - Exact/Global)
-	gmailEmails, nextPageToken, estimate, err := h.gmailService.SearchEmails(ctx, user, query, pageToken)
+	gmailEmails, nextPageToken, estimate, err := provider.SearchEmails(ctx, user, gmailQuery, pageToken)
+	if errors.Is(err, services.ErrGmailRateLimited) {
+		c.JSON(mapGmailError(err))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "search_error",
@@ -226,16 +327,33 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 		return
 	}
 
-	// 2. Local MongoDB Search (Secondary - Partial Regex)
-	localEmails, err := h.emailRepo.SearchEmails(ctx, user.ID.Hex(), query)
-	if err != nil {
-		// Log error but continue with Gmail results
-		localEmails = []models.Email{}
+	// 2. Local MongoDB Search (Secondary - Text index, relaxed regex as fallback)
+	localEmails, nextCursor, localTotal := []models.Email{}, "", int64(0)
+	if !smart {
+		localEmails, nextCursor, localTotal, err = h.emailRepo.SearchEmailsPage(ctx, user.ID.Hex(), query, category, filters, localCursor, localLimit)
+		if err != nil {
+			// Log error but continue with Gmail results
+			log.Println("local search failed:", err)
+			localEmails = []models.Email{}
+		}
 	}
 
-	// Merge results (Deduplicate by ID)
+	// Merge results (Deduplicate by ID). Gmail results don't know their category: use the
+	// stored one, or the rule-based guess for emails not synced yet.
+	gmailCategorized := cloneEmails(gmailEmails)
+	h.setCategories(ctx, gmailCategorized)
+	if filters != nil && filters.Status != "" {
+		h.setStatuses(ctx, gmailCategorized)
+	}
 	emailMap := make(map[string]models.Email)
-	for _, e := range gmailEmails {
+	for _, e := range gmailCategorized {
+		if category != "" && e.Category != category {
+			continue
+		}
+		// Gmail can't express every filter (status, user labels): check them here
+		if !filters.Matches(e) {
+			continue
+		}
 		emailMap[e.ID] = *e
 	}
 	for _, e := range localEmails {
@@ -244,48 +362,19 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 		}
 	}
 
-	// 3. Fuzzy Search Fallback (If no results found)
-	// Only if generic query (not too short) and no results so far.
-	if len(emailMap) == 0 && len(query) > 3 {
-		// Fetch all local emails (excluding trash, via GetKanban)
-		kanbanMap, err := h.emailRepo.GetKanban(ctx, user.ID.Hex(), false, false, "date", "desc")
-		if err == nil {
-			// Pre-process candidates for fuzzy search (Sanitize HTML once)
-
-			var searchableItems []SearchableEmail
-			for _, list := range kanbanMap {
-				for i := range list {
-					// Use pointer to avoid copying big structs
-					e := &list[i]
-					// Combine fields and sanitize
-					rawText := e.Subject + " " + e.From.Name + " " + e.From.Email + " " + e.Body
-					cleanText := utils.SanitizeHTML(rawText)
-					searchableItems = append(searchableItems, SearchableEmail{
-						Original:   e,
-						SearchText: cleanText,
-					})
-				}
-			}
-
-			// Use sahilm/fuzzy for search
-			src := &EmailSource{items: searchableItems}
-			matches := fuzzy.FindFrom(query, src)
-
-			for _, match := range matches {
-				// Debug logging to help tune threshold
-				// fmt.Printf("Query: %s, Match: %s, Score: %d\n", query, searchableItems[match.Index].SearchText, match.Score)
-
-				// Threshold: Match score must be at least the query length.
-				// This filters out very weak/scattered matches.
-				if match.Score < len(query) {
-					continue
-				}
+	// Relevance of the results that have one (fuzzy fallback matches); the rest rank by date
+	relevance := map[string]float64{}
 
-				if match.Index < len(searchableItems) {
-					email := searchableItems[match.Index].Original
-					emailMap[email.ID] = *email
-				}
-			}
+	// 3. Fuzzy Search Fallback (If no results found)
+	// Only if generic query (not too short) and no results so far
+	if terms := typoTerms(query); len(emailMap) == 0 && len(query) > 3 && !smart && len(terms) > 0 {
+		matches, matched, err := h.fuzzyMatches(ctx, user.ID.Hex(), terms, category, filters)
+		if err != nil {
+			log.Println("fuzzy search failed:", err)
+		}
+		for _, e := range matches {
+			emailMap[e.ID] = e
+			relevance[e.ID] = float64(matched[e.ID])
 		}
 	}
 
@@ -305,66 +394,171 @@ func (h *EmailHandler) SearchEmails(c *gin.Context) {
 	// Sync valid Gmail results to local DB (as before)
 	// We only sync the DIRECT Gmail results to ensure we have the latest data for them.
 	// Local results are already local.
-	if len(gmailEmails) > 0 {
-		go func(emails []*models.Email) {
-			syncCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-			defer cancel()
-			for _, e := range emails {
-				existing, err := h.emailRepo.GetByID(syncCtx, e.ID)
-				if err == nil && existing != nil {
-					e.Status = existing.Status
-					e.SnoozedUntil = existing.SnoozedUntil
-					e.Summary = existing.Summary
-				} else {
-					e.Status = models.StatusInbox
-				}
-				e.UserID = user.ID.Hex()
-				_ = h.emailRepo.UpsertEmail(syncCtx, e)
-			}
-		}(gmailEmails)
-	}
-
-	// Sort by ReceivedAt descending (newest first)
-	sort.Slice(finalEmails, func(i, j int) bool {
-		// Newest first means i > j (i is 'after' j)
-		return finalEmails[i].ReceivedAt.After(finalEmails[j].ReceivedAt)
-	})
+	h.syncToLocal(user.ID.Hex(), gmailEmails)
 
-	// Sort by ReceivedAt descending (newest first)
-	sort.Slice(finalEmails, func(i, j int) bool {
-		// Newest first means i > j (i is 'after' j)
-		return finalEmails[i].ReceivedAt.After(finalEmails[j].ReceivedAt)
-	})
+	sortSearchResults(finalEmails, relevance)
 
-	// Calculate total estimate (max of Gmail estimate or actual count)
+	// Both sources mostly hold the same mailbox, so the larger of the Gmail estimate and the
+	// local match count approximates the merged total over all pages
 	totalEstimate := estimate
+	if int(localTotal) > totalEstimate {
+		totalEstimate = int(localTotal)
+	}
 	if len(finalEmails) > totalEstimate {
 		totalEstimate = len(finalEmails)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"emails":        finalEmails,
 		"nextPageToken": nextPageToken,
+		"nextCursor":    nextCursor,
+		"localTotal":    localTotal,
 		"totalEstimate": totalEstimate,
+	}
+	if translation != nil {
+		response["translatedQuery"] = translation.Query
+		response["translationSource"] = translation.Source
+	}
+	// Later pages are the same search
+	if pageToken == "" && localCursor == "" {
+		recordSearch(ctx, h.history, user.ID.Hex(), query, totalEstimate)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sortSearchResults orders merged search results deterministically: by relevance (higher
+// first, missing counts as 0), then newest first, then by ID. emailMap iteration order is
+// random, so every tie needs a key.
+func sortSearchResults(emails []*models.Email, relevance map[string]float64) {
+	sort.Slice(emails, func(i, j int) bool {
+		a, b := emails[i], emails[j]
+		if ra, rb := relevance[a.ID], relevance[b.ID]; ra != rb {
+			return ra > rb
+		}
+		if !a.ReceivedAt.Equal(b.ReceivedAt) {
+			return a.ReceivedAt.After(b.ReceivedAt)
+		}
+		return a.ID < b.ID
 	})
 }
 
-// Helper for fuzzy search
-type SearchableEmail struct {
-	Original   *models.Email
-	SearchText string
+// setCategories fills in the stored category of emails fetched from Gmail, falling back to
+// the rule-based guess for emails that haven't been categorized yet
+func (h *EmailHandler) setCategories(ctx context.Context, emails []*models.Email) {
+	ids := make([]string, len(emails))
+	for i, e := range emails {
+		ids[i] = e.ID
+	}
+	stored, err := h.emailRepo.Categories(ctx, ids)
+	if err != nil {
+		log.Println("failed to load email categories:", err)
+	}
+	for _, e := range emails {
+		if c, ok := stored[e.ID]; ok {
+			e.Category = c
+		} else {
+			e.Category, _ = services.CategorizeByRules(e)
+		}
+	}
+}
+
+// setStatuses sets the stored Kanban status of emails; emails not stored yet are in the inbox
+func (h *EmailHandler) setStatuses(ctx context.Context, emails []*models.Email) {
+	ids := make([]string, len(emails))
+	for i, e := range emails {
+		ids[i] = e.ID
+	}
+	stored, err := h.emailRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		log.Println("failed to load email statuses:", err)
+	}
+	for _, e := range emails {
+		if s, ok := stored[e.ID]; ok {
+			e.Status = s.Status
+		}
+	}
+}
+
+// cloneEmails returns shallow copies so background work doesn't race with response encoding
+func cloneEmails(emails []*models.Email) []*models.Email {
+	out := make([]*models.Email, len(emails))
+	for i, e := range emails {
+		c := *e
+		out[i] = &c
+	}
+	return out
+}
+
+// fuzzyCandidateLimit bounds the emails the typo check runs on per search
+const fuzzyCandidateLimit = 200
+
+// fuzzyMatches returns userID's emails with a word of the subject or summary within a few
+// edits of one of terms, for typos like "recieve" or "hoa dn" (accents are ignored on both
+// sides). Emails sharing trigrams with the terms are shortlisted in Mongo; only those are
+// checked. matched maps each email ID to the number of terms it matched.
+func (h *EmailHandler) fuzzyMatches(ctx context.Context, userID string, terms []string, category models.EmailCategory, filters *models.SearchFilters) (emails []models.Email, matched map[string]int, err error) {
+	candidates, err := h.emailRepo.FuzzyCandidates(ctx, userID, utils.WordTrigrams(terms), category, filters, fuzzyCandidateLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched = map[string]int{}
+	for _, e := range candidates {
+		if n := typoMatchCount(terms, e.SubjectNormalized+" "+e.SummaryNormalized); n > 0 {
+			emails = append(emails, e)
+			matched[e.ID] = n
+		}
+	}
+	return emails, matched, nil
 }
 
-type EmailSource struct {
-	items []SearchableEmail
+// typoTerms returns the query words long enough for typo matching, lower-cased and without
+// accents
+func typoTerms(query string) []string {
+	var terms []string
+	for _, w := range utils.SearchWords(utils.RemoveAccents(query)) {
+		if utf8.RuneCountInString(w) >= 4 {
+			terms = append(terms, w)
+		}
+	}
+	return terms
 }
 
-func (s *EmailSource) String(i int) string {
-	return s.items[i].SearchText
+// typoMaxEdits is the edit distance a word may be off by: 1 up to 5 runes, 2 up to 9, else 3
+func typoMaxEdits(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n <= 5:
+		return 1
+	case n <= 9:
+		return 2
+	default:
+		return 3
+	}
 }
 
-func (s *EmailSource) Len() int {
-	return len(s.items)
+// typoMatchCount returns how many of the terms are within typoMaxEdits (Damerau-Levenshtein,
+// so a swapped pair of letters is one edit) of a word of text. Both are expected normalized
+// (see utils.NormalizeSearchText).
+func typoMatchCount(terms []string, text string) int {
+	words := map[string]struct{}{}
+	for _, w := range strings.Fields(text) {
+		words[w] = struct{}{}
+	}
+	matched := 0
+	for _, term := range terms {
+		maxEdits := typoMaxEdits(term)
+		termLen := utf8.RuneCountInString(term)
+		for w := range words {
+			// the length difference alone already costs that many edits
+			if d := utf8.RuneCountInString(w) - termLen; d > maxEdits || -d > maxEdits {
+				continue
+			}
+			if utils.DamerauLevenshtein(term, w) <= maxEdits {
+				matched++
+				break
+			}
+		}
+	}
+	return matched
 }
 
 // GetEmailDetail returns detailed information about a specific email
@@ -374,8 +568,11 @@ func (s *EmailSource) Len() int {
 // @Tags         emails
 // @Produce      json
 // @Param        emailId   path      string  true  "Email ID"
+// @Param        resolveInline  query  bool  false  "Rewrite cid: image URLs of the body to /api/attachments/:id?messageId=..."
+// @Param        markRead       query  bool  false  "Also mark the email read, as POST /emails/{emailId}/read does"
 // @Success      200  {object}  models.Email
 // @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
 // @Failure      404  {object}  models.ErrorResponse
 // @Failure      500  {object}  models.ErrorResponse
 // @Security     ApiKeyAuth
@@ -392,7 +589,7 @@ func (h *EmailHandler) GetEmailDetail(c *gin.Context) {
 
 	emailID := c.Param("emailId")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -404,21 +601,26 @@ func (h *EmailHandler) GetEmailDetail(c *gin.Context) {
 		return
 	}
 
-	email, err := h.gmailService.GetEmail(ctx, user, emailID)
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	email, err := provider.GetEmail(ctx, user, emailID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "email_not_found",
-				Message: "Email not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "gmail_error",
-			Message: "Failed to load email: " + err.Error(),
-		})
+		writeMessageError(c, "load", err)
 		return
 	}
+	if err := h.emailRepo.Touch(ctx, user.ID.Hex(), email.ID); err != nil {
+		log.Printf("email detail: failed to touch %s: %v", email.ID, err)
+	}
+	if c.Query("markRead") == "true" {
+		h.markOpenedRead(ctx, provider, user, email)
+	}
+	// cid: images can't be loaded by the browser; point them at the attachment route
+	if c.Query("resolveInline") == "true" {
+		email.Body = services.ResolveInlineImages(email.Body, email.ID, email.InlineImages)
+	}
 
 	c.JSON(http.StatusOK, email)
 }
@@ -449,7 +651,7 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 
 	if contentType == "multipart/form-data" || c.Request.MultipartForm != nil {
 		// Parse multipart form
-		if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB max
+		if err := c.Request.ParseMultipartForm(services.MaxAttachmentBytes); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Error:   "invalid_request",
 				Message: "Failed to parse multipart form: " + err.Error(),
@@ -523,7 +725,7 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -561,7 +763,12 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 		Attachments: attachments,
 	}
 
-	if err := h.gmailService.SendEmail(ctx, user, email); err != nil {
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	if err := provider.SendEmail(ctx, user, email); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "gmail_error",
 			Message: "Failed to send email: " + err.Error(),
@@ -572,6 +779,85 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Email sent successfully"})
 }
 
+// ForwardEmailRequest is the body of POST /api/emails/:emailId/forward
+type ForwardEmailRequest struct {
+	To   []string `json:"to" binding:"required,min=1"`
+	Cc   []string `json:"cc,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// ForwardEmail godoc
+// @Summary      Forward an email
+// @Description  Forward an email with its attachments to new recipients, with an optional note above the original
+// @Tags         emails
+// @Accept       json
+// @Produce      json
+// @Param        emailId   path      string                       true  "Email ID"
+// @Param        request   body      handlers.ForwardEmailRequest true  "Recipients and note"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/forward [post]
+func (h *EmailHandler) ForwardEmail(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req ForwardEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "At least one recipient is required",
+		})
+		return
+	}
+
+	// Downloading the attachments again takes longer than a plain send
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
+	toAddresses := make([]models.EmailAddress, len(req.To))
+	for i, to := range req.To {
+		toAddresses[i] = models.EmailAddress{Email: to}
+	}
+	ccAddresses := make([]models.EmailAddress, len(req.Cc))
+	for i, cc := range req.Cc {
+		ccAddresses[i] = models.EmailAddress{Email: cc}
+	}
+
+	err = h.gmailService.ForwardEmail(ctx, user, c.Param("emailId"), toAddresses, ccAddresses, req.Note)
+	if errors.Is(err, services.ErrAttachmentsTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "attachments_too_large",
+			Message: fmt.Sprintf("Attachments exceed the %d MB limit for forwarding", services.MaxAttachmentBytes>>20),
+		})
+		return
+	}
+	if err != nil {
+		writeMessageError(c, "forward", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email forwarded successfully"})
+}
+
 // ReplyEmail replies to an existing email
 func (h *EmailHandler) ReplyEmail(c *gin.Context) {
 	// Use the same SendEmail logic
@@ -603,7 +889,7 @@ func (h *EmailHandler) ModifyEmail(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	user, err := h.userRepo.FindByID(ctx, userID.(string))
@@ -615,41 +901,48 @@ func (h *EmailHandler) ModifyEmail(c *gin.Context) {
 		return
 	}
 
-	if err := h.gmailService.ModifyEmail(ctx, user, emailID, req.AddLabels, req.RemoveLabels); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "gmail_error",
-			Message: "Failed to modify email: " + err.Error(),
-		})
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	if err := provider.ModifyEmail(ctx, user, emailID, req.AddLabels, req.RemoveLabels); err != nil {
+		writeMessageError(c, "modify", err)
 		return
 	}
 
 	// Sync changes to local database immediately to reflect in Kanban/other views
 	// Fetch fresh details from Gmail to get current labels/state
-	updatedEmail, err := h.gmailService.GetEmail(ctx, user, emailID)
+	updatedEmail, err := provider.GetEmail(ctx, user, emailID)
 	if err == nil {
-		// Preserve local fields that aren't on Gmail (like custom status, snoozedUntil if any - though modify might affect them)
-		// For now, simple Upsert is safe as it overwrites with fresh Gmail data.
-		// However, we must ensure we don't lose custom Status if it's not stored in Gmail.
-		// Actually, GetEmail from GmailService might return a default Status if not found map?
-		// Let's check repository.GetByID first.
-		existing, _ := h.emailRepo.GetByID(ctx, emailID)
-		if existing != nil {
-			updatedEmail.Status = existing.Status
-			updatedEmail.SnoozedUntil = existing.SnoozedUntil
-			updatedEmail.Summary = existing.Summary
-		} else {
-			// If not in DB, default?
-			updatedEmail.Status = models.StatusInbox
+		// Only Gmail-owned fields are written; status, snooze and summary stay as stored
+		if err := h.syncer.Store(ctx, user.ID.Hex(), []*models.Email{updatedEmail}); err != nil {
+			log.Println("modify email: failed to store updated email:", err)
 		}
-		updatedEmail.UserID = user.ID.Hex()
-		_ = h.emailRepo.UpsertEmail(ctx, updatedEmail)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Email modified successfully"})
 }
 
-// GetAttachment streams an attachment
-func (h *EmailHandler) GetAttachment(c *gin.Context) {
+// modifyBatchMaxEmails caps the emails of one modify-batch request; Gmail takes them 1000 per call
+const modifyBatchMaxEmails = 5000
+
+// ModifyEmailsBatch godoc
+// @Summary      Modify labels of many emails
+// @Description  Adds and removes the same labels on up to 5000 emails with one Gmail batchModify call per 1000,
+// @Description  then updates the cached copies. Each chunk reports its own outcome; a failed chunk doesn't stop the others.
+// @Description  The emails are given as emailIds, or as a mailboxId whose newest 5000 emails are modified (hasMore is set when it holds more).
+// @Tags         emails
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.ModifyBatchRequest  true  "Emails and labels"
+// @Success      200  {object}  models.ModifyBatchResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/modify-batch [post]
+func (h *EmailHandler) ModifyEmailsBatch(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -659,22 +952,79 @@ func (h *EmailHandler) GetAttachment(c *gin.Context) {
 		return
 	}
 
-	// Route: /api/attachments/:id?messageId=...
-	attachmentID := c.Param("id")
-	messageID := c.Query("messageId")
-
-	if messageID == "" {
+	var req models.ModifyBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error:   "invalid_request",
-			Message: "messageId query parameter is required",
+			Message: "Invalid request body",
+		})
+		return
+	}
+	ids := uniqueIDs(req.EmailIDs)
+	mailboxID := strings.TrimSpace(req.MailboxID)
+	addLabels := uniqueIDs(req.AddLabels)
+	removeLabels := uniqueIDs(req.RemoveLabels)
+	switch {
+	case len(ids) == 0 && mailboxID == "":
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "emailIds or mailboxId is required",
+		})
+		return
+	case len(ids) > 0 && mailboxID != "":
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Give either emailIds or mailboxId, not both",
+		})
+		return
+	case len(ids) > modifyBatchMaxEmails:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("At most %d emails per request", modifyBatchMaxEmails),
+		})
+		return
+	case len(addLabels) == 0 && len(removeLabels) == 0:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "addLabels or removeLabels is required",
+		})
+		return
+	}
+	h.modifyBatch(c, userID.(string), ids, mailboxID, false, addLabels, removeLabels)
+}
+
+// MarkAllRead godoc
+// @Summary      Mark every email of a mailbox as read
+// @Description  Removes UNREAD from the mailbox's unread emails, up to 5000 per request with one Gmail batchModify
+// @Description  call per 1000; hasMore is set when unread emails remain. Partial failures are reported per chunk.
+// @Tags         emails
+// @Produce      json
+// @Param        mailboxId  path      string  true  "Mailbox ID"
+// @Success      200  {object}  models.ModifyBatchResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /mailboxes/{mailboxId}/mark-all-read [post]
+func (h *EmailHandler) MarkAllRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
 		})
 		return
 	}
+	h.modifyBatch(c, userID.(string), nil, c.Param("mailboxId"), true, nil, []string{"UNREAD"})
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// modifyBatch applies the label change to ids, or when mailboxID is set to the newest
+// modifyBatchMaxEmails emails of that mailbox (only the unread ones when unreadOnly), and
+// writes the per-chunk outcome
+func (h *EmailHandler) modifyBatch(c *gin.Context, userID string, ids []string, mailboxID string, unreadOnly bool, addLabels, removeLabels []string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
 	defer cancel()
 
-	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	user, err := h.userRepo.FindByID(ctx, userID)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error:   "user_not_found",
@@ -682,13 +1032,604 @@ func (h *EmailHandler) GetAttachment(c *gin.Context) {
 		})
 		return
 	}
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	resp := models.ModifyBatchResponse{Chunks: []models.ModifyBatchChunk{}}
+	if mailboxID != "" {
+		ids, resp.HasMore, err = provider.ListMessageIDs(ctx, user, mailboxID, unreadOnly, modifyBatchMaxEmails)
+		if err != nil {
+			c.JSON(mapGmailError(err))
+			return
+		}
+	}
 
-	data, err := h.gmailService.GetAttachment(ctx, user, messageID, attachmentID)
+	chunks, err := provider.ModifyEmailsBatch(ctx, user, ids, addLabels, removeLabels)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "gmail_error",
-			Message: "Failed to get attachment: " + err.Error(),
+		c.JSON(mapGmailError(err))
+		return
+	}
+
+	for _, chunk := range chunks {
+		out := models.ModifyBatchChunk{EmailIDs: chunk.EmailIDs, OK: chunk.Err == nil}
+		if chunk.Err != nil {
+			out.Error = chunk.Err.Error()
+			resp.Failed += len(chunk.EmailIDs)
+			resp.Chunks = append(resp.Chunks, out)
+			continue
+		}
+		resp.Succeeded += len(chunk.EmailIDs)
+		// Only what Gmail applied is mirrored, so the cache never runs ahead of Gmail
+		failed, err := h.emailRepo.BulkModifyLabels(ctx, userID, chunk.EmailIDs, addLabels, removeLabels)
+		if err == nil && len(failed) > 0 {
+			err = fmt.Errorf("%d cached emails were not updated", len(failed))
+		}
+		if err != nil {
+			log.Println("modify batch: failed to update cached emails:", err)
+			out.LocalError = err.Error()
+		}
+		resp.Chunks = append(resp.Chunks, out)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ArchiveEmail godoc
+// @Summary      Archive an email
+// @Description  Removes the INBOX label in Gmail and in the local copy
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/archive [post]
+func (h *EmailHandler) ArchiveEmail(c *gin.Context) {
+	h.messageAction(c, "archive", "archived",
+		func(ctx context.Context, user *models.User, emailID string) error {
+			provider, err := h.mail.For(user)
+			if err != nil {
+				return err
+			}
+			return provider.ModifyEmail(ctx, user, emailID, nil, []string{"INBOX"})
+		},
+		func(ctx context.Context, userID, emailID string) error {
+			return h.emailRepo.RemoveLabel(ctx, userID, emailID, "INBOX")
 		})
+}
+
+// TrashEmail godoc
+// @Summary      Move an email to the trash
+// @Description  Trashes the message in Gmail and hides it from the board, search and statistics
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/trash [post]
+func (h *EmailHandler) TrashEmail(c *gin.Context) {
+	h.messageAction(c, "trash", "trashed", h.gmailService.TrashEmail, h.emailRepo.MarkTrashed)
+}
+
+// UntrashEmail godoc
+// @Summary      Take an email out of the trash
+// @Description  Untrashes the message in Gmail (restoring its previous labels) and brings the card back to the board
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/untrash [post]
+func (h *EmailHandler) UntrashEmail(c *gin.Context) {
+	h.messageAction(c, "untrash", "untrashed", h.gmailService.UntrashEmail,
+		func(ctx context.Context, userID, emailID string) error {
+			// not cached or not deleted locally: nothing to undo
+			if err := h.emailRepo.Restore(ctx, userID, emailID); err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+			return nil
+		})
+}
+
+// DeleteEmail godoc
+// @Summary      Permanently delete an email
+// @Description  Deletes the message in Gmail without going through the trash and removes the local copy. Requires the full https://mail.google.com/ Gmail scope.
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId} [delete]
+func (h *EmailHandler) DeleteEmail(c *gin.Context) {
+	h.messageAction(c, "delete", "deleted", h.gmailService.DeleteEmail,
+		func(ctx context.Context, userID, emailID string) error {
+			_, err := h.emailRepo.DeleteByIDs(ctx, userID, []string{emailID})
+			return err
+		})
+}
+
+// MarkRead godoc
+// @Summary      Mark an email as read
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  models.Email
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/read [post]
+func (h *EmailHandler) MarkRead(c *gin.Context) {
+	h.setFlag(c, "isRead", true, "UNREAD", false)
+}
+
+// MarkUnread godoc
+// @Summary      Mark an email as unread
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  models.Email
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/unread [post]
+func (h *EmailHandler) MarkUnread(c *gin.Context) {
+	h.setFlag(c, "isRead", false, "UNREAD", true)
+}
+
+// StarEmail godoc
+// @Summary      Star an email
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  models.Email
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/star [post]
+func (h *EmailHandler) StarEmail(c *gin.Context) {
+	h.setFlag(c, "isStarred", true, "STARRED", true)
+}
+
+// UnstarEmail godoc
+// @Summary      Remove the star from an email
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  models.Email
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/unstar [post]
+func (h *EmailHandler) UnstarEmail(c *gin.Context) {
+	h.setFlag(c, "isStarred", false, "STARRED", false)
+}
+
+// setFlag adds or removes the Gmail label behind a read/starred flag, mirrors it in the
+// local copy so statistics are right immediately, and returns the updated email
+func (h *EmailHandler) setFlag(c *gin.Context, field string, value bool, label string, addLabel bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	emailID := c.Param("emailId")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
+	var add, remove []string
+	if addLabel {
+		add = []string{label}
+	} else {
+		remove = []string{label}
+	}
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	if err := provider.ModifyEmail(ctx, user, emailID, add, remove); err != nil {
+		writeMessageError(c, "update", err)
+		return
+	}
+
+	email, err := h.emailRepo.SetFlag(ctx, userID.(string), emailID, field, value, label, addLabel)
+	if err == nil {
+		c.JSON(http.StatusOK, email)
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Printf("update email: failed to update local copy of %s: %v", emailID, err)
+	}
+
+	// Not cached locally: return Gmail's copy and store it
+	email, err = provider.GetEmail(ctx, user, emailID)
+	if err != nil {
+		writeMessageError(c, "load", err)
+		return
+	}
+	h.syncToLocal(userID.(string), []*models.Email{email})
+	c.JSON(http.StatusOK, email)
+}
+
+// markOpenedRead marks an email opened with markRead=true as read in Gmail and in the local
+// copy. Failures are only logged: the detail is returned either way.
+func (h *EmailHandler) markOpenedRead(ctx context.Context, provider services.MailProvider, user *models.User, email *models.Email) {
+	if email.IsRead {
+		return
+	}
+	if err := provider.ModifyEmail(ctx, user, email.ID, nil, []string{"UNREAD"}); err != nil {
+		log.Printf("email detail: failed to mark %s read: %v", email.ID, err)
+		return
+	}
+	email.IsRead = true
+	email.Labels = slices.DeleteFunc(email.Labels, func(l string) bool { return l == "UNREAD" })
+	if _, err := h.emailRepo.SetFlag(ctx, user.ID.Hex(), email.ID, "isRead", true, "UNREAD", false); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("email detail: failed to update local copy of %s: %v", email.ID, err)
+	}
+}
+
+// messageAction runs a Gmail operation on one message and mirrors it in the local copy so
+// the Kanban and statistics filters see it before the next sync
+func (h *EmailHandler) messageAction(c *gin.Context, action, done string,
+	gmailOp func(ctx context.Context, user *models.User, emailID string) error,
+	localOp func(ctx context.Context, userID, emailID string) error) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	emailID := c.Param("emailId")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
+	if err := gmailOp(ctx, user, emailID); err != nil {
+		writeMessageError(c, action, err)
+		return
+	}
+
+	if err := localOp(ctx, userID.(string), emailID); err != nil {
+		// Gmail has the change; the next sync brings the local copy in line
+		log.Printf("%s email: failed to update local copy of %s: %v", action, emailID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email " + done + " successfully", "emailId": emailID})
+}
+
+// writeMessageError maps a failed Gmail operation on one message to its response
+func writeMessageError(c *gin.Context, action string, err error) {
+	status, resp := mapGmailError(err)
+	switch status {
+	case http.StatusForbidden:
+		resp.Message = "Gmail did not allow this " + action + ": " + err.Error()
+	case http.StatusInternalServerError:
+		resp.Message = "Failed to " + action + " email: " + err.Error()
+	}
+	c.JSON(status, resp)
+}
+
+// mapGmailError returns the HTTP status and body for a failed mail provider call. Gmail's
+// 404 and 403 responses are recognized whether or not the service already translated them
+// to ErrMessageNotFound and ErrInsufficientScope; a rate limit that outlasted the retries is
+// a 503.
+func mapGmailError(err error) (int, models.ErrorResponse) {
+	if errors.Is(err, services.ErrGmailRateLimited) {
+		return http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "rate_limited",
+			Message: "Gmail is rate limiting requests, please try again shortly",
+		}
+	}
+	var unsupported *services.UnsupportedMailProviderError
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			err = services.ErrMessageNotFound
+		case http.StatusForbidden:
+			err = fmt.Errorf("%w: %s", services.ErrInsufficientScope, apiErr.Message)
+		}
+	}
+	switch {
+	case errors.As(err, &unsupported):
+		return http.StatusNotImplemented, models.ErrorResponse{
+			Error:   "unsupported_provider",
+			Message: err.Error(),
+		}
+	case errors.Is(err, services.ErrMessageNotFound):
+		return http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "Email not found",
+		}
+	case errors.Is(err, services.ErrInsufficientScope):
+		return http.StatusForbidden, models.ErrorResponse{
+			Error:   "insufficient_scope",
+			Message: "Gmail denied access to this email: " + err.Error(),
+		}
+	default:
+		return http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "gmail_error",
+			Message: err.Error(),
+		}
+	}
+}
+
+// GetTrash godoc
+// @Summary      List deleted emails
+// @Description  Returns soft-deleted emails (trashed in Gmail or removed from the board), most recently deleted first
+// @Tags         emails
+// @Produce      json
+// @Param        limit  query     int  false  "Max results (default 50, max 100)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/trash [get]
+func (h *EmailHandler) GetTrash(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	emails, err := h.emailRepo.GetTrash(c.Request.Context(), userID.(string), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load deleted emails: " + err.Error(),
+		})
+		return
+	}
+	if emails == nil {
+		emails = []models.Email{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"emails": emails, "total": len(emails)})
+}
+
+// RestoreEmail godoc
+// @Summary      Restore a deleted email
+// @Description  Clears the soft delete so the card returns to the board. Emails trashed in Gmail are untrashed there too.
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/restore [post]
+func (h *EmailHandler) RestoreEmail(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	emailID := c.Param("emailId")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	email, err := h.emailRepo.GetByID(ctx, emailID)
+	if err != nil || email.UserID != userID.(string) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "Email not found",
+		})
+		return
+	}
+
+	// Untrash in Gmail first, otherwise the next sync would delete the card again
+	if email.HasLabel("TRASH") {
+		user, err := h.userRepo.FindByID(ctx, userID.(string))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "user_not_found",
+				Message: "User not found",
+			})
+			return
+		}
+		provider, ok := h.mailProvider(c, user)
+		if !ok {
+			return
+		}
+		if err := provider.ModifyEmail(ctx, user, emailID, []string{"INBOX"}, []string{"TRASH"}); err != nil {
+			writeMessageError(c, "untrash", err)
+			return
+		}
+	}
+
+	if err := h.emailRepo.Restore(ctx, userID.(string), emailID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "email_not_deleted",
+				Message: "Email is not deleted",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to restore email: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email restored successfully"})
+}
+
+// ListAttachments godoc
+// @Summary      List an email's attachments
+// @Description  Names, sizes and types of the attachments, each with the url that downloads it. Read from the
+// @Description  stored copy when there is one, otherwise from Gmail. An email without attachments has an empty list.
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true  "Email ID"
+// @Success      200  {object}  map[string][]models.Attachment
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/attachments [get]
+func (h *EmailHandler) ListAttachments(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	emailID := c.Param("emailId")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	email, err := h.emailRepo.GetOwned(ctx, userID.(string), emailID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load email: " + err.Error(),
+		})
+		return
+	}
+	// Not stored, or stored without its attachment list
+	if email == nil || (email.HasAttachments && len(email.Attachments) == 0) {
+		user, err := h.userRepo.FindByID(ctx, userID.(string))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "user_not_found",
+				Message: "User not found",
+			})
+			return
+		}
+		provider, ok := h.mailProvider(c, user)
+		if !ok {
+			return
+		}
+		email, err = provider.GetEmail(ctx, user, emailID)
+		if err != nil {
+			writeMessageError(c, "load", err)
+			return
+		}
+	}
+
+	attachments := make([]*models.Attachment, 0, len(email.Attachments))
+	for _, a := range email.Attachments {
+		if a == nil {
+			continue
+		}
+		item := *a
+		item.URL = services.AttachmentURL(email.ID, a.ID)
+		attachments = append(attachments, &item)
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+// GetAttachment streams an attachment
+func (h *EmailHandler) GetAttachment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	// Route: /api/attachments/:id?messageId=...
+	attachmentID := c.Param("id")
+	messageID := c.Query("messageId")
+
+	if messageID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "messageId query parameter is required",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
+	provider, ok := h.mailProvider(c, user)
+	if !ok {
+		return
+	}
+
+	data, err := provider.GetAttachment(ctx, user, messageID, attachmentID)
+	if err != nil {
+		status, resp := mapGmailError(err)
+		switch status {
+		case http.StatusNotFound:
+			resp.Error, resp.Message = "attachment_not_found", "Attachment not found"
+		case http.StatusInternalServerError:
+			resp.Message = "Failed to get attachment: " + err.Error()
+		}
+		c.JSON(status, resp)
 		return
 	}
 
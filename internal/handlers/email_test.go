@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/testutil"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/api/googleapi"
+)
+
+func TestMapGmailError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  int
+		wantError string
+	}{
+		{"retries exhausted", fmt.Errorf("%w: %w", services.ErrGmailRateLimited, &googleapi.Error{Code: http.StatusTooManyRequests}), http.StatusServiceUnavailable, "rate_limited"},
+		{"not found", &googleapi.Error{Code: http.StatusNotFound}, http.StatusNotFound, "email_not_found"},
+		{"translated not found", services.ErrMessageNotFound, http.StatusNotFound, "email_not_found"},
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden, Message: "insufficient scope"}, http.StatusForbidden, "insufficient_scope"},
+		{"unsupported provider", &services.UnsupportedMailProviderError{Provider: "imap"}, http.StatusNotImplemented, "unsupported_provider"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "gmail_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := mapGmailError(tt.err)
+			if code != tt.wantCode || resp.Error != tt.wantError || resp.Message == "" {
+				t.Errorf("mapGmailError = %d %+v, want %d %q", code, resp, tt.wantCode, tt.wantError)
+			}
+		})
+	}
+}
+
+// modifyCall is one ModifyEmail call seen by fakeMailProvider
+type modifyCall struct {
+	emailID     string
+	add, remove []string
+}
+
+// fakeMailProvider records label changes; calls it doesn't override panic
+type fakeMailProvider struct {
+	services.MailProvider
+	modifyErr error
+	modified  []modifyCall
+}
+
+func (f *fakeMailProvider) ModifyEmail(_ context.Context, _ *models.User, emailID string, add, remove []string) error {
+	f.modified = append(f.modified, modifyCall{emailID, add, remove})
+	return f.modifyErr
+}
+
+// serveEmailAction runs handler on POST /emails/:emailId as userID
+func serveEmailAction(handler gin.HandlerFunc, userID, emailID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/emails/:emailId", func(c *gin.Context) {
+		c.Set("userID", userID)
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/emails/"+emailID, nil))
+	return w
+}
+
+func TestMarkReadUnread(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	userRepo := repository.NewUserRepository(db, nil)
+	emailRepo := repository.NewEmailRepository(db)
+	user := &models.User{Email: "reader@example.com", Provider: "google"}
+	if err := userRepo.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	userID := user.ID.Hex()
+	if _, err := db.Collection("emails").InsertOne(ctx, bson.M{
+		"_id": "m1", "userId": userID, "mailboxId": "INBOX", "labels": []string{"INBOX", "UNREAD"}, "isRead": false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeMailProvider{}
+	mail := services.NewMailProviders(nil)
+	mail.Register(services.MailProviderGmail, fake)
+	h := NewEmailHandler(nil, mail, userRepo, emailRepo, nil, nil, nil)
+
+	stored := func() models.Email {
+		t.Helper()
+		var e models.Email
+		if err := db.Collection("emails").FindOne(ctx, bson.M{"_id": "m1"}).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	check := func(name string, w *httptest.ResponseRecorder, wantRead bool) {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %s)", name, w.Code, w.Body)
+		}
+		var resp models.Email
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsRead != wantRead {
+			t.Errorf("%s: response isRead = %v, want %v", name, resp.IsRead, wantRead)
+		}
+		e := stored()
+		if e.IsRead != wantRead || slices.Contains(e.Labels, "UNREAD") == wantRead {
+			t.Errorf("%s: stored isRead %v labels %v, want isRead %v", name, e.IsRead, e.Labels, wantRead)
+		}
+	}
+
+	check("read", serveEmailAction(h.MarkRead, userID, "m1"), true)
+	check("unread", serveEmailAction(h.MarkUnread, userID, "m1"), false)
+
+	want := []modifyCall{
+		{emailID: "m1", remove: []string{"UNREAD"}},
+		{emailID: "m1", add: []string{"UNREAD"}},
+	}
+	if len(fake.modified) != len(want) {
+		t.Fatalf("ModifyEmail calls = %+v, want %+v", fake.modified, want)
+	}
+	for i, got := range fake.modified {
+		if got.emailID != want[i].emailID || !slices.Equal(got.add, want[i].add) || !slices.Equal(got.remove, want[i].remove) {
+			t.Errorf("ModifyEmail call %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// A Gmail failure leaves the local copy alone
+	fake.modifyErr = &googleapi.Error{Code: http.StatusForbidden, Message: "insufficient scope"}
+	w := serveEmailAction(h.MarkRead, userID, "m1")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("failed read: status = %d, want 403 (body %s)", w.Code, w.Body)
+	}
+	if e := stored(); e.IsRead {
+		t.Errorf("failed read: stored isRead = true, want false")
+	}
+}
+
+func TestSearchEmailsRejectsTamperedCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewEmailHandler(nil, nil, nil, nil, nil, nil, nil)
+	r := gin.New()
+	r.GET("/emails/search", func(c *gin.Context) {
+		c.Set("userID", "u1")
+		h.SearchEmails(c)
+	})
+
+	valid := repository.EmailCursor{ReceivedAt: time.Now(), ID: "18f2a"}.Encode()
+	for _, cursor := range []string{"garbage!", valid[:len(valid)-3] + "x", "e30"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/emails/search?q=invoice&cursor="+url.QueryEscape(cursor), nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("cursor %q: status = %d, want 400", cursor, w.Code)
+			continue
+		}
+		var resp models.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error != "invalid_cursor" {
+			t.Errorf("cursor %q: body = %s, want invalid_cursor", cursor, w.Body)
+		}
+	}
+}
+
+func TestTypoMatchCount(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  int
+	}{
+		{"recieve", "please receive the parcel", 1},
+		{"invocie march", "your march invoice is ready", 2},
+		{"thnog bao", utils.NormalizeSearchText("Thông báo nghỉ lễ"), 1},
+		{"hợp doong", utils.NormalizeSearchText("Hợp đồng thuê nhà"), 1},
+		{"thahn toan", utils.NormalizeSearchText("Re: câu hỏi") + " " + utils.NormalizeSearchText("Xác nhận thanh toán hóa đơn"), 2},
+		{"budget", "quarterly report", 0},
+		// 4-5 letter words allow a single edit only
+		{"toan", "tuan sau", 1},
+		{"toan", "tuyen", 0},
+	}
+	for _, tt := range tests {
+		if got := typoMatchCount(typoTerms(tt.query), tt.text); got != tt.want {
+			t.Errorf("typoMatchCount(%q, %q) = %d, want %d", tt.query, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatchesMisspelledVietnamese(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	h := NewEmailHandler(nil, nil, nil, emailRepo, nil, nil, nil)
+
+	// 1,000 emails built from words no query below is a typo of
+	vocabulary := []string{"Lịch", "họp", "Cập", "nhật", "dự", "án", "mời", "buổi", "tối", "Khuyến", "mãi",
+		"cuối", "năm", "Báo", "cáo", "kết", "quả", "học", "tập", "Chúc", "mừng", "sinh"}
+	start := time.Now().Add(-1000 * time.Minute)
+	emails := make([]*models.Email, 0, 1003)
+	for i := 0; i < 1000; i++ {
+		subject := fmt.Sprintf("%s %s %s %d", vocabulary[i%len(vocabulary)], vocabulary[(i*7)%len(vocabulary)], vocabulary[(i*13)%len(vocabulary)], i)
+		emails = append(emails, &models.Email{ID: fmt.Sprintf("d%04d", i), UserID: "u1", MailboxID: "INBOX", Subject: subject, ReceivedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	// The targets are the oldest, so recency can't rank them into the shortlist
+	old := start.Add(-time.Hour)
+	emails = append(emails,
+		&models.Email{ID: "notice", UserID: "u1", MailboxID: "INBOX", Subject: "Thông báo nghỉ lễ", ReceivedAt: old},
+		&models.Email{ID: "contract", UserID: "u1", MailboxID: "INBOX", Subject: "Hợp đồng thuê nhà", ReceivedAt: old},
+		&models.Email{ID: "payment", UserID: "u1", MailboxID: "INBOX", Subject: "Re: câu hỏi", ReceivedAt: old},
+	)
+	if err := emailRepo.BulkUpsertFromGmail(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+	// Only the summary of this one matches
+	if err := emailRepo.SetSummary(ctx, "payment", "Xác nhận <b>thanh toán</b> hóa đơn tiền điện", "vi", "short"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"thnog bao", []string{"notice"}},
+		{"thôgn báo", []string{"notice"}},
+		{"hop doong", []string{"contract"}},
+		{"HỢP ĐÔNG", []string{"contract"}},
+		{"thahn toan", []string{"payment"}},
+		{"hoa dơnn tien dien", []string{"payment"}},
+		{"programming", nil},
+	}
+	for _, tt := range tests {
+		got, matched, err := h.fuzzyMatches(ctx, "u1", typoTerms(tt.query), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(got))
+		for i, e := range got {
+			ids[i] = e.ID
+			if matched[e.ID] == 0 {
+				t.Errorf("%q: %s has no matched terms", tt.query, e.ID)
+			}
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("fuzzyMatches(%q) = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+}
+
+func TestSortSearchResultsIsDeterministic(t *testing.T) {
+	day := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	fresh := func() []*models.Email {
+		return []*models.Email{
+			{ID: "c", ReceivedAt: day},
+			{ID: "a", ReceivedAt: day},
+			{ID: "old", ReceivedAt: day.Add(-time.Hour)},
+			{ID: "new", ReceivedAt: day.Add(time.Hour)},
+			{ID: "best", ReceivedAt: day.Add(-48 * time.Hour)},
+			{ID: "b", ReceivedAt: day},
+			{ID: "unscored", ReceivedAt: day.Add(72 * time.Hour)},
+		}
+	}
+	relevance := map[string]float64{"best": 3, "a": 1, "b": 1, "c": 1, "old": 1, "new": 1}
+	want := []string{"best", "new", "a", "b", "c", "old", "unscored"}
+
+	// Shuffle between runs, as merging through a map does
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 50; run++ {
+		emails := fresh()
+		rng.Shuffle(len(emails), func(i, j int) { emails[i], emails[j] = emails[j], emails[i] })
+		sortSearchResults(emails, relevance)
+		got := make([]string, len(emails))
+		for i, e := range emails {
+			got[i] = e.ID
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("run %d: order %v, want %v", run, got, want)
+		}
+	}
+}
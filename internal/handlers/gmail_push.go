@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GmailPushHandler manages Gmail push watches and receives their Pub/Sub notifications
+type GmailPushHandler struct {
+	cfg          *config.Config
+	gmailService *services.GmailService
+	userRepo     *repository.UserRepository
+	emails       *EmailHandler
+	background   *services.BackgroundTasks
+
+	// Coalesces notifications per user: a push that arrives while a sync runs marks the user
+	// dirty and the running sync goes again, instead of two syncs racing on the history ID
+	mu      sync.Mutex
+	running map[string]bool
+	dirty   map[string]bool
+}
+
+func NewGmailPushHandler(cfg *config.Config, gmailService *services.GmailService, userRepo *repository.UserRepository, emails *EmailHandler, background *services.BackgroundTasks) *GmailPushHandler {
+	return &GmailPushHandler{
+		cfg:          cfg,
+		gmailService: gmailService,
+		userRepo:     userRepo,
+		emails:       emails,
+		background:   background,
+		running:      map[string]bool{},
+		dirty:        map[string]bool{},
+	}
+}
+
+// WatchResponse describes the user's Gmail push watch
+type WatchResponse struct {
+	Enabled   bool       `json:"enabled"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	HistoryID uint64     `json:"historyId,omitempty"`
+}
+
+// pubSubPush is the envelope Pub/Sub POSTs to push endpoints
+type pubSubPush struct {
+	Message struct {
+		Data      string `json:"data"` // base64 JSON gmailNotification
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gmailNotification is the payload Gmail publishes for a mailbox change
+type gmailNotification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    uint64 `json:"historyId"`
+}
+
+// Watch godoc
+// @Summary      Enable Gmail push notifications
+// @Description  Registers a Gmail watch on the configured Pub/Sub topic so new mail is synced as it arrives. The watch is renewed automatically before its 7-day expiry.
+// @Tags         emails
+// @Produce      json
+// @Success      200  {object}  handlers.WatchResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /gmail/watch [post]
+func (h *GmailPushHandler) Watch(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if h.cfg.GmailPubSubTopic == "" {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "push_not_configured",
+			Message: "Gmail push notifications are not configured on this server",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	expiry, historyID, err := h.gmailService.Watch(ctx, user, h.cfg.GmailPubSubTopic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "gmail_error",
+			Message: "Failed to register Gmail watch: " + err.Error(),
+		})
+		return
+	}
+
+	userID := user.ID.Hex()
+	err = h.userRepo.SetGmailWatchEnabled(ctx, userID, true)
+	if err == nil {
+		err = h.userRepo.UpdateGmailWatch(ctx, userID, expiry, historyID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to save Gmail watch: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, WatchResponse{Enabled: true, ExpiresAt: &expiry, HistoryID: historyID})
+}
+
+// Unwatch godoc
+// @Summary      Disable Gmail push notifications
+// @Tags         emails
+// @Produce      json
+// @Success      200  {object}  handlers.WatchResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /gmail/watch [delete]
+func (h *GmailPushHandler) Unwatch(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	// Disable locally first so the renewal worker stops even if Gmail is unreachable
+	if err := h.userRepo.SetGmailWatchEnabled(ctx, user.ID.Hex(), false); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to disable Gmail watch: " + err.Error(),
+		})
+		return
+	}
+	if err := h.gmailService.StopWatch(ctx, user); err != nil {
+		// the watch lapses on its own within 7 days; notifications are ignored meanwhile
+		log.Println("gmail push: failed to stop watch:", user.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, WatchResponse{Enabled: false})
+}
+
+// Webhook godoc
+// @Summary      Gmail Pub/Sub push endpoint
+// @Description  Receives Gmail change notifications from a Pub/Sub push subscription and syncs the user's mailbox in the background. Requires the shared secret as the token query parameter.
+// @Tags         webhooks
+// @Accept       json
+// @Param        token  query  string  true  "Shared webhook secret"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Router       /webhooks/gmail [post]
+func (h *GmailPushHandler) Webhook(c *gin.Context) {
+	token := c.Query("token")
+	if h.cfg.GmailWebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.GmailWebhookToken)) != 1 {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "forbidden",
+			Message: "Invalid webhook token",
+		})
+		return
+	}
+
+	var push pubSubPush
+	if err := c.ShouldBindJSON(&push); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid Pub/Sub push envelope",
+		})
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		data, err = base64.URLEncoding.DecodeString(push.Message.Data)
+	}
+	var note gmailNotification
+	if err != nil || json.Unmarshal(data, &note) != nil || note.EmailAddress == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid Gmail notification payload",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// Anything other than 2xx makes Pub/Sub redeliver, so notifications we will never act on
+	// (unknown user, push disabled, already synced) are acknowledged and dropped
+	user, err := h.userRepo.FindByEmail(ctx, note.EmailAddress)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		// transient: let Pub/Sub redeliver
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to look up user",
+		})
+		return
+	}
+	if err != nil || !user.GmailWatchEnabled {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if note.HistoryID != 0 && note.HistoryID <= user.GmailHistoryID {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	h.scheduleSync(user.ID.Hex())
+	c.Status(http.StatusNoContent)
+}
+
+// scheduleSync runs a background sync for the user, or marks a running one to go again
+func (h *GmailPushHandler) scheduleSync(userID string) {
+	h.mu.Lock()
+	if h.running[userID] {
+		h.dirty[userID] = true
+		h.mu.Unlock()
+		return
+	}
+	h.running[userID] = true
+	h.mu.Unlock()
+
+	h.background.Go(func(ctx context.Context) {
+		for {
+			h.syncOnce(ctx, userID)
+
+			h.mu.Lock()
+			if !h.dirty[userID] || ctx.Err() != nil {
+				delete(h.running, userID)
+				delete(h.dirty, userID)
+				h.mu.Unlock()
+				return
+			}
+			delete(h.dirty, userID)
+			h.mu.Unlock()
+		}
+	})
+}
+
+func (h *GmailPushHandler) syncOnce(ctx context.Context, userID string) {
+	// Reload so the sync resumes from the latest stored history ID
+	user, err := h.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Println("gmail push: failed to load user:", userID, err)
+		return
+	}
+	if _, err := h.emails.syncUser(ctx, user); err != nil {
+		log.Println("gmail push: sync failed:", userID, err)
+	}
+}
+
+func (h *GmailPushHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/database"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dbPingTimeout bounds how long a probe waits on MongoDB
+const dbPingTimeout = 2 * time.Second
+
+// HealthHandler serves liveness, readiness and health probes
+type HealthHandler struct {
+	db  *database.MongoDB
+	cfg *config.Config
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(db *database.MongoDB, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{db: db, cfg: cfg}
+}
+
+// pingDB reports whether MongoDB answers a ping within dbPingTimeout
+func (h *HealthHandler) pingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+	return h.db.Client.Ping(ctx, nil)
+}
+
+// noStore overrides the public cache policy: a cached probe result would hide an outage
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+}
+
+// Health godoc
+// @Summary Health check
+// @Description Reports API, database and AI provider status. Returns 503 when MongoDB is unreachable.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /health [get]
+func (h *HealthHandler) Health(c *gin.Context) {
+	noStore(c)
+	status := "ok"
+	code := http.StatusOK
+	dbStatus := "connected"
+	if err := h.pingDB(c.Request.Context()); err != nil {
+		status = "degraded"
+		code = http.StatusServiceUnavailable
+		dbStatus = "unreachable: " + err.Error()
+	}
+
+	// Missing AI keys don't fail the probe: summaries and search fall back to local processing
+	llmStatus := "configured"
+	if h.cfg.LLMApiKey == "" {
+		llmStatus = "not configured (local fallback)"
+	}
+	embeddingStatus := "configured"
+	if h.cfg.EmbeddingProvider != "local" && h.cfg.EmbeddingAPIKey == "" {
+		embeddingStatus = "not configured (local fallback)"
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"message":   "AI Email Box API is running",
+		"database":  dbStatus,
+		"llm":       llmStatus,
+		"embedding": embeddingStatus,
+	})
+}
+
+// Live godoc
+// @Summary Liveness probe
+// @Description Returns 200 while the process is serving requests
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /live [get]
+func (h *HealthHandler) Live(c *gin.Context) {
+	noStore(c)
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready godoc
+// @Summary Readiness probe
+// @Description Returns 200 when MongoDB is reachable, 503 otherwise
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /ready [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	noStore(c)
+	if err := h.pingDB(c.Request.Context()); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -5,21 +5,37 @@ import (
 	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/repository"
 	"aiemailbox-be/internal/services"
+	"aiemailbox-be/internal/utils"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type KanbanHandler struct {
-	repo    *repository.EmailRepository
-	summary services.SummaryService
-	cfg     *config.Config
+	repo     *repository.EmailRepository
+	moves    *repository.KanbanMoveRepository
+	columns  *repository.KanbanConfigRepository
+	notes    *repository.CardNoteRepository
+	activity *repository.CardActivityRepository
+	userRepo *repository.UserRepository
+	gmail    *services.GmailService
+	summary  services.SummaryService
+	webhooks *services.WebhookService // nil when outbound webhooks are disabled
+	cfg      *config.Config
 }
 
-func NewKanbanHandler(repo *repository.EmailRepository, summary services.SummaryService, cfg *config.Config) *KanbanHandler {
-	return &KanbanHandler{repo: repo, summary: summary, cfg: cfg}
+func NewKanbanHandler(repo *repository.EmailRepository, moves *repository.KanbanMoveRepository, columns *repository.KanbanConfigRepository, notes *repository.CardNoteRepository, activity *repository.CardActivityRepository, userRepo *repository.UserRepository, gmail *services.GmailService, summary services.SummaryService, webhooks *services.WebhookService, cfg *config.Config) *KanbanHandler {
+	return &KanbanHandler{repo: repo, moves: moves, columns: columns, notes: notes, activity: activity, userRepo: userRepo, gmail: gmail, summary: summary, webhooks: webhooks, cfg: cfg}
 }
 
 // Card represents the Kanban card shape returned to the client
@@ -34,38 +50,184 @@ type Card struct {
 	ReceivedAt     time.Time  `json:"received_at"`
 	IsRead         bool       `json:"is_read"`
 	HasAttachments bool       `json:"has_attachments"`
+	// Checklist extracted by POST /api/emails/:emailId/action-items
+	ActionItems []models.ActionItem `json:"action_items,omitempty"`
+	// urgent | high | normal | low
+	Priority models.EmailPriority `json:"priority"`
+	// Phishing/spam risk; omitted until the email has been analyzed
+	RiskScore *int   `json:"risk_score,omitempty"`
+	RiskLevel string `json:"risk_level,omitempty"`
+	// newsletter | billing | personal | notification; omitted until categorized
+	Category models.EmailCategory `json:"category,omitempty"`
+	// Notes under /api/kanban/cards/:emailId/notes
+	NoteCount int `json:"note_count"`
+	// Latest entry of the card's activity log; omitted when it has none
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	// Column key the email is stored under; differs from the column it is listed in for
+	// uncategorized cards
+	Status string `json:"status"`
+	// groupBy=thread only: the card stands for every board message of the thread. The other
+	// fields are the latest message's; is_read is false while any message is unread.
+	ThreadID     string   `json:"thread_id,omitempty"`
+	MessageCount int      `json:"message_count,omitempty"`
+	UnreadCount  int      `json:"unread_count,omitempty"`
+	EmailIDs     []string `json:"email_ids,omitempty"`
+	// Gmail conversation of the card's email, as last fetched with threadInfo=true: whether a
+	// newer message is unread ("needs attention") and how many messages it has
+	ThreadUnread       bool `json:"thread_unread"`
+	ThreadMessageCount int  `json:"thread_message_count,omitempty"`
+	// Set on cards of GET /api/kanban/archive
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
 // ColMeta describes a single column metadata item returned by /api/kanban/meta
 type ColMeta struct {
-	Key   string `json:"key"`
-	Label string `json:"label"`
+	Key        string `json:"key"`
+	Label      string `json:"label"`
+	Color      string `json:"color,omitempty"`
+	GmailLabel string `json:"gmailLabel"`
 }
 
+// uncategorizedMeta describes the synthetic column of cards whose status has no column
+var uncategorizedMeta = ColMeta{Key: models.UncategorizedColumnKey, Label: "Uncategorized"}
+
 // MoveRequest is the payload for moving a card between columns
 type MoveRequest struct {
 	EmailID  string `json:"email_id" binding:"required"`
 	ToStatus string `json:"to_status" binding:"required"`
+	// Move every board message of the email's thread (cards of GET /api/kanban?groupBy=thread)
+	Thread bool `json:"thread"`
 }
 
-// SnoozeRequest is the payload for snoozing a card until a given time
+// SnoozeRequest is the payload for snoozing a card until a given time; exactly one of until
+// and preset is required
 type SnoozeRequest struct {
 	EmailID string `json:"email_id" binding:"required"`
-	Until   string `json:"until" binding:"required"` // RFC3339
+	Until   string `json:"until"` // RFC3339
+	// later_today | tomorrow_morning | next_week | weekend, in the user's time zone setting
+	Preset models.SnoozePreset `json:"preset"`
+	// daily | weekly: snooze again for the next period when due, until the card is moved
+	Recurrence models.SnoozeRecurrence `json:"recurrence"`
 }
 
 // SummarizeRequest requests generation of a summary for an email
 type SummarizeRequest struct {
-	EmailID string `json:"email_id" binding:"required"`
+	EmailID  string `json:"email_id" binding:"required"`
+	Language string `json:"language"` // "auto" (default) | "en" | "vi"
+	Length   string `json:"length"`   // "short" (default) | "medium" | "detailed"
+}
+
+// SummarizeBatchRequest summarizes either explicit emails or the unsummarized cards of a column
+type SummarizeBatchRequest struct {
+	EmailIDs []string `json:"email_ids"`
+	Column   string   `json:"column"`
+	Limit    int      `json:"limit"`
+	Language string   `json:"language"`
+	Length   string   `json:"length"`
+}
+
+// BatchSummaryResult is the outcome for a single email in a batch
+type BatchSummaryResult struct {
+	EmailID string `json:"email_id"`
+	OK      bool   `json:"ok"`
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SummarizeBatchResponse reports per-email results and totals
+type SummarizeBatchResponse struct {
+	Results    []BatchSummaryResult `json:"results"`
+	Summarized int                  `json:"summarized"`
+	Failed     int                  `json:"failed"`
+	Skipped    int                  `json:"skipped"`   // already had a summary
+	Remaining  int                  `json:"remaining"` // not processed before the deadline
+}
+
+const (
+	batchSummaryConcurrency = 3 // parallel LLM calls per batch
+	threadInfoConcurrency   = 5 // parallel Gmail thread lookups for GET /api/kanban?threadInfo=true
+	batchSummaryMaxEmails   = 100
+	batchSummaryDefaultSize = 20
+	batchSummaryTimeout     = 55 * time.Second
+)
+
+// Bulk card actions
+const (
+	BulkActionMove      = "move"
+	BulkActionSnooze    = "snooze"
+	BulkActionSummarize = "summarize"
+	BulkActionArchive   = "archive"
+)
+
+// bulkMaxEmails caps the cards of one bulk request
+const bulkMaxEmails = 100
+
+// BulkRequest applies one action to several cards
+type BulkRequest struct {
+	EmailIDs []string `json:"email_ids" binding:"required"`
+	Action   string   `json:"action" binding:"required"` // move | snooze | summarize | archive
+	ToStatus string   `json:"to_status"`                 // move
+	Until    string   `json:"until"`                     // snooze, RFC3339
+	Language string   `json:"language"`                  // summarize
+	Length   string   `json:"length"`                    // summarize
+}
+
+// BulkResult is the outcome for a single card of a bulk request
+type BulkResult struct {
+	EmailID string `json:"email_id"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Summary string `json:"summary,omitempty"` // summarize
+}
+
+// BulkResponse reports per-card results in request order
+type BulkResponse struct {
+	Action    string       `json:"action"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	// Set when the cards moved on the board but their Gmail labels could not be updated
+	GmailError string `json:"gmail_error,omitempty"`
+}
+
+// SummaryDebugRequest asks for the extractive summarizer's scoring of either raw text or a stored email
+type SummaryDebugRequest struct {
+	EmailID      string `json:"email_id"`
+	Text         string `json:"text"`
+	TopSentences int    `json:"top_sentences"`
+	MaxChars     int    `json:"max_chars"`
+}
+
+// SummaryDebugResponse exposes the scored sentences and the resulting summary
+type SummaryDebugResponse struct {
+	Sentences    []services.ScoredSentence `json:"sentences"`
+	Summary      string                    `json:"summary"`
+	TopSentences int                       `json:"top_sentences"`
+	MaxChars     int                       `json:"max_chars"`
 }
 
 // GET /api/kanban
 // GetKanban godoc
 // @Summary Get Kanban board
-// @Description Return kanban columns with cards
+// @Description Return the user's columns with their cards. columns maps every column key to its cards
+// @Description (empty columns included); order lists the columns as /api/kanban/meta does. Cards whose status
+// @Description matches no column are listed under "uncategorized", which is then appended to order.
+// @Description Filters apply to every column alike; filters echoes the active ones and counts the cards left
+// @Description per column.
 // @Tags kanban
 // @Security ApiKeyAuth
-// @Success 200 {object} map[string][]handlers.Card
+// @Param sender query string false "Case-insensitive substring of the sender's address or name"
+// @Param label query string false "Gmail label ID, e.g. STARRED or Label_123"
+// @Param from query string false "Received at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Received before (RFC 3339), or on or before (YYYY-MM-DD)"
+// @Param unreadOnly query bool false "Only unread emails (unread=true is accepted too)"
+// @Param hasAttachments query bool false "Only emails with attachments"
+// @Param priority query string false "Comma-separated priorities: urgent, high, normal, low"
+// @Param category query string false "Comma-separated categories: newsletter, billing, personal, notification"
+// @Param groupBy query string false "thread: one card per conversation, in the column of its most recently moved message"
+// @Param threadInfo query bool false "Refresh thread_unread and thread_message_count from Gmail (one call per conversation; slower)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban [get]
 func (h *KanbanHandler) GetKanban(c *gin.Context) {
@@ -76,40 +238,318 @@ func (h *KanbanHandler) GetKanban(c *gin.Context) {
 	}
 	ctx := c.Request.Context()
 	// read filtering & sorting query params
-	unreadOnly := c.Query("unread") == "true"
-	hasAttachmentsOnly := c.Query("hasAttachments") == "true"
+	filters, active, err := boardFiltersFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	sortBy := c.DefaultQuery("sortBy", "date")
 	sortOrder := c.DefaultQuery("sortOrder", "desc")
+	var priorities []models.EmailPriority
+	for _, p := range strings.Split(c.Query("priority"), ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if !models.ValidPriority(models.EmailPriority(p)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority " + p + " (use urgent, high, normal or low)"})
+			return
+		}
+		priorities = append(priorities, models.EmailPriority(p))
+	}
+	var categories []models.EmailCategory
+	for _, cat := range strings.Split(c.Query("category"), ",") {
+		cat = strings.ToLower(strings.TrimSpace(cat))
+		if cat == "" {
+			continue
+		}
+		if !models.ValidCategory(models.EmailCategory(cat)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category " + cat + " (use newsletter, billing, personal or notification)"})
+			return
+		}
+		categories = append(categories, models.EmailCategory(cat))
+	}
+
+	var groupByThread bool
+	switch c.Query("groupBy") {
+	case "":
+	case "thread":
+		groupByThread = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid groupBy " + c.Query("groupBy") + " (use thread)"})
+		return
+	}
 
-	board, err := h.repo.GetKanban(ctx, userID.(string), unreadOnly, hasAttachmentsOnly, sortBy, sortOrder)
+	cols, err := h.boardColumns(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch columns"})
+		return
+	}
+	var board map[string][]models.EmailThread
+	if groupByThread {
+		board, err = h.repo.GetKanbanThreads(ctx, userID.(string), filters, priorities, categories, sortBy, sortOrder)
+	} else {
+		var emails map[string][]models.Email
+		emails, err = h.repo.GetKanban(ctx, userID.(string), filters, priorities, categories, sortBy, sortOrder)
+		board = singleMessageCards(emails)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if c.Query("threadInfo") == "true" {
+		h.refreshThreadState(ctx, userID.(string), board)
+	}
 
-	resp := map[string][]Card{}
-	for status, emails := range board {
-		for _, e := range emails {
-			sender := e.From.Email
-			if e.From.Name != "" {
-				sender = e.From.Name
+	var ids []string
+	for _, threads := range board {
+		for _, t := range threads {
+			ids = append(ids, t.EmailIDs...)
+		}
+	}
+	noteCounts, err := h.notes.CountByEmails(ctx, userID.(string), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	lastActivity, err := h.activity.LastByEmails(ctx, userID.(string), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Statuses without a column (e.g. left by an older release) still show up, in one bucket
+	known := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		known[col.Key] = true
+	}
+	var uncategorized []models.EmailThread
+	for status, threads := range board {
+		if !known[status] {
+			uncategorized = append(uncategorized, threads...)
+			delete(board, status)
+		}
+	}
+	if len(uncategorized) > 0 {
+		// Cards of several statuses were merged; restore the requested order across them
+		sortBoardCards(uncategorized, sortBy, sortOrder)
+		board[models.UncategorizedColumnKey] = uncategorized
+	}
+
+	resp := make(map[string][]Card, len(board)+len(cols))
+	counts := make(map[string]int, len(board)+len(cols))
+	for _, col := range cols {
+		resp[col.Key] = []Card{}
+		counts[col.Key] = 0
+	}
+	for column, threads := range board {
+		for _, t := range threads {
+			card := h.newCard(&t, noteCounts, lastActivity)
+			if groupByThread {
+				card.ThreadID = t.Latest.ThreadID
+				card.MessageCount = len(t.EmailIDs)
+				card.UnreadCount = t.UnreadCount
+				card.EmailIDs = t.EmailIDs
 			}
-			card := Card{
-				ID:             e.ID,
-				Sender:         sender,
-				Subject:        e.Subject,
-				Summary:        e.Summary,
-				Preview:        e.Preview,
-				GmailURL:       e.GmailURL,
-				SnoozedUntil:   e.SnoozedUntil,
-				ReceivedAt:     e.ReceivedAt,
-				IsRead:         e.IsRead,
-				HasAttachments: e.HasAttachments,
+			resp[column] = append(resp[column], card)
+		}
+		counts[column] = len(resp[column])
+	}
+
+	order := columnMeta(cols)
+	if len(uncategorized) > 0 {
+		order = append(order, uncategorizedMeta)
+	}
+	c.JSON(http.StatusOK, gin.H{"columns": resp, "order": order, "filters": active, "counts": counts})
+}
+
+// boardFiltersFromQuery reads the board filters: sender, label, from and to (RFC 3339 or
+// YYYY-MM-DD; a bare date in to includes that whole day), unreadOnly (or unread) and
+// hasAttachments. It also returns the active filters as given, for the response.
+func boardFiltersFromQuery(c *gin.Context) (*models.SearchFilters, gin.H, error) {
+	f := &models.SearchFilters{
+		Sender: strings.TrimSpace(c.Query("sender")),
+		Label:  strings.TrimSpace(c.Query("label")),
+	}
+	active := gin.H{}
+	if f.Sender != "" {
+		active["sender"] = f.Sender
+	}
+	if f.Label != "" {
+		active["label"] = f.Label
+	}
+
+	parseDate := func(name string, endOfDay bool) (*time.Time, error) {
+		raw := strings.TrimSpace(c.Query(name))
+		if raw == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			active[name] = raw
+			return &t, nil
+		}
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q (use an RFC 3339 time or YYYY-MM-DD)", name, raw)
+		}
+		active[name] = raw
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	var err error
+	if f.DateFrom, err = parseDate("from", false); err != nil {
+		return nil, nil, err
+	}
+	if f.DateTo, err = parseDate("to", true); err != nil {
+		return nil, nil, err
+	}
+	if f.DateFrom != nil && f.DateTo != nil && !f.DateFrom.Before(*f.DateTo) {
+		return nil, nil, errors.New("from must be before to")
+	}
+	if len(f.Sender) > 256 {
+		return nil, nil, errors.New("sender must be at most 256 characters")
+	}
+
+	if c.Query("unreadOnly") == "true" || c.Query("unread") == "true" {
+		unread := false
+		f.IsRead = &unread
+		active["unreadOnly"] = true
+	}
+	if c.Query("hasAttachments") == "true" {
+		has := true
+		f.HasAttachment = &has
+		active["hasAttachments"] = true
+	}
+	return f, active, nil
+}
+
+// refreshThreadState fetches the Gmail conversation state of each card's email and stores it,
+// with at most threadInfoConcurrency lookups in flight. Failures are logged and leave the
+// stored state as it was.
+func (h *KanbanHandler) refreshThreadState(ctx context.Context, userID string, board map[string][]models.EmailThread) {
+	user, err := h.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Println("kanban: thread info: failed to load user:", err)
+		return
+	}
+
+	var latest []*models.Email
+	for _, threads := range board {
+		for i := range threads {
+			if threads[i].Latest.ThreadID != "" {
+				latest = append(latest, &threads[i].Latest)
 			}
-			resp[status] = append(resp[status], card)
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"columns": resp})
+
+	sem := make(chan struct{}, threadInfoConcurrency)
+	var wg sync.WaitGroup
+	for _, e := range latest {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(e *models.Email) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			count, unread, err := h.gmail.GetThreadState(ctx, user, e.ThreadID, e.ID)
+			if err != nil {
+				log.Printf("kanban: thread info for %s: %v", e.ID, err)
+				return
+			}
+			e.ThreadMessageCount, e.ThreadUnread = count, unread
+			if err := h.repo.SetThreadState(ctx, e.ID, count, unread); err != nil {
+				log.Printf("kanban: failed to store thread info for %s: %v", e.ID, err)
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// singleMessageCards wraps each email of a GetKanban board as a thread of its own, so both
+// board modes build cards the same way
+func singleMessageCards(board map[string][]models.Email) map[string][]models.EmailThread {
+	out := make(map[string][]models.EmailThread, len(board))
+	for status, emails := range board {
+		threads := make([]models.EmailThread, 0, len(emails))
+		for _, e := range emails {
+			threads = append(threads, singleMessageThread(e, models.EmailStatus(status)))
+		}
+		out[status] = threads
+	}
+	return out
+}
+
+// singleMessageThread wraps e as a thread of its own, listed under status
+func singleMessageThread(e models.Email, status models.EmailStatus) models.EmailThread {
+	t := models.EmailThread{
+		Latest:         e,
+		EmailIDs:       []string{e.ID},
+		HasAttachments: e.HasAttachments,
+		Status:         status,
+		SnoozedUntil:   e.SnoozedUntil,
+	}
+	if !e.IsRead {
+		t.UnreadCount = 1
+	}
+	return t
+}
+
+// newCard builds the card of a thread from its latest message; notes and activity of all its
+// messages count
+func (h *KanbanHandler) newCard(t *models.EmailThread, noteCounts map[string]int, lastActivity map[string]time.Time) Card {
+	e := &t.Latest
+	sender := e.From.Email
+	if e.From.Name != "" {
+		sender = e.From.Name
+	}
+	card := Card{
+		ID:             e.ID,
+		Sender:         sender,
+		Subject:        e.Subject,
+		Summary:        e.Summary,
+		Preview:        e.Preview,
+		GmailURL:       e.GmailURL,
+		SnoozedUntil:   t.SnoozedUntil,
+		ReceivedAt:     e.ReceivedAt,
+		IsRead:         t.UnreadCount == 0,
+		HasAttachments: t.HasAttachments,
+		ActionItems:    e.ActionItems,
+		Priority:       e.Priority,
+		Category:       e.Category,
+		Status:         string(t.Status),
+	}
+	card.ThreadUnread, card.ThreadMessageCount = e.ThreadUnread, e.ThreadMessageCount
+	for _, id := range t.EmailIDs {
+		card.NoteCount += noteCounts[id]
+		if at, ok := lastActivity[id]; ok && (card.LastActivityAt == nil || at.After(*card.LastActivityAt)) {
+			card.LastActivityAt = &at
+		}
+	}
+	if card.Priority == "" {
+		card.Priority = models.PriorityNormal
+	}
+	if card.Status == "" {
+		card.Status = string(models.StatusInbox)
+	}
+	if e.Security != nil {
+		score := e.Security.RiskScore
+		card.RiskScore = &score
+		card.RiskLevel = e.Security.RiskLevel
+	}
+	// Emails stored before links were mapped
+	if card.GmailURL == "" {
+		card.GmailURL = services.GmailWebURL(h.cfg.GmailWebURL, e.ThreadID, e.ID)
+	}
+	return card
 }
 
 // POST /api/kanban/move
@@ -120,9 +560,16 @@ func (h *KanbanHandler) GetKanban(c *gin.Context) {
 // @Param payload body handlers.MoveRequest true "Move payload"
 // @Success 200 {object} map[string]bool
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban/move [post]
 func (h *KanbanHandler) Move(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
 	var body MoveRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -130,40 +577,258 @@ func (h *KanbanHandler) Move(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	if err := h.repo.UpdateStatus(ctx, body.EmailID, body.ToStatus); err != nil {
+	if body.Thread {
+		h.moveThread(c, userID.(string), body)
+		return
+	}
+	if status, msg := h.checkWipLimit(ctx, userID.(string), body.ToStatus, body.EmailID); status != http.StatusOK {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	previous, err := h.repo.MoveStatus(ctx, userID.(string), body.EmailID, body.ToStatus)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	fromStatus := previous.Status
+	if fromStatus == "" {
+		fromStatus = models.StatusInbox
+	}
+	if string(fromStatus) != body.ToStatus {
+		h.recordActivity(ctx, &models.CardActivity{
+			UserID:     userID.(string),
+			EmailID:    body.EmailID,
+			Type:       models.CardActivityMove,
+			FromStatus: fromStatus,
+			ToStatus:   models.EmailStatus(body.ToStatus),
+		})
+	}
+
+	// Remember where the card was for POST /api/kanban/undo; the move itself already happened
+	if h.cfg.KanbanUndoDepth > 0 && string(previous.Status) != body.ToStatus {
+		now := time.Now()
+		move := &models.KanbanMove{
+			UserID:           userID.(string),
+			EmailID:          body.EmailID,
+			FromStatus:       previous.Status,
+			FromSnoozedUntil: previous.SnoozedUntil,
+			ToStatus:         models.EmailStatus(body.ToStatus),
+			MovedAt:          now,
+			ExpiresAt:        now.Add(h.cfg.KanbanUndoWindow),
+		}
+		if move.FromStatus == "" {
+			move.FromStatus = models.StatusInbox
+		}
+		if err := h.moves.Record(ctx, move, h.cfg.KanbanUndoDepth); err != nil {
+			log.Println("failed to record kanban move:", err)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// moveThread moves every board message of body.EmailID's thread to body.ToStatus in one batch.
+// The thread is one card, so the WIP limit is checked as for a single move. Thread moves are
+// not recorded for undo.
+func (h *KanbanHandler) moveThread(c *gin.Context, userID string, body MoveRequest) {
+	ctx := c.Request.Context()
+	ids, err := h.repo.ThreadEmailIDs(ctx, userID, body.EmailID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status, msg := h.checkWipLimit(ctx, userID, body.ToStatus, ids...); status != http.StatusOK {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	previous, err := h.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	failed, err := h.repo.BulkSetStatus(ctx, userID, ids, body.ToStatus, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var moved []string
+	var activity []*models.CardActivity
+	for _, id := range ids {
+		if _, ok := failed[id]; ok {
+			continue
+		}
+		moved = append(moved, id)
+		from := previous[id].Status
+		if from == "" {
+			from = models.StatusInbox
+		}
+		if string(from) != body.ToStatus {
+			activity = append(activity, &models.CardActivity{
+				UserID:     userID,
+				EmailID:    id,
+				Type:       models.CardActivityMove,
+				FromStatus: from,
+				ToStatus:   models.EmailStatus(body.ToStatus),
+				Detail:     "thread",
+			})
+		}
+	}
+	h.recordActivity(ctx, activity...)
+
+	failures := map[string]string{}
+	addBulkFailures(failures, failed)
+	c.JSON(http.StatusOK, gin.H{"ok": len(failures) == 0, "moved": moved, "failed": failures})
+}
+
+// checkWipLimit returns 409 when moving the card of emailIDs into the toStatus column would
+// exceed the column's WIP limit. Columns without a limit (or not configured) accept any move.
+func (h *KanbanHandler) checkWipLimit(ctx context.Context, userID, toStatus string, emailIDs ...string) (int, string) {
+	column, err := h.columns.GetColumnByKey(ctx, userID, toStatus)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return http.StatusOK, ""
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to load column"
+	}
+	if column.WipLimit == nil {
+		return http.StatusOK, ""
+	}
+	// The card itself doesn't count, so moves within the column always pass
+	count, err := h.repo.CountInStatus(ctx, userID, toStatus, emailIDs...)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to count cards"
+	}
+	if count >= int64(*column.WipLimit) {
+		return http.StatusConflict, fmt.Sprintf("Column %q is at its WIP limit of %d cards; move a card out first", column.Label, *column.WipLimit)
+	}
+	return http.StatusOK, ""
+}
+
+// POST /api/kanban/undo
+// Undo godoc
+// @Summary Undo the last card move
+// @Description Moves the card of the user's most recent move (within KANBAN_UNDO_WINDOW) back to its previous column. Repeated calls walk further back through the move history.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/undo [post]
+func (h *KanbanHandler) Undo(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	for {
+		move, err := h.moves.PopLatest(ctx, userID.(string))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if move == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "nothing to undo"})
+			return
+		}
+		err = h.repo.RestoreStatus(ctx, userID.(string), move.EmailID, string(move.FromStatus), move.FromSnoozedUntil)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// the email is gone (deleted or cleaned up); undo the move before it
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		h.recordActivity(ctx, &models.CardActivity{
+			UserID:       userID.(string),
+			EmailID:      move.EmailID,
+			Type:         models.CardActivityMove,
+			FromStatus:   move.ToStatus,
+			ToStatus:     move.FromStatus,
+			SnoozedUntil: move.FromSnoozedUntil,
+			Detail:       "undo",
+		})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "reverted": move})
+		return
+	}
+}
+
 // POST /api/kanban/snooze
 // Snooze godoc
 // @Summary Snooze a card until a given time
 // @Tags kanban
 // @Security ApiKeyAuth
+// @Description Snoozes until an RFC3339 time or a preset resolved in the user's time zone (PATCH /auth/me/settings). With a recurrence the card is snoozed again for the next day or week each time it is due, until it is moved.
 // @Param payload body handlers.SnoozeRequest true "Snooze payload"
-// @Success 200 {object} map[string]bool
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban/snooze [post]
 func (h *KanbanHandler) Snooze(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
 	var body SnoozeRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	until, err := time.Parse(time.RFC3339, body.Until)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time format, use RFC3339"})
+	if (body.Until == "") == (body.Preset == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either until or preset is required"})
+		return
+	}
+	if body.Recurrence != "" && !models.ValidSnoozeRecurrence(body.Recurrence) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurrence " + string(body.Recurrence) + " (use daily or weekly)"})
 		return
 	}
 	ctx := c.Request.Context()
-	if err := h.repo.SetSnooze(ctx, body.EmailID, until); err != nil {
+	var until time.Time
+	if body.Preset != "" {
+		user, err := h.userRepo.FindByID(ctx, userID.(string))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		until, err = body.Preset.Resolve(time.Now(), user.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		t, err := time.Parse(time.RFC3339, body.Until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid time format, use RFC3339"})
+			return
+		}
+		until = t
+	}
+	previous, err := h.repo.SetSnooze(ctx, userID.(string), body.EmailID, until, body.Preset, body.Recurrence)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	entry := snoozeActivity(userID.(string), body.EmailID, previous.Status, until)
+	entry.Detail = strings.Trim(string(body.Preset)+" "+string(body.Recurrence), " ")
+	h.recordActivity(ctx, entry)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "snoozed_until": until, "preset": body.Preset, "recurrence": body.Recurrence})
 }
 
 // POST /api/kanban/summarize
@@ -174,55 +839,597 @@ func (h *KanbanHandler) Snooze(c *gin.Context) {
 // @Param payload body handlers.SummarizeRequest true "Summarize payload"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban/summarize [post]
 func (h *KanbanHandler) Summarize(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
 	var body SummarizeRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	opts, err := services.SummaryOptions{Language: body.Language, Length: body.Length}.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	ctx := c.Request.Context()
-	summary, err := h.summary.SummarizeAndSave(ctx, body.EmailID)
+	if _, err := h.repo.GetOwned(ctx, userID.(string), body.EmailID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	summary, err := h.summary.SummarizeAndSave(ctx, body.EmailID, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.recordActivity(ctx, summaryActivity(userID.(string), body.EmailID, opts))
 	c.JSON(http.StatusOK, gin.H{"ok": true, "summary": summary})
 }
 
+// POST /api/kanban/summarize-batch
+// SummarizeBatch godoc
+// @Summary Generate summaries for several emails
+// @Description Summarizes the given email_ids, or up to limit unsummarized cards of a column. Emails that already have a summary are skipped; work stops at the request deadline and the rest is reported as remaining.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param payload body handlers.SummarizeBatchRequest true "Email IDs or column key"
+// @Success 200 {object} handlers.SummarizeBatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/summarize-batch [post]
+func (h *KanbanHandler) SummarizeBatch(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var body SummarizeBatchRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(body.EmailIDs) == 0 && body.Column == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either email_ids or column is required"})
+		return
+	}
+	if len(body.EmailIDs) > batchSummaryMaxEmails {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many email_ids (max 100)"})
+		return
+	}
+
+	opts, err := services.SummaryOptions{Language: body.Language, Length: body.Length}.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), batchSummaryTimeout)
+	defer cancel()
+
+	resp := SummarizeBatchResponse{Results: []BatchSummaryResult{}}
+	var pending []string
+
+	if len(body.EmailIDs) > 0 {
+		emails, err := h.repo.GetByIDs(ctx, body.EmailIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Every email must exist and belong to the caller before any work starts
+		for _, id := range body.EmailIDs {
+			e, ok := emails[id]
+			if !ok || e.UserID != userID.(string) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "email not found: " + id})
+				return
+			}
+			if e.Summary != "" {
+				resp.Skipped++
+				continue
+			}
+			pending = append(pending, id)
+		}
+	} else {
+		limit := body.Limit
+		if limit <= 0 {
+			limit = batchSummaryDefaultSize
+		}
+		if limit > batchSummaryMaxEmails {
+			limit = batchSummaryMaxEmails
+		}
+		emails, err := h.repo.ListUnsummarized(ctx, userID.(string), body.Column, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, e := range emails {
+			pending = append(pending, e.ID)
+		}
+	}
+
+	results := h.summarizeConcurrently(ctx, pending, opts)
+	var activity []*models.CardActivity
+	for _, r := range results {
+		switch {
+		case r == nil:
+			resp.Remaining++
+		case r.OK:
+			resp.Summarized++
+			resp.Results = append(resp.Results, *r)
+			activity = append(activity, summaryActivity(userID.(string), r.EmailID, opts))
+		default:
+			resp.Failed++
+			resp.Results = append(resp.Results, *r)
+		}
+	}
+	// the batch may have used up the request's deadline
+	h.recordActivity(context.WithoutCancel(ctx), activity...)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// summarizeConcurrently summarizes emails with at most batchSummaryConcurrency calls in flight.
+// Results keep the input order; emails not started before ctx is done are left nil.
+func (h *KanbanHandler) summarizeConcurrently(ctx context.Context, emailIDs []string, opts services.SummaryOptions) []*BatchSummaryResult {
+	results := make([]*BatchSummaryResult, len(emailIDs))
+	sem := make(chan struct{}, batchSummaryConcurrency)
+	var wg sync.WaitGroup
+
+	for i, id := range emailIDs {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			summary, err := h.summary.SummarizeAndSave(ctx, id, opts)
+			if err != nil {
+				results[i] = &BatchSummaryResult{EmailID: id, Error: err.Error()}
+				return
+			}
+			results[i] = &BatchSummaryResult{EmailID: id, OK: true, Summary: summary}
+		}(i, id)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// POST /api/kanban/bulk
+// Bulk godoc
+// @Summary Move, snooze, summarize or archive several cards
+// @Description Applies action to up to 100 email_ids. Every ID is checked to belong to the caller first; the others fail individually. Moves and snoozes are written in one batch, moves respect the target column's WIP limit, and the mapped Gmail labels of moved or archived cards are updated with one batchModify call. Bulk moves are not recorded for undo.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param payload body handlers.BulkRequest true "Cards and action"
+// @Success 200 {object} handlers.BulkResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/bulk [post]
+func (h *KanbanHandler) Bulk(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var body BulkRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ids := uniqueIDs(body.EmailIDs)
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email_ids is required"})
+		return
+	}
+	if len(ids) > bulkMaxEmails {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many email_ids (max %d)", bulkMaxEmails)})
+		return
+	}
+
+	var until time.Time
+	var opts services.SummaryOptions
+	switch body.Action {
+	case BulkActionMove:
+		if body.ToStatus == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_status is required to move"})
+			return
+		}
+	case BulkActionSnooze:
+		t, err := time.Parse(time.RFC3339, body.Until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until, use RFC3339"})
+			return
+		}
+		until = t
+	case BulkActionSummarize:
+		o, err := services.SummaryOptions{Language: body.Language, Length: body.Length}.Normalize()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		opts = o
+	case BulkActionArchive:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action " + body.Action + " (use move, snooze, summarize or archive)"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), batchSummaryTimeout)
+	defer cancel()
+
+	// Ownership of every ID is checked before anything is written
+	emails, err := h.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	failures := map[string]string{}
+	var owned []string
+	for _, id := range ids {
+		if e, ok := emails[id]; !ok || e.UserID != userID.(string) {
+			failures[id] = "email not found"
+			continue
+		}
+		owned = append(owned, id)
+	}
+
+	resp := BulkResponse{Action: body.Action, Results: make([]BulkResult, 0, len(ids))}
+	summaries := map[string]string{}
+	switch body.Action {
+	case BulkActionMove:
+		resp.GmailError, err = h.bulkMove(ctx, userID.(string), owned, body.ToStatus, emails, failures)
+	case BulkActionSnooze:
+		var failed map[string]error
+		failed, err = h.repo.BulkSetStatus(ctx, userID.(string), owned, string(models.StatusSnoozed), &until)
+		addBulkFailures(failures, failed)
+	case BulkActionArchive:
+		err = h.bulkArchive(ctx, userID.(string), owned, failures)
+	case BulkActionSummarize:
+		for _, r := range h.summarizeConcurrently(ctx, owned, opts) {
+			if r == nil {
+				continue
+			}
+			if !r.OK {
+				failures[r.EmailID] = r.Error
+				continue
+			}
+			summaries[r.EmailID] = r.Summary
+		}
+		for _, id := range owned {
+			if _, done := summaries[id]; !done && failures[id] == "" {
+				failures[id] = "not summarized before the deadline"
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var activity []*models.CardActivity
+	for _, id := range ids {
+		if msg, failed := failures[id]; failed {
+			resp.Results = append(resp.Results, BulkResult{EmailID: id, Error: msg})
+			resp.Failed++
+			continue
+		}
+		resp.Results = append(resp.Results, BulkResult{EmailID: id, OK: true, Summary: summaries[id]})
+		resp.Succeeded++
+
+		switch from := emails[id].Status; body.Action {
+		case BulkActionMove:
+			if from == "" {
+				from = models.StatusInbox
+			}
+			if string(from) != body.ToStatus {
+				activity = append(activity, &models.CardActivity{
+					UserID:     userID.(string),
+					EmailID:    id,
+					Type:       models.CardActivityMove,
+					FromStatus: from,
+					ToStatus:   models.EmailStatus(body.ToStatus),
+					Detail:     "bulk",
+				})
+			}
+		case BulkActionSnooze:
+			activity = append(activity, snoozeActivity(userID.(string), id, from, until))
+		case BulkActionSummarize:
+			activity = append(activity, summaryActivity(userID.(string), id, opts))
+		}
+	}
+	h.recordActivity(context.WithoutCancel(ctx), activity...)
+	c.JSON(http.StatusOK, resp)
+}
+
+// bulkMove moves ids to toStatus, filling the column up to its WIP limit, and moves their
+// Gmail labels from the columns they left to the target column's with one batchModify call.
+// Failed IDs are added to failures; a Gmail error is returned as a message, since the board
+// is already updated by then.
+func (h *KanbanHandler) bulkMove(ctx context.Context, userID string, ids []string, toStatus string, emails map[string]models.Email, failures map[string]string) (string, error) {
+	columns, err := h.columns.GetColumns(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	var target *models.KanbanColumn
+	for i := range columns {
+		if columns[i].Key == toStatus {
+			target = &columns[i]
+		}
+	}
+
+	if target != nil && target.WipLimit != nil && len(ids) > 0 {
+		// cards of the batch already in the column keep their place
+		count, err := h.repo.CountInStatus(ctx, userID, toStatus, ids...)
+		if err != nil {
+			return "", err
+		}
+		free := max(*target.WipLimit-int(count), 0)
+		if len(ids) > free {
+			for _, id := range ids[free:] {
+				failures[id] = fmt.Sprintf("column %q is at its WIP limit of %d cards", target.Label, *target.WipLimit)
+			}
+			ids = ids[:free]
+		}
+	}
+
+	failed, err := h.repo.BulkSetStatus(ctx, userID, ids, toStatus, nil)
+	if err != nil {
+		return "", err
+	}
+	addBulkFailures(failures, failed)
+
+	// Labels of the columns the moved cards came from, minus the target column's
+	var add, remove []string
+	if target != nil && target.GmailLabel != "" {
+		add = []string{target.GmailLabel}
+	}
+	var moved []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if _, failed := failures[id]; failed {
+			continue
+		}
+		moved = append(moved, id)
+		from := string(emails[id].Status)
+		if from == "" {
+			from = string(models.StatusInbox)
+		}
+		for _, col := range columns {
+			if col.Key == from && col.GmailLabel != "" && (target == nil || col.GmailLabel != target.GmailLabel) && !seen[col.GmailLabel] {
+				seen[col.GmailLabel] = true
+				remove = append(remove, col.GmailLabel)
+			}
+		}
+	}
+	if len(moved) == 0 || (len(add) == 0 && len(remove) == 0) {
+		return "", nil
+	}
+	user, err := h.userRepo.FindByID(ctx, userID)
+	if err == nil {
+		err = h.gmail.BatchModifyEmails(ctx, user, moved, add, remove)
+	}
+	if err != nil {
+		log.Println("bulk move: failed to update Gmail labels:", err)
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// bulkArchive removes the INBOX label of ids in Gmail with one batchModify call, then from
+// the cached copies. A Gmail error fails every card.
+func (h *KanbanHandler) bulkArchive(ctx context.Context, userID string, ids []string, failures map[string]string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	user, err := h.userRepo.FindByID(ctx, userID)
+	if err == nil {
+		err = h.gmail.BatchModifyEmails(ctx, user, ids, nil, []string{"INBOX"})
+	}
+	if err != nil {
+		for _, id := range ids {
+			failures[id] = "Gmail: " + err.Error()
+		}
+		return nil
+	}
+	failed, err := h.repo.BulkRemoveLabel(ctx, userID, ids, "INBOX")
+	addBulkFailures(failures, failed)
+	return err
+}
+
+// addBulkFailures records the per-email errors of a bulk repository write in failures
+func addBulkFailures(failures map[string]string, failed map[string]error) {
+	for id, err := range failed {
+		failures[id] = err.Error()
+	}
+}
+
+// sortBoardCards sorts cards by their latest message the way EmailRepository.GetKanban sorts
+// emails for sortBy and sortOrder
+func sortBoardCards(threads []models.EmailThread, sortBy, sortOrder string) {
+	direction := -1
+	if strings.ToLower(sortOrder) == "asc" {
+		direction = 1
+	}
+	newestFirst := func(a, b models.Email) int {
+		return cmp.Or(b.ReceivedAt.Compare(a.ReceivedAt), cmp.Compare(b.ID, a.ID))
+	}
+	slices.SortStableFunc(threads, func(ta, tb models.EmailThread) int {
+		a, b := ta.Latest, tb.Latest
+		switch strings.ToLower(sortBy) {
+		case "subject":
+			return cmp.Or(direction*cmp.Compare(a.Subject, b.Subject), newestFirst(a, b))
+		case "sender", "from":
+			return cmp.Or(direction*cmp.Compare(a.From.Email, b.From.Email), newestFirst(a, b))
+		default:
+			return direction * -newestFirst(a, b)
+		}
+	})
+}
+
+// uniqueIDs drops empty and repeated IDs, keeping the first occurrence's order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var out []string
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
+
 // GET /api/kanban/meta
-// Returns ordered columns with keys and labels for frontend to render
+// Meta godoc
+// @Summary Get board columns
+// @Description The user's columns in their configured order (defaults are created on first use)
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string][]handlers.ColMeta
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/meta [get]
 func (h *KanbanHandler) Meta(c *gin.Context) {
-	cols := h.cfg.KanbanColumns
-	// helper to normalize label -> key
-	normalize := func(s string) string {
-		s = strings.ToLower(strings.TrimSpace(s))
-		s = strings.ReplaceAll(s, " ", "_")
-		return s
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	cols, err := h.boardColumns(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch columns"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"columns": columnMeta(cols)})
+}
+
+// boardColumns returns the user's columns in order, creating the defaults on first use
+func (h *KanbanHandler) boardColumns(ctx context.Context, userID string) ([]models.KanbanColumn, error) {
+	if err := h.columns.InitDefaultColumns(ctx, userID); err != nil {
+		return nil, err
 	}
+	return h.columns.GetColumns(ctx, userID)
+}
 
-	// map some common labels to canonical status keys
-	canonical := map[string]string{
-		"inbox":       string(models.StatusInbox),
-		"to do":       string(models.StatusTodo),
-		"todo":        string(models.StatusTodo),
-		"in progress": string(models.StatusInProgress),
-		"in_progress": string(models.StatusInProgress),
-		"done":        string(models.StatusDone),
-		"snoozed":     string(models.StatusSnoozed),
+// columnMeta converts columns to the metadata the frontend renders
+func columnMeta(cols []models.KanbanColumn) []ColMeta {
+	out := make([]ColMeta, 0, len(cols))
+	for _, col := range cols {
+		out = append(out, ColMeta{Key: col.Key, Label: col.Label, Color: col.Color, GmailLabel: col.GmailLabel})
 	}
+	return out
+}
 
-	var out []ColMeta
-	for _, l := range cols {
-		norm := strings.ToLower(strings.TrimSpace(l))
-		key, ok := canonical[norm]
-		if !ok {
-			// fallback: normalized slug
-			key = normalize(l)
+// kanbanUser returns the caller's user ID, or writes 401
+func kanbanUser(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return "", false
+	}
+	return userID.(string), true
+}
+
+// POST /api/summary/debug
+// SummaryDebug godoc
+// @Summary Inspect extractive summarizer scoring (admins, debug endpoints only)
+// @Description Returns every candidate sentence with its score and whether it was chosen. email_id must be one of the caller's emails.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param payload body handlers.SummaryDebugRequest true "Text or email to score"
+// @Success 200 {object} handlers.SummaryDebugResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /summary/debug [post]
+func (h *KanbanHandler) SummaryDebug(c *gin.Context) {
+	userID, ok := kanbanUser(c)
+	if !ok {
+		return
+	}
+	var body SummaryDebugRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	text := body.Text
+	if text == "" {
+		if body.EmailID == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "either text or email_id is required",
+			})
+			return
+		}
+		// Only the caller's own emails: the body is echoed back in the scoring
+		email, err := h.repo.GetOwned(c.Request.Context(), userID, body.EmailID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, models.ErrorResponse{
+					Error:   "not_found",
+					Message: "Email not found",
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to load email: " + err.Error(),
+			})
+			return
+		}
+		text = email.Body
+		if strings.TrimSpace(text) == "" {
+			text = email.Preview
 		}
-		out = append(out, ColMeta{Key: key, Label: l})
+	}
+	text = utils.SanitizeHTML(text)
+
+	// Same defaults as the card summarizer
+	if body.TopSentences <= 0 {
+		body.TopSentences = 2
+	}
+	if body.MaxChars <= 0 {
+		body.MaxChars = 120
 	}
 
-	c.JSON(http.StatusOK, gin.H{"columns": out})
+	sentences, summary := services.ScoreExtractiveSentences(text, body.TopSentences, body.MaxChars)
+	if sentences == nil {
+		sentences = []services.ScoredSentence{}
+	}
+	c.JSON(http.StatusOK, SummaryDebugResponse{
+		Sentences:    sentences,
+		Summary:      summary,
+		TopSentences: body.TopSentences,
+		MaxChars:     body.MaxChars,
+	})
 }
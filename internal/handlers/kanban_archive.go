@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	archiveDefaultLimit = 50
+	archiveMaxLimit     = 100
+)
+
+// ArchiveDoneRequest archives the cards that have been in a column for at least days
+type ArchiveDoneRequest struct {
+	// Default models.DefaultArchiveDays; 0 archives every card of the column
+	Days *int `json:"days"`
+	// Column key; default done
+	Column string `json:"column"`
+}
+
+// POST /api/kanban/archive-done
+// ArchiveDone godoc
+// @Summary Archive old cards of the done column
+// @Description Archives the cards that entered the column (done unless column is given) more than days ago; cards never
+// @Description moved count from when they were received. Archived cards leave the board and the status statistics but
+// @Description stay in mailboxes and search; list them with GET /api/kanban/archive.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param payload body handlers.ArchiveDoneRequest false "Age in days (default 14) and column"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/archive-done [post]
+func (h *KanbanHandler) ArchiveDone(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var body ArchiveDoneRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	days := models.DefaultArchiveDays
+	if body.Days != nil {
+		days = *body.Days
+	}
+	if days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must not be negative"})
+		return
+	}
+	column := body.Column
+	if column == "" {
+		column = string(models.StatusDone)
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.columns.GetColumnByKey(ctx, userID.(string), column); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown column " + column})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cutoff := models.ArchiveCutoff(time.Now(), days)
+	archived, err := h.repo.ArchiveBefore(ctx, userID.(string), column, cutoff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"archived": archived, "column": column, "cutoff": cutoff})
+}
+
+// GET /api/kanban/archive
+// ListArchive godoc
+// @Summary List archived cards
+// @Description Newest first. Pass nextCursor as cursor for the next page.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/archive [get]
+func (h *KanbanHandler) ListArchive(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	limit := archiveDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(n, archiveMaxLimit)
+	}
+
+	emails, next, err := h.repo.ListArchived(c.Request.Context(), userID.(string), c.Query("cursor"), limit)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cards := make([]Card, 0, len(emails))
+	for _, e := range emails {
+		t := singleMessageThread(e, e.Status)
+		card := h.newCard(&t, nil, nil)
+		card.ArchivedAt = e.ArchivedAt
+		cards = append(cards, card)
+	}
+	c.JSON(http.StatusOK, gin.H{"cards": cards, "nextCursor": next})
+}
+
+// POST /api/kanban/archive/:emailId/restore
+// RestoreArchived godoc
+// @Summary Restore an archived card
+// @Description The card returns to the column it was archived from. Moving an archived card restores it too.
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Success 200 {object} handlers.Card
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/archive/{emailId}/restore [post]
+func (h *KanbanHandler) RestoreArchived(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	email, err := h.repo.Unarchive(c.Request.Context(), userID.(string), c.Param("emailId"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archived card not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	t := singleMessageThread(*email, email.Status)
+	c.JSON(http.StatusOK, h.newCard(&t, nil, nil))
+}
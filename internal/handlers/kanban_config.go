@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // KanbanConfigHandler handles Kanban configuration endpoints
@@ -20,7 +24,10 @@ type KanbanConfigHandler struct {
 	configRepo   *repository.KanbanConfigRepository
 	emailRepo    *repository.EmailRepository
 	gmailService *services.GmailService
+	mail         *services.MailProviders
 	cfg          *config.Config
+	// Needed for the Gmail client when creating or deleting labels
+	userRepo *repository.UserRepository
 }
 
 // NewKanbanConfigHandler creates a new handler
@@ -28,16 +35,30 @@ func NewKanbanConfigHandler(
 	configRepo *repository.KanbanConfigRepository,
 	emailRepo *repository.EmailRepository,
 	gmailService *services.GmailService,
+	mail *services.MailProviders,
 	cfg *config.Config,
+	userRepo *repository.UserRepository,
 ) *KanbanConfigHandler {
 	return &KanbanConfigHandler{
 		configRepo:   configRepo,
 		emailRepo:    emailRepo,
 		gmailService: gmailService,
+		mail:         mail,
 		cfg:          cfg,
+		userRepo:     userRepo,
 	}
 }
 
+// columnKeyPattern is the format of keys set through UpdateColumn
+var columnKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// columnUpdateResponse is the updated column plus, after a key change, how many cards moved
+// to the new key
+type columnUpdateResponse struct {
+	models.KanbanColumn
+	Migrated *int64 `json:"migrated,omitempty"`
+}
+
 // ========== Column Configuration Endpoints ==========
 
 // GetColumns godoc
@@ -46,6 +67,7 @@ func NewKanbanConfigHandler(
 // @Tags kanban-config
 // @Security ApiKeyAuth
 // @Produce json
+// @Param counts query bool false "Include each column's current card count"
 // @Success 200 {object} map[string][]models.KanbanColumn
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban/columns [get]
@@ -75,11 +97,28 @@ func (h *KanbanConfigHandler) GetColumns(c *gin.Context) {
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
 
-	c.JSON(http.StatusOK, gin.H{"columns": columns})
+	if c.Query("counts") != "true" {
+		c.JSON(http.StatusOK, gin.H{"columns": columns})
+		return
+	}
+
+	// Include live card counts so headers render in one call
+	counts, err := h.emailRepo.CountByStatus(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count cards"})
+		return
+	}
+	withCounts := make([]models.KanbanColumnWithCount, len(columns))
+	for i, col := range columns {
+		withCounts[i] = models.KanbanColumnWithCount{KanbanColumn: col, Count: counts[col.Key]}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"columns": withCounts})
 }
 
 // CreateColumn godoc
 // @Summary Create a new Kanban column
+// @Description With createGmailLabel the backing Gmail label is created (or an existing one with the same name reused)
 // @Tags kanban-config
 // @Security ApiKeyAuth
 // @Accept json
@@ -88,6 +127,7 @@ func (h *KanbanConfigHandler) GetColumns(c *gin.Context) {
 // @Success 201 {object} models.KanbanColumn
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
 // @Router /kanban/columns [post]
 func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -102,6 +142,15 @@ func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 		return
 	}
 
+	if req.WipLimit != nil && *req.WipLimit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wipLimit must be positive"})
+		return
+	}
+	if req.AutoArchiveDays != nil && *req.AutoArchiveDays <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "autoArchiveDays must be positive"})
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	// Get max order
@@ -111,6 +160,38 @@ func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 		return
 	}
 
+	// Create the backing Gmail label first so the column never points at a missing one
+	gmailLabel := req.GmailLabel
+	var createdLabel *models.GmailLabel
+	if req.CreateGmailLabel {
+		name := strings.TrimSpace(req.GmailLabel)
+		if name == "" {
+			name = strings.TrimSpace(req.Label)
+		}
+		user, err := h.userRepo.FindByID(ctx, userID.(string))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+			return
+		}
+		label, created, err := h.gmailService.CreateLabel(ctx, user, name)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create Gmail label: " + err.Error()})
+			return
+		}
+		gmailLabel = label.ID
+		if created {
+			createdLabel = label
+		}
+		defer func() {
+			// Don't leave a fresh label behind when the column couldn't be saved
+			if createdLabel != nil && c.Writer.Status() != http.StatusCreated {
+				if err := h.gmailService.DeleteLabel(ctx, user, createdLabel.ID); err != nil {
+					fmt.Printf("failed to roll back Gmail label %s: %v\n", createdLabel.ID, err)
+				}
+			}
+		}()
+	}
+
 	// Generate key from label
 	key := h.generateKey(req.Label)
 
@@ -120,9 +201,11 @@ func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 		Key:        key,
 		Label:      req.Label,
 		Order:      maxOrder + 1,
-		GmailLabel: req.GmailLabel,
+		GmailLabel: gmailLabel,
 		Color:      req.Color,
 		IsDefault:  false,
+		WipLimit:   req.WipLimit,
+		AutoArchiveDays: req.AutoArchiveDays,
 	}
 
 	if err := h.configRepo.CreateColumn(ctx, column); err != nil {
@@ -135,6 +218,7 @@ func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 
 // UpdateColumn godoc
 // @Summary Update a Kanban column
+// @Description Changing key moves the column's cards to the new key; migrated is the number moved
 // @Tags kanban-config
 // @Security ApiKeyAuth
 // @Accept json
@@ -143,7 +227,9 @@ func (h *KanbanConfigHandler) CreateColumn(c *gin.Context) {
 // @Param payload body models.UpdateColumnRequest true "Update data"
 // @Success 200 {object} models.KanbanColumn
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /kanban/columns/{id} [put]
 func (h *KanbanConfigHandler) UpdateColumn(c *gin.Context) {
@@ -192,6 +278,37 @@ func (h *KanbanConfigHandler) UpdateColumn(c *gin.Context) {
 	if req.Order != nil {
 		updates["order"] = *req.Order
 	}
+	if req.WipLimit != nil {
+		switch {
+		case *req.WipLimit < 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wipLimit must not be negative"})
+			return
+		case *req.WipLimit == 0:
+			updates["wipLimit"] = nil
+		default:
+			updates["wipLimit"] = *req.WipLimit
+		}
+	}
+	if req.AutoArchiveDays != nil {
+		switch {
+		case *req.AutoArchiveDays < 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "autoArchiveDays must not be negative"})
+			return
+		case *req.AutoArchiveDays == 0:
+			updates["autoArchiveDays"] = nil
+		default:
+			updates["autoArchiveDays"] = *req.AutoArchiveDays
+		}
+	}
+	newKey := strings.TrimSpace(req.Key)
+	if newKey != "" && newKey != column.Key {
+		status, err := h.checkKeyChange(ctx, column, newKey)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		updates["key"] = newKey
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No updates provided"})
@@ -200,23 +317,46 @@ func (h *KanbanConfigHandler) UpdateColumn(c *gin.Context) {
 
 	// Use FindOneAndUpdate to get the updated document atomically
 	updatedColumn, err := h.configRepo.UpdateColumnAndReturn(ctx, columnID, updates)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A column with key %q already exists", newKey)})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update column"})
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedColumn)
+	resp := columnUpdateResponse{KanbanColumn: *updatedColumn}
+	if _, changed := updates["key"]; changed {
+		// The column has its new key first so a card never points at a key no column has
+		// for longer than the migration takes
+		migrated, err := h.emailRepo.ReassignStatus(ctx, userID.(string), column.Key, newKey)
+		if err != nil {
+			if rollbackErr := h.configRepo.UpdateColumn(ctx, columnID, map[string]interface{}{"key": column.Key}); rollbackErr != nil {
+				fmt.Printf("failed to restore key %s of column %s: %v\n", column.Key, columnID, rollbackErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move cards to the new key"})
+			return
+		}
+		resp.Migrated = &migrated
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // DeleteColumn godoc
 // @Summary Delete a Kanban column
+// @Description The column's cards move to reassignTo (default inbox); migrated is the number moved. With deleteGmailLabel=true the mapped Gmail user label is deleted too, unless another column still uses it
 // @Tags kanban-config
 // @Security ApiKeyAuth
 // @Param id path string true "Column ID"
-// @Success 200 {object} map[string]bool
+// @Param reassignTo query string false "Key of the column that receives the cards (default inbox; not snoozed)"
+// @Param deleteGmailLabel query bool false "Also delete the backing Gmail label"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
 // @Router /kanban/columns/{id} [delete]
 func (h *KanbanConfigHandler) DeleteColumn(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -250,6 +390,27 @@ func (h *KanbanConfigHandler) DeleteColumn(c *gin.Context) {
 		return
 	}
 
+	// The column's cards move elsewhere so they don't drop off the board
+	target := strings.TrimSpace(c.DefaultQuery("reassignTo", string(models.StatusInbox)))
+	if status, err := h.checkReassignTarget(ctx, userID.(string), column.Key, target); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	migrated, err := h.emailRepo.ReassignStatus(ctx, userID.(string), column.Key, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move the column's cards"})
+		return
+	}
+
+	// Remove the Gmail label before the column so a failure leaves both in place
+	if c.Query("deleteGmailLabel") == "true" && column.GmailLabel != "" {
+		status, err := h.deleteGmailLabel(ctx, userID.(string), column)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	if err := h.configRepo.DeleteColumn(ctx, columnID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete column"})
 		return
@@ -267,7 +428,7 @@ func (h *KanbanConfigHandler) DeleteColumn(c *gin.Context) {
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
 
-	c.JSON(http.StatusOK, gin.H{"columns": columns})
+	c.JSON(http.StatusOK, gin.H{"columns": columns, "migrated": migrated, "reassignedTo": target})
 }
 
 // ReorderColumns godoc
@@ -319,10 +480,12 @@ func (h *KanbanConfigHandler) ReorderColumns(c *gin.Context) {
 
 // GetGmailLabels godoc
 // @Summary Get available Gmail labels
+// @Description The user's Gmail labels; type is "system" or "user"
 // @Tags kanban-config
 // @Security ApiKeyAuth
 // @Produce json
 // @Success 200 {object} map[string][]models.GmailLabel
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /gmail/labels [get]
 func (h *KanbanConfigHandler) GetGmailLabels(c *gin.Context) {
@@ -334,7 +497,19 @@ func (h *KanbanConfigHandler) GetGmailLabels(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	labels, err := h.gmailService.GetLabels(ctx, userID.(string))
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	provider, err := h.mail.For(user)
+	if err != nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+
+	labels, err := provider.GetLabels(ctx, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Gmail labels: " + err.Error()})
 		return
@@ -343,6 +518,78 @@ func (h *KanbanConfigHandler) GetGmailLabels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"labels": labels})
 }
 
+// deleteGmailLabel deletes the Gmail label of column unless another of the user's columns
+// is mapped to it. Returns the status to answer with on error.
+func (h *KanbanConfigHandler) deleteGmailLabel(ctx context.Context, userID string, column *models.KanbanColumn) (int, error) {
+	columns, err := h.configRepo.GetColumns(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("Failed to fetch columns")
+	}
+	for _, other := range columns {
+		if other.ID != column.ID && other.GmailLabel == column.GmailLabel {
+			return 0, nil
+		}
+	}
+
+	user, err := h.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("Failed to load user")
+	}
+	if err := h.gmailService.DeleteLabel(ctx, user, column.GmailLabel); err != nil {
+		if errors.Is(err, services.ErrSystemLabel) {
+			return http.StatusBadRequest, fmt.Errorf("Gmail label %s is a system label and can't be deleted", column.GmailLabel)
+		}
+		return http.StatusBadGateway, fmt.Errorf("Failed to delete Gmail label: %v", err)
+	}
+	return 0, nil
+}
+
+// checkReassignTarget validates the column the cards of column from move to when it is
+// deleted. Returns the status to answer with on error.
+func (h *KanbanConfigHandler) checkReassignTarget(ctx context.Context, userID, from, target string) (int, error) {
+	switch {
+	case target == string(models.StatusSnoozed):
+		return http.StatusBadRequest, errors.New("Cards can't be reassigned to snoozed")
+	case target == from:
+		return http.StatusBadRequest, errors.New("reassignTo must be another column")
+	case target == string(models.StatusInbox):
+		// Always on the board, with or without a column document
+		return 0, nil
+	}
+	if _, err := h.configRepo.GetColumnByKey(ctx, userID, target); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return http.StatusBadRequest, fmt.Errorf("reassignTo column %q not found", target)
+		}
+		return http.StatusInternalServerError, errors.New("Failed to fetch columns")
+	}
+	return 0, nil
+}
+
+// checkKeyChange validates renaming the key of column to key. Returns the status to answer
+// with on error.
+func (h *KanbanConfigHandler) checkKeyChange(ctx context.Context, column *models.KanbanColumn, key string) (int, error) {
+	if column.IsDefault {
+		return http.StatusForbidden, errors.New("Cannot change the key of a default column")
+	}
+	if !columnKeyPattern.MatchString(key) {
+		return http.StatusBadRequest, errors.New("key must be 1-64 lowercase letters, digits or underscores")
+	}
+	switch models.EmailStatus(key) {
+	case models.StatusInbox, models.StatusTodo, models.StatusInProgress, models.StatusDone, models.StatusSnoozed:
+		return http.StatusBadRequest, fmt.Errorf("key %q is reserved for a default column", key)
+	case models.UncategorizedColumnKey:
+		return http.StatusBadRequest, fmt.Errorf("key %q is reserved for the board", key)
+	}
+	_, err := h.configRepo.GetColumnByKey(ctx, column.UserID, key)
+	if err == nil {
+		return http.StatusConflict, fmt.Errorf("A column with key %q already exists", key)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return http.StatusInternalServerError, errors.New("Failed to fetch columns")
+	}
+	return 0, nil
+}
+
 // Helper: generate URL-safe key from label
 func (h *KanbanConfigHandler) generateKey(label string) string {
 	key := strings.ToLower(label)
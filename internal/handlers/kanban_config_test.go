@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveGet runs handler on a GET of target, as userID when set
+func serveGet(handler gin.HandlerFunc, userID, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("userID", userID)
+		}
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestGetColumnsCounts(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	configRepo := repository.NewKanbanConfigRepository(db)
+	configHandler := NewKanbanConfigHandler(configRepo, emailRepo, nil, nil, nil, nil)
+	kanbanHandler := NewKanbanHandler(emailRepo, nil, configRepo, repository.NewCardNoteRepository(db), repository.NewCardActivityRepository(db), nil, nil, nil, nil, nil)
+
+	now := time.Now()
+	for _, e := range []*models.Email{
+		{ID: "i1", UserID: "u1", MailboxID: "INBOX", Status: models.StatusInbox},
+		{ID: "i2", UserID: "u1", MailboxID: "INBOX"}, // no status yet: an inbox card
+		{ID: "t1", UserID: "u1", MailboxID: "INBOX", Status: models.StatusTodo},
+		{ID: "t2", UserID: "u1", MailboxID: "INBOX", Status: models.StatusTodo},
+		{ID: "t3", UserID: "u1", MailboxID: "INBOX", Status: models.StatusTodo},
+		{ID: "d1", UserID: "u1", MailboxID: "INBOX", Status: models.StatusDone},
+		// Not on the board
+		{ID: "trash", UserID: "u1", MailboxID: "TRASH", Status: models.StatusTodo},
+		{ID: "archived", UserID: "u1", MailboxID: "INBOX", Status: models.StatusDone, ArchivedAt: &now},
+		{ID: "deleted", UserID: "u1", MailboxID: "INBOX", Status: models.StatusInbox, DeletedAt: &now},
+		{ID: "skipped", UserID: "u1", MailboxID: "INBOX", Status: models.StatusInbox, SkipBoard: true},
+		{ID: "other", UserID: "u2", MailboxID: "INBOX", Status: models.StatusInProgress},
+	} {
+		if err := emailRepo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serveGet(configHandler.GetColumns, "u1", "/?counts=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetColumns status = %d, body %s", w.Code, w.Body)
+	}
+	var columns struct {
+		Columns []models.KanbanColumnWithCount `json:"columns"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &columns); err != nil {
+		t.Fatal(err)
+	}
+
+	w = serveGet(kanbanHandler.GetKanban, "u1", "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetKanban status = %d, body %s", w.Code, w.Body)
+	}
+	var board struct {
+		Columns map[string][]Card `json:"columns"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &board); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"inbox": 2, "todo": 3, "in_progress": 0, "done": 1, "snoozed": 0}
+	if len(columns.Columns) != len(want) {
+		t.Fatalf("got %d columns, want the %d defaults", len(columns.Columns), len(want))
+	}
+	for _, col := range columns.Columns {
+		if col.Count != want[col.Key] {
+			t.Errorf("column %s count = %d, want %d", col.Key, col.Count, want[col.Key])
+		}
+		if n := len(board.Columns[col.Key]); col.Count != n {
+			t.Errorf("column %s count = %d, board has %d cards", col.Key, col.Count, n)
+		}
+	}
+
+	// Without the flag the columns carry no count at all
+	w = serveGet(configHandler.GetColumns, "u1", "/")
+	var raw struct {
+		Columns []map[string]any `json:"columns"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil || len(raw.Columns) != len(want) {
+		t.Fatalf("GetColumns without counts = %s (err %v)", w.Body, err)
+	}
+	if _, ok := raw.Columns[0]["count"]; ok {
+		t.Error("count included without ?counts=true")
+	}
+}
+
+// These cases are rejected before any column lookup, so the handler needs no repositories
+func TestColumnCascadeRejections(t *testing.T) {
+	h := NewKanbanConfigHandler(nil, nil, nil, nil, nil, nil)
+	ctx := context.Background()
+	custom := &models.KanbanColumn{UserID: "u1", Key: "waiting"}
+
+	keyChanges := []struct {
+		column *models.KanbanColumn
+		key    string
+		want   int
+	}{
+		{&models.KanbanColumn{UserID: "u1", Key: "todo", IsDefault: true}, "tasks", http.StatusForbidden},
+		{custom, "Waiting On", http.StatusBadRequest},
+		{custom, strings.Repeat("a", 65), http.StatusBadRequest},
+		{custom, "snoozed", http.StatusBadRequest},
+		{custom, "inbox", http.StatusBadRequest},
+	}
+	for _, tt := range keyChanges {
+		if status, err := h.checkKeyChange(ctx, tt.column, tt.key); err == nil || status != tt.want {
+			t.Errorf("checkKeyChange(%s -> %q) = %d, %v; want %d", tt.column.Key, tt.key, status, err, tt.want)
+		}
+	}
+
+	for _, target := range []string{"snoozed", "waiting"} {
+		if status, err := h.checkReassignTarget(ctx, "u1", "waiting", target); err == nil || status != http.StatusBadRequest {
+			t.Errorf("checkReassignTarget(%q) = %d, %v; want 400", target, status, err)
+		}
+	}
+	if _, err := h.checkReassignTarget(ctx, "u1", "waiting", "inbox"); err != nil {
+		t.Errorf("checkReassignTarget(inbox) = %v; the inbox always accepts cards", err)
+	}
+}
+
+// boardRouter serves the board and column config routes as userID
+func boardRouter(kanban *KanbanHandler, config *KanbanConfigHandler, userID string) func(method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", userID) })
+	r.GET("/kanban", kanban.GetKanban)
+	r.GET("/kanban/meta", kanban.Meta)
+	r.POST("/kanban/move", kanban.Move)
+	r.GET("/kanban/columns", config.GetColumns)
+	r.POST("/kanban/columns", config.CreateColumn)
+	r.PUT("/kanban/columns/:id", config.UpdateColumn)
+	r.DELETE("/kanban/columns/:id", config.DeleteColumn)
+	r.POST("/kanban/columns/reorder", config.ReorderColumns)
+	return func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestCustomColumnsEndToEnd(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	configRepo := repository.NewKanbanConfigRepository(db)
+	configHandler := NewKanbanConfigHandler(configRepo, emailRepo, nil, nil, nil, nil)
+	kanbanHandler := NewKanbanHandler(emailRepo, nil, configRepo, repository.NewCardNoteRepository(db), repository.NewCardActivityRepository(db), nil, nil, nil, nil, &config.Config{})
+	serve := boardRouter(kanbanHandler, configHandler, "u1")
+
+	decode := func(w *httptest.ResponseRecorder, wantCode int, v any) {
+		t.Helper()
+		if w.Code != wantCode {
+			t.Fatalf("status = %d, want %d, body %s", w.Code, wantCode, w.Body)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type board struct {
+		Columns map[string][]Card `json:"columns"`
+		Order   []ColMeta         `json:"order"`
+	}
+	getBoard := func() board {
+		t.Helper()
+		var b board
+		decode(serve(http.MethodGet, "/kanban", ""), http.StatusOK, &b)
+		return b
+	}
+	keys := func(cols []ColMeta) []string {
+		var out []string
+		for _, c := range cols {
+			out = append(out, c.Key)
+		}
+		return out
+	}
+	cardIDs := func(cards []Card) []string {
+		var out []string
+		for _, c := range cards {
+			out = append(out, c.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	// A new user gets the default columns
+	var meta struct {
+		Columns []ColMeta `json:"columns"`
+	}
+	decode(serve(http.MethodGet, "/kanban/meta", ""), http.StatusOK, &meta)
+	defaults := []string{"inbox", "todo", "in_progress", "done", "snoozed"}
+	if got := keys(meta.Columns); !slices.Equal(got, defaults) {
+		t.Fatalf("meta columns = %v, want %v", got, defaults)
+	}
+
+	// A custom column is listed after them, then moved to the front
+	var waiting models.KanbanColumn
+	decode(serve(http.MethodPost, "/kanban/columns", `{"label":"Waiting on","color":"#fef9c3"}`), http.StatusCreated, &waiting)
+	var columns struct {
+		Columns []models.KanbanColumn `json:"columns"`
+	}
+	decode(serve(http.MethodGet, "/kanban/columns", ""), http.StatusOK, &columns)
+	ids := []string{waiting.ID}
+	for _, col := range columns.Columns {
+		if col.ID != waiting.ID {
+			ids = append(ids, col.ID)
+		}
+	}
+	body, _ := json.Marshal(models.ReorderColumnsRequest{ColumnIDs: ids})
+	decode(serve(http.MethodPost, "/kanban/columns/reorder", string(body)), http.StatusOK, &columns)
+	decode(serve(http.MethodGet, "/kanban/meta", ""), http.StatusOK, &meta)
+	if want := append([]string{waiting.Key}, defaults...); !slices.Equal(keys(meta.Columns), want) {
+		t.Fatalf("meta columns = %v, want %v", keys(meta.Columns), want)
+	}
+	if meta.Columns[0] != (ColMeta{Key: waiting.Key, Label: "Waiting on", Color: "#fef9c3"}) {
+		t.Errorf("custom column meta = %+v", meta.Columns[0])
+	}
+
+	for _, e := range []*models.Email{
+		{ID: "c1", UserID: "u1", MailboxID: "INBOX"},
+		{ID: "c2", UserID: "u1", MailboxID: "INBOX"},
+		{ID: "legacy", UserID: "u1", MailboxID: "INBOX", Status: "followup"}, // no column has this key
+	} {
+		if err := emailRepo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"c1", "c2"} {
+		if w := serve(http.MethodPost, "/kanban/move", `{"email_id":"`+id+`","to_status":"`+waiting.Key+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("move %s = %d %s", id, w.Code, w.Body)
+		}
+	}
+
+	b := getBoard()
+	if want := append(append([]string{waiting.Key}, defaults...), models.UncategorizedColumnKey); !slices.Equal(keys(b.Order), want) {
+		t.Errorf("board order = %v, want %v", keys(b.Order), want)
+	}
+	if got := cardIDs(b.Columns[waiting.Key]); !slices.Equal(got, []string{"c1", "c2"}) {
+		t.Errorf("%s cards = %v", waiting.Key, got)
+	}
+	if got := b.Columns[models.UncategorizedColumnKey]; len(got) != 1 || got[0].ID != "legacy" || got[0].Status != "followup" {
+		t.Errorf("uncategorized cards = %+v", got)
+	}
+	if got := b.Columns["todo"]; got == nil || len(got) != 0 {
+		t.Errorf("empty todo column = %v, want listed and empty", got)
+	}
+
+	// Renaming the key takes the cards along
+	var updated struct {
+		models.KanbanColumn
+		Migrated *int64 `json:"migrated"`
+	}
+	decode(serve(http.MethodPut, "/kanban/columns/"+waiting.ID, `{"key":"blocked","label":"Blocked"}`), http.StatusOK, &updated)
+	if updated.Key != "blocked" || updated.Label != "Blocked" || updated.Migrated == nil || *updated.Migrated != 2 {
+		t.Fatalf("update = %+v, migrated %v", updated.KanbanColumn, updated.Migrated)
+	}
+	b = getBoard()
+	if _, ok := b.Columns[waiting.Key]; ok {
+		t.Errorf("old key %s is still on the board", waiting.Key)
+	}
+	if got := cardIDs(b.Columns["blocked"]); !slices.Equal(got, []string{"c1", "c2"}) {
+		t.Errorf("blocked cards = %v", got)
+	}
+
+	// Deleting it moves the cards to the chosen column
+	var deleted struct {
+		Migrated     int64  `json:"migrated"`
+		ReassignedTo string `json:"reassignedTo"`
+	}
+	decode(serve(http.MethodDelete, "/kanban/columns/"+waiting.ID+"?reassignTo=todo", ""), http.StatusOK, &deleted)
+	if deleted.Migrated != 2 || deleted.ReassignedTo != "todo" {
+		t.Errorf("delete = %+v", deleted)
+	}
+	b = getBoard()
+	if want := append(slices.Clone(defaults), models.UncategorizedColumnKey); !slices.Equal(keys(b.Order), want) {
+		t.Errorf("board order after delete = %v, want %v", keys(b.Order), want)
+	}
+	if got := cardIDs(b.Columns["todo"]); !slices.Equal(got, []string{"c1", "c2"}) {
+		t.Errorf("todo cards = %v", got)
+	}
+
+	// Another user's board is untouched by all of this
+	var other board
+	decode(boardRouter(kanbanHandler, configHandler, "u2")(http.MethodGet, "/kanban", ""), http.StatusOK, &other)
+	if !slices.Equal(keys(other.Order), defaults) {
+		t.Errorf("u2 board order = %v, want the defaults", keys(other.Order))
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	cardActivityDefaultLimit = 50
+	cardActivityMaxLimit     = 200
+)
+
+// GET /api/kanban/cards/:emailId/notes
+// ListCardNotes godoc
+// @Summary List a card's notes
+// @Description Returns the caller's notes on the card, oldest first
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Success 200 {object} map[string][]models.CardNote
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/cards/{emailId}/notes [get]
+func (h *KanbanHandler) ListCardNotes(c *gin.Context) {
+	userID, ok := h.cardOwner(c)
+	if !ok {
+		return
+	}
+	notes, err := h.notes.List(c.Request.Context(), userID, c.Param("emailId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notes": notes})
+}
+
+// POST /api/kanban/cards/:emailId/notes
+// CreateCardNote godoc
+// @Summary Add a note to a card
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Param payload body models.CardNoteRequest true "Note text"
+// @Success 201 {object} models.CardNote
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/cards/{emailId}/notes [post]
+func (h *KanbanHandler) CreateCardNote(c *gin.Context) {
+	userID, ok := h.cardOwner(c)
+	if !ok {
+		return
+	}
+	text, ok := bindNoteText(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	note := &models.CardNote{UserID: userID, EmailID: c.Param("emailId"), Text: text}
+	if err := h.notes.Create(ctx, note); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.recordActivity(ctx, &models.CardActivity{
+		UserID:  userID,
+		EmailID: note.EmailID,
+		Type:    models.CardActivityNoteAdded,
+		NoteID:  note.ID.Hex(),
+		At:      note.CreatedAt,
+	})
+	c.JSON(http.StatusCreated, note)
+}
+
+// PUT /api/kanban/cards/:emailId/notes/:noteId
+// UpdateCardNote godoc
+// @Summary Edit a card note
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Param noteId path string true "Note ID"
+// @Param payload body models.CardNoteRequest true "New note text"
+// @Success 200 {object} models.CardNote
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/cards/{emailId}/notes/{noteId} [put]
+func (h *KanbanHandler) UpdateCardNote(c *gin.Context) {
+	userID, ok := h.cardOwner(c)
+	if !ok {
+		return
+	}
+	text, ok := bindNoteText(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	note, err := h.notes.Update(ctx, userID, c.Param("emailId"), c.Param("noteId"), text)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "note not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.recordActivity(ctx, &models.CardActivity{
+		UserID:  userID,
+		EmailID: note.EmailID,
+		Type:    models.CardActivityNoteEdited,
+		NoteID:  note.ID.Hex(),
+		At:      note.UpdatedAt,
+	})
+	c.JSON(http.StatusOK, note)
+}
+
+// DELETE /api/kanban/cards/:emailId/notes/:noteId
+// DeleteCardNote godoc
+// @Summary Delete a card note
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Param noteId path string true "Note ID"
+// @Success 200 {object} map[string]bool
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/cards/{emailId}/notes/{noteId} [delete]
+func (h *KanbanHandler) DeleteCardNote(c *gin.Context) {
+	userID, ok := h.cardOwner(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	emailID, noteID := c.Param("emailId"), c.Param("noteId")
+	if err := h.notes.Delete(ctx, userID, emailID, noteID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "note not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.recordActivity(ctx, &models.CardActivity{
+		UserID:  userID,
+		EmailID: emailID,
+		Type:    models.CardActivityNoteDeleted,
+		NoteID:  noteID,
+	})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GET /api/kanban/cards/:emailId/activity
+// GetCardActivity godoc
+// @Summary Get a card's activity log
+// @Description Returns moves, snoozes, summaries and note edits of the card, newest first
+// @Tags kanban
+// @Security ApiKeyAuth
+// @Param emailId path string true "Email ID"
+// @Param limit query int false "Max entries (default 50, max 200)"
+// @Success 200 {object} map[string][]models.CardActivity
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /kanban/cards/{emailId}/activity [get]
+func (h *KanbanHandler) GetCardActivity(c *gin.Context) {
+	userID, ok := h.cardOwner(c)
+	if !ok {
+		return
+	}
+	limit := cardActivityDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(n, cardActivityMaxLimit)
+	}
+
+	entries, err := h.activity.List(c.Request.Context(), userID, c.Param("emailId"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"activity": entries})
+}
+
+// cardOwner returns the caller's ID after checking that the :emailId card is theirs; it
+// writes the error response otherwise
+func (h *KanbanHandler) cardOwner(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", false
+	}
+	if _, err := h.repo.GetOwned(c.Request.Context(), userID.(string), c.Param("emailId")); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return userID.(string), true
+}
+
+// bindNoteText reads and validates the text of a CardNoteRequest
+func bindNoteText(c *gin.Context) (string, bool) {
+	var body models.CardNoteRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	text := strings.TrimSpace(body.Text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text must not be blank"})
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > models.CardNoteMaxLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("text must be at most %d characters", models.CardNoteMaxLength)})
+		return "", false
+	}
+	return text, true
+}
+
+// recordActivity appends entries to the card activity log. The change they describe already
+// happened, so a failure is only logged.
+func (h *KanbanHandler) recordActivity(ctx context.Context, entries ...*models.CardActivity) {
+	if err := h.activity.Record(ctx, entries...); err != nil {
+		log.Println("failed to record card activity:", err)
+	}
+	// Moves and summaries are also sent to the user's webhook
+	h.webhooks.EmitActivity(ctx, entries...)
+}
+
+// snoozeActivity is the log entry of snoozing emailID out of column from until the given time
+func snoozeActivity(userID, emailID string, from models.EmailStatus, until time.Time) *models.CardActivity {
+	if from == "" {
+		from = models.StatusInbox
+	}
+	return &models.CardActivity{
+		UserID:       userID,
+		EmailID:      emailID,
+		Type:         models.CardActivitySnooze,
+		FromStatus:   from,
+		ToStatus:     models.StatusSnoozed,
+		SnoozedUntil: &until,
+	}
+}
+
+// summaryActivity is the log entry of summarizing emailID with opts
+func summaryActivity(userID, emailID string, opts services.SummaryOptions) *models.CardActivity {
+	return &models.CardActivity{
+		UserID:  userID,
+		EmailID: emailID,
+		Type:    models.CardActivitySummary,
+		Detail:  opts.Language + "/" + opts.Length,
+	}
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// kanbanRuleDryRunEmails is how many of the latest emails a dry run checks
+const kanbanRuleDryRunEmails = 100
+
+// KanbanRuleHandler manages the user's Kanban rules
+type KanbanRuleHandler struct {
+	repo      *repository.KanbanRuleRepository
+	emailRepo *repository.EmailRepository
+}
+
+// NewKanbanRuleHandler creates a new Kanban rule handler
+func NewKanbanRuleHandler(repo *repository.KanbanRuleRepository, emailRepo *repository.EmailRepository) *KanbanRuleHandler {
+	return &KanbanRuleHandler{repo: repo, emailRepo: emailRepo}
+}
+
+// ListKanbanRules godoc
+// @Summary      List Kanban rules
+// @Description  The user's Kanban rules in evaluation order
+// @Tags         kanban
+// @Produce      json
+// @Success      200  {array}   models.KanbanRule
+// @Failure      401  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules [get]
+func (h *KanbanRuleHandler) ListKanbanRules(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	rules, err := h.repo.List(c.Request.Context(), userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load Kanban rules: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetKanbanRule godoc
+// @Summary      Get a Kanban rule
+// @Tags         kanban
+// @Produce      json
+// @Param        id   path      string  true  "Rule ID"
+// @Success      200  {object}  models.KanbanRule
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules/{id} [get]
+func (h *KanbanRuleHandler) GetKanbanRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateKanbanRule godoc
+// @Summary      Create a Kanban rule
+// @Description  Kanban rules run in order on newly synced emails that would start in the inbox; the first match applies its action. Every condition that is set (senderContains, domainEquals, subjectMatches, hasAttachment, labelEquals) must match. The action can set the column and priority, snooze the email for a duration and keep it off the board. The rule that fired is stored on the email as kanbanRuleId.
+// @Tags         kanban
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.CreateKanbanRuleRequest  true  "Rule"
+// @Success      201      {object}  models.KanbanRule
+// @Failure      400      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules [post]
+func (h *KanbanRuleHandler) CreateKanbanRule(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	var req models.CreateKanbanRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	rule := &models.KanbanRule{
+		UserID:     userID,
+		Name:       strings.TrimSpace(req.Name),
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		Conditions: trimKanbanConditions(req.Conditions),
+		Action:     trimKanbanAction(req.Action),
+	}
+	if !validKanbanRule(c, rule) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.Order != nil {
+		rule.Order = *req.Order
+	} else {
+		next, err := h.repo.NextOrder(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to load Kanban rules: " + err.Error(),
+			})
+			return
+		}
+		rule.Order = next
+	}
+	if err := h.repo.Create(ctx, rule); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to create Kanban rule: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateKanbanRule godoc
+// @Summary      Update a Kanban rule
+// @Tags         kanban
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                          true  "Rule ID"
+// @Param        request  body      models.UpdateKanbanRuleRequest  true  "Fields to change"
+// @Success      200      {object}  models.KanbanRule
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules/{id} [put]
+func (h *KanbanRuleHandler) UpdateKanbanRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateKanbanRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	set := bson.M{}
+	if req.Name != nil {
+		rule.Name = strings.TrimSpace(*req.Name)
+		set["name"] = rule.Name
+	}
+	if req.Order != nil {
+		set["order"] = *req.Order
+	}
+	if req.Enabled != nil {
+		set["enabled"] = *req.Enabled
+	}
+	if req.Conditions != nil {
+		rule.Conditions = trimKanbanConditions(*req.Conditions)
+		set["conditions"] = rule.Conditions
+	}
+	if req.Action != nil {
+		rule.Action = trimKanbanAction(*req.Action)
+		set["action"] = rule.Action
+	}
+	if !validKanbanRule(c, rule) {
+		return
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "No updates provided",
+		})
+		return
+	}
+
+	updated, err := h.repo.Update(c.Request.Context(), rule.UserID, rule.ID, set)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to update Kanban rule: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteKanbanRule godoc
+// @Summary      Delete a Kanban rule
+// @Tags         kanban
+// @Param        id  path  string  true  "Rule ID"
+// @Success      204
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules/{id} [delete]
+func (h *KanbanRuleHandler) DeleteKanbanRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(c.Request.Context(), rule.UserID, rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to delete Kanban rule: " + err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DryRunKanbanRule godoc
+// @Summary      Dry-run a Kanban rule
+// @Description  Lists which of the user's latest 100 emails the conditions of a stored rule (ruleId) or of unsaved conditions match, without changing anything. Emails that are no longer in the inbox are listed too; on sync the rule would only see new emails.
+// @Tags         kanban
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.KanbanRuleDryRunRequest  true  "Rule to test"
+// @Success      200      {object}  models.KanbanRuleDryRunResult
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /kanban/rules/dry-run [post]
+func (h *KanbanRuleHandler) DryRunKanbanRule(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	var req models.KanbanRuleDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var conditions models.KanbanRuleConditions
+	switch {
+	case req.RuleID != "":
+		rule, err := h.repo.GetByID(ctx, userID, req.RuleID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: "Kanban rule not found",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to load Kanban rule: " + err.Error(),
+			})
+			return
+		}
+		conditions = rule.Conditions
+	case req.Conditions != nil && !req.Conditions.IsEmpty():
+		conditions = trimKanbanConditions(*req.Conditions)
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Pass ruleId or conditions",
+		})
+		return
+	}
+	match, err := conditions.Matcher()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_rule",
+			Message: err.Error(),
+			Fields:  map[string]string{"subjectMatches": err.Error()},
+		})
+		return
+	}
+
+	emails, err := h.emailRepo.ListRecent(ctx, userID, kanbanRuleDryRunEmails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load emails: " + err.Error(),
+		})
+		return
+	}
+	result := models.KanbanRuleDryRunResult{Checked: len(emails), Matched: []models.KanbanRuleMatch{}}
+	for i := range emails {
+		e := &emails[i]
+		if !match(e) {
+			continue
+		}
+		status := e.Status
+		if status == "" {
+			status = models.StatusInbox
+		}
+		result.Matched = append(result.Matched, models.KanbanRuleMatch{
+			EmailID:    e.ID,
+			Subject:    e.Subject,
+			From:       e.From,
+			ReceivedAt: e.ReceivedAt,
+			Status:     status,
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// load returns the caller's Kanban rule of the :id param; other users' rules look missing
+func (h *KanbanRuleHandler) load(c *gin.Context) (*models.KanbanRule, bool) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return nil, false
+	}
+	rule, err := h.repo.GetByID(c.Request.Context(), userID, c.Param("id"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Kanban rule not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load Kanban rule: " + err.Error(),
+		})
+		return nil, false
+	}
+	return rule, true
+}
+
+// validKanbanRule writes a 400 and returns false unless rule has a name, valid conditions
+// and a valid action
+func validKanbanRule(c *gin.Context, rule *models.KanbanRule) bool {
+	fields := map[string]string{}
+	if rule.Name == "" {
+		fields["name"] = "must not be empty"
+	}
+	if rule.Conditions.IsEmpty() {
+		fields["conditions"] = "need at least one of senderContains, domainEquals, subjectMatches, hasAttachment or labelEquals"
+	} else if _, err := rule.Conditions.Matcher(); err != nil {
+		fields["conditions.subjectMatches"] = err.Error()
+	}
+	action := rule.Action
+	if action.IsEmpty() {
+		fields["action"] = "needs setStatus, setPriority, snoozeFor or skipBoard"
+	}
+	if action.SetPriority != "" && !models.ValidPriority(action.SetPriority) {
+		fields["action.setPriority"] = "must be urgent, high, normal or low"
+	}
+	if _, err := action.SnoozeDuration(); err != nil {
+		fields["action.snoozeFor"] = "must be a positive duration such as 4h or 72h"
+	}
+	switch {
+	case action.SetStatus == models.StatusSnoozed:
+		fields["action.setStatus"] = "use snoozeFor to snooze emails"
+	case action.SetStatus != "" && action.SnoozeFor != "":
+		fields["action.setStatus"] = "can't be combined with snoozeFor"
+	}
+	if len(fields) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "invalid_rule",
+		Message: "Invalid Kanban rule",
+		Fields:  fields,
+	})
+	return false
+}
+
+func trimKanbanConditions(cond models.KanbanRuleConditions) models.KanbanRuleConditions {
+	return models.KanbanRuleConditions{
+		SenderContains: strings.TrimSpace(cond.SenderContains),
+		DomainEquals:   strings.ToLower(strings.TrimPrefix(strings.TrimSpace(cond.DomainEquals), "@")),
+		SubjectMatches: strings.TrimSpace(cond.SubjectMatches),
+		HasAttachment:  cond.HasAttachment,
+		LabelEquals:    strings.TrimSpace(cond.LabelEquals),
+	}
+}
+
+func trimKanbanAction(action models.KanbanRuleAction) models.KanbanRuleAction {
+	return models.KanbanRuleAction{
+		SetStatus:   models.EmailStatus(strings.TrimSpace(string(action.SetStatus))),
+		SetPriority: models.EmailPriority(strings.ToLower(strings.TrimSpace(string(action.SetPriority)))),
+		SnoozeFor:   strings.TrimSpace(action.SnoozeFor),
+		SkipBoard:   action.SkipBoard,
+	}
+}
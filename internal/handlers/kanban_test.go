@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveJSON runs handler on a POST with body, as userID when set
+func serveJSON(handler gin.HandlerFunc, userID, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("userID", userID)
+		}
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSummaryDebugText(t *testing.T) {
+	h := &KanbanHandler{}
+	w := serveJSON(h.SummaryDebug, "u1", `{"text":"<p>Budget review on Friday.</p> Send the budget first. Lunch is provided.","top_sentences":1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp SummaryDebugResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sentences) != 3 || resp.TopSentences != 1 || resp.MaxChars != 120 || resp.Summary == "" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	chosen := 0
+	for _, s := range resp.Sentences {
+		if strings.Contains(s.Text, "<") {
+			t.Errorf("sentence %q still has HTML", s.Text)
+		}
+		if s.Chosen {
+			chosen++
+		}
+	}
+	if chosen != 1 {
+		t.Errorf("%d sentences chosen, want 1", chosen)
+	}
+}
+
+func TestSummaryDebugErrors(t *testing.T) {
+	h := &KanbanHandler{}
+	tests := []struct {
+		name     string
+		userID   string
+		body     string
+		wantCode int
+	}{
+		{"unauthenticated", "", `{"text":"Hello there."}`, http.StatusUnauthorized},
+		{"invalid json", "u1", `{`, http.StatusBadRequest},
+		{"neither text nor email", "u1", `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(h.SummaryDebug, tt.userID, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			var resp models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == "" || resp.Message == "" {
+				t.Errorf("body %s is not an ErrorResponse", w.Body)
+			}
+		})
+	}
+}
+
+func TestBulkRejectsOversizedBatch(t *testing.T) {
+	// Rejected before any lookup, so the handler needs no repositories
+	h := NewKanbanHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	ids := make([]string, bulkMaxEmails+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("e%d", i)
+	}
+	body, _ := json.Marshal(BulkRequest{EmailIDs: ids, Action: BulkActionSnooze, Until: "2030-01-01T09:00:00Z"})
+
+	w := serveJSON(h.Bulk, "u1", string(body))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "max 100") {
+		t.Errorf("101 email_ids = %d %s, want 400", w.Code, w.Body)
+	}
+	if w := serveJSON(h.Bulk, "u1", `{"email_ids":[" "],"action":"archive"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("blank email_ids = %d %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestBulkMixedResults(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	configRepo := repository.NewKanbanConfigRepository(db)
+	activityRepo := repository.NewCardActivityRepository(db)
+	h := NewKanbanHandler(emailRepo, nil, configRepo, nil, activityRepo, nil, nil, nil, nil, nil)
+
+	// A column without a Gmail label, so moves stay local, with room for two cards
+	limit := 2
+	if err := configRepo.CreateColumn(ctx, &models.KanbanColumn{UserID: "u1", Key: "waiting", Label: "Waiting", WipLimit: &limit}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*models.Email{
+		{ID: "d1", UserID: "u1", MailboxID: "INBOX", Status: models.StatusDone},
+		{ID: "d2", UserID: "u1", MailboxID: "INBOX", Status: models.StatusDone},
+		{ID: "d3", UserID: "u1", MailboxID: "INBOX", Status: models.StatusDone},
+		{ID: "other", UserID: "u2", MailboxID: "INBOX", Status: models.StatusDone},
+	} {
+		if err := emailRepo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serveJSON(h.Bulk, "u1", `{"email_ids":["d1","other","d2","missing","d3","d1"],"action":"move","to_status":"waiting"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []BulkResult{
+		{EmailID: "d1", OK: true},
+		{EmailID: "other", Error: "email not found"},
+		{EmailID: "d2", OK: true},
+		{EmailID: "missing", Error: "email not found"},
+		{EmailID: "d3", Error: `column "Waiting" is at its WIP limit of 2 cards`},
+	}
+	if resp.Succeeded != 2 || resp.Failed != 3 || !reflect.DeepEqual(resp.Results, want) {
+		t.Errorf("response = %+v, want results %+v", resp, want)
+	}
+	for id, status := range map[string]models.EmailStatus{"d1": "waiting", "d2": "waiting", "d3": models.StatusDone, "other": models.StatusDone} {
+		if e, err := emailRepo.GetEmailByID(ctx, id); err != nil || e.Status != status {
+			t.Errorf("%s status = %v (err %v), want %s", id, e, err, status)
+		}
+	}
+	// Only the cards that moved are logged
+	for id, n := range map[string]int{"d1": 1, "d2": 1, "d3": 0} {
+		if entries, err := activityRepo.List(ctx, "u1", id, 10); err != nil || len(entries) != n {
+			t.Errorf("%s has %d activity entries (err %v), want %d", id, len(entries), err, n)
+		}
+	}
+
+	// A full batch of 100 is accepted; the duplicate doesn't count against the cap
+	ids := []string{"d1"}
+	for i := range bulkMaxEmails - 1 {
+		id := fmt.Sprintf("s%d", i)
+		ids = append(ids, id)
+		if err := emailRepo.CreateEmail(ctx, &models.Email{ID: id, UserID: "u1", MailboxID: "INBOX"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body, _ := json.Marshal(BulkRequest{EmailIDs: append(ids, "d1"), Action: BulkActionSnooze, Until: "2030-01-01T09:00:00Z"})
+	w = serveJSON(h.Bulk, "u1", string(body))
+	resp = BulkResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("snooze of 100 = %d %s", w.Code, w.Body)
+	}
+	if resp.Succeeded != bulkMaxEmails || resp.Failed != 0 {
+		t.Errorf("snooze of 100: %d succeeded, %d failed", resp.Succeeded, resp.Failed)
+	}
+}
+
+func TestMoveAndSnoozeActivity(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	activityRepo := repository.NewCardActivityRepository(db)
+	h := NewKanbanHandler(emailRepo, nil, repository.NewKanbanConfigRepository(db), nil, activityRepo, nil, nil, nil, nil, &config.Config{})
+
+	if err := emailRepo.CreateEmail(ctx, &models.Email{ID: "c1", UserID: "u1", MailboxID: "INBOX"}); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		handler gin.HandlerFunc
+		userID  string
+		body    string
+		code    int
+	}{
+		{h.Move, "u1", `{"email_id":"c1","to_status":"todo"}`, http.StatusOK},
+		{h.Move, "u1", `{"email_id":"c1","to_status":"todo"}`, http.StatusOK}, // already there: not logged
+		{h.Move, "u2", `{"email_id":"c1","to_status":"done"}`, http.StatusNotFound},
+		{h.Snooze, "u1", `{"email_id":"c1","until":"2030-01-02T08:00:00Z","recurrence":"daily"}`, http.StatusOK},
+		{h.Snooze, "u1", `{"email_id":"c1","until":"not a time"}`, http.StatusBadRequest},
+	}
+	for i, s := range steps {
+		if w := serveJSON(s.handler, s.userID, s.body); w.Code != s.code {
+			t.Fatalf("step %d: status = %d, want %d, body %s", i, w.Code, s.code, w.Body)
+		}
+	}
+
+	entries, err := activityRepo.List(ctx, "u1", "c1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want the move and the snooze: %+v", len(entries), entries)
+	}
+	until := time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC)
+	snooze, move := entries[0], entries[1]
+	if snooze.Type != models.CardActivitySnooze || snooze.FromStatus != models.StatusTodo || snooze.ToStatus != models.StatusSnoozed ||
+		snooze.SnoozedUntil == nil || !snooze.SnoozedUntil.Equal(until) || snooze.Detail != "daily" {
+		t.Errorf("snooze entry = %+v", snooze)
+	}
+	if move.Type != models.CardActivityMove || move.FromStatus != models.StatusInbox || move.ToStatus != models.StatusTodo || move.Detail != "" {
+		t.Errorf("move entry = %+v", move)
+	}
+	for _, e := range entries {
+		if e.At.IsZero() {
+			t.Errorf("%s entry has no time", e.Type)
+		}
+	}
+	if other, err := activityRepo.List(ctx, "u2", "c1", 10); err != nil || len(other) != 0 {
+		t.Errorf("u2 has %d entries (err %v), want none", len(other), err)
+	}
+}
+
+func TestBoardFiltersFromQuery(t *testing.T) {
+	parse := func(query string) (*models.SearchFilters, gin.H, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/kanban?"+query, nil)
+		return boardFiltersFromQuery(c)
+	}
+
+	f, active, err := parse("sender=+acme+&label=STARRED&from=2026-10-01&to=2026-10-05&unread=true&hasAttachments=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 6, 0, 0, 0, 0, time.UTC) // a bare to date includes that day
+	if f.Sender != "acme" || f.Label != "STARRED" || f.DateFrom == nil || !f.DateFrom.Equal(from) || f.DateTo == nil || !f.DateTo.Equal(to) ||
+		f.IsRead == nil || *f.IsRead || f.HasAttachment == nil || !*f.HasAttachment {
+		t.Errorf("filters = %+v", f)
+	}
+	wantActive := gin.H{"sender": "acme", "label": "STARRED", "from": "2026-10-01", "to": "2026-10-05", "unreadOnly": true, "hasAttachments": true}
+	if !reflect.DeepEqual(active, wantActive) {
+		t.Errorf("active = %v, want %v", active, wantActive)
+	}
+
+	// RFC 3339 times are used as given
+	f, _, err = parse("from=2026-10-01T08:00:00Z&to=2026-10-01T09:00:00Z")
+	if err != nil || !f.DateTo.Equal(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("RFC 3339 range = %+v, %v", f, err)
+	}
+
+	f, active, err = parse("")
+	if err != nil || f.IsRead != nil || f.HasAttachment != nil || f.DateFrom != nil || len(active) != 0 {
+		t.Errorf("no filters = %+v, %v, %v", f, active, err)
+	}
+
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2026-13-01",
+		"from=2026-10-05&to=2026-10-01",
+		"from=2026-10-01T09:00:00Z&to=2026-10-01T09:00:00Z",
+		"sender=" + strings.Repeat("a", 257),
+	} {
+		if _, _, err := parse(query); err == nil {
+			t.Errorf("%s: accepted", query)
+		}
+	}
+}
+
+func TestGetKanbanCombinedFilters(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	h := NewKanbanHandler(emailRepo, nil, repository.NewKanbanConfigRepository(db), repository.NewCardNoteRepository(db), repository.NewCardActivityRepository(db), nil, nil, nil, nil, &config.Config{})
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC) }
+	acme := models.EmailAddress{Name: "Acme Billing", Email: "billing@acme.com"}
+	for _, e := range []*models.Email{
+		{ID: "match-inbox", From: acme, ReceivedAt: day(2), Labels: []string{"INBOX", "STARRED"}, HasAttachments: true, Priority: models.PriorityHigh},
+		{ID: "match-todo", From: acme, ReceivedAt: day(3), Labels: []string{"STARRED"}, HasAttachments: true, Priority: models.PriorityUrgent, Status: models.StatusTodo},
+		// Each fails exactly one filter
+		{ID: "read", From: acme, ReceivedAt: day(2), Labels: []string{"STARRED"}, HasAttachments: true, IsRead: true, Priority: models.PriorityHigh},
+		{ID: "other-sender", From: models.EmailAddress{Email: "bob@example.com"}, ReceivedAt: day(2), Labels: []string{"STARRED"}, HasAttachments: true, Priority: models.PriorityHigh},
+		{ID: "unstarred", From: acme, ReceivedAt: day(2), Labels: []string{"INBOX"}, HasAttachments: true, Priority: models.PriorityHigh},
+		{ID: "too-old", From: acme, ReceivedAt: day(1).Add(-13 * time.Hour), Labels: []string{"STARRED"}, HasAttachments: true, Priority: models.PriorityHigh},
+		{ID: "too-new", From: acme, ReceivedAt: day(6), Labels: []string{"STARRED"}, HasAttachments: true, Priority: models.PriorityHigh, Status: models.StatusDone},
+		{ID: "no-attachment", From: acme, ReceivedAt: day(2), Labels: []string{"STARRED"}, Priority: models.PriorityHigh},
+		{ID: "low-priority", From: acme, ReceivedAt: day(2), Labels: []string{"STARRED"}, HasAttachments: true, Priority: models.PriorityLow},
+	} {
+		e.UserID, e.MailboxID = "u1", "INBOX"
+		if err := emailRepo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serveGet(h.GetKanban, "u1", "/?sender=ACME&label=STARRED&from=2026-10-01&to=2026-10-05&unreadOnly=true&hasAttachments=true&priority=urgent,high")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Columns map[string][]Card `json:"columns"`
+		Filters map[string]any    `json:"filters"`
+		Counts  map[string]int    `json:"counts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for column, cards := range resp.Columns {
+		for _, card := range cards {
+			found[card.ID] = column
+		}
+		if resp.Counts[column] != len(cards) {
+			t.Errorf("count of %s = %d, listed %d", column, resp.Counts[column], len(cards))
+		}
+	}
+	if want := map[string]string{"match-inbox": "inbox", "match-todo": "todo"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("cards = %v, want %v", found, want)
+	}
+	if len(resp.Filters) != 6 || resp.Filters["sender"] != "ACME" || resp.Filters["unreadOnly"] != true {
+		t.Errorf("filters = %v", resp.Filters)
+	}
+	if resp.Counts["done"] != 0 {
+		t.Errorf("done count = %d with every card filtered out", resp.Counts["done"])
+	}
+
+	// Dropping one filter lets exactly the card it excluded back in
+	w = serveGet(h.GetKanban, "u1", "/?sender=ACME&label=STARRED&from=2026-10-01&to=2026-10-05&hasAttachments=true&priority=urgent,high")
+	resp.Columns = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(resp.Columns["inbox"]) + len(resp.Columns["todo"]); n != 3 {
+		t.Errorf("without unreadOnly: %d cards, want 3", n)
+	}
+}
+
+func TestArchiveDoneRejectsNegativeDays(t *testing.T) {
+	h := NewKanbanHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	if w := serveJSON(h.ArchiveDone, "u1", `{"days":-1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("days -1 = %d %s, want 400", w.Code, w.Body)
+	}
+}
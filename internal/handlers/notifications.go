@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	notificationDefaultLimit = 20
+	notificationMaxLimit     = 100
+)
+
+// NotificationHandler serves the user's in-app notifications
+type NotificationHandler struct {
+	repo *repository.NotificationRepository
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(repo *repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{repo: repo}
+}
+
+// ListNotifications godoc
+// @Summary      List notifications
+// @Description  The user's notifications, newest first, with the unread count. Pass nextCursor as before for the next page.
+// @Tags         notifications
+// @Produce      json
+// @Param        before  query     string  false  "Cursor from the previous page"
+// @Param        limit   query     int     false  "Page size (default 20, max 100)"
+// @Param        unread  query     bool    false  "Only unread notifications"
+// @Success      200  {object}  models.NotificationPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /notifications [get]
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	limit := notificationDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "limit must be a positive number",
+			})
+			return
+		}
+		limit = min(n, notificationMaxLimit)
+	}
+
+	ctx := c.Request.Context()
+	notifications, next, err := h.repo.List(ctx, userID, c.Query("before"), limit, c.Query("unread") == "true")
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_cursor",
+			Message: "Invalid before cursor",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load notifications: " + err.Error(),
+		})
+		return
+	}
+	unread, err := h.repo.CountUnread(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to count notifications: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.NotificationPage{Notifications: notifications, NextCursor: next, UnreadCount: unread})
+}
+
+// MarkNotificationRead godoc
+// @Summary      Mark a notification read
+// @Description  Marking a read notification again keeps its original readAt
+// @Tags         notifications
+// @Produce      json
+// @Param        id   path      string  true  "Notification ID"
+// @Success      200  {object}  models.Notification
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /notifications/{id}/read [post]
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	n, err := h.repo.MarkRead(c.Request.Context(), userID, c.Param("id"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Notification not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to update notification: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, n)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotifications(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	repo := repository.NewNotificationRepository(db)
+	h := NewNotificationHandler(repo)
+
+	var created []*models.Notification
+	for _, id := range []string{"e1", "e2", "e3"} {
+		n := &models.Notification{UserID: "u1", Type: models.NotificationSnoozeReturned, EmailID: id, Subject: "Subject " + id}
+		if err := repo.Create(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		if n.ID.IsZero() || n.CreatedAt.IsZero() {
+			t.Fatalf("Create left ID %v, createdAt %v unset", n.ID, n.CreatedAt)
+		}
+		created = append(created, n)
+	}
+	if err := repo.Create(ctx, &models.Notification{UserID: "u2", Type: models.NotificationSnoozeRecurred, EmailID: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(target string) models.NotificationPage {
+		t.Helper()
+		w := serveGet(h.ListNotifications, "u1", target)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, w.Code, w.Body)
+		}
+		var page models.NotificationPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	emailIDs := func(page models.NotificationPage) []string {
+		var ids []string
+		for _, n := range page.Notifications {
+			ids = append(ids, n.EmailID)
+		}
+		return ids
+	}
+
+	// Newest first, two per page, only u1's
+	first := list("/?limit=2")
+	if got := emailIDs(first); len(got) != 2 || got[0] != "e3" || got[1] != "e2" || first.NextCursor == "" || first.UnreadCount != 3 {
+		t.Fatalf("first page = %v, cursor %q, unread %d", got, first.NextCursor, first.UnreadCount)
+	}
+	second := list("/?limit=2&before=" + first.NextCursor)
+	if got := emailIDs(second); len(got) != 1 || got[0] != "e1" || second.NextCursor != "" {
+		t.Fatalf("second page = %v, cursor %q", got, second.NextCursor)
+	}
+
+	markRead := func(userID, id string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.POST("/notifications/:id/read", func(c *gin.Context) {
+			c.Set("userID", userID)
+			h.MarkNotificationRead(c)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notifications/"+id+"/read", nil))
+		return w
+	}
+	w := markRead("u1", created[1].ID.Hex())
+	var read models.Notification
+	if err := json.Unmarshal(w.Body.Bytes(), &read); err != nil || w.Code != http.StatusOK || read.ReadAt == nil || read.EmailID != "e2" {
+		t.Fatalf("mark read = %d %s", w.Code, w.Body)
+	}
+	// Marking it again keeps the first readAt
+	w = markRead("u1", created[1].ID.Hex())
+	var again models.Notification
+	if err := json.Unmarshal(w.Body.Bytes(), &again); err != nil || w.Code != http.StatusOK || again.ReadAt == nil || !again.ReadAt.Equal(*read.ReadAt) {
+		t.Errorf("second mark read = %d %s, want readAt %v kept", w.Code, w.Body, read.ReadAt)
+	}
+	for _, tt := range []struct{ userID, id string }{{"u2", created[0].ID.Hex()}, {"u1", "not-an-id"}, {"u1", "000000000000000000000000"}} {
+		if w := markRead(tt.userID, tt.id); w.Code != http.StatusNotFound {
+			t.Errorf("mark read of %s as %s = %d, want 404", tt.id, tt.userID, w.Code)
+		}
+	}
+
+	unread := list("/?unread=true")
+	if got := emailIDs(unread); len(got) != 2 || got[0] != "e3" || got[1] != "e1" || unread.UnreadCount != 2 {
+		t.Errorf("unread = %v, count %d; want e3, e1", got, unread.UnreadCount)
+	}
+	if n, err := repo.CountUnread(ctx, "u2"); err != nil || n != 1 {
+		t.Errorf("u2 unread = %d (err %v), want 1", n, err)
+	}
+
+	for _, target := range []string{"/?limit=0", "/?before=bogus"} {
+		if w := serveGet(h.ListNotifications, "u1", target); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, w.Code)
+		}
+	}
+}
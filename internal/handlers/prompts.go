@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PromptTemplateHandler manages summarizer prompt templates. Users manage their own; admins
+// can also edit the default template and, with ?userId=, manage other users' templates.
+type PromptTemplateHandler struct {
+	repo  *repository.PromptTemplateRepository
+	store *services.PromptTemplateStore
+	cfg   *config.Config
+}
+
+// NewPromptTemplateHandler creates a new prompt template handler
+func NewPromptTemplateHandler(repo *repository.PromptTemplateRepository, store *services.PromptTemplateStore, cfg *config.Config) *PromptTemplateHandler {
+	return &PromptTemplateHandler{repo: repo, store: store, cfg: cfg}
+}
+
+// ListTemplates godoc
+// @Summary      List prompt templates
+// @Description  The default summary prompt template followed by the user's own. Placeholders: {{body}}, {{subject}}, {{sender}}, {{language}}, {{length}}. Admins may pass userId.
+// @Tags         settings
+// @Produce      json
+// @Param        userId  query     string  false  "Another user's templates (admin only)"
+// @Success      200     {array}   models.PromptTemplate
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      403     {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts [get]
+func (h *PromptTemplateHandler) ListTemplates(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+	templates, err := h.repo.List(c.Request.Context(), owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load prompt templates: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetTemplate godoc
+// @Summary      Get a prompt template
+// @Tags         settings
+// @Produce      json
+// @Param        id   path      string  true  "Template ID"
+// @Success      200  {object}  models.PromptTemplate
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts/{id} [get]
+func (h *PromptTemplateHandler) GetTemplate(c *gin.Context) {
+	tpl, ok := h.load(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+// CreateTemplate godoc
+// @Summary      Create a prompt template
+// @Description  Creates a summary prompt template; with active=true it replaces the user's active template. The prompt must contain {{body}}.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Param        userId   query     string                              false  "Create for another user (admin only)"
+// @Param        request  body      models.CreatePromptTemplateRequest  true   "Template"
+// @Success      201      {object}  models.PromptTemplate
+// @Failure      400      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts [post]
+func (h *PromptTemplateHandler) CreateTemplate(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+	var req models.CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if !validTemplate(c, req.System, req.Prompt) {
+		return
+	}
+
+	tpl := &models.PromptTemplate{
+		UserID: owner,
+		Name:   strings.TrimSpace(req.Name),
+		System: req.System,
+		Prompt: req.Prompt,
+		Active: req.Active,
+	}
+	if err := h.repo.Create(c.Request.Context(), tpl); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to create prompt template: " + err.Error(),
+		})
+		return
+	}
+	h.store.Invalidate(owner)
+	c.JSON(http.StatusCreated, tpl)
+}
+
+// UpdateTemplate godoc
+// @Summary      Update a prompt template
+// @Description  Updates name, system prompt or prompt. Only admins can edit the default template.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                              true  "Template ID"
+// @Param        request  body      models.UpdatePromptTemplateRequest  true  "Fields to change"
+// @Success      200      {object}  models.PromptTemplate
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts/{id} [put]
+func (h *PromptTemplateHandler) UpdateTemplate(c *gin.Context) {
+	tpl, ok := h.load(c, true)
+	if !ok {
+		return
+	}
+	var req models.UpdatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	set := bson.M{}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: "name must not be empty",
+			})
+			return
+		}
+		set["name"] = strings.TrimSpace(*req.Name)
+	}
+	system, prompt := tpl.System, tpl.Prompt
+	if req.System != nil {
+		system = *req.System
+		set["system"] = system
+	}
+	if req.Prompt != nil {
+		prompt = *req.Prompt
+		set["prompt"] = prompt
+	}
+	if !validTemplate(c, system, prompt) {
+		return
+	}
+
+	updated, err := h.repo.Update(c.Request.Context(), tpl.ID, set)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to update prompt template: " + err.Error(),
+		})
+		return
+	}
+	h.invalidate(tpl)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTemplate godoc
+// @Summary      Delete a prompt template
+// @Description  Deletes a user template; summaries fall back to the default when it was active. The default can't be deleted.
+// @Tags         settings
+// @Param        id  path  string  true  "Template ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts/{id} [delete]
+func (h *PromptTemplateHandler) DeleteTemplate(c *gin.Context) {
+	tpl, ok := h.load(c, true)
+	if !ok {
+		return
+	}
+	if tpl.IsDefault {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "default_template",
+			Message: "The default template can't be deleted",
+		})
+		return
+	}
+	if err := h.repo.Delete(c.Request.Context(), tpl.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to delete prompt template: " + err.Error(),
+		})
+		return
+	}
+	h.invalidate(tpl)
+	c.Status(http.StatusNoContent)
+}
+
+// ActivateTemplate godoc
+// @Summary      Use a prompt template
+// @Description  Makes the template the one the user's summaries are generated with. Activating the default clears the user's active template.
+// @Tags         settings
+// @Produce      json
+// @Param        id      path      string  true   "Template ID"
+// @Param        userId  query     string  false  "Activate for another user (admin only)"
+// @Success      200     {object}  map[string]interface{}
+// @Failure      404     {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/prompts/{id}/activate [post]
+func (h *PromptTemplateHandler) ActivateTemplate(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+	tpl, ok := h.load(c, false)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var err error
+	switch {
+	case tpl.IsDefault:
+		err = h.repo.Deactivate(ctx, owner)
+	case tpl.UserID == owner:
+		err = h.repo.Activate(ctx, owner, tpl.ID)
+	default:
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Prompt template not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to activate prompt template: " + err.Error(),
+		})
+		return
+	}
+	h.store.Invalidate(owner)
+	c.JSON(http.StatusOK, gin.H{"success": true, "activeId": tpl.ID.Hex()})
+}
+
+// owner returns whose templates the request is about: the caller, or ?userId= for admins
+func (h *PromptTemplateHandler) owner(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return "", false
+	}
+	other := c.Query("userId")
+	if other == "" || other == userID.(string) {
+		return userID.(string), true
+	}
+	if !h.cfg.IsAdmin(c.GetString("email")) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "forbidden",
+			Message: "Admin access required",
+		})
+		return "", false
+	}
+	return other, true
+}
+
+// load returns the template of the :id param if the caller may see it, or may change it when
+// write is set. Other users' templates look missing to non-admins.
+func (h *PromptTemplateHandler) load(c *gin.Context, write bool) (*models.PromptTemplate, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return nil, false
+	}
+	admin := h.cfg.IsAdmin(c.GetString("email"))
+
+	tpl, err := h.repo.GetByID(c.Request.Context(), c.Param("id"))
+	if err == nil && !tpl.IsDefault && tpl.UserID != userID.(string) && !admin {
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Prompt template not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load prompt template: " + err.Error(),
+		})
+		return nil, false
+	}
+	if write && tpl.IsDefault && !admin {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "forbidden",
+			Message: "Only admins can change the default template",
+		})
+		return nil, false
+	}
+	return tpl, true
+}
+
+// invalidate drops the cached templates affected by a change to tpl
+func (h *PromptTemplateHandler) invalidate(tpl *models.PromptTemplate) {
+	if tpl.IsDefault {
+		h.store.InvalidateAll()
+		return
+	}
+	h.store.Invalidate(tpl.UserID)
+}
+
+// validTemplate writes a 400 naming the bad placeholders when the template doesn't validate
+func validTemplate(c *gin.Context, system, prompt string) bool {
+	if err := services.ValidatePromptTemplate(system, prompt); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_template",
+			Message: err.Error(),
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PushHandler manages the browser subscriptions Web Push alerts are sent to
+type PushHandler struct {
+	push *services.PushService // nil when no VAPID key pair is configured
+	subs *repository.PushSubscriptionRepository
+}
+
+// NewPushHandler creates a new push handler; push may be nil
+func NewPushHandler(push *services.PushService, subs *repository.PushSubscriptionRepository) *PushHandler {
+	return &PushHandler{push: push, subs: subs}
+}
+
+// GetVAPIDPublicKey godoc
+// @Summary      Get the VAPID public key
+// @Description  The applicationServerKey to pass to PushManager.subscribe()
+// @Tags         push
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /push/vapid-public-key [get]
+func (h *PushHandler) GetVAPIDPublicKey(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": h.push.PublicKey()})
+}
+
+// Subscribe godoc
+// @Summary      Subscribe a browser to push alerts
+// @Description  Stores the PushSubscription of the browser; subscribing an endpoint again replaces its keys
+// @Tags         push
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      models.PushSubscribeRequest  true  "PushSubscription.toJSON()"
+// @Success      201  {object}  models.PushSubscription
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /push/subscribe [post]
+func (h *PushHandler) Subscribe(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	var req models.PushSubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	sub := &models.PushSubscription{
+		UserID:    userID,
+		Endpoint:  req.Endpoint,
+		Keys:      req.Keys,
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := services.ValidateSubscription(sub); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_subscription",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.subs.Upsert(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to save subscription: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+// Unsubscribe godoc
+// @Summary      Unsubscribe a browser from push alerts
+// @Tags         push
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      models.PushUnsubscribeRequest  true  "Endpoint of the subscription"
+// @Success      200  {object}  map[string]bool
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /push/subscribe [delete]
+func (h *PushHandler) Unsubscribe(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	var req models.PushUnsubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	err := h.subs.Delete(c.Request.Context(), userID, req.Endpoint)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Subscription not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to delete subscription: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// enabled writes 503 when push is not configured
+func (h *PushHandler) enabled(c *gin.Context) bool {
+	if h.push == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "push_disabled",
+			Message: "Web Push is not configured on this server",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RuleHandler manages the user's email filing rules
+type RuleHandler struct {
+	repo      *repository.RuleRepository
+	emailRepo *repository.EmailRepository
+	rules     *services.RuleService
+}
+
+// NewRuleHandler creates a new rule handler
+func NewRuleHandler(repo *repository.RuleRepository, emailRepo *repository.EmailRepository, rules *services.RuleService) *RuleHandler {
+	return &RuleHandler{repo: repo, emailRepo: emailRepo, rules: rules}
+}
+
+// ListRules godoc
+// @Summary      List filing rules
+// @Description  The user's rules in evaluation order
+// @Tags         rules
+// @Produce      json
+// @Success      200  {array}   models.Rule
+// @Failure      401  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules [get]
+func (h *RuleHandler) ListRules(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	rules, err := h.repo.List(c.Request.Context(), userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load rules: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetRule godoc
+// @Summary      Get a filing rule
+// @Tags         rules
+// @Produce      json
+// @Param        id   path      string  true  "Rule ID"
+// @Success      200  {object}  models.Rule
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules/{id} [get]
+func (h *RuleHandler) GetRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateRule godoc
+// @Summary      Create a filing rule
+// @Description  Rules run on newly synced emails in order. Every condition that is set (sender, subject, label) must match; the first matching rule with setStatus picks the Kanban column, and addLabel adds a Gmail label. stopOnMatch skips the rules after a match.
+// @Tags         rules
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.CreateRuleRequest  true  "Rule"
+// @Success      201      {object}  models.Rule
+// @Failure      400      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules [post]
+func (h *RuleHandler) CreateRule(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	var req models.CreateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	rule := &models.Rule{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		StopOnMatch: req.StopOnMatch,
+		Conditions:  trimConditions(req.Conditions),
+		Action:      trimAction(req.Action),
+	}
+	if !validRule(c, rule) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.Order != nil {
+		rule.Order = *req.Order
+	} else {
+		next, err := h.repo.NextOrder(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to load rules: " + err.Error(),
+			})
+			return
+		}
+		rule.Order = next
+	}
+	if err := h.repo.Create(ctx, rule); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to create rule: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule godoc
+// @Summary      Update a filing rule
+// @Tags         rules
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                    true  "Rule ID"
+// @Param        request  body      models.UpdateRuleRequest  true  "Fields to change"
+// @Success      200      {object}  models.Rule
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules/{id} [put]
+func (h *RuleHandler) UpdateRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	set := bson.M{}
+	if req.Name != nil {
+		rule.Name = strings.TrimSpace(*req.Name)
+		set["name"] = rule.Name
+	}
+	if req.Order != nil {
+		set["order"] = *req.Order
+	}
+	if req.Enabled != nil {
+		set["enabled"] = *req.Enabled
+	}
+	if req.StopOnMatch != nil {
+		set["stopOnMatch"] = *req.StopOnMatch
+	}
+	if req.Conditions != nil {
+		rule.Conditions = trimConditions(*req.Conditions)
+		set["conditions"] = rule.Conditions
+	}
+	if req.Action != nil {
+		rule.Action = trimAction(*req.Action)
+		set["action"] = rule.Action
+	}
+	if !validRule(c, rule) {
+		return
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "No updates provided",
+		})
+		return
+	}
+
+	updated, err := h.repo.Update(c.Request.Context(), rule.UserID, rule.ID, set)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to update rule: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRule godoc
+// @Summary      Delete a filing rule
+// @Tags         rules
+// @Param        id  path  string  true  "Rule ID"
+// @Success      204
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules/{id} [delete]
+func (h *RuleHandler) DeleteRule(c *gin.Context) {
+	rule, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(c.Request.Context(), rule.UserID, rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to delete rule: " + err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TestRules godoc
+// @Summary      Dry-run filing rules
+// @Description  Reports which enabled rules would match an email and what they would do, without changing anything. Pass emailId for a stored email, or describe a sample email with from, subject and labels.
+// @Tags         rules
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.TestRulesRequest  true  "Email to test"
+// @Success      200      {object}  models.RuleEvaluation
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /rules/test [post]
+func (h *RuleHandler) TestRules(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	var req models.TestRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	email := &models.Email{From: req.From, Subject: req.Subject, Labels: req.Labels}
+	if req.EmailID != "" {
+		stored, err := h.emailRepo.GetByIDs(ctx, []string{req.EmailID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to load email: " + err.Error(),
+			})
+			return
+		}
+		e, found := stored[req.EmailID]
+		if !found || e.UserID != userID {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: "Email not found",
+			})
+			return
+		}
+		email = &e
+	} else if req.From.Email == "" && req.From.Name == "" && req.Subject == "" && len(req.Labels) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Pass emailId or a sample email (from, subject, labels)",
+		})
+		return
+	}
+
+	eval, err := h.rules.Evaluate(ctx, userID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load rules: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, eval)
+}
+
+// ruleUser returns the caller's user ID
+func ruleUser(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return "", false
+	}
+	return userID.(string), true
+}
+
+// load returns the caller's rule of the :id param; other users' rules look missing
+func (h *RuleHandler) load(c *gin.Context) (*models.Rule, bool) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return nil, false
+	}
+	rule, err := h.repo.GetByID(c.Request.Context(), userID, c.Param("id"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "Rule not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load rule: " + err.Error(),
+		})
+		return nil, false
+	}
+	return rule, true
+}
+
+// validRule writes a 400 and returns false unless rule has a name, a condition and an action
+func validRule(c *gin.Context, rule *models.Rule) bool {
+	var msg string
+	switch {
+	case rule.Name == "":
+		msg = "name must not be empty"
+	case rule.Conditions.IsEmpty():
+		msg = "conditions need at least one of sender, subject or label"
+	case rule.Action.IsEmpty():
+		msg = "action needs setStatus or addLabel"
+	case rule.Action.SetStatus == models.StatusSnoozed:
+		// snoozing needs a wake-up time
+		msg = "rules can't snooze emails"
+	default:
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "invalid_rule",
+		Message: msg,
+	})
+	return false
+}
+
+func trimConditions(cond models.RuleConditions) models.RuleConditions {
+	return models.RuleConditions{
+		Sender:  strings.TrimSpace(cond.Sender),
+		Subject: strings.TrimSpace(cond.Subject),
+		Label:   strings.TrimSpace(cond.Label),
+	}
+}
+
+func trimAction(action models.RuleAction) models.RuleAction {
+	return models.RuleAction{
+		SetStatus: models.EmailStatus(strings.TrimSpace(string(action.SetStatus))),
+		AddLabel:  strings.TrimSpace(action.AddLabel),
+	}
+}
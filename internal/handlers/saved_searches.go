@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SavedSearchHandler manages saved searches and runs them through hybrid search
+type SavedSearchHandler struct {
+	repo     *repository.SavedSearchRepository
+	userRepo *repository.UserRepository
+	search   *services.SearchService
+}
+
+// NewSavedSearchHandler creates a new saved search handler
+func NewSavedSearchHandler(repo *repository.SavedSearchRepository, userRepo *repository.UserRepository, search *services.SearchService) *SavedSearchHandler {
+	return &SavedSearchHandler{repo: repo, userRepo: userRepo, search: search}
+}
+
+// ListSavedSearches godoc
+// @Summary List saved searches
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.SavedSearch
+// @Failure 500 {object} models.ErrorResponse
+// @Router /search/saved [get]
+// @Router /saved-searches [get]
+func (h *SavedSearchHandler) ListSavedSearches(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	searches, err := h.repo.List(c.Request.Context(), userID.(string), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load saved searches"})
+		return
+	}
+	c.JSON(http.StatusOK, searches)
+}
+
+// GetSavedSearch godoc
+// @Summary Get a saved search
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Success 200 {object} models.SavedSearch
+// @Failure 404 {object} models.ErrorResponse
+// @Router /search/saved/{id} [get]
+// @Router /saved-searches/{id} [get]
+func (h *SavedSearchHandler) GetSavedSearch(c *gin.Context) {
+	search, ok := h.load(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, search)
+}
+
+// CreateSavedSearch godoc
+// @Summary Save a search
+// @Description Stores a query with filters and a mode (hybrid, keyword, semantic or gmail). An optional action (moveToStatus or addLabel) is applied to newly synced emails whose sender, subject or body contain every query word and that pass the filters; filing rules take precedence for the column.
+// @Tags search
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body models.SavedSearchRequest true "Saved search"
+// @Success 201 {object} models.SavedSearch
+// @Failure 400 {object} models.ErrorResponse
+// @Router /search/saved [post]
+// @Router /saved-searches [post]
+func (h *SavedSearchHandler) CreateSavedSearch(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	search, ok := savedSearchFromRequest(c)
+	if !ok {
+		return
+	}
+	search.UserID = userID.(string)
+	if err := h.repo.Create(c.Request.Context(), search); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save search"})
+		return
+	}
+	c.JSON(http.StatusCreated, search)
+}
+
+// UpdateSavedSearch godoc
+// @Summary Replace a saved search
+// @Tags search
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Param request body models.SavedSearchRequest true "Saved search"
+// @Success 200 {object} models.SavedSearch
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /search/saved/{id} [put]
+// @Router /saved-searches/{id} [put]
+func (h *SavedSearchHandler) UpdateSavedSearch(c *gin.Context) {
+	existing, ok := h.load(c)
+	if !ok {
+		return
+	}
+	search, ok := savedSearchFromRequest(c)
+	if !ok {
+		return
+	}
+	search.ID, search.UserID, search.CreatedAt = existing.ID, existing.UserID, existing.CreatedAt
+	if err := h.repo.Replace(c.Request.Context(), search); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved search"})
+		return
+	}
+	c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearch godoc
+// @Summary Delete a saved search
+// @Tags search
+// @Security ApiKeyAuth
+// @Param id path string true "Saved search ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Router /search/saved/{id} [delete]
+// @Router /saved-searches/{id} [delete]
+func (h *SavedSearchHandler) DeleteSavedSearch(c *gin.Context) {
+	search, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(c.Request.Context(), search.UserID, search.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete saved search"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RunSavedSearch godoc
+// @Summary Run a saved search
+// @Description Runs the saved query and filters through hybrid search, with the retrievers of the saved mode
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Param limit query int false "Max results (default 20, max 50)"
+// @Success 200 {object} models.HybridSearchResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /search/saved/{id}/run [get]
+// @Router /saved-searches/{id}/run [get]
+func (h *SavedSearchHandler) RunSavedSearch(c *gin.Context) {
+	search, ok := h.load(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	sources, _ := models.SavedSearchSources(search.Mode)
+
+	ctx := c.Request.Context()
+	user, err := h.userRepo.FindByID(ctx, search.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	resp, err := h.search.Hybrid(ctx, user, &models.HybridSearchRequest{
+		Query:   search.Query,
+		Limit:   limit,
+		Filters: search.Filters,
+		Sources: sources,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// load returns the caller's saved search of the :id param; other users' look missing
+func (h *SavedSearchHandler) load(c *gin.Context) (*models.SavedSearch, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	search, err := h.repo.GetByID(c.Request.Context(), userID.(string), c.Param("id"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load saved search"})
+		return nil, false
+	}
+	return search, true
+}
+
+// savedSearchFromRequest binds and validates a saved search payload, writing a 400 when it
+// is invalid
+func savedSearchFromRequest(c *gin.Context) (*models.SavedSearch, bool) {
+	var req models.SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	search := &models.SavedSearch{
+		Name:    strings.TrimSpace(req.Name),
+		Query:   strings.TrimSpace(req.Query),
+		Filters: req.Filters,
+		Mode:    strings.ToLower(strings.TrimSpace(req.Mode)),
+		Action:  req.Action,
+	}
+	if search.Mode == "" {
+		search.Mode = models.SavedSearchModeHybrid
+	}
+	if search.Action.IsEmpty() {
+		search.Action = nil
+	}
+
+	problems := search.Filters.Validate()
+	if problems == nil {
+		problems = map[string]string{}
+	}
+	if search.Name == "" {
+		problems["name"] = "must not be empty"
+	}
+	if search.Query == "" {
+		problems["query"] = "must not be empty"
+	}
+	if _, ok := models.SavedSearchSources(search.Mode); !ok {
+		problems["mode"] = "must be hybrid, keyword, semantic or gmail"
+	}
+	if search.Action != nil && search.Action.MoveToStatus == models.StatusSnoozed {
+		problems["action.moveToStatus"] = "can't snooze emails"
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saved search", "fields": problems})
+		return nil, false
+	}
+	return search, true
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"aiemailbox-be/config"
 	"aiemailbox-be/internal/models"
@@ -15,17 +19,23 @@ import (
 
 // SearchHandler handles semantic search and suggestions
 type SearchHandler struct {
-	repo      *repository.EmailRepository
-	embedding services.EmbeddingService
-	cfg       *config.Config
+	repo     *repository.EmailRepository
+	userRepo *repository.UserRepository
+	history  *repository.SearchHistoryRepository
+	search   *services.SearchService
+	indexer  *services.EmbeddingIndexer
+	cfg      *config.Config
 }
 
 // NewSearchHandler creates a new search handler
-func NewSearchHandler(repo *repository.EmailRepository, embedding services.EmbeddingService, cfg *config.Config) *SearchHandler {
+func NewSearchHandler(repo *repository.EmailRepository, userRepo *repository.UserRepository, history *repository.SearchHistoryRepository, search *services.SearchService, indexer *services.EmbeddingIndexer, cfg *config.Config) *SearchHandler {
 	return &SearchHandler{
-		repo:      repo,
-		embedding: embedding,
-		cfg:       cfg,
+		repo:     repo,
+		userRepo: userRepo,
+		history:  history,
+		search:   search,
+		indexer:  indexer,
+		cfg:      cfg,
 	}
 }
 
@@ -35,12 +45,17 @@ func NewSearchHandler(repo *repository.EmailRepository, embedding services.Embed
 type SemanticSearchRequest struct {
 	Query string `json:"query" binding:"required"`
 	Limit int    `json:"limit"`
+	// Minimum cosine similarity (-1 to 1); defaults to SEMANTIC_MIN_SCORE
+	MinScore *float64             `json:"minScore"`
+	Filters  models.SearchFilters `json:"filters"`
 }
 
 // SearchResult represents a single search result with score
 type SearchResult struct {
 	Email *models.Email `json:"email"`
-	Score float32       `json:"score"`
+	Score float32       `json:"score"` // 0-1, (1 + similarity) / 2
+	// Cosine similarity with the query (-1 to 1)
+	Similarity float32 `json:"similarity"`
 }
 
 // SemanticSearchResponse is the response for semantic search
@@ -48,14 +63,34 @@ type SemanticSearchResponse struct {
 	Results []SearchResult `json:"results"`
 	Query   string         `json:"query"`
 	Total   int            `json:"total"`
+	// Embedded emails the query was compared against
+	Searched int64 `json:"searched"`
+	// True when there are no more relevant emails than returned, i.e. fewer than limit
+	// passed the minimum score; with no results, nothing relevant was found
+	Exhausted bool `json:"exhausted"`
 }
 
 // Suggestion represents a single search suggestion
 type Suggestion struct {
 	Text string `json:"text"`
-	Type string `json:"type"` // "sender" | "keyword" | "subject"
+	Type string `json:"type"` // "sender" | "history" | "keyword"
 }
 
+// Suggestion types, in ranking order
+const (
+	SuggestionSender  = "sender"
+	SuggestionHistory = "history"
+	SuggestionKeyword = "keyword"
+)
+
+// Suggestions shown per type and in total
+const (
+	maxSenderSuggestions  = 3
+	maxHistorySuggestions = 2
+	maxKeywordSuggestions = 2
+	maxSuggestions        = 5
+)
+
 // SuggestionsResponse is the response for search suggestions
 type SuggestionsResponse struct {
 	Suggestions []Suggestion `json:"suggestions"`
@@ -66,11 +101,61 @@ type GenerateEmbeddingsRequest struct {
 	Limit int `json:"limit"` // Max emails to process (default 50)
 }
 
+// searchFiltersFromQuery reads search filters from query parameters: dateFrom and dateTo
+// (RFC 3339 or YYYY-MM-DD), sender, label, status, mailboxId, isRead and hasAttachment. It
+// returns the problems per parameter when some don't parse or don't validate.
+func searchFiltersFromQuery(c *gin.Context) (*models.SearchFilters, map[string]string) {
+	f := &models.SearchFilters{
+		Sender:    strings.TrimSpace(c.Query("sender")),
+		Label:     strings.TrimSpace(c.Query("label")),
+		Status:    strings.TrimSpace(c.Query("status")),
+		MailboxID: strings.TrimSpace(c.Query("mailboxId")),
+	}
+	problems := map[string]string{}
+	parseTime := func(name string) *time.Time {
+		raw := strings.TrimSpace(c.Query(name))
+		if raw == "" {
+			return nil
+		}
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return &t
+			}
+		}
+		problems[name] = "must be an RFC 3339 time or YYYY-MM-DD"
+		return nil
+	}
+	parseBool := func(name string) *bool {
+		raw := strings.TrimSpace(c.Query(name))
+		if raw == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			problems[name] = "must be true or false"
+			return nil
+		}
+		return &b
+	}
+	f.DateFrom = parseTime("dateFrom")
+	f.DateTo = parseTime("dateTo")
+	f.IsRead = parseBool("isRead")
+	f.HasAttachment = parseBool("hasAttachment")
+
+	for field, problem := range f.Validate() {
+		problems[field] = problem
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return f, nil
+}
+
 // ========== Handlers ==========
 
 // SemanticSearch godoc
 // @Summary Semantic search for emails
-// @Description Search emails using vector similarity (conceptual relevance)
+// @Description Search emails using vector similarity (conceptual relevance). Uses Atlas Vector Search when ATLAS_VECTOR_SEARCH is on, otherwise scores embedded emails in memory. Results below minScore (default SEMANTIC_MIN_SCORE) are dropped; exhausted tells the UI there are no more relevant emails
 // @Tags search
 // @Security ApiKeyAuth
 // @Accept json
@@ -78,6 +163,7 @@ type GenerateEmbeddingsRequest struct {
 // @Param payload body SemanticSearchRequest true "Search query"
 // @Success 200 {object} SemanticSearchResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /search/semantic [post]
 func (h *SearchHandler) SemanticSearch(c *gin.Context) {
@@ -98,6 +184,11 @@ func (h *SearchHandler) SemanticSearch(c *gin.Context) {
 		return
 	}
 
+	if problems := req.Filters.Validate(); problems != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filters", "fields": problems})
+		return
+	}
+
 	limit := req.Limit
 	if limit <= 0 {
 		limit = 10
@@ -108,63 +199,109 @@ func (h *SearchHandler) SemanticSearch(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	// Generate embedding for query
-	queryEmbedding, err := h.embedding.GenerateEmbedding(ctx, req.Query)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate query embedding: " + err.Error()})
-		return
+	minScore := h.search.MinScore()
+	if req.MinScore != nil {
+		if *req.MinScore < -1 || *req.MinScore > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minScore must be between -1 and 1"})
+			return
+		}
+		minScore = *req.MinScore
 	}
 
-	// Get all emails with embeddings for this user
-	emails, err := h.repo.GetAllWithEmbeddings(ctx, userID.(string))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emails: " + err.Error()})
+	res, err := h.search.Semantic(ctx, userID.(string), req.Query, &req.Filters, limit, minScore)
+	if errors.Is(err, services.ErrEmbeddingDimensionMismatch) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Calculate similarity scores
-	type scoredEmail struct {
-		email *models.Email
-		score float32
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	var scored []scoredEmail
-	for i := range emails {
-		if len(emails[i].Embedding) > 0 {
-			score := services.CosineSimilarity(queryEmbedding, emails[i].Embedding)
-			scored = append(scored, scoredEmail{email: &emails[i], score: score})
+	results := make([]SearchResult, len(res.Hits))
+	for i := range res.Hits {
+		similarity := res.Hits[i].Score
+		results[i] = SearchResult{
+			Email:      &res.Hits[i].Email,
+			Score:      float32((1 + similarity) / 2),
+			Similarity: float32(similarity),
 		}
 	}
 
-	// Sort by score descending
-	sort.Slice(scored, func(i, j int) bool {
-		return scored[i].score > scored[j].score
+	recordSearch(ctx, h.history, userID.(string), req.Query, len(results))
+	c.JSON(http.StatusOK, SemanticSearchResponse{
+		Results:   results,
+		Query:     req.Query,
+		Total:     len(results),
+		Searched:  res.Searched,
+		Exhausted: len(results) < limit,
 	})
+}
 
-	// Take top results
-	if len(scored) > limit {
-		scored = scored[:limit]
+// HybridSearch godoc
+// @Summary Hybrid search
+// @Description Runs keyword (local text index), semantic (embeddings) and Gmail search in parallel and merges them with reciprocal rank fusion into one ranked list. Each result says which retrievers found it. Filters apply to every retriever; retrievers that fail are listed in errors.
+// @Tags search
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param payload body models.HybridSearchRequest true "Query, filters and sources"
+// @Success 200 {object} models.HybridSearchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /search [post]
+func (h *SearchHandler) HybridSearch(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
 
-	// Build response
-	results := make([]SearchResult, len(scored))
-	for i, s := range scored {
-		results[i] = SearchResult{
-			Email: s.email,
-			Score: s.score,
-		}
+	var req models.HybridSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query cannot be empty"})
+		return
+	}
+	if problems := req.Filters.Validate(); problems != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filters", "fields": problems})
+		return
 	}
 
-	c.JSON(http.StatusOK, SemanticSearchResponse{
-		Results: results,
-		Query:   req.Query,
-		Total:   len(results),
-	})
+	ctx := c.Request.Context()
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	resp, err := h.search.Hybrid(ctx, user, &req)
+	if errors.Is(err, services.ErrInvalidSearchSource) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+	recordSearch(ctx, h.history, userID.(string), req.Query, resp.Total)
+	c.JSON(http.StatusOK, resp)
+}
+
+// recordSearch adds a search to the user's history; failures only cost the history entry
+func recordSearch(ctx context.Context, history *repository.SearchHistoryRepository, userID, query string, resultCount int) {
+	if err := history.Record(ctx, userID, query, resultCount); err != nil {
+		log.Println("failed to record search history:", err)
+	}
 }
 
 // GetSuggestions godoc
 // @Summary Get search suggestions
-// @Description Get auto-complete suggestions based on senders and keywords
+// @Description Get auto-complete suggestions: matching senders first, then the user's recent searches, then subject keywords
 // @Tags search
 // @Security ApiKeyAuth
 // @Produce json
@@ -187,41 +324,107 @@ func (h *SearchHandler) GetSuggestions(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	var suggestions []Suggestion
-
-	// Get sender suggestions (limit 3)
-	senders, err := h.repo.GetUniqueSenders(ctx, userID.(string), query, 3)
-	if err == nil {
-		for _, s := range senders {
-			suggestions = append(suggestions, Suggestion{Text: s, Type: "sender"})
+	// Each source is best effort: a failing one just contributes nothing
+	senders, _ := h.repo.GetUniqueSenders(ctx, userID.(string), query, maxSenderSuggestions)
+	var history []string
+	if entries, err := h.history.Recent(ctx, userID.(string), query, maxHistorySuggestions); err == nil {
+		for _, e := range entries {
+			history = append(history, e.Query)
 		}
 	}
+	keywords, _ := h.repo.GetSubjectKeywords(ctx, userID.(string), query, maxKeywordSuggestions)
+
+	c.JSON(http.StatusOK, SuggestionsResponse{Suggestions: rankSuggestions(senders, history, keywords)})
+}
 
-	// Get keyword suggestions (limit 2)
-	keywords, err := h.repo.GetSubjectKeywords(ctx, userID.(string), query, 2)
-	if err == nil {
-		for _, k := range keywords {
-			suggestions = append(suggestions, Suggestion{Text: k, Type: "keyword"})
+// rankSuggestions lists senders, then recent searches, then keywords, each capped at its
+// per-type maximum and maxSuggestions in total. A text already suggested (ignoring case) is
+// not repeated under a lower-ranked type.
+func rankSuggestions(senders, history, keywords []string) []Suggestion {
+	suggestions := []Suggestion{}
+	seen := map[string]bool{}
+	add := func(texts []string, kind string, max int) {
+		added := 0
+		for _, text := range texts {
+			key := models.NormalizeSearchQuery(text)
+			if added == max || len(suggestions) == maxSuggestions {
+				return
+			}
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			suggestions = append(suggestions, Suggestion{Text: text, Type: kind})
+			added++
 		}
 	}
+	add(senders, SuggestionSender, maxSenderSuggestions)
+	add(history, SuggestionHistory, maxHistorySuggestions)
+	add(keywords, SuggestionKeyword, maxKeywordSuggestions)
+	return suggestions
+}
+
+// GetSearchHistory godoc
+// @Summary Recent searches
+// @Description The user's most recent distinct searches (up to 100), newest first
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Param limit query int false "Max entries (default 20, max 100)"
+// @Success 200 {object} map[string][]models.SearchHistoryEntry
+// @Failure 500 {object} models.ErrorResponse
+// @Router /search/history [get]
+func (h *SearchHandler) GetSearchHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > repository.SearchHistoryLimit {
+		limit = 20
+	}
 
-	// Limit total to 5
-	if len(suggestions) > 5 {
-		suggestions = suggestions[:5]
+	entries, err := h.history.Recent(c.Request.Context(), userID.(string), "", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load search history"})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"history": entries})
+}
 
-	c.JSON(http.StatusOK, SuggestionsResponse{Suggestions: suggestions})
+// ClearSearchHistory godoc
+// @Summary Clear recent searches
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Failure 500 {object} models.ErrorResponse
+// @Router /search/history [delete]
+func (h *SearchHandler) ClearSearchHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	deleted, err := h.history.Clear(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear search history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
 }
 
 // GenerateEmbeddings godoc
 // @Summary Generate embeddings for emails
-// @Description Batch generate embeddings for emails that don't have them yet
+// @Description Embed emails that don't have an embedding yet right away. The background indexer does the same continuously; this forces a run for the current user.
 // @Tags search
 // @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param payload body GenerateEmbeddingsRequest true "Request"
 // @Success 200 {object} map[string]int
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /search/generate-embeddings [post]
 func (h *SearchHandler) GenerateEmbeddings(c *gin.Context) {
@@ -245,45 +448,59 @@ func (h *SearchHandler) GenerateEmbeddings(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	// Get emails without embeddings
-	emails, err := h.repo.GetEmailsWithoutEmbedding(ctx, userID.(string), req.Limit)
+	res, err := h.indexer.IndexUser(ctx, userID.(string), req.Limit)
+	if err != nil && res.Processed == 0 {
+		var capErr *services.UsageCapError
+		switch {
+		case errors.As(err, &capErr):
+			c.JSON(http.StatusPaymentRequired, capErr.Response())
+		case services.IsRateLimited(err):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Embedding provider rate limit reached, try again later"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate embeddings: " + err.Error()})
+		}
+		return
+	}
+
+	status, err := h.indexer.Status(ctx, userID.(string))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emails: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count emails: " + err.Error()})
 		return
 	}
 
-	if len(emails) == 0 {
+	if res.Processed == 0 && res.Failed == 0 && status.Pending == 0 {
 		c.JSON(http.StatusOK, gin.H{"processed": 0, "message": "All emails already have embeddings"})
 		return
 	}
 
-	// Generate embeddings for each email
-	processed := 0
-	failed := 0
-	for _, email := range emails {
-		// Combine subject and body for embedding
-		text := email.Subject + " " + email.Body
-		if text == "" {
-			text = email.Preview
-		}
-
-		embedding, err := h.embedding.GenerateEmbedding(ctx, text)
-		if err != nil {
-			failed++
-			continue
-		}
-
-		if err := h.repo.SetEmbedding(ctx, email.ID, embedding); err != nil {
-			failed++
-			continue
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"processed": res.Processed,
+		"failed":    res.Failed,
+		"skipped":   res.Skipped,
+		"remaining": status.Pending,
+	})
+}
 
-		processed++
+// IndexStatus godoc
+// @Summary Semantic search indexing progress
+// @Description How many of the user's emails have an embedding (indexed) and how many are waiting for the background indexer (pending)
+// @Tags search
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.EmbeddingIndexStatus
+// @Failure 500 {object} models.ErrorResponse
+// @Router /search/index-status [get]
+func (h *SearchHandler) IndexStatus(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"processed": processed,
-		"failed":    failed,
-		"remaining": len(emails) - processed - failed,
-	})
+	status, err := h.indexer.Status(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load index status: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
 }
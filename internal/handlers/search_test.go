@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankSuggestions(t *testing.T) {
+	s := func(text, kind string) Suggestion { return Suggestion{Text: text, Type: kind} }
+	tests := []struct {
+		name                       string
+		senders, history, keywords []string
+		want                       []Suggestion
+	}{
+		{"senders, then history, then keywords",
+			[]string{"Ann Lee"}, []string{"annual report"}, []string{"Announcement"},
+			[]Suggestion{s("Ann Lee", SuggestionSender), s("annual report", SuggestionHistory), s("Announcement", SuggestionKeyword)}},
+		{"each type is capped",
+			[]string{"a1", "a2", "a3", "a4"}, []string{"h1", "h2", "h3"}, nil,
+			[]Suggestion{s("a1", SuggestionSender), s("a2", SuggestionSender), s("a3", SuggestionSender), s("h1", SuggestionHistory), s("h2", SuggestionHistory)}},
+		{"five in total, keywords are dropped first",
+			[]string{"a1", "a2", "a3"}, []string{"h1", "h2"}, []string{"k1"},
+			[]Suggestion{s("a1", SuggestionSender), s("a2", SuggestionSender), s("a3", SuggestionSender), s("h1", SuggestionHistory), s("h2", SuggestionHistory)}},
+		{"a repeat keeps its highest-ranked type and frees the slot",
+			[]string{"Invoice"}, []string{"INVOICE", " invoice  march ", "invoices"}, []string{"invoice march", "Invoicing"},
+			[]Suggestion{s("Invoice", SuggestionSender), s(" invoice  march ", SuggestionHistory), s("invoices", SuggestionHistory), s("Invoicing", SuggestionKeyword)}},
+		{"blanks are skipped", []string{"", "  "}, nil, []string{"k1"}, []Suggestion{s("k1", SuggestionKeyword)}},
+		{"nothing", nil, nil, nil, []Suggestion{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankSuggestions(tt.senders, tt.history, tt.keywords); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankSuggestions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSuggestionsRanking(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emailRepo := repository.NewEmailRepository(db)
+	history := repository.NewSearchHistoryRepository(db)
+	h := NewSearchHandler(emailRepo, nil, history, nil, nil, nil)
+
+	for _, e := range []*models.Email{
+		{ID: "m1", UserID: "u1", MailboxID: "INBOX", Subject: "Quarterly budget", From: models.EmailAddress{Name: "Budget Bot", Email: "bot@acme.com"}},
+		{ID: "m2", UserID: "u2", MailboxID: "INBOX", Subject: "Budgeting tips", From: models.EmailAddress{Name: "Budget Coach", Email: "coach@x.com"}},
+	} {
+		if err := emailRepo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Re-running a search makes it the most recent; other users' history is not suggested
+	for _, r := range []struct{ user, query string }{
+		{"u1", "budget 2023"}, {"u1", "team budget"}, {"u1", "lunch"}, {"u1", "Budget 2023"}, {"u2", "budget secret"},
+	} {
+		if err := history.Record(ctx, r.user, r.query, 1); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct searchedAt at Mongo's millisecond precision
+	}
+
+	w := serveGet(h.GetSuggestions, "u1", "/?q=bud")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp SuggestionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []Suggestion{
+		{Text: "Budget Bot", Type: SuggestionSender},
+		{Text: "Budget 2023", Type: SuggestionHistory},
+		{Text: "team budget", Type: SuggestionHistory},
+		{Text: "budget", Type: SuggestionKeyword},
+	}
+	if !reflect.DeepEqual(resp.Suggestions, want) {
+		t.Errorf("suggestions = %v, want %v", resp.Suggestions, want)
+	}
+
+	w = serveGet(h.GetSuggestions, "u1", "/?q=+")
+	if w.Code != http.StatusOK || w.Body.String() != `{"suggestions":[]}` {
+		t.Errorf("blank query = %d %s", w.Code, w.Body)
+	}
+	if w := serveGet(h.GetSuggestions, "", "/?q=bud"); w.Code != http.StatusUnauthorized {
+		t.Errorf("status without a user = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityHandler exposes the phishing/spam risk of emails
+type SecurityHandler struct {
+	emailRepo *repository.EmailRepository
+	security  *services.SecurityAnalysisService
+}
+
+// NewSecurityHandler creates a new security handler
+func NewSecurityHandler(emailRepo *repository.EmailRepository, security *services.SecurityAnalysisService) *SecurityHandler {
+	return &SecurityHandler{
+		emailRepo: emailRepo,
+		security:  security,
+	}
+}
+
+// GetSecurity godoc
+// @Summary      Get the phishing/spam risk of an email
+// @Description  Returns the stored risk score (0-100), level and reasons. Emails synced before scoring existed, or refresh=true, are analyzed on the spot.
+// @Tags         emails
+// @Produce      json
+// @Param        emailId   path      string  true   "Email ID"
+// @Param        refresh   query     bool    false  "Re-run the analysis"
+// @Success      200  {object}  models.SecurityAnalysis
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /emails/{emailId}/security [get]
+func (h *SecurityHandler) GetSecurity(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	email, err := h.emailRepo.GetByID(ctx, c.Param("emailId"))
+	if err != nil || email.UserID != userID.(string) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "email_not_found",
+			Message: "Email not found",
+		})
+		return
+	}
+
+	if email.Security != nil && c.Query("refresh") != "true" {
+		c.JSON(http.StatusOK, email.Security)
+		return
+	}
+
+	known, err := h.emailRepo.FrequentSenderDomains(ctx, email.UserID, h.security.FrequentSenderLimit())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load known senders: " + err.Error(),
+		})
+		return
+	}
+	analysis := h.security.Analyze(ctx, email, known)
+	if err := h.emailRepo.SetSecurity(ctx, email.ID, analysis); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to save security analysis: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
@@ -4,16 +4,18 @@ import (
 	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/repository"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type StatisticsHandler struct {
-	repo *repository.StatisticsRepository
+	repo        *repository.StatisticsRepository
+	summaryJobs *repository.SummaryJobRepository // nil when auto-summarize is disabled
 }
 
-func NewStatisticsHandler(repo *repository.StatisticsRepository) *StatisticsHandler {
-	return &StatisticsHandler{repo: repo}
+func NewStatisticsHandler(repo *repository.StatisticsRepository, summaryJobs *repository.SummaryJobRepository) *StatisticsHandler {
+	return &StatisticsHandler{repo: repo, summaryJobs: summaryJobs}
 }
 
 // GetStatistics godoc
@@ -22,7 +24,10 @@ func NewStatisticsHandler(repo *repository.StatisticsRepository) *StatisticsHand
 // @Tags statistics
 // @Security ApiKeyAuth
 // @Param period query string false "Time period: 7d, 30d, 90d" default(30d)
+// @Param timezone query string false "IANA time zone for the snooze buckets, e.g. Asia/Ho_Chi_Minh" default(UTC)
+// @Param includeArchived query bool false "Count cards archived off the board in the status distribution"
 // @Success 200 {object} models.StatisticsResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /statistics [get]
@@ -46,16 +51,34 @@ func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
 		period = "30d"
 	}
 
+	// Days of the snooze wake-up buckets are in this IANA zone
+	loc := time.UTC
+	if tz := c.Query("timezone"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone " + tz})
+			return
+		}
+		loc = l
+	}
+
 	ctx := c.Request.Context()
 	userIDStr := userID.(string)
 
 	// Get status stats
-	statusStats, err := h.repo.GetEmailsByStatus(ctx, userIDStr)
+	statusStats, err := h.repo.GetEmailsByStatus(ctx, userIDStr, c.Query("includeArchived") == "true")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get status stats: " + err.Error()})
 		return
 	}
 
+	// Get category stats
+	categoryStats, err := h.repo.GetEmailsByCategory(ctx, userIDStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get category stats: " + err.Error()})
+		return
+	}
+
 	// Get email trend
 	emailTrend, err := h.repo.GetEmailTrend(ctx, userIDStr, days)
 	if err != nil {
@@ -70,6 +93,13 @@ func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
 		return
 	}
 
+	// Get top sender domains (limit 10)
+	topDomains, err := h.repo.GetTopDomains(ctx, userIDStr, 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get top domains: " + err.Error()})
+		return
+	}
+
 	// Get daily activity
 	dailyActivity, err := h.repo.GetDailyActivity(ctx, userIDStr, days)
 	if err != nil {
@@ -84,16 +114,52 @@ func (h *StatisticsHandler) GetStatistics(c *gin.Context) {
 		return
 	}
 
+	// Get time to first reply
+	responseTimes, err := h.repo.GetResponseTimes(ctx, userIDStr, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get response times: " + err.Error()})
+		return
+	}
+
+	// Get snoozed backlog
+	snooze, err := h.repo.GetSnoozeStats(ctx, userIDStr, loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get snooze stats: " + err.Error()})
+		return
+	}
+
+	// Get AI summary coverage
+	summaryCoverage, err := h.repo.GetSummaryCoverage(ctx, userIDStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get summary coverage: " + err.Error()})
+		return
+	}
+
 	// Build response
 	response := models.StatisticsResponse{
-		StatusStats:   statusStats,
-		EmailTrend:    emailTrend,
-		TopSenders:    topSenders,
-		DailyActivity: dailyActivity,
-		TotalEmails:   total,
-		UnreadCount:   unread,
-		StarredCount:  starred,
-		Period:        period,
+		StatusStats:     statusStats,
+		CategoryStats:   categoryStats,
+		EmailTrend:      emailTrend,
+		TopSenders:      topSenders,
+		TopDomains:      topDomains,
+		DailyActivity:   dailyActivity,
+		TotalEmails:     total,
+		UnreadCount:     unread,
+		StarredCount:    starred,
+		Period:          period,
+		ResponseTimes:   responseTimes,
+		Snooze:          snooze,
+		SummaryCoverage: summaryCoverage,
+	}
+
+	// Auto-summarize queue depth and processed counts
+	if h.summaryJobs != nil {
+		queueStats, err := h.summaryJobs.GetStats(ctx, userIDStr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get summary queue stats: " + err.Error()})
+			return
+		}
+		response.SummaryQueue = &queueStats
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/services"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SyncResponse reports what a mailbox sync changed locally
+type SyncResponse struct {
+	Mode      string `json:"mode"` // "incremental" or "full"
+	Upserted  int    `json:"upserted"`
+	Deleted   int64  `json:"deleted"`
+	HistoryID uint64 `json:"historyId"`
+}
+
+// SyncMailbox godoc
+// @Summary      Sync mailbox changes from Gmail
+// @Description  Fetches only messages added, relabeled or deleted since the last sync (Gmail history). Falls back to a full sync of recent messages on first use or when the stored history ID has expired.
+// @Tags         emails
+// @Produce      json
+// @Success      200  {object}  handlers.SyncResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /sync [post]
+func (h *EmailHandler) SyncMailbox(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.FindByID(ctx, userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User not found",
+		})
+		return
+	}
+
+	resp, err := h.syncUser(ctx, user)
+	if err != nil {
+		var serr *syncError
+		if errors.As(err, &serr) {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   serr.code,
+				Message: serr.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "sync_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// syncError tags a sync failure with the API error code it maps to
+type syncError struct {
+	code string
+	msg  string
+	err  error
+}
+
+func (e *syncError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *syncError) Unwrap() error { return e.err }
+
+// syncUser applies Gmail changes since the user's stored history ID to the local store,
+// falling back to a full sync on first use or when the history has expired. Shared by the
+// manual sync endpoint and Gmail push notifications.
+func (h *EmailHandler) syncUser(ctx context.Context, user *models.User) (*SyncResponse, error) {
+	mode := "incremental"
+	var changes *services.MailboxChanges
+	var err error
+	if user.GmailHistoryID != 0 {
+		changes, err = h.gmailService.SyncHistory(ctx, user, user.GmailHistoryID)
+	}
+	if user.GmailHistoryID == 0 || errors.Is(err, services.ErrHistoryExpired) {
+		mode = "full"
+		changes, err = h.gmailService.FullSync(ctx, user)
+	}
+	if err != nil {
+		return nil, &syncError{"gmail_error", "Failed to sync mailbox", err}
+	}
+
+	userIDStr := user.ID.Hex()
+	if err := h.syncer.Store(ctx, userIDStr, changes.Upserted); err != nil {
+		return nil, &syncError{"database_error", "Failed to store synced emails", err}
+	}
+	deleted, err := h.emailRepo.DeleteByIDs(ctx, userIDStr, changes.DeletedIDs)
+	if err != nil {
+		return nil, &syncError{"database_error", "Failed to remove deleted emails", err}
+	}
+
+	// Only advance the history ID once local state reflects the changes
+	if err := h.userRepo.UpdateHistoryID(ctx, userIDStr, changes.HistoryID); err != nil {
+		return nil, &syncError{"database_error", "Failed to save sync state", err}
+	}
+	h.gmailService.InvalidateUserCache(userIDStr)
+
+	return &SyncResponse{
+		Mode:      mode,
+		Upserted:  len(changes.Upserted),
+		Deleted:   deleted,
+		HistoryID: changes.HistoryID,
+	}, nil
+}
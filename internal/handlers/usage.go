@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageHandler reports LLM token usage
+type UsageHandler struct {
+	meter *services.UsageMeter
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(meter *services.UsageMeter) *UsageHandler {
+	return &UsageHandler{meter: meter}
+}
+
+// GetUsage godoc
+// @Summary      Get AI token usage
+// @Description  Token usage and estimated cost of the current user's LLM and embedding calls this month (UTC), by operation
+// @Tags         usage
+// @Produce      json
+// @Success      200  {object}  models.LLMUsageSummary
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /usage [get]
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	summary, err := h.meter.Summary(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "database_error",
+			Message: "Failed to load usage: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WebhookHandler manages the user's outbound webhook and shows its delivery log
+type WebhookHandler struct {
+	webhooks   *services.WebhookService // nil when WEBHOOKS_ENABLED is off
+	hooks      *repository.WebhookRepository
+	deliveries *repository.WebhookDeliveryRepository
+}
+
+// NewWebhookHandler creates a new webhook handler; webhooks may be nil
+func NewWebhookHandler(webhooks *services.WebhookService, hooks *repository.WebhookRepository, deliveries *repository.WebhookDeliveryRepository) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks, hooks: hooks, deliveries: deliveries}
+}
+
+// GetWebhook godoc
+// @Summary      Get the outbound webhook
+// @Description  The secret is not included; rotate it to get a new one
+// @Tags         webhooks
+// @Produce      json
+// @Success      200  {object}  models.Webhook
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook [get]
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	hook, err := h.hooks.Get(c.Request.Context(), userID)
+	if err != nil {
+		writeWebhookError(c, "Failed to load webhook", err)
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// SaveWebhook godoc
+// @Summary      Create or update the outbound webhook
+// @Description  Board events (email.moved, email.summarized, email.unsnoozed) are POSTed to the URL, signed with
+// @Description  X-Webhook-Signature: sha256=hex(HMAC-SHA256(secret, X-Webhook-Timestamp + "." + body)).
+// @Description  The secret is returned once, when the webhook is created.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      models.WebhookRequest  true  "URL and events"
+// @Success      200  {object}  models.WebhookResponse
+// @Success      201  {object}  models.WebhookResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook [put]
+func (h *WebhookHandler) SaveWebhook(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.webhooks.ValidateURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_url",
+			Message: err.Error(),
+		})
+		return
+	}
+	for _, e := range req.Events {
+		if !models.ValidWebhookEvent(e) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_event",
+				Message: "Unknown webhook event: " + string(e),
+			})
+			return
+		}
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to generate secret: " + err.Error(),
+		})
+		return
+	}
+	hook, created, err := h.hooks.Save(c.Request.Context(), userID, req.URL, req.Events, enabled, secret)
+	if err != nil {
+		writeWebhookError(c, "Failed to save webhook", err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, models.WebhookResponse{Webhook: hook})
+		return
+	}
+	c.JSON(http.StatusCreated, models.WebhookResponse{Webhook: hook, Secret: hook.Secret})
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete the outbound webhook
+// @Description  Queued deliveries are cancelled
+// @Tags         webhooks
+// @Produce      json
+// @Success      200  {object}  map[string]bool
+// @Failure      404  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.hooks.Delete(ctx, userID); err != nil {
+		writeWebhookError(c, "Failed to delete webhook", err)
+		return
+	}
+	if err := h.deliveries.CancelPending(ctx, userID, "webhook was removed"); err != nil {
+		writeWebhookError(c, "Failed to cancel deliveries", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RotateSecret godoc
+// @Summary      Rotate the webhook secret
+// @Description  Deliveries are signed with the new secret from now on, retries of older events included
+// @Tags         webhooks
+// @Produce      json
+// @Success      200  {object}  models.WebhookResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook/secret [post]
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to generate secret: " + err.Error(),
+		})
+		return
+	}
+	hook, err := h.hooks.RotateSecret(c.Request.Context(), userID, secret)
+	if err != nil {
+		writeWebhookError(c, "Failed to rotate secret", err)
+		return
+	}
+	c.JSON(http.StatusOK, models.WebhookResponse{Webhook: hook, Secret: hook.Secret})
+}
+
+// TestWebhook godoc
+// @Summary      Send a test event
+// @Description  Queues a webhook.ping delivery, even when the webhook is disabled; check the delivery log for the result
+// @Tags         webhooks
+// @Produce      json
+// @Success      202  {object}  models.WebhookDelivery
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook/test [post]
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	d, err := h.webhooks.Ping(c.Request.Context(), userID)
+	if err != nil {
+		writeWebhookError(c, "Failed to queue test event", err)
+		return
+	}
+	c.JSON(http.StatusAccepted, d)
+}
+
+// ListDeliveries godoc
+// @Summary      List recent webhook deliveries
+// @Description  Newest first; deliveries are kept for 30 days
+// @Tags         webhooks
+// @Produce      json
+// @Param        limit  query     int  false  "Max deliveries (default 50, max 200)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      503  {object}  models.ErrorResponse
+// @Security     ApiKeyAuth
+// @Router       /settings/webhook/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	userID, ok := ruleUser(c)
+	if !ok || !h.enabled(c) {
+		return
+	}
+	limit := 50
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		limit = min(n, 200)
+	}
+	deliveries, err := h.deliveries.List(c.Request.Context(), userID, limit)
+	if err != nil {
+		writeWebhookError(c, "Failed to list deliveries", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// enabled writes 503 when outbound webhooks are off
+func (h *WebhookHandler) enabled(c *gin.Context) bool {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "webhooks_disabled",
+			Message: "Outbound webhooks are not enabled on this server",
+		})
+		return false
+	}
+	return true
+}
+
+// writeWebhookError writes 404 when the user has no webhook, 500 otherwise
+func writeWebhookError(c *gin.Context, message string, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "No webhook configured",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "database_error",
+		Message: message + ": " + err.Error(),
+	})
+}
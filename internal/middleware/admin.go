@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin allows the request only when the authenticated user's email is listed in
+// cfg.AdminEmails. Must run after AuthMiddleware.
+func RequireAdmin(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.IsAdmin(c.GetString("email")) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "forbidden",
+			Message: "Admin access required",
+		})
+	}
+}
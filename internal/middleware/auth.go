@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/utils"
 	"net/http"
 	"strings"
@@ -9,35 +9,38 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware validates the "Authorization: Bearer <token>" header and only accepts
+// access tokens signed with keys. On success it sets "userID" and "email" in the gin context.
+func AuthMiddleware(keys *utils.JWTKeys) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			abortUnauthorized(c, "missing_token", "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		parts := strings.Fields(authHeader)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			abortUnauthorized(c, "invalid_auth_header", "Invalid authorization header format")
 			return
 		}
 
 		tokenString := parts[1]
-		claims, err := utils.ValidateToken(tokenString, cfg.JWTSecret)
+		claims, err := utils.ValidateToken(tokenString, keys)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			abortUnauthorized(c, "invalid_token", "Invalid or expired token")
 			return
 		}
 
-		// Check if it's an access token
+		// Refresh tokens must never be accepted as bearer credentials
 		if claims.TokenType != "access" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type"})
-			c.Abort()
+			abortUnauthorized(c, "invalid_token_type", "Invalid token type")
+			return
+		}
+
+		if claims.UserID == "" {
+			abortUnauthorized(c, "invalid_token", "Token has no subject")
 			return
 		}
 
@@ -47,3 +50,10 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func abortUnauthorized(c *gin.Context, code, message string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error:   code,
+		Message: message,
+	})
+}
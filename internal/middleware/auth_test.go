@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := utils.NewHS256Keys("test-secret")
+	otherKeys := utils.NewHS256Keys("other-secret")
+
+	token := func(t *testing.T, gen func(string, string, *utils.JWTKeys, time.Duration) (string, error), userID string, k *utils.JWTKeys, exp time.Duration) string {
+		t.Helper()
+		s, err := gen(userID, "user@example.com", k, exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		header    func(t *testing.T) string
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:      "missing header",
+			header:    func(t *testing.T) string { return "" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: "missing_token",
+		},
+		{
+			name:      "basic scheme",
+			header:    func(t *testing.T) string { return "Basic dXNlcjpwYXNz" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_auth_header",
+		},
+		{
+			name:      "bearer without token",
+			header:    func(t *testing.T) string { return "Bearer" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_auth_header",
+		},
+		{
+			name: "extra parts",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateAccessToken, "u1", keys, time.Minute) + " extra"
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_auth_header",
+		},
+		{
+			name:      "garbage token",
+			header:    func(t *testing.T) string { return "Bearer not.a.jwt" },
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_token",
+		},
+		{
+			name: "expired token",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateAccessToken, "u1", keys, -time.Minute)
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_token",
+		},
+		{
+			name: "signed with another key",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateAccessToken, "u1", otherKeys, time.Minute)
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_token",
+		},
+		{
+			name: "refresh token as bearer",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateRefreshToken, "u1", keys, time.Minute)
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_token_type",
+		},
+		{
+			name: "no subject",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateAccessToken, "", keys, time.Minute)
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_token",
+		},
+		{
+			name: "valid access token",
+			header: func(t *testing.T) string {
+				return "Bearer " + token(t, utils.GenerateAccessToken, "u1", keys, time.Minute)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "lowercase scheme",
+			header: func(t *testing.T) string {
+				return "bearer " + token(t, utils.GenerateAccessToken, "u1", keys, time.Minute)
+			},
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", AuthMiddleware(keys), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"userID": c.GetString("userID"), "email": c.GetString("email")})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if h := tt.header(t); h != "" {
+				req.Header.Set("Authorization", h)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode == http.StatusOK {
+				var got map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if got["userID"] != "u1" || got["email"] != "user@example.com" {
+					t.Errorf("context = %v, want userID u1 and email user@example.com", got)
+				}
+				return
+			}
+			var resp models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body is not an ErrorResponse: %s", w.Body)
+			}
+			if resp.Error != tt.wantError || resp.Message == "" {
+				t.Errorf("error = %+v, want code %q with a message", resp, tt.wantError)
+			}
+		})
+	}
+}
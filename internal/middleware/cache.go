@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"aiemailbox-be/config"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControl sets Cache-Control per request. Public, unauthenticated GETs
+// may be cached for cfg.PublicCacheMaxAge so the PWA service worker can use them; anything
+// carrying an Authorization header is user-specific and must never be stored by a shared
+// proxy or served stale after a mutation.
+func CacheControl(cfg *config.Config) gin.HandlerFunc {
+	publicValue := "no-cache, no-store, must-revalidate"
+	if seconds := int(cfg.PublicCacheMaxAge.Seconds()); seconds > 0 {
+		publicValue = fmt.Sprintf("public, max-age=%d, must-revalidate", seconds)
+	}
+
+	return func(c *gin.Context) {
+		switch {
+		case c.GetHeader("Authorization") != "":
+			c.Writer.Header().Set("Cache-Control", "private, no-store")
+		case c.Request.Method == http.MethodGet:
+			c.Writer.Header().Set("Cache-Control", publicValue)
+		default:
+			// Don't cache non-GET requests
+			c.Writer.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		}
+		c.Next()
+	}
+}
@@ -2,27 +2,23 @@ package middleware
 
 import (
 	"aiemailbox-be/config"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 func CORS(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", cfg.FrontendURL)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-		
-		// PWA Caching Support: Allow service workers to cache responses
-		// Set appropriate cache control headers for GET requests
-		if c.Request.Method == "GET" {
-			// Cache GET requests for 5 minutes (300 seconds)
-			// Service Worker will use NetworkFirst strategy
-			c.Writer.Header().Set("Cache-Control", "public, max-age=300, must-revalidate")
-		} else {
-			// Don't cache non-GET requests
-			c.Writer.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		// Only reflect the Origin back when it is on the allowlist
+		origin := c.GetHeader("Origin")
+		if origin != "" && originAllowed(origin, cfg.AllowedOrigins) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		}
+		c.Writer.Header().Add("Vary", "Origin")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -32,3 +28,28 @@ func CORS(cfg *config.Config) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// originAllowed reports whether origin matches one of the allowed entries. An entry of "*"
+// matches everything; an entry like "https://*.example.com" matches any subdomain of
+// example.com over the same scheme (but not example.com itself).
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	for _, a := range allowed {
+		a = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(a)), "/")
+		if a == "*" || a == origin {
+			return true
+		}
+		// wildcard subdomain: scheme://*.domain
+		if i := strings.Index(a, "://*."); i != -1 {
+			scheme := a[:i+3]
+			suffix := a[i+4:] // ".domain"
+			if strings.HasPrefix(origin, scheme) {
+				host := origin[len(scheme):]
+				if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"aiemailbox-be/internal/models"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery turns a panic in any handler into a JSON 500. The panic value and stack are only
+// logged (with the request ID), never sent to the client.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("panic recovered: request_id=%s %s %s: %v\n%s",
+					c.GetString("requestID"), c.Request.Method, c.Request.URL.Path, rec, debug.Stack())
+
+				if c.Writer.Written() {
+					// Headers are already out; all we can do is stop the chain
+					c.Abort()
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+					Error:   "internal_error",
+					Message: "An unexpected error occurred",
+				})
+			}
+		}()
+		c.Next()
+	}
+}
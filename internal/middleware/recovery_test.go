@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"aiemailbox-be/internal/models"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	r := gin.New()
+	r.Use(RequestID(), Recovery())
+	r.GET("/panic", func(c *gin.Context) {
+		panic("secret connection string")
+	})
+	r.GET("/panic-after-write", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("too late")
+	})
+	r.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(RequestIDHeader, "req-123")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/panic")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %s is not JSON: %v", w.Body, err)
+	}
+	if resp.Error != "internal_error" || resp.Message != "An unexpected error occurred" || len(resp.Fields) != 0 {
+		t.Errorf("body = %+v", resp)
+	}
+	if strings.Contains(w.Body.String(), "secret") || strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("body leaks the panic: %s", w.Body)
+	}
+	if out := logs.String(); !strings.Contains(out, "request_id=req-123") || !strings.Contains(out, "secret connection string") ||
+		!strings.Contains(out, "recovery_test.go") {
+		t.Errorf("log = %q, want the request ID, panic value and stack", out)
+	}
+
+	// A panic after the response started can't change it, but the server keeps serving
+	if w := serve("/panic-after-write"); w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("panic after write = %d %q, want the partial 200", w.Code, w.Body)
+	}
+	if w := serve("/ok"); w.Code != http.StatusOK {
+		t.Errorf("status after recovered panics = %d, want 200", w.Code)
+	}
+}
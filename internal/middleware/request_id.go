@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID to and from clients and proxies
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses the caller's X-Request-ID (or generates one), stores it in the gin
+// context as "requestID" and echoes it in the response so logs can be correlated.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Set("requestID", id)
+		c.Writer.Header().Set(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
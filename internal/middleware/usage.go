@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageScope attributes the LLM and embedding calls made while handling the request to the
+// authenticated user. Must run after AuthMiddleware.
+func UsageScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.GetString("userID"); userID != "" {
+			c.Request = c.Request.WithContext(services.WithUsageUser(c.Request.Context(), userID))
+		}
+		c.Next()
+	}
+}
+
+// RequireTokenBudget answers 402 with the user's monthly usage once their token cap is used
+// up. Must run after AuthMiddleware.
+func RequireTokenBudget(meter *services.UsageMeter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := meter.Check(c.Request.Context(), c.GetString("userID"))
+		var capErr *services.UsageCapError
+		if errors.As(err, &capErr) {
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, capErr.Response())
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "database_error",
+				Message: "Failed to check AI usage: " + err.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,8 @@
+package models
+
+// ActionItem is a concrete ask extracted from an email
+type ActionItem struct {
+	Title    string `json:"title" bson:"title"`
+	DueDate  string `json:"dueDate,omitempty" bson:"dueDate,omitempty"` // YYYY-MM-DD
+	Assignee string `json:"assignee,omitempty" bson:"assignee,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CardNoteMaxLength caps the text of a card note, in characters
+const CardNoteMaxLength = 2000
+
+// CardNote is a user's annotation on a Kanban card, e.g. "waiting on legal"
+type CardNote struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"-" bson:"userId"`
+	EmailID   string             `json:"emailId" bson:"emailId"`
+	Text      string             `json:"text" bson:"text"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CardNoteRequest is the payload for creating or editing a card note
+type CardNoteRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// CardActivityType is what happened to a card
+type CardActivityType string
+
+const (
+	CardActivityMove        CardActivityType = "move"
+	CardActivitySnooze      CardActivityType = "snooze"
+	CardActivitySummary     CardActivityType = "summary"
+	CardActivityNoteAdded   CardActivityType = "note_added"
+	CardActivityNoteEdited  CardActivityType = "note_edited"
+	CardActivityNoteDeleted CardActivityType = "note_deleted"
+)
+
+// CardActivity is one entry of a card's append-only activity log
+type CardActivity struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID  string             `json:"-" bson:"userId"`
+	EmailID string             `json:"emailId" bson:"emailId"`
+	Type    CardActivityType   `json:"type" bson:"type"`
+	// Columns of a move (undo included) or the column a snoozed card left
+	FromStatus EmailStatus `json:"fromStatus,omitempty" bson:"fromStatus,omitempty"`
+	ToStatus   EmailStatus `json:"toStatus,omitempty" bson:"toStatus,omitempty"`
+	// When a snoozed card is due back
+	SnoozedUntil *time.Time `json:"snoozedUntil,omitempty" bson:"snoozedUntil,omitempty"`
+	// Note the entry is about (note_added, note_edited, note_deleted)
+	NoteID string `json:"noteId,omitempty" bson:"noteId,omitempty"`
+	// move: "undo", "bulk" or "thread" when not a single drag; summary: the options used
+	Detail string    `json:"detail,omitempty" bson:"detail,omitempty"`
+	At     time.Time `json:"at" bson:"at"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// Draft is a Gmail draft with the message fields a compose window needs
+type Draft struct {
+	ID        string         `json:"id"`        // Gmail draft ID
+	MessageID string         `json:"messageId"` // ID of the draft's current message
+	ThreadID  string         `json:"threadId,omitempty"`
+	To        []EmailAddress `json:"to"`
+	Cc        []EmailAddress `json:"cc,omitempty"`
+	Bcc       []EmailAddress `json:"bcc,omitempty"`
+	Subject   string         `json:"subject"`
+	Preview   string         `json:"preview"`
+	Body      string         `json:"body,omitempty"` // only when the draft is loaded in full
+	// Attachments are only listed when the draft is loaded in full
+	HasAttachments bool          `json:"hasAttachments"`
+	Attachments    []*Attachment `json:"attachments,omitempty"`
+	UpdatedAt      time.Time     `json:"updatedAt"`
+	// The draft's message as an email, for the local copy; set when loaded in full
+	Email *Email `json:"-"`
+}
+
+// DraftRequest creates or replaces a draft. The fields match POST /api/emails/send.
+type DraftRequest struct {
+	To      []string `json:"to"`
+	Cc      []string `json:"cc,omitempty"`
+	Bcc     []string `json:"bcc,omitempty"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"` // HTML
+	// Gmail ID of the message being replied to; the draft is threaded under it. Updates
+	// without it (or ThreadID) keep the draft's current thread.
+	InReplyTo string `json:"inReplyTo,omitempty"`
+	// Gmail thread to reply in, to the thread's latest message; InReplyTo wins when both are set
+	ThreadID string `json:"threadId,omitempty"`
+	// Replace the draft's attachments. Omitted on update, the current ones are kept; an
+	// empty list removes them.
+	Attachments []DraftAttachment `json:"attachments,omitempty"`
+}
+
+// DraftAttachment is a file attached to a draft
+type DraftAttachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"` // base64 in JSON
+}
+
+// DraftAutosaveMaxBytes caps the body of a locally autosaved draft
+const DraftAutosaveMaxBytes = 1 << 20
+
+// DraftAutosave is compose-in-progress saved locally every few seconds, keyed by an ID the
+// client generates, so autosave doesn't create Gmail drafts. Saving it to Gmail records the
+// Gmail draft, which later saves update.
+type DraftAutosave struct {
+	ID        string   `json:"id" bson:"clientId"`
+	UserID    string   `json:"-" bson:"userId"`
+	To        []string `json:"to" bson:"to"`
+	Cc        []string `json:"cc,omitempty" bson:"cc,omitempty"`
+	Bcc       []string `json:"bcc,omitempty" bson:"bcc,omitempty"`
+	Subject   string   `json:"subject" bson:"subject"`
+	Body      string   `json:"body" bson:"body"`
+	InReplyTo string   `json:"inReplyTo,omitempty" bson:"inReplyTo,omitempty"`
+	ThreadID  string   `json:"threadId,omitempty" bson:"threadId,omitempty"`
+	// Set once the draft was saved to Gmail
+	GmailDraftID string    `json:"gmailDraftId,omitempty" bson:"gmailDraftId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// DraftAutosaveRequest replaces the content of a local draft
+type DraftAutosaveRequest struct {
+	To        []string `json:"to"`
+	Cc        []string `json:"cc,omitempty"`
+	Bcc       []string `json:"bcc,omitempty"`
+	Subject   string   `json:"subject"`
+	Body      string   `json:"body"`
+	InReplyTo string   `json:"inReplyTo,omitempty"`
+	ThreadID  string   `json:"threadId,omitempty"`
+}
+
+// DraftRequest is the Gmail draft a local draft is saved as; attachments are left as they are
+func (d *DraftAutosave) DraftRequest() *DraftRequest {
+	return &DraftRequest{
+		To:        d.To,
+		Cc:        d.Cc,
+		Bcc:       d.Bcc,
+		Subject:   d.Subject,
+		Body:      d.Body,
+		InReplyTo: d.InReplyTo,
+		ThreadID:  d.ThreadID,
+	}
+}
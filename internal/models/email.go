@@ -15,6 +15,44 @@ const (
 	StatusSnoozed    EmailStatus = "snoozed"
 )
 
+// EmailPriority is the urgency assigned to an email on sync
+type EmailPriority string
+
+const (
+	PriorityUrgent EmailPriority = "urgent"
+	PriorityHigh   EmailPriority = "high"
+	PriorityNormal EmailPriority = "normal"
+	PriorityLow    EmailPriority = "low"
+)
+
+// ValidPriority reports whether p is a known priority
+func ValidPriority(p EmailPriority) bool {
+	switch p {
+	case PriorityUrgent, PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// EmailCategory is the kind of mail, assigned on sync
+type EmailCategory string
+
+const (
+	CategoryNewsletter   EmailCategory = "newsletter"
+	CategoryBilling      EmailCategory = "billing"
+	CategoryPersonal     EmailCategory = "personal"
+	CategoryNotification EmailCategory = "notification"
+)
+
+// ValidCategory reports whether c is a known category
+func ValidCategory(c EmailCategory) bool {
+	switch c {
+	case CategoryNewsletter, CategoryBilling, CategoryPersonal, CategoryNotification:
+		return true
+	}
+	return false
+}
+
 type Mailbox struct {
 	ID          string `json:"id" bson:"id"`
 	UserID      string `json:"userId" bson:"userId"`
@@ -37,6 +75,8 @@ type Email struct {
 	Subject   string         `json:"subject" bson:"subject"`
 	Preview   string         `json:"preview" bson:"preview"`
 	Body      string         `json:"body" bson:"body"`
+	// Reply-To header addresses, if any
+	ReplyTo []EmailAddress `json:"replyTo,omitempty" bson:"replyTo,omitempty"`
 	// Workflow fields for Kanban
 	Status         EmailStatus   `json:"status" bson:"status"`
 	SnoozedUntil   *time.Time    `json:"snoozedUntil,omitempty" bson:"snoozedUntil,omitempty"`
@@ -49,8 +89,100 @@ type Email struct {
 	Labels         []string      `json:"labels,omitempty" bson:"labels,omitempty"`
 	ReceivedAt     time.Time     `json:"receivedAt" bson:"receivedAt"`
 	CreatedAt      time.Time     `json:"createdAt" bson:"createdAt"`
+	// Images the HTML body shows inline (cid: URLs); see services.ResolveInlineImages
+	InlineImages []InlineImage `json:"inlineImages,omitempty" bson:"inlineImages,omitempty"`
+	// Last time the email changed column (moves, snoozes, wake-ups); nil if it never did
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty" bson:"statusChangedAt,omitempty"`
+	// Options the summary was generated with ("en"/"vi", "short"/"medium"/"detailed")
+	SummaryLanguage string `json:"summaryLanguage,omitempty" bson:"summaryLanguage,omitempty"`
+	SummaryLength   string `json:"summaryLength,omitempty" bson:"summaryLength,omitempty"`
+	// Concrete asks extracted from the email (POST /api/emails/:emailId/action-items)
+	ActionItems []ActionItem `json:"actionItems,omitempty" bson:"actionItems,omitempty"`
+	// Assigned on first sync by the classification service; empty for legacy emails (normal)
+	Priority EmailPriority `json:"priority,omitempty" bson:"priority,omitempty"`
+	// newsletter | billing | personal | notification; empty for emails synced before categories
+	Category EmailCategory `json:"category,omitempty" bson:"category,omitempty"`
+	// List-Unsubscribe header as fetched from Gmail; only used for categorization, not stored
+	ListUnsubscribe string `json:"-" bson:"-"`
+	// Phishing/spam risk, assessed on first sync (GET /api/emails/:emailId/security)
+	Security *SecurityAnalysis `json:"security,omitempty" bson:"security,omitempty"`
+	// Kanban rule that placed the email when it was first synced, for debugging
+	KanbanRuleID string `json:"kanbanRuleId,omitempty" bson:"kanbanRuleId,omitempty"`
+	// Kept off the board by a Kanban rule; still listed in mailboxes and search
+	SkipBoard bool `json:"skipBoard,omitempty" bson:"skipBoard,omitempty"`
+	// The message of a Gmail draft (DRAFT label). DraftID is only known for drafts saved
+	// through /api/drafts; they stay off the board unless a column maps to DRAFT.
+	IsDraft bool   `json:"isDraft,omitempty" bson:"isDraft,omitempty"`
+	DraftID string `json:"draftId,omitempty" bson:"draftId,omitempty"`
+	// Gmail conversation state: messages in the thread, and whether any message newer than
+	// this one is unread. Set when a thread is mapped and stored by
+	// GET /api/kanban?threadInfo=true; zero until then.
+	ThreadMessageCount int  `json:"threadMessageCount,omitempty" bson:"threadMessageCount,omitempty"`
+	ThreadUnread       bool `json:"threadUnread,omitempty" bson:"threadUnread,omitempty"`
+	// Preset the card was snoozed with, if any
+	SnoozePreset SnoozePreset `json:"snoozePreset,omitempty" bson:"snoozePreset,omitempty"`
+	// Set for repeating snoozes; cleared when the card is moved
+	SnoozeRecurrence SnoozeRecurrence `json:"snoozeRecurrence,omitempty" bson:"snoozeRecurrence,omitempty"`
+	// Set when the card is archived off the board (POST /api/kanban/archive-done or a column's
+	// auto-archive); it stays in mailboxes and search, and moving or restoring it clears this
+	ArchivedAt *time.Time `json:"archivedAt,omitempty" bson:"archivedAt,omitempty"`
+	// Soft delete: set when the email is trashed in Gmail or removed from the board
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Retention: refreshed on every upsert/read, used by the stale-email cleanup
+	LastAccessedAt time.Time `json:"-" bson:"lastAccessedAt,omitempty"`
 	// Week 4: Vector embedding for semantic search
 	Embedding []float32 `json:"-" bson:"embedding,omitempty"`
+	// Long emails are embedded in overlapping windows; Embedding then holds chunk 0. Empty for
+	// emails that fit one window and for emails embedded before chunking.
+	EmbeddingChunks []EmbeddingChunk `json:"-" bson:"embeddingChunks,omitempty"`
+	// Length of the stored vectors; 0 on emails embedded before it was recorded (use
+	// len(Embedding))
+	EmbeddingDim int `json:"-" bson:"embeddingDim,omitempty"`
+	// SHA-256 of the embedded text and the embedding model; the indexer skips re-embedding an
+	// email whose hash still matches
+	EmbeddingHash string `json:"-" bson:"embeddingHash,omitempty"`
+	// Set by a Gmail re-sync that changed the subject or body so the indexer checks it again
+	EmbeddingStale bool `json:"-" bson:"embeddingStale,omitempty"`
+	// Subject lower-cased without accents (utils.NormalizeSearchText) and its word trigrams,
+	// written on every upsert for typo-tolerant search
+	SubjectNormalized string   `json:"-" bson:"subjectNormalized,omitempty"`
+	SubjectGrams      []string `json:"-" bson:"subjectGrams,omitempty"`
+	// The same for the summary, written whenever it is stored
+	SummaryNormalized string   `json:"-" bson:"summaryNormalized,omitempty"`
+	SummaryGrams      []string `json:"-" bson:"summaryGrams,omitempty"`
+}
+
+// EmbeddingChunk is the embedding of one window of an email's text
+type EmbeddingChunk struct {
+	ChunkIndex int       `bson:"chunkIndex"`
+	TextOffset int       `bson:"textOffset"` // in runes, into the embedded text
+	Embedding  []float32 `bson:"embedding"`
+}
+
+// Risk levels derived from SecurityAnalysis.RiskScore
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// SecurityAnalysis is the phishing/spam risk of an email: a 0-100 score and why
+type SecurityAnalysis struct {
+	RiskScore  int       `json:"riskScore" bson:"riskScore"`
+	RiskLevel  string    `json:"riskLevel" bson:"riskLevel"`
+	Reasons    []string  `json:"reasons" bson:"reasons"`
+	LLMChecked bool      `json:"llmChecked" bson:"llmChecked"`
+	AnalyzedAt time.Time `json:"analyzedAt" bson:"analyzedAt"`
+}
+
+// HasLabel reports whether the email carries the given Gmail label
+func (e *Email) HasLabel(label string) bool {
+	for _, l := range e.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
 }
 
 type EmailAddress struct {
@@ -67,14 +199,72 @@ type Attachment struct {
 	Data     []byte `json:"-" bson:"-"` // For sending attachments (not stored)
 }
 
+// InlineImage maps the Content-ID an HTML body references as cid:... to the attachment
+// holding the image. A list rather than a map: Content-IDs contain dots, which Mongo field
+// names can't.
+type InlineImage struct {
+	ContentID    string `json:"contentId" bson:"contentId"` // without the angle brackets
+	AttachmentID string `json:"attachmentId" bson:"attachmentId"`
+	MimeType     string `json:"mimeType,omitempty" bson:"mimeType,omitempty"`
+}
+
 type EmailListResponse struct {
 	Emails      []*Email `json:"emails"`
 	Total       int      `json:"total"`
 	Page        int      `json:"page"`
 	PerPage     int      `json:"perPage"`
 	HasNextPage bool     `json:"hasNextPage"`
+	// Set when Total is Gmail's resultSizeEstimate (filtered listings); show it as
+	// "about N", never as an exact count
+	TotalIsEstimate bool `json:"totalIsEstimate"`
 }
 
 type MailboxesResponse struct {
 	Mailboxes []Mailbox `json:"mailboxes"`
 }
+
+// EmailThread is a conversation shown as one Kanban card (GET /api/kanban?groupBy=thread)
+type EmailThread struct {
+	// Most recently received message of the thread on the board
+	Latest Email
+	// Board messages of the thread, oldest first
+	EmailIDs       []string
+	UnreadCount    int
+	HasAttachments bool
+	// Column of the message moved most recently, or of Latest when none was ever moved
+	Status       EmailStatus
+	SnoozedUntil *time.Time
+}
+
+// ModifyBatchRequest is the payload of POST /api/emails/modify-batch. Either EmailIDs or
+// MailboxID selects the emails; MailboxID takes the newest ones in that mailbox.
+type ModifyBatchRequest struct {
+	EmailIDs     []string `json:"emailIds"`
+	MailboxID    string   `json:"mailboxId"`
+	AddLabels    []string `json:"addLabels"`
+	RemoveLabels []string `json:"removeLabels"`
+}
+
+// ModifyBatchChunk is the outcome of one Gmail batchModify call (up to 1000 emails)
+type ModifyBatchChunk struct {
+	EmailIDs []string `json:"emailIds"`
+	OK       bool     `json:"ok"`
+	Error    string   `json:"error,omitempty"`
+	// Set when Gmail was updated but some cached copies were not
+	LocalError string `json:"localError,omitempty"`
+}
+
+// ModifyBatchResponse reports every chunk so partial failures are visible
+type ModifyBatchResponse struct {
+	Chunks    []ModifyBatchChunk `json:"chunks"`
+	Succeeded int                `json:"succeeded"` // emails Gmail modified
+	Failed    int                `json:"failed"`
+	// Set when the mailbox held more emails than one request modifies; send it again
+	HasMore bool `json:"hasMore,omitempty"`
+}
+
+// ScoredEmail is a search hit with its relevance score
+type ScoredEmail struct {
+	Email `bson:",inline"`
+	Score float64 `json:"score" bson:"score"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmbeddingIndexStatus is a user's semantic search indexing progress. Counts are refreshed
+// when the status is read; the run fields are kept by the background indexer.
+type EmbeddingIndexStatus struct {
+	UserID  string `json:"-" bson:"_id"`
+	Total   int64  `json:"total" bson:"total"`     // visible emails
+	Indexed int64  `json:"indexed" bson:"indexed"` // emails with an embedding
+	Pending int64  `json:"pending" bson:"pending"` // emails waiting for one
+	// Emails with no text to embed
+	Skipped int64 `json:"skipped" bson:"skipped"`
+
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty" bson:"lastRunAt,omitempty"`
+	LastIndexedAt *time.Time `json:"lastIndexedAt,omitempty" bson:"lastIndexedAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	UpdatedAt     time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
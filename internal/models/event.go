@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CalendarEvent is a meeting found in an email, from its ICS invitation or extracted by
+// the LLM
+type CalendarEvent struct {
+	UID         string         `json:"uid,omitempty"`
+	Title       string         `json:"title"`
+	Start       time.Time      `json:"start"`
+	End         time.Time      `json:"end"`
+	AllDay      bool           `json:"allDay"`
+	TimeZone    string         `json:"timeZone"`
+	Location    string         `json:"location,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Organizer   *EmailAddress  `json:"organizer,omitempty"`
+	Attendees   []EmailAddress `json:"attendees"`
+}
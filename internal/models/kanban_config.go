@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // KanbanColumn represents a custom Kanban column for a user
 type KanbanColumn struct {
 	ID         string `json:"id" bson:"_id,omitempty"`
@@ -10,6 +12,30 @@ type KanbanColumn struct {
 	GmailLabel string `json:"gmailLabel" bson:"gmailLabel"` // mapped Gmail label (e.g., "STARRED", "IMPORTANT")
 	Color      string `json:"color,omitempty" bson:"color,omitempty"`
 	IsDefault  bool   `json:"isDefault" bson:"isDefault"` // true for system columns
+	// Most cards the column may hold; nil means no limit
+	WipLimit *int `json:"wipLimit,omitempty" bson:"wipLimit,omitempty"`
+	// Cards that have been in the column this many days are archived by the auto-archive
+	// worker; nil means never
+	AutoArchiveDays *int `json:"autoArchiveDays,omitempty" bson:"autoArchiveDays,omitempty"`
+}
+
+// DefaultArchiveDays is how long cards stay in done before POST /api/kanban/archive-done
+// archives them when no days are given
+const DefaultArchiveDays = 14
+
+// ArchiveCutoff is the time before which cards entered their column to be archived after days
+func ArchiveCutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// UncategorizedColumnKey is the synthetic board column holding cards whose status matches
+// none of the user's columns (e.g. left behind by an older release); no column may use it
+const UncategorizedColumnKey = "uncategorized"
+
+// KanbanColumnWithCount is a column plus its current number of cards
+type KanbanColumnWithCount struct {
+	KanbanColumn
+	Count int `json:"count"`
 }
 
 // KanbanConfig represents the complete Kanban configuration for a user
@@ -23,6 +49,13 @@ type CreateColumnRequest struct {
 	Label      string `json:"label" binding:"required"`
 	GmailLabel string `json:"gmailLabel"`
 	Color      string `json:"color"`
+	// Create a Gmail label named gmailLabel (or label) and map the column to it; an existing
+	// label with that name is reused
+	CreateGmailLabel bool `json:"createGmailLabel"`
+	// Work-in-progress limit; omit for none
+	WipLimit *int `json:"wipLimit"`
+	// Archive cards after this many days in the column; omit for never
+	AutoArchiveDays *int `json:"autoArchiveDays"`
 }
 
 // UpdateColumnRequest is the request payload for updating a column
@@ -31,6 +64,13 @@ type UpdateColumnRequest struct {
 	GmailLabel string `json:"gmailLabel"`
 	Color      string `json:"color"`
 	Order      *int   `json:"order"`
+	// New work-in-progress limit; 0 removes it
+	WipLimit *int `json:"wipLimit"`
+	// New auto-archive age in days; 0 turns auto-archive off
+	AutoArchiveDays *int `json:"autoArchiveDays"`
+	// New key (lowercase letters, digits and underscores); the column's cards move with it.
+	// Default columns keep their keys.
+	Key string `json:"key"`
 }
 
 // ReorderColumnsRequest is the request for reordering columns
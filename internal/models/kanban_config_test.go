@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveCutoff(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		days int
+		want time.Time
+	}{
+		{0, now},
+		{1, time.Date(2026, 10, 15, 15, 30, 0, 0, time.UTC)},
+		{DefaultArchiveDays, time.Date(2026, 10, 2, 15, 30, 0, 0, time.UTC)},
+		{30, time.Date(2026, 9, 16, 15, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := ArchiveCutoff(now, tt.days); !got.Equal(tt.want) {
+			t.Errorf("ArchiveCutoff(%d days) = %v, want %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+// Days are calendar days: across a DST change the cutoff keeps the local time of day
+func TestArchiveCutoffAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available:", err)
+	}
+	// Clocks went back on 2026-10-25
+	now := time.Date(2026, 10, 30, 9, 0, 0, 0, loc)
+	got := ArchiveCutoff(now, 7)
+	if want := time.Date(2026, 10, 23, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("cutoff = %v, want %v", got, want)
+	}
+	if d := now.Sub(got); d != 7*24*time.Hour+time.Hour {
+		t.Errorf("cutoff is %v before now, want 7 days and the extra DST hour", d)
+	}
+}
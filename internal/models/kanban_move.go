@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KanbanMove records where a card was before a move, so the move can be undone
+type KanbanMove struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID  string             `json:"-" bson:"userId"`
+	EmailID string             `json:"emailId" bson:"emailId"`
+	// Column before the move and, for snoozed cards, when they were due back
+	FromStatus       EmailStatus `json:"fromStatus" bson:"fromStatus"`
+	FromSnoozedUntil *time.Time  `json:"fromSnoozedUntil,omitempty" bson:"fromSnoozedUntil,omitempty"`
+	ToStatus         EmailStatus `json:"toStatus" bson:"toStatus"`
+	MovedAt          time.Time   `json:"movedAt" bson:"movedAt"`
+	// The move can't be undone after this; Mongo deletes it shortly after
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
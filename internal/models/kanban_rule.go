@@ -0,0 +1,166 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KanbanRule places newly synced emails on the board, e.g. "everything from jira@ goes
+// straight to To Do". A user's enabled rules are evaluated in Order on emails that would
+// start in the inbox; the first matching rule wins.
+type KanbanRule struct {
+	ID         primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	UserID     string               `json:"userId" bson:"userId"`
+	Name       string               `json:"name" bson:"name"`
+	Order      int                  `json:"order" bson:"order"`
+	Enabled    bool                 `json:"enabled" bson:"enabled"`
+	Conditions KanbanRuleConditions `json:"conditions" bson:"conditions"`
+	Action     KanbanRuleAction     `json:"action" bson:"action"`
+	CreatedAt  time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// KanbanRuleConditions select the emails a Kanban rule applies to; every condition that is
+// set must match
+type KanbanRuleConditions struct {
+	// Case-insensitive substring of the sender's address or name, e.g. "jira@"
+	SenderContains string `json:"senderContains,omitempty" bson:"senderContains,omitempty"`
+	// Host part of the sender's address, case-insensitive, e.g. "atlassian.net"
+	DomainEquals string `json:"domainEquals,omitempty" bson:"domainEquals,omitempty"`
+	// Case-insensitive regular expression (RE2 syntax) the subject must match
+	SubjectMatches string `json:"subjectMatches,omitempty" bson:"subjectMatches,omitempty"`
+	HasAttachment  *bool  `json:"hasAttachment,omitempty" bson:"hasAttachment,omitempty"`
+	// Gmail label ID the email carries, e.g. CATEGORY_UPDATES or Label_123
+	LabelEquals string `json:"labelEquals,omitempty" bson:"labelEquals,omitempty"`
+}
+
+// IsEmpty reports whether no condition is set
+func (c KanbanRuleConditions) IsEmpty() bool {
+	return strings.TrimSpace(c.SenderContains) == "" && strings.TrimSpace(c.DomainEquals) == "" &&
+		strings.TrimSpace(c.SubjectMatches) == "" && c.HasAttachment == nil && strings.TrimSpace(c.LabelEquals) == ""
+}
+
+// Matcher compiles the conditions into a predicate. It fails when subjectMatches is not a
+// valid pattern. Conditions that are all empty never match.
+func (c KanbanRuleConditions) Matcher() (func(e *Email) bool, error) {
+	if c.IsEmpty() {
+		return func(*Email) bool { return false }, nil
+	}
+	var subject *regexp.Regexp
+	if pattern := strings.TrimSpace(c.SubjectMatches); pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid subjectMatches pattern: %w", err)
+		}
+		subject = regexp.MustCompile("(?i)" + pattern)
+	}
+	sender := strings.ToLower(strings.TrimSpace(c.SenderContains))
+	domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(c.DomainEquals), "@"))
+	label := strings.TrimSpace(c.LabelEquals)
+	hasAttachment := c.HasAttachment
+
+	return func(e *Email) bool {
+		if sender != "" &&
+			!strings.Contains(strings.ToLower(e.From.Email), sender) &&
+			!strings.Contains(strings.ToLower(e.From.Name), sender) {
+			return false
+		}
+		if domain != "" && EmailDomain(e.From.Email) != domain {
+			return false
+		}
+		if subject != nil && !subject.MatchString(e.Subject) {
+			return false
+		}
+		if hasAttachment != nil && e.HasAttachments != *hasAttachment {
+			return false
+		}
+		if label != "" && !e.HasLabel(label) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// EmailDomain returns the lower-cased host part of address, or "" when it has none
+func EmailDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(address[at+1:], " <>"))
+}
+
+// KanbanRuleAction is what happens to a matching email; any combination may be set
+type KanbanRuleAction struct {
+	// Kanban column the email starts in instead of the inbox
+	SetStatus EmailStatus `json:"setStatus,omitempty" bson:"setStatus,omitempty"`
+	// urgent | high | normal | low; replaces the classifier's priority
+	SetPriority EmailPriority `json:"setPriority,omitempty" bson:"setPriority,omitempty"`
+	// Snooze the email for this long after it is synced (Go duration, e.g. "4h" or "72h")
+	SnoozeFor string `json:"snoozeFor,omitempty" bson:"snoozeFor,omitempty"`
+	// Keep the email off the board; it is still listed in mailboxes and search
+	SkipBoard bool `json:"skipBoard,omitempty" bson:"skipBoard,omitempty"`
+}
+
+// IsEmpty reports whether the action does nothing
+func (a KanbanRuleAction) IsEmpty() bool {
+	return a.SetStatus == "" && a.SetPriority == "" && strings.TrimSpace(a.SnoozeFor) == "" && !a.SkipBoard
+}
+
+// SnoozeDuration parses SnoozeFor; 0 when it is not set
+func (a KanbanRuleAction) SnoozeDuration() (time.Duration, error) {
+	if strings.TrimSpace(a.SnoozeFor) == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(a.SnoozeFor))
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// CreateKanbanRuleRequest is the payload for creating a Kanban rule
+type CreateKanbanRuleRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Position among the user's Kanban rules; omitted appends the rule
+	Order      *int                 `json:"order"`
+	Enabled    *bool                `json:"enabled"` // default true
+	Conditions KanbanRuleConditions `json:"conditions"`
+	Action     KanbanRuleAction     `json:"action"`
+}
+
+// UpdateKanbanRuleRequest is the payload for updating a Kanban rule; omitted fields are kept
+type UpdateKanbanRuleRequest struct {
+	Name       *string               `json:"name"`
+	Order      *int                  `json:"order"`
+	Enabled    *bool                 `json:"enabled"`
+	Conditions *KanbanRuleConditions `json:"conditions"`
+	Action     *KanbanRuleAction     `json:"action"`
+}
+
+// KanbanRuleDryRunRequest tests a stored rule (ruleId) or unsaved conditions
+type KanbanRuleDryRunRequest struct {
+	RuleID     string                `json:"ruleId"`
+	Conditions *KanbanRuleConditions `json:"conditions"`
+}
+
+// KanbanRuleMatch is an email a dry run matched
+type KanbanRuleMatch struct {
+	EmailID    string       `json:"emailId"`
+	Subject    string       `json:"subject"`
+	From       EmailAddress `json:"from"`
+	ReceivedAt time.Time    `json:"receivedAt"`
+	Status     EmailStatus  `json:"status"` // current column
+}
+
+// KanbanRuleDryRunResult lists which of the user's latest emails the conditions match
+type KanbanRuleDryRunResult struct {
+	Checked int               `json:"checked"`
+	Matched []KanbanRuleMatch `json:"matched"`
+}
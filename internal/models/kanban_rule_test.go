@@ -0,0 +1,66 @@
+package models
+
+import "testing"
+
+func TestKanbanRuleMatcher(t *testing.T) {
+	yes, no := true, false
+	jira := &Email{
+		Subject:        "[PROJ-42] Login fails on Safari",
+		From:           EmailAddress{Name: "Jira Cloud", Email: "jira@Acme.Atlassian.net"},
+		HasAttachments: true,
+		Labels:         []string{"INBOX", "CATEGORY_UPDATES"},
+	}
+	tests := []struct {
+		name string
+		c    KanbanRuleConditions
+		want bool
+	}{
+		{"no conditions never match", KanbanRuleConditions{}, false},
+		{"blank conditions never match", KanbanRuleConditions{SenderContains: " ", LabelEquals: "  "}, false},
+		{"sender address, any case", KanbanRuleConditions{SenderContains: "JIRA@"}, true},
+		{"sender name", KanbanRuleConditions{SenderContains: "cloud"}, true},
+		{"other sender", KanbanRuleConditions{SenderContains: "github"}, false},
+		{"domain, any case", KanbanRuleConditions{DomainEquals: "acme.atlassian.net"}, true},
+		{"domain with a leading @", KanbanRuleConditions{DomainEquals: " @ACME.atlassian.net"}, true},
+		{"parent domain is not equal", KanbanRuleConditions{DomainEquals: "atlassian.net"}, false},
+		{"subject pattern, any case", KanbanRuleConditions{SubjectMatches: `^\[proj-\d+\]`}, true},
+		{"subject pattern elsewhere", KanbanRuleConditions{SubjectMatches: "safari$"}, true},
+		{"subject pattern misses", KanbanRuleConditions{SubjectMatches: `^re:`}, false},
+		{"has an attachment", KanbanRuleConditions{HasAttachment: &yes}, true},
+		{"has no attachment", KanbanRuleConditions{HasAttachment: &no}, false},
+		{"label", KanbanRuleConditions{LabelEquals: "CATEGORY_UPDATES"}, true},
+		{"label IDs are case-sensitive", KanbanRuleConditions{LabelEquals: "category_updates"}, false},
+		{"all conditions hold", KanbanRuleConditions{SenderContains: "jira", DomainEquals: "acme.atlassian.net", SubjectMatches: "login", HasAttachment: &yes, LabelEquals: "INBOX"}, true},
+		{"one condition fails", KanbanRuleConditions{SenderContains: "jira", DomainEquals: "acme.atlassian.net", SubjectMatches: "login", HasAttachment: &no, LabelEquals: "INBOX"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.c.Matcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(jira); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKanbanRuleMatcherInvalidPattern(t *testing.T) {
+	if _, err := (KanbanRuleConditions{SubjectMatches: "[unclosed"}).Matcher(); err == nil {
+		t.Error("Matcher accepted an invalid subjectMatches pattern")
+	}
+}
+
+func TestEmailDomain(t *testing.T) {
+	for address, want := range map[string]string{
+		"bob@Example.COM":        "example.com",
+		"<bob@example.com>":      "example.com",
+		"\"a@b\" <bob@mail.org>": "mail.org",
+		"no-address":             "",
+	} {
+		if got := EmailDomain(address); got != want {
+			t.Errorf("EmailDomain(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
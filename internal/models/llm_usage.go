@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LLMUsage is the token usage of one LLM or embedding call, as reported by the provider
+type LLMUsage struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID           string             `json:"userId" bson:"userId"` // empty for calls not made on behalf of a user
+	Provider         string             `json:"provider" bson:"provider"`
+	Model            string             `json:"model" bson:"model"`
+	Operation        string             `json:"operation" bson:"operation"` // summary, compose, embedding, ...
+	PromptTokens     int                `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int                `json:"completionTokens" bson:"completionTokens"`
+	CostEstimate     float64            `json:"costEstimate" bson:"costEstimate"` // USD
+	Timestamp        time.Time          `json:"timestamp" bson:"timestamp"`
+}
+
+// OperationUsage totals one operation's calls in a period
+type OperationUsage struct {
+	Operation        string  `json:"operation" bson:"_id"`
+	Calls            int64   `json:"calls" bson:"calls"`
+	PromptTokens     int64   `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens" bson:"totalTokens"`
+	CostEstimate     float64 `json:"costEstimate" bson:"costEstimate"`
+}
+
+// LLMUsageSummary is a user's token usage for the current calendar month (UTC)
+type LLMUsageSummary struct {
+	Month            string    `json:"month"` // YYYY-MM
+	PeriodStart      time.Time `json:"periodStart"`
+	PeriodEnd        time.Time `json:"periodEnd"`
+	Calls            int64     `json:"calls"`
+	PromptTokens     int64     `json:"promptTokens"`
+	CompletionTokens int64     `json:"completionTokens"`
+	TotalTokens      int64     `json:"totalTokens"`
+	CostEstimate     float64   `json:"costEstimate"`
+	// Monthly token cap and what is left of it; omitted when usage is unlimited
+	TokenCap        int64            `json:"tokenCap,omitempty"`
+	RemainingTokens *int64           `json:"remainingTokens,omitempty"`
+	Operations      []OperationUsage `json:"operations"`
+}
+
+// UsageCapResponse is the 402 body returned once the monthly token cap is used up
+type UsageCapResponse struct {
+	Error   string           `json:"error"`
+	Message string           `json:"message"`
+	Usage   *LLMUsageSummary `json:"usage"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationType is what a notification is about
+type NotificationType string
+
+const (
+	// A snoozed email returned to the inbox
+	NotificationSnoozeReturned NotificationType = "snooze_returned"
+	// A recurring snooze came due and was snoozed again for the next period
+	NotificationSnoozeRecurred NotificationType = "snooze_recurred"
+)
+
+// Notification is an in-app message for a user, e.g. that a snoozed card is back
+type Notification struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"-" bson:"userId"`
+	Type      NotificationType   `json:"type" bson:"type"`
+	EmailID   string             `json:"emailId,omitempty" bson:"emailId,omitempty"`
+	Subject   string             `json:"subject,omitempty" bson:"subject,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// nil until the user marks the notification read
+	ReadAt *time.Time `json:"readAt,omitempty" bson:"readAt,omitempty"`
+}
+
+// NotificationPage is one page of a user's notifications, newest first
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	// Pass as before to get the next page; empty on the last page
+	NextCursor  string `json:"nextCursor,omitempty"`
+	UnreadCount int64  `json:"unreadCount"`
+}
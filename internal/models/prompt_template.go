@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PromptTemplate is a summarizer prompt. Placeholders like {{body}} are filled in per email;
+// the seeded default (IsDefault, no user) is used by everyone without an active template.
+type PromptTemplate struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userId,omitempty" bson:"userId"` // empty for the default
+	Name      string             `json:"name" bson:"name"`
+	System    string             `json:"system" bson:"system"` // optional system prompt
+	Prompt    string             `json:"prompt" bson:"prompt"` // must contain {{body}}
+	Active    bool               `json:"active" bson:"active"` // at most one per user
+	IsDefault bool               `json:"isDefault" bson:"isDefault"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CreatePromptTemplateRequest is the payload for creating a template
+type CreatePromptTemplateRequest struct {
+	Name   string `json:"name" binding:"required"`
+	System string `json:"system"`
+	Prompt string `json:"prompt" binding:"required"`
+	Active bool   `json:"active"`
+}
+
+// UpdatePromptTemplateRequest is the payload for updating a template; omitted fields are kept
+type UpdatePromptTemplateRequest struct {
+	Name   *string `json:"name"`
+	System *string `json:"system"`
+	Prompt *string `json:"prompt"`
+}
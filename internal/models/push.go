@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PushSubscription is a browser's Web Push subscription, as returned by
+// PushSubscription.toJSON() in the service worker. A user has one per browser.
+type PushSubscription struct {
+	ID        primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	UserID    string               `json:"-" bson:"userId"`
+	Endpoint  string               `json:"endpoint" bson:"endpoint"`
+	Keys      PushSubscriptionKeys `json:"keys" bson:"keys"`
+	UserAgent string               `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	CreatedAt time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// PushSubscriptionKeys are the browser's keys for payload encryption, base64url encoded
+type PushSubscriptionKeys struct {
+	// Uncompressed P-256 public key
+	P256dh string `json:"p256dh" bson:"p256dh" binding:"required"`
+	// 16-byte authentication secret
+	Auth string `json:"auth" bson:"auth" binding:"required"`
+}
+
+// PushSubscribeRequest is the payload of POST /api/push/subscribe
+type PushSubscribeRequest struct {
+	Endpoint string               `json:"endpoint" binding:"required"`
+	Keys     PushSubscriptionKeys `json:"keys"`
+}
+
+// PushUnsubscribeRequest is the payload of DELETE /api/push/subscribe
+type PushUnsubscribeRequest struct {
+	Endpoint string `json:"endpoint" binding:"required"`
+}
+
+// PushImportantEmail is the push message type for a newly synced urgent or high-priority
+// email; snoozed cards use the notification types
+const PushImportantEmail NotificationType = "important_email"
+
+// PushMessage is the JSON payload the service worker receives
+type PushMessage struct {
+	Type    NotificationType `json:"type"`
+	Title   string           `json:"title"`
+	Body    string           `json:"body,omitempty"`
+	EmailID string           `json:"emailId,omitempty"`
+	// Number of emails the message stands for when several arrived at once
+	Count int `json:"count,omitempty"`
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rule files incoming emails automatically, e.g. "emails from billing@ go to To Do". A user's
+// enabled rules are evaluated in Order when an email is first synced.
+type Rule struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID  string             `json:"userId" bson:"userId"`
+	Name    string             `json:"name" bson:"name"`
+	Order   int                `json:"order" bson:"order"`
+	Enabled bool               `json:"enabled" bson:"enabled"`
+	// Later rules are not evaluated once this one matched
+	StopOnMatch bool           `json:"stopOnMatch" bson:"stopOnMatch"`
+	Conditions  RuleConditions `json:"conditions" bson:"conditions"`
+	Action      RuleAction     `json:"action" bson:"action"`
+	CreatedAt   time.Time      `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt" bson:"updatedAt"`
+}
+
+// RuleConditions select the emails a rule applies to; every condition that is set must match
+type RuleConditions struct {
+	// Case-insensitive substring of the sender's address or name, e.g. "billing@"
+	Sender string `json:"sender,omitempty" bson:"sender,omitempty"`
+	// Case-insensitive substring of the subject
+	Subject string `json:"subject,omitempty" bson:"subject,omitempty"`
+	// Gmail label ID the email carries, e.g. CATEGORY_PROMOTIONS or Label_123
+	Label string `json:"label,omitempty" bson:"label,omitempty"`
+}
+
+// IsEmpty reports whether no condition is set
+func (c RuleConditions) IsEmpty() bool {
+	return strings.TrimSpace(c.Sender) == "" && strings.TrimSpace(c.Subject) == "" && strings.TrimSpace(c.Label) == ""
+}
+
+// RuleAction is what happens to a matching email
+type RuleAction struct {
+	// Kanban column the email starts in instead of the inbox
+	SetStatus EmailStatus `json:"setStatus,omitempty" bson:"setStatus,omitempty"`
+	// Gmail label ID to add
+	AddLabel string `json:"addLabel,omitempty" bson:"addLabel,omitempty"`
+}
+
+// IsEmpty reports whether the action does nothing
+func (a RuleAction) IsEmpty() bool {
+	return a.SetStatus == "" && strings.TrimSpace(a.AddLabel) == ""
+}
+
+// Matches reports whether e meets all of the rule's conditions. Rules without conditions
+// never match.
+func (r *Rule) Matches(e *Email) bool {
+	c := r.Conditions
+	if c.IsEmpty() {
+		return false
+	}
+	if sender := strings.ToLower(strings.TrimSpace(c.Sender)); sender != "" &&
+		!strings.Contains(strings.ToLower(e.From.Email), sender) &&
+		!strings.Contains(strings.ToLower(e.From.Name), sender) {
+		return false
+	}
+	if subject := strings.ToLower(strings.TrimSpace(c.Subject)); subject != "" &&
+		!strings.Contains(strings.ToLower(e.Subject), subject) {
+		return false
+	}
+	if label := strings.TrimSpace(c.Label); label != "" && !e.HasLabel(label) {
+		return false
+	}
+	return true
+}
+
+// CreateRuleRequest is the payload for creating a rule
+type CreateRuleRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Position among the user's rules; omitted appends the rule
+	Order       *int           `json:"order"`
+	Enabled     *bool          `json:"enabled"` // default true
+	StopOnMatch bool           `json:"stopOnMatch"`
+	Conditions  RuleConditions `json:"conditions"`
+	Action      RuleAction     `json:"action"`
+}
+
+// UpdateRuleRequest is the payload for updating a rule; omitted fields are kept
+type UpdateRuleRequest struct {
+	Name        *string         `json:"name"`
+	Order       *int            `json:"order"`
+	Enabled     *bool           `json:"enabled"`
+	StopOnMatch *bool           `json:"stopOnMatch"`
+	Conditions  *RuleConditions `json:"conditions"`
+	Action      *RuleAction     `json:"action"`
+}
+
+// TestRulesRequest is the payload of the rules dry run: a stored email, or a sample email
+// described by its sender, subject and labels
+type TestRulesRequest struct {
+	EmailID string       `json:"emailId"`
+	From    EmailAddress `json:"from"`
+	Subject string       `json:"subject"`
+	Labels  []string     `json:"labels"`
+}
+
+// RuleEvaluation is the outcome of running a user's rules on one email
+type RuleEvaluation struct {
+	// Rules that matched, in evaluation order
+	Matched []Rule `json:"matched"`
+	// Saved searches with an action that matched
+	MatchedSearches []SavedSearch `json:"matchedSearches,omitempty"`
+	// Column the email would start in; empty keeps the inbox
+	Status EmailStatus `json:"status,omitempty"`
+	// Gmail labels that would be added
+	AddLabels []string `json:"addLabels,omitempty"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SavedSearchModeHybrid runs keyword, semantic and Gmail search and fuses the results; the
+// other modes are the retriever names (keyword, semantic, gmail)
+const SavedSearchModeHybrid = "hybrid"
+
+// SavedSearchSources returns the hybrid search retrievers a mode runs (nil for all); ok is
+// false for unknown modes
+func SavedSearchSources(mode string) (sources []string, ok bool) {
+	switch mode {
+	case "", SavedSearchModeHybrid:
+		return nil, true
+	case RetrieverKeyword, RetrieverSemantic, RetrieverGmail:
+		return []string{mode}, true
+	}
+	return nil, false
+}
+
+// SavedSearch is a search the user runs again by name. With an action it also works as a
+// filter: newly synced emails matching the query and filters get the action applied.
+type SavedSearch struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID  string             `json:"userId" bson:"userId"`
+	Name    string             `json:"name" bson:"name"`
+	Query   string             `json:"query" bson:"query"`
+	Filters SearchFilters      `json:"filters" bson:"filters"`
+	// hybrid (default), keyword, semantic or gmail
+	Mode      string             `json:"mode" bson:"mode"`
+	Action    *SavedSearchAction `json:"action,omitempty" bson:"action,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SavedSearchAction is applied to newly synced emails that match a saved search
+type SavedSearchAction struct {
+	// Kanban column the email starts in instead of the inbox
+	MoveToStatus EmailStatus `json:"moveToStatus,omitempty" bson:"moveToStatus,omitempty"`
+	// Gmail label ID to add
+	AddLabel string `json:"addLabel,omitempty" bson:"addLabel,omitempty"`
+}
+
+// IsEmpty reports whether the action does nothing
+func (a *SavedSearchAction) IsEmpty() bool {
+	return a == nil || (a.MoveToStatus == "" && a.AddLabel == "")
+}
+
+// SavedSearchRequest is the payload for creating or replacing a saved search
+type SavedSearchRequest struct {
+	Name    string             `json:"name" binding:"required"`
+	Query   string             `json:"query" binding:"required"`
+	Filters SearchFilters      `json:"filters"`
+	Mode    string             `json:"mode"`
+	Action  *SavedSearchAction `json:"action"`
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Hybrid search retrievers
+const (
+	RetrieverKeyword  = "keyword"
+	RetrieverSemantic = "semantic"
+	RetrieverGmail    = "gmail"
+)
+
+// SearchFilters restrict search results in every retriever; zero values don't filter
+type SearchFilters struct {
+	DateFrom *time.Time `json:"dateFrom,omitempty" bson:"dateFrom,omitempty"` // received at or after
+	DateTo   *time.Time `json:"dateTo,omitempty" bson:"dateTo,omitempty"`     // received before
+	// Case-insensitive substring of the sender's address or name
+	Sender string `json:"sender,omitempty" bson:"sender,omitempty"`
+	// Gmail label ID, e.g. INBOX, STARRED or Label_123
+	Label         string `json:"label,omitempty" bson:"label,omitempty"`
+	HasAttachment *bool  `json:"hasAttachment,omitempty" bson:"hasAttachment,omitempty"`
+	// Kanban column (workflow status); emails never moved are in inbox
+	Status string `json:"status,omitempty" bson:"status,omitempty"`
+	// Mailbox (Gmail label ID) the email is filed under
+	MailboxID string `json:"mailboxId,omitempty" bson:"mailboxId,omitempty"`
+	IsRead    *bool  `json:"isRead,omitempty" bson:"isRead,omitempty"`
+}
+
+// Validate returns a message per invalid field (JSON names), or nil when the filters are usable
+func (f *SearchFilters) Validate() map[string]string {
+	if f == nil {
+		return nil
+	}
+	problems := map[string]string{}
+	if f.DateFrom != nil && f.DateTo != nil && !f.DateFrom.Before(*f.DateTo) {
+		problems["dateFrom"] = "must be before dateTo"
+	}
+	if len(f.Sender) > 256 {
+		problems["sender"] = "must be at most 256 characters"
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// Matches reports whether e passes the filters
+func (f *SearchFilters) Matches(e *Email) bool {
+	if f == nil {
+		return true
+	}
+	if f.DateFrom != nil && e.ReceivedAt.Before(*f.DateFrom) {
+		return false
+	}
+	if f.DateTo != nil && !e.ReceivedAt.Before(*f.DateTo) {
+		return false
+	}
+	if sender := strings.ToLower(strings.TrimSpace(f.Sender)); sender != "" &&
+		!strings.Contains(strings.ToLower(e.From.Email), sender) &&
+		!strings.Contains(strings.ToLower(e.From.Name), sender) {
+		return false
+	}
+	if f.Label != "" && !e.HasLabel(f.Label) {
+		return false
+	}
+	if f.HasAttachment != nil && e.HasAttachments != *f.HasAttachment {
+		return false
+	}
+	if f.Status != "" && emailStatus(e) != f.Status {
+		return false
+	}
+	if f.MailboxID != "" && e.MailboxID != f.MailboxID && !e.HasLabel(f.MailboxID) {
+		return false
+	}
+	if f.IsRead != nil && e.IsRead != *f.IsRead {
+		return false
+	}
+	return true
+}
+
+// emailStatus is e's Kanban column; emails that were never stored or moved are in the inbox
+func emailStatus(e *Email) string {
+	if e.Status == "" {
+		return string(StatusInbox)
+	}
+	return string(e.Status)
+}
+
+// HybridSearchRequest is the payload of POST /api/search
+type HybridSearchRequest struct {
+	Query   string        `json:"query" binding:"required"`
+	Limit   int           `json:"limit"` // default 20, max 50
+	Filters SearchFilters `json:"filters"`
+	// Retrievers to run (keyword, semantic, gmail); empty runs all
+	Sources []string `json:"sources,omitempty"`
+}
+
+// HybridSearchResult is one fused hit
+type HybridSearchResult struct {
+	Email *Email `json:"email"`
+	// Reciprocal rank fusion score: the sum of 1/(k+rank) over the retrievers that found it
+	Score float64 `json:"score"`
+	// Retrievers that returned the email, best rank first
+	MatchedBy []string `json:"matchedBy"`
+	// 1-based rank and min-max normalized score (0-1) per retriever
+	Ranks  map[string]int     `json:"ranks"`
+	Scores map[string]float64 `json:"scores"`
+}
+
+// HybridSearchResponse is the fused result list
+type HybridSearchResponse struct {
+	Query   string               `json:"query"`
+	Results []HybridSearchResult `json:"results"`
+	Total   int                  `json:"total"`
+	// Retrievers that failed; the results come from the others
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// SearchHistoryEntry is a search the user ran; repeated queries (ignoring case and spacing)
+// share one entry
+type SearchHistoryEntry struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID string             `json:"-" bson:"userId"`
+	Query  string             `json:"query" bson:"query"` // as last typed
+	// Lower-cased query with collapsed spaces; unique per user
+	Normalized  string    `json:"-" bson:"normalized"`
+	ResultCount int       `json:"resultCount" bson:"resultCount"`
+	SearchedAt  time.Time `json:"searchedAt" bson:"searchedAt"`
+}
+
+// NormalizeSearchQuery is the form search history is deduplicated by
+func NormalizeSearchQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
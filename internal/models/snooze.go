@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SnoozePreset is a snooze time named relative to now, resolved in the user's time zone
+type SnoozePreset string
+
+const (
+	// 18:00 today, or three hours from now once it is past 15:00
+	SnoozeLaterToday SnoozePreset = "later_today"
+	// 08:00 tomorrow
+	SnoozeTomorrowMorning SnoozePreset = "tomorrow_morning"
+	// 08:00 next Monday
+	SnoozeNextWeek SnoozePreset = "next_week"
+	// 09:00 on the coming Saturday (next week's during the weekend)
+	SnoozeWeekend SnoozePreset = "weekend"
+)
+
+// SnoozeRecurrence makes a snooze repeat: when it is due the card is snoozed again for the
+// next period instead of returning to the inbox, until the user moves it
+type SnoozeRecurrence string
+
+const (
+	SnoozeDaily  SnoozeRecurrence = "daily"
+	SnoozeWeekly SnoozeRecurrence = "weekly"
+)
+
+// ValidSnoozeRecurrence reports whether r is a known recurrence
+func ValidSnoozeRecurrence(r SnoozeRecurrence) bool {
+	return r == SnoozeDaily || r == SnoozeWeekly
+}
+
+// Resolve returns the time preset p stands for at now, in loc
+func (p SnoozePreset) Resolve(now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+	at := func(days, hour int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()+days, hour, 0, 0, 0, loc)
+	}
+	switch p {
+	case SnoozeLaterToday:
+		if now.Hour() >= 15 {
+			return now.Add(3 * time.Hour).Truncate(time.Minute), nil
+		}
+		return at(0, 18), nil
+	case SnoozeTomorrowMorning:
+		return at(1, 8), nil
+	case SnoozeNextWeek:
+		// days until next Monday: 7 on Mondays, 1 on Sundays
+		return at(7-(int(now.Weekday())+6)%7, 8), nil
+	case SnoozeWeekend:
+		days := (int(time.Saturday) - int(now.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return at(days, 9), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown snooze preset %q (use later_today, tomorrow_morning, next_week or weekend)", p)
+}
+
+// Next returns the first occurrence of a snooze that was due at due, repeated by r, that is
+// after now
+func (r SnoozeRecurrence) Next(due, now time.Time) time.Time {
+	days := 1
+	if r == SnoozeWeekly {
+		days = 7
+	}
+	next := due.AddDate(0, 0, days)
+	for !next.After(now) {
+		next = next.AddDate(0, 0, days)
+	}
+	return next
+}
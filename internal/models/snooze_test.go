@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnoozeRecurrenceNext(t *testing.T) {
+	due := time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC) // a Monday
+	tests := []struct {
+		name string
+		r    SnoozeRecurrence
+		now  time.Time
+		want time.Time
+	}{
+		{"daily, on time", SnoozeDaily, due.Add(time.Minute), due.AddDate(0, 0, 1)},
+		{"daily, worker was down for days", SnoozeDaily, due.AddDate(0, 0, 3).Add(time.Hour), due.AddDate(0, 0, 4)},
+		{"daily, now is exactly the next occurrence", SnoozeDaily, due.AddDate(0, 0, 1), due.AddDate(0, 0, 2)},
+		{"weekly, on time", SnoozeWeekly, due.Add(time.Minute), due.AddDate(0, 0, 7)},
+		{"weekly, missed two weeks", SnoozeWeekly, due.AddDate(0, 0, 15), due.AddDate(0, 0, 21)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.Next(due, tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+			if !got.After(tt.now) {
+				t.Errorf("Next = %v is not after now %v", got, tt.now)
+			}
+		})
+	}
+}
+
+func TestSnoozeRecurrenceNextKeepsLocalTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available:", err)
+	}
+	// DST starts on 2026-03-08; the daily snooze stays at 08:00 local time
+	due := time.Date(2026, 3, 7, 8, 0, 0, 0, loc)
+	got := SnoozeDaily.Next(due, due.Add(time.Minute))
+	if want := time.Date(2026, 3, 8, 8, 0, 0, 0, loc); !got.Equal(want) || got.Hour() != 8 {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestValidSnoozeRecurrence(t *testing.T) {
+	for _, r := range []SnoozeRecurrence{SnoozeDaily, SnoozeWeekly} {
+		if !ValidSnoozeRecurrence(r) {
+			t.Errorf("%q is not valid", r)
+		}
+	}
+	for _, r := range []SnoozeRecurrence{"", "monthly", "Daily"} {
+		if ValidSnoozeRecurrence(r) {
+			t.Errorf("%q is valid", r)
+		}
+	}
+}
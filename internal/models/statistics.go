@@ -12,11 +12,26 @@ type EmailTrendPoint struct {
 	Count int    `json:"count" bson:"count"`
 }
 
+// EmailCategoryStats - count of emails by category ("uncategorized" for legacy emails)
+type EmailCategoryStats struct {
+	Category string `json:"category" bson:"_id"`
+	Count    int    `json:"count" bson:"count"`
+}
+
 // TopSender - represents a top email sender with count
 type TopSender struct {
-	Name  string `json:"name" bson:"name"`
-	Email string `json:"email" bson:"email"`
-	Count int    `json:"count" bson:"count"`
+	Name        string `json:"name" bson:"name"`
+	Email       string `json:"email" bson:"email"`
+	Count       int    `json:"count" bson:"count"`
+	UnreadCount int    `json:"unreadCount" bson:"unreadCount"`
+}
+
+// TopDomain - represents a top sender domain (host part of the address) with count
+type TopDomain struct {
+	Domain      string  `json:"domain" bson:"domain"`
+	Count       int     `json:"count" bson:"count"`
+	UnreadCount int     `json:"unreadCount" bson:"unreadCount"`
+	Percentage  float64 `json:"percentage" bson:"percentage"` // of all visible emails, 0-100
 }
 
 // DailyActivity - email activity by day of week and hour
@@ -26,14 +41,74 @@ type DailyActivity struct {
 	Count     int `json:"count" bson:"count"`
 }
 
+// Response time histogram buckets
+const (
+	ResponseUnderHour = "under1h" // under 1 hour
+	ResponseUnder4h   = "1to4h"   // 1 to 4 hours
+	ResponseSameDay   = "sameDay" // 4 to 24 hours
+	ResponseOverDay   = "over1d"  // more than a day
+)
+
+// ResponseTimeBucket - number of replied threads whose first reply took this long
+type ResponseTimeBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// ResponseTimeStats - time between the first received message of a thread and the user's first
+// reply to it; threads without a reply are not counted
+type ResponseTimeStats struct {
+	RepliedThreads int                  `json:"repliedThreads"`
+	MedianSeconds  int64                `json:"medianSeconds"`
+	AverageSeconds int64                `json:"averageSeconds"`
+	Buckets        []ResponseTimeBucket `json:"buckets"` // always all four, in order
+}
+
+// Snooze wake-up buckets, in the user's time zone
+const (
+	SnoozeWakeToday    = "today"    // by the end of today, overdue included
+	SnoozeWakeThisWeek = "thisWeek" // after today, by the end of Sunday
+	SnoozeWakeLater    = "later"
+)
+
+// SnoozeWakeBucket - number of snoozed emails waking up in this period
+type SnoozeWakeBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// SnoozeStats - emails currently in the Snoozed column
+type SnoozeStats struct {
+	Snoozed int                `json:"snoozed"`
+	Buckets []SnoozeWakeBucket `json:"buckets"` // always all three, in order
+}
+
+// SummaryCoverage - visible emails that have an AI summary
+type SummaryCoverage struct {
+	Summarized int     `json:"summarized"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"` // 0-100
+}
+
 // StatisticsResponse - complete statistics response for the dashboard
 type StatisticsResponse struct {
 	StatusStats   []EmailStatusStats `json:"statusStats"`
 	EmailTrend    []EmailTrendPoint  `json:"emailTrend"`
 	TopSenders    []TopSender        `json:"topSenders"`
+	TopDomains    []TopDomain        `json:"topDomains"`
 	DailyActivity []DailyActivity    `json:"dailyActivity"`
 	TotalEmails   int                `json:"totalEmails"`
 	UnreadCount   int                `json:"unreadCount"`
 	StarredCount  int                `json:"starredCount"`
 	Period        string             `json:"period"` // "7d", "30d", "90d"
+	// Visible emails per category
+	CategoryStats []EmailCategoryStats `json:"categoryStats"`
+	// Auto-summarize queue; omitted when the feature is disabled
+	SummaryQueue *SummaryQueueStats `json:"summaryQueue,omitempty"`
+	// Time to first reply for threads active in the period
+	ResponseTimes ResponseTimeStats `json:"responseTimes"`
+	// Snoozed backlog by wake-up time
+	Snooze SnoozeStats `json:"snooze"`
+	// Share of visible emails with an AI summary
+	SummaryCoverage SummaryCoverage `json:"summaryCoverage"`
 }
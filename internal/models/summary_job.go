@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// SummaryJobStatus is the lifecycle state of a queued summarization job
+type SummaryJobStatus string
+
+const (
+	JobPending    SummaryJobStatus = "pending"
+	JobProcessing SummaryJobStatus = "processing"
+	JobDone       SummaryJobStatus = "done"
+	JobSkipped    SummaryJobStatus = "skipped" // email too short to need a summary
+	JobFailed     SummaryJobStatus = "failed"  // gave up after the maximum number of attempts
+)
+
+// SummaryJob is a persistent auto-summarize job for one email
+type SummaryJob struct {
+	EmailID   string           `json:"emailId" bson:"_id"`
+	UserID    string           `json:"userId" bson:"userId"`
+	Status    SummaryJobStatus `json:"status" bson:"status"`
+	Attempts  int              `json:"attempts" bson:"attempts"`
+	LastError string           `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	NextRunAt time.Time        `json:"nextRunAt" bson:"nextRunAt"`
+	CreatedAt time.Time        `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SummaryQueueStats reports a user's auto-summarize queue depth and processed counts
+type SummaryQueueStats struct {
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Done       int `json:"done"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
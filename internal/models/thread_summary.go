@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ThreadSummary is the rolling summary of a whole conversation. It is valid while the
+// thread's newest message is still LastMessageID.
+type ThreadSummary struct {
+	ID            string    `json:"-" bson:"_id"` // "<userId>:<threadId>"
+	UserID        string    `json:"userId" bson:"userId"`
+	ThreadID      string    `json:"threadId" bson:"threadId"`
+	LastMessageID string    `json:"lastMessageId" bson:"lastMessageId"`
+	MessageCount  int       `json:"messageCount" bson:"messageCount"`
+	Summary       string    `json:"summary" bson:"summary"`
+	Language      string    `json:"language" bson:"language"`
+	Model         string    `json:"model" bson:"model"` // "<provider>/<model>" or "extractive"
+	UpdatedAt     time.Time `json:"updatedAt" bson:"updatedAt"`
+}
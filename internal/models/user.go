@@ -14,17 +14,54 @@ type User struct {
 	Picture      string    `json:"picture,omitempty" bson:"picture,omitempty"`
 	Provider     string    `json:"provider" bson:"provider"` // "email" or "google"
 	GoogleID     string    `json:"-" bson:"googleId,omitempty"`
-	RefreshToken string    `json:"-" bson:"refreshToken,omitempty"`
+	RefreshToken string    `json:"-" bson:"refreshToken,omitempty"` // legacy raw token, replaced by RefreshTokenHash on the next login or refresh
+
+	// App refresh token: only its SHA-256 is stored (utils.HashToken)
+	RefreshTokenHash string `json:"-" bson:"refreshTokenHash,omitempty"`
+	// Rotated-out tokens that are still accepted for a short while (JWT_REFRESH_REUSE_WINDOW)
+	RecentRefreshTokens []RecentRefreshToken `json:"-" bson:"recentRefreshTokens,omitempty"`
 
 	// Google OAuth Tokens
 	GoogleRefreshToken string    `json:"-" bson:"googleRefreshToken,omitempty"`
 	GoogleAccessToken  string    `json:"-" bson:"googleAccessToken,omitempty"`
 	GoogleTokenExpiry  time.Time `json:"-" bson:"googleTokenExpiry,omitempty"`
 
+	// Backend of the linked mailbox (services.MailProvider); empty is gmail
+	MailProvider string `json:"mailProvider,omitempty" bson:"mailProvider,omitempty"`
+
+	// Gmail push notifications (Users.Watch)
+	GmailWatchEnabled bool      `json:"-" bson:"gmailWatchEnabled,omitempty"`
+	GmailWatchExpiry  time.Time `json:"-" bson:"gmailWatchExpiry,omitempty"`
+	GmailHistoryID    uint64    `json:"-" bson:"gmailHistoryId,omitempty"`
+
+	// Settings
+	// Classify priority with keyword heuristics only, never with the LLM
+	PriorityHeuristicsOnly bool `json:"priorityHeuristicsOnly" bson:"priorityHeuristicsOnly,omitempty"`
+	// IANA time zone snooze presets are resolved in, e.g. "Asia/Ho_Chi_Minh"; empty is UTC
+	TimeZone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
+// RecentRefreshToken is a rotated refresh token's hash and when it stops being accepted
+type RecentRefreshToken struct {
+	Hash       string    `bson:"hash"`
+	ValidUntil time.Time `bson:"validUntil"`
+}
+
+// Location is the user's time zone setting; UTC when unset or no longer known
+func (u *User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
@@ -44,6 +81,13 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
+// UpdateSettingsRequest changes user settings; omitted fields are left unchanged
+type UpdateSettingsRequest struct {
+	PriorityHeuristicsOnly *bool `json:"priorityHeuristicsOnly"`
+	// IANA name; "" resets to UTC
+	TimeZone *string `json:"timezone"`
+}
+
 type AuthResponse struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
@@ -53,4 +97,6 @@ type AuthResponse struct {
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
+	// Problems per request field, for validation errors
+	Fields map[string]string `json:"fields,omitempty"`
 }
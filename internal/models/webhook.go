@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEvent is a board event an outbound webhook can be sent for
+type WebhookEvent string
+
+const (
+	WebhookEmailMoved      WebhookEvent = "email.moved"
+	WebhookEmailSummarized WebhookEvent = "email.summarized"
+	WebhookEmailUnsnoozed  WebhookEvent = "email.unsnoozed"
+	// Sent by POST /api/settings/webhook/test, whatever the webhook's events
+	WebhookPing WebhookEvent = "webhook.ping"
+)
+
+// ValidWebhookEvent reports whether e is an event a webhook can subscribe to
+func ValidWebhookEvent(e WebhookEvent) bool {
+	switch e {
+	case WebhookEmailMoved, WebhookEmailSummarized, WebhookEmailUnsnoozed:
+		return true
+	}
+	return false
+}
+
+// Webhook is a user's outbound integration (Zapier, n8n, ...): board events are POSTed to
+// URL, signed with Secret. A user has at most one.
+type Webhook struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID string             `json:"-" bson:"userId"`
+	URL    string             `json:"url" bson:"url"`
+	// HMAC-SHA256 key; only returned when it is created or rotated
+	Secret string `json:"-" bson:"secret"`
+	// Events delivered; empty means all of them
+	Events  []WebhookEvent `json:"events" bson:"events"`
+	Enabled bool           `json:"enabled" bson:"enabled"`
+	// Outcome of the latest delivery attempt
+	LastStatus     WebhookDeliveryStatus `json:"lastStatus,omitempty" bson:"lastStatus,omitempty"`
+	LastStatusCode int                   `json:"lastStatusCode,omitempty" bson:"lastStatusCode,omitempty"`
+	LastError      string                `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	LastDeliveryAt *time.Time            `json:"lastDeliveryAt,omitempty" bson:"lastDeliveryAt,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Wants reports whether the webhook is enabled and subscribed to event
+func (w *Webhook) Wants(event WebhookEvent) bool {
+	if !w.Enabled {
+		return false
+	}
+	if event == WebhookPing || len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRequest is the payload of PUT /api/settings/webhook
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Events to deliver; omitted or empty means all
+	Events []WebhookEvent `json:"events"`
+	// Default true
+	Enabled *bool `json:"enabled"`
+}
+
+// WebhookResponse is a webhook with its secret, returned when the secret is new
+type WebhookResponse struct {
+	*Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryStatus is the lifecycle state of a queued webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending    WebhookDeliveryStatus = "pending"
+	DeliveryProcessing WebhookDeliveryStatus = "processing"
+	DeliveryDelivered  WebhookDeliveryStatus = "delivered"
+	DeliveryFailed     WebhookDeliveryStatus = "failed" // gave up after the maximum number of attempts
+)
+
+// WebhookDelivery is one queued POST of an event to a user's webhook
+type WebhookDelivery struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID string             `json:"-" bson:"userId"`
+	Event  WebhookEvent       `json:"event" bson:"event"`
+	// JSON body, stored as sent so the signature covers the exact bytes
+	Payload        string                `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	LastStatusCode int                   `json:"lastStatusCode,omitempty" bson:"lastStatusCode,omitempty"`
+	LastError      string                `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	NextRunAt      time.Time             `json:"nextRunAt" bson:"nextRunAt"`
+	CreatedAt      time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt" bson:"updatedAt"`
+}
+
+// WebhookPayload is the JSON body receivers get
+type WebhookPayload struct {
+	ID        string             `json:"id"` // delivery ID, the same on every retry
+	Event     WebhookEvent       `json:"event"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Data      WebhookEmailChange `json:"data"`
+}
+
+// WebhookEmailChange describes the email an event is about
+type WebhookEmailChange struct {
+	EmailID    string      `json:"emailId,omitempty"`
+	Subject    string      `json:"subject,omitempty"`
+	From       string      `json:"from,omitempty"`
+	FromStatus EmailStatus `json:"fromStatus,omitempty"`
+	ToStatus   EmailStatus `json:"toStatus,omitempty"`
+	Summary    string      `json:"summary,omitempty"`
+	// email.moved: "undo", "bulk" or "thread" when not a single drag
+	Detail string `json:"detail,omitempty"`
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// aiUsageRetention is how long daily usage counters are kept
+const aiUsageRetention = 90 * 24 * time.Hour
+
+// ErrQuotaExceeded is returned when a user has used up a daily AI quota
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// AIUsageRepository counts per-user, per-feature AI calls per UTC day
+type AIUsageRepository struct {
+	collection *mongo.Collection
+}
+
+type aiUsageEntry struct {
+	Key       string    `bson:"_id"` // "<userID>:<feature>:<YYYY-MM-DD>"
+	UserID    string    `bson:"userId"`
+	Feature   string    `bson:"feature"`
+	Day       string    `bson:"day"`
+	Count     int       `bson:"count"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// NewAIUsageRepository creates a new repository
+func NewAIUsageRepository(db *mongo.Database) *AIUsageRepository {
+	r := &AIUsageRepository{
+		collection: db.Collection("ai_usage"),
+	}
+
+	// TTL index: old counters are removed automatically
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("idx_created_at_ttl").SetExpireAfterSeconds(int32(aiUsageRetention.Seconds())),
+	})
+
+	return r
+}
+
+func aiUsageKey(userID, feature string, now time.Time) (key, day string) {
+	day = now.UTC().Format("2006-01-02")
+	return userID + ":" + feature + ":" + day, day
+}
+
+// Reserve counts one call of feature for today and returns the new count. With limit > 0 it
+// returns ErrQuotaExceeded instead once the count has reached limit. The check and the
+// increment are a single atomic upsert, so concurrent requests cannot overshoot.
+func (r *AIUsageRepository) Reserve(ctx context.Context, userID, feature string, limit int) (int, error) {
+	now := time.Now()
+	key, day := aiUsageKey(userID, feature, now)
+
+	filter := bson.M{"_id": key}
+	if limit > 0 {
+		filter["count"] = bson.M{"$lt": limit}
+	}
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"userId": userID, "feature": feature, "day": day, "createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var entry aiUsageEntry
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	if err != nil {
+		// At the limit the filter misses the existing counter and the upsert collides with it
+		if mongo.IsDuplicateKeyError(err) {
+			return limit, ErrQuotaExceeded
+		}
+		return 0, err
+	}
+	return entry.Count, nil
+}
+
+// Release gives back a reservation whose call failed
+func (r *AIUsageRepository) Release(ctx context.Context, userID, feature string) error {
+	key, _ := aiUsageKey(userID, feature, time.Now())
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": key, "count": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CardActivityRepository is the append-only activity log of Kanban cards
+type CardActivityRepository struct {
+	collection *mongo.Collection
+}
+
+// NewCardActivityRepository creates the repository and its indexes
+func NewCardActivityRepository(db *mongo.Database) *CardActivityRepository {
+	r := &CardActivityRepository{
+		collection: db.Collection(cardActivityCollection),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "emailId", Value: 1}, {Key: "at", Value: -1}},
+		Options: options.Index().SetName("idx_user_email_at"),
+	})
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "emailId", Value: 1}},
+		Options: options.Index().SetName("idx_email"),
+	})
+
+	return r
+}
+
+// Record appends entries; entries without a time are stamped now
+func (r *CardActivityRepository) Record(ctx context.Context, entries ...*models.CardActivity) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		if e.At.IsZero() {
+			e.At = now
+		}
+		docs[i] = e
+	}
+	_, err := r.collection.InsertMany(ctx, docs)
+	return err
+}
+
+// List returns userID's latest limit entries for emailID, newest first
+func (r *CardActivityRepository) List(ctx context.Context, userID, emailID string, limit int) ([]models.CardActivity, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID, "emailId": emailID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.CardActivity{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LastByEmails returns the time of userID's latest entry for each of emailIDs; emails
+// without activity are absent
+func (r *CardActivityRepository) LastByEmails(ctx context.Context, userID string, emailIDs []string) (map[string]time.Time, error) {
+	last := make(map[string]time.Time)
+	if len(emailIDs) == 0 {
+		return last, nil
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID, "emailId": bson.M{"$in": emailIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$emailId", "at": bson.M{"$max": "$at"}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		EmailID string    `bson:"_id"`
+		At      time.Time `bson:"at"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		last[row.EmailID] = row.At
+	}
+	return last, nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections keyed by emailId that are purged together with their email (see
+// EmailRepository.DeleteByIDs and DeleteStale)
+const (
+	cardNotesCollection    = "card_notes"
+	cardActivityCollection = "card_activity"
+)
+
+// CardNoteRepository stores users' notes on Kanban cards
+type CardNoteRepository struct {
+	collection *mongo.Collection
+}
+
+// NewCardNoteRepository creates the repository and its indexes
+func NewCardNoteRepository(db *mongo.Database) *CardNoteRepository {
+	r := &CardNoteRepository{
+		collection: db.Collection(cardNotesCollection),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "emailId", Value: 1}, {Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("idx_user_email_created"),
+	})
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "emailId", Value: 1}},
+		Options: options.Index().SetName("idx_email"),
+	})
+
+	return r
+}
+
+// List returns userID's notes on emailID, oldest first
+func (r *CardNoteRepository) List(ctx context.Context, userID, emailID string) ([]models.CardNote, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID, "emailId": emailID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notes := []models.CardNote{}
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// Create inserts a note
+func (r *CardNoteRepository) Create(ctx context.Context, note *models.CardNote) error {
+	now := time.Now()
+	note.ID = primitive.NewObjectID()
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	_, err := r.collection.InsertOne(ctx, note)
+	return err
+}
+
+// Update replaces the text of one of userID's notes on emailID and returns the updated note,
+// or mongo.ErrNoDocuments
+func (r *CardNoteRepository) Update(ctx context.Context, userID, emailID, id, text string) (*models.CardNote, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	filter := bson.M{"_id": oid, "userId": userID, "emailId": emailID}
+	update := bson.M{"$set": bson.M{"text": text, "updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var note models.CardNote
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Delete removes one of userID's notes on emailID, or returns mongo.ErrNoDocuments
+func (r *CardNoteRepository) Delete(ctx context.Context, userID, emailID, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return mongo.ErrNoDocuments
+	}
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": oid, "userId": userID, "emailId": emailID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// CountByEmails returns how many notes userID has on each of emailIDs; emails without notes
+// are absent
+func (r *CardNoteRepository) CountByEmails(ctx context.Context, userID string, emailIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(emailIDs) == 0 {
+		return counts, nil
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID, "emailId": bson.M{"$in": emailIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$emailId", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		EmailID string `bson:"_id"`
+		Count   int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.EmailID] = row.Count
+	}
+	return counts, nil
+}
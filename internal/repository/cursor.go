@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EmailCursor marks a position in a (receivedAt desc, _id desc) ordered listing.
+// It is handed to clients as opaque base64-encoded JSON.
+type EmailCursor struct {
+	ReceivedAt time.Time `json:"r"`
+	ID         string    `json:"i"`
+	Mode       string    `json:"m,omitempty"` // search mode the cursor was produced by, if any
+}
+
+// Encode returns the opaque string form of the cursor
+func (c EmailCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeEmailCursor parses an opaque cursor. An empty string yields a nil cursor (first page).
+func DecodeEmailCursor(s string) (*EmailCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c EmailCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID == "" || c.ReceivedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// cursorFor builds the cursor pointing just past the given email
+func cursorFor(e *models.Email, mode string) string {
+	return EmailCursor{ReceivedAt: e.ReceivedAt, ID: e.ID, Mode: mode}.Encode()
+}
+
+// afterCursorFilter matches documents that sort strictly after c in (receivedAt desc, _id desc) order
+func afterCursorFilter(c *EmailCursor) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"receivedAt": bson.M{"$lt": c.ReceivedAt}},
+		{"receivedAt": c.ReceivedAt, "_id": bson.M{"$lt": c.ID}},
+	}}
+}
+
+// keysetSort is the deterministic newest-first ordering used by all listings; _id breaks
+// ties between emails sharing a receivedAt so order is stable across requests and pages
+var keysetSort = bson.D{{Key: "receivedAt", Value: -1}, {Key: "_id", Value: -1}}
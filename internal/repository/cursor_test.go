@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	c := EmailCursor{ReceivedAt: at, ID: "18f2a", Mode: string(SearchModeText)}
+	got, err := DecodeEmailCursor(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ReceivedAt.Equal(at) || got.ID != c.ID || got.Mode != c.Mode {
+		t.Errorf("decoded %+v, want %+v", got, c)
+	}
+
+	if got, err := DecodeEmailCursor(""); got != nil || err != nil {
+		t.Errorf("empty cursor = %v, %v; want first page", got, err)
+	}
+}
+
+func TestDecodeEmailCursorRejectsTampering(t *testing.T) {
+	valid := EmailCursor{ReceivedAt: time.Now(), ID: "18f2a"}.Encode()
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+	flipped := append([]byte{}, raw...)
+	flipped[0] ^= 0xff
+
+	tests := map[string]string{
+		"not base64":      "not a cursor!",
+		"padded base64":   base64.URLEncoding.EncodeToString(raw) + "==",
+		"not json":        base64.RawURLEncoding.EncodeToString([]byte("receivedAt=now")),
+		"flipped byte":    base64.RawURLEncoding.EncodeToString(flipped),
+		"truncated":       valid[:len(valid)/2],
+		"missing id":      base64.RawURLEncoding.EncodeToString([]byte(`{"r":"2024-05-01T09:30:00Z"}`)),
+		"missing time":    base64.RawURLEncoding.EncodeToString([]byte(`{"i":"18f2a"}`)),
+		"wrong time type": base64.RawURLEncoding.EncodeToString([]byte(`{"r":12,"i":"18f2a"}`)),
+	}
+	for name, cursor := range tests {
+		if _, err := DecodeEmailCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
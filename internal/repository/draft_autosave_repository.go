@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DraftAutosaveRetention is how long a local draft is kept after its last autosave
+const DraftAutosaveRetention = 30 * 24 * time.Hour
+
+// DraftAutosaveRepository stores compose-in-progress between autosaves
+type DraftAutosaveRepository struct {
+	collection *mongo.Collection
+}
+
+// NewDraftAutosaveRepository creates the repository and its indexes
+func NewDraftAutosaveRepository(db *mongo.Database) *DraftAutosaveRepository {
+	r := &DraftAutosaveRepository{
+		collection: db.Collection("draft_autosaves"),
+	}
+
+	ctx := context.Background()
+	idxView := r.collection.Indexes()
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "clientId", Value: 1}},
+		Options: options.Index().SetName("idx_user_client_id").SetUnique(true),
+	})
+	// TTL index: abandoned drafts go DraftAutosaveRetention after their last save
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+		Options: options.Index().SetName("idx_updated_at_ttl").SetExpireAfterSeconds(int32(DraftAutosaveRetention.Seconds())),
+	})
+
+	return r
+}
+
+// Save creates or replaces the content of userID's local draft clientID
+func (r *DraftAutosaveRepository) Save(ctx context.Context, userID, clientID string, req *models.DraftAutosaveRequest) (*models.DraftAutosave, error) {
+	now := time.Now()
+	to := req.To
+	if to == nil {
+		to = []string{}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"to":        to,
+			"cc":        req.Cc,
+			"bcc":       req.Bcc,
+			"subject":   req.Subject,
+			"body":      req.Body,
+			"inReplyTo": req.InReplyTo,
+			"threadId":  req.ThreadID,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var d models.DraftAutosave
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"userId": userID, "clientId": clientID}, update, opts).Decode(&d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Get returns userID's local draft clientID; mongo.ErrNoDocuments when there is none
+func (r *DraftAutosaveRepository) Get(ctx context.Context, userID, clientID string) (*models.DraftAutosave, error) {
+	var d models.DraftAutosave
+	if err := r.collection.FindOne(ctx, bson.M{"userId": userID, "clientId": clientID}).Decode(&d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// List returns userID's local drafts, most recently saved first
+func (r *DraftAutosaveRepository) List(ctx context.Context, userID string, limit int) ([]models.DraftAutosave, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	drafts := []models.DraftAutosave{}
+	if err := cursor.All(ctx, &drafts); err != nil {
+		return nil, err
+	}
+	return drafts, nil
+}
+
+// SetGmailDraftID records the Gmail draft userID's local draft clientID was saved as
+func (r *DraftAutosaveRepository) SetGmailDraftID(ctx context.Context, userID, clientID, gmailDraftID string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"userId": userID, "clientId": clientID},
+		bson.M{"$set": bson.M{"gmailDraftId": gmailDraftID}},
+	)
+	return err
+}
+
+// Delete removes userID's local draft clientID; mongo.ErrNoDocuments when there is none
+func (r *DraftAutosaveRepository) Delete(ctx context.Context, userID, clientID string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"userId": userID, "clientId": clientID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteByGmailDraft removes the local drafts saved as Gmail draft gmailDraftID, once that
+// draft is sent or deleted
+func (r *DraftAutosaveRepository) DeleteByGmailDraft(ctx context.Context, userID, gmailDraftID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"userId": userID, "gmailDraftId": gmailDraftID})
+	return err
+}
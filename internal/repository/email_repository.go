@@ -4,8 +4,13 @@ import (
 	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/utils"
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,12 +21,17 @@ import (
 type EmailRepository struct {
 	emailCollection   *mongo.Collection
 	mailboxCollection *mongo.Collection
+	// Card notes and activity, purged together with their emails
+	cardNoteCollection     *mongo.Collection
+	cardActivityCollection *mongo.Collection
 }
 
 func NewEmailRepository(db *mongo.Database) *EmailRepository {
 	r := &EmailRepository{
-		emailCollection:   db.Collection("emails"),
-		mailboxCollection: db.Collection("mailboxes"),
+		emailCollection:        db.Collection("emails"),
+		mailboxCollection:      db.Collection("mailboxes"),
+		cardNoteCollection:     db.Collection(cardNotesCollection),
+		cardActivityCollection: db.Collection(cardActivityCollection),
 	}
 
 	// Ensure indexes for faster Kanban queries
@@ -37,10 +47,79 @@ func NewEmailRepository(db *mongo.Database) *EmailRepository {
 		Keys:    bson.D{{Key: "snoozedUntil", Value: 1}},
 		Options: options.Index().SetName("idx_snoozed_until"),
 	})
+	// subject and summary trigrams, the candidate filter of the typo-tolerant fallback search
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "subjectGrams", Value: 1}},
+		Options: options.Index().SetName("idx_user_subject_grams"),
+	})
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "summaryGrams", Value: 1}},
+		Options: options.Index().SetName("idx_user_summary_grams"),
+	})
+	// copies of the drafts saved through /api/drafts
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "draftId", Value: 1}},
+		Options: options.Index().SetName("idx_user_draft_id").SetSparse(true),
+	})
+	ensureTextIndex(ctx, idxView)
 
 	return r
 }
 
+// textIndexName is the collection's (only) text index, used by every $text search
+const textIndexName = "idx_text_search"
+
+// textIndexModel is the weighted text index over the searchable fields. "none" disables
+// stemming/stop words so non-English (e.g. Vietnamese) content is tokenized as-is.
+//
+// Indexing body makes the index roughly as large as the email bodies themselves, and the
+// first build scans the whole collection. MongoDB 4.2+ only locks the collection briefly at
+// the start and end of the build, but expect CPU and I/O load proportional to the collection
+// size for a while after deploying. Every upsert that changes a body also updates the index.
+func textIndexModel() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "subject", Value: "text"},
+			{Key: "from.name", Value: "text"},
+			{Key: "from.email", Value: "text"},
+			{Key: "summary", Value: "text"},
+			{Key: "body", Value: "text"},
+		},
+		Options: options.Index().
+			SetName(textIndexName).
+			SetDefaultLanguage("none").
+			SetWeights(bson.D{
+				{Key: "subject", Value: 10},
+				{Key: "from.name", Value: 5},
+				{Key: "from.email", Value: 5},
+				{Key: "summary", Value: 2},
+				{Key: "body", Value: 1},
+			}),
+	}
+}
+
+// ensureTextIndex creates the text index. A collection has at most one text index, so an
+// older definition (without body) is dropped and rebuilt.
+func ensureTextIndex(ctx context.Context, idxView mongo.IndexView) {
+	_, err := idxView.CreateOne(ctx, textIndexModel())
+	var cmdErr mongo.CommandError
+	if err == nil || !errors.As(err, &cmdErr) {
+		return
+	}
+	// 85 IndexOptionsConflict, 86 IndexKeySpecsConflict
+	if cmdErr.Code != 85 && cmdErr.Code != 86 {
+		return
+	}
+	log.Println("rebuilding email text index:", cmdErr.Message)
+	if _, err := idxView.DropOne(ctx, textIndexName); err != nil {
+		log.Println("failed to drop old email text index:", err)
+		return
+	}
+	if _, err := idxView.CreateOne(ctx, textIndexModel()); err != nil {
+		log.Println("failed to create email text index:", err)
+	}
+}
+
 // helper to build ID filter that supports either ObjectID hex or string IDs
 func idFilter(emailID string) bson.M {
 	if oid, err := primitive.ObjectIDFromHex(emailID); err == nil {
@@ -50,24 +129,72 @@ func idFilter(emailID string) bson.M {
 }
 
 // GetKanban returns emails grouped by status for a specific user. Snoozed emails are excluded.
-func (r *EmailRepository) GetKanban(ctx context.Context, userID string, unreadOnly bool, hasAttachmentsOnly bool, sortBy string, sortOrder string) (map[string][]models.Email, error) {
-	// Build base filter
-	filter := bson.M{
-		"userId":    userID,
-		"labels":    bson.M{"$ne": "TRASH"},
-		"mailboxId": bson.M{"$ne": "TRASH"},
+// filters optionally restricts the cards the same way in every column (sender, label, received
+// date range, read state, attachments); nil doesn't filter.
+// priorities optionally restricts the priority; unclassified emails count as normal.
+// categories optionally restricts the category; uncategorized emails never match.
+func (r *EmailRepository) GetKanban(ctx context.Context, userID string, filters *models.SearchFilters, priorities []models.EmailPriority, categories []models.EmailCategory, sortBy string, sortOrder string) (map[string][]models.Email, error) {
+	filter := kanbanFilter(userID, filters, priorities, categories)
+	findOptions := options.Find().SetSort(kanbanSort("", sortBy, sortOrder))
+
+	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	if unreadOnly {
-		filter["isRead"] = false
+	result := make(map[string][]models.Email)
+	for cursor.Next(ctx) {
+		var e models.Email
+		if err := cursor.Decode(&e); err != nil {
+			return nil, err
+		}
+		key := string(e.Status)
+		if key == "" {
+			key = string(models.StatusInbox)
+		}
+		result[key] = append(result[key], e)
 	}
-	if hasAttachmentsOnly {
-		filter["hasAttachments"] = true
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// kanbanFilter matches userID's board cards passing the board's filters
+func kanbanFilter(userID string, filters *models.SearchFilters, priorities []models.EmailPriority, categories []models.EmailCategory) bson.M {
+	filter := bson.M{
+		"userId":     userID,
+		"labels":     bson.M{"$ne": "TRASH"},
+		"mailboxId":  bson.M{"$ne": "TRASH"},
+		"deletedAt":  nil,
+		"skipBoard":  bson.M{"$ne": true},
+		"archivedAt": nil,
 	}
 
-	findOptions := options.Find()
+	// The sender clause is an $or; $and keeps it from clashing with others
+	if clauses := searchFilterClauses(filters); len(clauses) > 0 {
+		filter["$and"] = clauses
+	}
+	if len(priorities) > 0 {
+		in := []interface{}{}
+		for _, p := range priorities {
+			in = append(in, p)
+			if p == models.PriorityNormal {
+				in = append(in, nil, "")
+			}
+		}
+		filter["priority"] = bson.M{"$in": in}
+	}
+	if len(categories) > 0 {
+		filter["category"] = bson.M{"$in": categories}
+	}
+	return filter
+}
 
-	// Determine sort field and direction
+// kanbanSort is the board's sort for sortBy and sortOrder; prefix addresses the email fields
+// inside a document (e.g. "latest." after grouping)
+func kanbanSort(prefix, sortBy, sortOrder string) bson.D {
 	direction := -1
 	if strings.ToLower(sortOrder) == "asc" {
 		direction = 1
@@ -75,232 +202,1635 @@ func (r *EmailRepository) GetKanban(ctx context.Context, userID string, unreadOn
 
 	switch strings.ToLower(sortBy) {
 	case "subject":
-		findOptions.SetSort(bson.D{{Key: "subject", Value: direction}})
+		return bson.D{{Key: prefix + "subject", Value: direction}, {Key: prefix + "receivedAt", Value: -1}, {Key: prefix + "_id", Value: -1}}
 	case "sender", "from":
 		// sort by nested field from.email
-		findOptions.SetSort(bson.D{{Key: "from.email", Value: direction}})
+		return bson.D{{Key: prefix + "from.email", Value: direction}, {Key: prefix + "receivedAt", Value: -1}, {Key: prefix + "_id", Value: -1}}
 	default:
 		// default: sort by receivedAt
-		findOptions.SetSort(bson.D{{Key: "receivedAt", Value: direction}})
+		// _id breaks ties between emails sharing a timestamp (e.g. date parsing fell back to now)
+		return bson.D{{Key: prefix + "receivedAt", Value: direction}, {Key: prefix + "_id", Value: direction}}
+	}
+}
+
+// threadMessage is what GetKanbanThreads keeps of each message of a thread
+type threadMessage struct {
+	ID              string             `bson:"id"`
+	Status          models.EmailStatus `bson:"status"`
+	StatusChangedAt *time.Time         `bson:"statusChangedAt"`
+	SnoozedUntil    *time.Time         `bson:"snoozedUntil"`
+	IsRead          bool               `bson:"isRead"`
+}
+
+// GetKanbanThreads is GetKanban with one card per thread: the messages passing the filters
+// are grouped by threadId (emails without one stand alone) and each thread is listed under
+// the status threadStatus picks, keyed like GetKanban. Threads are sorted by their latest
+// message.
+func (r *EmailRepository) GetKanbanThreads(ctx context.Context, userID string, filters *models.SearchFilters, priorities []models.EmailPriority, categories []models.EmailCategory, sortBy string, sortOrder string) (map[string][]models.EmailThread, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: kanbanFilter(userID, filters, priorities, categories)}},
+		// Cards don't show these; keep them out of the grouped documents
+		{{Key: "$project", Value: bson.M{"body": 0, "embedding": 0, "embeddingChunks": 0, "subjectGrams": 0, "summaryGrams": 0, "attachments": 0}}},
+		{{Key: "$sort", Value: bson.D{{Key: "receivedAt", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$threadId", ""}}, "$threadId", "$_id"}},
+			// oldest first after the $sort, so $last is the latest message
+			"latest": bson.M{"$last": "$$ROOT"},
+			"messages": bson.M{"$push": bson.M{
+				"id":              "$_id",
+				"status":          "$status",
+				"statusChangedAt": "$statusChangedAt",
+				"snoozedUntil":    "$snoozedUntil",
+				"isRead":          "$isRead",
+			}},
+			"hasAttachments": bson.M{"$max": "$hasAttachments"},
+		}}},
+		{{Key: "$sort", Value: kanbanSort("latest.", sortBy, sortOrder)}},
+	}
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	result := make(map[string][]models.EmailThread)
+	for cursor.Next(ctx) {
+		var group struct {
+			Latest         models.Email    `bson:"latest"`
+			Messages       []threadMessage `bson:"messages"`
+			HasAttachments bool            `bson:"hasAttachments"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		thread := models.EmailThread{
+			Latest:         group.Latest,
+			EmailIDs:       make([]string, 0, len(group.Messages)),
+			HasAttachments: group.HasAttachments,
+		}
+		for _, m := range group.Messages {
+			thread.EmailIDs = append(thread.EmailIDs, m.ID)
+			if !m.IsRead {
+				thread.UnreadCount++
+			}
+		}
+		thread.Status, thread.SnoozedUntil = threadStatus(group.Messages)
+		result[string(thread.Status)] = append(result[string(thread.Status)], thread)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// threadStatus picks the column of a thread card from its messages (oldest first): the status
+// of the message that changed column last, so moving any message of a thread moves the card.
+// When none ever moved, the latest message's status is used. Emails without a status are in
+// the inbox.
+func threadStatus(messages []threadMessage) (models.EmailStatus, *time.Time) {
+	if len(messages) == 0 {
+		return models.StatusInbox, nil
+	}
+	picked := messages[len(messages)-1]
+	var movedAt time.Time
+	for _, m := range messages {
+		// >= so a later message wins ties
+		if m.StatusChangedAt != nil && !m.StatusChangedAt.Before(movedAt) {
+			picked, movedAt = m, *m.StatusChangedAt
+		}
+	}
+	status := picked.Status
+	if status == "" {
+		status = models.StatusInbox
+	}
+	var snoozedUntil *time.Time
+	if status == models.StatusSnoozed {
+		snoozedUntil = picked.SnoozedUntil
+	}
+	return status, snoozedUntil
+}
+
+// ThreadEmailIDs returns the board messages of the thread of one of userID's emails, oldest
+// first; just emailID when it has no thread. mongo.ErrNoDocuments when userID has no such email.
+func (r *EmailRepository) ThreadEmailIDs(ctx context.Context, userID, emailID string) ([]string, error) {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	var email models.Email
+	opts := options.FindOne().SetProjection(bson.M{"threadId": 1})
+	if err := r.emailCollection.FindOne(ctx, filter, opts).Decode(&email); err != nil {
+		return nil, err
+	}
+	if email.ThreadID == "" {
+		return []string{email.ID}, nil
+	}
+
+	threadFilter := kanbanFilter(userID, nil, nil, nil)
+	threadFilter["threadId"] = email.ThreadID
+	findOpts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "receivedAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.emailCollection.Find(ctx, threadFilter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := []string{}
+	for cursor.Next(ctx) {
+		var e models.Email
+		if err := cursor.Decode(&e); err != nil {
+			return nil, err
+		}
+		ids = append(ids, e.ID)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		// the email itself is off the board (trashed, skipped); move it alone
+		ids = append(ids, email.ID)
+	}
+	return ids, nil
+}
+
+// CountByStatus returns the number of board cards per status for a user, using the same
+// visibility rules as GetKanban. Emails without a status are counted as inbox.
+func (r *EmailRepository) CountByStatus(ctx context.Context, userID string) (map[string]int, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":     userID,
+			"labels":     bson.M{"$ne": "TRASH"},
+			"mailboxId":  bson.M{"$ne": "TRASH"},
+			"deletedAt":  nil,
+			"skipBoard":  bson.M{"$ne": true},
+			"archivedAt": nil,
+		}},
+		{"$group": bson.M{
+			"_id":   "$status",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Status string `bson:"_id"`
+			Count  int    `bson:"count"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		key := doc.Status
+		if key == "" {
+			key = string(models.StatusInbox)
+		}
+		counts[key] += doc.Count
+	}
+	return counts, cursor.Err()
+}
+
+// ListUnsummarized returns up to limit visible cards in a column (status) that have no summary yet,
+// newest first. The inbox column also matches emails without a status.
+func (r *EmailRepository) ListUnsummarized(ctx context.Context, userID string, status string, limit int) ([]models.Email, error) {
+	filter := bson.M{
+		"userId":     userID,
+		"summary":    bson.M{"$in": []interface{}{nil, ""}},
+		"labels":     bson.M{"$ne": "TRASH"},
+		"mailboxId":  bson.M{"$ne": "TRASH"},
+		"deletedAt":  nil,
+		"skipBoard":  bson.M{"$ne": true},
+		"archivedAt": nil,
+	}
+	if status == string(models.StatusInbox) {
+		filter["status"] = bson.M{"$in": []interface{}{nil, "", status}}
+	} else {
+		filter["status"] = status
+	}
+
+	findOptions := options.Find().SetSort(keysetSort).SetLimit(int64(limit))
+	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []models.Email
+	if err = cursor.All(ctx, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// SearchMode picks how local search matches a query
+type SearchMode string
+
+const (
+	// SearchModeAuto uses the text index, falling back to the regex for queries shorter than
+	// 3 characters or when the index finds nothing (partial words, missing accents)
+	SearchModeAuto SearchMode = "auto"
+	// SearchModeText only uses the text index: whole words, ranked by textScore
+	SearchModeText SearchMode = "text"
+	// SearchModeRegex scans with the accent-insensitive regex: substrings, newest first
+	SearchModeRegex SearchMode = "regex"
+)
+
+// DefaultSearchLimit is the local search page size when callers pass 0
+const DefaultSearchLimit = 50
+
+// SearchEmails searches userID's emails in subject, sender, summary and body with the given
+// mode and returns one page (skip, then at most limit emails) plus the number of matches.
+// Text results are ordered by relevance (textScore, so subject hits rank above sender,
+// summary and body hits), regex results newest first. The regex is an unindexed scan of the
+// user's emails; auto mode only uses it as a fallback.
+func (r *EmailRepository) SearchEmails(ctx context.Context, userID string, query string, mode SearchMode, filters *models.SearchFilters, limit, skip int) ([]models.Email, int64, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	if mode == SearchModeAuto || mode == "" {
+		if utf8.RuneCountInString(query) >= 3 {
+			emails, total, err := r.searchEmails(ctx, userID, query, SearchModeText, filters, limit, skip)
+			if err != nil || total > 0 {
+				return emails, total, err
+			}
+		}
+		mode = SearchModeRegex
+	}
+	return r.searchEmails(ctx, userID, query, mode, filters, limit, skip)
+}
+
+func (r *EmailRepository) searchEmails(ctx context.Context, userID, query string, mode SearchMode, filters *models.SearchFilters, limit, skip int) ([]models.Email, int64, error) {
+	filter := bson.M{"$and": searchClauses(userID, query, "", mode, filters)}
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"embedding": 0, "embeddingChunks": 0}).
+		SetSort(keysetSort).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+	if mode == SearchModeText {
+		findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}, "embedding": 0, "embeddingChunks": 0})
+		findOptions.SetSort(bson.D{
+			{Key: "score", Value: bson.M{"$meta": "textScore"}},
+			{Key: "receivedAt", Value: -1},
+			{Key: "_id", Value: -1},
+		})
+	}
+
+	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	emails := []models.Email{}
+	if err = cursor.All(ctx, &emails); err != nil {
+		return nil, 0, err
+	}
+
+	// a short page ends the results, so only full (or past-the-end) pages need a count
+	total := int64(skip + len(emails))
+	if len(emails) == limit || (len(emails) == 0 && skip > 0) {
+		if total, err = r.emailCollection.CountDocuments(ctx, filter); err != nil {
+			return nil, 0, err
+		}
+	}
+	return emails, total, nil
+}
+
+// searchClauses are the conditions of a local search: the user's visible emails, of category
+// when set, passing filters, matching query the way mode does
+func searchClauses(userID, query string, category models.EmailCategory, mode SearchMode, filters *models.SearchFilters) []bson.M {
+	clauses := []bson.M{{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}}
+	if category != "" {
+		clauses = append(clauses, bson.M{"category": category})
+	}
+	clauses = append(clauses, searchFilterClauses(filters)...)
+	if mode == SearchModeText {
+		return append(clauses, bson.M{"$text": bson.M{"$search": query}})
+	}
+	regex := bson.M{"$regex": utils.GenerateRelaxedRegex(query), "$options": "i"}
+	return append(clauses, bson.M{"$or": []bson.M{
+		{"subject": regex},
+		{"from.name": regex},
+		{"from.email": regex},
+		{"summary": regex},
+		{"body": regex},
+	}})
+}
+
+// FuzzyCandidates returns userID's visible emails whose subject or summary shares trigrams
+// with grams (see utils.WordTrigrams), most shared trigrams first, then newest first, at most
+// limit. It only shortlists: callers still check the edit distance against SubjectNormalized
+// and SummaryNormalized. Bodies and embeddings are not loaded.
+func (r *EmailRepository) FuzzyCandidates(ctx context.Context, userID string, grams []string, category models.EmailCategory, filters *models.SearchFilters, limit int) ([]models.Email, error) {
+	if len(grams) == 0 {
+		return []models.Email{}, nil
+	}
+	clauses := []bson.M{{
+		"userId": userID,
+		"$or": []bson.M{
+			{"subjectGrams": bson.M{"$in": grams}},
+			{"summaryGrams": bson.M{"$in": grams}},
+		},
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}}
+	if category != "" {
+		clauses = append(clauses, bson.M{"category": category})
+	}
+	clauses = append(clauses, searchFilterClauses(filters)...)
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"$and": clauses}},
+		{"$addFields": bson.M{"gramOverlap": bson.M{"$size": bson.M{"$setIntersection": []interface{}{
+			bson.M{"$setUnion": []interface{}{
+				bson.M{"$ifNull": []interface{}{"$subjectGrams", bson.A{}}},
+				bson.M{"$ifNull": []interface{}{"$summaryGrams", bson.A{}}},
+			}},
+			grams,
+		}}}}},
+		{"$sort": bson.D{{Key: "gramOverlap", Value: -1}, {Key: "receivedAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{"$limit": limit},
+		{"$project": bson.M{"body": 0, "embedding": 0, "embeddingChunks": 0, "subjectGrams": 0, "summaryGrams": 0, "gramOverlap": 0}},
+	}
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.Email{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BackfillSearchGrams writes the normalized subject and summary and their trigrams on up to
+// limit emails stored before they existed, and returns how many it updated
+func (r *EmailRepository) BackfillSearchGrams(ctx context.Context, limit int) (int, error) {
+	opts := options.Find().SetLimit(int64(limit)).SetProjection(bson.M{"subject": 1, "summary": 1})
+	filter := bson.M{"$or": []bson.M{
+		{"subjectNormalized": bson.M{"$exists": false}},
+		{"summary": bson.M{"$nin": []interface{}{nil, ""}}, "summaryNormalized": bson.M{"$exists": false}},
+	}}
+	cursor, err := r.emailCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	var docs []struct {
+		ID      interface{} `bson:"_id"`
+		Subject string      `bson:"subject"`
+		Summary string      `bson:"summary"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	operations := make([]mongo.WriteModel, len(docs))
+	for i, doc := range docs {
+		set := summaryGramsSet(doc.Summary)
+		set["subjectNormalized"], set["subjectGrams"] = searchGrams(doc.Subject)
+		operations[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": set})
+	}
+	if _, err := r.emailCollection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
+
+// SearchEmailsPage is the cursor-paginated local search, ordered by (receivedAt desc, _id desc)
+// so pages stay stable while new mail is inserted. The first page uses the text index (falling
+// back to the relaxed-accent regex for short queries or no text hits); later pages reuse the
+// mode encoded in the cursor. Returns the next cursor, or "" when there are no more results,
+// and the number of matches over all pages.
+func (r *EmailRepository) SearchEmailsPage(ctx context.Context, userID string, query string, category models.EmailCategory, filters *models.SearchFilters, cursor string, limit int) ([]models.Email, string, int64, error) {
+	after, err := DecodeEmailCursor(cursor)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	mode := SearchModeRegex
+	if utf8.RuneCountInString(query) >= 3 {
+		mode = SearchModeText
+	}
+	if after != nil && after.Mode != "" {
+		mode = SearchMode(after.Mode)
+	}
+
+	emails, next, total, err := r.searchPage(ctx, userID, query, category, filters, mode, after, limit)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if mode == SearchModeText && after == nil && len(emails) == 0 {
+		return r.searchPage(ctx, userID, query, category, filters, SearchModeRegex, nil, limit)
+	}
+	return emails, next, total, nil
+}
+
+func (r *EmailRepository) searchPage(ctx context.Context, userID, query string, category models.EmailCategory, filters *models.SearchFilters, mode SearchMode, after *EmailCursor, limit int) ([]models.Email, string, int64, error) {
+	clauses := searchClauses(userID, query, category, mode, filters)
+	total, err := r.emailCollection.CountDocuments(ctx, bson.M{"$and": clauses})
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if after != nil {
+		clauses = append(clauses, afterCursorFilter(after))
+	}
+
+	// fetch one extra document to know whether another page exists
+	findOptions := options.Find().SetSort(keysetSort).SetLimit(int64(limit + 1))
+	cursor, err := r.emailCollection.Find(ctx, bson.M{"$and": clauses}, findOptions)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []models.Email
+	if err = cursor.All(ctx, &emails); err != nil {
+		return nil, "", 0, err
+	}
+
+	next := ""
+	if len(emails) > limit {
+		emails = emails[:limit]
+		next = cursorFor(&emails[limit-1], string(mode))
+	}
+	return emails, next, total, nil
+}
+
+// searchFilterClauses turns search filters into query clauses
+func searchFilterClauses(f *models.SearchFilters) []bson.M {
+	if f == nil {
+		return nil
+	}
+	var clauses []bson.M
+	received := bson.M{}
+	if f.DateFrom != nil {
+		received["$gte"] = *f.DateFrom
+	}
+	if f.DateTo != nil {
+		received["$lt"] = *f.DateTo
+	}
+	if len(received) > 0 {
+		clauses = append(clauses, bson.M{"receivedAt": received})
+	}
+	if sender := strings.TrimSpace(f.Sender); sender != "" {
+		regex := bson.M{"$regex": regexp.QuoteMeta(sender), "$options": "i"}
+		clauses = append(clauses, bson.M{"$or": []bson.M{{"from.email": regex}, {"from.name": regex}}})
+	}
+	if f.Label != "" {
+		clauses = append(clauses, bson.M{"labels": f.Label})
+	}
+	if f.HasAttachment != nil {
+		clauses = append(clauses, bson.M{"hasAttachments": *f.HasAttachment})
+	}
+	if f.Status != "" {
+		clauses = append(clauses, statusFilter(f.Status))
+	}
+	if f.MailboxID != "" {
+		clauses = append(clauses, bson.M{"$or": []bson.M{{"mailboxId": f.MailboxID}, {"labels": f.MailboxID}}})
+	}
+	if f.IsRead != nil {
+		clauses = append(clauses, bson.M{"isRead": *f.IsRead})
+	}
+	return clauses
+}
+
+// KeywordSearch returns up to limit of userID's emails matching query, most relevant first.
+// The text index ranks by text score; short queries, or queries the index finds nothing for,
+// use the relaxed-accent regex with the newest first and no score.
+func (r *EmailRepository) KeywordSearch(ctx context.Context, userID, query string, filters *models.SearchFilters, limit int) ([]models.ScoredEmail, error) {
+	base := append([]bson.M{{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}}, searchFilterClauses(filters)...)
+
+	results := []models.ScoredEmail{}
+	if utf8.RuneCountInString(query) >= 3 {
+		clauses := append(append([]bson.M{}, base...), bson.M{"$text": bson.M{"$search": query}})
+		findOptions := options.Find().
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}, "embedding": 0, "embeddingChunks": 0}).
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}).
+			SetLimit(int64(limit))
+		cursor, err := r.emailCollection.Find(ctx, bson.M{"$and": clauses}, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		if err := cursor.All(ctx, &results); err != nil {
+			return nil, err
+		}
+		if len(results) > 0 {
+			return results, nil
+		}
+	}
+
+	regex := bson.M{"$regex": utils.GenerateRelaxedRegex(query), "$options": "i"}
+	clauses := append(base, bson.M{"$or": []bson.M{
+		{"subject": regex},
+		{"from.name": regex},
+		{"from.email": regex},
+		{"summary": regex},
+		{"body": regex},
+	}})
+	findOptions := options.Find().
+		SetProjection(bson.M{"embedding": 0, "embeddingChunks": 0}).
+		SetSort(keysetSort).
+		SetLimit(int64(limit))
+	cursor, err := r.emailCollection.Find(ctx, bson.M{"$and": clauses}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// UpdateStatus updates the workflow status for an email
+func (r *EmailRepository) UpdateStatus(ctx context.Context, emailID string, status string) error {
+	filter := idFilter(emailID)
+	update := bson.M{"$set": statusSet(status)}
+	// if moving out of snoozed, clear snoozedUntil
+	if status != string(models.StatusSnoozed) {
+		update = bson.M{"$set": statusSet(status), "$unset": clearSnooze()}
+	}
+	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// statusSet is the $set of a move to status. statusChangedAt tells which message of a thread
+// moved last (see GetKanbanThreads); a move also takes an archived card back onto the board.
+func statusSet(status string) bson.M {
+	return bson.M{"status": status, "statusChangedAt": time.Now(), "archivedAt": nil}
+}
+
+// clearSnooze is the $unset of a card's snooze: its due time, preset and recurrence
+func clearSnooze() bson.M {
+	return bson.M{"snoozedUntil": "", "snoozePreset": "", "snoozeRecurrence": ""}
+}
+
+// statusFilter matches emails in the status column; emails never moved are in the inbox
+func statusFilter(status string) bson.M {
+	if status == string(models.StatusInbox) {
+		return bson.M{"status": bson.M{"$in": []interface{}{nil, "", status}}}
+	}
+	return bson.M{"status": status}
+}
+
+// CountInStatus counts userID's visible emails in the status column, not counting exceptIDs
+func (r *EmailRepository) CountInStatus(ctx context.Context, userID, status string, exceptIDs ...string) (int64, error) {
+	if exceptIDs == nil {
+		exceptIDs = []string{}
+	}
+	filter := bson.M{
+		"$and": []bson.M{
+			{"userId": userID},
+			statusFilter(status),
+			{"_id": bson.M{"$nin": exceptIDs}},
+			{"labels": bson.M{"$ne": "TRASH"}},
+			{"mailboxId": bson.M{"$ne": "TRASH"}},
+			{"deletedAt": nil},
+			{"skipBoard": bson.M{"$ne": true}},
+			{"archivedAt": nil},
+		},
+	}
+	return r.emailCollection.CountDocuments(ctx, filter)
+}
+
+// MoveStatus sets the status of one of userID's emails like UpdateStatus and returns the
+// email's previous status and snoozedUntil; mongo.ErrNoDocuments when userID has no such email
+func (r *EmailRepository) MoveStatus(ctx context.Context, userID, emailID string, status string) (*models.Email, error) {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	update := bson.M{"$set": statusSet(status)}
+	if status != string(models.StatusSnoozed) {
+		update = bson.M{"$set": statusSet(status), "$unset": clearSnooze()}
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"status": 1, "snoozedUntil": 1})
+	var previous models.Email
+	if err := r.emailCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous); err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// RestoreStatus puts one of userID's emails back in status, with snoozedUntil (nil clears
+// it); mongo.ErrNoDocuments when userID has no such email
+func (r *EmailRepository) RestoreStatus(ctx context.Context, userID, emailID string, status string, snoozedUntil *time.Time) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	update := bson.M{"$set": statusSet(status), "$unset": clearSnooze()}
+	if snoozedUntil != nil {
+		update = bson.M{
+			"$set":   bson.M{"status": status, "snoozedUntil": *snoozedUntil, "statusChangedAt": time.Now()},
+			"$unset": bson.M{"snoozePreset": "", "snoozeRecurrence": ""},
+		}
+	}
+	res, err := r.emailCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// BulkSetStatus moves userID's emails to status in one unordered BulkWrite. snoozedUntil is
+// stored when status is snoozed; moving anywhere else clears it. Emails whose update failed
+// are returned with their error; the error is for the write as a whole.
+func (r *EmailRepository) BulkSetStatus(ctx context.Context, userID string, emailIDs []string, status string, snoozedUntil *time.Time) (map[string]error, error) {
+	update := bson.M{"$set": statusSet(status), "$unset": clearSnooze()}
+	if status == string(models.StatusSnoozed) && snoozedUntil != nil {
+		update = bson.M{
+			"$set":   bson.M{"status": status, "snoozedUntil": *snoozedUntil, "statusChangedAt": time.Now()},
+			"$unset": bson.M{"snoozePreset": "", "snoozeRecurrence": ""},
+		}
+	}
+	return r.bulkUpdate(ctx, userID, emailIDs, update)
+}
+
+// ErrInvalidReassignment is returned by ReassignStatus for a target emails can't be moved to
+var ErrInvalidReassignment = errors.New("invalid column reassignment")
+
+// ReassignStatus moves every one of userID's emails in column from to column to, for a
+// column that is deleted or whose key changes, and returns how many moved. Snoozed is not a
+// valid target (it needs a wake-up time), and from and to must differ.
+func (r *EmailRepository) ReassignStatus(ctx context.Context, userID, from, to string) (int64, error) {
+	switch {
+	case from == "" || to == "":
+		return 0, fmt.Errorf("%w: both column keys are required", ErrInvalidReassignment)
+	case from == to:
+		return 0, fmt.Errorf("%w: the target is the same column", ErrInvalidReassignment)
+	case to == string(models.StatusSnoozed):
+		return 0, fmt.Errorf("%w: emails can't be moved to snoozed in bulk", ErrInvalidReassignment)
+	}
+	filter := statusFilter(from)
+	filter["userId"] = userID
+	res, err := r.emailCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": to}, "$unset": clearSnooze()})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// BulkRemoveLabel removes label from userID's cached emails like RemoveLabel, in one
+// BulkWrite; see BulkSetStatus for the results
+func (r *EmailRepository) BulkRemoveLabel(ctx context.Context, userID string, emailIDs []string, label string) (map[string]error, error) {
+	return r.bulkUpdate(ctx, userID, emailIDs, bson.M{"$pull": bson.M{"labels": label}})
+}
+
+// BulkModifyLabels adds and removes labels on userID's cached emails in one BulkWrite, keeping
+// isRead and isStarred in step with UNREAD and STARRED. Emails that aren't cached are left to
+// the next sync. See BulkSetStatus for the results.
+func (r *EmailRepository) BulkModifyLabels(ctx context.Context, userID string, emailIDs []string, addLabels, removeLabels []string) (map[string]error, error) {
+	if addLabels == nil {
+		addLabels = []string{}
+	}
+	if removeLabels == nil {
+		removeLabels = []string{}
+	}
+	// A pipeline update, since $addToSet and $pull can't touch the same field in one update
+	set := bson.M{"labels": bson.M{"$setUnion": bson.A{
+		bson.M{"$setDifference": bson.A{bson.M{"$ifNull": bson.A{"$labels", bson.A{}}}, removeLabels}},
+		addLabels,
+	}}}
+	for _, label := range addLabels {
+		switch label {
+		case "UNREAD":
+			set["isRead"] = false
+		case "STARRED":
+			set["isStarred"] = true
+		}
+	}
+	for _, label := range removeLabels {
+		switch label {
+		case "UNREAD":
+			set["isRead"] = true
+		case "STARRED":
+			set["isStarred"] = false
+		}
+	}
+	return r.bulkUpdate(ctx, userID, emailIDs, bson.A{bson.M{"$set": set}})
+}
+
+// bulkUpdate applies update (a document or a pipeline) to each of userID's emails with an
+// unordered BulkWrite and maps the per-write errors back to email IDs
+func (r *EmailRepository) bulkUpdate(ctx context.Context, userID string, emailIDs []string, update interface{}) (map[string]error, error) {
+	failed := map[string]error{}
+	if len(emailIDs) == 0 {
+		return failed, nil
+	}
+	operations := make([]mongo.WriteModel, len(emailIDs))
+	for i, id := range emailIDs {
+		filter := idFilter(id)
+		filter["userId"] = userID
+		operations[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+	}
+	_, err := r.emailCollection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Index < len(emailIDs) {
+				failed[emailIDs[writeErr.Index]] = errors.New(writeErr.Message)
+			}
+		}
+		return failed, nil
+	}
+	return failed, err
+}
+
+// SetSnooze snoozes one of userID's emails until the given time, recording the preset and
+// recurrence (empty clears them), and returns its previous status and snoozedUntil;
+// mongo.ErrNoDocuments when userID has no such email
+func (r *EmailRepository) SetSnooze(ctx context.Context, userID, emailID string, until time.Time, preset models.SnoozePreset, recurrence models.SnoozeRecurrence) (*models.Email, error) {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	set := bson.M{"status": string(models.StatusSnoozed), "snoozedUntil": until, "statusChangedAt": time.Now()}
+	unset := bson.M{}
+	if preset != "" {
+		set["snoozePreset"] = preset
+	} else {
+		unset["snoozePreset"] = ""
+	}
+	if recurrence != "" {
+		set["snoozeRecurrence"] = recurrence
+	} else {
+		unset["snoozeRecurrence"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"status": 1, "snoozedUntil": 1})
+	var previous models.Email
+	if err := r.emailCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous); err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// SetSummary stores a generated summary for an email along with the language and length it was generated with
+func (r *EmailRepository) SetSummary(ctx context.Context, emailID string, summary, language, length string) error {
+	filter := idFilter(emailID)
+	set := summaryGramsSet(summary)
+	set["summary"], set["summaryLanguage"], set["summaryLength"] = summary, language, length
+	_, err := r.emailCollection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	return err
+}
+
+// searchGrams returns text lower-cased without accents and its word trigrams, as stored for
+// the typo-tolerant fallback search
+func searchGrams(text string) (string, []string) {
+	normalized := utils.NormalizeSearchText(text)
+	return normalized, utils.WordTrigrams(utils.SearchWords(normalized))
+}
+
+// summaryGramsSet is the $set of the search fields derived from summary (markup stripped)
+func summaryGramsSet(summary string) bson.M {
+	normalized, grams := searchGrams(utils.SanitizeHTML(summary))
+	return bson.M{"summaryNormalized": normalized, "summaryGrams": grams}
+}
+
+// SetActionItems stores the action items extracted from an email
+func (r *EmailRepository) SetActionItems(ctx context.Context, emailID string, items []models.ActionItem) error {
+	filter := idFilter(emailID)
+	update := bson.M{"$set": bson.M{"actionItems": items}}
+	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// GetByID returns an email by its ID (supports string IDs and ObjectID hex)
+func (r *EmailRepository) GetByID(ctx context.Context, emailID string) (*models.Email, error) {
+	filter := idFilter(emailID)
+	var email models.Email
+	if err := r.emailCollection.FindOne(ctx, filter).Decode(&email); err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// Touch records that userID opened the email so retention cleanup keeps it. Emails not
+// cached locally are ignored.
+func (r *EmailRepository) Touch(ctx context.Context, userID, emailID string) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	update := bson.M{"$set": bson.M{"lastAccessedAt": time.Now()}}
+	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// GetOwned returns one of userID's visible emails without its body and embeddings, or
+// mongo.ErrNoDocuments
+func (r *EmailRepository) GetOwned(ctx context.Context, userID, emailID string) (*models.Email, error) {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	filter["deletedAt"] = nil
+	opts := options.FindOne().SetProjection(bson.M{"body": 0, "embedding": 0, "embeddingChunks": 0, "subjectGrams": 0, "summaryGrams": 0})
+	var email models.Email
+	if err := r.emailCollection.FindOne(ctx, filter, opts).Decode(&email); err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// GetByThreadID returns a user's stored messages of a thread, oldest first
+func (r *EmailRepository) GetByThreadID(ctx context.Context, userID, threadID string) ([]models.Email, error) {
+	filter := bson.M{"userId": userID, "threadId": threadID, "deletedAt": nil}
+	opts := options.Find().SetSort(bson.D{{Key: "receivedAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.emailCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []models.Email
+	if err := cursor.All(ctx, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// Resnooze moves a due recurring snooze to next. It does nothing when the email is no longer
+// snoozed until due (the user moved or re-snoozed it meanwhile); mongo.ErrNoDocuments then.
+func (r *EmailRepository) Resnooze(ctx context.Context, emailID string, due, next time.Time) error {
+	filter := idFilter(emailID)
+	filter["status"] = string(models.StatusSnoozed)
+	filter["snoozedUntil"] = due
+	res, err := r.emailCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"snoozedUntil": next}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ListSnoozedDue returns snoozed emails that are due (snoozedUntil <= now)
+func (r *EmailRepository) ListSnoozedDue(ctx context.Context, now time.Time) ([]models.Email, error) {
+	filter := bson.M{"status": string(models.StatusSnoozed), "snoozedUntil": bson.M{"$lte": now}}
+	cursor, err := r.emailCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []models.Email
+	for cursor.Next(ctx) {
+		var e models.Email
+		if err := cursor.Decode(&e); err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+func (r *EmailRepository) GetMailboxes(ctx context.Context, userID string) ([]*models.Mailbox, error) {
+	cursor, err := r.mailboxCollection.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var mailboxes []*models.Mailbox
+	if err = cursor.All(ctx, &mailboxes); err != nil {
+		return nil, err
+	}
+
+	return mailboxes, nil
+}
+
+func (r *EmailRepository) GetEmails(ctx context.Context, mailboxID string, page, perPage int) ([]*models.Email, int, error) {
+	skip := (page - 1) * perPage
+
+	findOptions := options.Find()
+	findOptions.SetSkip(int64(skip))
+	findOptions.SetLimit(int64(perPage))
+	findOptions.SetSort(keysetSort)
+
+	filter := bson.M{"mailboxId": mailboxID}
+
+	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []*models.Email
+	if err = cursor.All(ctx, &emails); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := r.emailCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return emails, int(total), nil
+}
+
+// GetEmailsPage is the cursor-paginated variant of GetEmails, ordered by (receivedAt desc, _id desc).
+// Returns the next cursor, or "" on the last page.
+func (r *EmailRepository) GetEmailsPage(ctx context.Context, mailboxID string, cursor string, limit int) ([]*models.Email, string, error) {
+	after, err := DecodeEmailCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+
+	filter := bson.M{"mailboxId": mailboxID}
+	if after != nil {
+		filter = bson.M{"$and": []bson.M{filter, afterCursorFilter(after)}}
+	}
+
+	findOptions := options.Find().SetSort(keysetSort).SetLimit(int64(limit + 1))
+	cur, err := r.emailCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+
+	var emails []*models.Email
+	if err = cur.All(ctx, &emails); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(emails) > limit {
+		emails = emails[:limit]
+		next = cursorFor(emails[limit-1], "")
+	}
+	return emails, next, nil
+}
+
+func (r *EmailRepository) GetEmailByID(ctx context.Context, emailID string) (*models.Email, error) {
+	oid, err := primitive.ObjectIDFromHex(emailID)
+	if err != nil {
+		return nil, err
+	}
+
+	var email models.Email
+	err = r.emailCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &email, nil
+}
+
+func (r *EmailRepository) CreateEmail(ctx context.Context, email *models.Email) error {
+	_, err := r.emailCollection.InsertOne(ctx, email)
+	return err
+}
+
+func (r *EmailRepository) CreateMailbox(ctx context.Context, mailbox *models.Mailbox) error {
+	_, err := r.mailboxCollection.InsertOne(ctx, mailbox)
+	return err
+}
+
+func (r *EmailRepository) GetMailboxByID(ctx context.Context, mailboxID string) (*models.Mailbox, error) {
+	var mailbox models.Mailbox
+	err := r.mailboxCollection.FindOne(ctx, bson.M{"id": mailboxID}).Decode(&mailbox)
+	if err != nil {
+		return nil, err
+	}
+	return &mailbox, nil
+}
+
+func (r *EmailRepository) UpdateMailboxUnreadCount(ctx context.Context, mailboxID string, count int) error {
+	update := bson.M{
+		"$set": bson.M{
+			"unreadCount": count,
+		},
+	}
+	_, err := r.mailboxCollection.UpdateOne(ctx, bson.M{"id": mailboxID}, update)
+	return err
+}
+
+// UpsertFromGmail stores a message fetched from Gmail. See BulkUpsertFromGmail.
+func (r *EmailRepository) UpsertFromGmail(ctx context.Context, email *models.Email) error {
+	return r.BulkUpsertFromGmail(ctx, []*models.Email{email})
+}
+
+// staleDeleteBatch is how many emails DeleteStale removes per query
+const staleDeleteBatch = 500
+
+// DeleteStale removes cached emails (and their embeddings and card activity) not accessed
+// since cutoff. User-curated cards survive: anything moved out of the inbox, summarized,
+// snoozed or annotated with a note is kept. Documents without lastAccessedAt (cached before
+// retention existed) fall back to receivedAt.
+func (r *EmailRepository) DeleteStale(ctx context.Context, cutoff time.Time) (int64, error) {
+	filter := bson.M{
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"lastAccessedAt": bson.M{"$lt": cutoff}},
+				{"lastAccessedAt": bson.M{"$exists": false}, "receivedAt": bson.M{"$lt": cutoff}},
+			}},
+			{"status": bson.M{"$in": []interface{}{nil, "", string(models.StatusInbox)}}},
+			{"summary": bson.M{"$in": []interface{}{nil, ""}}},
+			{"snoozedUntil": nil},
+		},
+	}
+	cursor, err := r.emailCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var deleted int64
+	batch := make([]string, 0, staleDeleteBatch)
+	flush := func() error {
+		n, err := r.deleteUnannotated(ctx, batch)
+		deleted += n
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return deleted, err
+		}
+		batch = append(batch, doc.ID)
+		if len(batch) == staleDeleteBatch {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return deleted, err
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteUnannotated removes the emails of emailIDs that have no card notes, and their
+// card activity
+func (r *EmailRepository) deleteUnannotated(ctx context.Context, emailIDs []string) (int64, error) {
+	noted, err := r.cardNoteCollection.Distinct(ctx, "emailId", bson.M{"emailId": bson.M{"$in": emailIDs}})
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[string]bool, len(noted))
+	for _, id := range noted {
+		if s, ok := id.(string); ok {
+			keep[s] = true
+		}
+	}
+	ids := make([]string, 0, len(emailIDs))
+	for _, id := range emailIDs {
+		if !keep[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res, err := r.emailCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.cardActivityCollection.DeleteMany(ctx, bson.M{"emailId": bson.M{"$in": ids}})
+	return res.DeletedCount, err
+}
+
+// ListRecent returns userID's latest visible emails, newest first, without bodies and
+// embeddings
+func (r *EmailRepository) ListRecent(ctx context.Context, userID string, limit int) ([]models.Email, error) {
+	filter := bson.M{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "receivedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"body": 0, "embedding": 0, "embeddingChunks": 0, "subjectGrams": 0, "summaryGrams": 0})
+	cursor, err := r.emailCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	emails := []models.Email{}
+	if err := cursor.All(ctx, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// DeleteByIDs removes a user's emails (e.g. permanently deleted in Gmail) with their card
+// notes and activity
+func (r *EmailRepository) DeleteByIDs(ctx context.Context, userID string, emailIDs []string) (int64, error) {
+	if len(emailIDs) == 0 {
+		return 0, nil
+	}
+	res, err := r.emailCollection.DeleteMany(ctx, bson.M{"userId": userID, "_id": bson.M{"$in": emailIDs}})
+	if err != nil {
+		return 0, err
+	}
+	cardFilter := bson.M{"userId": userID, "emailId": bson.M{"$in": emailIDs}}
+	if _, err := r.cardNoteCollection.DeleteMany(ctx, cardFilter); err != nil {
+		return res.DeletedCount, err
+	}
+	if _, err := r.cardActivityCollection.DeleteMany(ctx, cardFilter); err != nil {
+		return res.DeletedCount, err
+	}
+	return res.DeletedCount, nil
+}
+
+// GetByIDs returns the stored emails for the given IDs keyed by ID (missing IDs are absent)
+func (r *EmailRepository) GetByIDs(ctx context.Context, emailIDs []string) (map[string]models.Email, error) {
+	result := make(map[string]models.Email, len(emailIDs))
+	if len(emailIDs) == 0 {
+		return result, nil
+	}
+
+	cursor, err := r.emailCollection.Find(ctx, bson.M{"_id": bson.M{"$in": emailIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var e models.Email
+		if err := cursor.Decode(&e); err != nil {
+			return nil, err
+		}
+		result[e.ID] = e
+	}
+	return result, cursor.Err()
+}
+
+// BulkUpsertFromGmail stores messages fetched from Gmail in one ordered BulkWrite. Only
+// Gmail-sourced fields are $set; status (e.Status as set by rules, else inbox), createdAt
+// and the snooze and board placement of a Kanban rule are $setOnInsert, and every other user-owned field (snooze, summary, action
+// items, embedding, ...) is left untouched, so callers never need to read the stored copy
+// first. Per email the ops are:
+//  1. if the stored copy was in TRASH and Gmail no longer is, clear deletedAt (untrash)
+//  2. if the subject, body or preview changed, flag the embedding stale
+//  3. the upsert itself
+//  4. if Gmail has it in TRASH, set deletedAt unless already set (keeps the original time)
+//  5. store e.Priority when set and the stored copy has none
+//  6. likewise e.Category and e.Security
+//
+// A board-only soft delete (deletedAt without the TRASH label) survives re-syncs.
+func (r *EmailRepository) BulkUpsertFromGmail(ctx context.Context, emails []*models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	operations := make([]mongo.WriteModel, 0, 2*len(emails))
+	for _, e := range emails {
+		trashed := e.HasLabel("TRASH")
+		if !trashed {
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": e.ID, "labels": "TRASH"}).
+				SetUpdate(bson.M{"$unset": bson.M{"deletedAt": ""}}))
+		}
+
+		// Changed content must be embedded again; the indexer compares hashes to skip no-ops
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": e.ID, "$or": []bson.M{
+				{"subject": bson.M{"$ne": e.Subject}},
+				{"body": bson.M{"$ne": e.Body}},
+				{"preview": bson.M{"$ne": e.Preview}},
+			}}).
+			SetUpdate(bson.M{
+				"$set":   bson.M{"embeddingStale": true},
+				"$unset": bson.M{"embeddingSkipped": ""},
+			}))
+
+		onInsert := bson.M{"status": e.Status, "createdAt": now}
+		if e.Status == "" {
+			onInsert["status"] = models.StatusInbox
+		}
+		// placed by a Kanban rule
+		if e.SnoozedUntil != nil {
+			onInsert["snoozedUntil"] = *e.SnoozedUntil
+		}
+		if e.KanbanRuleID != "" {
+			onInsert["kanbanRuleId"] = e.KanbanRuleID
+		}
+		if e.SkipBoard {
+			onInsert["skipBoard"] = true
+		}
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": e.ID}).
+			SetUpdate(bson.M{
+				"$set":         gmailFields(e, now),
+				"$setOnInsert": onInsert,
+			}).
+			SetUpsert(true))
+
+		if trashed {
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": e.ID, "deletedAt": nil}).
+				SetUpdate(bson.M{"$set": bson.M{"deletedAt": now}}))
+		}
+		if e.Priority != "" {
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": e.ID, "priority": bson.M{"$in": []interface{}{nil, ""}}}).
+				SetUpdate(bson.M{"$set": bson.M{"priority": e.Priority}}))
+		}
+		if e.Category != "" {
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": e.ID, "category": bson.M{"$in": []interface{}{nil, ""}}}).
+				SetUpdate(bson.M{"$set": bson.M{"category": e.Category}}))
+		}
+		if e.Security != nil {
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": e.ID, "security": nil}).
+				SetUpdate(bson.M{"$set": bson.M{"security": e.Security}}))
+		}
+	}
+
+	// Ordered: the untrash check must see the labels from before the upsert
+	_, err := r.emailCollection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(true))
+	return err
+}
+
+// gmailFields are the fields Gmail owns; a re-sync overwrites them
+func gmailFields(e *models.Email, now time.Time) bson.M {
+	set := bson.M{
+		"threadId":       e.ThreadID,
+		"mailboxId":      e.MailboxID,
+		"userId":         e.UserID,
+		"from":           e.From,
+		"to":             e.To,
+		"cc":             e.Cc,
+		"bcc":            e.Bcc,
+		"replyTo":        e.ReplyTo,
+		"subject":        e.Subject,
+		"preview":        e.Preview,
+		"body":           e.Body,
+		"labels":         e.Labels,
+		"isRead":         e.IsRead,
+		"isStarred":      e.IsStarred,
+		"hasAttachments": e.HasAttachments,
+		"attachments":    e.Attachments,
+		"inlineImages":   e.InlineImages,
+		"receivedAt":     e.ReceivedAt,
+		"gmailUrl":       e.GmailURL,
+		"isDraft":        e.IsDraft,
+		"lastAccessedAt": now,
+	}
+	// derived from the subject, so rewritten with it
+	set["subjectNormalized"], set["subjectGrams"] = searchGrams(e.Subject)
+	return set
+}
+
+// EmailEnrichment tells which sync-time analyses a stored email already has
+type EmailEnrichment struct {
+	Priority bool
+	Security bool
+	Category bool
+}
+
+// Enrichment returns, for the given emails that are stored, which analyses they have.
+// Emails that aren't stored are absent.
+func (r *EmailRepository) Enrichment(ctx context.Context, emailIDs []string) (map[string]EmailEnrichment, error) {
+	result := make(map[string]EmailEnrichment, len(emailIDs))
+	if len(emailIDs) == 0 {
+		return result, nil
+	}
+
+	projection := bson.M{"priority": 1, "category": 1, "security.riskLevel": 1}
+	cursor, err := r.emailCollection.Find(ctx, bson.M{"_id": bson.M{"$in": emailIDs}}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       string                   `bson:"_id"`
+			Priority models.EmailPriority     `bson:"priority"`
+			Category models.EmailCategory     `bson:"category"`
+			Security *models.SecurityAnalysis `bson:"security"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		result[doc.ID] = EmailEnrichment{
+			Priority: doc.Priority != "",
+			Security: doc.Security != nil,
+			Category: doc.Category != "",
+		}
 	}
+	return result, cursor.Err()
+}
 
-	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+// Categories returns the stored category of the given emails; uncategorized and unknown
+// emails are absent
+func (r *EmailRepository) Categories(ctx context.Context, emailIDs []string) (map[string]models.EmailCategory, error) {
+	result := make(map[string]models.EmailCategory, len(emailIDs))
+	if len(emailIDs) == 0 {
+		return result, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": emailIDs}, "category": bson.M{"$nin": []interface{}{nil, ""}}}
+	cursor, err := r.emailCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"category": 1}))
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	result := make(map[string][]models.Email)
 	for cursor.Next(ctx) {
-		var e models.Email
-		if err := cursor.Decode(&e); err != nil {
-			return nil, err
+		var doc struct {
+			ID       string               `bson:"_id"`
+			Category models.EmailCategory `bson:"category"`
 		}
-		key := string(e.Status)
-		if key == "" {
-			key = string(models.StatusInbox)
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
 		}
-		result[key] = append(result[key], e)
+		result[doc.ID] = doc.Category
 	}
-	if err := cursor.Err(); err != nil {
-		return nil, err
+	return result, cursor.Err()
+}
+
+// SetSecurity stores an email's phishing/spam analysis
+func (r *EmailRepository) SetSecurity(ctx context.Context, emailID string, analysis *models.SecurityAnalysis) error {
+	_, err := r.emailCollection.UpdateOne(ctx, idFilter(emailID), bson.M{"$set": bson.M{"security": analysis}})
+	return err
+}
+
+// ArchiveBefore archives userID's cards in the status column that entered it before cutoff
+// (were received before it when never moved) and returns how many were archived
+func (r *EmailRepository) ArchiveBefore(ctx context.Context, userID, status string, cutoff time.Time) (int64, error) {
+	filter := bson.M{"$and": []bson.M{
+		kanbanFilter(userID, nil, nil, nil),
+		statusFilter(status),
+		{"$or": []bson.M{
+			{"statusChangedAt": bson.M{"$lt": cutoff}},
+			{"statusChangedAt": nil, "receivedAt": bson.M{"$lt": cutoff}},
+		}},
+	}}
+	res, err := r.emailCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"archivedAt": time.Now()}})
+	if err != nil {
+		return 0, err
 	}
-	return result, nil
+	return res.ModifiedCount, nil
 }
 
-// SearchEmails searches for emails matching the query string in subject, sender, or summary.
-func (r *EmailRepository) SearchEmails(ctx context.Context, userID string, query string) ([]models.Email, error) {
-	// Fuzzy search using regex with case insensitivity
-	// We search in: subject, from.name, from.email, summary, body
-	// Use relaxed regex for accent insensitivity
-	pattern := utils.GenerateRelaxedRegex(query)
-	regex := bson.M{"$regex": pattern, "$options": "i"}
+// ListArchived is the cursor-paginated list of userID's archived cards, ordered by
+// (receivedAt desc, _id desc). Returns the next cursor, or "" on the last page.
+func (r *EmailRepository) ListArchived(ctx context.Context, userID, cursor string, limit int) ([]models.Email, string, error) {
+	after, err := DecodeEmailCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
 	filter := bson.M{
-		"userId": userID,
-		"$or": []bson.M{
-			{"subject": regex},
-			{"from.name": regex},
-			{"from.email": regex},
-			{"summary": regex},
-			{"body": regex},
-		},
-		"labels":    bson.M{"$ne": "TRASH"},
-		"mailboxId": bson.M{"$ne": "TRASH"},
+		"userId":     userID,
+		"archivedAt": bson.M{"$ne": nil},
+		"deletedAt":  nil,
+	}
+	if after != nil {
+		filter = bson.M{"$and": []bson.M{filter, afterCursorFilter(after)}}
 	}
 
-	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{Key: "receivedAt", Value: -1}})
-	findOptions.SetLimit(50) // Limit results for performance
-
-	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
+	opts := options.Find().
+		SetSort(keysetSort).
+		SetLimit(int64(limit + 1)).
+		SetProjection(bson.M{"body": 0, "embedding": 0, "embeddingChunks": 0, "subjectGrams": 0, "summaryGrams": 0})
+	cur, err := r.emailCollection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer cursor.Close(ctx)
+	defer cur.Close(ctx)
 
-	var emails []models.Email
-	if err = cursor.All(ctx, &emails); err != nil {
-		return nil, err
+	emails := []models.Email{}
+	if err = cur.All(ctx, &emails); err != nil {
+		return nil, "", err
 	}
 
-	return emails, nil
-}
-
-// UpdateStatus updates the workflow status for an email
-func (r *EmailRepository) UpdateStatus(ctx context.Context, emailID string, status string) error {
-	filter := idFilter(emailID)
-	update := bson.M{"$set": bson.M{"status": status}}
-	// if moving out of snoozed, clear snoozedUntil
-	if status != string(models.StatusSnoozed) {
-		update = bson.M{"$set": bson.M{"status": status}, "$unset": bson.M{"snoozedUntil": ""}}
+	next := ""
+	if len(emails) > limit {
+		emails = emails[:limit]
+		next = cursorFor(&emails[limit-1], "")
 	}
-	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
-	return err
-}
-
-// SetSnooze sets an email to snoozed with a snoozedUntil time
-func (r *EmailRepository) SetSnooze(ctx context.Context, emailID string, until time.Time) error {
-	filter := idFilter(emailID)
-	update := bson.M{"$set": bson.M{"status": string(models.StatusSnoozed), "snoozedUntil": until}}
-	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
-	return err
+	return emails, next, nil
 }
 
-// SetSummary stores a generated summary for an email
-func (r *EmailRepository) SetSummary(ctx context.Context, emailID string, summary string) error {
+// Unarchive puts one of userID's archived cards back in its column and returns it;
+// mongo.ErrNoDocuments when userID has no such archived card
+func (r *EmailRepository) Unarchive(ctx context.Context, userID, emailID string) (*models.Email, error) {
 	filter := idFilter(emailID)
-	update := bson.M{"$set": bson.M{"summary": summary}}
-	_, err := r.emailCollection.UpdateOne(ctx, filter, update)
-	return err
-}
+	filter["userId"] = userID
+	filter["archivedAt"] = bson.M{"$ne": nil}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-// GetByID returns an email by its ID (supports string IDs and ObjectID hex)
-func (r *EmailRepository) GetByID(ctx context.Context, emailID string) (*models.Email, error) {
-	filter := idFilter(emailID)
 	var email models.Email
-	if err := r.emailCollection.FindOne(ctx, filter).Decode(&email); err != nil {
+	if err := r.emailCollection.FindOneAndUpdate(ctx, filter, bson.M{"$unset": bson.M{"archivedAt": ""}}, opts).Decode(&email); err != nil {
 		return nil, err
 	}
 	return &email, nil
 }
 
-// ListSnoozedDue returns snoozed emails that are due (snoozedUntil <= now)
-func (r *EmailRepository) ListSnoozedDue(ctx context.Context, now time.Time) ([]models.Email, error) {
-	filter := bson.M{"status": string(models.StatusSnoozed), "snoozedUntil": bson.M{"$lte": now}}
-	cursor, err := r.emailCollection.Find(ctx, filter)
+// SetThreadState stores the Gmail conversation state of an email (see Email.ThreadUnread)
+func (r *EmailRepository) SetThreadState(ctx context.Context, emailID string, messageCount int, unread bool) error {
+	update := bson.M{"$set": bson.M{"threadMessageCount": messageCount, "threadUnread": unread}}
+	_, err := r.emailCollection.UpdateOne(ctx, idFilter(emailID), update)
+	return err
+}
+
+// FrequentSenderDomains returns the sender domains a user has received the most visible
+// mail from, most frequent first
+func (r *EmailRepository) FrequentSenderDomains(ctx context.Context, userID string, limit int) ([]string, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":     userID,
+			"labels":     bson.M{"$ne": "TRASH"},
+			"mailboxId":  bson.M{"$ne": "TRASH"},
+			"deletedAt":  nil,
+			"from.email": bson.M{"$regex": "@"},
+		}},
+		{"$group": bson.M{
+			"_id":   bson.M{"$toLower": bson.M{"$arrayElemAt": bson.A{bson.M{"$split": bson.A{"$from.email", "@"}}, -1}}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var emails []models.Email
+	var domains []string
 	for cursor.Next(ctx) {
-		var e models.Email
-		if err := cursor.Decode(&e); err != nil {
+		var doc struct {
+			Domain string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
 			return nil, err
 		}
-		emails = append(emails, e)
-	}
-	if err := cursor.Err(); err != nil {
-		return nil, err
+		domains = append(domains, doc.Domain)
 	}
-	return emails, nil
+	return domains, cursor.Err()
 }
-func (r *EmailRepository) GetMailboxes(ctx context.Context, userID string) ([]*models.Mailbox, error) {
-	cursor, err := r.mailboxCollection.Find(ctx, bson.M{"userId": userID})
+
+// SoftDelete hides a user's email from the board, search and statistics without removing it
+func (r *EmailRepository) SoftDelete(ctx context.Context, userID, emailID string) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	filter["deletedAt"] = nil
+	res, err := r.emailCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deletedAt": time.Now()}})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer cursor.Close(ctx)
-
-	var mailboxes []*models.Mailbox
-	if err = cursor.All(ctx, &mailboxes); err != nil {
-		return nil, err
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
 	}
-
-	return mailboxes, nil
+	return nil
 }
 
-func (r *EmailRepository) GetEmails(ctx context.Context, mailboxID string, page, perPage int) ([]*models.Email, int, error) {
-	skip := (page - 1) * perPage
-
-	findOptions := options.Find()
-	findOptions.SetSkip(int64(skip))
-	findOptions.SetLimit(int64(perPage))
-	findOptions.SetSort(bson.D{{Key: "receivedAt", Value: -1}})
-
-	filter := bson.M{"mailboxId": mailboxID}
-
-	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var emails []*models.Email
-	if err = cursor.All(ctx, &emails); err != nil {
-		return nil, 0, err
+// MarkTrashed records locally that an email was moved to the Gmail trash: it gets the TRASH
+// label and mailbox and is soft-deleted (keeping an earlier deletedAt). Emails that are not
+// cached are ignored.
+func (r *EmailRepository) MarkTrashed(ctx context.Context, userID, emailID string) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	res, err := r.emailCollection.UpdateOne(ctx, filter, bson.M{
+		"$addToSet": bson.M{"labels": "TRASH"},
+		"$set":      bson.M{"mailboxId": "TRASH"},
+	})
+	if err != nil || res.MatchedCount == 0 {
+		return err
 	}
-
-	total, err := r.emailCollection.CountDocuments(ctx, filter)
-	if err != nil {
-		return nil, 0, err
+	// ErrNoDocuments: already soft-deleted
+	if err := r.SoftDelete(ctx, userID, emailID); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
 	}
+	return nil
+}
 
-	return emails, int(total), nil
+// RemoveLabel removes a label from a cached email, e.g. INBOX when it is archived
+func (r *EmailRepository) RemoveLabel(ctx context.Context, userID, emailID, label string) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	_, err := r.emailCollection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"labels": label}})
+	return err
 }
 
-func (r *EmailRepository) GetEmailByID(ctx context.Context, emailID string) (*models.Email, error) {
-	oid, err := primitive.ObjectIDFromHex(emailID)
-	if err != nil {
-		return nil, err
+// SetFlag sets a boolean Gmail flag (isRead, isStarred) on a cached email and adds or removes
+// the label that backs it, returning the updated email. Returns mongo.ErrNoDocuments when
+// the email isn't cached.
+func (r *EmailRepository) SetFlag(ctx context.Context, userID, emailID, field string, value bool, label string, addLabel bool) (*models.Email, error) {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	update := bson.M{"$set": bson.M{field: value}}
+	if addLabel {
+		update["$addToSet"] = bson.M{"labels": label}
+	} else {
+		update["$pull"] = bson.M{"labels": label}
 	}
 
 	var email models.Email
-	err = r.emailCollection.FindOne(ctx, bson.M{"_id": oid}).Decode(&email)
-	if err != nil {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.emailCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&email); err != nil {
 		return nil, err
 	}
-
 	return &email, nil
 }
 
-func (r *EmailRepository) CreateEmail(ctx context.Context, email *models.Email) error {
-	_, err := r.emailCollection.InsertOne(ctx, email)
-	return err
-}
+// Restore clears a soft delete and the local TRASH label so the card reappears on the board.
+// Returns mongo.ErrNoDocuments when the email doesn't exist or isn't deleted.
+func (r *EmailRepository) Restore(ctx context.Context, userID, emailID string) error {
+	filter := idFilter(emailID)
+	filter["userId"] = userID
+	filter["$or"] = []bson.M{
+		{"deletedAt": bson.M{"$ne": nil}},
+		{"labels": "TRASH"},
+		{"mailboxId": "TRASH"},
+	}
+	update := bson.M{
+		"$unset": bson.M{"deletedAt": ""},
+		"$pull":  bson.M{"labels": "TRASH"},
+	}
+	res, err := r.emailCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 
-func (r *EmailRepository) CreateMailbox(ctx context.Context, mailbox *models.Mailbox) error {
-	_, err := r.mailboxCollection.InsertOne(ctx, mailbox)
+	// Emails cached from the Trash mailbox go back to the inbox
+	inTrash := idFilter(emailID)
+	inTrash["mailboxId"] = "TRASH"
+	_, err = r.emailCollection.UpdateOne(ctx, inTrash, bson.M{"$set": bson.M{"mailboxId": "INBOX"}})
 	return err
 }
 
-func (r *EmailRepository) GetMailboxByID(ctx context.Context, mailboxID string) (*models.Mailbox, error) {
-	var mailbox models.Mailbox
-	err := r.mailboxCollection.FindOne(ctx, bson.M{"id": mailboxID}).Decode(&mailbox)
+// GetTrash returns a user's soft-deleted emails, most recently deleted first
+func (r *EmailRepository) GetTrash(ctx context.Context, userID string, limit int) ([]models.Email, error) {
+	filter := bson.M{
+		"userId":    userID,
+		"deletedAt": bson.M{"$ne": nil},
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "deletedAt", Value: -1}, {Key: "_id", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+
+	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
 	if err != nil {
 		return nil, err
 	}
-	return &mailbox, nil
-}
+	defer cursor.Close(ctx)
 
-func (r *EmailRepository) UpdateMailboxUnreadCount(ctx context.Context, mailboxID string, count int) error {
-	update := bson.M{
-		"$set": bson.M{
-			"unreadCount": count,
-		},
+	var emails []models.Email
+	if err = cursor.All(ctx, &emails); err != nil {
+		return nil, err
 	}
-	_, err := r.mailboxCollection.UpdateOne(ctx, bson.M{"id": mailboxID}, update)
-	return err
-}
 
-// UpsertEmail updates an existing email or inserts a new one
-func (r *EmailRepository) UpsertEmail(ctx context.Context, email *models.Email) error {
-	filter := bson.M{"_id": email.ID} // email.ID is now string from Gmail ID
-	update := bson.M{"$set": email}
-	opts := options.Update().SetUpsert(true)
-	_, err := r.emailCollection.UpdateOne(ctx, filter, update, opts)
-	return err
+	return emails, nil
 }
 
 // ======== Week 4: Semantic Search Methods ========
@@ -313,17 +1843,56 @@ func (r *EmailRepository) SetEmbedding(ctx context.Context, emailID string, embe
 	return err
 }
 
-// GetAllWithEmbeddings returns all emails for a user that have embeddings stored
+// SetEmbeddingChunks stores the embeddings of a chunked email and the hash of the content
+// they were computed from: chunk 0 becomes the email's embedding (used by Atlas Vector Search
+// and older readers), all chunks go to embeddingChunks. A single chunk is stored like
+// SetEmbedding.
+func (r *EmailRepository) SetEmbeddingChunks(ctx context.Context, emailID string, chunks []models.EmbeddingChunk, hash string) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	set := bson.M{
+		"embedding":       chunks[0].Embedding,
+		"embeddingChunks": chunks,
+		"embeddingDim":    len(chunks[0].Embedding),
+		"embeddingHash":   hash,
+	}
+	unset := bson.M{"embeddingStale": ""}
+	if len(chunks) == 1 {
+		delete(set, "embeddingChunks")
+		unset["embeddingChunks"] = ""
+	}
+	_, err := r.emailCollection.UpdateOne(ctx, idFilter(emailID), bson.M{"$set": set, "$unset": unset})
+	return err
+}
+
+// ClearEmbeddingStale marks stale embeddings current again, for emails whose content hash
+// turned out unchanged
+func (r *EmailRepository) ClearEmbeddingStale(ctx context.Context, emailIDs []string) error {
+	if len(emailIDs) == 0 {
+		return nil
+	}
+	filters := make([]bson.M, 0, len(emailIDs))
+	for _, id := range emailIDs {
+		filters = append(filters, idFilter(id))
+	}
+	_, err := r.emailCollection.UpdateMany(ctx, bson.M{"$or": filters}, bson.M{"$unset": bson.M{"embeddingStale": ""}})
+	return err
+}
+
+// GetAllWithEmbeddings returns all emails for a user that have embeddings stored, with their
+// embeddingChunks when they were embedded in several chunks
 func (r *EmailRepository) GetAllWithEmbeddings(ctx context.Context, userID string) ([]models.Email, error) {
 	filter := bson.M{
 		"userId":    userID,
 		"embedding": bson.M{"$exists": true, "$ne": nil},
 		"labels":    bson.M{"$ne": "TRASH"},
 		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
 	}
 
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{Key: "receivedAt", Value: -1}})
+	findOptions.SetSort(keysetSort)
 
 	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -339,22 +1908,77 @@ func (r *EmailRepository) GetAllWithEmbeddings(ctx context.Context, userID strin
 	return emails, nil
 }
 
-// GetEmailsWithoutEmbedding returns emails that don't have embeddings yet
-func (r *EmailRepository) GetEmailsWithoutEmbedding(ctx context.Context, userID string, limit int) ([]models.Email, error) {
-	filter := bson.M{
-		"userId": userID,
+// withoutEmbeddingFilter matches visible emails that still need an embedding, or whose
+// content changed since it was computed; emails with no text to embed are marked
+// embeddingSkipped and left out
+func withoutEmbeddingFilter() bson.M {
+	return bson.M{
 		"$or": []bson.M{
 			{"embedding": bson.M{"$exists": false}},
 			{"embedding": nil},
 			{"embedding": bson.M{"$size": 0}},
+			{"embeddingStale": true},
 		},
-		"labels":    bson.M{"$ne": "TRASH"},
-		"mailboxId": bson.M{"$ne": "TRASH"},
+		"embeddingSkipped": bson.M{"$ne": true},
+		"labels":           bson.M{"$ne": "TRASH"},
+		"mailboxId":        bson.M{"$ne": "TRASH"},
+		"deletedAt":        nil,
+	}
+}
+
+// VectorSearch returns userID's emails nearest to queryVector using an Atlas Vector Search
+// index, best first. Score is Atlas' normalized cosine score, (1 + cosine) / 2. Hidden emails
+// are dropped after the search, so fewer than limit may come back. Only the embedding field is
+// indexed, so chunked emails are matched on their first chunk.
+func (r *EmailRepository) VectorSearch(ctx context.Context, userID string, queryVector []float32, index string, numCandidates, limit int) ([]models.ScoredEmail, error) {
+	if numCandidates < limit {
+		numCandidates = limit
+	}
+	// Over-fetch a little to make up for trashed and deleted emails
+	searchLimit := limit * 2
+	if searchLimit > numCandidates {
+		searchLimit = numCandidates
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: bson.M{
+			"index":         index,
+			"path":          "embedding",
+			"queryVector":   queryVector,
+			"numCandidates": numCandidates,
+			"limit":         searchLimit,
+			"filter":        bson.M{"userId": userID},
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"labels":    bson.M{"$ne": "TRASH"},
+			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
+		}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "vectorSearchScore"}}}},
+		{{Key: "$project", Value: bson.M{"embedding": 0, "embeddingChunks": 0}}},
+	}
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.ScoredEmail{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
 	}
+	return results, nil
+}
+
+// GetEmailsWithoutEmbedding returns emails that don't have embeddings yet or have stale ones
+func (r *EmailRepository) GetEmailsWithoutEmbedding(ctx context.Context, userID string, limit int) ([]models.Email, error) {
+	filter := withoutEmbeddingFilter()
+	filter["userId"] = userID
 
 	findOptions := options.Find()
 	findOptions.SetLimit(int64(limit))
-	findOptions.SetSort(bson.D{{Key: "receivedAt", Value: -1}})
+	findOptions.SetSort(keysetSort)
 
 	cursor, err := r.emailCollection.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -370,6 +1994,84 @@ func (r *EmailRepository) GetEmailsWithoutEmbedding(ctx context.Context, userID
 	return emails, nil
 }
 
+// UsersWithoutEmbedding returns up to limit users that have emails waiting for an embedding
+func (r *EmailRepository) UsersWithoutEmbedding(ctx context.Context, limit int) ([]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: withoutEmbeddingFilter()}},
+		{{Key: "$group", Value: bson.M{"_id": "$userId"}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		UserID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.UserID)
+	}
+	return users, nil
+}
+
+// MarkEmbeddingSkipped flags emails that have no text to embed so the indexer stops picking
+// them up; a later SetEmbedding doesn't need to clear it
+func (r *EmailRepository) MarkEmbeddingSkipped(ctx context.Context, emailIDs []string) error {
+	if len(emailIDs) == 0 {
+		return nil
+	}
+	filters := make([]bson.M, 0, len(emailIDs))
+	for _, id := range emailIDs {
+		filters = append(filters, idFilter(id))
+	}
+	_, err := r.emailCollection.UpdateMany(ctx, bson.M{"$or": filters}, bson.M{"$set": bson.M{"embeddingSkipped": true}})
+	return err
+}
+
+// CountEmbedded counts a user's visible emails that have an embedding
+func (r *EmailRepository) CountEmbedded(ctx context.Context, userID string) (int64, error) {
+	return r.emailCollection.CountDocuments(ctx, bson.M{
+		"userId":      userID,
+		"embedding.0": bson.M{"$exists": true},
+		"labels":      bson.M{"$ne": "TRASH"},
+		"mailboxId":   bson.M{"$ne": "TRASH"},
+		"deletedAt":   nil,
+	})
+}
+
+// CountEmbeddingStatus counts a user's visible emails and how many of them have an embedding
+// or are waiting for one
+func (r *EmailRepository) CountEmbeddingStatus(ctx context.Context, userID string) (total, indexed, pending int64, err error) {
+	visible := bson.M{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}
+	if total, err = r.emailCollection.CountDocuments(ctx, visible); err != nil {
+		return 0, 0, 0, err
+	}
+
+	visible["embedding.0"] = bson.M{"$exists": true}
+	if indexed, err = r.emailCollection.CountDocuments(ctx, visible); err != nil {
+		return 0, 0, 0, err
+	}
+
+	waiting := withoutEmbeddingFilter()
+	waiting["userId"] = userID
+	if pending, err = r.emailCollection.CountDocuments(ctx, waiting); err != nil {
+		return 0, 0, 0, err
+	}
+	return total, indexed, pending, nil
+}
+
 // GetUniqueSenders returns unique sender names/emails for a user (for auto-suggestions)
 func (r *EmailRepository) GetUniqueSenders(ctx context.Context, userID string, query string, limit int) ([]string, error) {
 	pipeline := []bson.M{
@@ -377,6 +2079,7 @@ func (r *EmailRepository) GetUniqueSenders(ctx context.Context, userID string, q
 			"userId":    userID,
 			"labels":    bson.M{"$ne": "TRASH"},
 			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
 		}},
 		{"$group": bson.M{
 			"_id": bson.M{
@@ -431,6 +2134,7 @@ func (r *EmailRepository) GetSubjectKeywords(ctx context.Context, userID string,
 		"userId":    userID,
 		"labels":    bson.M{"$ne": "TRASH"},
 		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
 	}
 
 	findOptions := options.Find()
@@ -478,3 +2182,28 @@ func (r *EmailRepository) GetSubjectKeywords(ctx context.Context, userID string,
 
 	return results, nil
 }
+
+// SaveDraftCopy stores e, the current message of Gmail draft e.DraftID, and removes the copy
+// of the draft's previous message: Gmail gives a draft a new message each time it is saved
+func (r *EmailRepository) SaveDraftCopy(ctx context.Context, e *models.Email) error {
+	_, err := r.emailCollection.DeleteMany(ctx, bson.M{
+		"userId":  e.UserID,
+		"draftId": e.DraftID,
+		"_id":     bson.M{"$ne": e.ID},
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.BulkUpsertFromGmail(ctx, []*models.Email{e}); err != nil {
+		return err
+	}
+	_, err = r.emailCollection.UpdateOne(ctx, bson.M{"_id": e.ID}, bson.M{"$set": bson.M{"draftId": e.DraftID}})
+	return err
+}
+
+// DeleteDraftCopies removes the stored message of userID's draft draftID once it is sent
+// or deleted; a sent draft comes back with the next sync as a regular message
+func (r *EmailRepository) DeleteDraftCopies(ctx context.Context, userID, draftID string) error {
+	_, err := r.emailCollection.DeleteMany(ctx, bson.M{"userId": userID, "draftId": draftID})
+	return err
+}
@@ -0,0 +1,833 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/testutil"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDeleteStale(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	old := now.Add(-100 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+	cutoff := now.Add(-90 * 24 * time.Hour)
+
+	emails := []interface{}{
+		bson.M{"_id": "stale", "userId": "u1", "status": "inbox", "lastAccessedAt": old, "receivedAt": old},
+		bson.M{"_id": "stale-no-status", "userId": "u1", "lastAccessedAt": old, "receivedAt": old},
+		bson.M{"_id": "legacy-old", "userId": "u1", "receivedAt": old},
+		bson.M{"_id": "legacy-recent", "userId": "u1", "receivedAt": recent},
+		bson.M{"_id": "opened", "userId": "u1", "lastAccessedAt": recent, "receivedAt": old},
+		bson.M{"_id": "moved", "userId": "u1", "status": "done", "lastAccessedAt": old, "receivedAt": old},
+		bson.M{"_id": "summarized", "userId": "u1", "summary": "Budget review", "lastAccessedAt": old, "receivedAt": old},
+		bson.M{"_id": "snoozed", "userId": "u1", "snoozedUntil": now.Add(time.Hour), "lastAccessedAt": old, "receivedAt": old},
+		bson.M{"_id": "noted", "userId": "u1", "lastAccessedAt": old, "receivedAt": old},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Collection(cardNotesCollection).InsertOne(ctx, bson.M{"userId": "u1", "emailId": "noted", "text": "keep"}); err != nil {
+		t.Fatal(err)
+	}
+	activity := []interface{}{
+		bson.M{"userId": "u1", "emailId": "stale", "type": "moved"},
+		bson.M{"userId": "u1", "emailId": "moved", "type": "moved"},
+	}
+	if _, err := db.Collection(cardActivityCollection).InsertMany(ctx, activity); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.DeleteStale(ctx, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted = %d, want 3", deleted)
+	}
+
+	for _, id := range []string{"stale", "stale-no-status", "legacy-old"} {
+		if err := db.Collection("emails").FindOne(ctx, bson.M{"_id": id}).Err(); err != mongo.ErrNoDocuments {
+			t.Errorf("%s: still stored (err %v)", id, err)
+		}
+	}
+	for _, id := range []string{"legacy-recent", "opened", "moved", "summarized", "snoozed", "noted"} {
+		if err := db.Collection("emails").FindOne(ctx, bson.M{"_id": id}).Err(); err != nil {
+			t.Errorf("%s: deleted, want kept (err %v)", id, err)
+		}
+	}
+
+	n, err := db.Collection(cardActivityCollection).CountDocuments(ctx, bson.M{"emailId": "stale"})
+	if err != nil || n != 0 {
+		t.Errorf("activity of deleted email: count %d, err %v", n, err)
+	}
+	n, err = db.Collection(cardActivityCollection).CountDocuments(ctx, bson.M{"emailId": "moved"})
+	if err != nil || n != 1 {
+		t.Errorf("activity of kept email: count %d, err %v", n, err)
+	}
+}
+
+func TestGetByIDDoesNotTouch(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	old := time.Now().Add(-100 * 24 * time.Hour).Truncate(time.Millisecond)
+	if _, err := db.Collection("emails").InsertOne(ctx, bson.M{"_id": "e1", "userId": "u1", "lastAccessedAt": old}); err != nil {
+		t.Fatal(err)
+	}
+
+	email, err := repo.GetByID(ctx, "e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !email.LastAccessedAt.Equal(old) {
+		t.Errorf("GetByID changed lastAccessedAt to %v", email.LastAccessedAt)
+	}
+
+	if err := repo.Touch(ctx, "other", "e1"); err != nil {
+		t.Fatal(err)
+	}
+	if email, _ = repo.GetByID(ctx, "e1"); !email.LastAccessedAt.Equal(old) {
+		t.Error("Touch by another user changed lastAccessedAt")
+	}
+	if err := repo.Touch(ctx, "u1", "e1"); err != nil {
+		t.Fatal(err)
+	}
+	if email, _ = repo.GetByID(ctx, "e1"); !email.LastAccessedAt.After(old) {
+		t.Error("Touch did not refresh lastAccessedAt")
+	}
+}
+
+func TestMarkTrashed(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	earlier := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	emails := []interface{}{
+		bson.M{"_id": "e1", "userId": "u1", "mailboxId": "INBOX", "labels": []string{"INBOX"}},
+		bson.M{"_id": "e2", "userId": "u1", "mailboxId": "INBOX", "labels": []string{"INBOX"}, "deletedAt": earlier},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.MarkTrashed(ctx, "other", "e1"); err != nil {
+		t.Fatal(err)
+	}
+	if email, _ := repo.GetByID(ctx, "e1"); email.DeletedAt != nil || email.HasLabel("TRASH") {
+		t.Error("MarkTrashed by another user changed the email")
+	}
+
+	for _, id := range []string{"e1", "e2", "missing"} {
+		if err := repo.MarkTrashed(ctx, "u1", id); err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+	}
+	e1, _ := repo.GetByID(ctx, "e1")
+	if e1.DeletedAt == nil || !e1.HasLabel("TRASH") || e1.MailboxID != "TRASH" {
+		t.Errorf("e1 = %+v, want soft-deleted in TRASH", e1)
+	}
+	e2, _ := repo.GetByID(ctx, "e2")
+	if e2.DeletedAt == nil || !e2.DeletedAt.Equal(earlier) || !e2.HasLabel("TRASH") {
+		t.Errorf("e2 deletedAt = %v, want the earlier %v kept", e2.DeletedAt, earlier)
+	}
+}
+
+func TestBulkUpsertFromGmailPreservesEmbedding(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	synced := func(body string) *models.Email {
+		return &models.Email{ID: "e1", UserID: "u1", MailboxID: "INBOX", Labels: []string{"INBOX"}, Subject: "Budget", Body: body, Preview: body}
+	}
+	pending := func() bool {
+		t.Helper()
+		emails, err := repo.GetEmailsWithoutEmbedding(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(emails) == 1
+	}
+
+	if err := repo.UpsertFromGmail(ctx, synced("Q3 numbers")); err != nil {
+		t.Fatal(err)
+	}
+	if !pending() {
+		t.Fatal("new email is not pending embedding")
+	}
+	chunks := []models.EmbeddingChunk{{ChunkIndex: 0, Embedding: []float32{0.1, 0.2}}}
+	if err := repo.SetEmbeddingChunks(ctx, "e1", chunks, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+	if pending() {
+		t.Fatal("embedded email is still pending")
+	}
+
+	// A re-sync without embedding fields and with the same content keeps the embedding
+	if err := repo.UpsertFromGmail(ctx, synced("Q3 numbers")); err != nil {
+		t.Fatal(err)
+	}
+	email, err := repo.GetByID(ctx, "e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(email.Embedding) != 2 || email.EmbeddingHash != "hash-1" || email.EmbeddingStale {
+		t.Errorf("after unchanged re-sync: embedding %v, hash %q, stale %v", email.Embedding, email.EmbeddingHash, email.EmbeddingStale)
+	}
+	if pending() {
+		t.Error("unchanged re-sync made the email pending")
+	}
+
+	// Changed content keeps the old embedding until the indexer replaces it
+	if err := repo.UpsertFromGmail(ctx, synced("Q4 numbers")); err != nil {
+		t.Fatal(err)
+	}
+	email, _ = repo.GetByID(ctx, "e1")
+	if len(email.Embedding) != 2 || email.EmbeddingHash != "hash-1" || !email.EmbeddingStale {
+		t.Errorf("after changed re-sync: embedding %v, hash %q, stale %v", email.Embedding, email.EmbeddingHash, email.EmbeddingStale)
+	}
+	if !pending() {
+		t.Error("changed email is not pending")
+	}
+
+	if err := repo.ClearEmbeddingStale(ctx, []string{"e1"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending() {
+		t.Error("email still pending after ClearEmbeddingStale")
+	}
+
+	multi := []models.EmbeddingChunk{{ChunkIndex: 0, Embedding: []float32{1}}, {ChunkIndex: 1, TextOffset: 100, Embedding: []float32{2}}}
+	if err := repo.SetEmbeddingChunks(ctx, "e1", multi, "hash-2"); err != nil {
+		t.Fatal(err)
+	}
+	email, _ = repo.GetByID(ctx, "e1")
+	if email.EmbeddingHash != "hash-2" || len(email.EmbeddingChunks) != 2 || email.Embedding[0] != 1 {
+		t.Errorf("after chunked embedding: hash %q, %d chunks, embedding %v", email.EmbeddingHash, len(email.EmbeddingChunks), email.Embedding)
+	}
+}
+
+// emailIDs lists the IDs of emails in order
+func emailIDs(emails []models.Email) []string {
+	ids := make([]string, len(emails))
+	for i, e := range emails {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestSearchEmailsRanksSubjectAboveBody(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	// The body match is the newest, so only the text score can put the subject match first
+	emails := []interface{}{
+		bson.M{"_id": "subject", "userId": "u1", "subject": "Budget review", "body": "See attached.", "receivedAt": now.Add(-2 * time.Hour)},
+		bson.M{"_id": "body", "userId": "u1", "subject": "Hello", "body": "A note about the budget for next year.", "receivedAt": now},
+		bson.M{"_id": "sender", "userId": "u1", "subject": "Weekly", "from": bson.M{"name": "Budget Bot", "email": "bot@example.com"}, "receivedAt": now.Add(-time.Hour)},
+		bson.M{"_id": "unrelated", "userId": "u1", "subject": "Lunch", "body": "Pizza?", "receivedAt": now},
+		bson.M{"_id": "other-user", "userId": "u2", "subject": "Budget", "receivedAt": now},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	got, total, err := repo.SearchEmails(ctx, "u1", "budget", SearchModeAuto, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"subject", "sender", "body"}
+	if ids := emailIDs(got); !slices.Equal(ids, want) || total != 3 {
+		t.Errorf("SearchEmails = %v (total %d), want %v", ids, total, want)
+	}
+
+	// Regex mode ignores relevance and returns the newest first
+	got, _, err = repo.SearchEmails(ctx, "u1", "budget", SearchModeRegex, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := emailIDs(got); !slices.Equal(ids, []string{"body", "sender", "subject"}) {
+		t.Errorf("regex SearchEmails = %v, want newest first", ids)
+	}
+}
+
+func TestSearchEmailsAccentFallback(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	emails := []interface{}{
+		bson.M{"_id": "booking", "userId": "u1", "subject": "Đặt phòng khách sạn", "receivedAt": now},
+		bson.M{"_id": "hanoi", "userId": "u1", "subject": "Chuyến đi Hà Nội", "receivedAt": now.Add(-time.Hour)},
+		bson.M{"_id": "report", "userId": "u1", "subject": "Báo cáo", "body": "Gửi anh báo cáo tài chính quý 3", "receivedAt": now.Add(-2 * time.Hour)},
+		bson.M{"_id": "english", "userId": "u1", "subject": "Quarterly export", "receivedAt": now.Add(-3 * time.Hour)},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// "đ" has no decomposition, so the text index finds nothing and the regex falls back
+		{"dat", []string{"booking"}},
+		// shorter than 3 characters: regex only, substrings included ("khách")
+		{"hà", []string{"booking", "hanoi"}},
+		{"ha", []string{"booking", "hanoi"}},
+		// words of the body, without accents
+		{"tai chin", []string{"report"}},
+		{"ĐẶT", []string{"booking"}},
+		{"khong co", []string{}},
+	}
+	for _, tt := range tests {
+		got, total, err := repo.SearchEmails(ctx, "u1", tt.query, SearchModeAuto, nil, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := emailIDs(got); !slices.Equal(ids, tt.want) || total != int64(len(tt.want)) {
+			t.Errorf("SearchEmails(%q) = %v (total %d), want %v", tt.query, ids, total, tt.want)
+		}
+	}
+}
+
+func TestSearchEmailsPageStableWhileInserting(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	// e3 and e2 share a timestamp: _id breaks the tie
+	emails := []interface{}{
+		bson.M{"_id": "e5", "userId": "u1", "subject": "Invoice 5", "receivedAt": base},
+		bson.M{"_id": "e4", "userId": "u1", "subject": "Invoice 4", "receivedAt": base.Add(-time.Minute)},
+		bson.M{"_id": "e3", "userId": "u1", "subject": "Invoice 3", "receivedAt": base.Add(-2 * time.Minute)},
+		bson.M{"_id": "e2", "userId": "u1", "subject": "Invoice 2", "receivedAt": base.Add(-2 * time.Minute)},
+		bson.M{"_id": "e1", "userId": "u1", "subject": "Invoice 1", "receivedAt": base.Add(-3 * time.Minute)},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []string
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		got, next, _, err := repo.SearchEmailsPage(ctx, "u1", "invoice", "", nil, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen = append(seen, emailIDs(got)...)
+
+		// New mail arrives between every page
+		id := fmt.Sprintf("new%d", page)
+		if _, err := db.Collection("emails").InsertOne(ctx, bson.M{
+			"_id": id, "userId": "u1", "subject": "Invoice " + id, "receivedAt": time.Now().Add(time.Duration(page) * time.Second),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if want := []string{"e5", "e4", "e3", "e2", "e1"}; !slices.Equal(seen, want) {
+		t.Errorf("pages = %v, want %v once each", seen, want)
+	}
+
+	// A fresh first page starts with the new mail
+	got, _, total, err := repo.SearchEmailsPage(ctx, "u1", "invoice", "", nil, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0].ID, "new") || total < 6 {
+		t.Errorf("fresh page = %v (total %d), want the newest inserted emails first", emailIDs(got), total)
+	}
+}
+
+func TestBackfillSearchGrams(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	emails := []interface{}{
+		bson.M{"_id": "legacy", "userId": "u1", "subject": "Hóa đơn", "summary": "Thanh toán <b>tiền điện</b>"},
+		bson.M{"_id": "no-summary", "userId": "u1", "subject": "Lịch họp"},
+		bson.M{"_id": "subject-done", "userId": "u1", "subject": "Báo cáo", "subjectNormalized": "bao cao", "summary": "Kết quả quý"},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := repo.BackfillSearchGrams(ctx, 10)
+	if err != nil || n != 3 {
+		t.Fatalf("BackfillSearchGrams = %d, %v; want 3", n, err)
+	}
+	if n, err := repo.BackfillSearchGrams(ctx, 10); err != nil || n != 0 {
+		t.Errorf("second BackfillSearchGrams = %d, %v; want 0", n, err)
+	}
+
+	want := map[string][2]string{
+		"legacy":       {"hoa don", "thanh toan tien dien"},
+		"no-summary":   {"lich hop", ""},
+		"subject-done": {"bao cao", "ket qua quy"},
+	}
+	for id, w := range want {
+		email, err := repo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if email.SubjectNormalized != w[0] || email.SummaryNormalized != w[1] || len(email.SubjectGrams) == 0 {
+			t.Errorf("%s: subject %q summary %q (%d grams), want %q and %q", id, email.SubjectNormalized, email.SummaryNormalized, len(email.SubjectGrams), w[0], w[1])
+		}
+	}
+
+	candidates, err := repo.FuzzyCandidates(ctx, "u1", utils.WordTrigrams([]string{"dien"}), "", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := emailIDs(candidates); !slices.Equal(ids, []string{"legacy"}) {
+		t.Errorf("FuzzyCandidates(dien) = %v, want the summary match", ids)
+	}
+}
+
+func TestKanbanSortBreaksTiesByID(t *testing.T) {
+	for _, sortBy := range []string{"date", "subject", "sender", ""} {
+		for _, order := range []string{"asc", "desc"} {
+			sort := kanbanSort("", sortBy, order)
+			if last := sort[len(sort)-1]; last.Key != "_id" {
+				t.Errorf("kanbanSort(%q, %q) = %v, want _id as the last key", sortBy, order, sort)
+			}
+		}
+	}
+}
+
+func TestSameTimestampOrderIsDeterministic(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	// Same timestamp, inserted out of ID order
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, id := range []string{"m3", "m1", "m5", "m2", "m4"} {
+		if err := repo.CreateEmail(ctx, &models.Email{ID: id, UserID: "u1", MailboxID: "INBOX", Status: models.StatusInbox, Subject: "Same", ReceivedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	desc := []string{"m5", "m4", "m3", "m2", "m1"}
+	asc := []string{"m1", "m2", "m3", "m4", "m5"}
+
+	for i := 0; i < 3; i++ {
+		board, err := repo.GetKanban(ctx, "u1", nil, nil, nil, "date", "desc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailIDs(board["inbox"]); !slices.Equal(got, desc) {
+			t.Fatalf("GetKanban desc = %v, want %v", got, desc)
+		}
+		board, err = repo.GetKanban(ctx, "u1", nil, nil, nil, "date", "asc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailIDs(board["inbox"]); !slices.Equal(got, asc) {
+			t.Fatalf("GetKanban asc = %v, want %v", got, asc)
+		}
+		// Subject ties too, then falls back to newest first and the ID
+		board, err = repo.GetKanban(ctx, "u1", nil, nil, nil, "subject", "asc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailIDs(board["inbox"]); !slices.Equal(got, desc) {
+			t.Fatalf("GetKanban by subject = %v, want %v", got, desc)
+		}
+		recent, err := repo.ListRecent(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := emailIDs(recent); !slices.Equal(got, desc) {
+			t.Fatalf("ListRecent = %v, want %v", got, desc)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	day := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	fixture := []*models.Email{
+		{ID: "e1", Subject: "Report with chart", From: models.EmailAddress{Name: "Alice", Email: "alice@acme.com"}, ReceivedAt: day(1),
+			MailboxID: "INBOX", Labels: []string{"INBOX", "STARRED"}, HasAttachments: true, Status: models.StatusTodo},
+		{ID: "e2", Subject: "Report draft", From: models.EmailAddress{Name: "Bob", Email: "bob@other.com"}, ReceivedAt: day(2),
+			MailboxID: "INBOX", Labels: []string{"INBOX"}, IsRead: true},
+		{ID: "e3", Subject: "Invoice report", From: models.EmailAddress{Name: "ACME Billing", Email: "billing@vendor.com"}, ReceivedAt: day(10),
+			MailboxID: "Label_1", Labels: []string{"Label_1"}, HasAttachments: true, Status: models.StatusDone, IsRead: true},
+		{ID: "e4", Subject: "Monthly report", From: models.EmailAddress{Name: "Carol", Email: "carol@acme.com"}, ReceivedAt: day(30),
+			MailboxID: "INBOX", Labels: []string{"INBOX"}, Status: models.StatusInbox},
+	}
+	hidden := []*models.Email{
+		{ID: "trashed", UserID: "u1", Subject: "Report", MailboxID: "TRASH", Labels: []string{"TRASH"}, ReceivedAt: day(1)},
+		{ID: "other-user", UserID: "u2", Subject: "Report", MailboxID: "INBOX", Labels: []string{"INBOX"}, ReceivedAt: day(1)},
+	}
+	for _, e := range fixture {
+		e.UserID = "u1"
+	}
+	for _, e := range append(append([]*models.Email{}, fixture...), hidden...) {
+		if err := repo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	yes, no := true, false
+	from, to := day(5), day(5)
+	rangeFrom, rangeTo := day(20), day(2).Add(time.Minute)
+	tests := []struct {
+		name    string
+		filters *models.SearchFilters
+		want    []string
+	}{
+		{"none", nil, []string{"e1", "e2", "e3", "e4"}},
+		{"empty", &models.SearchFilters{}, []string{"e1", "e2", "e3", "e4"}},
+		{"date from", &models.SearchFilters{DateFrom: &from}, []string{"e1", "e2"}},
+		{"date to", &models.SearchFilters{DateTo: &to}, []string{"e3", "e4"}},
+		{"sender address or name", &models.SearchFilters{Sender: " ACME "}, []string{"e1", "e3", "e4"}},
+		{"sender is literal", &models.SearchFilters{Sender: "a.c"}, []string{}},
+		{"label", &models.SearchFilters{Label: "STARRED"}, []string{"e1"}},
+		{"with attachments", &models.SearchFilters{HasAttachment: &yes}, []string{"e1", "e3"}},
+		{"without attachments", &models.SearchFilters{HasAttachment: &no}, []string{"e2", "e4"}},
+		{"inbox status includes never moved", &models.SearchFilters{Status: "inbox"}, []string{"e2", "e4"}},
+		{"status", &models.SearchFilters{Status: "done"}, []string{"e3"}},
+		{"mailbox", &models.SearchFilters{MailboxID: "Label_1"}, []string{"e3"}},
+		{"unread", &models.SearchFilters{IsRead: &no}, []string{"e1", "e4"}},
+		{"sender, attachments and date", &models.SearchFilters{Sender: "acme", HasAttachment: &yes, DateFrom: &from}, []string{"e1"}},
+		{"status and unread", &models.SearchFilters{Status: "inbox", IsRead: &no}, []string{"e4"}},
+		{"date range", &models.SearchFilters{DateFrom: &rangeFrom, DateTo: &rangeTo}, []string{"e2", "e3"}},
+		{"nothing matches all", &models.SearchFilters{Label: "STARRED", IsRead: &yes}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The in-memory check used on Gmail and vector results must agree with the query
+			matched := []string{}
+			for _, e := range fixture {
+				if tt.filters.Matches(e) {
+					matched = append(matched, e.ID)
+				}
+			}
+			if !slices.Equal(matched, tt.want) {
+				t.Errorf("Matches = %v, want %v", matched, tt.want)
+			}
+
+			for _, mode := range []SearchMode{SearchModeRegex, SearchModeText} {
+				got, total, err := repo.SearchEmails(ctx, "u1", "report", mode, tt.filters, 10, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := emailIDs(got)
+				slices.Sort(ids)
+				if !slices.Equal(ids, tt.want) || total != int64(len(tt.want)) {
+					t.Errorf("%s SearchEmails = %v (total %d), want %v", mode, ids, total, tt.want)
+				}
+			}
+
+			hits, err := repo.KeywordSearch(ctx, "u1", "report", tt.filters, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, h := range hits {
+				ids = append(ids, h.ID)
+			}
+			slices.Sort(ids)
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("KeywordSearch = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestReassignStatus(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	until := time.Now().Add(time.Hour)
+	for _, e := range []*models.Email{
+		{ID: "w1", UserID: "u1", Status: "waiting"},
+		{ID: "w2", UserID: "u1", Status: "waiting", SnoozedUntil: &until}, // leftover snooze time is cleared
+		{ID: "t1", UserID: "u1", Status: models.StatusTodo},
+		{ID: "i1", UserID: "u1"}, // no status yet: an inbox card
+		{ID: "i2", UserID: "u1", Status: models.StatusInbox},
+		{ID: "s1", UserID: "u1", Status: models.StatusSnoozed, SnoozedUntil: &until},
+		{ID: "other", UserID: "u2", Status: "waiting"},
+	} {
+		if err := repo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statuses := func() map[string]models.EmailStatus {
+		t.Helper()
+		got := map[string]models.EmailStatus{}
+		for _, id := range []string{"w1", "w2", "t1", "i1", "i2", "s1", "other"} {
+			e, err := repo.GetByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[id] = e.Status
+		}
+		return got
+	}
+	before := statuses()
+
+	// Rejected before anything is written
+	for _, tt := range []struct{ from, to string }{
+		{"", "todo"},
+		{"waiting", ""},
+		{"waiting", "waiting"},
+		{"waiting", string(models.StatusSnoozed)},
+		{string(models.StatusInbox), string(models.StatusSnoozed)},
+	} {
+		if n, err := repo.ReassignStatus(ctx, "u1", tt.from, tt.to); !errors.Is(err, ErrInvalidReassignment) || n != 0 {
+			t.Errorf("ReassignStatus(%q, %q) = %d, %v; want ErrInvalidReassignment", tt.from, tt.to, n, err)
+		}
+	}
+	if got := statuses(); !maps.Equal(got, before) {
+		t.Fatalf("rejected reassignments changed statuses: %v", got)
+	}
+
+	// Only u1's cards of the column move
+	if n, err := repo.ReassignStatus(ctx, "u1", "waiting", "archive_later"); err != nil || n != 2 {
+		t.Fatalf("ReassignStatus(waiting) = %d, %v; want 2", n, err)
+	}
+	// The inbox column includes cards without a status
+	if n, err := repo.ReassignStatus(ctx, "u1", string(models.StatusInbox), string(models.StatusTodo)); err != nil || n != 2 {
+		t.Fatalf("ReassignStatus(inbox) = %d, %v; want 2", n, err)
+	}
+	// Nothing left in the old column
+	if n, err := repo.ReassignStatus(ctx, "u1", "waiting", string(models.StatusDone)); err != nil || n != 0 {
+		t.Errorf("second ReassignStatus(waiting) = %d, %v; want 0", n, err)
+	}
+
+	want := map[string]models.EmailStatus{
+		"w1": "archive_later", "w2": "archive_later", "t1": models.StatusTodo, "i1": models.StatusTodo, "i2": models.StatusTodo,
+		"s1": models.StatusSnoozed, "other": "waiting",
+	}
+	if got := statuses(); !maps.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if e, err := repo.GetByID(ctx, "w2"); err != nil || e.SnoozedUntil != nil {
+		t.Errorf("w2 kept snoozedUntil after the move (err %v)", err)
+	}
+}
+
+func TestThreadStatus(t *testing.T) {
+	base := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := base.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	until := at(24 * 60)
+	tests := []struct {
+		name      string
+		messages  []threadMessage // oldest first
+		want      models.EmailStatus
+		wantUntil *time.Time
+	}{
+		{"no messages", nil, models.StatusInbox, nil},
+		{"never moved: the latest message's column", []threadMessage{{ID: "a", Status: models.StatusTodo}, {ID: "b", Status: models.StatusDone}}, models.StatusDone, nil},
+		{"never moved, no status", []threadMessage{{ID: "a", Status: models.StatusTodo}, {ID: "b"}}, models.StatusInbox, nil},
+		{"an older message was moved", []threadMessage{{ID: "a", Status: models.StatusInProgress, StatusChangedAt: at(5)}, {ID: "b", Status: models.StatusInbox}}, models.StatusInProgress, nil},
+		{"the latest move wins", []threadMessage{
+			{ID: "a", Status: models.StatusDone, StatusChangedAt: at(30)},
+			{ID: "b", Status: models.StatusTodo, StatusChangedAt: at(10)},
+			{ID: "c"},
+		}, models.StatusDone, nil},
+		{"a tie goes to the later message", []threadMessage{{ID: "a", Status: models.StatusTodo, StatusChangedAt: at(1)}, {ID: "b", Status: models.StatusDone, StatusChangedAt: at(1)}}, models.StatusDone, nil},
+		{"snoozed keeps its wake-up time", []threadMessage{{ID: "a", Status: models.StatusSnoozed, StatusChangedAt: at(2), SnoozedUntil: until}, {ID: "b", Status: models.StatusTodo, StatusChangedAt: at(1)}}, models.StatusSnoozed, until},
+		{"a stale snooze time is dropped", []threadMessage{{ID: "a", Status: models.StatusSnoozed, StatusChangedAt: at(1), SnoozedUntil: until}, {ID: "b", Status: models.StatusTodo, StatusChangedAt: at(2), SnoozedUntil: until}}, models.StatusTodo, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, snoozedUntil := threadStatus(tt.messages)
+			if status != tt.want || (snoozedUntil == nil) != (tt.wantUntil == nil) || (snoozedUntil != nil && !snoozedUntil.Equal(*tt.wantUntil)) {
+				t.Errorf("threadStatus = %s, %v; want %s, %v", status, snoozedUntil, tt.want, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestGetKanbanThreads(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	base := time.Now().Add(-24 * time.Hour).Truncate(time.Millisecond)
+	hours := func(n int) time.Time { return base.Add(time.Duration(n) * time.Hour) }
+	moved := hours(5)
+	for _, e := range []*models.Email{
+		// One conversation spread over three columns; the message moved last decides
+		{ID: "t1-a", UserID: "u1", ThreadID: "t1", MailboxID: "INBOX", ReceivedAt: hours(1), Status: models.StatusDone, StatusChangedAt: &moved, IsRead: true},
+		{ID: "t1-b", UserID: "u1", ThreadID: "t1", MailboxID: "INBOX", ReceivedAt: hours(2), Status: models.StatusTodo, HasAttachments: true},
+		{ID: "t1-c", UserID: "u1", ThreadID: "t1", MailboxID: "INBOX", ReceivedAt: hours(3), Subject: "Re: launch plan"},
+		// Never moved: listed where its latest message is
+		{ID: "t2-a", UserID: "u1", ThreadID: "t2", MailboxID: "INBOX", ReceivedAt: hours(1), Status: models.StatusInProgress, IsRead: true},
+		{ID: "t2-b", UserID: "u1", ThreadID: "t2", MailboxID: "INBOX", ReceivedAt: hours(4), Status: models.StatusTodo, IsRead: true},
+		// No thread: a card of its own
+		{ID: "single", UserID: "u1", MailboxID: "INBOX", ReceivedAt: hours(2)},
+		// Not on the board, so not part of the thread card
+		{ID: "t1-trash", UserID: "u1", ThreadID: "t1", MailboxID: "TRASH", ReceivedAt: hours(6)},
+		{ID: "t1-other", UserID: "u2", ThreadID: "t1", MailboxID: "INBOX", ReceivedAt: hours(6)},
+	} {
+		if err := repo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	board, err := repo.GetKanbanThreads(ctx, "u1", nil, nil, nil, "date", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := map[string]models.EmailThread{}
+	for status, threads := range board {
+		for _, th := range threads {
+			if string(th.Status) != status {
+				t.Errorf("thread of %s listed under %s, status %s", th.Latest.ID, status, th.Status)
+			}
+			cards[th.Latest.ID] = th
+		}
+	}
+	if len(cards) != 3 {
+		t.Fatalf("got %d cards, want 3: %v", len(cards), board)
+	}
+
+	t1 := cards["t1-c"]
+	if t1.Status != models.StatusDone || !slices.Equal(t1.EmailIDs, []string{"t1-a", "t1-b", "t1-c"}) ||
+		t1.UnreadCount != 2 || !t1.HasAttachments || t1.Latest.Subject != "Re: launch plan" {
+		t.Errorf("t1 card = %+v", t1)
+	}
+	if t2 := cards["t2-b"]; t2.Status != models.StatusTodo || !slices.Equal(t2.EmailIDs, []string{"t2-a", "t2-b"}) || t2.UnreadCount != 0 {
+		t.Errorf("t2 card = %+v", t2)
+	}
+	if single := cards["single"]; single.Status != models.StatusInbox || !slices.Equal(single.EmailIDs, []string{"single"}) {
+		t.Errorf("single card = %+v", single)
+	}
+
+	// Moving any message moves the card
+	if _, err := repo.MoveStatus(ctx, "u1", "t2-a", string(models.StatusInProgress)); err != nil {
+		t.Fatal(err)
+	}
+	board, err = repo.GetKanbanThreads(ctx, "u1", nil, nil, nil, "date", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := board[string(models.StatusInProgress)]; len(got) != 1 || got[0].Latest.ID != "t2-b" {
+		t.Errorf("in_progress after moving t2-a = %+v", got)
+	}
+
+	ids, err := repo.ThreadEmailIDs(ctx, "u1", "t1-b")
+	if err != nil || !slices.Equal(ids, []string{"t1-a", "t1-b", "t1-c"}) {
+		t.Errorf("ThreadEmailIDs = %v, %v", ids, err)
+	}
+}
+
+func TestArchiveBeforeAndUnarchive(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewEmailRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Millisecond)
+	cutoff := models.ArchiveCutoff(now, models.DefaultArchiveDays)
+	ago := func(days int) *time.Time {
+		t := now.AddDate(0, 0, -days)
+		return &t
+	}
+	for _, e := range []*models.Email{
+		{ID: "old", Status: models.StatusDone, StatusChangedAt: ago(20), ReceivedAt: *ago(30)},
+		{ID: "recent", Status: models.StatusDone, StatusChangedAt: ago(3), ReceivedAt: *ago(30)}, // moved to done lately
+		{ID: "at-cutoff", Status: models.StatusDone, StatusChangedAt: &cutoff, ReceivedAt: *ago(30)},
+		{ID: "never-moved", Status: models.StatusDone, ReceivedAt: *ago(15)},
+		{ID: "never-moved-new", Status: models.StatusDone, ReceivedAt: *ago(2)},
+		{ID: "todo", Status: models.StatusTodo, StatusChangedAt: ago(20), ReceivedAt: *ago(30)},
+		{ID: "trash", Status: models.StatusDone, StatusChangedAt: ago(20), MailboxID: "TRASH"},
+	} {
+		e.UserID = "u1"
+		if e.MailboxID == "" {
+			e.MailboxID = "INBOX"
+		}
+		if err := repo.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.CreateEmail(ctx, &models.Email{ID: "other", UserID: "u2", MailboxID: "INBOX", Status: models.StatusDone, StatusChangedAt: ago(20)}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := repo.ArchiveBefore(ctx, "u1", string(models.StatusDone), cutoff)
+	if err != nil || n != 2 {
+		t.Fatalf("ArchiveBefore = %d, %v; want old and never-moved", n, err)
+	}
+	// Running it again finds nothing new
+	if n, err := repo.ArchiveBefore(ctx, "u1", string(models.StatusDone), cutoff); err != nil || n != 0 {
+		t.Errorf("second ArchiveBefore = %d, %v", n, err)
+	}
+
+	board, err := repo.GetKanban(ctx, "u1", nil, nil, nil, "date", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := emailIDs(board[string(models.StatusDone)]); !slices.Equal(got, []string{"never-moved-new", "recent", "at-cutoff"}) {
+		t.Errorf("done column = %v", got)
+	}
+
+	first, next, err := repo.ListArchived(ctx, "u1", "", 1)
+	if err != nil || len(first) != 1 || first[0].ID != "never-moved" || first[0].ArchivedAt == nil || next == "" {
+		t.Fatalf("first archive page = %v, %q, %v", emailIDs(first), next, err)
+	}
+	second, next, err := repo.ListArchived(ctx, "u1", next, 1)
+	if err != nil || emailIDs(second)[0] != "old" || next != "" {
+		t.Fatalf("second archive page = %v, %q, %v", emailIDs(second), next, err)
+	}
+
+	// Restoring puts the card back in its column
+	restored, err := repo.Unarchive(ctx, "u1", "old")
+	if err != nil || restored.ArchivedAt != nil || restored.Status != models.StatusDone {
+		t.Fatalf("Unarchive = %+v, %v", restored, err)
+	}
+	for _, tt := range []struct{ userID, id string }{{"u1", "old"}, {"u1", "recent"}, {"u2", "never-moved"}, {"u1", "missing"}} {
+		if _, err := repo.Unarchive(ctx, tt.userID, tt.id); !errors.Is(err, mongo.ErrNoDocuments) {
+			t.Errorf("Unarchive(%s, %s) = %v, want ErrNoDocuments", tt.userID, tt.id, err)
+		}
+	}
+	// Moving an archived card restores it too
+	if _, err := repo.MoveStatus(ctx, "u1", "never-moved", string(models.StatusTodo)); err != nil {
+		t.Fatal(err)
+	}
+	if archived, _, err := repo.ListArchived(ctx, "u1", "", 10); err != nil || len(archived) != 0 {
+		t.Errorf("still archived: %v, %v", emailIDs(archived), err)
+	}
+	// The restored card is archived again by the next pass, since it is still old
+	if n, err := repo.ArchiveBefore(ctx, "u1", string(models.StatusDone), cutoff); err != nil || n != 1 {
+		t.Errorf("ArchiveBefore after restore = %d, %v; want old again", n, err)
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmbeddingIndexRepository keeps each user's embedding indexing progress, one document per
+// user keyed by user ID
+type EmbeddingIndexRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmbeddingIndexRepository creates a new repository
+func NewEmbeddingIndexRepository(db *mongo.Database) *EmbeddingIndexRepository {
+	return &EmbeddingIndexRepository{collection: db.Collection("embedding_index_status")}
+}
+
+// Get returns the stored progress of userID; a user the indexer hasn't seen gets an empty one
+func (r *EmbeddingIndexRepository) Get(ctx context.Context, userID string) (*models.EmbeddingIndexStatus, error) {
+	var status models.EmbeddingIndexStatus
+	err := r.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&status)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.EmbeddingIndexStatus{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RecordRun stores the counts after an indexing run. indexed is how many emails the run
+// embedded; runErr (optional) is kept until a run succeeds.
+func (r *EmbeddingIndexRepository) RecordRun(ctx context.Context, status *models.EmbeddingIndexStatus, indexed int, runErr error) error {
+	now := time.Now()
+	set := bson.M{
+		"total":     status.Total,
+		"indexed":   status.Indexed,
+		"pending":   status.Pending,
+		"skipped":   status.Skipped,
+		"lastRunAt": now,
+		"updatedAt": now,
+	}
+	update := bson.M{"$set": set}
+	if runErr != nil {
+		set["lastError"] = runErr.Error()
+	} else {
+		update["$unset"] = bson.M{"lastError": ""}
+	}
+	if indexed > 0 {
+		set["lastIndexedAt"] = now
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": status.UserID}, update, options.Update().SetUpsert(true))
+	return err
+}
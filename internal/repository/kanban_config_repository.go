@@ -37,6 +37,10 @@ func NewKanbanConfigRepository(db *mongo.Database) *KanbanConfigRepository {
 		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "key", Value: 1}},
 		Options: options.Index().SetName("idx_user_key_unique").SetUnique(true),
 	})
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "autoArchiveDays", Value: 1}},
+		Options: options.Index().SetName("idx_auto_archive_days").SetSparse(true),
+	})
 
 	return r
 }
@@ -196,6 +200,21 @@ func (r *KanbanConfigRepository) GetColumnByKey(ctx context.Context, userID, key
 	return &column, nil
 }
 
+// AutoArchiveColumns returns every user's columns with auto-archive turned on
+func (r *KanbanConfigRepository) AutoArchiveColumns(ctx context.Context) ([]models.KanbanColumn, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"autoArchiveDays": bson.M{"$gt": 0}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var columns []models.KanbanColumn
+	if err = cursor.All(ctx, &columns); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
 // helper to build ID filter - tries both ObjectID and string formats
 func (r *KanbanConfigRepository) idFilter(columnID string) bson.M {
 	// Try as ObjectID first
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KanbanMoveRepository keeps a short per-user history of Kanban moves for undo
+type KanbanMoveRepository struct {
+	collection *mongo.Collection
+}
+
+// NewKanbanMoveRepository creates a new repository
+func NewKanbanMoveRepository(db *mongo.Database) *KanbanMoveRepository {
+	r := &KanbanMoveRepository{
+		collection: db.Collection("kanban_moves"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "movedAt", Value: -1}},
+		Options: options.Index().SetName("idx_user_moved_at"),
+	})
+	// TTL index: Mongo removes moves once they expire
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("idx_expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+
+	return r
+}
+
+// Record stores move and drops the user's moves beyond the depth most recent ones
+func (r *KanbanMoveRepository) Record(ctx context.Context, move *models.KanbanMove, depth int) error {
+	if _, err := r.collection.InsertOne(ctx, move); err != nil {
+		return err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "movedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(depth)).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": move.UserID}, opts)
+	if err != nil {
+		return err
+	}
+	var old []struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &old); err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(old))
+	for i, m := range old {
+		ids[i] = m.ID
+	}
+	_, err = r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// PopLatest removes and returns userID's most recent unexpired move, or nil when there is none.
+// Expired moves the TTL monitor hasn't removed yet are skipped.
+func (r *KanbanMoveRepository) PopLatest(ctx context.Context, userID string) (*models.KanbanMove, error) {
+	filter := bson.M{"userId": userID, "expiresAt": bson.M{"$gt": time.Now()}}
+	opts := options.FindOneAndDelete().SetSort(bson.D{{Key: "movedAt", Value: -1}, {Key: "_id", Value: -1}})
+	var move models.KanbanMove
+	if err := r.collection.FindOneAndDelete(ctx, filter, opts).Decode(&move); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &move, nil
+}
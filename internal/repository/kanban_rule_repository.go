@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KanbanRuleRepository stores users' Kanban rules
+type KanbanRuleRepository struct {
+	collection *mongo.Collection
+}
+
+// NewKanbanRuleRepository creates the repository and its indexes
+func NewKanbanRuleRepository(db *mongo.Database) *KanbanRuleRepository {
+	r := &KanbanRuleRepository{
+		collection: db.Collection("kanban_rules"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "order", Value: 1}},
+		Options: options.Index().SetName("idx_user_order"),
+	})
+
+	return r
+}
+
+// List returns userID's Kanban rules in evaluation order; enabledOnly skips disabled rules
+func (r *KanbanRuleRepository) List(ctx context.Context, userID string, enabledOnly bool) ([]models.KanbanRule, error) {
+	filter := bson.M{"userId": userID}
+	if enabledOnly {
+		filter["enabled"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "createdAt", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := []models.KanbanRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetByID returns one of userID's rules, or mongo.ErrNoDocuments
+func (r *KanbanRuleRepository) GetByID(ctx context.Context, userID, id string) (*models.KanbanRule, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	var rule models.KanbanRule
+	if err := r.collection.FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// NextOrder returns the order that puts a new rule after userID's existing ones
+func (r *KanbanRuleRepository) NextOrder(ctx context.Context, userID string) (int, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}}).SetProjection(bson.M{"order": 1})
+	var last models.KanbanRule
+	err := r.collection.FindOne(ctx, bson.M{"userId": userID}, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Order + 1, nil
+}
+
+// Create inserts a rule
+func (r *KanbanRuleRepository) Create(ctx context.Context, rule *models.KanbanRule) error {
+	now := time.Now()
+	rule.ID = primitive.NewObjectID()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	_, err := r.collection.InsertOne(ctx, rule)
+	return err
+}
+
+// Update sets fields of one of userID's rules and returns the updated document
+func (r *KanbanRuleRepository) Update(ctx context.Context, userID string, id primitive.ObjectID, set bson.M) (*models.KanbanRule, error) {
+	set["updatedAt"] = time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var rule models.KanbanRule
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "userId": userID}, bson.M{"$set": set}, opts).Decode(&rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Delete removes one of userID's rules
+func (r *KanbanRuleRepository) Delete(ctx context.Context, userID string, id primitive.ObjectID) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
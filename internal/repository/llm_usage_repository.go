@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LLMUsageRepository stores one record per LLM or embedding call
+type LLMUsageRepository struct {
+	collection *mongo.Collection
+}
+
+// NewLLMUsageRepository creates a new repository
+func NewLLMUsageRepository(db *mongo.Database) *LLMUsageRepository {
+	r := &LLMUsageRepository{
+		collection: db.Collection("llm_usage"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("idx_user_timestamp"),
+	})
+
+	return r
+}
+
+// Insert records one call
+func (r *LLMUsageRepository) Insert(ctx context.Context, usage *models.LLMUsage) error {
+	_, err := r.collection.InsertOne(ctx, usage)
+	return err
+}
+
+// TotalsByOperation sums a user's usage in [from, to) per operation, largest first
+func (r *LLMUsageRepository) TotalsByOperation(ctx context.Context, userID string, from, to time.Time) ([]models.OperationUsage, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID, "timestamp": bson.M{"$gte": from, "$lt": to}}},
+		{"$group": bson.M{
+			"_id":              "$operation",
+			"calls":            bson.M{"$sum": 1},
+			"promptTokens":     bson.M{"$sum": "$promptTokens"},
+			"completionTokens": bson.M{"$sum": "$completionTokens"},
+			"totalTokens":      bson.M{"$sum": bson.M{"$add": bson.A{"$promptTokens", "$completionTokens"}}},
+			"costEstimate":     bson.M{"$sum": "$costEstimate"},
+		}},
+		{"$sort": bson.D{{Key: "totalTokens", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.OperationUsage{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// TotalTokens sums a user's prompt and completion tokens in [from, to)
+func (r *LLMUsageRepository) TotalTokens(ctx context.Context, userID string, from, to time.Time) (int64, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID, "timestamp": bson.M{"$gte": from, "$lt": to}}},
+		{"$group": bson.M{
+			"_id":   nil,
+			"total": bson.M{"$sum": bson.M{"$add": bson.A{"$promptTokens", "$completionTokens"}}},
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationRepository stores users' in-app notifications
+type NotificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewNotificationRepository creates the repository and its indexes
+func NewNotificationRepository(db *mongo.Database) *NotificationRepository {
+	r := &NotificationRepository{
+		collection: db.Collection("notifications"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("idx_user_id"),
+	})
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "readAt", Value: 1}},
+		Options: options.Index().SetName("idx_user_read_at"),
+	})
+
+	return r
+}
+
+// Create inserts a notification
+func (r *NotificationRepository) Create(ctx context.Context, n *models.Notification) error {
+	n.ID = primitive.NewObjectID()
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	_, err := r.collection.InsertOne(ctx, n)
+	return err
+}
+
+// List returns up to limit of userID's notifications older than before (a notification ID;
+// empty starts at the newest), newest first. unreadOnly skips read ones. The cursor is the
+// ID to pass as before for the next page, empty on the last page.
+func (r *NotificationRepository) List(ctx context.Context, userID, before string, limit int, unreadOnly bool) ([]models.Notification, string, error) {
+	filter := bson.M{"userId": userID}
+	if before != "" {
+		oid, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		filter["_id"] = bson.M{"$lt": oid}
+	}
+	if unreadOnly {
+		filter["readAt"] = nil
+	}
+	// one extra to know whether there is a next page
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit + 1))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		next = notifications[limit-1].ID.Hex()
+	}
+	return notifications, next, nil
+}
+
+// CountUnread counts userID's unread notifications
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"userId": userID, "readAt": nil})
+}
+
+// MarkRead marks one of userID's notifications read and returns it; a notification that is
+// already read keeps its readAt. mongo.ErrNoDocuments when userID has no such notification.
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID, id string) (*models.Notification, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	filter := bson.M{"_id": oid, "userId": userID}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"readAt": bson.M{"$ifNull": bson.A{"$readAt", time.Now()}}}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var n models.Notification
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
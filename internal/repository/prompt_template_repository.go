@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromptTemplateRepository stores summarizer prompt templates
+type PromptTemplateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPromptTemplateRepository creates the repository and its indexes
+func NewPromptTemplateRepository(db *mongo.Database) *PromptTemplateRepository {
+	r := &PromptTemplateRepository{
+		collection: db.Collection("prompt_templates"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "active", Value: 1}},
+		Options: options.Index().SetName("idx_user_active"),
+	})
+
+	return r
+}
+
+// EnsureDefault inserts tpl as the default template unless one exists; an edited default is
+// left alone
+func (r *PromptTemplateRepository) EnsureDefault(ctx context.Context, tpl *models.PromptTemplate) error {
+	now := time.Now()
+	doc := bson.M{
+		"userId":    "",
+		"name":      tpl.Name,
+		"system":    tpl.System,
+		"prompt":    tpl.Prompt,
+		"active":    false,
+		"isDefault": true,
+		"createdAt": now,
+		"updatedAt": now,
+	}
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"isDefault": true},
+		bson.M{"$setOnInsert": doc},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// List returns the default template followed by userID's templates, oldest first
+func (r *PromptTemplateRepository) List(ctx context.Context, userID string) ([]models.PromptTemplate, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"userId": userID}, bson.M{"isDefault": true}}}
+	opts := options.Find().SetSort(bson.D{{Key: "isDefault", Value: -1}, {Key: "createdAt", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	templates := []models.PromptTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetByID returns a template, or mongo.ErrNoDocuments
+func (r *PromptTemplateRepository) GetByID(ctx context.Context, id string) (*models.PromptTemplate, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	var tpl models.PromptTemplate
+	if err := r.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&tpl); err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// Create inserts a user template; an active one replaces the user's previous active template
+func (r *PromptTemplateRepository) Create(ctx context.Context, tpl *models.PromptTemplate) error {
+	now := time.Now()
+	tpl.ID = primitive.NewObjectID()
+	tpl.IsDefault = false
+	tpl.CreatedAt = now
+	tpl.UpdatedAt = now
+	if tpl.Active {
+		if err := r.Deactivate(ctx, tpl.UserID); err != nil {
+			return err
+		}
+	}
+	_, err := r.collection.InsertOne(ctx, tpl)
+	return err
+}
+
+// Update sets fields of a template and returns the updated document
+func (r *PromptTemplateRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (*models.PromptTemplate, error) {
+	set["updatedAt"] = time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var tpl models.PromptTemplate
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set}, opts).Decode(&tpl); err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// Delete removes a user template; the default can't be deleted
+func (r *PromptTemplateRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "isDefault": bson.M{"$ne": true}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Activate makes id userID's active template
+func (r *PromptTemplateRepository) Activate(ctx context.Context, userID string, id primitive.ObjectID) error {
+	if err := r.Deactivate(ctx, userID); err != nil {
+		return err
+	}
+	res, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "userId": userID},
+		bson.M{"$set": bson.M{"active": true, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Deactivate clears userID's active template so the default applies again
+func (r *PromptTemplateRepository) Deactivate(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"userId": userID, "active": true},
+		bson.M{"$set": bson.M{"active": false}},
+	)
+	return err
+}
+
+// Active returns userID's active template, else the default, else nil
+func (r *PromptTemplateRepository) Active(ctx context.Context, userID string) (*models.PromptTemplate, error) {
+	var tpl models.PromptTemplate
+	if userID != "" {
+		err := r.collection.FindOne(ctx, bson.M{"userId": userID, "active": true}).Decode(&tpl)
+		if err == nil {
+			return &tpl, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+	err := r.collection.FindOne(ctx, bson.M{"isDefault": true}).Decode(&tpl)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
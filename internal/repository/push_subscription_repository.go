@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PushSubscriptionRepository stores users' Web Push subscriptions
+type PushSubscriptionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPushSubscriptionRepository creates the repository and its indexes
+func NewPushSubscriptionRepository(db *mongo.Database) *PushSubscriptionRepository {
+	r := &PushSubscriptionRepository{
+		collection: db.Collection("push_subscriptions"),
+	}
+
+	ctx := context.Background()
+	// An endpoint identifies one browser; it belongs to whoever subscribed last
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "endpoint", Value: 1}},
+		Options: options.Index().SetName("idx_endpoint").SetUnique(true),
+	})
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}},
+		Options: options.Index().SetName("idx_user_id"),
+	})
+
+	return r
+}
+
+// Upsert stores sub under its endpoint, replacing the keys and owner of an existing
+// subscription (browsers re-subscribe with new keys, and a browser may switch accounts)
+func (r *PushSubscriptionRepository) Upsert(ctx context.Context, sub *models.PushSubscription) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"userId":    sub.UserID,
+			"keys":      sub.Keys,
+			"userAgent": sub.UserAgent,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	return r.collection.FindOneAndUpdate(ctx, bson.M{"endpoint": sub.Endpoint}, update, opts).Decode(sub)
+}
+
+// ListByUser returns userID's subscriptions
+func (r *PushSubscriptionRepository) ListByUser(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	subs := []models.PushSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// Delete removes userID's subscription for endpoint, or returns mongo.ErrNoDocuments
+func (r *PushSubscriptionRepository) Delete(ctx context.Context, userID, endpoint string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"userId": userID, "endpoint": endpoint})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteByEndpoint removes an expired subscription, whoever owns it
+func (r *PushSubscriptionRepository) DeleteByEndpoint(ctx context.Context, endpoint string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"endpoint": endpoint})
+	return err
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SavedSearchRepository stores users' saved searches
+type SavedSearchRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSavedSearchRepository creates the repository and its indexes
+func NewSavedSearchRepository(db *mongo.Database) *SavedSearchRepository {
+	r := &SavedSearchRepository{
+		collection: db.Collection("saved_searches"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("idx_user_created_at"),
+	})
+
+	return r
+}
+
+// List returns userID's saved searches, oldest first; withActionOnly skips those without an
+// action
+func (r *SavedSearchRepository) List(ctx context.Context, userID string, withActionOnly bool) ([]models.SavedSearch, error) {
+	filter := bson.M{"userId": userID}
+	if withActionOnly {
+		filter["action"] = bson.M{"$ne": nil}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	searches := []models.SavedSearch{}
+	if err := cursor.All(ctx, &searches); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+// GetByID returns one of userID's saved searches, or mongo.ErrNoDocuments
+func (r *SavedSearchRepository) GetByID(ctx context.Context, userID, id string) (*models.SavedSearch, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	var search models.SavedSearch
+	if err := r.collection.FindOne(ctx, bson.M{"_id": oid, "userId": userID}).Decode(&search); err != nil {
+		return nil, err
+	}
+	return &search, nil
+}
+
+// Create inserts a saved search
+func (r *SavedSearchRepository) Create(ctx context.Context, search *models.SavedSearch) error {
+	now := time.Now()
+	search.ID = primitive.NewObjectID()
+	search.CreatedAt = now
+	search.UpdatedAt = now
+	_, err := r.collection.InsertOne(ctx, search)
+	return err
+}
+
+// Replace overwrites the name, query, filters, mode and action of one of the owner's saved
+// searches
+func (r *SavedSearchRepository) Replace(ctx context.Context, search *models.SavedSearch) error {
+	search.UpdatedAt = time.Now()
+	set := bson.M{
+		"name":      search.Name,
+		"query":     search.Query,
+		"filters":   search.Filters,
+		"mode":      search.Mode,
+		"updatedAt": search.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if search.Action.IsEmpty() {
+		update["$unset"] = bson.M{"action": ""}
+	} else {
+		set["action"] = search.Action
+	}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": search.ID, "userId": search.UserID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Delete removes one of userID's saved searches
+func (r *SavedSearchRepository) Delete(ctx context.Context, userID string, id primitive.ObjectID) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
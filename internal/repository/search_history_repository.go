@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SearchHistoryLimit is how many distinct queries are kept per user
+const SearchHistoryLimit = 100
+
+// SearchHistoryRepository stores the searches users ran, newest per query
+type SearchHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSearchHistoryRepository creates the repository and its indexes
+func NewSearchHistoryRepository(db *mongo.Database) *SearchHistoryRepository {
+	r := &SearchHistoryRepository{
+		collection: db.Collection("search_history"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "normalized", Value: 1}},
+		Options: options.Index().SetName("idx_user_normalized").SetUnique(true),
+	})
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "searchedAt", Value: -1}},
+		Options: options.Index().SetName("idx_user_searched_at"),
+	})
+
+	return r
+}
+
+// Record stores a search of userID, replacing an earlier run of the same query, and drops the
+// user's oldest entries beyond SearchHistoryLimit
+func (r *SearchHistoryRepository) Record(ctx context.Context, userID, query string, resultCount int) error {
+	normalized := models.NormalizeSearchQuery(query)
+	if normalized == "" {
+		return nil
+	}
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"userId": userID, "normalized": normalized},
+		bson.M{"$set": bson.M{
+			"query":       query,
+			"resultCount": resultCount,
+			"searchedAt":  time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "searchedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(SearchHistoryLimit).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return err
+	}
+	var old []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &old); err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(old))
+	for i, e := range old {
+		ids[i] = e.ID
+	}
+	_, err = r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// Recent returns userID's latest searches, newest first. A non-empty prefix keeps the queries
+// that contain a word starting with it (case-insensitive).
+func (r *SearchHistoryRepository) Recent(ctx context.Context, userID, prefix string, limit int) ([]models.SearchHistoryEntry, error) {
+	filter := bson.M{"userId": userID}
+	if prefix = models.NormalizeSearchQuery(prefix); prefix != "" {
+		filter["normalized"] = bson.M{"$regex": `(^|\s)` + utils.EscapeRegexLiteral(prefix)}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "searchedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.SearchHistoryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Clear deletes userID's search history
+func (r *SearchHistoryRepository) Clear(ctx context.Context, userID string) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
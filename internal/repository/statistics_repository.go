@@ -3,12 +3,16 @@ package repository
 import (
 	"aiemailbox-be/internal/models"
 	"context"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// unreadCounter is a $group accumulator counting unread emails
+var unreadCounter = bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$isRead", false}}, 1, 0}}}
+
 type StatisticsRepository struct {
 	emailCollection *mongo.Collection
 }
@@ -19,14 +23,20 @@ func NewStatisticsRepository(db *mongo.Database) *StatisticsRepository {
 	}
 }
 
-// GetEmailsByStatus aggregates email count by workflow status
-func (r *StatisticsRepository) GetEmailsByStatus(ctx context.Context, userID string) ([]models.EmailStatusStats, error) {
+// GetEmailsByStatus aggregates email count by workflow status. Cards archived off the board
+// are left out unless includeArchived is set.
+func (r *StatisticsRepository) GetEmailsByStatus(ctx context.Context, userID string, includeArchived bool) ([]models.EmailStatusStats, error) {
+	match := bson.M{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}
+	if !includeArchived {
+		match["archivedAt"] = nil
+	}
 	pipeline := []bson.M{
-		{"$match": bson.M{
-			"userId":    userID,
-			"labels":    bson.M{"$ne": "TRASH"},
-			"mailboxId": bson.M{"$ne": "TRASH"},
-		}},
+		{"$match": match},
 		{"$group": bson.M{
 			"_id":   "$status",
 			"count": bson.M{"$sum": 1},
@@ -55,6 +65,35 @@ func (r *StatisticsRepository) GetEmailsByStatus(ctx context.Context, userID str
 	return results, nil
 }
 
+// GetEmailsByCategory aggregates visible emails by category
+func (r *StatisticsRepository) GetEmailsByCategory(ctx context.Context, userID string) ([]models.EmailCategoryStats, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":    userID,
+			"labels":    bson.M{"$ne": "TRASH"},
+			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
+		}},
+		{"$group": bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$category", "uncategorized"}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.EmailCategoryStats{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 // GetEmailTrend aggregates emails by date for the last N days
 func (r *StatisticsRepository) GetEmailTrend(ctx context.Context, userID string, days int) ([]models.EmailTrendPoint, error) {
 	startDate := time.Now().AddDate(0, 0, -days)
@@ -65,6 +104,7 @@ func (r *StatisticsRepository) GetEmailTrend(ctx context.Context, userID string,
 			"receivedAt": bson.M{"$gte": startDate},
 			"labels":     bson.M{"$ne": "TRASH"},
 			"mailboxId":  bson.M{"$ne": "TRASH"},
+			"deletedAt":  nil,
 		}},
 		{"$group": bson.M{
 			"_id": bson.M{
@@ -99,21 +139,24 @@ func (r *StatisticsRepository) GetTopSenders(ctx context.Context, userID string,
 			"userId":    userID,
 			"labels":    bson.M{"$ne": "TRASH"},
 			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
 		}},
 		{"$group": bson.M{
 			"_id": bson.M{
 				"name":  "$from.name",
 				"email": "$from.email",
 			},
-			"count": bson.M{"$sum": 1},
+			"count":       bson.M{"$sum": 1},
+			"unreadCount": unreadCounter,
 		}},
 		{"$sort": bson.M{"count": -1}},
 		{"$limit": limit},
 		{"$project": bson.M{
-			"name":  "$_id.name",
-			"email": "$_id.email",
-			"count": 1,
-			"_id":   0,
+			"name":        "$_id.name",
+			"email":       "$_id.email",
+			"count":       1,
+			"unreadCount": 1,
+			"_id":         0,
 		}},
 	}
 
@@ -131,6 +174,69 @@ func (r *StatisticsRepository) GetTopSenders(ctx context.Context, userID string,
 	return results, nil
 }
 
+// GetTopDomains aggregates the top N sender domains (the part of the address after the @).
+// Addresses without a domain are left out of the list but still count toward the percentages.
+func (r *StatisticsRepository) GetTopDomains(ctx context.Context, userID string, limit int) ([]models.TopDomain, error) {
+	// from.email may be missing or not a string on malformed messages; $split needs a string
+	address := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": "$from.email"}, "string"}},
+		"$from.email",
+		"",
+	}}
+	parts := bson.M{"$split": bson.A{address, "@"}}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":    userID,
+			"labels":    bson.M{"$ne": "TRASH"},
+			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$size": parts}, 1}},
+				bson.M{"$toLower": bson.M{"$trim": bson.M{"input": bson.M{"$arrayElemAt": bson.A{parts, -1}}}}},
+				"",
+			}},
+			"count":       bson.M{"$sum": 1},
+			"unreadCount": unreadCounter,
+		}},
+		// total over every domain (malformed included) for the percentages
+		{"$group": bson.M{
+			"_id":     nil,
+			"total":   bson.M{"$sum": "$count"},
+			"domains": bson.M{"$push": "$$ROOT"},
+		}},
+		{"$unwind": "$domains"},
+		{"$match": bson.M{"domains._id": bson.M{"$ne": ""}}},
+		{"$sort": bson.D{{Key: "domains.count", Value: -1}, {Key: "domains._id", Value: 1}}},
+		{"$limit": limit},
+		{"$project": bson.M{
+			"domain":      "$domains._id",
+			"count":       "$domains.count",
+			"unreadCount": "$domains.unreadCount",
+			"percentage": bson.M{"$round": bson.A{
+				bson.M{"$multiply": bson.A{bson.M{"$divide": bson.A{"$domains.count", "$total"}}, 100}},
+				1,
+			}},
+			"_id": 0,
+		}},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.TopDomain{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
 // GetDailyActivity aggregates email activity by day of week and hour
 func (r *StatisticsRepository) GetDailyActivity(ctx context.Context, userID string, days int) ([]models.DailyActivity, error) {
 	startDate := time.Now().AddDate(0, 0, -days)
@@ -141,6 +247,7 @@ func (r *StatisticsRepository) GetDailyActivity(ctx context.Context, userID stri
 			"receivedAt": bson.M{"$gte": startDate},
 			"labels":     bson.M{"$ne": "TRASH"},
 			"mailboxId":  bson.M{"$ne": "TRASH"},
+			"deletedAt":  nil,
 		}},
 		{"$group": bson.M{
 			"_id": bson.M{
@@ -175,12 +282,200 @@ func (r *StatisticsRepository) GetDailyActivity(ctx context.Context, userID stri
 	return results, nil
 }
 
+// GetResponseTimes measures how fast the user replies: for each thread active in the last N
+// days, the time from its first message received in that period to the user's first sent
+// message after it. Threads without a reply are skipped.
+func (r *StatisticsRepository) GetResponseTimes(ctx context.Context, userID string, days int) (models.ResponseTimeStats, error) {
+	startDate := time.Now().AddDate(0, 0, -days)
+	sent := bson.M{"$or": bson.A{
+		bson.M{"$in": bson.A{"SENT", bson.M{"$ifNull": bson.A{"$labels", bson.A{}}}}},
+		bson.M{"$eq": bson.A{"$mailboxId", "SENT"}},
+	}}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":     userID,
+			"threadId":   bson.M{"$nin": bson.A{"", nil}},
+			"receivedAt": bson.M{"$gte": startDate},
+			"labels":     bson.M{"$ne": "TRASH"},
+			"mailboxId":  bson.M{"$ne": "TRASH"},
+			"deletedAt":  nil,
+		}},
+		// $min ignores the nulls, leaving the first received message and every sent time
+		{"$group": bson.M{
+			"_id":       "$threadId",
+			"firstIn":   bson.M{"$min": bson.M{"$cond": bson.A{sent, nil, "$receivedAt"}}},
+			"sentTimes": bson.M{"$push": bson.M{"$cond": bson.A{sent, "$receivedAt", nil}}},
+		}},
+		{"$match": bson.M{"firstIn": bson.M{"$ne": nil}}},
+		{"$project": bson.M{
+			"firstIn": 1,
+			"firstReply": bson.M{"$min": bson.M{"$filter": bson.M{
+				"input": "$sentTimes",
+				"as":    "t",
+				"cond":  bson.M{"$gt": bson.A{"$$t", "$firstIn"}},
+			}}},
+		}},
+		{"$match": bson.M{"firstReply": bson.M{"$ne": nil}}},
+		{"$project": bson.M{
+			"_id":    0,
+			"millis": bson.M{"$subtract": bson.A{"$firstReply", "$firstIn"}},
+		}},
+		{"$sort": bson.M{"millis": 1}},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return models.ResponseTimeStats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Millis int64 `bson:"millis"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return models.ResponseTimeStats{}, err
+	}
+
+	durations := make([]time.Duration, len(results))
+	for i, res := range results {
+		durations[i] = time.Duration(res.Millis) * time.Millisecond
+	}
+	return responseTimeStats(durations), nil
+}
+
+// responseTimeStats summarizes reply delays sorted in ascending order
+func responseTimeStats(sorted []time.Duration) models.ResponseTimeStats {
+	stats := models.ResponseTimeStats{
+		RepliedThreads: len(sorted),
+		Buckets: []models.ResponseTimeBucket{
+			{Bucket: models.ResponseUnderHour},
+			{Bucket: models.ResponseUnder4h},
+			{Bucket: models.ResponseSameDay},
+			{Bucket: models.ResponseOverDay},
+		},
+	}
+	if len(sorted) == 0 {
+		return stats
+	}
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+		switch {
+		case d < time.Hour:
+			stats.Buckets[0].Count++
+		case d < 4*time.Hour:
+			stats.Buckets[1].Count++
+		case d < 24*time.Hour:
+			stats.Buckets[2].Count++
+		default:
+			stats.Buckets[3].Count++
+		}
+	}
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	stats.MedianSeconds = int64(median / time.Second)
+	stats.AverageSeconds = int64(sum / time.Duration(len(sorted)) / time.Second)
+	return stats
+}
+
+// GetSnoozeStats counts the emails in the Snoozed column by when they wake up: by the end of
+// today (overdue ones included), by the end of the week (weeks start on Monday) or later, with
+// days in loc
+func (r *StatisticsRepository) GetSnoozeStats(ctx context.Context, userID string, loc *time.Location) (models.SnoozeStats, error) {
+	now := time.Now().In(loc)
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	// next Monday; the same as endOfToday on a Sunday
+	endOfWeek := endOfToday.AddDate(0, 0, (7-int(now.Weekday()))%7)
+
+	// emails snoozed without a wake-up time count as later
+	wakeAt := bson.M{"$ifNull": bson.A{"$snoozedUntil", endOfWeek}}
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"userId":    userID,
+			"status":    models.StatusSnoozed,
+			"labels":    bson.M{"$ne": "TRASH"},
+			"mailboxId": bson.M{"$ne": "TRASH"},
+			"deletedAt": nil,
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$lt": bson.A{wakeAt, endOfToday}}, "then": models.SnoozeWakeToday},
+					bson.M{"case": bson.M{"$lt": bson.A{wakeAt, endOfWeek}}, "then": models.SnoozeWakeThisWeek},
+				},
+				"default": models.SnoozeWakeLater,
+			}},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.emailCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return models.SnoozeStats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Bucket string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return models.SnoozeStats{}, err
+	}
+
+	stats := models.SnoozeStats{Buckets: []models.SnoozeWakeBucket{
+		{Bucket: models.SnoozeWakeToday},
+		{Bucket: models.SnoozeWakeThisWeek},
+		{Bucket: models.SnoozeWakeLater},
+	}}
+	for _, res := range results {
+		stats.Snoozed += res.Count
+		for i := range stats.Buckets {
+			if stats.Buckets[i].Bucket == res.Bucket {
+				stats.Buckets[i].Count = res.Count
+			}
+		}
+	}
+	return stats, nil
+}
+
+// GetSummaryCoverage counts the visible emails and those with an AI summary
+func (r *StatisticsRepository) GetSummaryCoverage(ctx context.Context, userID string) (models.SummaryCoverage, error) {
+	filter := bson.M{
+		"userId":    userID,
+		"labels":    bson.M{"$ne": "TRASH"},
+		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
+	}
+	total, err := r.emailCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return models.SummaryCoverage{}, err
+	}
+
+	filter["summary"] = bson.M{"$nin": bson.A{"", nil}}
+	summarized, err := r.emailCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return models.SummaryCoverage{}, err
+	}
+
+	coverage := models.SummaryCoverage{Summarized: int(summarized), Total: int(total)}
+	if total > 0 {
+		coverage.Percentage = math.Round(float64(summarized)*1000/float64(total)) / 10
+	}
+	return coverage, nil
+}
+
 // GetTotalAndUnread returns total email count and unread count
 func (r *StatisticsRepository) GetTotalAndUnread(ctx context.Context, userID string) (total int, unread int, starred int, err error) {
 	baseFilter := bson.M{
 		"userId":    userID,
 		"labels":    bson.M{"$ne": "TRASH"},
 		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
 	}
 
 	// Total count
@@ -195,6 +490,7 @@ func (r *StatisticsRepository) GetTotalAndUnread(ctx context.Context, userID str
 		"isRead":    false,
 		"labels":    bson.M{"$ne": "TRASH"},
 		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
 	}
 	unreadCount, err := r.emailCollection.CountDocuments(ctx, unreadFilter)
 	if err != nil {
@@ -207,6 +503,7 @@ func (r *StatisticsRepository) GetTotalAndUnread(ctx context.Context, userID str
 		"isStarred": true,
 		"labels":    bson.M{"$ne": "TRASH"},
 		"mailboxId": bson.M{"$ne": "TRASH"},
+		"deletedAt": nil,
 	}
 	starredCount, err := r.emailCollection.CountDocuments(ctx, starredFilter)
 	if err != nil {
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SummaryCacheTTL is how long a cached LLM summary stays valid
+const SummaryCacheTTL = 30 * 24 * time.Hour
+
+// SummaryCacheRepository stores LLM summaries keyed by body hash and model, so identical
+// newsletters/notifications are summarized once across all users
+type SummaryCacheRepository struct {
+	collection *mongo.Collection
+}
+
+type summaryCacheEntry struct {
+	Key       string    `bson:"_id"` // "<model>:<sha256>"
+	Summary   string    `bson:"summary"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// NewSummaryCacheRepository creates a new repository
+func NewSummaryCacheRepository(db *mongo.Database) *SummaryCacheRepository {
+	r := &SummaryCacheRepository{
+		collection: db.Collection("summary_cache"),
+	}
+
+	// TTL index: Mongo removes entries SummaryCacheTTL after creation
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("idx_created_at_ttl").SetExpireAfterSeconds(int32(SummaryCacheTTL.Seconds())),
+	})
+
+	return r
+}
+
+func summaryCacheKey(hash, model string) string {
+	return model + ":" + hash
+}
+
+// Get returns the cached summary, or ok=false on a miss. Entries past the TTL count as misses
+// even if the TTL monitor hasn't removed them yet.
+func (r *SummaryCacheRepository) Get(ctx context.Context, hash, model string) (string, bool, error) {
+	filter := bson.M{
+		"_id":       summaryCacheKey(hash, model),
+		"createdAt": bson.M{"$gt": time.Now().Add(-SummaryCacheTTL)},
+	}
+	var entry summaryCacheEntry
+	if err := r.collection.FindOne(ctx, filter).Decode(&entry); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return entry.Summary, true, nil
+}
+
+// Put stores (or refreshes) a summary for the hash and model
+func (r *SummaryCacheRepository) Put(ctx context.Context, hash, model, summary string) error {
+	key := summaryCacheKey(hash, model)
+	entry := summaryCacheEntry{Key: key, Summary: summary, CreatedAt: time.Now()}
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SummaryJobRepository persists the auto-summarize job queue so restarts don't lose work.
+// Jobs are keyed by email ID, so enqueueing the same email twice is a no-op.
+type SummaryJobRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSummaryJobRepository creates a new repository
+func NewSummaryJobRepository(db *mongo.Database) *SummaryJobRepository {
+	r := &SummaryJobRepository{
+		collection: db.Collection("summary_jobs"),
+	}
+
+	// Ensure indexes
+	ctx := context.Background()
+	idxView := r.collection.Indexes()
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextRunAt", Value: 1}},
+		Options: options.Index().SetName("idx_status_next_run"),
+	})
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}},
+		Options: options.Index().SetName("idx_user_status"),
+	})
+
+	return r
+}
+
+// EnqueueMany adds a pending job for each email that doesn't have one yet
+func (r *SummaryJobRepository) EnqueueMany(ctx context.Context, userID string, emailIDs []string) error {
+	if len(emailIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	operations := make([]mongo.WriteModel, 0, len(emailIDs))
+	for _, id := range emailIDs {
+		op := mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$setOnInsert": models.SummaryJob{
+				EmailID:   id,
+				UserID:    userID,
+				Status:    models.JobPending,
+				NextRunAt: now,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}}).
+			SetUpsert(true)
+		operations = append(operations, op)
+	}
+
+	_, err := r.collection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// ClaimNext marks the oldest due pending job as processing and returns it.
+// Returns mongo.ErrNoDocuments when the queue is empty.
+func (r *SummaryJobRepository) ClaimNext(ctx context.Context, now time.Time) (*models.SummaryJob, error) {
+	filter := bson.M{"status": models.JobPending, "nextRunAt": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"status": models.JobProcessing, "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextRunAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.SummaryJob
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Finish records a terminal status (done or skipped) for a job
+func (r *SummaryJobRepository) Finish(ctx context.Context, emailID string, status models.SummaryJobStatus) error {
+	update := bson.M{
+		"$set":   bson.M{"status": status, "updatedAt": time.Now()},
+		"$unset": bson.M{"lastError": ""},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": emailID}, update)
+	return err
+}
+
+// Retry puts a failed job back in the queue after backoff, or marks it permanently failed
+// once it has used maxAttempts
+func (r *SummaryJobRepository) Retry(ctx context.Context, job *models.SummaryJob, cause error, maxAttempts int, backoff time.Duration) error {
+	now := time.Now()
+	set := bson.M{"lastError": cause.Error(), "updatedAt": now}
+	if job.Attempts >= maxAttempts {
+		set["status"] = models.JobFailed
+	} else {
+		set["status"] = models.JobPending
+		set["nextRunAt"] = now.Add(backoff * time.Duration(job.Attempts))
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": job.EmailID}, bson.M{"$set": set})
+	return err
+}
+
+// RequeueProcessing returns jobs left in processing (e.g. by a crash) to the queue
+func (r *SummaryJobRepository) RequeueProcessing(ctx context.Context) (int64, error) {
+	res, err := r.collection.UpdateMany(ctx,
+		bson.M{"status": models.JobProcessing},
+		bson.M{"$set": bson.M{"status": models.JobPending, "nextRunAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// GetStats returns a user's job counts per status
+func (r *SummaryJobRepository) GetStats(ctx context.Context, userID string) (models.SummaryQueueStats, error) {
+	var stats models.SummaryQueueStats
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userID}},
+		{"$group": bson.M{
+			"_id":   "$status",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			Status models.SummaryJobStatus `bson:"_id"`
+			Count  int                     `bson:"count"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return stats, err
+		}
+		switch doc.Status {
+		case models.JobPending:
+			stats.Pending = doc.Count
+		case models.JobProcessing:
+			stats.Processing = doc.Count
+		case models.JobDone:
+			stats.Done = doc.Count
+		case models.JobSkipped:
+			stats.Skipped = doc.Count
+		case models.JobFailed:
+			stats.Failed = doc.Count
+		}
+	}
+	return stats, cursor.Err()
+}
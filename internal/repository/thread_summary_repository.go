@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ThreadSummaryRepository stores one rolling summary per user thread
+type ThreadSummaryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewThreadSummaryRepository creates a new repository
+func NewThreadSummaryRepository(db *mongo.Database) *ThreadSummaryRepository {
+	return &ThreadSummaryRepository{
+		collection: db.Collection("thread_summaries"),
+	}
+}
+
+func threadSummaryKey(userID, threadID string) string {
+	return userID + ":" + threadID
+}
+
+// Get returns the stored summary for a thread, or mongo.ErrNoDocuments
+func (r *ThreadSummaryRepository) Get(ctx context.Context, userID, threadID string) (*models.ThreadSummary, error) {
+	var ts models.ThreadSummary
+	if err := r.collection.FindOne(ctx, bson.M{"_id": threadSummaryKey(userID, threadID)}).Decode(&ts); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// Put replaces the stored summary for the thread
+func (r *ThreadSummaryRepository) Put(ctx context.Context, ts *models.ThreadSummary) error {
+	ts.ID = threadSummaryKey(ts.UserID, ts.ThreadID)
+	ts.UpdatedAt = time.Now()
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": ts.ID}, ts, options.Replace().SetUpsert(true))
+	return err
+}
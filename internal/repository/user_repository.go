@@ -2,22 +2,81 @@ package repository
 
 import (
 	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/utils"
 	"context"
+	"errors"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository struct {
 	collection *mongo.Collection
+	// cipher encrypts Google tokens at rest; nil stores them as plaintext
+	cipher *utils.TokenCipher
 }
 
-func NewUserRepository(db *mongo.Database) *UserRepository {
-	return &UserRepository{
+// emailFoldCollation compares emails ignoring letter case; FindByEmailFold queries with it
+// so the idx_email_fold index serves the lookup
+var emailFoldCollation = &options.Collation{Locale: "en", Strength: 2}
+
+func NewUserRepository(db *mongo.Database, cipher *utils.TokenCipher) *UserRepository {
+	r := &UserRepository{
 		collection: db.Collection("users"),
+		cipher:     cipher,
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("idx_email_fold").SetCollation(emailFoldCollation),
+	})
+
+	return r
+}
+
+// encryptToken seals a Google token for storage (no-op when encryption is disabled)
+func (r *UserRepository) encryptToken(userID, token string) (string, error) {
+	if r.cipher == nil {
+		return token, nil
 	}
+	return r.cipher.Encrypt(userID, token)
+}
+
+// decryptTokens transparently opens the Google token fields of a loaded user.
+// Legacy plaintext values are returned unchanged.
+func (r *UserRepository) decryptTokens(user *models.User) error {
+	if r.cipher == nil {
+		return nil
+	}
+	userID := user.ID.Hex()
+	access, err := r.cipher.Decrypt(userID, user.GoogleAccessToken)
+	if err != nil {
+		return err
+	}
+	refresh, err := r.cipher.Decrypt(userID, user.GoogleRefreshToken)
+	if err != nil {
+		return err
+	}
+	user.GoogleAccessToken = access
+	user.GoogleRefreshToken = refresh
+	return nil
+}
+
+// findOne loads a single user and decrypts its tokens
+func (r *UserRepository) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, filter, opts...).Decode(&user); err != nil {
+		return nil, err
+	}
+	if err := r.decryptTokens(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
@@ -29,8 +88,22 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		user.ID = primitive.NewObjectID()
 	}
 
+	// Encrypt Google tokens on a copy so the caller keeps plaintext values
+	stored := *user
+	// Only email/password accounts sign in with a password
+	if stored.Provider != "email" {
+		stored.Password = ""
+	}
+	var err error
+	if stored.GoogleAccessToken, err = r.encryptToken(user.ID.Hex(), user.GoogleAccessToken); err != nil {
+		return err
+	}
+	if stored.GoogleRefreshToken, err = r.encryptToken(user.ID.Hex(), user.GoogleRefreshToken); err != nil {
+		return err
+	}
+
 	// Insert the user directly (MongoDB will use the _id field from the struct)
-	_, err := r.collection.InsertOne(ctx, user)
+	_, err = r.collection.InsertOne(ctx, &stored)
 	if err != nil {
 		return err
 	}
@@ -39,12 +112,13 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 }
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+// FindByEmailFold finds the user whose email equals email ignoring case, whichever
+// provider created the account
+func (r *UserRepository) FindByEmailFold(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email}, options.FindOne().SetCollation(emailFoldCollation))
 }
 
 func (r *UserRepository) FindByID(ctx context.Context, id string) (*models.User, error) {
@@ -53,21 +127,11 @@ func (r *UserRepository) FindByID(ctx context.Context, id string) (*models.User,
 		return nil, err
 	}
 
-	var user models.User
-	err = r.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	return r.findOne(ctx, bson.M{"_id": oid})
 }
 
 func (r *UserRepository) FindByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
-	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"googleId": googleID}).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	return r.findOne(ctx, bson.M{"googleId": googleID})
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
@@ -75,11 +139,10 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 
 	update := bson.M{
 		"$set": bson.M{
-			"email":        user.Email,
-			"name":         user.Name,
-			"picture":      user.Picture,
-			"refreshToken": user.RefreshToken,
-			"updatedAt":    user.UpdatedAt,
+			"email":     user.Email,
+			"name":      user.Name,
+			"picture":   user.Picture,
+			"updatedAt": user.UpdatedAt,
 		},
 	}
 
@@ -87,6 +150,8 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	return err
 }
 
+// UpdateRefreshToken stores the hash of the user's new app refresh token, dropping any
+// earlier ones (login, signup); an empty refreshToken revokes them all (logout)
 func (r *UserRepository) UpdateRefreshToken(ctx context.Context, userID, refreshToken string) error {
 	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
@@ -94,25 +159,86 @@ func (r *UserRepository) UpdateRefreshToken(ctx context.Context, userID, refresh
 	}
 
 	update := bson.M{
-		"$set": bson.M{
-			"refreshToken": refreshToken,
-			"updatedAt":    time.Now(),
-		},
+		"$set":   bson.M{"updatedAt": time.Now()},
+		"$unset": bson.M{"refreshToken": "", "recentRefreshTokens": ""},
+	}
+	if refreshToken == "" {
+		update["$unset"].(bson.M)["refreshTokenHash"] = ""
+	} else {
+		update["$set"].(bson.M)["refreshTokenHash"] = utils.HashToken(refreshToken)
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	return err
 }
 
+// RotateRefreshToken replaces the user's refresh token with next if presented is the
+// current one, or one rotated out less than reuseWindow ago. The current token stays
+// accepted for reuseWindow so a retried refresh still succeeds; at most keep rotated tokens
+// are remembered. It reports false, changing nothing, when presented is not accepted.
+func (r *UserRepository) RotateRefreshToken(ctx context.Context, userID, presented, next string, reuseWindow time.Duration, keep int) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	presentedHash := utils.HashToken(presented)
+	filter := bson.M{
+		"_id": oid,
+		"$or": []bson.M{
+			{"refreshTokenHash": presentedHash},
+			{"recentRefreshTokens": bson.M{"$elemMatch": bson.M{"hash": presentedHash, "validUntil": bson.M{"$gt": now}}}},
+			// stored before tokens were hashed
+			{"refreshTokenHash": nil, "refreshToken": presented},
+		},
+	}
+
+	// Still-valid rotated tokens plus the current one, newest last
+	recent := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$recentRefreshTokens", bson.A{}}},
+		"cond":  bson.M{"$gt": bson.A{"$$this.validUntil", now}},
+	}}
+	if reuseWindow > 0 {
+		recent = bson.M{"$concatArrays": bson.A{
+			recent,
+			bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$refreshTokenHash", ""}}, ""}},
+				bson.A{bson.M{"hash": "$refreshTokenHash", "validUntil": now.Add(reuseWindow)}},
+				bson.A{},
+			}},
+		}}
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"recentRefreshTokens": bson.M{"$slice": bson.A{recent, -keep}},
+			"refreshTokenHash":    utils.HashToken(next),
+			"updatedAt":           now,
+		}}},
+		{{Key: "$unset", Value: "refreshToken"}},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
 func (r *UserRepository) UpdateGoogleTokens(ctx context.Context, userID, accessToken, refreshToken string, expiry time.Time) error {
 	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return err
 	}
 
+	encAccess, err := r.encryptToken(userID, accessToken)
+	if err != nil {
+		return err
+	}
+
 	update := bson.M{
 		"$set": bson.M{
-			"googleAccessToken": accessToken,
+			"googleAccessToken": encAccess,
 			"googleTokenExpiry": expiry,
 			"updatedAt":         time.Now(),
 		},
@@ -120,9 +246,180 @@ func (r *UserRepository) UpdateGoogleTokens(ctx context.Context, userID, accessT
 
 	// Only update refresh token if it's provided (it might not be returned in every exchange)
 	if refreshToken != "" {
-		update["$set"].(bson.M)["googleRefreshToken"] = refreshToken
+		encRefresh, err := r.encryptToken(userID, refreshToken)
+		if err != nil {
+			return err
+		}
+		update["$set"].(bson.M)["googleRefreshToken"] = encRefresh
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+// ListWatchesDue returns users with Gmail push enabled whose watch expires before the given
+// time. Users whose tokens can't be decrypted are logged and left out.
+func (r *UserRepository) ListWatchesDue(ctx context.Context, before time.Time) ([]models.User, error) {
+	filter := bson.M{
+		"gmailWatchEnabled": true,
+		"$or": []bson.M{
+			{"gmailWatchExpiry": bson.M{"$exists": false}},
+			{"gmailWatchExpiry": bson.M{"$lte": before}},
+		},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	// One unreadable user (e.g. a retired key) must not stop the renewal of the others
+	due := users[:0]
+	for _, user := range users {
+		if err := r.decryptTokens(&user); err != nil {
+			log.Printf("list watches due: skipping user %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		due = append(due, user)
+	}
+	return due, nil
+}
+
+// UpdateGmailWatch stores the expiry returned by Users.Watch. The history ID is only recorded
+// when none is stored yet: once set it belongs to the incremental sync, and moving it forward
+// here would skip unsynced changes.
+func (r *UserRepository) UpdateGmailWatch(ctx context.Context, userID string, expiry time.Time, historyID uint64) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"gmailWatchExpiry": expiry,
+			"updatedAt":        time.Now(),
+		},
+	}
+	if _, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update); err != nil {
+		return err
+	}
+
+	noHistory := bson.M{"_id": oid, "gmailHistoryId": bson.M{"$in": []interface{}{nil, 0}}}
+	_, err = r.collection.UpdateOne(ctx, noHistory, bson.M{"$set": bson.M{"gmailHistoryId": historyID}})
+	return err
+}
+
+// UpdateSettings applies the settings present in req
+func (r *UserRepository) UpdateSettings(ctx context.Context, userID string, req *models.UpdateSettingsRequest) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	if req.PriorityHeuristicsOnly != nil {
+		set["priorityHeuristicsOnly"] = *req.PriorityHeuristicsOnly
+	}
+	if req.TimeZone != nil {
+		set["timezone"] = *req.TimeZone
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": set})
+	return err
+}
+
+// SetGmailWatchEnabled turns Gmail push on or off for a user. Disabling also clears the
+// watch expiry so the renewal worker ignores the user.
+func (r *UserRepository) SetGmailWatchEnabled(ctx context.Context, userID string, enabled bool) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"gmailWatchEnabled": enabled,
+			"updatedAt":         time.Now(),
+		},
+	}
+	if !enabled {
+		update["$unset"] = bson.M{"gmailWatchExpiry": ""}
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+// UpdateHistoryID stores the Gmail history ID the next incremental sync resumes from
+func (r *UserRepository) UpdateHistoryID(ctx context.Context, userID string, historyID uint64) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"gmailHistoryId": historyID,
+			"updatedAt":      time.Now(),
+		},
 	}
 
 	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	return err
 }
+
+// EncryptLegacyTokens encrypts Google token fields still stored as plaintext (no key-ID prefix).
+// Returns the number of users updated. Used by the one-off cmd/migrate-tokens command.
+func (r *UserRepository) EncryptLegacyTokens(ctx context.Context) (int, error) {
+	if r.cipher == nil {
+		return 0, errors.New("token encryption is not configured")
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"$or": []bson.M{
+		{"googleAccessToken": bson.M{"$exists": true, "$ne": ""}},
+		{"googleRefreshToken": bson.M{"$exists": true, "$ne": ""}},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return updated, err
+		}
+
+		set := bson.M{}
+		userID := user.ID.Hex()
+		if user.GoogleAccessToken != "" && !utils.IsEncrypted(user.GoogleAccessToken) {
+			enc, err := r.cipher.Encrypt(userID, user.GoogleAccessToken)
+			if err != nil {
+				return updated, err
+			}
+			set["googleAccessToken"] = enc
+		}
+		if user.GoogleRefreshToken != "" && !utils.IsEncrypted(user.GoogleRefreshToken) {
+			enc, err := r.cipher.Encrypt(userID, user.GoogleRefreshToken)
+			if err != nil {
+				return updated, err
+			}
+			set["googleRefreshToken"] = enc
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, cursor.Err()
+}
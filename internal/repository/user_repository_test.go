@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/testutil"
+	"aiemailbox-be/internal/utils"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func testCipher(t *testing.T, keyID string, b byte) *utils.TokenCipher {
+	t.Helper()
+	c, err := utils.NewTokenCipher(keyID, map[string][]byte{keyID: bytes.Repeat([]byte{b}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDecryptTokensLegacyPlaintext(t *testing.T) {
+	r := &UserRepository{cipher: testCipher(t, "k1", 1)}
+	user := models.User{ID: primitive.NewObjectID(), GoogleAccessToken: "ya29.plain", GoogleRefreshToken: "1//plain"}
+	if err := r.decryptTokens(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.GoogleAccessToken != "ya29.plain" || user.GoogleRefreshToken != "1//plain" {
+		t.Errorf("legacy tokens changed to %q, %q", user.GoogleAccessToken, user.GoogleRefreshToken)
+	}
+}
+
+func TestDecryptTokensMixed(t *testing.T) {
+	c := testCipher(t, "k1", 1)
+	r := &UserRepository{cipher: c}
+	id := primitive.NewObjectID()
+	enc, _ := c.Encrypt(id.Hex(), "ya29.secret")
+	user := models.User{ID: id, GoogleAccessToken: enc, GoogleRefreshToken: "1//plain"}
+	if err := r.decryptTokens(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.GoogleAccessToken != "ya29.secret" || user.GoogleRefreshToken != "1//plain" {
+		t.Errorf("tokens = %q, %q", user.GoogleAccessToken, user.GoogleRefreshToken)
+	}
+}
+
+func TestUserTokensEncryptedAtRest(t *testing.T) {
+	db := testutil.MongoDB(t)
+	c := testCipher(t, "k1", 1)
+	repo := NewUserRepository(db, c)
+	ctx := context.Background()
+
+	// A user stored before encryption existed
+	id := primitive.NewObjectID()
+	if _, err := db.Collection("users").InsertOne(ctx, bson.M{
+		"_id": id, "email": "legacy@example.com", "googleAccessToken": "ya29.plain", "googleRefreshToken": "1//plain",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.FindByID(ctx, id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GoogleAccessToken != "ya29.plain" || user.GoogleRefreshToken != "1//plain" {
+		t.Errorf("legacy read = %q, %q", user.GoogleAccessToken, user.GoogleRefreshToken)
+	}
+
+	n, err := repo.EncryptLegacyTokens(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("EncryptLegacyTokens = %d, %v; want 1", n, err)
+	}
+	var raw bson.M
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"googleAccessToken", "googleRefreshToken"} {
+		if s, _ := raw[field].(string); !utils.IsEncrypted(s) {
+			t.Errorf("%s stored as %q after migration", field, s)
+		}
+	}
+	if n, _ := repo.EncryptLegacyTokens(ctx); n != 0 {
+		t.Errorf("second migration updated %d users", n)
+	}
+
+	user, err = repo.FindByID(ctx, id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GoogleAccessToken != "ya29.plain" || user.GoogleRefreshToken != "1//plain" {
+		t.Errorf("read after migration = %q, %q", user.GoogleAccessToken, user.GoogleRefreshToken)
+	}
+}
+
+func TestListWatchesDueSkipsUndecryptable(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	good := primitive.NewObjectID()
+	bad := primitive.NewObjectID()
+	goodToken, _ := testCipher(t, "k1", 1).Encrypt(good.Hex(), "1//good")
+	// Sealed with a key the repository doesn't have
+	badToken, _ := testCipher(t, "k1", 2).Encrypt(bad.Hex(), "1//bad")
+	users := []interface{}{
+		bson.M{"_id": good, "email": "good@example.com", "gmailWatchEnabled": true, "gmailWatchExpiry": now, "googleRefreshToken": goodToken},
+		bson.M{"_id": bad, "email": "bad@example.com", "gmailWatchEnabled": true, "gmailWatchExpiry": now, "googleRefreshToken": badToken},
+		bson.M{"_id": primitive.NewObjectID(), "email": "later@example.com", "gmailWatchEnabled": true, "gmailWatchExpiry": now.Add(72 * time.Hour)},
+	}
+	if _, err := db.Collection("users").InsertMany(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := NewUserRepository(db, testCipher(t, "k1", 1)).ListWatchesDue(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != good || due[0].GoogleRefreshToken != "1//good" {
+		t.Errorf("due = %+v, want only the decryptable user", due)
+	}
+}
+
+func TestFindByEmailFold(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := NewUserRepository(db, nil)
+	ctx := context.Background()
+
+	google := &models.User{Email: "Alice.Smith@Example.com", Provider: "google", GoogleID: "g-1"}
+	if err := repo.Create(ctx, google); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"alice.smith@example.com", "ALICE.SMITH@EXAMPLE.COM", "Alice.Smith@Example.com"} {
+		user, err := repo.FindByEmailFold(ctx, email)
+		if err != nil || user.ID != google.ID {
+			t.Errorf("FindByEmailFold(%q) = %v, %v; want the Google account", email, user, err)
+		}
+	}
+	// Regex and query operators are plain text
+	for _, email := range []string{"alice.smith@example.co", "alice_smith@example.com", "alice.smith@example.com|x", ".*", "^alice.*$"} {
+		if _, err := repo.FindByEmailFold(ctx, email); err != mongo.ErrNoDocuments {
+			t.Errorf("FindByEmailFold(%q) err = %v, want ErrNoDocuments", email, err)
+		}
+	}
+
+	// The lookup is served by the case-insensitive index
+	var plan bson.M
+	cmd := bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: "users"},
+			{Key: "filter", Value: bson.M{"email": "alice.smith@example.com"}},
+			{Key: "collation", Value: bson.M{"locale": "en", "strength": 2}},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+	if err := db.RunCommand(ctx, cmd).Decode(&plan); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := bson.MarshalExtJSON(plan, false, false); !bytes.Contains(out, []byte("idx_email_fold")) {
+		t.Errorf("query plan does not use idx_email_fold: %s", out)
+	}
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// webhookDeliveryRetention is how long delivery records are kept for the delivery log
+const webhookDeliveryRetention = 30 * 24 * time.Hour
+
+// WebhookDeliveryRepository persists the outbound webhook queue so restarts don't lose
+// deliveries, and keeps finished ones as a delivery log
+type WebhookDeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewWebhookDeliveryRepository creates the repository and its indexes
+func NewWebhookDeliveryRepository(db *mongo.Database) *WebhookDeliveryRepository {
+	r := &WebhookDeliveryRepository{
+		collection: db.Collection("webhook_deliveries"),
+	}
+
+	ctx := context.Background()
+	idxView := r.collection.Indexes()
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextRunAt", Value: 1}},
+		Options: options.Index().SetName("idx_status_next_run"),
+	})
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("idx_user_id"),
+	})
+	_, _ = idxView.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("idx_created_at_ttl").SetExpireAfterSeconds(int32(webhookDeliveryRetention.Seconds())),
+	})
+
+	return r
+}
+
+// Enqueue adds a pending delivery due now; d.ID is kept when set
+func (r *WebhookDeliveryRepository) Enqueue(ctx context.Context, d *models.WebhookDelivery) error {
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	now := time.Now()
+	d.Status = models.DeliveryPending
+	d.NextRunAt = now
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	_, err := r.collection.InsertOne(ctx, d)
+	return err
+}
+
+// ClaimNext marks the oldest due pending delivery as processing and returns it.
+// Returns mongo.ErrNoDocuments when nothing is due.
+func (r *WebhookDeliveryRepository) ClaimNext(ctx context.Context, now time.Time) (*models.WebhookDelivery, error) {
+	filter := bson.M{"status": models.DeliveryPending, "nextRunAt": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"status": models.DeliveryProcessing, "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextRunAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var d models.WebhookDelivery
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Finish records a terminal status for a delivery: delivered, or failed without retries
+// (e.g. the webhook was removed)
+func (r *WebhookDeliveryRepository) Finish(ctx context.Context, id primitive.ObjectID, status models.WebhookDeliveryStatus, statusCode int, cause string) error {
+	update := bson.M{"$set": bson.M{
+		"status":         status,
+		"lastStatusCode": statusCode,
+		"lastError":      cause,
+		"updatedAt":      time.Now(),
+	}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Retry puts a failed delivery back in the queue after backoff, or marks it failed once it
+// has used maxAttempts. Returns the status it was left in.
+func (r *WebhookDeliveryRepository) Retry(ctx context.Context, d *models.WebhookDelivery, statusCode int, cause string, maxAttempts int, backoff time.Duration) (models.WebhookDeliveryStatus, error) {
+	now := time.Now()
+	set := bson.M{"lastStatusCode": statusCode, "lastError": cause, "updatedAt": now}
+	status := models.DeliveryPending
+	if d.Attempts >= maxAttempts {
+		status = models.DeliveryFailed
+	} else {
+		set["nextRunAt"] = now.Add(backoff)
+	}
+	set["status"] = status
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": set})
+	return status, err
+}
+
+// RequeueProcessing returns deliveries left in processing (e.g. by a crash) to the queue
+func (r *WebhookDeliveryRepository) RequeueProcessing(ctx context.Context) (int64, error) {
+	res, err := r.collection.UpdateMany(ctx,
+		bson.M{"status": models.DeliveryProcessing},
+		bson.M{"$set": bson.M{"status": models.DeliveryPending, "nextRunAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// CancelPending fails userID's queued deliveries, e.g. when the webhook is deleted
+func (r *WebhookDeliveryRepository) CancelPending(ctx context.Context, userID, cause string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"userId": userID, "status": models.DeliveryPending},
+		bson.M{"$set": bson.M{"status": models.DeliveryFailed, "lastError": cause, "updatedAt": time.Now()}},
+	)
+	return err
+}
+
+// List returns userID's latest deliveries, newest first
+func (r *WebhookDeliveryRepository) List(ctx context.Context, userID string, limit int) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebhookRepository stores users' outbound webhooks, one per user
+type WebhookRepository struct {
+	collection *mongo.Collection
+}
+
+// NewWebhookRepository creates the repository and its indexes
+func NewWebhookRepository(db *mongo.Database) *WebhookRepository {
+	r := &WebhookRepository{
+		collection: db.Collection("webhooks"),
+	}
+
+	ctx := context.Background()
+	_, _ = r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}},
+		Options: options.Index().SetName("idx_user_id_unique").SetUnique(true),
+	})
+
+	return r
+}
+
+// Get returns userID's webhook, or mongo.ErrNoDocuments
+func (r *WebhookRepository) Get(ctx context.Context, userID string) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := r.collection.FindOne(ctx, bson.M{"userId": userID}).Decode(&hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// Save creates or updates userID's webhook. secret is only stored when the webhook is
+// created; created reports whether it was.
+func (r *WebhookRepository) Save(ctx context.Context, userID, url string, events []models.WebhookEvent, enabled bool, secret string) (hook *models.Webhook, created bool, err error) {
+	now := time.Now()
+	if events == nil {
+		events = []models.WebhookEvent{}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"url":       url,
+			"events":    events,
+			"enabled":   enabled,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{"secret": secret, "createdAt": now},
+	}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, false, err
+	}
+	hook, err = r.Get(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return hook, res.UpsertedCount > 0, nil
+}
+
+// RotateSecret replaces the secret of userID's webhook; mongo.ErrNoDocuments when there is
+// none
+func (r *WebhookRepository) RotateSecret(ctx context.Context, userID, secret string) (*models.Webhook, error) {
+	update := bson.M{"$set": bson.M{"secret": secret, "updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var hook models.Webhook
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"userId": userID}, update, opts).Decode(&hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// Delete removes userID's webhook; mongo.ErrNoDocuments when there is none
+func (r *WebhookRepository) Delete(ctx context.Context, userID string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RecordAttempt stores the outcome of the latest delivery attempt on userID's webhook
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, userID string, status models.WebhookDeliveryStatus, statusCode int, cause string, at time.Time) error {
+	update := bson.M{"$set": bson.M{
+		"lastStatus":     status,
+		"lastStatusCode": statusCode,
+		"lastError":      cause,
+		"lastDeliveryAt": at,
+	}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"userId": userID}, update)
+	return err
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// actionItemAttempts is how many times the LLM is asked before falling back to local extraction
+const actionItemAttempts = 2
+
+// maxActionItems caps how many items are stored per email
+const maxActionItems = 10
+
+// ActionItemService extracts concrete asks (title, due date, assignee) from emails
+type ActionItemService struct {
+	repo *repository.EmailRepository
+	llm  LLMProvider // nil uses the local extractor only
+}
+
+// NewActionItemService creates a new action item service
+func NewActionItemService(repo *repository.EmailRepository, llm LLMProvider) *ActionItemService {
+	return &ActionItemService{repo: repo, llm: llm}
+}
+
+// ExtractAndSave extracts action items from a stored email and saves them on the email document
+func (s *ActionItemService) ExtractAndSave(ctx context.Context, emailID string) ([]models.ActionItem, error) {
+	email, err := s.repo.GetByID(ctx, emailID)
+	if err != nil {
+		return nil, err
+	}
+	text := email.Body
+	if strings.TrimSpace(text) == "" {
+		text = email.Preview
+	}
+
+	items := s.Extract(ctx, email.Subject, utils.SanitizeHTML(text), email.ReceivedAt)
+	if err := s.repo.SetActionItems(ctx, emailID, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Extract returns the action items in text. The LLM is re-prompted once on malformed JSON;
+// the local extractor is the final fallback.
+func (s *ActionItemService) Extract(ctx context.Context, subject, text string, received time.Time) []models.ActionItem {
+	if strings.TrimSpace(text) == "" {
+		return []models.ActionItem{}
+	}
+
+	if s.llm != nil {
+		prompt := buildActionItemPrompt(subject, text, received)
+		for attempt := 0; attempt < actionItemAttempts; attempt++ {
+			out, err := s.llm.Generate(withOperation(ctx, "action_items"), LLMRequest{
+				System:      "You extract action items from emails. Reply with JSON only, no prose and no code fences.",
+				Prompt:      prompt,
+				MaxTokens:   400,
+				Temperature: 0,
+			})
+			if err != nil {
+				fmt.Printf("%s action items failed, falling back: %v\n", s.llm.Name(), err)
+				break
+			}
+			items, perr := parseActionItems(out)
+			if perr == nil {
+				return items
+			}
+			// Re-prompt with the parse error so the model can correct itself
+			prompt = buildActionItemPrompt(subject, text, received) +
+				fmt.Sprintf("\n\nYour previous reply was not valid (%v). Reply with ONLY the JSON array.", perr)
+		}
+	}
+
+	return extractActionItemsLocal(text)
+}
+
+func buildActionItemPrompt(subject, text string, received time.Time) string {
+	return fmt.Sprintf(`List the concrete tasks the recipient is asked to do in this email.
+Return a JSON array of objects: [{"title": string, "dueDate": "YYYY-MM-DD" (optional), "assignee": string (optional)}].
+Resolve relative dates against the received date %s. Return [] if there are no tasks.
+
+Subject: %s
+
+%s`, received.Format("2006-01-02"), subject, text)
+}
+
+// jsonFenceRE matches a ```json ... ``` wrapper some models add despite instructions
+var jsonFenceRE = regexp.MustCompile("(?s)^```(?:json)?\\s*(.*?)\\s*```$")
+
+// parseActionItems parses and validates the model's JSON. Items without a title are dropped
+// and unparseable due dates are cleared.
+func parseActionItems(out string) ([]models.ActionItem, error) {
+	out = strings.TrimSpace(out)
+	if m := jsonFenceRE.FindStringSubmatch(out); m != nil {
+		out = m[1]
+	}
+
+	var raw []models.ActionItem
+	if err := utils.ParseJSON(out, &raw); err != nil {
+		return nil, err
+	}
+
+	items := []models.ActionItem{}
+	for _, it := range raw {
+		it.Title = strings.TrimSpace(it.Title)
+		if it.Title == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", it.DueDate); err != nil {
+			it.DueDate = ""
+		}
+		it.Assignee = strings.TrimSpace(it.Assignee)
+		items = append(items, it)
+		if len(items) == maxActionItems {
+			break
+		}
+	}
+	return items, nil
+}
+
+// ===== Local extractor (no API key) =====
+
+// actionCueRE matches imperative/request phrasing in English and Vietnamese
+var actionCueRE = regexp.MustCompile(`(?i)^(please|kindly|send|review|submit|confirm|reply|call|schedule|prepare|update|check|complete|sign|approve|fill|book|remember|don't forget|make sure)\b|\b(please|need to|needs to|must|should|could you|can you|would you|let me know|vui lòng|hãy|cần|làm ơn)\b`)
+
+// actionDateRE matches explicit or relative dates
+var actionDateRE = regexp.MustCompile(`(?i)\b(\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}(/\d{2,4})?|today|tomorrow|tonight|monday|tuesday|wednesday|thursday|friday|saturday|sunday|next week|end of (the )?(day|week|month)|eod|eow|deadline|hôm nay|ngày mai|tuần sau|hạn chót)\b`)
+
+// isoDateRE extracts a due date the local extractor can store as-is
+var isoDateRE = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b`)
+
+// extractActionItemsLocal returns sentences that contain a request or a date
+func extractActionItemsLocal(text string) []models.ActionItem {
+	items := []models.ActionItem{}
+	seen := map[string]bool{}
+	for _, sentence := range sentenceSplitRE.FindAllString(text, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if len(sentence) < 8 || seen[sentence] {
+			continue
+		}
+		if !actionCueRE.MatchString(sentence) && !actionDateRE.MatchString(sentence) {
+			continue
+		}
+		seen[sentence] = true
+
+		item := models.ActionItem{Title: sentence}
+		if m := isoDateRE.FindString(sentence); m != "" {
+			if _, err := time.Parse("2006-01-02", m); err == nil {
+				item.DueDate = m
+			}
+		}
+		items = append(items, item)
+		if len(items) == maxActionItems {
+			break
+		}
+	}
+	return items
+}
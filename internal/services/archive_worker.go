@@ -0,0 +1,53 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"log"
+	"time"
+)
+
+// StartAutoArchiveWorker starts a background goroutine that periodically archives the cards
+// of every column with autoArchiveDays set once they have been in it that long. The worker
+// stops when ctx is done.
+func StartAutoArchiveWorker(ctx context.Context, interval time.Duration, columns *repository.KanbanConfigRepository, repo *repository.EmailRepository) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("auto-archive worker: shutting down")
+				return
+			case <-ticker.C:
+				autoArchive(ctx, columns, repo)
+			}
+		}
+	}()
+}
+
+// autoArchive runs one pass of the auto-archive worker
+func autoArchive(ctx context.Context, columns *repository.KanbanConfigRepository, repo *repository.EmailRepository) {
+	cols, err := columns.AutoArchiveColumns(ctx)
+	if err != nil {
+		log.Println("auto-archive worker: error loading columns:", err)
+		return
+	}
+	now := time.Now()
+	var total int64
+	for _, col := range cols {
+		if ctx.Err() != nil {
+			return
+		}
+		n, err := repo.ArchiveBefore(ctx, col.UserID, col.Key, models.ArchiveCutoff(now, *col.AutoArchiveDays))
+		if err != nil {
+			log.Printf("auto-archive worker: error archiving column %s of user %s: %v", col.Key, col.UserID, err)
+			continue
+		}
+		total += n
+	}
+	if total > 0 {
+		log.Printf("auto-archive worker: archived %d cards", total)
+	}
+}
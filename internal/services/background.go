@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BackgroundTasks runs fire-and-forget work (e.g. syncing fetched emails to Mongo) detached
+// from the request but tied to the server lifetime: every task gets a context derived from
+// the server context with a per-task timeout, so shutdown cancels in-flight work promptly.
+type BackgroundTasks struct {
+	ctx     context.Context
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// NewBackgroundTasks creates a task runner bound to ctx (cancelled on shutdown)
+func NewBackgroundTasks(ctx context.Context, timeout time.Duration) *BackgroundTasks {
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	return &BackgroundTasks{ctx: ctx, timeout: timeout}
+}
+
+// Go runs fn in a goroutine. Tasks submitted after shutdown are dropped.
+func (b *BackgroundTasks) Go(fn func(ctx context.Context)) {
+	if b.ctx.Err() != nil {
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ctx, cancel := context.WithTimeout(b.ctx, b.timeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// Wait blocks until all tasks have finished or the timeout elapses.
+// Returns false if tasks were still running when it gave up.
+func (b *BackgroundTasks) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundTasksShutdownCancelsSync(t *testing.T) {
+	serverCtx, shutdown := context.WithCancel(context.Background())
+	tasks := NewBackgroundTasks(serverCtx, time.Hour)
+
+	started := make(chan struct{})
+	var taskErr atomic.Value
+	tasks.Go(func(ctx context.Context) {
+		close(started)
+		// Stands in for a long sync that only stops when its context is done
+		<-ctx.Done()
+		taskErr.Store(ctx.Err())
+	})
+	<-started
+
+	begin := time.Now()
+	shutdown()
+	if !tasks.Wait(time.Second) {
+		t.Fatal("in-flight task still running a second after shutdown")
+	}
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Errorf("task took %v to stop after shutdown", d)
+	}
+	if err, _ := taskErr.Load().(error); !errors.Is(err, context.Canceled) {
+		t.Errorf("task context error = %v, want context.Canceled", err)
+	}
+
+	// Work submitted after shutdown is dropped
+	var ran atomic.Bool
+	tasks.Go(func(context.Context) { ran.Store(true) })
+	if !tasks.Wait(time.Second) || ran.Load() {
+		t.Error("task submitted after shutdown ran")
+	}
+}
+
+func TestBackgroundTasksTimeout(t *testing.T) {
+	tasks := NewBackgroundTasks(context.Background(), 20*time.Millisecond)
+	done := make(chan error, 1)
+	tasks.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		done <- ctx.Err()
+	})
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("task context error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task was not stopped by its timeout")
+	}
+}
+
+func TestBackgroundTasksWaitGivesUp(t *testing.T) {
+	tasks := NewBackgroundTasks(context.Background(), time.Hour)
+	release := make(chan struct{})
+	defer close(release)
+	tasks.Go(func(context.Context) { <-release })
+	if tasks.Wait(20 * time.Millisecond) {
+		t.Error("Wait returned true while a task was still running")
+	}
+}
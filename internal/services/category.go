@@ -0,0 +1,175 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CategoryService assigns each synced email one of the fixed categories. The rules always
+// run; the LLM is only asked about emails the rules can't decide, and only when a provider
+// is configured and useLLM is on.
+type CategoryService struct {
+	llm    LLMProvider // nil without a provider
+	useLLM bool
+}
+
+// NewCategoryService creates the service; llm may be nil
+func NewCategoryService(llm LLMProvider, useLLM bool) *CategoryService {
+	return &CategoryService{llm: llm, useLLM: useLLM}
+}
+
+// UsesLLM reports whether Categorize may call the LLM
+func (s *CategoryService) UsesLLM() bool {
+	return s.llm != nil && s.useLLM
+}
+
+// Categorize returns the category of e. LLM failures fall back to the rule-based guess.
+func (s *CategoryService) Categorize(ctx context.Context, e *models.Email) models.EmailCategory {
+	category, confident := CategorizeByRules(e)
+	if confident || !s.UsesLLM() {
+		return category
+	}
+	c, err := s.llmCategory(ctx, e)
+	if err != nil {
+		fmt.Printf("category classification failed, using rules: %v\n", err)
+		return category
+	}
+	return c
+}
+
+// ===== Rules =====
+
+var (
+	billingSubjectRE      = regexp.MustCompile(`(?i)\b(invoice|receipt|payment (received|confirmation|due|failed)|your (order|bill|statement|subscription)|order (confirmation|#)|billing|refund|renewal|hóa đơn|biên lai|thanh toán)`)
+	billingSenderRE       = regexp.MustCompile(`(?i)^(billing|invoices?|receipts?|payments?|accounts?|orders?)([+.-]|$)`)
+	newsletterSubjectRE   = regexp.MustCompile(`(?i)\b(newsletter|digest|weekly|monthly|issue #?\d+|edition|roundup|bản tin)`)
+	notificationSubjectRE = regexp.MustCompile(`(?i)\b(notification|alert|security alert|new sign[- ]in|verification code|password (reset|changed)|mentioned you|commented on|assigned to you|pull request|build (failed|passed)|reminder|your account|thông báo|mã xác (minh|nhận))`)
+	// Local parts of list senders
+	marketingSenderRE = regexp.MustCompile(`(?i)^(newsletter|news|marketing|digest|hello|team)([+.-]|$)`)
+)
+
+// notificationDomains send almost exclusively automated notifications
+var notificationDomains = []string{"github.com", "gitlab.com", "atlassian.net", "slack.com", "accounts.google.com", "trello.com", "notion.so", "linear.app", "vercel.com", "sentry.io"}
+
+// categoryOrder breaks ties: the more specific category wins
+var categoryOrder = []models.EmailCategory{models.CategoryBilling, models.CategoryNotification, models.CategoryNewsletter, models.CategoryPersonal}
+
+// CategorizeByRules scores List-Unsubscribe, the sender and the subject:
+// billing +3 subject, +2 billing sender; newsletter +2 List-Unsubscribe, +2 subject, +2 bulk
+// mailing domain, +1 Gmail promotions/forums, +1 marketing sender; notification +2 automated
+// sender, +2 subject, +2 notification domain, +1 Gmail updates/social; personal +2 a person
+// writing without list headers, +1 Gmail personal. The best score wins; the result is
+// confident when it scores at least 3 and leads the runner-up by 2.
+func CategorizeByRules(e *models.Email) (models.EmailCategory, bool) {
+	scores := map[models.EmailCategory]int{}
+	subject := e.Subject
+	senderLocal, senderDomain := splitAddress(e.From.Email)
+	hasUnsubscribe := strings.TrimSpace(e.ListUnsubscribe) != ""
+	bulk := isBulkDomain(senderDomain)
+	automated := automatedSenderRE.MatchString(senderLocal)
+
+	if billingSubjectRE.MatchString(subject) {
+		scores[models.CategoryBilling] += 3
+	}
+	if billingSenderRE.MatchString(senderLocal) {
+		scores[models.CategoryBilling] += 2
+	}
+
+	if hasUnsubscribe {
+		scores[models.CategoryNewsletter] += 2
+	}
+	if newsletterSubjectRE.MatchString(subject) {
+		scores[models.CategoryNewsletter] += 2
+	}
+	if bulk {
+		scores[models.CategoryNewsletter] += 2
+	}
+	if e.HasLabel("CATEGORY_PROMOTIONS") || e.HasLabel("CATEGORY_FORUMS") {
+		scores[models.CategoryNewsletter]++
+	}
+	if marketingSenderRE.MatchString(senderLocal) {
+		scores[models.CategoryNewsletter]++
+	}
+
+	if automated {
+		scores[models.CategoryNotification] += 2
+	}
+	if notificationSubjectRE.MatchString(subject) {
+		scores[models.CategoryNotification] += 2
+	}
+	if isNotificationDomain(senderDomain) {
+		scores[models.CategoryNotification] += 2
+	}
+	if e.HasLabel("CATEGORY_UPDATES") || e.HasLabel("CATEGORY_SOCIAL") {
+		scores[models.CategoryNotification]++
+	}
+
+	if !hasUnsubscribe && !bulk && !automated && !billingSenderRE.MatchString(senderLocal) && senderDomain != "" {
+		scores[models.CategoryPersonal] += 2
+	}
+	if e.HasLabel("CATEGORY_PERSONAL") {
+		scores[models.CategoryPersonal]++
+	}
+
+	best, second := categoryOrder[0], 0
+	for _, c := range categoryOrder[1:] {
+		if scores[c] > scores[best] {
+			best = c
+		}
+	}
+	for _, c := range categoryOrder {
+		if c != best && scores[c] > second {
+			second = scores[c]
+		}
+	}
+	if scores[best] == 0 {
+		// nothing to go on: treat it as mail from a person
+		return models.CategoryPersonal, false
+	}
+	return best, scores[best] >= 3 && scores[best]-second >= 2
+}
+
+func isNotificationDomain(domain string) bool {
+	for _, d := range notificationDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ===== LLM =====
+
+func (s *CategoryService) llmCategory(ctx context.Context, e *models.Email) (models.EmailCategory, error) {
+	text := e.Preview
+	if text == "" {
+		text = stripHTML(e.Body)
+	}
+	if r := []rune(text); len(r) > 1000 {
+		text = string(r[:1000])
+	}
+	unsubscribe := "no"
+	if strings.TrimSpace(e.ListUnsubscribe) != "" {
+		unsubscribe = "yes"
+	}
+
+	out, err := s.llm.Generate(withOperation(ctx, "category"), LLMRequest{
+		System: `You sort emails. Answer with exactly one word:
+newsletter (mailing lists, marketing, digests), billing (invoices, receipts, orders, payments),
+notification (automated alerts, account and service notices) or personal (written by a person to the recipient).`,
+		Prompt:      fmt.Sprintf("From: %s <%s>\nList-Unsubscribe: %s\nSubject: %s\n\n%s", e.From.Name, e.From.Email, unsubscribe, e.Subject, text),
+		MaxTokens:   5,
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	c := models.EmailCategory(strings.ToLower(strings.Trim(strings.TrimSpace(out), ".!\"'`")))
+	if !models.ValidCategory(c) {
+		return "", fmt.Errorf("unexpected category %q", out)
+	}
+	return c, nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCategorizeByRules(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         models.Email
+		want          models.EmailCategory
+		wantConfident bool
+	}{
+		{"invoice from a billing address",
+			models.Email{From: models.EmailAddress{Email: "billing@shop.com"}, Subject: "Invoice #123 for March"},
+			models.CategoryBilling, true},
+		{"receipt through a bulk mailer",
+			models.Email{From: models.EmailAddress{Email: "receipts@mailgun.org"}, Subject: "Your receipt from Acme"},
+			models.CategoryBilling, true},
+		{"Vietnamese bill from an unknown address",
+			models.Email{From: models.EmailAddress{Email: "cskh@evn.com.vn"}, Subject: "Hóa đơn tiền điện tháng 5"},
+			models.CategoryBilling, false},
+		{"digest with List-Unsubscribe",
+			models.Email{From: models.EmailAddress{Email: "news@medium.com"}, Subject: "Weekly digest", ListUnsubscribe: "<mailto:u@medium.com>"},
+			models.CategoryNewsletter, true},
+		{"post from a bulk mailing domain",
+			models.Email{From: models.EmailAddress{Email: "writer@substack.com"}, Subject: "New post: On writing", ListUnsubscribe: "<https://substack.com/u>"},
+			models.CategoryNewsletter, true},
+		{"CI notification",
+			models.Email{From: models.EmailAddress{Email: "notifications@github.com"}, Subject: "[repo] Build failed", ListUnsubscribe: "<mailto:x@github.com>",
+				Labels: []string{"CATEGORY_UPDATES"}},
+			models.CategoryNotification, true},
+		{"security alert",
+			models.Email{From: models.EmailAddress{Email: "no-reply@accounts.google.com"}, Subject: "Security alert"},
+			models.CategoryNotification, true},
+		{"friend",
+			models.Email{From: models.EmailAddress{Email: "friend@gmail.com"}, Subject: "Dinner Saturday?"},
+			models.CategoryPersonal, false},
+		{"friend in Gmail's personal tab",
+			models.Email{From: models.EmailAddress{Email: "friend@gmail.com"}, Subject: "Dinner Saturday?", Labels: []string{"CATEGORY_PERSONAL"}},
+			models.CategoryPersonal, true},
+		{"nothing to go on",
+			models.Email{},
+			models.CategoryPersonal, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confident := CategorizeByRules(&tt.email)
+			if got != tt.want || confident != tt.wantConfident {
+				t.Errorf("CategorizeByRules = %s (confident %v), want %s (confident %v)", got, confident, tt.want, tt.wantConfident)
+			}
+		})
+	}
+}
+
+func TestCategorizeAsksLLMOnlyWhenUnsure(t *testing.T) {
+	unsure := &models.Email{From: models.EmailAddress{Email: "cskh@evn.com.vn"}, Subject: "Hóa đơn tiền điện tháng 5"}
+	sure := &models.Email{From: models.EmailAddress{Email: "billing@shop.com"}, Subject: "Invoice #123"}
+
+	tests := []struct {
+		name      string
+		llm       *stubLLM
+		useLLM    bool
+		email     *models.Email
+		want      models.EmailCategory
+		wantCalls int32
+	}{
+		{"unsure: LLM decides", &stubLLM{reply: "Notification."}, true, unsure, models.CategoryNotification, 1},
+		{"confident rules skip the LLM", &stubLLM{reply: "personal"}, true, sure, models.CategoryBilling, 0},
+		{"LLM turned off", &stubLLM{reply: "notification"}, false, unsure, models.CategoryBilling, 0},
+		{"LLM error keeps the rules", &stubLLM{err: errors.New("timeout")}, true, unsure, models.CategoryBilling, 1},
+		{"unknown answer keeps the rules", &stubLLM{reply: "spam"}, true, unsure, models.CategoryBilling, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewCategoryService(tt.llm, tt.useLLM)
+			if got := s.Categorize(context.Background(), tt.email); got != tt.want {
+				t.Errorf("Categorize = %s, want %s", got, tt.want)
+			}
+			if n := tt.llm.calls.Load(); n != tt.wantCalls {
+				t.Errorf("LLM calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+
+	if got := NewCategoryService(nil, true).Categorize(context.Background(), unsure); got != models.CategoryBilling {
+		t.Errorf("Categorize without a provider = %s, want the rules' billing", got)
+	}
+}
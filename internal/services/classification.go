@@ -0,0 +1,198 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PriorityClassifier assigns a priority to an email addressed to userEmail
+type PriorityClassifier interface {
+	ClassifyPriority(ctx context.Context, e *models.Email, userEmail string) (models.EmailPriority, error)
+}
+
+// ClassificationService picks the LLM or heuristic classifier per user. The LLM is only used
+// when a provider is configured and the user has not opted out (PriorityHeuristicsOnly);
+// LLM failures fall back to the heuristics.
+type ClassificationService struct {
+	llm       PriorityClassifier // nil without an LLM provider
+	heuristic PriorityClassifier
+}
+
+// NewClassificationService creates a classification service; llm may be nil
+func NewClassificationService(llm LLMProvider) *ClassificationService {
+	s := &ClassificationService{heuristic: HeuristicClassifier{}}
+	if llm != nil {
+		s.llm = &LLMClassifier{llm: llm}
+	}
+	return s
+}
+
+// Classify returns the email's priority for user
+func (s *ClassificationService) Classify(ctx context.Context, e *models.Email, user *models.User) models.EmailPriority {
+	if s.llm != nil && !user.PriorityHeuristicsOnly {
+		p, err := s.llm.ClassifyPriority(ctx, e, user.Email)
+		if err == nil {
+			return p
+		}
+		fmt.Printf("priority classification failed, falling back to heuristics: %v\n", err)
+	}
+	p, _ := s.heuristic.ClassifyPriority(ctx, e, user.Email)
+	return p
+}
+
+// UsesLLM reports whether Classify calls the LLM for user
+func (s *ClassificationService) UsesLLM(user *models.User) bool {
+	return s.llm != nil && !user.PriorityHeuristicsOnly
+}
+
+// ===== LLM classifier =====
+
+// LLMClassifier asks the configured LLM provider for a one-word priority
+type LLMClassifier struct {
+	llm LLMProvider
+}
+
+func (c *LLMClassifier) ClassifyPriority(ctx context.Context, e *models.Email, userEmail string) (models.EmailPriority, error) {
+	out, err := c.llm.Generate(withOperation(ctx, "priority"), LLMRequest{
+		System:      "You triage emails. Answer with exactly one word: urgent, high, normal or low.",
+		Prompt:      buildPriorityPrompt(e, userEmail),
+		MaxTokens:   5,
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	p := models.EmailPriority(strings.ToLower(strings.Trim(strings.TrimSpace(out), ".!\"'`")))
+	if !models.ValidPriority(p) {
+		return "", fmt.Errorf("unexpected priority %q", out)
+	}
+	return p, nil
+}
+
+func buildPriorityPrompt(e *models.Email, userEmail string) string {
+	text := e.Preview
+	if text == "" {
+		text = stripHTML(e.Body)
+	}
+	if r := []rune(text); len(r) > 1000 {
+		text = string(r[:1000])
+	}
+	return fmt.Sprintf(`Classify the priority of this email for the recipient.
+urgent: needs action within hours (outages, emergencies, same-day deadlines)
+high: needs a response or action soon (requests, deadlines, approvals)
+normal: personal or work mail with no time pressure
+low: newsletters, promotions, automated notifications
+
+From: %s <%s>
+Recipient role: %s
+Subject: %s
+
+%s`, e.From.Name, e.From.Email, recipientRole(e, userEmail), e.Subject, text)
+}
+
+// ===== Heuristic classifier =====
+
+// HeuristicClassifier scores subject keywords, the sender and the user's recipient role
+type HeuristicClassifier struct{}
+
+var (
+	urgentKeywordRE = regexp.MustCompile(`(?i)\b(urgent|asap|immediately|emergency|critical|outage|incident|action required|time[- ]sensitive|final notice|khẩn|gấp)`)
+	highKeywordRE   = regexp.MustCompile(`(?i)\b(important|deadline|due (today|tomorrow|date)|reminder|invoice|payment|approval|approve|please review|eod|overdue|quan trọng|hạn chót|nhắc)`)
+	lowKeywordRE    = regexp.MustCompile(`(?i)\b(newsletter|unsubscribe|digest|promotion|promo|sale|% off|discount|webinar|weekly update|deal)`)
+	// Local parts of senders that are not a person
+	automatedSenderRE = regexp.MustCompile(`(?i)^(no-?reply|do-?not-?reply|notifications?|newsletter|news|marketing|mailer|updates|info|hello)([+.-]|$)`)
+)
+
+// bulkSenderDomains are mailing services whose mail is almost never urgent
+var bulkSenderDomains = []string{"mailchimp.com", "mcsv.net", "sendgrid.net", "amazonses.com", "mailgun.org", "substack.com", "hubspotemail.net", "facebookmail.com", "linkedin.com"}
+
+// freeMailDomains do not identify a shared organization
+var freeMailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true, "outlook.com": true, "hotmail.com": true, "yahoo.com": true, "icloud.com": true, "proton.me": true}
+
+func (HeuristicClassifier) ClassifyPriority(_ context.Context, e *models.Email, userEmail string) (models.EmailPriority, error) {
+	return classifyPriorityHeuristic(e, userEmail), nil
+}
+
+// classifyPriorityHeuristic adds up signals: +3 urgent keyword, +2 high keyword, +1 Gmail
+// IMPORTANT, +1 colleague (same non-free domain), +1 direct To; -1 Cc only, -2 promotional
+// category or keyword, -3 automated/bulk sender. Urgent needs an urgent keyword and a score
+// of 3; high needs 3, or 2 with a keyword; -2 or less is low.
+func classifyPriorityHeuristic(e *models.Email, userEmail string) models.EmailPriority {
+	score := 0
+	subject := e.Subject
+
+	urgentKeyword := urgentKeywordRE.MatchString(subject)
+	highKeyword := !urgentKeyword && highKeywordRE.MatchString(subject)
+	switch {
+	case urgentKeyword:
+		score += 3
+	case highKeyword:
+		score += 2
+	}
+	if lowKeywordRE.MatchString(subject) || e.HasLabel("CATEGORY_PROMOTIONS") || e.HasLabel("CATEGORY_SOCIAL") || e.HasLabel("CATEGORY_FORUMS") {
+		score -= 2
+	}
+	if e.HasLabel("IMPORTANT") {
+		score++
+	}
+
+	senderLocal, senderDomain := splitAddress(e.From.Email)
+	if automatedSenderRE.MatchString(senderLocal) || isBulkDomain(senderDomain) {
+		score -= 3
+	} else if _, userDomain := splitAddress(userEmail); userDomain != "" && userDomain == senderDomain && !freeMailDomains[userDomain] {
+		score++
+	}
+
+	switch recipientRole(e, userEmail) {
+	case "to":
+		score++
+	case "cc":
+		score--
+	}
+
+	switch {
+	case urgentKeyword && score >= 3:
+		return models.PriorityUrgent
+	case score >= 3, score >= 2 && (urgentKeyword || highKeyword):
+		return models.PriorityHigh
+	case score <= -2:
+		return models.PriorityLow
+	default:
+		return models.PriorityNormal
+	}
+}
+
+// recipientRole returns "to" or "cc" for the user's address, or "other" (Bcc, alias, list)
+func recipientRole(e *models.Email, userEmail string) string {
+	for _, a := range e.To {
+		if strings.EqualFold(a.Email, userEmail) {
+			return "to"
+		}
+	}
+	for _, a := range e.Cc {
+		if strings.EqualFold(a.Email, userEmail) {
+			return "cc"
+		}
+	}
+	return "other"
+}
+
+func splitAddress(addr string) (local, domain string) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[:i], addr[i+1:]
+	}
+	return addr, ""
+}
+
+func isBulkDomain(domain string) bool {
+	for _, d := range bulkSenderDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+func recipients(email string) []models.EmailAddress {
+	return []models.EmailAddress{{Email: email}}
+}
+
+func TestClassifyPriorityHeuristic(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  string
+		email models.Email
+		want  models.EmailPriority
+	}{
+		{"urgent keyword from a colleague", "me@acme.com",
+			models.Email{Subject: "URGENT: prod outage", From: models.EmailAddress{Email: "bob@acme.com"}, To: recipients("me@acme.com")}, models.PriorityUrgent},
+		{"Vietnamese urgent keyword", "me@acme.com",
+			models.Email{Subject: "Khẩn: hệ thống lỗi", From: models.EmailAddress{Email: "bob@acme.com"}, To: recipients("me@acme.com")}, models.PriorityUrgent},
+		{"urgent keyword in Cc from outside", "me@acme.com",
+			models.Email{Subject: "urgent question", From: models.EmailAddress{Email: "x@other.com"}, Cc: recipients("me@acme.com")}, models.PriorityHigh},
+		{"urgent keyword from a no-reply sender", "me@acme.com",
+			models.Email{Subject: "Action required: verify your account", From: models.EmailAddress{Email: "no-reply@bank.com"}, To: recipients("me@acme.com")}, models.PriorityNormal},
+		{"high keyword from a colleague", "me@acme.com",
+			models.Email{Subject: "Please review the Q3 deck", From: models.EmailAddress{Email: "bob@acme.com"}, To: recipients("me@acme.com")}, models.PriorityHigh},
+		{"high keyword addressed directly", "me@acme.com",
+			models.Email{Subject: "Invoice #42", From: models.EmailAddress{Email: "billing@vendor.com"}, To: recipients("ME@Acme.com")}, models.PriorityHigh},
+		{"high keyword in Cc from a colleague", "me@acme.com",
+			models.Email{Subject: "Reminder: rent", From: models.EmailAddress{Email: "bob@acme.com"}, Cc: recipients("me@acme.com")}, models.PriorityHigh},
+		{"high keyword in Cc, free mail is no colleague", "me@gmail.com",
+			models.Email{Subject: "Reminder: rent", From: models.EmailAddress{Email: "friend@gmail.com"}, Cc: recipients("me@gmail.com")}, models.PriorityNormal},
+		{"Gmail IMPORTANT from a colleague", "me@acme.com",
+			models.Email{Subject: "Lunch plans", From: models.EmailAddress{Email: "bob@acme.com"}, To: recipients("me@acme.com"), Labels: []string{"IMPORTANT"}}, models.PriorityHigh},
+		{"personal mail", "me@gmail.com",
+			models.Email{Subject: "Dinner on Saturday?", From: models.EmailAddress{Email: "friend@gmail.com"}, To: recipients("me@gmail.com")}, models.PriorityNormal},
+		{"newsletter", "me@acme.com",
+			models.Email{Subject: "Weekly newsletter", From: models.EmailAddress{Email: "news@medium.com"}, To: recipients("me@acme.com")}, models.PriorityLow},
+		{"bulk mailing domain", "me@acme.com",
+			models.Email{Subject: "New post", From: models.EmailAddress{Email: "writer@mail.substack.com"}, To: recipients("me@acme.com")}, models.PriorityLow},
+		{"promotions category not addressed to the user", "me@acme.com",
+			models.Email{Subject: "Spring collection", From: models.EmailAddress{Email: "shop@store.com"}, To: recipients("list@store.com"), Labels: []string{"CATEGORY_PROMOTIONS"}}, models.PriorityLow},
+		{"promotions category addressed to the user", "me@acme.com",
+			models.Email{Subject: "Spring collection", From: models.EmailAddress{Email: "shop@store.com"}, To: recipients("me@acme.com"), Labels: []string{"CATEGORY_PROMOTIONS"}}, models.PriorityNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyPriorityHeuristic(&tt.email, tt.user); got != tt.want {
+				t.Errorf("priority = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecipientRole(t *testing.T) {
+	e := &models.Email{To: recipients("a@x.com"), Cc: recipients("b@x.com")}
+	for user, want := range map[string]string{"A@X.com": "to", "b@x.com": "cc", "c@x.com": "other"} {
+		if got := recipientRole(e, user); got != want {
+			t.Errorf("recipientRole(%s) = %s, want %s", user, got, want)
+		}
+	}
+}
+
+func TestClassifyUsesLLMUnlessOptedOut(t *testing.T) {
+	// The heuristics call this normal
+	e := &models.Email{Subject: "Dinner on Saturday?", From: models.EmailAddress{Email: "friend@gmail.com"}, To: recipients("me@gmail.com")}
+	user := &models.User{Email: "me@gmail.com"}
+
+	tests := []struct {
+		name      string
+		reply     string
+		err       error
+		optOut    bool
+		want      models.EmailPriority
+		wantCalls int32
+	}{
+		{"LLM answer", " Urgent.", nil, false, models.PriorityUrgent, 1},
+		{"LLM error falls back", "", errors.New("timeout"), false, models.PriorityNormal, 1},
+		{"unexpected answer falls back", "very important", nil, false, models.PriorityNormal, 1},
+		{"heuristics only", "urgent", nil, true, models.PriorityNormal, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &stubLLM{reply: tt.reply, err: tt.err}
+			s := NewClassificationService(llm)
+			u := *user
+			u.PriorityHeuristicsOnly = tt.optOut
+			if got := s.Classify(context.Background(), e, &u); got != tt.want {
+				t.Errorf("Classify = %s, want %s", got, tt.want)
+			}
+			if n := llm.calls.Load(); n != tt.wantCalls {
+				t.Errorf("LLM calls = %d, want %d", n, tt.wantCalls)
+			}
+			if s.UsesLLM(&u) == tt.optOut {
+				t.Errorf("UsesLLM = %v with PriorityHeuristicsOnly %v", s.UsesLLM(&u), tt.optOut)
+			}
+		})
+	}
+
+	if got := NewClassificationService(nil).Classify(context.Background(), e, user); got != models.PriorityNormal {
+		t.Errorf("Classify without a provider = %s, want the heuristic normal", got)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"aiemailbox-be/internal/repository"
+	"context"
+	"log"
+	"time"
+)
+
+// StartCleanupWorker starts a background goroutine that deletes cached emails not accessed
+// within the retention window, once at startup and then every interval. The worker stops
+// when ctx is done.
+func StartCleanupWorker(ctx context.Context, interval, retention time.Duration, repo *repository.EmailRepository) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		deleteStaleEmails(ctx, retention, repo)
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("cleanup worker: shutting down")
+				return
+			case <-ticker.C:
+				deleteStaleEmails(ctx, retention, repo)
+			}
+		}
+	}()
+}
+
+// deleteStaleEmails runs one retention pass
+func deleteStaleEmails(ctx context.Context, retention time.Duration, repo *repository.EmailRepository) {
+	deleted, err := repo.DeleteStale(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Println("cleanup worker: error deleting stale emails:", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("cleanup worker: deleted %d stale emails", deleted)
+	}
+}
+
+// searchGramBackfillBatch is how many emails StartSearchGramBackfill updates per query
+const searchGramBackfillBatch = 500
+
+// StartSearchGramBackfill starts a background goroutine that computes the normalized subject
+// and summary and their trigrams (used by fuzzy search) for emails stored before they
+// existed. It stops when every email has them, on the first error, or when ctx is done.
+func StartSearchGramBackfill(ctx context.Context, repo *repository.EmailRepository) {
+	go func() {
+		total := 0
+		for ctx.Err() == nil {
+			n, err := repo.BackfillSearchGrams(ctx, searchGramBackfillBatch)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println("search gram backfill: failed:", err)
+				}
+				return
+			}
+			total += n
+			if n < searchGramBackfillBatch {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("search gram backfill: updated %d emails", total)
+		}
+	}()
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"aiemailbox-be/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLLMNotConfigured is returned by features that have no local fallback
+var ErrLLMNotConfigured = errors.New("no LLM provider configured")
+
+// maxThreadContextChars bounds how much of the thread is sent with a compose request
+const maxThreadContextChars = 6000
+
+// Compose tones
+var composeTones = map[string]string{
+	"neutral":  "clear and neutral",
+	"formal":   "formal and polite",
+	"friendly": "warm and friendly",
+	"concise":  "brief and to the point",
+	"casual":   "relaxed and casual",
+}
+
+// ComposeInput describes a fresh draft or, when PreviousDraft is set, a refinement of one
+type ComposeInput struct {
+	Instructions  string
+	Tone          string
+	RecipientName string
+	ThreadContext string
+	PreviousDraft *ComposeDraft
+	Edit          string // refinement instruction, e.g. "make it shorter"
+}
+
+// ComposeDraft is a generated email
+type ComposeDraft struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// ComposeService drafts new emails with the configured LLM provider
+type ComposeService struct {
+	llm LLMProvider // nil disables compose
+}
+
+// NewComposeService creates a new compose service; llm may be nil
+func NewComposeService(llm LLMProvider) *ComposeService {
+	return &ComposeService{llm: llm}
+}
+
+// Enabled reports whether an LLM provider is configured
+func (s *ComposeService) Enabled() bool {
+	return s.llm != nil
+}
+
+// Validate normalizes the input and checks the fields required by its mode
+func (in *ComposeInput) Validate() error {
+	in.Tone = strings.ToLower(strings.TrimSpace(in.Tone))
+	if in.Tone == "" {
+		in.Tone = "neutral"
+	}
+	if _, ok := composeTones[in.Tone]; !ok {
+		return fmt.Errorf("invalid tone %q (use neutral, formal, friendly, concise or casual)", in.Tone)
+	}
+	if in.PreviousDraft != nil {
+		if strings.TrimSpace(in.Edit) == "" {
+			return errors.New("edit instruction is required to refine a draft")
+		}
+		if strings.TrimSpace(in.PreviousDraft.Body) == "" {
+			return errors.New("previous draft body is empty")
+		}
+		return nil
+	}
+	if strings.TrimSpace(in.Instructions) == "" {
+		return errors.New("instructions are required")
+	}
+	return nil
+}
+
+// Compose generates a draft (or refines PreviousDraft)
+func (s *ComposeService) Compose(ctx context.Context, in ComposeInput) (*ComposeDraft, error) {
+	if s.llm == nil {
+		return nil, ErrLLMNotConfigured
+	}
+	out, err := s.llm.Generate(withOperation(ctx, "compose"), buildComposePrompt(in))
+	if err != nil {
+		return nil, err
+	}
+	draft := parseComposeDraft(out)
+	if draft.Body == "" {
+		return nil, fmt.Errorf("%s returned an empty draft", s.llm.Name())
+	}
+	// A refinement that doesn't touch the subject keeps the old one
+	if draft.Subject == "" && in.PreviousDraft != nil {
+		draft.Subject = in.PreviousDraft.Subject
+	}
+	return draft, nil
+}
+
+// buildComposePrompt builds the provider request for a fresh draft or a refinement
+func buildComposePrompt(in ComposeInput) LLMRequest {
+	system := fmt.Sprintf(`You write emails on behalf of the user. The tone is %s.
+Reply with JSON only, no prose and no code fences: {"subject": string, "body": string}.
+The body is plain text with line breaks, including greeting and sign-off, without placeholders like [Your Name].`, composeTones[in.Tone])
+
+	var b strings.Builder
+	if in.PreviousDraft != nil {
+		fmt.Fprintf(&b, "Revise this draft: %s\n\nSubject: %s\n\n%s\n", in.Edit, in.PreviousDraft.Subject, in.PreviousDraft.Body)
+		if in.Instructions != "" {
+			fmt.Fprintf(&b, "\nThe original request was: %s\n", in.Instructions)
+		}
+	} else {
+		fmt.Fprintf(&b, "Write an email: %s\n", in.Instructions)
+	}
+	if in.RecipientName != "" {
+		fmt.Fprintf(&b, "\nRecipient: %s\n", in.RecipientName)
+	}
+	if ctx := strings.TrimSpace(in.ThreadContext); ctx != "" {
+		if r := []rune(ctx); len(r) > maxThreadContextChars {
+			// keep the most recent part of the thread
+			ctx = string(r[len(r)-maxThreadContextChars:])
+		}
+		fmt.Fprintf(&b, "\nEarlier messages in the thread, for context:\n%s\n", ctx)
+	}
+
+	return LLMRequest{
+		System:      system,
+		Prompt:      b.String(),
+		MaxTokens:   800,
+		Temperature: 0.7,
+	}
+}
+
+// parseComposeDraft reads the model's JSON; if the model ignored the format, a leading
+// "Subject:" line is used as the subject and the rest as the body
+func parseComposeDraft(out string) *ComposeDraft {
+	out = strings.TrimSpace(out)
+	if m := jsonFenceRE.FindStringSubmatch(out); m != nil {
+		out = m[1]
+	}
+
+	var draft ComposeDraft
+	if err := utils.ParseJSON(out, &draft); err == nil {
+		draft.Subject = strings.TrimSpace(draft.Subject)
+		draft.Body = strings.TrimSpace(draft.Body)
+		return &draft
+	}
+
+	if first, rest, ok := strings.Cut(out, "\n"); ok && strings.HasPrefix(strings.ToLower(first), "subject:") {
+		return &ComposeDraft{
+			Subject: strings.TrimSpace(first[len("subject:"):]),
+			Body:    strings.TrimSpace(rest),
+		}
+	}
+	return &ComposeDraft{Body: out}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBuildComposePromptFresh(t *testing.T) {
+	in := ComposeInput{Instructions: "Ask Lan to move Friday's review to Monday", Tone: "formal", RecipientName: "Lan"}
+	if err := in.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	req := buildComposePrompt(in)
+
+	if !strings.Contains(req.System, "The tone is formal and polite.") || !strings.Contains(req.System, `{"subject": string, "body": string}`) {
+		t.Errorf("system = %q", req.System)
+	}
+	for _, want := range []string{"Write an email: Ask Lan to move Friday's review to Monday\n", "\nRecipient: Lan\n"} {
+		if !strings.Contains(req.Prompt, want) {
+			t.Errorf("prompt %q lacks %q", req.Prompt, want)
+		}
+	}
+	for _, unwanted := range []string{"Revise this draft", "original request", "Earlier messages"} {
+		if strings.Contains(req.Prompt, unwanted) {
+			t.Errorf("fresh draft prompt has %q: %q", unwanted, req.Prompt)
+		}
+	}
+	if req.MaxTokens != 800 {
+		t.Errorf("MaxTokens = %d", req.MaxTokens)
+	}
+}
+
+func TestBuildComposePromptRefine(t *testing.T) {
+	in := ComposeInput{
+		Instructions:  "Decline the offer",
+		PreviousDraft: &ComposeDraft{Subject: "Re: Offer", Body: "Hi Minh,\nThanks, but I will pass.\nBest"},
+		Edit:          "make it warmer",
+	}
+	if err := in.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	req := buildComposePrompt(in)
+
+	if !strings.Contains(req.System, "The tone is clear and neutral.") {
+		t.Errorf("system = %q, want the default neutral tone", req.System)
+	}
+	want := "Revise this draft: make it warmer\n\nSubject: Re: Offer\n\nHi Minh,\nThanks, but I will pass.\nBest\n" +
+		"\nThe original request was: Decline the offer\n"
+	if req.Prompt != want {
+		t.Errorf("prompt = %q, want %q", req.Prompt, want)
+	}
+	if strings.Contains(req.Prompt, "Write an email") {
+		t.Error("refinement prompt asks for a new email")
+	}
+}
+
+func TestBuildComposePromptKeepsRecentThread(t *testing.T) {
+	thread := "OLDEST " + strings.Repeat("x", maxThreadContextChars) + " NEWEST"
+	req := buildComposePrompt(ComposeInput{Instructions: "Reply yes", Tone: "neutral", ThreadContext: thread})
+	if strings.Contains(req.Prompt, "OLDEST") || !strings.Contains(req.Prompt, "NEWEST") {
+		t.Error("thread context was not cut down to its most recent part")
+	}
+}
+
+func TestComposeInputValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      ComposeInput
+		wantErr string
+	}{
+		{"fresh", ComposeInput{Instructions: "Say hi"}, ""},
+		{"fresh without instructions", ComposeInput{Instructions: "  "}, "instructions are required"},
+		{"unknown tone", ComposeInput{Instructions: "Say hi", Tone: "angry"}, "invalid tone"},
+		{"refine", ComposeInput{PreviousDraft: &ComposeDraft{Body: "Hi"}, Edit: "shorter"}, ""},
+		{"refine without edit", ComposeInput{PreviousDraft: &ComposeDraft{Body: "Hi"}}, "edit instruction is required"},
+		{"refine an empty draft", ComposeInput{PreviousDraft: &ComposeDraft{}, Edit: "shorter"}, "previous draft body is empty"},
+	}
+	for _, tt := range tests {
+		err := tt.in.Validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: Validate = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseComposeDraft(t *testing.T) {
+	tests := []struct {
+		out  string
+		want ComposeDraft
+	}{
+		{`{"subject":" Lunch ","body":"Hi,\nLunch at 12?"}`, ComposeDraft{Subject: "Lunch", Body: "Hi,\nLunch at 12?"}},
+		{"```json\n{\"subject\":\"Lunch\",\"body\":\"Hi\"}\n```", ComposeDraft{Subject: "Lunch", Body: "Hi"}},
+		{"Subject: Lunch\nHi,\nLunch at 12?", ComposeDraft{Subject: "Lunch", Body: "Hi,\nLunch at 12?"}},
+		{"Hi, lunch at 12?", ComposeDraft{Body: "Hi, lunch at 12?"}},
+	}
+	for _, tt := range tests {
+		if got := parseComposeDraft(tt.out); *got != tt.want {
+			t.Errorf("parseComposeDraft(%q) = %+v, want %+v", tt.out, *got, tt.want)
+		}
+	}
+}
+
+func TestComposeRefineKeepsSubject(t *testing.T) {
+	llm := &stubLLM{reply: `{"subject":"","body":"Hi Minh, thank you so much, but I will pass."}`}
+	s := NewComposeService(llm)
+	draft, err := s.Compose(context.Background(), ComposeInput{
+		Tone:          "neutral",
+		PreviousDraft: &ComposeDraft{Subject: "Re: Offer", Body: "Thanks, but I will pass."},
+		Edit:          "make it warmer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.Subject != "Re: Offer" || !strings.HasPrefix(draft.Body, "Hi Minh") {
+		t.Errorf("draft = %+v", draft)
+	}
+
+	if _, err := NewComposeService(nil).Compose(context.Background(), ComposeInput{Instructions: "Say hi"}); err != ErrLLMNotConfigured {
+		t.Errorf("Compose without a provider = %v, want ErrLLMNotConfigured", err)
+	}
+	if _, err := NewComposeService(&stubLLM{reply: "  "}).Compose(context.Background(), ComposeInput{Instructions: "Say hi"}); err == nil {
+		t.Error("Compose accepted an empty draft")
+	}
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// emailSyncMaxBatch caps how many queued emails one worker pass writes
+const emailSyncMaxBatch = 500
+
+// classifyConcurrency bounds parallel LLM classification and security calls during a sync
+const classifyConcurrency = 4
+
+// importantPushMaxAge keeps the first sync of an account from pushing its old emails
+const importantPushMaxAge = 24 * time.Hour
+
+// syncBatch is one request's worth of fetched Gmail messages
+type syncBatch struct {
+	userID string
+	emails []*models.Email
+}
+
+// EmailSyncService stores fetched Gmail messages in Mongo. Request handlers Enqueue what they
+// fetched and return immediately; a single worker drains the bounded queue, merges pending
+// batches per user and writes each with one bulk lookup and one BulkWrite. When the queue is
+// full new batches are dropped: the messages are re-fetched on the next page load anyway.
+type EmailSyncService struct {
+	emailRepo   *repository.EmailRepository
+	userRepo    *repository.UserRepository
+	summaryJobs *repository.SummaryJobRepository // nil when auto-summarize is disabled
+	classifier  *ClassificationService           // nil skips priority classification
+	security    *SecurityAnalysisService         // nil skips phishing/spam scoring
+	categories  *CategoryService                 // nil skips categorization
+	rules       *RuleService                     // nil skips filing rules
+	push        *PushService                     // nil skips Web Push alerts
+	timeout     time.Duration
+	queue       chan syncBatch
+	done        chan struct{}
+}
+
+// NewEmailSyncService creates a sync service with a queue of queueSize batches. Each worker
+// pass is bounded by timeout.
+func NewEmailSyncService(emailRepo *repository.EmailRepository, userRepo *repository.UserRepository, summaryJobs *repository.SummaryJobRepository, classifier *ClassificationService, security *SecurityAnalysisService, categories *CategoryService, rules *RuleService, push *PushService, queueSize int, timeout time.Duration) *EmailSyncService {
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	return &EmailSyncService{
+		emailRepo:   emailRepo,
+		userRepo:    userRepo,
+		summaryJobs: summaryJobs,
+		classifier:  classifier,
+		security:    security,
+		categories:  categories,
+		rules:       rules,
+		push:        push,
+		timeout:     timeout,
+		queue:       make(chan syncBatch, queueSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start runs the sync worker until ctx is done
+func (s *EmailSyncService) Start(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case <-ctx.Done():
+				if n := len(s.queue); n > 0 {
+					log.Printf("email sync worker: shutting down, %d queued batches dropped", n)
+				} else {
+					log.Println("email sync worker: shutting down")
+				}
+				return
+			case first := <-s.queue:
+				s.process(ctx, s.collect(first))
+			}
+		}
+	}()
+}
+
+// Wait blocks until the worker has stopped or the timeout elapses.
+// Returns false if it was still running when Wait gave up.
+func (s *EmailSyncService) Wait(timeout time.Duration) bool {
+	select {
+	case <-s.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Enqueue queues emails for storage without blocking. Callers must not modify the emails
+// afterwards. Returns false when the queue is full and the batch was dropped.
+func (s *EmailSyncService) Enqueue(userID string, emails []*models.Email) bool {
+	if len(emails) == 0 {
+		return true
+	}
+	select {
+	case s.queue <- syncBatch{userID: userID, emails: emails}:
+		return true
+	default:
+		log.Printf("email sync: queue full, dropped %d emails for user %s", len(emails), userID)
+		return false
+	}
+}
+
+// collect merges first with whatever else is already queued, up to emailSyncMaxBatch
+// emails, grouped by user. A message fetched twice keeps its latest copy.
+func (s *EmailSyncService) collect(first syncBatch) map[string][]*models.Email {
+	byUser := map[string]map[string]*models.Email{}
+	add := func(b syncBatch) int {
+		if byUser[b.userID] == nil {
+			byUser[b.userID] = map[string]*models.Email{}
+		}
+		for _, e := range b.emails {
+			byUser[b.userID][e.ID] = e
+		}
+		return len(b.emails)
+	}
+
+	total := add(first)
+drain:
+	for total < emailSyncMaxBatch {
+		select {
+		case b := <-s.queue:
+			total += add(b)
+		default:
+			break drain
+		}
+	}
+
+	out := make(map[string][]*models.Email, len(byUser))
+	for userID, emails := range byUser {
+		for _, e := range emails {
+			out[userID] = append(out[userID], e)
+		}
+	}
+	return out
+}
+
+func (s *EmailSyncService) process(ctx context.Context, byUser map[string][]*models.Email) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	for userID, emails := range byUser {
+		if err := s.Store(ctx, userID, emails); err != nil {
+			log.Println("email sync:", err)
+		}
+	}
+}
+
+// Store upserts Gmail messages for a user without touching local workflow fields (see
+// EmailRepository.BulkUpsertFromGmail), classifies the priority, category and security risk
+// of emails that don't have one yet, files new emails by the user's rules, pushes an alert for
+// new important ones and queues them for auto-summarize
+func (s *EmailSyncService) Store(ctx context.Context, userID string, emails []*models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	ctx = WithUsageUser(ctx, userID)
+
+	ids := make([]string, len(emails))
+	for i, e := range emails {
+		ids[i] = e.ID
+	}
+	enrichment, err := s.emailRepo.Enrichment(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load stored classifications: %w", err)
+	}
+	var unclassified, uncategorized, unanalyzed, unstored []*models.Email
+	for _, e := range emails {
+		e.UserID = userID
+		stored, ok := enrichment[e.ID]
+		if !ok {
+			unstored = append(unstored, e)
+		}
+		if !stored.Priority {
+			unclassified = append(unclassified, e)
+		}
+		if !stored.Category {
+			uncategorized = append(uncategorized, e)
+		}
+		if !stored.Security {
+			unanalyzed = append(unanalyzed, e)
+		}
+	}
+	s.classifyPriorities(ctx, userID, unclassified)
+	s.categorize(ctx, uncategorized)
+	if err := s.analyzeSecurity(ctx, userID, unanalyzed); err != nil {
+		log.Println("email sync: security analysis skipped:", err)
+	}
+	s.applyRules(ctx, userID, unstored)
+	if err := s.emailRepo.BulkUpsertFromGmail(ctx, emails); err != nil {
+		return fmt.Errorf("bulk upsert failed: %w", err)
+	}
+	s.pushImportant(ctx, userID, unstored)
+
+	if s.summaryJobs != nil {
+		// Jobs are only created once per email, and the worker skips emails that already
+		// have a summary or were deleted in the meantime
+		var candidates []string
+		for _, e := range emails {
+			if !e.HasLabel("TRASH") {
+				candidates = append(candidates, e.ID)
+			}
+		}
+		if err := s.summaryJobs.EnqueueMany(ctx, userID, candidates); err != nil {
+			return fmt.Errorf("failed to enqueue summary jobs: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyRules files emails that aren't stored yet by the user's rules; stored emails keep the
+// column the user put them in. Failures leave the emails in the inbox.
+func (s *EmailSyncService) applyRules(ctx context.Context, userID string, emails []*models.Email) {
+	if s.rules == nil || len(emails) == 0 {
+		return
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Println("email sync: rules skipped:", err)
+		return
+	}
+	if err := s.rules.Apply(ctx, user, emails); err != nil {
+		log.Println("email sync: rules skipped:", err)
+	}
+}
+
+// pushImportant sends one Web Push alert for the new unread urgent or high-priority emails
+// among emails. Emails a rule snoozed or kept off the board are left out.
+func (s *EmailSyncService) pushImportant(ctx context.Context, userID string, emails []*models.Email) {
+	if s.push == nil {
+		return
+	}
+	cutoff := time.Now().Add(-importantPushMaxAge)
+	var important []*models.Email
+	for _, e := range emails {
+		if e.Priority != models.PriorityUrgent && e.Priority != models.PriorityHigh {
+			continue
+		}
+		if e.IsRead || e.SkipBoard || e.Status == models.StatusSnoozed || e.ReceivedAt.Before(cutoff) ||
+			e.HasLabel("TRASH") || e.HasLabel("SPAM") {
+			continue
+		}
+		important = append(important, e)
+	}
+	if len(important) == 0 {
+		return
+	}
+
+	first := important[0]
+	sender := first.From.Name
+	if sender == "" {
+		sender = first.From.Email
+	}
+	msg := models.PushMessage{
+		Type:    models.PushImportantEmail,
+		Title:   "Important email from " + sender,
+		Body:    first.Subject,
+		EmailID: first.ID,
+		Count:   len(important),
+	}
+	if len(important) > 1 {
+		msg.Title = fmt.Sprintf("%d new important emails", len(important))
+		msg.EmailID = ""
+	}
+	s.push.Notify(ctx, userID, msg)
+}
+
+// classifyPriorities sets Priority on emails that have none. Failures leave the priority
+// empty (shown as normal) and are retried on the next sync.
+func (s *EmailSyncService) classifyPriorities(ctx context.Context, userID string, emails []*models.Email) {
+	if s.classifier == nil || len(emails) == 0 {
+		return
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Println("email sync: priority classification skipped:", err)
+		return
+	}
+
+	if !s.classifier.UsesLLM(user) {
+		for _, e := range emails {
+			e.Priority = s.classifier.Classify(ctx, e, user)
+		}
+		return
+	}
+
+	forEachConcurrent(emails, func(e *models.Email) {
+		e.Priority = s.classifier.Classify(ctx, e, user)
+	})
+}
+
+// categorize sets Category on emails that have none. The stored category is kept, so
+// re-syncs don't move emails between categories.
+func (s *EmailSyncService) categorize(ctx context.Context, emails []*models.Email) {
+	if s.categories == nil || len(emails) == 0 {
+		return
+	}
+	if !s.categories.UsesLLM() {
+		for _, e := range emails {
+			e.Category = s.categories.Categorize(ctx, e)
+		}
+		return
+	}
+	forEachConcurrent(emails, func(e *models.Email) {
+		e.Category = s.categories.Categorize(ctx, e)
+	})
+}
+
+// analyzeSecurity sets Security on emails that have no stored analysis. The stored one is
+// kept, so scores don't change with every re-sync.
+func (s *EmailSyncService) analyzeSecurity(ctx context.Context, userID string, pending []*models.Email) error {
+	if s.security == nil || len(pending) == 0 {
+		return nil
+	}
+
+	known, err := s.emailRepo.FrequentSenderDomains(ctx, userID, s.security.FrequentSenderLimit())
+	if err != nil {
+		return err
+	}
+	forEachConcurrent(pending, func(e *models.Email) {
+		e.Security = s.security.Analyze(ctx, e, known)
+	})
+	return nil
+}
+
+// forEachConcurrent runs fn for every email, at most classifyConcurrency at a time
+func forEachConcurrent(emails []*models.Email, fn func(e *models.Email)) {
+	sem := make(chan struct{}, classifyConcurrency)
+	var wg sync.WaitGroup
+	for _, e := range emails {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *models.Email) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(e)
+		}(e)
+	}
+	wg.Wait()
+}
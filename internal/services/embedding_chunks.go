@@ -0,0 +1,97 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"fmt"
+	"unicode"
+)
+
+// Chunking of long emails for embedding. Sizes are in runes; at roughly 4 characters per
+// token a chunk is ~1,000 tokens, well under the providers' input limits.
+const (
+	embeddingChunkRunes   = 4000
+	embeddingChunkOverlap = 800
+	// embeddingMaxChunks bounds the cost of one huge email; the rest of its text is not embedded
+	embeddingMaxChunks = 16
+	// embeddingChunkSlack is how far back from the window end a chunk may end at whitespace
+	embeddingChunkSlack = 200
+)
+
+// TextChunk is a window of a text to embed
+type TextChunk struct {
+	Index  int
+	Offset int // in runes
+	Text   string
+}
+
+// ChunkText splits text into windows of at most size runes that overlap by overlap runes,
+// ending at whitespace when there is some near the end of the window. Text that fits one
+// window is returned whole.
+func ChunkText(text string, size, overlap, maxChunks int) []TextChunk {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+	if overlap >= size {
+		overlap = size / 2
+	}
+
+	var chunks []TextChunk
+	for start := 0; start < len(runes) && len(chunks) < maxChunks; {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			// prefer not to cut a word in half
+			for i := end; i > end-embeddingChunkSlack && i > start+overlap; i-- {
+				if unicode.IsSpace(runes[i-1]) {
+					end = i
+					break
+				}
+			}
+		}
+		chunks = append(chunks, TextChunk{Index: len(chunks), Offset: start, Text: string(runes[start:end])})
+		if end == len(runes) {
+			break
+		}
+		start = end - overlap
+	}
+	return chunks
+}
+
+// EmailSimilarity is the cosine similarity of query to the best matching chunk of e; emails
+// embedded as a single vector are compared with that vector
+func EmailSimilarity(query []float32, e *models.Email) float32 {
+	if len(e.EmbeddingChunks) == 0 {
+		return CosineSimilarity(query, e.Embedding)
+	}
+	best := float32(-1)
+	for _, chunk := range e.EmbeddingChunks {
+		if score := CosineSimilarity(query, chunk.Embedding); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// checkEmbeddingDimensions fails when any stored embedding has a different length than the
+// query vector. Cosine similarity of such vectors is 0, which would silently bury those emails;
+// this happens after switching to a model with another dimension, until they are re-embedded.
+func checkEmbeddingDimensions(emails []models.Email, queryDim int) error {
+	mismatched, stored := 0, 0
+	for i := range emails {
+		dim := emails[i].EmbeddingDim
+		if dim == 0 {
+			dim = len(emails[i].Embedding)
+		}
+		if dim != 0 && dim != queryDim {
+			mismatched++
+			stored = dim
+		}
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("%w: %d of %d emails have %d-dimension embeddings but the query has %d; re-embed them with the current embedding model",
+			ErrEmbeddingDimensionMismatch, mismatched, len(emails), stored, queryDim)
+	}
+	return nil
+}
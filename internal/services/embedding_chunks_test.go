@@ -0,0 +1,142 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestChunkText(t *testing.T) {
+	if got := ChunkText("", 100, 20, 4); got != nil {
+		t.Errorf("empty text = %v, want no chunks", got)
+	}
+	if got := ChunkText("short email", 100, 20, 4); len(got) != 1 || got[0].Text != "short email" {
+		t.Errorf("short text = %+v, want it whole", got)
+	}
+
+	// Words of 9 runes plus a space; "Tiếng" checks offsets count runes, not bytes
+	text := strings.Repeat("Tiếng abc ", 100)
+	runes := []rune(text)
+	chunks := ChunkText(text, 100, 20, 50)
+	for i, c := range chunks {
+		if c.Index != i {
+			t.Errorf("chunk %d has index %d", i, c.Index)
+		}
+		n := len([]rune(c.Text))
+		if n > 100 {
+			t.Errorf("chunk %d has %d runes, over the window", i, n)
+		}
+		if string(runes[c.Offset:c.Offset+n]) != c.Text {
+			t.Errorf("chunk %d text doesn't match the text at offset %d", i, c.Offset)
+		}
+		last := i == len(chunks)-1
+		if !last && !unicode.IsSpace(runes[c.Offset+n-1]) {
+			t.Errorf("chunk %d ends mid-word: %q", i, c.Text)
+		}
+		if !last && chunks[i+1].Offset != c.Offset+n-20 {
+			t.Errorf("chunk %d starts at %d, want an overlap of 20 with chunk %d ending at %d", i+1, chunks[i+1].Offset, i, c.Offset+n)
+		}
+		if last && c.Offset+n != len(runes) {
+			t.Errorf("last chunk ends at %d of %d runes", c.Offset+n, len(runes))
+		}
+	}
+
+	if got := ChunkText(text, 100, 20, 3); len(got) != 3 {
+		t.Errorf("got %d chunks, want maxChunks 3", len(got))
+	}
+	// An overlap as large as the window would never advance
+	if got := ChunkText(strings.Repeat("x", 250), 100, 100, 10); len(got) != 4 || got[1].Offset != 50 {
+		t.Errorf("overlap >= size: %d chunks, second at %d; want 4 chunks half a window apart", len(got), got[1].Offset)
+	}
+}
+
+func TestEmailSimilarityUsesBestChunk(t *testing.T) {
+	query := []float32{0, 1}
+	single := &models.Email{Embedding: []float32{1, 0}}
+	chunked := &models.Email{
+		Embedding: []float32{1, 0},
+		EmbeddingChunks: []models.EmbeddingChunk{
+			{ChunkIndex: 0, Embedding: []float32{1, 0}},
+			{ChunkIndex: 1, Embedding: []float32{-1, 0}},
+			{ChunkIndex: 2, Embedding: []float32{0, 1}},
+		},
+	}
+	if got := EmailSimilarity(query, single); got != 0 {
+		t.Errorf("single vector similarity = %v, want 0", got)
+	}
+	if got := EmailSimilarity(query, chunked); got != 1 {
+		t.Errorf("chunked similarity = %v, want 1 from the last chunk", got)
+	}
+}
+
+// topicEmbedder embeds texts mentioning topic as [0, 1] and everything else as [1, 0]
+type topicEmbedder struct {
+	countingEmbedder
+	topic string
+}
+
+func (e *topicEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	if strings.Contains(strings.ToLower(text), e.topic) {
+		return []float32{0, 1}, nil
+	}
+	return []float32{1, 0}, nil
+}
+
+func (e *topicEmbedder) BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = e.GenerateEmbedding(ctx, text)
+	}
+	return vectors, nil
+}
+
+func TestTailChunkMatchIsFound(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emails := repository.NewEmailRepository(db)
+	embedder := &topicEmbedder{topic: "wire transfer"}
+
+	filler := strings.Repeat("Minutes of the quarterly planning meeting, nothing urgent here. ", 200)
+	long := filler + "PS: please approve the wire transfer to the supplier by Friday."
+	if n := len(ChunkText(long, embeddingChunkRunes, embeddingChunkOverlap, embeddingMaxChunks)); n < 3 {
+		t.Fatalf("fixture has %d chunks, want the match well past the first", n)
+	}
+	for _, e := range []*models.Email{
+		{ID: "long", Subject: "Planning minutes", Body: long},
+		{ID: "short", Subject: "Lunch", Body: "Pizza on Friday?"},
+	} {
+		e.UserID, e.MailboxID, e.Labels = "u1", "INBOX", []string{"INBOX"}
+		if err := emails.UpsertFromGmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexer := NewEmbeddingIndexer(emails, repository.NewEmbeddingIndexRepository(db), embedder, "openai", 0)
+	if _, err := indexer.IndexUser(ctx, "u1", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := emails.GetByID(ctx, "long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first chunk, which is all a single-vector search would see, doesn't match
+	if stored.Embedding[1] != 0 {
+		t.Fatalf("first chunk embedding = %v, want the unrelated [1 0]", stored.Embedding)
+	}
+	if n := len(stored.EmbeddingChunks); n < 3 || stored.EmbeddingChunks[n-1].TextOffset == 0 {
+		t.Fatalf("stored %d chunks, want every window of the body", n)
+	}
+
+	s := NewSearchService(emails, embedder, nil, VectorSearchConfig{}, 0)
+	res, err := s.Semantic(ctx, "u1", "wire transfer", nil, 10, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "long" || res.Hits[0].Score < 0.99 {
+		t.Errorf("hits = %+v, want only the long email, scored by its tail chunk", res.Hits)
+	}
+}
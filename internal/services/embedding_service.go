@@ -7,18 +7,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"aiemailbox-be/config"
 )
 
+// ErrEmbeddingDimensionMismatch means stored embeddings and the query vector come from models
+// with different dimensions, so they can't be compared
+var ErrEmbeddingDimensionMismatch = errors.New("embedding dimension mismatch")
+
 // EmbeddingService defines the interface for generating embeddings
 type EmbeddingService interface {
 	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
 	BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
 	GetDimension() int
+	// ModelName is the model the vectors come from; vectors of different models don't compare
+	ModelName() string
 }
 
 // OpenAIEmbeddingService implements EmbeddingService using OpenAI API
@@ -49,6 +57,13 @@ func NewEmbeddingService(cfg *config.Config) EmbeddingService {
 			client:    &http.Client{Timeout: 30 * time.Second},
 			dimension: 768, // Gemini embedding-001 dimension
 		}
+	case "local":
+		return &LocalEmbeddingService{
+			baseURL: strings.TrimRight(cfg.EmbeddingBaseURL, "/"),
+			apiKey:  cfg.EmbeddingAPIKey,
+			model:   getLocalModel(cfg.EmbeddingModel),
+			client:  &http.Client{Timeout: 120 * time.Second},
+		}
 	case "openai":
 		fallthrough
 	default:
@@ -78,6 +93,11 @@ func (s *OpenAIEmbeddingService) GetDimension() int {
 	return s.dimension
 }
 
+// ModelName returns the embedding model
+func (s *OpenAIEmbeddingService) ModelName() string {
+	return s.model
+}
+
 // GenerateEmbedding generates embedding for a single text using OpenAI
 func (s *OpenAIEmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
 	if s.apiKey == "" {
@@ -120,18 +140,22 @@ func (s *OpenAIEmbeddingService) GenerateEmbedding(ctx context.Context, text str
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, &providerError{provider: "OpenAI", status: resp.StatusCode, body: string(bodyBytes)}
 	}
 
 	var result struct {
 		Data []struct {
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	reportTokens(ctx, result.Usage.PromptTokens, 0)
 
 	if len(result.Data) == 0 {
 		return nil, errors.New("no embedding data in response")
@@ -193,7 +217,7 @@ func (s *OpenAIEmbeddingService) BatchGenerateEmbeddings(ctx context.Context, te
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, &providerError{provider: "OpenAI", status: resp.StatusCode, body: string(bodyBytes)}
 	}
 
 	var result struct {
@@ -201,11 +225,15 @@ func (s *OpenAIEmbeddingService) BatchGenerateEmbeddings(ctx context.Context, te
 			Index     int       `json:"index"`
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	reportTokens(ctx, result.Usage.PromptTokens, 0)
 
 	// Sort by index and extract embeddings
 	embeddings := make([][]float32, len(cleanTexts))
@@ -225,6 +253,11 @@ func (s *GeminiEmbeddingService) GetDimension() int {
 	return s.dimension
 }
 
+// ModelName returns the embedding model
+func (s *GeminiEmbeddingService) ModelName() string {
+	return s.model
+}
+
 // GenerateEmbedding generates embedding using Gemini API
 func (s *GeminiEmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
 	if s.apiKey == "" {
@@ -271,7 +304,7 @@ func (s *GeminiEmbeddingService) GenerateEmbedding(ctx context.Context, text str
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, &providerError{provider: "Gemini", status: resp.StatusCode, body: string(bodyBytes)}
 	}
 
 	var result struct {
@@ -302,6 +335,132 @@ func (s *GeminiEmbeddingService) BatchGenerateEmbeddings(ctx context.Context, te
 	return embeddings, nil
 }
 
+// ======== Local (OpenAI-compatible) Embedding Service ========
+
+// LocalEmbeddingService implements EmbeddingService against a self-hosted server exposing the
+// OpenAI /v1/embeddings API (Ollama, LM Studio, vLLM, ...). The dimension depends on the model,
+// so it is taken from the first response.
+type LocalEmbeddingService struct {
+	baseURL   string // e.g. http://localhost:11434/v1
+	apiKey    string // optional; sent as a bearer token when set
+	model     string
+	client    *http.Client
+	dimension atomic.Int64
+}
+
+func getLocalModel(model string) string {
+	// The OpenAI default means EMBEDDING_MODEL wasn't set for the local server
+	if model == "" || model == "text-embedding-ada-002" {
+		return "nomic-embed-text"
+	}
+	return model
+}
+
+// GetDimension returns the embedding dimension, or 0 before the first embedding
+func (s *LocalEmbeddingService) GetDimension() int {
+	return int(s.dimension.Load())
+}
+
+// ModelName returns the embedding model
+func (s *LocalEmbeddingService) ModelName() string {
+	return s.model
+}
+
+// GenerateEmbedding generates embedding for a single text
+func (s *LocalEmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := s.BatchGenerateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return nil, errors.New("no embedding data in response")
+	}
+	return embeddings[0], nil
+}
+
+// BatchGenerateEmbeddings generates embeddings for multiple texts in one request
+func (s *LocalEmbeddingService) BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.baseURL == "" {
+		return nil, errors.New("EMBEDDING_BASE_URL not configured")
+	}
+
+	cleanTexts := make([]string, 0, len(texts))
+	for _, t := range texts {
+		if t = strings.TrimSpace(t); t != "" {
+			cleanTexts = append(cleanTexts, t)
+		}
+	}
+	if len(cleanTexts) == 0 {
+		return nil, errors.New("no valid texts provided")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.model,
+		"input": cleanTexts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &providerError{provider: "Local embeddings", status: resp.StatusCode, body: string(bodyBytes)}
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	reportTokens(ctx, result.Usage.PromptTokens, 0)
+
+	embeddings := make([][]float32, len(cleanTexts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(embeddings) || len(d.Embedding) == 0 {
+			continue
+		}
+		if err := s.checkDimension(len(d.Embedding)); err != nil {
+			return nil, err
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+// checkDimension records the dimension of the first embedding and rejects later ones that
+// differ, e.g. after the server's model was swapped
+func (s *LocalEmbeddingService) checkDimension(n int) error {
+	if s.dimension.CompareAndSwap(0, int64(n)) {
+		return nil
+	}
+	if want := s.dimension.Load(); int64(n) != want {
+		return fmt.Errorf("%w: %s returned %d dimensions, earlier embeddings have %d", ErrEmbeddingDimensionMismatch, s.model, n, want)
+	}
+	return nil
+}
+
 // ======== Cosine Similarity for Vector Search ========
 
 // CosineSimilarity computes cosine similarity between two vectors
@@ -321,20 +480,5 @@ func CosineSimilarity(a, b []float32) float32 {
 		return 0
 	}
 
-	return dotProduct / (sqrt32(normA) * sqrt32(normB))
-}
-
-func sqrt32(x float32) float32 {
-	return float32(sqrtNewton(float64(x)))
-}
-
-func sqrtNewton(x float64) float64 {
-	if x <= 0 {
-		return 0
-	}
-	z := x
-	for i := 0; i < 10; i++ {
-		z = (z + x/z) / 2
-	}
-	return z
+	return float32(float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB))))
 }
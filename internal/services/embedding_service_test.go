@@ -0,0 +1,158 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// localEmbeddingServer fakes an OpenAI-compatible /v1/embeddings endpoint answering each
+// input with a vector of dims[call] dimensions (the last entry once calls run past it)
+func localEmbeddingServer(t *testing.T, got *embeddingsRequest, dims ...int) *httptest.Server {
+	t.Helper()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/embeddings" {
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer local-key" {
+			http.Error(w, "bad auth "+auth, http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dim := dims[min(calls, len(dims)-1)]
+		calls++
+		type datum struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []datum
+		// Answer out of order: the index, not the position, says which input it belongs to
+		for i := len(got.Input) - 1; i >= 0; i-- {
+			v := make([]float32, dim)
+			v[0] = float32(i + 1)
+			data = append(data, datum{Index: i, Embedding: v})
+		}
+		writeJSON(w, map[string]any{"data": data, "usage": map[string]int{"prompt_tokens": 7}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newLocalEmbeddings(baseURL, model string) EmbeddingService {
+	return NewEmbeddingService(&config.Config{
+		EmbeddingProvider: "local",
+		EmbeddingBaseURL:  baseURL + "/v1/",
+		EmbeddingAPIKey:   "local-key",
+		EmbeddingModel:    model,
+	})
+}
+
+func TestLocalEmbeddingService(t *testing.T) {
+	var got embeddingsRequest
+	srv := localEmbeddingServer(t, &got, 3)
+	s := newLocalEmbeddings(srv.URL, "")
+
+	if s.GetDimension() != 0 || s.ModelName() != "nomic-embed-text" {
+		t.Errorf("before use: dimension %d, model %q", s.GetDimension(), s.ModelName())
+	}
+	var usage tokenUsage
+	ctx := context.WithValue(context.Background(), tokenSinkKey{}, &usage)
+	vectors, err := s.BatchGenerateEmbeddings(ctx, []string{" first ", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "nomic-embed-text" || !reflect.DeepEqual(got.Input, []string{"first", "second"}) {
+		t.Errorf("request = %+v", got)
+	}
+	if !reflect.DeepEqual(vectors, [][]float32{{1, 0, 0}, {2, 0, 0}}) {
+		t.Errorf("vectors = %v, want them in input order", vectors)
+	}
+	if s.GetDimension() != 3 {
+		t.Errorf("dimension = %d, want 3 from the response", s.GetDimension())
+	}
+	if usage.prompt != 7 {
+		t.Errorf("reported %d prompt tokens, want 7", usage.prompt)
+	}
+
+	if v, err := s.GenerateEmbedding(context.Background(), "third"); err != nil || len(v) != 3 {
+		t.Errorf("GenerateEmbedding = %v, %v", v, err)
+	}
+	if _, err := s.BatchGenerateEmbeddings(context.Background(), []string{" ", ""}); err == nil {
+		t.Error("blank texts sent to the server")
+	}
+	if _, err := newLocalEmbeddings("", "m").GenerateEmbedding(context.Background(), "x"); err == nil {
+		t.Error("no error without EMBEDDING_BASE_URL")
+	}
+}
+
+// Swapping the model behind the server changes the dimension; mixing such vectors with the
+// stored ones would make every similarity 0, so it is an error
+func TestLocalEmbeddingDimensionMismatch(t *testing.T) {
+	var got embeddingsRequest
+	srv := localEmbeddingServer(t, &got, 768, 768, 1024)
+	s := newLocalEmbeddings(srv.URL, "nomic-embed-text")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.GenerateEmbedding(context.Background(), "hello"); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	_, err := s.GenerateEmbedding(context.Background(), "hello")
+	if !errors.Is(err, ErrEmbeddingDimensionMismatch) {
+		t.Fatalf("1024 after 768 dimensions = %v, want ErrEmbeddingDimensionMismatch", err)
+	}
+	if s.GetDimension() != 768 {
+		t.Errorf("dimension = %d, want the first 768 kept", s.GetDimension())
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2, 3}, []float32{10, 20, 30}, 1},
+		{"opposite", []float32{1, -2}, []float32{-1, 2}, -1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 5}, 0},
+		{"45 degrees", []float32{1, 0}, []float32{1, 1}, 1 / math.Sqrt2},
+		{"known value", []float32{3, 4, 0}, []float32{4, 3, 12}, 24.0 / 65},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+		{"both zero", []float32{0, 0}, []float32{0, 0}, 0},
+		{"length mismatch", []float32{1, 0}, []float32{1, 0, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		got := CosineSimilarity(tt.a, tt.b)
+		if math.Abs(float64(got)-tt.want) > 1e-6 {
+			t.Errorf("%s: CosineSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Large components must not lose precision: 1536 dimensions like text-embedding-3-small
+	a, b := make([]float32, 1536), make([]float32, 1536)
+	for i := range a {
+		a[i] = float32(i%7) - 3
+		b[i] = a[i] * 1000
+	}
+	if got := CosineSimilarity(a, b); math.Abs(float64(got)-1) > 1e-5 {
+		t.Errorf("1536 dimensions: CosineSimilarity = %v, want 1", got)
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// embeddingUsersPerRun bounds how many users one worker tick serves; each gets one batch
+	embeddingUsersPerRun = 20
+	// embeddingMaxBackoff caps the pause after repeated provider 429s
+	embeddingMaxBackoff = 30 * time.Minute
+)
+
+// embeddingBatchSize returns the emails sent per provider request. OpenAI takes an array of
+// inputs per call; Gemini embeds one text per request, so smaller batches keep a tick short.
+func embeddingBatchSize(provider string, override int) int {
+	if override > 0 {
+		return override
+	}
+	switch strings.ToLower(provider) {
+	case "gemini":
+		return 16
+	default:
+		return 64
+	}
+}
+
+// EmbeddingRunResult counts what one indexing run did
+type EmbeddingRunResult struct {
+	Processed int `json:"processed"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"` // no text to embed
+	// Re-synced emails whose content hash still matched their embedding
+	Unchanged int `json:"unchanged"`
+}
+
+// EmbeddingStats counts the indexer's work since startup
+type EmbeddingStats struct {
+	Generated uint64 `json:"generated"`
+	Unchanged uint64 `json:"unchanged"`
+}
+
+// EmbeddingIndexer embeds emails that don't have an embedding yet and keeps per-user progress
+type EmbeddingIndexer struct {
+	emails    *repository.EmailRepository
+	status    *repository.EmbeddingIndexRepository
+	embedding EmbeddingService
+	batchSize int
+
+	generated atomic.Uint64
+	unchanged atomic.Uint64
+}
+
+// NewEmbeddingIndexer creates an indexer; batchSize 0 picks the provider default
+func NewEmbeddingIndexer(emails *repository.EmailRepository, status *repository.EmbeddingIndexRepository, embedding EmbeddingService, provider string, batchSize int) *EmbeddingIndexer {
+	return &EmbeddingIndexer{
+		emails:    emails,
+		status:    status,
+		embedding: embedding,
+		batchSize: embeddingBatchSize(provider, batchSize),
+	}
+}
+
+// BatchSize is the number of emails per provider request
+func (x *EmbeddingIndexer) BatchSize() int {
+	return x.batchSize
+}
+
+// Stats returns how many emails were embedded and how many re-embeddings were skipped
+func (x *EmbeddingIndexer) Stats() EmbeddingStats {
+	return EmbeddingStats{Generated: x.generated.Load(), Unchanged: x.unchanged.Load()}
+}
+
+// EmbeddingHash identifies an embedding's input: the embedded text and the model
+func EmbeddingHash(text, model string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbeddingText is what an email's embedding is computed from: the subject and the plain
+// text body (or the preview)
+func EmbeddingText(e *models.Email) string {
+	body := strings.TrimSpace(stripHTML(e.Body))
+	if body == "" {
+		body = strings.TrimSpace(e.Preview)
+	}
+	return strings.TrimSpace(e.Subject + "\n" + body)
+}
+
+// IndexUser embeds up to limit of userID's pending emails, one provider request per batch,
+// and records the user's progress. Emails whose stored hash matches their content are not
+// embedded again. Provider errors stop the run and are returned (check IsRateLimited); emails
+// that fail to save are counted and left pending.
+func (x *EmbeddingIndexer) IndexUser(ctx context.Context, userID string, limit int) (EmbeddingRunResult, error) {
+	var res EmbeddingRunResult
+	ctx = WithUsageUser(ctx, userID)
+
+	var runErr error
+	model := x.embedding.ModelName()
+	for done := 0; done < limit; done = res.Processed + res.Failed + res.Skipped + res.Unchanged {
+		batch := x.batchSize
+		if limit-done < batch {
+			batch = limit - done
+		}
+		emails, err := x.emails.GetEmailsWithoutEmbedding(ctx, userID, batch)
+		if err != nil {
+			runErr = err
+			break
+		}
+		if len(emails) == 0 {
+			break
+		}
+
+		var ids, hashes, empty, unchanged []string
+		var chunks [][]TextChunk
+		var texts []string
+		for i := range emails {
+			text := EmbeddingText(&emails[i])
+			if text == "" {
+				empty = append(empty, emails[i].ID)
+				continue
+			}
+			hash := EmbeddingHash(text, model)
+			if hash == emails[i].EmbeddingHash && len(emails[i].Embedding) > 0 {
+				unchanged = append(unchanged, emails[i].ID)
+				continue
+			}
+			emailChunks := ChunkText(text, embeddingChunkRunes, embeddingChunkOverlap, embeddingMaxChunks)
+			ids = append(ids, emails[i].ID)
+			hashes = append(hashes, hash)
+			chunks = append(chunks, emailChunks)
+			for _, chunk := range emailChunks {
+				texts = append(texts, chunk.Text)
+			}
+		}
+		if len(empty) > 0 {
+			if err := x.emails.MarkEmbeddingSkipped(ctx, empty); err != nil {
+				runErr = err
+				break
+			}
+			res.Skipped += len(empty)
+		}
+		if len(unchanged) > 0 {
+			if err := x.emails.ClearEmbeddingStale(ctx, unchanged); err != nil {
+				runErr = err
+				break
+			}
+			res.Unchanged += len(unchanged)
+			x.unchanged.Add(uint64(len(unchanged)))
+		}
+		if len(texts) == 0 {
+			continue
+		}
+
+		vectors, err := x.embedTexts(ctx, texts)
+		if err != nil {
+			runErr = err
+			break
+		}
+		next := 0
+		for i, emailChunks := range chunks {
+			stored := make([]models.EmbeddingChunk, 0, len(emailChunks))
+			for _, chunk := range emailChunks {
+				if vector := vectors[next]; len(vector) > 0 {
+					stored = append(stored, models.EmbeddingChunk{
+						ChunkIndex: chunk.Index,
+						TextOffset: chunk.Offset,
+						Embedding:  vector,
+					})
+				}
+				next++
+			}
+			if len(stored) != len(emailChunks) {
+				res.Failed++
+				continue
+			}
+			if err := x.emails.SetEmbeddingChunks(ctx, ids[i], stored, hashes[i]); err != nil {
+				res.Failed++
+				continue
+			}
+			res.Processed++
+			x.generated.Add(1)
+		}
+		if len(emails) < batch {
+			break
+		}
+	}
+
+	if err := x.recordRun(ctx, userID, res.Processed, runErr); err != nil {
+		log.Println("embedding indexer: failed to record progress:", userID, err)
+	}
+	return res, runErr
+}
+
+// embedTexts embeds texts at most batchSize per provider request; long emails are split in
+// several chunks, so one batch of emails can need more than one request
+func (x *EmbeddingIndexer) embedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += x.batchSize {
+		end := start + x.batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := x.embedding.BatchGenerateEmbeddings(ctx, texts[start:end])
+		if err == nil && len(batch) != end-start {
+			err = fmt.Errorf("provider returned %d embeddings for %d texts", len(batch), end-start)
+		}
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// Status returns userID's indexing progress with fresh counts
+func (x *EmbeddingIndexer) Status(ctx context.Context, userID string) (*models.EmbeddingIndexStatus, error) {
+	status, err := x.status.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := x.count(ctx, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (x *EmbeddingIndexer) count(ctx context.Context, status *models.EmbeddingIndexStatus) error {
+	total, indexed, pending, err := x.emails.CountEmbeddingStatus(ctx, status.UserID)
+	if err != nil {
+		return err
+	}
+	status.Total, status.Indexed, status.Pending = total, indexed, pending
+	status.Skipped = total - indexed - pending
+	if status.Skipped < 0 {
+		status.Skipped = 0
+	}
+	return nil
+}
+
+func (x *EmbeddingIndexer) recordRun(ctx context.Context, userID string, indexed int, runErr error) error {
+	status := &models.EmbeddingIndexStatus{UserID: userID}
+	if err := x.count(ctx, status); err != nil {
+		return err
+	}
+	return x.status.RecordRun(ctx, status, indexed, runErr)
+}
+
+// StartEmbeddingWorker starts a background goroutine that embeds emails without an embedding.
+// Each tick serves up to embeddingUsersPerRun users with one batch each. A provider 429 pauses
+// the worker, doubling the pause on each consecutive one up to embeddingMaxBackoff. The worker
+// stops when ctx is done.
+func StartEmbeddingWorker(ctx context.Context, interval time.Duration, indexer *EmbeddingIndexer) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		var backoff time.Duration
+		var resumeAt time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("embedding worker: shutting down")
+				return
+			case <-ticker.C:
+				if time.Now().Before(resumeAt) {
+					continue
+				}
+				users, err := indexer.emails.UsersWithoutEmbedding(ctx, embeddingUsersPerRun)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Println("embedding worker: error listing users:", err)
+					}
+					continue
+				}
+
+				rateLimited := false
+				for _, userID := range users {
+					_, err := indexer.IndexUser(ctx, userID, indexer.BatchSize())
+					var capErr *UsageCapError
+					switch {
+					case err == nil, errors.As(err, &capErr):
+						// users at their token cap wait for next month
+					case IsRateLimited(err):
+						rateLimited = true
+					default:
+						log.Println("embedding worker: indexing failed:", userID, err)
+					}
+					if rateLimited {
+						break
+					}
+				}
+
+				if !rateLimited {
+					backoff = 0
+					continue
+				}
+				if backoff == 0 {
+					backoff = interval
+				}
+				backoff *= 2
+				if backoff > embeddingMaxBackoff {
+					backoff = embeddingMaxBackoff
+				}
+				resumeAt = time.Now().Add(backoff)
+				log.Printf("embedding worker: provider rate limited, pausing for %s", backoff)
+			}
+		}
+	}()
+}
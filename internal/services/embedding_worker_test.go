@@ -0,0 +1,118 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"testing"
+)
+
+func TestEmbeddingHash(t *testing.T) {
+	h := EmbeddingHash("Budget\nQ3 numbers", "model-a")
+	if len(h) != 64 {
+		t.Fatalf("hash %q is not hex SHA-256", h)
+	}
+	if h != EmbeddingHash("Budget\nQ3 numbers", "model-a") {
+		t.Error("hash is not deterministic")
+	}
+	if h == EmbeddingHash("Budget\nQ4 numbers", "model-a") {
+		t.Error("hash ignores the text")
+	}
+	if h == EmbeddingHash("Budget\nQ3 numbers", "model-b") {
+		t.Error("hash ignores the model")
+	}
+	// The separator keeps model and text apart
+	if EmbeddingHash("bc", "a") == EmbeddingHash("c", "ab") {
+		t.Error("model/text boundary is ambiguous")
+	}
+}
+
+func TestEmbeddingText(t *testing.T) {
+	tests := []struct {
+		email models.Email
+		want  string
+	}{
+		{models.Email{Subject: "Budget", Body: "<p>Q3 <b>numbers</b></p>", Preview: "ignored"}, "Budget\nQ3 numbers"},
+		{models.Email{Subject: "Budget", Preview: " Q3 preview "}, "Budget\nQ3 preview"},
+		{models.Email{Body: "<br>", Preview: ""}, ""},
+	}
+	for _, tt := range tests {
+		if got := EmbeddingText(&tt.email); got != tt.want {
+			t.Errorf("EmbeddingText(%+v) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+// countingEmbedder returns a fixed vector per text and counts the texts it embedded
+type countingEmbedder struct {
+	texts int
+}
+
+func (e *countingEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	e.texts++
+	return []float32{1, 0}, nil
+}
+
+func (e *countingEmbedder) BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	e.texts += len(texts)
+	return vectors, nil
+}
+
+func (e *countingEmbedder) GetDimension() int { return 2 }
+
+func (e *countingEmbedder) ModelName() string { return "test-model" }
+
+func TestIndexUserComparesHashes(t *testing.T) {
+	db := testutil.MongoDB(t)
+	emails := repository.NewEmailRepository(db)
+	embedder := &countingEmbedder{}
+	indexer := NewEmbeddingIndexer(emails, repository.NewEmbeddingIndexRepository(db), embedder, "openai", 0)
+	ctx := context.Background()
+
+	sync := func(body, preview string) {
+		t.Helper()
+		e := &models.Email{ID: "e1", UserID: "u1", MailboxID: "INBOX", Labels: []string{"INBOX"}, Subject: "Budget", Body: body, Preview: preview}
+		if err := emails.UpsertFromGmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := func(want EmbeddingRunResult, wantTexts int) {
+		t.Helper()
+		embedder.texts = 0
+		res, err := indexer.IndexUser(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != want || embedder.texts != wantTexts {
+			t.Errorf("IndexUser = %+v with %d texts embedded, want %+v with %d", res, embedder.texts, want, wantTexts)
+		}
+	}
+
+	sync("Q3 numbers", "Q3")
+	index(EmbeddingRunResult{Processed: 1}, 1)
+	stored, _ := emails.GetByID(ctx, "e1")
+	if stored.EmbeddingHash != EmbeddingHash("Budget\nQ3 numbers", "test-model") {
+		t.Errorf("stored hash %q does not match the embedded text", stored.EmbeddingHash)
+	}
+
+	// Unchanged re-sync: nothing pending
+	sync("Q3 numbers", "Q3")
+	index(EmbeddingRunResult{}, 0)
+
+	// Only the preview changed: flagged stale, but the embedded text and hash are the same
+	sync("Q3 numbers", "Q3 update")
+	index(EmbeddingRunResult{Unchanged: 1}, 0)
+
+	// The body changed: embedded again
+	sync("Q4 numbers", "Q3 update")
+	index(EmbeddingRunResult{Processed: 1}, 1)
+
+	if stats := indexer.Stats(); stats.Generated != 2 || stats.Unchanged != 1 {
+		t.Errorf("Stats = %+v, want 2 generated and 1 unchanged", stats)
+	}
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NoEventError means the email has no event, or one too ambiguous to put in a calendar
+type NoEventError struct {
+	Reason string
+}
+
+func (e *NoEventError) Error() string {
+	return "no calendar event: " + e.Reason
+}
+
+// defaultEventDuration is used when an invitation or the email gives no end time
+const defaultEventDuration = time.Hour
+
+// EventResult is an extracted event and where it came from
+type EventResult struct {
+	Event  *models.CalendarEvent
+	Source string // "ics" or "llm"
+}
+
+// EventService turns emails into calendar events. ICS invitations are parsed locally; plain
+// text is only handled when an LLM provider is configured.
+type EventService struct {
+	gmail *GmailService
+	users *repository.UserRepository
+	llm   LLMProvider // nil: ICS only
+}
+
+// NewEventService creates an event service; llm may be nil
+func NewEventService(gmail *GmailService, users *repository.UserRepository, llm LLMProvider) *EventService {
+	return &EventService{gmail: gmail, users: users, llm: llm}
+}
+
+// Extract returns the event in email. loc is the user's time zone, used for relative
+// dates in the text and for invitations with floating times.
+func (s *EventService) Extract(ctx context.Context, email *models.Email, loc *time.Location) (*EventResult, error) {
+	user, err := s.users.FindByID(ctx, email.UserID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.gmail.GetCalendarParts(ctx, user, email.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		ev, err := ParseICS(part, loc)
+		if err == nil {
+			return &EventResult{Event: ev, Source: "ics"}, nil
+		}
+		fmt.Printf("Email %s: unusable calendar part: %v\n", email.ID, err)
+	}
+
+	if s.llm == nil {
+		if len(parts) > 0 {
+			return nil, &NoEventError{Reason: "the calendar invitation could not be read"}
+		}
+		return nil, ErrLLMNotConfigured
+	}
+	ev, err := s.extractWithLLM(ctx, email, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &EventResult{Event: ev, Source: "llm"}, nil
+}
+
+// ===== ICS parsing =====
+
+// icsProperty is one content line: NAME;PARAM=value:value
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// ParseICS reads the first VEVENT of an iCalendar document. Times with a TZID are read in
+// that zone (falling back to loc for unknown zone names), UTC times as UTC and floating
+// times in loc.
+func ParseICS(data string, loc *time.Location) (*models.CalendarEvent, error) {
+	props, err := icsEventProperties(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &models.CalendarEvent{Attendees: []models.EmailAddress{}}
+	var duration time.Duration
+	hasEnd := false
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			ev.UID = p.value
+		case "SUMMARY":
+			ev.Title = icsUnescape(p.value)
+		case "LOCATION":
+			ev.Location = icsUnescape(p.value)
+		case "DESCRIPTION":
+			ev.Description = icsUnescape(p.value)
+		case "DTSTART":
+			ev.Start, ev.AllDay, err = icsTime(p, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTSTART: %w", err)
+			}
+			ev.TimeZone = icsZoneName(p, ev.Start)
+		case "DTEND":
+			ev.End, _, err = icsTime(p, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTEND: %w", err)
+			}
+			hasEnd = true
+		case "DURATION":
+			duration, err = icsDuration(p.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DURATION: %w", err)
+			}
+		case "ORGANIZER":
+			addr := icsAddress(p)
+			ev.Organizer = &addr
+		case "ATTENDEE":
+			ev.Attendees = append(ev.Attendees, icsAddress(p))
+		}
+	}
+
+	if ev.Start.IsZero() {
+		return nil, errors.New("event has no start time")
+	}
+	switch {
+	case hasEnd:
+	case duration > 0:
+		ev.End = ev.Start.Add(duration)
+	case ev.AllDay:
+		ev.End = ev.Start.AddDate(0, 0, 1)
+	default:
+		ev.End = ev.Start.Add(defaultEventDuration)
+	}
+	if ev.Title == "" {
+		ev.Title = "Untitled event"
+	}
+	return ev, nil
+}
+
+// icsEventProperties unfolds the document and returns the properties of its first VEVENT
+func icsEventProperties(data string) ([]icsProperty, error) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	// Unfold: a line starting with a space or tab continues the previous one
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\n ", ""), "\n\t", "")
+
+	var props []icsProperty
+	inEvent, depth := false, 0
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		upper := strings.ToUpper(line)
+		switch {
+		case upper == "BEGIN:VEVENT" && !inEvent:
+			inEvent = true
+			continue
+		case !inEvent:
+			continue
+		case strings.HasPrefix(upper, "BEGIN:"):
+			// nested components (VALARM) are skipped
+			depth++
+			continue
+		case strings.HasPrefix(upper, "END:"):
+			if depth == 0 {
+				return props, nil
+			}
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		if p, ok := parseICSLine(line); ok {
+			props = append(props, p)
+		}
+	}
+	if !inEvent {
+		return nil, errors.New("no VEVENT found")
+	}
+	return nil, errors.New("unterminated VEVENT")
+}
+
+func parseICSLine(line string) (icsProperty, bool) {
+	// The value starts at the first colon outside a quoted parameter value
+	inQuotes, colon := false, -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icsProperty{}, false
+	}
+
+	head := strings.Split(line[:colon], ";")
+	p := icsProperty{name: strings.ToUpper(head[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range head[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, true
+}
+
+func icsTime(p icsProperty, loc *time.Location) (t time.Time, allDay bool, err error) {
+	v := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(v) == 8 {
+		t, err = time.ParseInLocation("20060102", v, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err = time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	zone := loc
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, lerr := time.LoadLocation(tzid); lerr == nil {
+			zone = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", v, zone)
+	return t, false, err
+}
+
+func icsZoneName(p icsProperty, t time.Time) string {
+	if tzid := p.params["TZID"]; tzid != "" {
+		if _, err := time.LoadLocation(tzid); err == nil {
+			return tzid
+		}
+	}
+	return t.Location().String()
+}
+
+// icsDuration parses the common RFC 5545 forms: P1W, P1D, PT1H30M, P1DT2H
+func icsDuration(v string) (time.Duration, error) {
+	v = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "+")
+	if !strings.HasPrefix(v, "P") {
+		return 0, fmt.Errorf("unsupported duration %q", v)
+	}
+	var d time.Duration
+	n := 0
+	inTime := false
+	for _, r := range v[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			n = n*10 + int(r-'0')
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		case r == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("unsupported duration %q", v)
+		}
+		n = 0
+	}
+	return d, nil
+}
+
+func icsAddress(p icsProperty) models.EmailAddress {
+	addr := p.value
+	if strings.HasPrefix(strings.ToLower(addr), "mailto:") {
+		addr = addr[len("mailto:"):]
+	}
+	return models.EmailAddress{Name: p.params["CN"], Email: addr}
+}
+
+func icsUnescape(v string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(v)
+}
+
+func icsEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(v)
+}
+
+// BuildICS renders ev as a single-event iCalendar file. Times are written in UTC, all-day
+// events as dates.
+func BuildICS(ev *models.CalendarEvent) string {
+	uid := ev.UID
+	if uid == "" {
+		uid = fmt.Sprintf("%d@aiemailbox", ev.Start.UnixNano())
+	}
+
+	var b strings.Builder
+	line := func(s string) {
+		// Fold at 75 octets, continuation lines start with a space
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && !utf8RuneStart(s[cut]) {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//AiEmailbox//Event Extraction//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("BEGIN:VEVENT")
+	line("UID:" + uid)
+	line("DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z"))
+	if ev.AllDay {
+		line("DTSTART;VALUE=DATE:" + ev.Start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + ev.End.Format("20060102"))
+	} else {
+		line("DTSTART:" + ev.Start.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + ev.End.UTC().Format("20060102T150405Z"))
+	}
+	line("SUMMARY:" + icsEscape(ev.Title))
+	if ev.Location != "" {
+		line("LOCATION:" + icsEscape(ev.Location))
+	}
+	if ev.Description != "" {
+		line("DESCRIPTION:" + icsEscape(ev.Description))
+	}
+	if ev.Organizer != nil && ev.Organizer.Email != "" {
+		line(icsAddressLine("ORGANIZER", *ev.Organizer))
+	}
+	for _, a := range ev.Attendees {
+		if a.Email != "" {
+			line(icsAddressLine("ATTENDEE", a))
+		}
+	}
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func icsAddressLine(name string, a models.EmailAddress) string {
+	if a.Name != "" {
+		name += `;CN="` + strings.ReplaceAll(a.Name, `"`, "'") + `"`
+	}
+	return name + ":mailto:" + a.Email
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// ===== LLM extraction =====
+
+// llmEvent is the JSON the model is asked for
+type llmEvent struct {
+	Found     bool     `json:"found"`
+	Reason    string   `json:"reason"`
+	Title     string   `json:"title"`
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	AllDay    bool     `json:"allDay"`
+	Location  string   `json:"location"`
+	Attendees []string `json:"attendees"`
+}
+
+func (s *EventService) extractWithLLM(ctx context.Context, email *models.Email, loc *time.Location) (*models.CalendarEvent, error) {
+	text := stripHTML(email.Body)
+	if strings.TrimSpace(text) == "" {
+		text = email.Preview
+	}
+	if r := []rune(text); len(r) > 4000 {
+		text = string(r[:4000])
+	}
+	sent := email.ReceivedAt.In(loc)
+
+	out, err := s.llm.Generate(withOperation(ctx, "event_extraction"), LLMRequest{
+		System: `You extract a single calendar event from an email. Reply with JSON only, no code fences:
+{"found": bool, "reason": string, "title": string, "start": string, "end": string, "allDay": bool, "location": string, "attendees": [string]}
+- start/end are RFC 3339 with the UTC offset of the given time zone (e.g. 2026-03-10T15:00:00+07:00); for allDay events use midnight.
+- Resolve relative dates ("Tuesday", "tomorrow") against the date the email was sent.
+- attendees are email addresses mentioned as participants.
+- If there is no event, or the date or time cannot be determined without guessing, set found to false and explain why in reason. Never invent a date or time.
+- end may be empty when the email gives no end or duration.`,
+		Prompt: fmt.Sprintf("Time zone: %s\nEmail sent: %s (%s)\nFrom: %s <%s>\nSubject: %s\n\n%s",
+			loc.String(), sent.Format(time.RFC3339), sent.Weekday(), email.From.Name, email.From.Email, email.Subject, text),
+		MaxTokens:   300,
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out = strings.TrimSpace(out)
+	if m := jsonFenceRE.FindStringSubmatch(out); m != nil {
+		out = m[1]
+	}
+	var le llmEvent
+	if err := utils.ParseJSON(out, &le); err != nil {
+		return nil, fmt.Errorf("unexpected event extraction output %q", out)
+	}
+	if !le.Found {
+		reason := strings.TrimSpace(le.Reason)
+		if reason == "" {
+			reason = "no event found in the email"
+		}
+		return nil, &NoEventError{Reason: reason}
+	}
+
+	start, err := time.Parse(time.RFC3339, le.Start)
+	if err != nil {
+		return nil, &NoEventError{Reason: "the event's start time is ambiguous"}
+	}
+	ev := &models.CalendarEvent{
+		Title:     strings.TrimSpace(le.Title),
+		Start:     start.In(loc),
+		AllDay:    le.AllDay,
+		TimeZone:  loc.String(),
+		Location:  strings.TrimSpace(le.Location),
+		Organizer: &models.EmailAddress{Name: email.From.Name, Email: email.From.Email},
+		Attendees: []models.EmailAddress{},
+	}
+	if end, err := time.Parse(time.RFC3339, le.End); err == nil && end.After(start) {
+		ev.End = end.In(loc)
+	} else if ev.AllDay {
+		ev.End = ev.Start.AddDate(0, 0, 1)
+	} else {
+		ev.End = ev.Start.Add(defaultEventDuration)
+	}
+	if ev.Title == "" {
+		ev.Title = email.Subject
+	}
+	for _, a := range le.Attendees {
+		if a = strings.TrimSpace(a); strings.Contains(a, "@") {
+			ev.Attendees = append(ev.Attendees, parseAddress(a))
+		}
+	}
+	return ev, nil
+}
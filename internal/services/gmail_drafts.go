@@ -0,0 +1,378 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrDraftNotFound is returned when Gmail has no draft with the given ID
+var ErrDraftNotFound = errors.New("draft not found")
+
+// replyHeaders thread a message under the one it replies to
+type replyHeaders struct {
+	InReplyTo  string // RFC 822 Message-ID of the parent
+	References string // the parent's References plus its Message-ID
+	ThreadID   string // Gmail thread of the parent
+	Subject    string // the parent's subject
+}
+
+// loadReplyHeaders reads the threading headers of the Gmail message parentID
+func (s *GmailService) loadReplyHeaders(ctx context.Context, srv *gmail.Service, parentID string) (*replyHeaders, error) {
+	msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", parentID).Format("metadata").
+		MetadataHeaders("Message-ID", "References", "Subject").Context(ctx).Do)
+	if err != nil {
+		return nil, messageError(err)
+	}
+
+	h := &replyHeaders{ThreadID: msg.ThreadId}
+	var references string
+	if msg.Payload != nil {
+		for _, header := range msg.Payload.Headers {
+			switch strings.ToLower(header.Name) {
+			case "message-id":
+				h.InReplyTo = header.Value
+			case "references":
+				references = header.Value
+			case "subject":
+				h.Subject = header.Value
+			}
+		}
+	}
+	h.References = strings.TrimSpace(references + " " + h.InReplyTo)
+	return h, nil
+}
+
+// draftReplyHeaders returns the threading headers draft d was saved with, or nil when it
+// isn't a reply
+func draftReplyHeaders(d *gmail.Draft) *replyHeaders {
+	if d.Message == nil || d.Message.Payload == nil {
+		return nil
+	}
+	h := &replyHeaders{ThreadID: d.Message.ThreadId}
+	for _, header := range d.Message.Payload.Headers {
+		switch strings.ToLower(header.Name) {
+		case "in-reply-to":
+			h.InReplyTo = header.Value
+		case "references":
+			h.References = header.Value
+		}
+	}
+	if h.InReplyTo == "" {
+		return nil
+	}
+	return h
+}
+
+// latestThreadMessage returns the ID of the newest message of thread threadID
+func (s *GmailService) latestThreadMessage(ctx context.Context, srv *gmail.Service, threadID string) (string, error) {
+	thread, err := retryGmail(ctx, s.retry, srv.Users.Threads.Get("me", threadID).Format("minimal").Context(ctx).Do)
+	if err != nil {
+		return "", messageError(err)
+	}
+	if len(thread.Messages) == 0 {
+		return "", ErrMessageNotFound
+	}
+	return thread.Messages[len(thread.Messages)-1].Id, nil
+}
+
+// requestAttachments converts the attachments of a draft request, enforcing MaxAttachmentBytes
+func requestAttachments(in []models.DraftAttachment) ([]*models.Attachment, error) {
+	var total int64
+	out := make([]*models.Attachment, 0, len(in))
+	for _, a := range in {
+		total += int64(len(a.Data))
+		filename, mimeType := strings.TrimSpace(a.Filename), a.MimeType
+		if filename == "" {
+			filename = "attachment"
+		}
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		out = append(out, &models.Attachment{Filename: filename, MimeType: mimeType, Size: int64(len(a.Data)), Data: a.Data})
+	}
+	if total > MaxAttachmentBytes {
+		return nil, ErrAttachmentsTooLarge
+	}
+	return out, nil
+}
+
+// draftAttachments downloads the attachments of draft d, so an update that doesn't replace
+// them can attach them again
+func (s *GmailService) draftAttachments(ctx context.Context, user *models.User, d *gmail.Draft) ([]*models.Attachment, error) {
+	if d.Message == nil || d.Message.Payload == nil {
+		return nil, nil
+	}
+	current := s.getAttachments(d.Message.Payload)
+	var total int64
+	for _, att := range current {
+		total += att.Size
+	}
+	if total > MaxAttachmentBytes {
+		return nil, ErrAttachmentsTooLarge
+	}
+	out := make([]*models.Attachment, 0, len(current))
+	for _, att := range current {
+		data, err := s.GetAttachment(ctx, user, d.Message.Id, att.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download attachment %s: %w", att.Filename, messageError(err))
+		}
+		out = append(out, &models.Attachment{Filename: att.Filename, MimeType: att.MimeType, Size: int64(len(data)), Data: data})
+	}
+	return out, nil
+}
+
+// draftMessage builds the Gmail message for a draft request. Replies (to req.InReplyTo, or
+// the latest message of req.ThreadID) get the parent's thread, threading headers and a "Re:"
+// subject when none was given; reply (the headers of the draft being updated) is used when
+// the request names no parent.
+func (s *GmailService) draftMessage(ctx context.Context, srv *gmail.Service, req *models.DraftRequest, reply *replyHeaders, attachments []*models.Attachment) (*gmail.Message, error) {
+	email := &models.Email{
+		To:          toEmailAddresses(req.To),
+		Cc:          toEmailAddresses(req.Cc),
+		Bcc:         toEmailAddresses(req.Bcc),
+		Subject:     req.Subject,
+		Body:        req.Body,
+		Attachments: attachments,
+	}
+
+	parentID := req.InReplyTo
+	if parentID == "" && req.ThreadID != "" {
+		var err error
+		if parentID, err = s.latestThreadMessage(ctx, srv, req.ThreadID); err != nil {
+			return nil, err
+		}
+	}
+	if parentID != "" {
+		var err error
+		if reply, err = s.loadReplyHeaders(ctx, srv, parentID); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(email.Subject) == "" {
+			email.Subject = reply.Subject
+		}
+		if !strings.HasPrefix(strings.ToLower(email.Subject), "re:") {
+			email.Subject = "Re: " + email.Subject
+		}
+	}
+
+	msg := &gmail.Message{Raw: base64.URLEncoding.EncodeToString([]byte(buildRawMessage(email, reply)))}
+	if reply != nil {
+		msg.ThreadId = reply.ThreadID
+	}
+	return msg, nil
+}
+
+func toEmailAddresses(addrs []string) []models.EmailAddress {
+	out := make([]models.EmailAddress, 0, len(addrs))
+	for _, a := range addrs {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, parseAddress(a))
+		}
+	}
+	return out
+}
+
+// CreateDraft saves a new draft
+func (s *GmailService) CreateDraft(ctx context.Context, user *models.User, req *models.DraftRequest) (*models.Draft, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := requestAttachments(req.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.draftMessage(ctx, srv, req, nil, attachments)
+	if err != nil {
+		return nil, err
+	}
+	created, err := srv.Users.Drafts.Create("me", &gmail.Draft{Message: msg}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDraft(ctx, user, created.Id)
+}
+
+// UpdateDraft replaces the content of a draft
+func (s *GmailService) UpdateDraft(ctx context.Context, user *models.User, draftID string, req *models.DraftRequest) (*models.Draft, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []*models.Attachment
+	if req.Attachments != nil {
+		if attachments, err = requestAttachments(req.Attachments); err != nil {
+			return nil, err
+		}
+	}
+
+	// The update replaces the whole message: keep the thread and attachments the request
+	// doesn't change
+	var existing *replyHeaders
+	keepThread := req.InReplyTo == "" && req.ThreadID == ""
+	if keepThread || req.Attachments == nil {
+		current, err := srv.Users.Drafts.Get("me", draftID).Format("full").Context(ctx).Do()
+		if err != nil {
+			return nil, draftError(err)
+		}
+		if keepThread {
+			existing = draftReplyHeaders(current)
+		}
+		if req.Attachments == nil {
+			if attachments, err = s.draftAttachments(ctx, user, current); err != nil {
+				return nil, err
+			}
+		}
+	}
+	msg, err := s.draftMessage(ctx, srv, req, existing, attachments)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := srv.Users.Drafts.Update("me", draftID, &gmail.Draft{Id: draftID, Message: msg}).Context(ctx).Do(); err != nil {
+		return nil, draftError(err)
+	}
+	return s.GetDraft(ctx, user, draftID)
+}
+
+// GetDraft returns a draft with its full body
+func (s *GmailService) GetDraft(ctx context.Context, user *models.User, draftID string) (*models.Draft, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	d, err := srv.Users.Drafts.Get("me", draftID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return nil, draftError(err)
+	}
+	return s.mapDraft(d, true), nil
+}
+
+// ListDrafts returns one page of drafts (without bodies), newest first, and the token of
+// the next page
+func (s *GmailService) ListDrafts(ctx context.Context, user *models.User, pageToken string, maxResults int64) ([]*models.Draft, string, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	call := srv.Users.Drafts.List("me").MaxResults(maxResults).Context(ctx)
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+	resp, err := call.Do()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Drafts.List only returns IDs; load the headers concurrently, keeping the list order
+	const maxConcurrency = 10
+	sem := make(chan struct{}, maxConcurrency)
+	drafts := make([]*models.Draft, len(resp.Drafts))
+	errs := make(chan error, len(resp.Drafts))
+	for i, d := range resp.Drafts {
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer func() { <-sem }()
+			full, err := srv.Users.Drafts.Get("me", id).Format("metadata").Context(ctx).Do()
+			if err == nil {
+				drafts[i] = s.mapDraft(full, false)
+			}
+			errs <- err
+		}(i, d.Id)
+	}
+	for range resp.Drafts {
+		if err := <-errs; err != nil && draftError(err) != ErrDraftNotFound {
+			return nil, "", err
+		}
+	}
+
+	// drop drafts deleted between the list and the get
+	out := drafts[:0]
+	for _, d := range drafts {
+		if d != nil {
+			out = append(out, d)
+		}
+	}
+	return out, resp.NextPageToken, nil
+}
+
+// SendDraft sends a draft; replies stay in their thread. Returns the sent message's ID.
+func (s *GmailService) SendDraft(ctx context.Context, user *models.User, draftID string) (string, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	sent, err := srv.Users.Drafts.Send("me", &gmail.Draft{Id: draftID}).Context(ctx).Do()
+	if err != nil {
+		return "", draftError(err)
+	}
+	cache.Invalidate(user.ID.Hex())
+	return sent.Id, nil
+}
+
+// DeleteDraft permanently deletes a draft
+func (s *GmailService) DeleteDraft(ctx context.Context, user *models.User, draftID string) error {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := srv.Users.Drafts.Delete("me", draftID).Context(ctx).Do(); err != nil {
+		return draftError(err)
+	}
+	return nil
+}
+
+// mapDraft converts a Gmail draft using the message mappers
+func (s *GmailService) mapDraft(d *gmail.Draft, full bool) *models.Draft {
+	draft := &models.Draft{ID: d.Id}
+	if d.Message == nil || d.Message.Payload == nil {
+		return draft
+	}
+
+	var email models.Email
+	if full {
+		email = s.mapGmailMessageToEmail(d.Message)
+	} else {
+		email = s.mapGmailMessageToEmailMetadata(d.Message)
+	}
+	draft.MessageID = email.ID
+	draft.ThreadID = email.ThreadID
+	draft.To = email.To
+	draft.Cc = email.Cc
+	draft.Bcc = email.Bcc
+	draft.Subject = email.Subject
+	draft.Preview = email.Preview
+	draft.Body = email.Body
+	draft.HasAttachments = email.HasAttachments
+	draft.UpdatedAt = email.ReceivedAt
+	if draft.To == nil {
+		draft.To = []models.EmailAddress{}
+	}
+	if full {
+		for _, att := range email.Attachments {
+			withURL := *att
+			withURL.URL = AttachmentURL(email.ID, att.ID)
+			draft.Attachments = append(draft.Attachments, &withURL)
+		}
+		email.DraftID = d.Id
+		draft.Email = &email
+	}
+	return draft
+}
+
+// draftError maps Gmail 404s for a draft to ErrDraftNotFound
+func draftError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return ErrDraftNotFound
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeDraftStore is an in-memory Gmail drafts API. Like Gmail, it parses the raw message of
+// every saved draft into a full-format message with a new message ID, and serves the
+// attachments of those messages.
+type fakeDraftStore struct {
+	mu          sync.Mutex
+	drafts      map[string]*gmail.Message // draft ID -> current message
+	parents     map[string]*gmail.Message // messages drafts can reply to
+	attachments map[string][]byte         // message ID + "/" + attachment ID -> data
+	sent        []*gmail.Message
+	nextID      int
+}
+
+func newFakeDraftStore(parents ...*gmail.Message) *fakeDraftStore {
+	f := &fakeDraftStore{drafts: map[string]*gmail.Message{}, parents: map[string]*gmail.Message{}, attachments: map[string][]byte{}}
+	for _, p := range parents {
+		f.parents[p.Id] = p
+	}
+	return f
+}
+
+// message parses raw like Gmail does when a draft is saved
+func (f *fakeDraftStore) message(raw, threadID string) (*gmail.Message, error) {
+	data, err := base64.URLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	f.nextID++
+	id := fmt.Sprintf("msg-%d", f.nextID)
+	if threadID == "" {
+		threadID = "thread-" + id
+	}
+	msg := &gmail.Message{Id: id, ThreadId: threadID, LabelIds: []string{"DRAFT"}, Payload: &gmail.MessagePart{Body: &gmail.MessagePartBody{}}}
+	for name, values := range parsed.Header {
+		for _, v := range values {
+			msg.Payload.Headers = append(msg.Payload.Headers, &gmail.MessagePartHeader{Name: name, Value: v})
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	msg.Payload.MimeType = mediaType
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+		if err != nil {
+			return nil, err
+		}
+		msg.Payload.Body.Data = base64.URLEncoding.EncodeToString(body)
+		return msg, nil
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			return nil, err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		p := &gmail.MessagePart{MimeType: partType, Filename: part.FileName(), Body: &gmail.MessagePartBody{Size: int64(len(content))}}
+		if p.Filename != "" {
+			p.Body.AttachmentId = fmt.Sprintf("att-%d", i)
+			f.attachments[id+"/"+p.Body.AttachmentId] = content
+		} else {
+			p.Body.Data = base64.URLEncoding.EncodeToString(content)
+		}
+		msg.Payload.Parts = append(msg.Payload.Parts, p)
+	}
+	return msg, nil
+}
+
+func (f *fakeDraftStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	const drafts, messages = "/gmail/v1/users/me/drafts", "/gmail/v1/users/me/messages/"
+
+	readDraft := func() (*gmail.Draft, bool) {
+		var d gmail.Draft
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			writeGmailError(w, http.StatusBadRequest, "invalidArgument")
+			return nil, false
+		}
+		return &d, true
+	}
+	save := func(id string, d *gmail.Draft) {
+		msg, err := f.message(d.Message.Raw, d.Message.ThreadId)
+		if err != nil {
+			writeGmailError(w, http.StatusBadRequest, "invalidArgument")
+			return
+		}
+		f.drafts[id] = msg
+		writeJSON(w, &gmail.Draft{Id: id, Message: &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId}})
+	}
+
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodPost && path == drafts:
+		if d, ok := readDraft(); ok {
+			f.nextID++
+			save(fmt.Sprintf("draft-%d", f.nextID), d)
+		}
+	case r.Method == http.MethodPost && path == drafts+"/send":
+		d, ok := readDraft()
+		if !ok {
+			return
+		}
+		msg, found := f.drafts[d.Id]
+		if !found {
+			writeGmailError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		delete(f.drafts, d.Id)
+		f.sent = append(f.sent, msg)
+		writeJSON(w, &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId, LabelIds: []string{"SENT"}})
+	case strings.HasPrefix(path, drafts+"/"):
+		id := strings.TrimPrefix(path, drafts+"/")
+		msg, found := f.drafts[id]
+		if !found {
+			writeGmailError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, &gmail.Draft{Id: id, Message: msg})
+		case http.MethodPut:
+			if d, ok := readDraft(); ok {
+				save(id, d)
+			}
+		case http.MethodDelete:
+			delete(f.drafts, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, messages):
+		rest := strings.TrimPrefix(path, messages)
+		if msgID, attID, ok := strings.Cut(rest, "/attachments/"); ok {
+			data, found := f.attachments[msgID+"/"+attID]
+			if !found {
+				writeGmailError(w, http.StatusNotFound, "notFound")
+				return
+			}
+			writeJSON(w, &gmail.MessagePartBody{AttachmentId: attID, Size: int64(len(data)), Data: base64.URLEncoding.EncodeToString(data)})
+			return
+		}
+		if msg, found := f.parents[rest]; found {
+			writeJSON(w, msg)
+			return
+		}
+		writeGmailError(w, http.StatusNotFound, "notFound")
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+path, http.StatusNotFound)
+	}
+}
+
+// header returns the value of header name of msg
+func header(msg *gmail.Message, name string) string {
+	for _, h := range msg.Payload.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func TestDraftRoundTrip(t *testing.T) {
+	parent := fakeMessage("parent")
+	parent.Payload.Headers = append(parent.Payload.Headers,
+		&gmail.MessagePartHeader{Name: "Message-ID", Value: "<p1@mail.example.com>"},
+		&gmail.MessagePartHeader{Name: "References", Value: "<p0@mail.example.com>"})
+	store := newFakeDraftStore(parent)
+	s, user := newFakeGmail(t, store, 1, 0)
+	ctx := context.Background()
+
+	// A reply with an attachment
+	created, err := s.CreateDraft(ctx, user, &models.DraftRequest{
+		To:          []string{"Alice <alice@example.com>"},
+		Body:        "<p>First take</p>",
+		InReplyTo:   "parent",
+		Attachments: []models.DraftAttachment{{Filename: "notes.txt", MimeType: "text/plain", Data: []byte("agenda")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Subject != "Re: Subject of parent" || created.ThreadID != "t-parent" || !strings.Contains(created.Body, "First take") {
+		t.Errorf("created draft: subject %q, thread %q, body %q", created.Subject, created.ThreadID, created.Body)
+	}
+	if len(created.To) != 1 || created.To[0].Email != "alice@example.com" || created.To[0].Name != "Alice" {
+		t.Errorf("created draft to = %+v", created.To)
+	}
+	if len(created.Attachments) != 1 || created.Attachments[0].Filename != "notes.txt" || !created.HasAttachments {
+		t.Fatalf("created draft attachments = %+v", created.Attachments)
+	}
+
+	// Updating the text keeps the thread and the attachment
+	updated, err := s.UpdateDraft(ctx, user, created.ID, &models.DraftRequest{
+		To:      []string{"alice@example.com", "bob@example.com"},
+		Subject: "Re: Subject of parent",
+		Body:    "<p>Second take</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || updated.MessageID == created.MessageID || updated.ThreadID != "t-parent" ||
+		!strings.Contains(updated.Body, "Second take") || len(updated.To) != 2 {
+		t.Errorf("updated draft = %+v", updated)
+	}
+	if len(updated.Attachments) != 1 {
+		t.Fatalf("updated draft attachments = %+v, want notes.txt kept", updated.Attachments)
+	}
+	data, err := s.GetAttachment(ctx, user, updated.MessageID, updated.Attachments[0].ID)
+	if err != nil || string(data) != "agenda" {
+		t.Errorf("kept attachment = %q, %v", data, err)
+	}
+
+	// An empty list removes the attachments
+	updated, err = s.UpdateDraft(ctx, user, created.ID, &models.DraftRequest{To: []string{"alice@example.com"}, Subject: "Re: Subject of parent", Body: "<p>Final</p>", Attachments: []models.DraftAttachment{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Attachments) != 0 || updated.HasAttachments || updated.ThreadID != "t-parent" {
+		t.Errorf("draft after removing attachments = %+v", updated)
+	}
+
+	sentID, err := s.SendDraft(ctx, user, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.sent) != 1 || sentID != store.sent[0].Id {
+		t.Fatalf("sent %d messages, ID %q", len(store.sent), sentID)
+	}
+	sent := store.sent[0]
+	if sent.ThreadId != "t-parent" || header(sent, "In-Reply-To") != "<p1@mail.example.com>" ||
+		header(sent, "References") != "<p0@mail.example.com> <p1@mail.example.com>" || header(sent, "Subject") != "Re: Subject of parent" {
+		t.Errorf("sent message: thread %q, headers %+v", sent.ThreadId, sent.Payload.Headers)
+	}
+
+	// The draft is gone once sent
+	if _, err := s.GetDraft(ctx, user, created.ID); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("GetDraft after send = %v, want ErrDraftNotFound", err)
+	}
+	if _, err := s.SendDraft(ctx, user, created.ID); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("second SendDraft = %v, want ErrDraftNotFound", err)
+	}
+	if _, err := s.UpdateDraft(ctx, user, created.ID, &models.DraftRequest{Body: "late"}); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("UpdateDraft after send = %v, want ErrDraftNotFound", err)
+	}
+}
+
+func TestDraftWithoutReplyAndDelete(t *testing.T) {
+	store := newFakeDraftStore()
+	s, user := newFakeGmail(t, store, 1, 0)
+	ctx := context.Background()
+
+	d, err := s.CreateDraft(ctx, user, &models.DraftRequest{To: []string{"carol@example.com"}, Subject: "Lunch?", Body: "<p>Friday</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Subject != "Lunch?" || d.HasAttachments {
+		t.Errorf("draft = %+v", d)
+	}
+	if header(store.drafts[d.ID], "In-Reply-To") != "" {
+		t.Error("a new conversation has an In-Reply-To header")
+	}
+	if err := s.DeleteDraft(ctx, user, d.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteDraft(ctx, user, d.ID); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("second DeleteDraft = %v, want ErrDraftNotFound", err)
+	}
+	if _, err := s.CreateDraft(ctx, user, &models.DraftRequest{To: []string{"carol@example.com"}, InReplyTo: "missing"}); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("reply to a missing message = %v, want ErrMessageNotFound", err)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// newFakeGmail returns a GmailService whose API calls go to handler, and a user it can act
+// for. Retries back off for at most maxDelay.
+func newFakeGmail(t *testing.T, handler http.Handler, attempts int, maxDelay time.Duration) (*GmailService, *models.User) {
+	t.Helper()
+	return newFakeGmailConfig(t, handler, &config.Config{GmailRetryAttempts: attempts, GmailRetryMaxDelay: maxDelay})
+}
+
+// newFakeGmailConfig is newFakeGmail with the service built from cfg
+func newFakeGmailConfig(t *testing.T, handler http.Handler, cfg *config.Config) (*GmailService, *models.User) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	s := NewGmailService(cfg)
+	s.clientOptions = []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}
+	user := &models.User{ID: primitive.NewObjectID(), GoogleRefreshToken: "refresh-token"}
+	return s, user
+}
+
+// writeGmailError writes a Gmail API error response
+func writeGmailError(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": reason,
+			"errors":  []map[string]string{{"reason": reason, "message": reason}},
+		},
+	})
+}
+
+// writeJSON writes v as a 200 JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// fakeMessage is a minimal full-format Gmail message
+func fakeMessage(id string, labels ...string) *gmail.Message {
+	return &gmail.Message{
+		Id:       id,
+		ThreadId: "t-" + id,
+		LabelIds: labels,
+		Payload: &gmail.MessagePart{
+			MimeType: "text/plain",
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "Subject", Value: "Subject of " + id},
+				{Name: "From", Value: "Alice <alice@example.com>"},
+			},
+			Body: &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte("Body of " + id))},
+		},
+	}
+}
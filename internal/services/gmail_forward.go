@@ -0,0 +1,111 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// MaxAttachmentBytes caps the attachments of one outgoing message, uploaded or forwarded
+const MaxAttachmentBytes = 32 << 20
+
+// ErrAttachmentsTooLarge is returned when a message's attachments exceed MaxAttachmentBytes
+var ErrAttachmentsTooLarge = errors.New("attachments exceed the size limit")
+
+// ForwardEmail sends message emailID to the given recipients as a new conversation: "Fwd:"
+// subject, the optional note, a header block of the original and its body, with the
+// original attachments downloaded and attached again.
+func (s *GmailService) ForwardEmail(ctx context.Context, user *models.User, emailID string, to, cc []models.EmailAddress, note string) error {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", emailID).Format("full").Context(ctx).Do)
+	if err != nil {
+		return messageError(err)
+	}
+	original := s.mapGmailMessageToEmail(msg)
+
+	// Check the sizes Gmail reports before downloading anything
+	var total int64
+	for _, att := range original.Attachments {
+		total += att.Size
+	}
+	if total > MaxAttachmentBytes {
+		return ErrAttachmentsTooLarge
+	}
+
+	attachments := make([]*models.Attachment, 0, len(original.Attachments))
+	for _, att := range original.Attachments {
+		data, err := s.GetAttachment(ctx, user, emailID, att.ID)
+		if err != nil {
+			return fmt.Errorf("failed to download attachment %s: %w", att.Filename, messageError(err))
+		}
+		attachments = append(attachments, &models.Attachment{
+			Filename: att.Filename,
+			MimeType: att.MimeType,
+			Size:     int64(len(data)),
+			Data:     data,
+		})
+	}
+
+	subject := original.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "fwd:") && !strings.HasPrefix(strings.ToLower(subject), "fw:") {
+		subject = "Fwd: " + subject
+	}
+	email := &models.Email{
+		To:          to,
+		Cc:          cc,
+		Subject:     subject,
+		Body:        forwardBody(&original, note),
+		Attachments: attachments,
+	}
+
+	raw := base64.URLEncoding.EncodeToString([]byte(buildRawMessage(email, nil)))
+	if _, err := srv.Users.Messages.Send("me", &gmail.Message{Raw: raw}).Context(ctx).Do(); err != nil {
+		return err
+	}
+
+	cache.Invalidate(user.ID.Hex())
+	return nil
+}
+
+// forwardBody renders the HTML body of a forward the way Gmail does: the note, then the
+// header block of the original, then its body
+func forwardBody(original *models.Email, note string) string {
+	var b strings.Builder
+	if note = strings.TrimSpace(note); note != "" {
+		b.WriteString("<div>" + strings.ReplaceAll(html.EscapeString(note), "\n", "<br>") + "</div><br>\n")
+	}
+
+	b.WriteString(`<div class="gmail_quote">---------- Forwarded message ---------<br>` + "\n")
+	fmt.Fprintf(&b, "From: %s<br>\n", html.EscapeString(formatAddresses([]models.EmailAddress{original.From})))
+	fmt.Fprintf(&b, "Date: %s<br>\n", original.ReceivedAt.Format("Mon, Jan 2, 2006 at 3:04 PM"))
+	fmt.Fprintf(&b, "Subject: %s<br>\n", html.EscapeString(original.Subject))
+	fmt.Fprintf(&b, "To: %s<br>\n", html.EscapeString(formatAddresses(original.To)))
+	if len(original.Cc) > 0 {
+		fmt.Fprintf(&b, "Cc: %s<br>\n", html.EscapeString(formatAddresses(original.Cc)))
+	}
+	b.WriteString("<br>\n")
+
+	body := original.Body
+	if !looksLikeHTML(body) {
+		// plain-text originals keep their line breaks
+		body = strings.ReplaceAll(html.EscapeString(body), "\n", "<br>")
+	}
+	b.WriteString(body)
+	b.WriteString("</div>")
+	return b.String()
+}
+
+func looksLikeHTML(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "<html") || strings.Contains(s, "<div") || strings.Contains(s, "<p") || strings.Contains(s, "<br") || strings.Contains(s, "<table")
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// labelFetchTimeout bounds a shared label fetch; it no longer follows the context of the
+// request that happened to start it
+const labelFetchTimeout = 15 * time.Second
+
+type labelCacheEntry struct {
+	labels    []*gmail.Label
+	expiresAt time.Time
+}
+
+// labelCache keeps each user's Gmail label list for a short TTL. Concurrent misses for the
+// same user share one Labels.List call.
+type labelCache struct {
+	ttl   time.Duration // 0 disables caching, calls are still shared
+	mu    sync.Mutex
+	items map[string]labelCacheEntry
+	// bumped by invalidate so a fetch that started before it isn't stored
+	generation map[string]uint64
+	group      singleflight.Group
+}
+
+func newLabelCache(ttl time.Duration) *labelCache {
+	return &labelCache{
+		ttl:        ttl,
+		items:      make(map[string]labelCacheEntry),
+		generation: make(map[string]uint64),
+	}
+}
+
+// get returns the cached labels of userID, or calls fetch once for all concurrent callers
+func (c *labelCache) get(ctx context.Context, userID string, fetch func(ctx context.Context) ([]*gmail.Label, error)) ([]*gmail.Label, error) {
+	c.mu.Lock()
+	if entry, ok := c.items[userID]; ok && time.Now().Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.labels, nil
+	}
+	c.mu.Unlock()
+
+	ch := c.group.DoChan(userID, func() (interface{}, error) {
+		c.mu.Lock()
+		gen := c.generation[userID]
+		c.mu.Unlock()
+
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), labelFetchTimeout)
+		defer cancel()
+		labels, err := fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.ttl > 0 && c.generation[userID] == gen {
+			c.items[userID] = labelCacheEntry{labels: labels, expiresAt: time.Now().Add(c.ttl)}
+		}
+		c.mu.Unlock()
+		return labels, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]*gmail.Label), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// invalidate drops userID's labels; a fetch already in flight is not cached
+func (c *labelCache) invalidate(userID string) {
+	c.mu.Lock()
+	delete(c.items, userID)
+	c.generation[userID]++
+	c.mu.Unlock()
+	c.group.Forget(userID)
+}
+
+// listLabels returns the user's Gmail labels, from the cache when fresh
+func (s *GmailService) listLabels(ctx context.Context, user *models.User) ([]*gmail.Label, error) {
+	return s.labels.get(ctx, user.ID.Hex(), func(ctx context.Context) ([]*gmail.Label, error) {
+		srv, err := s.GetClient(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := srv.Users.Labels.List("me").Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		return resp.Labels, nil
+	})
+}
+
+// InvalidateLabels drops the cached label list of a user; call it after creating, renaming
+// or deleting labels
+func (s *GmailService) InvalidateLabels(userID string) {
+	s.labels.invalidate(userID)
+}
+
+// ErrSystemLabel is returned when asked to delete one of Gmail's own labels
+var ErrSystemLabel = errors.New("system labels can't be deleted")
+
+// CreateLabel creates a user label called name. When the user already has a label by that
+// name (Gmail compares names case-insensitively) it is returned instead, with created false.
+func (s *GmailService) CreateLabel(ctx context.Context, user *models.User, name string) (label *models.GmailLabel, created bool, err error) {
+	name = strings.TrimSpace(name)
+	if existing, err := s.findLabel(ctx, user, name); err != nil || existing != nil {
+		return existing, false, err
+	}
+
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, false, err
+	}
+	l, err := srv.Users.Labels.Create("me", &gmail.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	}).Context(ctx).Do()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+			// created elsewhere since our (cached) listing
+			s.InvalidateLabels(user.ID.Hex())
+			if existing, ferr := s.findLabel(ctx, user, name); ferr == nil && existing != nil {
+				return existing, false, nil
+			}
+		}
+		return nil, false, err
+	}
+	s.InvalidateLabels(user.ID.Hex())
+	return &models.GmailLabel{ID: l.Id, Name: l.Name, Type: strings.ToLower(l.Type)}, true, nil
+}
+
+// DeleteLabel deletes a user label; Gmail removes it from all messages. A label that no
+// longer exists is not an error.
+func (s *GmailService) DeleteLabel(ctx context.Context, user *models.User, labelID string) error {
+	labels, err := s.listLabels(ctx, user)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if l.Id == labelID && l.Type == "system" {
+			return ErrSystemLabel
+		}
+	}
+
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := srv.Users.Labels.Delete("me", labelID).Context(ctx).Do(); err != nil {
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+			return err
+		}
+	}
+	s.InvalidateLabels(user.ID.Hex())
+	cache.Invalidate(user.ID.Hex())
+	return nil
+}
+
+// gmailBatchModifyMax is the most message IDs Gmail accepts per batchModify call
+const gmailBatchModifyMax = 1000
+
+// ModifyChunkResult is the outcome of one batchModify call of ModifyEmailsBatch
+type ModifyChunkResult struct {
+	EmailIDs []string
+	Err      error // nil when Gmail applied the labels to every message of the chunk
+}
+
+// BatchModifyEmails adds and removes the same labels on several messages with one
+// batchModify call per gmailBatchModifyMax messages, stopping at the first failed call
+func (s *GmailService) BatchModifyEmails(ctx context.Context, user *models.User, emailIDs []string, addLabels, removeLabels []string) error {
+	chunks, err := s.modifyEmailsBatch(ctx, user, emailIDs, addLabels, removeLabels, true)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if chunk.Err != nil {
+			return chunk.Err
+		}
+	}
+	return nil
+}
+
+// ModifyEmailsBatch is BatchModifyEmails that goes on after a failed call and reports the
+// outcome of every chunk. The error is only set when no call could be made.
+func (s *GmailService) ModifyEmailsBatch(ctx context.Context, user *models.User, emailIDs []string, addLabels, removeLabels []string) ([]ModifyChunkResult, error) {
+	return s.modifyEmailsBatch(ctx, user, emailIDs, addLabels, removeLabels, false)
+}
+
+func (s *GmailService) modifyEmailsBatch(ctx context.Context, user *models.User, emailIDs []string, addLabels, removeLabels []string, stopOnError bool) ([]ModifyChunkResult, error) {
+	if len(emailIDs) == 0 || (len(addLabels) == 0 && len(removeLabels) == 0) {
+		return nil, nil
+	}
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []ModifyChunkResult
+	modified := false
+	for start := 0; start < len(emailIDs); start += gmailBatchModifyMax {
+		end := min(start+gmailBatchModifyMax, len(emailIDs))
+		req := &gmail.BatchModifyMessagesRequest{
+			Ids:            emailIDs[start:end],
+			AddLabelIds:    addLabels,
+			RemoveLabelIds: removeLabels,
+		}
+		err := retryGmailDo(ctx, s.retry, srv.Users.Messages.BatchModify("me", req).Context(ctx).Do)
+		if err != nil {
+			err = messageError(err)
+		} else {
+			modified = true
+		}
+		chunks = append(chunks, ModifyChunkResult{EmailIDs: emailIDs[start:end], Err: err})
+		if err != nil && stopOnError {
+			break
+		}
+	}
+	if modified {
+		cache.Invalidate(user.ID.Hex())
+		// label counts (ListMailboxes) changed too
+		s.InvalidateLabels(user.ID.Hex())
+	}
+	return chunks, nil
+}
+
+// gmailListIDsPage is the most message IDs one messages.list call returns
+const gmailListIDsPage = 500
+
+// ListMessageIDs pages through the IDs of the messages labelled mailboxID, newest first, only
+// the unread ones when unreadOnly. At most limit IDs are returned; more is set when the label
+// holds further matches.
+func (s *GmailService) ListMessageIDs(ctx context.Context, user *models.User, mailboxID string, unreadOnly bool, limit int) (ids []string, more bool, err error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, false, err
+	}
+	token := ""
+	for len(ids) < limit {
+		req := srv.Users.Messages.List("me").LabelIds(mailboxID).
+			MaxResults(int64(min(gmailListIDsPage, limit-len(ids)))).
+			Fields("messages/id", "nextPageToken").Context(ctx)
+		if unreadOnly {
+			req = req.Q("is:unread")
+		}
+		if token != "" {
+			req = req.PageToken(token)
+		}
+		resp, err := retryGmail(ctx, s.retry, req.Do)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, m := range resp.Messages {
+			ids = append(ids, m.Id)
+		}
+		token = resp.NextPageToken
+		if token == "" {
+			return ids, false, nil
+		}
+	}
+	return ids, true, nil
+}
+
+// findLabel returns the user's label called name, or nil
+func (s *GmailService) findLabel(ctx context.Context, user *models.User, name string) (*models.GmailLabel, error) {
+	labels, err := s.listLabels(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if strings.EqualFold(l.Name, name) {
+			return &models.GmailLabel{ID: l.Id, Name: l.Name, Type: strings.ToLower(l.Type)}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// batchModifyRecorder is a fake batchModify endpoint that records every request and fails
+// the calls listed in fail (1-based)
+type batchModifyRecorder struct {
+	mu    sync.Mutex
+	calls []gmail.BatchModifyMessagesRequest
+	fail  []int
+}
+
+func (b *batchModifyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/gmail/v1/users/me/messages/batchModify" {
+		http.NotFound(w, r)
+		return
+	}
+	var req gmail.BatchModifyMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.mu.Lock()
+	b.calls = append(b.calls, req)
+	n := len(b.calls)
+	b.mu.Unlock()
+	if slices.Contains(b.fail, n) {
+		writeGmailError(w, http.StatusBadRequest, "invalidArgument")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *batchModifyRecorder) sizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sizes []int
+	for _, c := range b.calls {
+		sizes = append(sizes, len(c.Ids))
+	}
+	return sizes
+}
+
+func messageIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%04d", i)
+	}
+	return ids
+}
+
+func TestModifyEmailsBatchChunksPerThousand(t *testing.T) {
+	rec := &batchModifyRecorder{}
+	s, user := newFakeGmail(t, rec, 1, time.Millisecond)
+	ids := messageIDs(2500)
+
+	chunks, err := s.ModifyEmailsBatch(context.Background(), user, ids, nil, []string{"UNREAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.sizes(); !slices.Equal(got, []int{1000, 1000, 500}) {
+		t.Fatalf("batchModify sizes = %v, want [1000 1000 500]", got)
+	}
+
+	var sent []string
+	for i, c := range rec.calls {
+		if len(c.AddLabelIds) != 0 || !slices.Equal(c.RemoveLabelIds, []string{"UNREAD"}) {
+			t.Errorf("call %d labels = +%v -%v, want -[UNREAD]", i, c.AddLabelIds, c.RemoveLabelIds)
+		}
+		sent = append(sent, c.Ids...)
+	}
+	if !slices.Equal(sent, ids) {
+		t.Error("batchModify calls did not cover every ID once, in order")
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3", len(chunks))
+	}
+	for i, c := range chunks {
+		if c.Err != nil || !slices.Equal(c.EmailIDs, rec.calls[i].Ids) {
+			t.Errorf("chunk %d = %d IDs err %v, want the IDs of call %d and no error", i, len(c.EmailIDs), c.Err, i)
+		}
+	}
+}
+
+func TestModifyEmailsBatchSmallBatch(t *testing.T) {
+	for _, n := range []int{1, 1000} {
+		rec := &batchModifyRecorder{}
+		s, user := newFakeGmail(t, rec, 1, time.Millisecond)
+		if _, err := s.ModifyEmailsBatch(context.Background(), user, messageIDs(n), []string{"STARRED"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.sizes(); !slices.Equal(got, []int{n}) {
+			t.Errorf("%d IDs: batchModify sizes = %v, want [%d]", n, got, n)
+		}
+	}
+}
+
+func TestModifyEmailsBatchNothingToDo(t *testing.T) {
+	rec := &batchModifyRecorder{}
+	s, user := newFakeGmail(t, rec, 1, time.Millisecond)
+	if _, err := s.ModifyEmailsBatch(context.Background(), user, nil, nil, []string{"UNREAD"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ModifyEmailsBatch(context.Background(), user, messageIDs(3), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.sizes(); len(got) != 0 {
+		t.Errorf("batchModify sizes = %v, want no calls", got)
+	}
+}
+
+func TestModifyEmailsBatchFailedChunk(t *testing.T) {
+	rec := &batchModifyRecorder{fail: []int{2}}
+	s, user := newFakeGmail(t, rec, 1, time.Millisecond)
+
+	chunks, err := s.ModifyEmailsBatch(context.Background(), user, messageIDs(2500), nil, []string{"UNREAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || chunks[0].Err != nil || chunks[1].Err == nil || chunks[2].Err != nil {
+		t.Fatalf("chunks = %+v, want only the second to fail", chunks)
+	}
+
+	// BatchModifyEmails stops at the failed call
+	rec = &batchModifyRecorder{fail: []int{2}}
+	s, user = newFakeGmail(t, rec, 1, time.Millisecond)
+	if err := s.BatchModifyEmails(context.Background(), user, messageIDs(2500), nil, []string{"UNREAD"}); err == nil {
+		t.Fatal("BatchModifyEmails succeeded, want the second call's error")
+	}
+	if got := rec.sizes(); !slices.Equal(got, []int{1000, 1000}) {
+		t.Errorf("batchModify sizes = %v, want [1000 1000]", got)
+	}
+}
+
+// labelsServer is a fake labels.list endpoint counting its calls
+func labelsServer(calls *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gmail/v1/users/me/labels" {
+			http.NotFound(w, r)
+			return
+		}
+		calls.Add(1)
+		writeJSON(w, &gmail.ListLabelsResponse{Labels: []*gmail.Label{
+			{Id: "INBOX", Name: "INBOX", Type: "system"},
+			{Id: "Label_1", Name: "Receipts", Type: "user"},
+		}})
+	})
+}
+
+func TestLabelCacheTTL(t *testing.T) {
+	var calls atomic.Int32
+	ttl := 100 * time.Millisecond
+	s, user := newFakeGmailConfig(t, labelsServer(&calls), &config.Config{GmailRetryAttempts: 1, GmailLabelCacheTTL: ttl})
+	ctx := context.Background()
+
+	get := func(wantCalls int32) {
+		t.Helper()
+		labels, err := s.GetLabels(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(labels) != 2 || labels[1].Name != "Receipts" || labels[1].Type != "user" {
+			t.Fatalf("labels = %+v", labels)
+		}
+		if n := calls.Load(); n != wantCalls {
+			t.Fatalf("labels.list calls = %d, want %d", n, wantCalls)
+		}
+	}
+
+	get(1)
+	get(1) // within the TTL: served from the cache
+	time.Sleep(ttl + 50*time.Millisecond)
+	get(2) // expired
+	get(2)
+	s.InvalidateLabels(user.ID.Hex())
+	get(3)
+}
+
+func TestLabelCacheDisabled(t *testing.T) {
+	var calls atomic.Int32
+	s, user := newFakeGmailConfig(t, labelsServer(&calls), &config.Config{GmailRetryAttempts: 1})
+	for i := 1; i <= 3; i++ {
+		if _, err := s.GetLabels(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+		if n := calls.Load(); n != int32(i) {
+			t.Fatalf("labels.list calls = %d after %d GetLabels, want one each", n, i)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// gmailRetryBaseDelay is the first backoff; it doubles on each retry
+const gmailRetryBaseDelay = 500 * time.Millisecond
+
+// ErrGmailRateLimited is returned when Gmail still rate-limits a call after every retry
+var ErrGmailRateLimited = errors.New("gmail rate limit exceeded")
+
+// gmailRetryPolicy is how rate-limited Gmail calls are retried
+type gmailRetryPolicy struct {
+	attempts int           // total tries, the first included; 1 disables retries
+	maxDelay time.Duration // cap of one backoff; a longer Retry-After gives up instead
+}
+
+// retryGmail runs do until it succeeds, fails with an error that isn't a rate limit, or the
+// attempts run out. It waits for Gmail's Retry-After when given, otherwise backs off
+// exponentially with jitter. Exhausted retries return an error wrapping ErrGmailRateLimited
+// and the last Gmail error.
+func retryGmail[T any](ctx context.Context, p gmailRetryPolicy, do func(...googleapi.CallOption) (T, error)) (T, error) {
+	backoff := gmailRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		res, err := do()
+		if err == nil || !isGmailRateLimit(err) {
+			return res, err
+		}
+		delay := min(backoff, p.maxDelay)
+		// Full jitter over the upper half keeps concurrent fetches from retrying in lockstep
+		delay = delay/2 + rand.N(delay/2+1)
+		if after, ok := gmailRetryAfter(err); ok {
+			if after > p.maxDelay {
+				return res, fmt.Errorf("%w: %w", ErrGmailRateLimited, err)
+			}
+			delay = max(delay, after)
+		}
+		if attempt >= p.attempts {
+			return res, fmt.Errorf("%w: %w", ErrGmailRateLimited, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, fmt.Errorf("%w: %w", ErrGmailRateLimited, err)
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryGmailDo is retryGmail for calls that only return an error, such as BatchModify
+func retryGmailDo(ctx context.Context, p gmailRetryPolicy, do func(...googleapi.CallOption) error) error {
+	_, err := retryGmail(ctx, p, func(opts ...googleapi.CallOption) (struct{}, error) {
+		return struct{}{}, do(opts...)
+	})
+	return err
+}
+
+// isGmailRateLimit reports whether err is Gmail's 429 or one of its 403 rate-limit reasons
+func isGmailRateLimit(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// gmailRetryAfter parses the Retry-After header (seconds or an HTTP date) of a Gmail error
+func gmailRetryAfter(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0, false
+	}
+	raw := apiErr.Header.Get("Retry-After")
+	if raw == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(raw); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
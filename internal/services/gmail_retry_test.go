@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestGetEmailRetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	s, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/users/me/messages/m1") {
+			http.NotFound(w, r)
+			return
+		}
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeGmailError(w, http.StatusTooManyRequests, "rateLimitExceeded")
+			return
+		}
+		writeJSON(w, fakeMessage("m1", "INBOX"))
+	}), 3, 2*time.Second)
+
+	start := time.Now()
+	email, err := s.GetEmail(context.Background(), user, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.ID != "m1" {
+		t.Errorf("email ID = %q, want m1", email.ID)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Gmail called %d times, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before Retry-After", elapsed)
+	}
+}
+
+func TestModifyEmailRetries403RateLimit(t *testing.T) {
+	var calls atomic.Int32
+	s, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			writeGmailError(w, http.StatusForbidden, "userRateLimitExceeded")
+			return
+		}
+		writeJSON(w, fakeMessage("m1"))
+	}), 3, 10*time.Millisecond)
+
+	if err := s.ModifyEmail(context.Background(), user, "m1", nil, []string{"UNREAD"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Gmail called %d times, want 2", n)
+	}
+}
+
+func TestListMessageIDsRetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	s, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			writeGmailError(w, http.StatusTooManyRequests, "rateLimitExceeded")
+			return
+		}
+		writeJSON(w, gmail.ListMessagesResponse{Messages: []*gmail.Message{{Id: "m1"}, {Id: "m2"}}})
+	}), 3, 10*time.Millisecond)
+
+	ids, more, err := s.ListMessageIDs(context.Background(), user, "INBOX", false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || more {
+		t.Errorf("ListMessageIDs = %v, more %v", ids, more)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Gmail called %d times, want 2", n)
+	}
+}
+
+func TestGmailRetriesExhausted(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantCalls  int32
+	}{
+		{"backoff", "", 3},
+		// Waiting longer than maxDelay gives up at once
+		{"retry-after beyond max delay", "3600", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			s, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				writeGmailError(w, http.StatusTooManyRequests, "rateLimitExceeded")
+			}), 3, 10*time.Millisecond)
+
+			_, err := s.GetEmail(context.Background(), user, "m1")
+			if !errors.Is(err, ErrGmailRateLimited) {
+				t.Fatalf("err = %v, want ErrGmailRateLimited", err)
+			}
+			var apiErr *googleapi.Error
+			if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+				t.Errorf("err = %v does not wrap Gmail's 429", err)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("Gmail called %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGmailErrorsNotRetried(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusBadRequest} {
+		var calls atomic.Int32
+		s, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			writeGmailError(w, code, "failed")
+		}), 3, 10*time.Millisecond)
+
+		_, err := s.GetEmail(context.Background(), user, "m1")
+		if err == nil || errors.Is(err, ErrGmailRateLimited) {
+			t.Errorf("%d: err = %v, want the Gmail error", code, err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%d: Gmail called %d times, want 1", code, n)
+		}
+	}
+}
+
+func TestGmailRetryAfter(t *testing.T) {
+	withHeader := func(v string) error {
+		h := http.Header{}
+		if v != "" {
+			h.Set("Retry-After", v)
+		}
+		return &googleapi.Error{Code: http.StatusTooManyRequests, Header: h}
+	}
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{"seconds", withHeader("7"), 7 * time.Second, true},
+		{"past date", withHeader(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), 0, true},
+		{"invalid", withHeader("soon"), 0, false},
+		{"negative", withHeader("-1"), 0, false},
+		{"missing", withHeader(""), 0, false},
+		{"not a Gmail error", errors.New("boom"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := gmailRetryAfter(tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("gmailRetryAfter = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	future := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if got, ok := gmailRetryAfter(withHeader(future)); !ok || got <= 25*time.Second || got > 30*time.Second {
+		t.Errorf("gmailRetryAfter(date in 30s) = %v, %v", got, ok)
+	}
+}
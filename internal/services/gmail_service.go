@@ -8,20 +8,19 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/mail"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 	"unicode/utf8"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -29,8 +28,7 @@ import (
 // Simple in-memory cache to avoid repeated API calls
 
 type cacheEntry struct {
-	emails    []*models.Email
-	total     int
+	page      *EmailPage
 	expiresAt time.Time
 }
 
@@ -45,30 +43,29 @@ var cache = &emailCache{
 
 const cacheTTL = 2 * time.Minute // Cache expires after 2 minutes
 
-func (c *emailCache) Get(key string) ([]*models.Email, int, bool) {
+func (c *emailCache) Get(key string) (*EmailPage, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	entry, ok := c.items[key]
 	if !ok {
-		return nil, 0, false
+		return nil, false
 	}
 
 	// Check if cache has expired
 	if time.Now().After(entry.expiresAt) {
-		return nil, 0, false
+		return nil, false
 	}
 
-	return entry.emails, entry.total, true
+	return entry.page, true
 }
 
-func (c *emailCache) Set(key string, emails []*models.Email, total int) {
+func (c *emailCache) Set(key string, page *EmailPage) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.items[key] = cacheEntry{
-		emails:    emails,
-		total:     total,
+		page:      page,
 		expiresAt: time.Now().Add(cacheTTL),
 	}
 }
@@ -85,15 +82,103 @@ func (c *emailCache) Invalidate(userID string) {
 	}
 }
 
+// ========== PAGE TOKENS ==========
+// Gmail pages with opaque tokens while the frontend asks for page numbers. Tokens seen for a
+// listing are remembered so page N can be requested directly; unknown pages are reached by
+// walking forward with ID-only list calls.
+
+// pageTokenTTL bounds how long a remembered token is reused
+const pageTokenTTL = 10 * time.Minute
+
+// maxPageWalk caps the list calls spent reaching an unknown page
+const maxPageWalk = 20
+
+// ErrMessageNotFound is returned when Gmail has no message with the given ID
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrInsufficientScope is returned when the user's Google grant doesn't allow an operation
+var ErrInsufficientScope = errors.New("insufficient Gmail permission")
+
+// errPageOutOfRange means the requested page is past the last one
+var errPageOutOfRange = errors.New("page out of range")
+
+// ErrPageTooFar is returned for a page more than maxPageWalk pages beyond any known token
+var ErrPageTooFar = errors.New("page is too far ahead; page through the mailbox in order")
+
+type pageTokenEntry struct {
+	tokens    map[int]string // page number (>= 2) -> token
+	expiresAt time.Time
+}
+
+type pageTokenCache struct {
+	mu    sync.Mutex
+	items map[string]*pageTokenEntry
+}
+
+var pageTokens = &pageTokenCache{items: make(map[string]*pageTokenEntry)}
+
+// closest returns the highest known page <= page and its token (page 1 has no token)
+func (c *pageTokenCache) closest(key string, page int) (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.items[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return 1, ""
+	}
+	best, token := 1, ""
+	for p, t := range entry.tokens {
+		if p <= page && p > best {
+			best, token = p, t
+		}
+	}
+	return best, token
+}
+
+func (c *pageTokenCache) set(key string, page int, token string) {
+	if token == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.items[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		entry = &pageTokenEntry{tokens: map[int]string{}}
+		c.items[key] = entry
+	}
+	entry.tokens[page] = token
+	entry.expiresAt = time.Now().Add(pageTokenTTL)
+}
+
+// EmailPage is one page of a mailbox listing
+type EmailPage struct {
+	Emails []*models.Email
+	// Total is the mailbox's message count from its label (exact) when the listing is
+	// unfiltered or unread-only. With other filters Gmail only offers ResultSizeEstimate,
+	// which can be off by orders of magnitude; TotalExact is false then and clients must not
+	// present Total as a count.
+	Total       int
+	TotalExact  bool
+	HasNextPage bool
+}
+
 // ========== GMAIL SERVICE ==========
 
 type GmailService struct {
-	cfg *config.Config
+	cfg    *config.Config
+	labels *labelCache
+	retry  gmailRetryPolicy
+	// clientOptions replace the user's OAuth token source when set (tests point the client at
+	// a fake server)
+	clientOptions []option.ClientOption
 }
 
 func NewGmailService(cfg *config.Config) *GmailService {
 	return &GmailService{
-		cfg: cfg,
+		cfg:    cfg,
+		labels: newLabelCache(cfg.GmailLabelCacheTTL),
+		retry:  gmailRetryPolicy{attempts: cfg.GmailRetryAttempts, maxDelay: cfg.GmailRetryMaxDelay},
 	}
 }
 
@@ -118,6 +203,10 @@ func (s *GmailService) GetClient(ctx context.Context, user *models.User) (*gmail
 		return nil, errors.New("no google refresh token found")
 	}
 
+	if s.clientOptions != nil {
+		return gmail.NewService(ctx, s.clientOptions...)
+	}
+
 	config := s.getOAuthConfig()
 	token := &oauth2.Token{
 		AccessToken:  user.GoogleAccessToken,
@@ -138,18 +227,13 @@ func (s *GmailService) GetClient(ctx context.Context, user *models.User) (*gmail
 }
 
 func (s *GmailService) ListMailboxes(ctx context.Context, user *models.User) ([]models.Mailbox, error) {
-	srv, err := s.GetClient(ctx, user)
-	if err != nil {
-		return nil, err
-	}
-
-	labels, err := srv.Users.Labels.List("me").Do()
+	labels, err := s.listLabels(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
 	var mailboxes []models.Mailbox
-	for _, label := range labels.Labels {
+	for _, label := range labels {
 		// Filter out some system labels if needed, or map them to icons
 		icon := "FolderOutlined"
 		if label.Type == "system" {
@@ -182,28 +266,37 @@ func (s *GmailService) ListMailboxes(ctx context.Context, user *models.User) ([]
 	return mailboxes, nil
 }
 
-func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailboxID string, page int, perPage int, unreadOnly bool, hasAttachmentsOnly bool, sortBy string, sortOrder string) ([]*models.Email, int, error) {
+// GetMailboxCount returns the exact number of messages (or unread messages) in a mailbox,
+// from the label's MessagesTotal/MessagesUnread as also shown by ListMailboxes
+func (s *GmailService) GetMailboxCount(ctx context.Context, user *models.User, mailboxID string, unreadOnly bool) (int, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	label, err := srv.Users.Labels.Get("me", mailboxID).Context(ctx).Do()
+	if err != nil {
+		return 0, err
+	}
+	if unreadOnly {
+		return int(label.MessagesUnread), nil
+	}
+	return int(label.MessagesTotal), nil
+}
+
+func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailboxID string, page int, perPage int, unreadOnly bool, hasAttachmentsOnly bool, sortBy string, sortOrder string) (*EmailPage, error) {
 	// Generate cache key based on user and query parameters
 	cacheKey := fmt.Sprintf("%s:%s:%d:%d:%t:%t:%s:%s", user.ID.Hex(), mailboxID, page, perPage, unreadOnly, hasAttachmentsOnly, sortBy, sortOrder)
 
 	// Check cache first
-	if cachedEmails, cachedTotal, found := cache.Get(cacheKey); found {
-		return cachedEmails, cachedTotal, nil
+	if cached, found := cache.Get(cacheKey); found {
+		return cached, nil
 	}
 
 	srv, err := s.GetClient(ctx, user)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// Calculate max results (limit)
-	// Gmail API uses page tokens, so "page" number is tricky.
-	// For simplicity in this implementation, we might just fetch the first page or use tokens if we stored them.
-	// A robust implementation would map page numbers to tokens.
-	// Here we will just fetch the latest N messages.
-
-	req := srv.Users.Messages.List("me").LabelIds(mailboxID).MaxResults(int64(perPage))
-
 	// Apply filtering via Gmail query syntax
 	var queryParts []string
 	if unreadOnly {
@@ -212,32 +305,43 @@ func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailbo
 	if hasAttachmentsOnly {
 		queryParts = append(queryParts, "has:attachment")
 	}
+	query := strings.Join(queryParts, " ")
 
-	if len(queryParts) > 0 {
-		// Join query parts with space
-		query := ""
-		for i, part := range queryParts {
-			if i > 0 {
-				query += " "
-			}
-			query += part
+	listCall := func() *gmail.UsersMessagesListCall {
+		req := srv.Users.Messages.List("me").LabelIds(mailboxID).MaxResults(int64(perPage)).Context(ctx)
+		if query != "" {
+			req = req.Q(query)
 		}
-		req = req.Q(query)
+		return req
 	}
 
-	// If page > 1, we would need to use PageToken.
-	// For this exercise, let's assume simple pagination or just first page for now,
-	// or implement a basic token mechanism if the frontend supports it.
-	// Since the frontend sends page numbers, we can't easily map to tokens without state.
-	// We will just return the first page for now.
+	// Sorting is applied per page, so tokens only depend on the listing itself
+	tokenKey := fmt.Sprintf("%s:%s:%d:%t:%t", user.ID.Hex(), mailboxID, perPage, unreadOnly, hasAttachmentsOnly)
+	result := &EmailPage{Emails: []*models.Email{}}
 
-	resp, err := req.Do()
+	token, err := s.resolvePageToken(ctx, listCall, tokenKey, page)
+	if errors.Is(err, errPageOutOfRange) {
+		result.Total, result.TotalExact = s.listingTotal(ctx, user, mailboxID, unreadOnly, hasAttachmentsOnly, 0)
+		return result, nil
+	}
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
+	req := listCall()
+	if token != "" {
+		req = req.PageToken(token)
+	}
+	resp, err := retryGmail(ctx, s.retry, req.Do)
+	if err != nil {
+		return nil, err
+	}
+	pageTokens.set(tokenKey, page+1, resp.NextPageToken)
+	result.HasNextPage = resp.NextPageToken != ""
+	result.Total, result.TotalExact = s.listingTotal(ctx, user, mailboxID, unreadOnly, hasAttachmentsOnly, int(resp.ResultSizeEstimate))
+
 	if len(resp.Messages) == 0 {
-		return []*models.Email{}, 0, nil
+		return result, nil
 	}
 
 	// ========== PERFORMANCE OPTIMIZATION ==========
@@ -246,13 +350,13 @@ func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailbo
 	const maxConcurrency = 10
 	sem := make(chan struct{}, maxConcurrency)
 
-	type result struct {
+	type fetchResult struct {
 		index int
 		email *models.Email
 		err   error
 	}
 
-	resultsChan := make(chan result, len(resp.Messages))
+	resultsChan := make(chan fetchResult, len(resp.Messages))
 	emails := make([]*models.Email, len(resp.Messages))
 
 	for i, msgHeader := range resp.Messages {
@@ -262,17 +366,17 @@ func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailbo
 
 			// Use "metadata" format for list view (faster, less data)
 			// Only headers needed for list display: Subject, From, To, Date
-			msg, err := srv.Users.Messages.Get("me", id).
+			msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", id).
 				Format("metadata").
-				MetadataHeaders("Subject", "From", "To", "Date").
-				Do()
+				MetadataHeaders("Subject", "From", "To", "Reply-To", "Date", "List-Unsubscribe").
+				Context(ctx).Do)
 			if err != nil {
-				resultsChan <- result{index: idx, err: err}
+				resultsChan <- fetchResult{index: idx, err: err}
 				return
 			}
 
 			email := s.mapGmailMessageToEmailMetadata(msg)
-			resultsChan <- result{index: idx, email: &email}
+			resultsChan <- fetchResult{index: idx, email: &email}
 		}(i, msgHeader.Id)
 	}
 
@@ -318,10 +422,111 @@ func (s *GmailService) ListEmails(ctx context.Context, user *models.User, mailbo
 		}
 	}
 
+	result.Emails = validEmails
+
 	// Store in cache before returning
-	cache.Set(cacheKey, validEmails, int(resp.ResultSizeEstimate))
+	cache.Set(cacheKey, result)
+
+	return result, nil
+}
+
+// resolvePageToken returns the token for page (empty for page 1), walking forward from the
+// closest remembered page. Returns errPageOutOfRange past the last page.
+func (s *GmailService) resolvePageToken(ctx context.Context, listCall func() *gmail.UsersMessagesListCall, key string, page int) (string, error) {
+	if page <= 1 {
+		return "", nil
+	}
+	current, token := pageTokens.closest(key, page)
+	if page-current > maxPageWalk {
+		return "", ErrPageTooFar
+	}
+	for current < page {
+		req := listCall().Fields("nextPageToken")
+		if token != "" {
+			req = req.PageToken(token)
+		}
+		resp, err := retryGmail(ctx, s.retry, req.Do)
+		if err != nil {
+			return "", err
+		}
+		if resp.NextPageToken == "" {
+			return "", errPageOutOfRange
+		}
+		current++
+		token = resp.NextPageToken
+		pageTokens.set(key, current, token)
+	}
+	return token, nil
+}
+
+// listingTotal returns the exact mailbox count when the filters allow it, otherwise Gmail's
+// estimate (never an exact count; see EmailPage)
+func (s *GmailService) listingTotal(ctx context.Context, user *models.User, mailboxID string, unreadOnly, hasAttachmentsOnly bool, estimate int) (int, bool) {
+	if hasAttachmentsOnly || mailboxID == "" {
+		return estimate, false
+	}
+	count, err := s.GetMailboxCount(ctx, user, mailboxID, unreadOnly)
+	if err != nil {
+		return estimate, false
+	}
+	return count, true
+}
 
-	return validEmails, int(resp.ResultSizeEstimate), nil
+// GetThread returns every message of a Gmail conversation in full format, oldest first
+func (s *GmailService) GetThread(ctx context.Context, user *models.User, threadID string) ([]*models.Email, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	thread, err := srv.Users.Threads.Get("me", threadID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]*models.Email, 0, len(thread.Messages))
+	for _, msg := range thread.Messages {
+		email := s.mapGmailMessageToEmail(msg)
+		email.ThreadMessageCount, email.ThreadUnread = threadState(thread.Messages, msg.Id)
+		emails = append(emails, &email)
+	}
+	return emails, nil
+}
+
+// GetThreadState returns how many messages a Gmail conversation has and whether any of them
+// newer than messageID is unread. Only the minimal message format is fetched.
+func (s *GmailService) GetThreadState(ctx context.Context, user *models.User, threadID, messageID string) (count int, unread bool, err error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return 0, false, err
+	}
+
+	thread, err := retryGmail(ctx, s.retry, srv.Users.Threads.Get("me", threadID).Format("minimal").Context(ctx).Do)
+	if err != nil {
+		return 0, false, err
+	}
+	count, unread = threadState(thread.Messages, messageID)
+	return count, unread, nil
+}
+
+// threadState counts a thread's messages and reports whether one received after messageID is
+// unread; when messageID isn't in the thread, any unread message counts
+func threadState(messages []*gmail.Message, messageID string) (count int, unread bool) {
+	var after int64
+	for _, msg := range messages {
+		if msg.Id == messageID {
+			after = msg.InternalDate
+		}
+	}
+	for _, msg := range messages {
+		if msg.Id == messageID || msg.InternalDate < after {
+			continue
+		}
+		if slices.Contains(msg.LabelIds, "UNREAD") {
+			unread = true
+		}
+	}
+	return len(messages), unread
 }
 
 func (s *GmailService) GetEmail(ctx context.Context, user *models.User, emailID string) (*models.Email, error) {
@@ -330,7 +535,7 @@ func (s *GmailService) GetEmail(ctx context.Context, user *models.User, emailID
 		return nil, err
 	}
 
-	msg, err := srv.Users.Messages.Get("me", emailID).Format("full").Do()
+	msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", emailID).Format("full").Context(ctx).Do)
 	if err != nil {
 		return nil, err
 	}
@@ -339,8 +544,22 @@ func (s *GmailService) GetEmail(ctx context.Context, user *models.User, emailID
 	return &email, nil
 }
 
+// GmailWebURL returns the Gmail web link for a message. Gmail opens a conversation by its
+// thread ID under #all/ whatever its labels; the message ID is the fallback. base is the
+// mailbox root, e.g. "https://mail.google.com/mail/u/0/".
+func GmailWebURL(base, threadID, messageID string) string {
+	id := threadID
+	if id == "" {
+		id = messageID
+	}
+	if id == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/#all/" + id
+}
+
 func (s *GmailService) mapGmailMessageToEmail(msg *gmail.Message) models.Email {
-	var subject, from, to string
+	var subject, from, to, replyTo, cc, bcc, listUnsubscribe string
 	// Initialize date with InternalDate (epoch ms) as a reliable fallback
 	var date time.Time
 	if msg.InternalDate > 0 {
@@ -357,6 +576,15 @@ func (s *GmailService) mapGmailMessageToEmail(msg *gmail.Message) models.Email {
 			from = header.Value
 		case "To":
 			to = header.Value
+		case "Reply-To":
+			replyTo = header.Value
+		case "List-Unsubscribe":
+			listUnsubscribe = header.Value
+		case "Cc":
+			cc = header.Value
+		case "Bcc":
+			// only present on sent mail and drafts
+			bcc = header.Value
 		case "Date":
 			// Parse date using net/mail
 			d, err := mail.ParseDate(header.Value)
@@ -378,21 +606,40 @@ func (s *GmailService) mapGmailMessageToEmail(msg *gmail.Message) models.Email {
 	attachments := s.getAttachments(msg.Payload)
 	hasAttachments := len(attachments) > 0
 
+	// Attachment-only emails (e.g. a forwarded PDF) have no text part; describe the
+	// attachments instead so cards aren't blank and search can match filenames
+	snippet := msg.Snippet
+	if strings.TrimSpace(body) == "" && hasAttachments && s.cfg.AttachmentOnlyPlaceholder {
+		body = attachmentPlaceholder(attachments)
+		if strings.TrimSpace(snippet) == "" {
+			snippet = body
+		}
+	}
+
 	return models.Email{
 		ID:             msg.Id,
 		ThreadID:       msg.ThreadId,
+		GmailURL:       GmailWebURL(s.cfg.GmailWebURL, msg.ThreadId, msg.Id),
 		Subject:        utils.ToValidUTF8(subject),
-		Preview:        utils.ToValidUTF8(msg.Snippet),
+		Preview:        utils.ToValidUTF8(snippet),
 		From:           parseAddress(utils.ToValidUTF8(from)),
 		To:             parseAddresses(utils.ToValidUTF8(to)),
+		Cc:             parseAddresses(utils.ToValidUTF8(cc)),
+		Bcc:            parseAddresses(utils.ToValidUTF8(bcc)),
+		ReplyTo:        parseAddresses(utils.ToValidUTF8(replyTo)),
 		Body:           utils.ToValidUTF8(body),
 		ReceivedAt:     date,
 		IsRead:         isRead,
 		IsStarred:      isStarred,
 		HasAttachments: hasAttachments,
 		Attachments:    attachments,
+		InlineImages:   inlineImages(msg.Payload),
 		MailboxID:      "INBOX", // Default, or derive from labels
 		Labels:         msg.LabelIds,
+		IsDraft:        contains(msg.LabelIds, "DRAFT"),
+
+		// only read by categorization, not stored
+		ListUnsubscribe: listUnsubscribe,
 	}
 }
 
@@ -400,7 +647,7 @@ func (s *GmailService) mapGmailMessageToEmail(msg *gmail.Message) models.Email {
 // Used for list views where we don't need full body/attachments
 // This significantly reduces API response size and processing time
 func (s *GmailService) mapGmailMessageToEmailMetadata(msg *gmail.Message) models.Email {
-	var subject, from, to string
+	var subject, from, to, replyTo, listUnsubscribe string
 	// Initialize date with InternalDate (epoch ms) as a reliable fallback
 	var date time.Time
 	if msg.InternalDate > 0 {
@@ -419,6 +666,10 @@ func (s *GmailService) mapGmailMessageToEmailMetadata(msg *gmail.Message) models
 				from = header.Value
 			case "To":
 				to = header.Value
+			case "Reply-To":
+				replyTo = header.Value
+			case "List-Unsubscribe":
+				listUnsubscribe = header.Value
 			case "Date":
 				// Parse date using net/mail
 				d, err := mail.ParseDate(header.Value)
@@ -447,10 +698,12 @@ func (s *GmailService) mapGmailMessageToEmailMetadata(msg *gmail.Message) models
 	return models.Email{
 		ID:             msg.Id,
 		ThreadID:       msg.ThreadId,
+		GmailURL:       GmailWebURL(s.cfg.GmailWebURL, msg.ThreadId, msg.Id),
 		Subject:        utils.ToValidUTF8(subject),
 		Preview:        utils.ToValidUTF8(msg.Snippet), // Snippet is available in metadata format
 		From:           parseAddress(utils.ToValidUTF8(from)),
 		To:             parseAddresses(utils.ToValidUTF8(to)),
+		ReplyTo:        parseAddresses(utils.ToValidUTF8(replyTo)),
 		Body:           "", // Body not included in metadata format - will be fetched on detail view
 		ReceivedAt:     date,
 		IsRead:         isRead,
@@ -459,6 +712,10 @@ func (s *GmailService) mapGmailMessageToEmailMetadata(msg *gmail.Message) models
 		Attachments:    nil, // Attachments not included in metadata format
 		MailboxID:      "INBOX",
 		Labels:         msg.LabelIds,
+		IsDraft:        contains(msg.LabelIds, "DRAFT"),
+
+		// only read by categorization, not stored
+		ListUnsubscribe: listUnsubscribe,
 	}
 }
 
@@ -486,6 +743,18 @@ func (s *GmailService) getAttachments(part *gmail.MessagePart) []*models.Attachm
 	return attachments
 }
 
+// attachmentPlaceholder builds a body like "[Attachment: report.pdf] [Attachment: photo.jpg]"
+func attachmentPlaceholder(attachments []*models.Attachment) string {
+	parts := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		if a == nil || a.Filename == "" {
+			continue
+		}
+		parts = append(parts, "[Attachment: "+a.Filename+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
 func (s *GmailService) getBody(part *gmail.MessagePart) string {
 	// Helper to process plain text
 	processPlainText := func(data string) string {
@@ -590,56 +859,54 @@ func (s *GmailService) SendEmail(ctx context.Context, user *models.User, email *
 
 	var message gmail.Message
 
-	// Build recipient headers
-	toAddresses := make([]string, len(email.To))
-	for i, to := range email.To {
-		if to.Name != "" {
-			toAddresses[i] = to.Name + " <" + to.Email + ">"
-		} else {
-			toAddresses[i] = to.Email
-		}
+	// Add In-Reply-To and References headers for reply/forward
+	if email.ThreadID != "" {
+		message.ThreadId = email.ThreadID
 	}
 
-	var ccAddresses []string
-	if len(email.Cc) > 0 {
-		ccAddresses = make([]string, len(email.Cc))
-		for i, cc := range email.Cc {
-			if cc.Name != "" {
-				ccAddresses[i] = cc.Name + " <" + cc.Email + ">"
-			} else {
-				ccAddresses[i] = cc.Email
-			}
-		}
-	}
+	message.Raw = base64.URLEncoding.EncodeToString([]byte(buildRawMessage(email, nil)))
 
-	var bccAddresses []string
-	if len(email.Bcc) > 0 {
-		bccAddresses = make([]string, len(email.Bcc))
-		for i, bcc := range email.Bcc {
-			if bcc.Name != "" {
-				bccAddresses[i] = bcc.Name + " <" + bcc.Email + ">"
-			} else {
-				bccAddresses[i] = bcc.Email
-			}
-		}
+	_, err = srv.Users.Messages.Send("me", &message).Do()
+	if err != nil {
+		return err
 	}
 
-	// Add In-Reply-To and References headers for reply/forward
-	if email.ThreadID != "" {
-		message.ThreadId = email.ThreadID
+	// Invalidate cache for this user after successful send
+	cache.Invalidate(user.ID.Hex())
+	return nil
+}
+
+// formatAddresses renders addresses as a header value
+func formatAddresses(addrs []models.EmailAddress) string {
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		if a.Name != "" {
+			out[i] = a.Name + " <" + a.Email + ">"
+		} else {
+			out[i] = a.Email
+		}
 	}
+	return strings.Join(out, ", ")
+}
 
+// buildRawMessage renders email as an RFC 2822 message with an HTML body and its
+// attachments. reply, when set, adds the threading headers of a reply.
+func buildRawMessage(email *models.Email, reply *replyHeaders) string {
 	var msgString strings.Builder
 
 	// Write common headers
-	msgString.WriteString("To: " + strings.Join(toAddresses, ", ") + "\r\n")
-	if len(ccAddresses) > 0 {
-		msgString.WriteString("Cc: " + strings.Join(ccAddresses, ", ") + "\r\n")
+	msgString.WriteString("To: " + formatAddresses(email.To) + "\r\n")
+	if len(email.Cc) > 0 {
+		msgString.WriteString("Cc: " + formatAddresses(email.Cc) + "\r\n")
 	}
-	if len(bccAddresses) > 0 {
-		msgString.WriteString("Bcc: " + strings.Join(bccAddresses, ", ") + "\r\n")
+	if len(email.Bcc) > 0 {
+		msgString.WriteString("Bcc: " + formatAddresses(email.Bcc) + "\r\n")
 	}
 	msgString.WriteString("Subject: " + email.Subject + "\r\n")
+	if reply != nil && reply.InReplyTo != "" {
+		msgString.WriteString("In-Reply-To: " + reply.InReplyTo + "\r\n")
+		msgString.WriteString("References: " + reply.References + "\r\n")
+	}
 	msgString.WriteString("MIME-Version: 1.0\r\n")
 
 	// Check if we have attachments
@@ -685,40 +952,91 @@ func (s *GmailService) SendEmail(ctx context.Context, user *models.User, email *
 		msgString.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
 		msgString.WriteString(base64.StdEncoding.EncodeToString([]byte(email.Body)))
 	}
+	return msgString.String()
+}
 
-	message.Raw = base64.URLEncoding.EncodeToString([]byte(msgString.String()))
-
-	_, err = srv.Users.Messages.Send("me", &message).Do()
+func (s *GmailService) ModifyEmail(ctx context.Context, user *models.User, emailID string, addLabels, removeLabels []string) error {
+	srv, err := s.GetClient(ctx, user)
 	if err != nil {
 		return err
 	}
 
-	// Invalidate cache for this user after successful send
+	req := &gmail.ModifyMessageRequest{
+		AddLabelIds:    addLabels,
+		RemoveLabelIds: removeLabels,
+	}
+
+	_, err = retryGmail(ctx, s.retry, srv.Users.Messages.Modify("me", emailID, req).Context(ctx).Do)
+	if err != nil {
+		return messageError(err)
+	}
+
+	// Invalidate cache for this user after successful modification
 	cache.Invalidate(user.ID.Hex())
+	// The cached labels carry the unread and total counts ListMailboxes returns
+	s.InvalidateLabels(user.ID.Hex())
 	return nil
 }
 
-func (s *GmailService) ModifyEmail(ctx context.Context, user *models.User, emailID string, addLabels, removeLabels []string) error {
+// TrashEmail moves a message to the Gmail trash
+func (s *GmailService) TrashEmail(ctx context.Context, user *models.User, emailID string) error {
 	srv, err := s.GetClient(ctx, user)
 	if err != nil {
 		return err
 	}
-
-	req := &gmail.ModifyMessageRequest{
-		AddLabelIds:    addLabels,
-		RemoveLabelIds: removeLabels,
+	if _, err := srv.Users.Messages.Trash("me", emailID).Context(ctx).Do(); err != nil {
+		return messageError(err)
 	}
+	cache.Invalidate(user.ID.Hex())
+	return nil
+}
 
-	_, err = srv.Users.Messages.Modify("me", emailID, req).Do()
+// UntrashEmail takes a message out of the Gmail trash, restoring its previous labels
+func (s *GmailService) UntrashEmail(ctx context.Context, user *models.User, emailID string) error {
+	srv, err := s.GetClient(ctx, user)
 	if err != nil {
 		return err
 	}
+	if _, err := srv.Users.Messages.Untrash("me", emailID).Context(ctx).Do(); err != nil {
+		return messageError(err)
+	}
+	cache.Invalidate(user.ID.Hex())
+	return nil
+}
 
-	// Invalidate cache for this user after successful modification
+// DeleteEmail permanently deletes a message, bypassing the trash. Gmail only allows this
+// with the full https://mail.google.com/ scope; with gmail.modify it returns
+// ErrInsufficientScope.
+func (s *GmailService) DeleteEmail(ctx context.Context, user *models.User, emailID string) error {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := srv.Users.Messages.Delete("me", emailID).Context(ctx).Do(); err != nil {
+		return messageError(err)
+	}
 	cache.Invalidate(user.ID.Hex())
 	return nil
 }
 
+// messageError maps Gmail 404/403 responses for a single message to ErrMessageNotFound and
+// ErrInsufficientScope; rate limits are kept as they are
+func messageError(err error) error {
+	if errors.Is(err, ErrGmailRateLimited) || isGmailRateLimit(err) {
+		return err
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			return ErrMessageNotFound
+		case http.StatusForbidden:
+			return fmt.Errorf("%w: %s", ErrInsufficientScope, apiErr.Message)
+		}
+	}
+	return err
+}
+
 // InvalidateUserCache removes all cached email data for a specific user.
 // Call this after any operation that modifies email state (star, read, delete, etc.)
 func (s *GmailService) InvalidateUserCache(userID string) {
@@ -726,6 +1044,59 @@ func (s *GmailService) InvalidateUserCache(userID string) {
 }
 
 
+// GetCalendarParts returns the decoded text/calendar parts (inline invitations and .ics
+// attachments) of a message
+func (s *GmailService) GetCalendarParts(ctx context.Context, user *models.User, messageID string) ([]string, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", messageID).Format("full").Context(ctx).Do)
+	if err != nil {
+		return nil, messageError(err)
+	}
+
+	var parts []string
+	var walk func(part *gmail.MessagePart) error
+	walk = func(part *gmail.MessagePart) error {
+		if part == nil {
+			return nil
+		}
+		mimeType := strings.ToLower(part.MimeType)
+		isCalendar := mimeType == "text/calendar" || mimeType == "application/ics" ||
+			strings.HasSuffix(strings.ToLower(part.Filename), ".ics")
+		if isCalendar && part.Body != nil {
+			var data []byte
+			switch {
+			case part.Body.Data != "":
+				data, err = base64.URLEncoding.DecodeString(part.Body.Data)
+			case part.Body.AttachmentId != "":
+				var att *gmail.MessagePartBody
+				att, err = srv.Users.Messages.Attachments.Get("me", messageID, part.Body.AttachmentId).Context(ctx).Do()
+				if err == nil {
+					data, err = base64.URLEncoding.DecodeString(att.Data)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if len(data) > 0 {
+				parts = append(parts, string(data))
+			}
+		}
+		for _, p := range part.Parts {
+			if err := walk(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(msg.Payload); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
 func (s *GmailService) GetAttachment(ctx context.Context, user *models.User, messageID, attachmentID string) ([]byte, error) {
 	srv, err := s.GetClient(ctx, user)
 	if err != nil {
@@ -752,12 +1123,12 @@ func (s *GmailService) SearchEmails(ctx context.Context, user *models.User, quer
 	}
 
 	// Search using 'q' parameter with limit
-	req := srv.Users.Messages.List("me").Q(query).MaxResults(25)
+	req := srv.Users.Messages.List("me").Q(query).MaxResults(25).Context(ctx)
 	if pageToken != "" {
 		req.PageToken(pageToken)
 	}
 
-	resp, err := req.Do()
+	resp, err := retryGmail(ctx, s.retry, req.Do)
 	if err != nil {
 		return nil, "", 0, err
 	}
@@ -787,7 +1158,7 @@ func (s *GmailService) SearchEmails(ctx context.Context, user *models.User, quer
 		go func(idx int, id string) {
 			defer func() { <-sem }() // Release token
 
-			msg, err := srv.Users.Messages.Get("me", id).Format("full").Do()
+			msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", id).Format("full").Context(ctx).Do)
 			if err != nil {
 				resultsChan <- result{index: idx, err: err}
 				return
@@ -808,8 +1179,8 @@ func (s *GmailService) SearchEmails(ctx context.Context, user *models.User, quer
 
 				// Fallback to fuzzy
 				if byteIdx == -1 {
-					cleanBody, _, _ := transform.String(t, lowerBody)
-					cleanQuery, _, _ := transform.String(t, lowerQuery)
+					cleanBody := utils.RemoveAccents(lowerBody)
+					cleanQuery := utils.RemoveAccents(lowerQuery)
 					if cleanIdx := strings.Index(cleanBody, cleanQuery); cleanIdx != -1 {
 						byteIdx = cleanIdx
 						if byteIdx >= len(lowerBody) {
@@ -877,57 +1248,72 @@ func (s *GmailService) SearchEmails(ctx context.Context, user *models.User, quer
 	return validEmails, resp.NextPageToken, int(resp.ResultSizeEstimate), nil
 }
 
-// Transformer chain to remove accents
-var t = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-
 // ======== Week 4: Label Management ========
 
-// GetLabels returns all Gmail labels for a user
-func (s *GmailService) GetLabels(ctx context.Context, userID string) ([]models.GmailLabel, error) {
-	// Note: This method needs a User object to get the Gmail client
-	// For now, we return common Gmail labels as a fallback
-	// In production, you would get the user from repository
-
-	// Return common Gmail labels
-	labels := []models.GmailLabel{
-		{ID: "INBOX", Name: "Inbox", Type: "system"},
-		{ID: "STARRED", Name: "Starred", Type: "system"},
-		{ID: "IMPORTANT", Name: "Important", Type: "system"},
-		{ID: "SENT", Name: "Sent", Type: "system"},
-		{ID: "DRAFT", Name: "Draft", Type: "system"},
-		{ID: "TRASH", Name: "Trash", Type: "system"},
-		{ID: "SPAM", Name: "Spam", Type: "system"},
-		{ID: "UNREAD", Name: "Unread", Type: "system"},
-		{ID: "CATEGORY_PERSONAL", Name: "Personal", Type: "category"},
-		{ID: "CATEGORY_SOCIAL", Name: "Social", Type: "category"},
-		{ID: "CATEGORY_PROMOTIONS", Name: "Promotions", Type: "category"},
-		{ID: "CATEGORY_UPDATES", Name: "Updates", Type: "category"},
-		{ID: "CATEGORY_FORUMS", Name: "Forums", Type: "category"},
+// GetLabels returns the user's Gmail labels (cached, see GMAIL_LABEL_CACHE_TTL). Type is
+// "system" for Gmail's own labels (including the CATEGORY_* tabs) and "user" otherwise.
+func (s *GmailService) GetLabels(ctx context.Context, user *models.User) ([]models.GmailLabel, error) {
+	resp, err := s.listLabels(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]models.GmailLabel, 0, len(resp))
+	for _, l := range resp {
+		labelType := "user"
+		if strings.EqualFold(l.Type, "system") {
+			labelType = "system"
+		}
+		labels = append(labels, models.GmailLabel{
+			ID:   l.Id,
+			Name: l.Name,
+			Type: labelType,
+		})
 	}
 
 	return labels, nil
 }
 
-// GetLabelsWithUser returns Gmail labels for a specific user (full API call)
-func (s *GmailService) GetLabelsWithUser(ctx context.Context, user *models.User) ([]models.GmailLabel, error) {
+// ======== Gmail Push Notifications ========
+
+// WatchMailbox (re-)registers a Gmail push watch on the user's INBOX against the configured
+// Pub/Sub topic. Returns the watch expiry and the current mailbox history ID.
+func (s *GmailService) WatchMailbox(ctx context.Context, user *models.User) (time.Time, uint64, error) {
+	if s.cfg.GmailPubSubTopic == "" {
+		return time.Time{}, 0, errors.New("gmail pub/sub topic not configured")
+	}
+	return s.Watch(ctx, user, s.cfg.GmailPubSubTopic)
+}
+
+// Watch calls Users.Watch so Gmail publishes INBOX changes to topic. Gmail needs publish
+// rights on the topic (gmail-api-push@system.gserviceaccount.com). Watches expire after
+// about 7 days and must be renewed. Returns the watch expiry and the current history ID.
+func (s *GmailService) Watch(ctx context.Context, user *models.User, topic string) (time.Time, uint64, error) {
 	srv, err := s.GetClient(ctx, user)
 	if err != nil {
-		return nil, err
+		return time.Time{}, 0, err
 	}
 
-	resp, err := srv.Users.Labels.List("me").Do()
-	if err != nil {
-		return nil, err
+	req := &gmail.WatchRequest{
+		TopicName: topic,
+		LabelIds:  []string{"INBOX"},
 	}
 
-	var labels []models.GmailLabel
-	for _, l := range resp.Labels {
-		labels = append(labels, models.GmailLabel{
-			ID:   l.Id,
-			Name: l.Name,
-			Type: strings.ToLower(l.Type),
-		})
+	resp, err := srv.Users.Watch("me", req).Context(ctx).Do()
+	if err != nil {
+		return time.Time{}, 0, err
 	}
 
-	return labels, nil
+	// Expiration is epoch milliseconds
+	expiry := time.UnixMilli(resp.Expiration)
+	return expiry, resp.HistoryId, nil
+}
+
+// StopWatch stops push notifications for the user's mailbox
+func (s *GmailService) StopWatch(ctx context.Context, user *models.User) error {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return err
+	}
+	return srv.Users.Stop("me").Context(ctx).Do()
 }
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"encoding/base64"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func attachmentPart(filename, mimeType, id string) *gmail.MessagePart {
+	return &gmail.MessagePart{
+		Filename: filename,
+		MimeType: mimeType,
+		Body:     &gmail.MessagePartBody{AttachmentId: id, Size: 2048},
+	}
+}
+
+func textPart(mimeType, text string) *gmail.MessagePart {
+	return &gmail.MessagePart{
+		MimeType: mimeType,
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(text))},
+	}
+}
+
+func mixedMessage(snippet string, parts ...*gmail.MessagePart) *gmail.Message {
+	return &gmail.Message{
+		Id:       "m1",
+		ThreadId: "t1",
+		Snippet:  snippet,
+		Payload: &gmail.MessagePart{
+			MimeType: "multipart/mixed",
+			Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: "Fwd: contract"}},
+			Body:     &gmail.MessagePartBody{},
+			Parts:    parts,
+		},
+	}
+}
+
+func TestMapAttachmentOnlyMessage(t *testing.T) {
+	pdf := attachmentPart("contract.pdf", "application/pdf", "att-1")
+	photo := attachmentPart("photo.jpg", "image/jpeg", "att-2")
+
+	tests := []struct {
+		name        string
+		placeholder bool
+		msg         *gmail.Message
+		wantBody    string
+		wantPreview string
+	}{
+		{"single attachment", true, mixedMessage("", pdf), "[Attachment: contract.pdf]", "[Attachment: contract.pdf]"},
+		{"several attachments", true, mixedMessage("", pdf, photo), "[Attachment: contract.pdf] [Attachment: photo.jpg]", "[Attachment: contract.pdf] [Attachment: photo.jpg]"},
+		{"nested attachment", true, mixedMessage("", &gmail.MessagePart{MimeType: "multipart/mixed", Body: &gmail.MessagePartBody{}, Parts: []*gmail.MessagePart{pdf}}),
+			"[Attachment: contract.pdf]", "[Attachment: contract.pdf]"},
+		{"Gmail snippet is kept", true, mixedMessage("see attached", pdf), "[Attachment: contract.pdf]", "see attached"},
+		{"text body wins", true, mixedMessage("Hi", textPart("text/plain", "Hi there"), pdf), "Hi there", "Hi"},
+		{"placeholder disabled", false, mixedMessage("", pdf), "", ""},
+		{"no attachments", true, mixedMessage(""), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGmailService(&config.Config{AttachmentOnlyPlaceholder: tt.placeholder})
+			email := s.mapGmailMessageToEmail(tt.msg)
+			if email.Body != tt.wantBody || email.Preview != tt.wantPreview {
+				t.Errorf("body = %q, preview = %q, want %q, %q", email.Body, email.Preview, tt.wantBody, tt.wantPreview)
+			}
+			if email.HasAttachments != (len(email.Attachments) > 0) {
+				t.Errorf("HasAttachments = %v with %d attachments", email.HasAttachments, len(email.Attachments))
+			}
+		})
+	}
+}
+
+func TestAttachmentPlaceholderSkipsUnnamed(t *testing.T) {
+	s := NewGmailService(&config.Config{})
+	atts := s.getAttachments(mixedMessage("", attachmentPart("", "application/octet-stream", "att-3"), attachmentPart("a.txt", "text/plain", "att-4")).Payload)
+	if got := attachmentPlaceholder(atts); got != "[Attachment: a.txt]" {
+		t.Errorf("attachmentPlaceholder = %q", got)
+	}
+}
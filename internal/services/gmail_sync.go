@@ -0,0 +1,152 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrHistoryExpired is returned by SyncHistory when Gmail no longer keeps history for the
+// start ID (typically after about a week); callers should fall back to FullSync.
+var ErrHistoryExpired = errors.New("gmail history id is too old")
+
+// fullSyncLimit is how many recent messages FullSync fetches
+const fullSyncLimit = 100
+
+// MailboxChanges are the messages to store and delete locally after a sync
+type MailboxChanges struct {
+	Upserted   []*models.Email // added or relabeled messages, fetched in full
+	DeletedIDs []string        // messages permanently deleted in Gmail
+	HistoryID  uint64          // history ID to resume the next incremental sync from
+}
+
+// SyncHistory fetches only the messages added, relabeled or deleted since startHistoryID
+// using Users.History.List.
+func (s *GmailService) SyncHistory(ctx context.Context, user *models.User, startHistoryID uint64) (*MailboxChanges, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &MailboxChanges{HistoryID: startHistoryID}
+	changed := make(map[string]bool)
+	deleted := make(map[string]bool)
+
+	err = srv.Users.History.List("me").StartHistoryId(startHistoryID).Pages(ctx, func(resp *gmail.ListHistoryResponse) error {
+		for _, h := range resp.History {
+			for _, m := range h.MessagesAdded {
+				changed[m.Message.Id] = true
+			}
+			for _, m := range h.LabelsAdded {
+				changed[m.Message.Id] = true
+			}
+			for _, m := range h.LabelsRemoved {
+				changed[m.Message.Id] = true
+			}
+			for _, m := range h.MessagesDeleted {
+				deleted[m.Message.Id] = true
+			}
+		}
+		if resp.HistoryId > changes.HistoryID {
+			changes.HistoryID = resp.HistoryId
+		}
+		return nil
+	})
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, ErrHistoryExpired
+		}
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(changed))
+	for id := range changed {
+		if !deleted[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	emails, gone := s.fetchFullMessages(ctx, srv, ids)
+	changes.Upserted = emails
+	for _, id := range gone {
+		deleted[id] = true
+	}
+	for id := range deleted {
+		changes.DeletedIDs = append(changes.DeletedIDs, id)
+	}
+	return changes, nil
+}
+
+// FullSync fetches the most recent messages and the current history ID. Used for the first
+// sync and when the stored history ID has expired.
+func (s *GmailService) FullSync(ctx context.Context, user *models.User) (*MailboxChanges, error) {
+	srv, err := s.GetClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the history ID first so changes made during the listing are picked up next time
+	profile, err := srv.Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := retryGmail(ctx, s.retry, srv.Users.Messages.List("me").MaxResults(fullSyncLimit).Context(ctx).Do)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(resp.Messages))
+	for i, m := range resp.Messages {
+		ids[i] = m.Id
+	}
+	emails, _ := s.fetchFullMessages(ctx, srv, ids)
+
+	return &MailboxChanges{Upserted: emails, HistoryID: profile.HistoryId}, nil
+}
+
+// fetchFullMessages fetches messages in full with bounded concurrency. Messages Gmail no
+// longer has (404) are returned in gone; other failures are skipped.
+func (s *GmailService) fetchFullMessages(ctx context.Context, srv *gmail.Service, ids []string) (emails []*models.Email, gone []string) {
+	const maxConcurrency = 10
+	sem := make(chan struct{}, maxConcurrency)
+
+	type result struct {
+		id    string
+		email *models.Email
+		err   error
+	}
+	resultsChan := make(chan result, len(ids))
+
+	for _, id := range ids {
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() { <-sem }()
+			msg, err := retryGmail(ctx, s.retry, srv.Users.Messages.Get("me", id).Format("full").Context(ctx).Do)
+			if err != nil {
+				resultsChan <- result{id: id, err: err}
+				return
+			}
+			email := s.mapGmailMessageToEmail(msg)
+			resultsChan <- result{id: id, email: &email}
+		}(id)
+	}
+
+	for range ids {
+		res := <-resultsChan
+		if res.err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(res.err, &apiErr) && apiErr.Code == http.StatusNotFound {
+				gone = append(gone, res.id)
+			}
+			continue
+		}
+		emails = append(emails, res.email)
+	}
+	return emails, gone
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func scored(id string, score float64, received time.Time) models.ScoredEmail {
+	return models.ScoredEmail{Email: models.Email{ID: id, ReceivedAt: received}, Score: score}
+}
+
+func TestFuseRankings(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rankings := map[string][]models.ScoredEmail{
+		models.RetrieverKeyword: {
+			scored("a", 9, day), scored("b", 6, day), scored("c", 3, day),
+			scored("a", 1, day), // a duplicate keeps its first (best) rank
+		},
+		models.RetrieverSemantic: {scored("b", 0.9, day), scored("d", 0.7, day), scored("a", 0.5, day)},
+		// Gmail has no scores: by position
+		models.RetrieverGmail: {scored("e", 0, day.Add(time.Hour)), scored("c", 0, day), scored("f", 0, day)},
+	}
+	results := FuseRankings(rankings, 60)
+
+	rrf := func(ranks ...int) float64 {
+		sum := 0.0
+		for _, r := range ranks {
+			sum += 1 / float64(60+r)
+		}
+		return sum
+	}
+	want := []struct {
+		id        string
+		score     float64
+		matchedBy []string
+		ranks     map[string]int
+		scores    map[string]float64
+	}{
+		// b: keyword 2, semantic 1 beats a: keyword 1, semantic 3
+		{"b", rrf(2, 1), []string{"semantic", "keyword"}, map[string]int{"keyword": 2, "semantic": 1}, map[string]float64{"keyword": 0.625, "semantic": 1}},
+		{"a", rrf(1, 3), []string{"keyword", "semantic"}, map[string]int{"keyword": 1, "semantic": 3}, map[string]float64{"keyword": 1, "semantic": 0}},
+		{"c", rrf(3, 2), []string{"gmail", "keyword"}, map[string]int{"keyword": 3, "gmail": 2}, map[string]float64{"keyword": 0.25, "gmail": 1 - 1.0/3}},
+		// Found once: by rank alone
+		{"e", rrf(1), []string{"gmail"}, map[string]int{"gmail": 1}, map[string]float64{"gmail": 1}},
+		{"d", rrf(2), []string{"semantic"}, map[string]int{"semantic": 2}, map[string]float64{"semantic": 0.5}},
+		{"f", rrf(3), []string{"gmail"}, map[string]int{"gmail": 3}, map[string]float64{"gmail": 1 - 2.0/3}},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Email.ID != w.id {
+			t.Errorf("result %d = %s, want %s", i, r.Email.ID, w.id)
+			continue
+		}
+		if math.Abs(r.Score-w.score) > 1e-12 {
+			t.Errorf("%s score = %v, want %v", w.id, r.Score, w.score)
+		}
+		if !reflect.DeepEqual(r.MatchedBy, w.matchedBy) || !reflect.DeepEqual(r.Ranks, w.ranks) {
+			t.Errorf("%s matched by %v ranks %v, want %v %v", w.id, r.MatchedBy, r.Ranks, w.matchedBy, w.ranks)
+		}
+		for source, s := range w.scores {
+			if math.Abs(r.Scores[source]-s) > 1e-9 {
+				t.Errorf("%s %s score = %v, want %v", w.id, source, r.Scores[source], s)
+			}
+		}
+	}
+}
+
+func TestFuseRankingsTies(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// Each email is rank 1 somewhere, so all scores are equal: newer first, then by ID
+	rankings := map[string][]models.ScoredEmail{
+		models.RetrieverKeyword:  {scored("old", 1, day)},
+		models.RetrieverSemantic: {scored("y", 1, day.Add(time.Hour))},
+		models.RetrieverGmail:    {scored("x", 0, day.Add(time.Hour))},
+	}
+	for i := 0; i < 20; i++ {
+		var ids []string
+		for _, r := range FuseRankings(rankings, 60) {
+			ids = append(ids, r.Email.ID)
+		}
+		if got := strings.Join(ids, ","); got != "x,y,old" {
+			t.Fatalf("tied order = %s, want x,y,old", got)
+		}
+	}
+	if got := FuseRankings(map[string][]models.ScoredEmail{}, 60); len(got) != 0 {
+		t.Errorf("no rankings fused to %d results", len(got))
+	}
+}
+
+func TestGmailFilterOperators(t *testing.T) {
+	from := time.Unix(1714521600, 0)
+	yes, no := true, false
+	tests := []struct {
+		filters *models.SearchFilters
+		want    string
+	}{
+		{nil, ""},
+		{&models.SearchFilters{}, ""},
+		{&models.SearchFilters{DateFrom: &from, DateTo: &from}, " after:1714521600 before:1714521600"},
+		{&models.SearchFilters{Sender: " Ann (Sales) "}, " from:(Ann (Sales)"},
+		{&models.SearchFilters{Label: "STARRED", MailboxID: "INBOX"}, " label:starred label:inbox"},
+		// User labels are stored by ID, which Gmail's label: doesn't accept
+		{&models.SearchFilters{Label: "Label_12", MailboxID: "Label_3"}, ""},
+		{&models.SearchFilters{HasAttachment: &yes, IsRead: &no}, " has:attachment is:unread"},
+		{&models.SearchFilters{HasAttachment: &no, IsRead: &yes}, " -has:attachment is:read"},
+		{&models.SearchFilters{Status: "todo"}, ""},
+	}
+	for _, tt := range tests {
+		if got := GmailFilterOperators(tt.filters); got != tt.want {
+			t.Errorf("GmailFilterOperators(%+v) = %q, want %q", tt.filters, got, tt.want)
+		}
+	}
+}
+
+// searchGmail fakes a mailbox whose search returns every message regardless of the query,
+// like a Gmail that ignored the pushed-down operators, and records the queries
+func searchGmail(queries *[]string, mu *sync.Mutex, messages ...*gmail.Message) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/gmail/v1/users/me/messages"
+		switch {
+		case r.URL.Path == prefix:
+			mu.Lock()
+			*queries = append(*queries, r.URL.Query().Get("q"))
+			mu.Unlock()
+			list := &gmail.ListMessagesResponse{}
+			for _, m := range messages {
+				list.Messages = append(list.Messages, &gmail.Message{Id: m.Id})
+			}
+			writeJSON(w, list)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+			for _, m := range messages {
+				if m.Id == id {
+					writeJSON(w, m)
+					return
+				}
+			}
+			writeGmailError(w, http.StatusNotFound, "notFound")
+		default:
+			writeGmailError(w, http.StatusNotFound, "notFound")
+		}
+	})
+}
+
+// failingEmbedder fails every query, so the semantic retriever fails before touching the database
+type failingEmbedder struct{ fixedEmbedder }
+
+func (*failingEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("embedding API down")
+}
+
+func TestHybridAppliesFilters(t *testing.T) {
+	var (
+		queries []string
+		mu      sync.Mutex
+	)
+	gmailSvc, user := newFakeGmail(t, searchGmail(&queries, &mu,
+		fakeMessage("read", "INBOX"),
+		fakeMessage("unread1", "INBOX", "UNREAD"),
+		fakeMessage("spam", "SPAM", "UNREAD"),
+		fakeMessage("unread2", "INBOX", "UNREAD"),
+	), 1, 0)
+	s := NewSearchService(nil, &failingEmbedder{}, gmailSvc, VectorSearchConfig{}, 0)
+
+	unread := false
+	resp, err := s.Hybrid(context.Background(), user, &models.HybridSearchRequest{
+		Query:   "invoice",
+		Limit:   5,
+		Filters: models.SearchFilters{IsRead: &unread, Label: "INBOX"},
+		Sources: []string{models.RetrieverGmail, models.RetrieverSemantic},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0] != "invoice label:inbox is:unread" {
+		t.Errorf("Gmail queries = %q, want the filters as operators", queries)
+	}
+	var ids []string
+	for _, r := range resp.Results {
+		ids = append(ids, r.Email.ID)
+	}
+	// Filters are checked again on what Gmail returned
+	if got := strings.Join(ids, ","); got != "unread1,unread2" || resp.Total != 2 {
+		t.Errorf("results = %s (total %d), want unread1,unread2", got, resp.Total)
+	}
+	if resp.Errors[models.RetrieverSemantic] == "" || len(resp.Errors) != 1 {
+		t.Errorf("errors = %v, want the semantic failure reported", resp.Errors)
+	}
+
+	// Only when every retriever fails does the search fail
+	gmailDown, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeGmailError(w, http.StatusBadRequest, "invalidArgument")
+	}), 1, 0)
+	s = NewSearchService(nil, &failingEmbedder{}, gmailDown, VectorSearchConfig{}, 0)
+	if _, err := s.Hybrid(context.Background(), user, &models.HybridSearchRequest{
+		Query: "invoice", Sources: []string{models.RetrieverGmail, models.RetrieverSemantic},
+	}); err == nil || !strings.Contains(err.Error(), "all retrievers failed") {
+		t.Errorf("all retrievers failing = %v", err)
+	}
+
+	if _, err := s.Hybrid(context.Background(), user, &models.HybridSearchRequest{Query: "x", Sources: []string{"bing"}}); !errors.Is(err, ErrInvalidSearchSource) {
+		t.Errorf("unknown source = %v, want ErrInvalidSearchSource", err)
+	}
+}
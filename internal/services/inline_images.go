@@ -0,0 +1,71 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// AttachmentURL is the download route (GET /api/attachments/:id) of an attachment of messageID
+func AttachmentURL(messageID, attachmentID string) string {
+	return "/api/attachments/" + url.PathEscape(attachmentID) + "?messageId=" + url.QueryEscape(messageID)
+}
+
+// inlineImages collects the parts of a message that have a Content-ID and are stored as an
+// attachment, i.e. what an HTML body can reference with cid: URLs. Small parts Gmail sends
+// inline (no attachment ID) can't be downloaded separately and are skipped.
+func inlineImages(part *gmail.MessagePart) []models.InlineImage {
+	if part == nil {
+		return nil
+	}
+	var images []models.InlineImage
+	if part.Body != nil && part.Body.AttachmentId != "" {
+		for _, h := range part.Headers {
+			if !strings.EqualFold(h.Name, "Content-ID") {
+				continue
+			}
+			if cid := strings.Trim(strings.TrimSpace(h.Value), "<>"); cid != "" {
+				images = append(images, models.InlineImage{
+					ContentID:    cid,
+					AttachmentID: part.Body.AttachmentId,
+					MimeType:     part.MimeType,
+				})
+			}
+			break
+		}
+	}
+	for _, p := range part.Parts {
+		images = append(images, inlineImages(p)...)
+	}
+	return images
+}
+
+// cidURLRE matches a cid: URL up to the end of the attribute value it sits in
+var cidURLRE = regexp.MustCompile(`(?i)\bcid:([^"'\s)>]+)`)
+
+// ResolveInlineImages rewrites the cid: URLs of an HTML body to the download URLs of the
+// matching attachments of messageID. Content-IDs are compared case-insensitively, and
+// percent-encoded references are decoded first; unknown ones are left as they are.
+func ResolveInlineImages(body, messageID string, images []models.InlineImage) string {
+	if len(images) == 0 || !strings.Contains(strings.ToLower(body), "cid:") {
+		return body
+	}
+	byCID := make(map[string]string, len(images))
+	for _, img := range images {
+		byCID[strings.ToLower(img.ContentID)] = img.AttachmentID
+	}
+	return cidURLRE.ReplaceAllStringFunc(body, func(ref string) string {
+		cid := ref[len("cid:"):]
+		if decoded, err := url.PathUnescape(cid); err == nil {
+			cid = decoded
+		}
+		id, ok := byCID[strings.ToLower(cid)]
+		if !ok {
+			return ref
+		}
+		return AttachmentURL(messageID, id)
+	})
+}
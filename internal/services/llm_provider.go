@@ -0,0 +1,325 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LLMRequest is a provider-agnostic text generation request
+type LLMRequest struct {
+	System      string
+	Prompt      string
+	MaxTokens   int
+	Temperature float64
+}
+
+// LLMProvider generates text from a prompt. Implementations map LLMRequest onto their
+// provider's API and retry transient failures.
+type LLMProvider interface {
+	Name() string
+	Model() string
+	Generate(ctx context.Context, req LLMRequest) (string, error)
+}
+
+// NewLLMProvider returns the provider selected by name ("openai" | "gemini" | "anthropic"),
+// or nil when no API key is configured or the provider is unknown (callers fall back to
+// local processing).
+func NewLLMProvider(provider, apiKey, model string, client *http.Client) LLMProvider {
+	if apiKey == "" {
+		return nil
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	switch strings.ToLower(provider) {
+	case "", "openai":
+		if model == "" {
+			model = "gpt-3.5-turbo"
+		}
+		return &openAIProvider{apiKey: apiKey, model: model, client: client, baseURL: "https://api.openai.com/v1"}
+	case "gemini":
+		if model == "" {
+			model = "gemini-1.5-flash"
+		}
+		return &geminiProvider{apiKey: apiKey, model: model, client: client, baseURL: "https://generativelanguage.googleapis.com/v1beta"}
+	case "anthropic", "claude":
+		if model == "" {
+			model = "claude-3-haiku-20240307"
+		}
+		return &anthropicProvider{apiKey: apiKey, model: model, client: client, baseURL: "https://api.anthropic.com/v1"}
+	default:
+		fmt.Printf("Unknown LLM provider %q, using local processing\n", provider)
+		return nil
+	}
+}
+
+// ========== Retry ==========
+
+// providerError is a non-2xx response from an LLM provider
+type providerError struct {
+	provider string
+	status   int
+	body     string
+}
+
+func (e *providerError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.provider, e.status, e.body)
+}
+
+// retryable reports whether the request may succeed if repeated (rate limits, server errors)
+func (e *providerError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// IsRateLimited reports whether err is a provider's 429 response
+func IsRateLimited(err error) bool {
+	var pe *providerError
+	return errors.As(err, &pe) && pe.status == http.StatusTooManyRequests
+}
+
+const (
+	llmMaxAttempts = 3
+	llmBaseBackoff = 500 * time.Millisecond
+)
+
+// withRetry runs fn up to llmMaxAttempts times with exponential backoff (500ms, 1s, ...).
+// Client errors other than 429 are returned immediately.
+func withRetry(ctx context.Context, fn func() (string, error)) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < llmMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(llmBaseBackoff << (attempt - 1)):
+			}
+		}
+
+		out, err := fn()
+		if err == nil {
+			return out, nil
+		}
+		lastErr = err
+
+		var perr *providerError
+		if errors.As(err, &perr) && !perr.retryable() {
+			return "", err
+		}
+	}
+	return "", lastErr
+}
+
+// postJSON sends a JSON request and decodes a JSON response into out
+func postJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &providerError{provider: provider, status: resp.StatusCode, body: string(bodyBytes)}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ========== OpenAI ==========
+
+type openAIProvider struct {
+	apiKey  string
+	model   string
+	client  *http.Client
+	baseURL string
+}
+
+func (p *openAIProvider) Name() string  { return "openai" }
+func (p *openAIProvider) Model() string { return p.model }
+
+// Generate calls the Chat Completions API
+func (p *openAIProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	messages := []message{}
+	if req.System != "" {
+		messages = append(messages, message{Role: "system", Content: req.System})
+	}
+	messages = append(messages, message{Role: "user", Content: req.Prompt})
+
+	reqBody := map[string]interface{}{
+		"model":       p.model,
+		"messages":    messages,
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+	}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+
+	return withRetry(ctx, func() (string, error) {
+		var parsed struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+			Usage struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := postJSON(ctx, p.client, "OpenAI", p.baseURL+"/chat/completions", headers, reqBody, &parsed); err != nil {
+			return "", err
+		}
+		reportTokens(ctx, parsed.Usage.PromptTokens, parsed.Usage.CompletionTokens)
+		if len(parsed.Choices) == 0 {
+			return "", errors.New("no choices in OpenAI response")
+		}
+		return strings.TrimSpace(parsed.Choices[0].Message.Content), nil
+	})
+}
+
+// ========== Gemini ==========
+
+type geminiProvider struct {
+	apiKey  string
+	model   string
+	client  *http.Client
+	baseURL string
+}
+
+func (p *geminiProvider) Name() string  { return "gemini" }
+func (p *geminiProvider) Model() string { return p.model }
+
+// Generate calls the generateContent endpoint
+func (p *geminiProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", p.baseURL, p.model, p.apiKey)
+
+	reqBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]string{
+					{"text": req.Prompt},
+				},
+			},
+		},
+		"generationConfig": map[string]interface{}{
+			"temperature":     req.Temperature,
+			"maxOutputTokens": req.MaxTokens,
+		},
+	}
+	if req.System != "" {
+		reqBody["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]string{{"text": req.System}},
+		}
+	}
+
+	return withRetry(ctx, func() (string, error) {
+		var parsed struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := postJSON(ctx, p.client, "Gemini", url, nil, reqBody, &parsed); err != nil {
+			return "", err
+		}
+		reportTokens(ctx, parsed.UsageMetadata.PromptTokenCount, parsed.UsageMetadata.CandidatesTokenCount)
+		if len(parsed.Candidates) == 0 || len(parsed.Candidates[0].Content.Parts) == 0 {
+			return "", errors.New("no content in Gemini response")
+		}
+		return strings.TrimSpace(parsed.Candidates[0].Content.Parts[0].Text), nil
+	})
+}
+
+// ========== Anthropic ==========
+
+type anthropicProvider struct {
+	apiKey  string
+	model   string
+	client  *http.Client
+	baseURL string
+}
+
+func (p *anthropicProvider) Name() string  { return "anthropic" }
+func (p *anthropicProvider) Model() string { return p.model }
+
+// Generate calls the Messages API
+func (p *anthropicProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 256 // required by the Messages API
+	}
+	reqBody := map[string]interface{}{
+		"model":       p.model,
+		"max_tokens":  maxTokens,
+		"temperature": req.Temperature,
+		"messages": []map[string]string{
+			{"role": "user", "content": req.Prompt},
+		},
+	}
+	if req.System != "" {
+		reqBody["system"] = req.System
+	}
+	headers := map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
+	}
+
+	return withRetry(ctx, func() (string, error) {
+		var parsed struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			Usage struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if err := postJSON(ctx, p.client, "Anthropic", p.baseURL+"/messages", headers, reqBody, &parsed); err != nil {
+			return "", err
+		}
+		reportTokens(ctx, parsed.Usage.InputTokens, parsed.Usage.OutputTokens)
+		var sb strings.Builder
+		for _, c := range parsed.Content {
+			if c.Type == "text" {
+				sb.WriteString(c.Text)
+			}
+		}
+		if sb.Len() == 0 {
+			return "", errors.New("no content in Anthropic response")
+		}
+		return strings.TrimSpace(sb.String()), nil
+	})
+}
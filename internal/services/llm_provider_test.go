@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// providerCase describes one provider's endpoint and wire format
+type providerCase struct {
+	name  string
+	path  string
+	new   func(baseURL string, client *http.Client) LLMProvider
+	reply func(text string) any
+	// check inspects the headers and decoded body of a request made for req
+	check func(t *testing.T, r *http.Request, body map[string]any, req LLMRequest)
+}
+
+var providerCases = []providerCase{
+	{
+		name: "openai",
+		path: "/chat/completions",
+		new: func(baseURL string, client *http.Client) LLMProvider {
+			return &openAIProvider{apiKey: "sk-test", model: "gpt-test", client: client, baseURL: baseURL}
+		},
+		reply: func(text string) any {
+			return map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"content": text}}},
+				"usage":   map[string]any{"prompt_tokens": 12, "completion_tokens": 5},
+			}
+		},
+		check: func(t *testing.T, r *http.Request, body map[string]any, req LLMRequest) {
+			if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+				t.Errorf("Authorization = %q", got)
+			}
+			msgs, _ := body["messages"].([]any)
+			if body["model"] != "gpt-test" || len(msgs) != 2 ||
+				msgs[0].(map[string]any)["content"] != req.System || msgs[1].(map[string]any)["content"] != req.Prompt {
+				t.Errorf("request = %v", body)
+			}
+		},
+	},
+	{
+		name: "gemini",
+		path: "/models/gemini-test:generateContent",
+		new: func(baseURL string, client *http.Client) LLMProvider {
+			return &geminiProvider{apiKey: "g-test", model: "gemini-test", client: client, baseURL: baseURL}
+		},
+		reply: func(text string) any {
+			return map[string]any{
+				"candidates":    []any{map[string]any{"content": map[string]any{"parts": []any{map[string]any{"text": text}}}}},
+				"usageMetadata": map[string]any{"promptTokenCount": 12, "candidatesTokenCount": 5},
+			}
+		},
+		check: func(t *testing.T, r *http.Request, body map[string]any, req LLMRequest) {
+			if got := r.URL.Query().Get("key"); got != "g-test" {
+				t.Errorf("key = %q", got)
+			}
+			if !strings.Contains(mustJSON(body["systemInstruction"]), mustJSON(req.System)) ||
+				!strings.Contains(mustJSON(body["contents"]), mustJSON(req.Prompt)) {
+				t.Errorf("request = %v", body)
+			}
+		},
+	},
+	{
+		name: "anthropic",
+		path: "/messages",
+		new: func(baseURL string, client *http.Client) LLMProvider {
+			return &anthropicProvider{apiKey: "a-test", model: "claude-test", client: client, baseURL: baseURL}
+		},
+		reply: func(text string) any {
+			return map[string]any{
+				"content": []any{map[string]any{"type": "text", "text": text}},
+				"usage":   map[string]any{"input_tokens": 12, "output_tokens": 5},
+			}
+		},
+		check: func(t *testing.T, r *http.Request, body map[string]any, req LLMRequest) {
+			if r.Header.Get("x-api-key") != "a-test" || r.Header.Get("anthropic-version") == "" {
+				t.Errorf("headers = %v", r.Header)
+			}
+			if body["model"] != "claude-test" || body["system"] != req.System || body["max_tokens"] != float64(req.MaxTokens) {
+				t.Errorf("request = %v", body)
+			}
+		},
+	},
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// providerServer answers pc's endpoint with the given statuses in turn (200 once they run
+// out), checking each request against req and counting them
+func providerServer(t *testing.T, pc providerCase, req LLMRequest, calls *atomic.Int32, statuses ...int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if r.Method != http.MethodPost || r.URL.Path != pc.path {
+			http.NotFound(w, r)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pc.check(t, r, body, req)
+		if n <= len(statuses) {
+			http.Error(w, `{"error":"failed"}`, statuses[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pc.reply("  The invoice is due Friday.  "))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+var providerRequest = LLMRequest{System: "Be brief", Prompt: "Summarize this", MaxTokens: 80}
+
+func TestLLMProvidersGenerate(t *testing.T) {
+	for _, pc := range providerCases {
+		t.Run(pc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := providerServer(t, pc, providerRequest, &calls)
+			p := pc.new(srv.URL, srv.Client())
+
+			usage := &tokenUsage{}
+			ctx := context.WithValue(context.Background(), tokenSinkKey{}, usage)
+			got, err := p.Generate(ctx, providerRequest)
+			if err != nil || got != "The invoice is due Friday." {
+				t.Fatalf("Generate = %q, %v", got, err)
+			}
+			if calls.Load() != 1 || usage.prompt != 12 || usage.completion != 5 {
+				t.Errorf("calls = %d, tokens = %d/%d, want 1 call and 12/5 tokens", calls.Load(), usage.prompt, usage.completion)
+			}
+		})
+	}
+}
+
+func TestLLMProvidersRetryServerErrors(t *testing.T) {
+	for _, pc := range providerCases {
+		t.Run(pc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := providerServer(t, pc, providerRequest, &calls, http.StatusServiceUnavailable)
+			got, err := pc.new(srv.URL, srv.Client()).Generate(context.Background(), providerRequest)
+			if err != nil || got != "The invoice is due Friday." || calls.Load() != 2 {
+				t.Errorf("Generate = %q, %v after %d calls, want the second attempt's reply", got, err, calls.Load())
+			}
+		})
+	}
+}
+
+func TestLLMProvidersFallBackOnError(t *testing.T) {
+	text := "The invoice for March is attached. Please pay the invoice by Friday. Thanks for your business."
+	opts := SummaryOptions{Language: SummaryLanguageEN}
+	norm, _ := opts.Normalize()
+	req := buildSummaryPrompt(text, norm)
+	spec := summaryLengths[norm.Length]
+	want := extractiveSummary(text, spec.topSentences, spec.maxChars)
+
+	for _, pc := range providerCases {
+		t.Run(pc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := providerServer(t, pc, req, &calls, http.StatusBadRequest, http.StatusBadRequest)
+			p := pc.new(srv.URL, srv.Client())
+
+			if _, err := p.Generate(context.Background(), req); err == nil || !strings.Contains(err.Error(), "status 400") {
+				t.Fatalf("Generate error = %v, want the 400 response", err)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Fatalf("calls = %d, want 1: client errors are not retried", n)
+			}
+
+			s := NewSummaryService(nil, nil, nil, nil, p, nil)
+			got, err := s.SummarizeText(context.Background(), text, opts)
+			if err != nil || got != want {
+				t.Errorf("SummarizeText = %q, %v, want the extractive summary %q", got, err, want)
+			}
+			if n := calls.Load(); n != 2 {
+				t.Errorf("calls = %d, want SummarizeText to try the provider once", n)
+			}
+		})
+	}
+}
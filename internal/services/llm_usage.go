@@ -0,0 +1,301 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// usageRecordTimeout bounds storing one usage record; it outlives the request that made the call
+const usageRecordTimeout = 5 * time.Second
+
+// UsageCapError is returned instead of calling a provider once the user has used up their
+// monthly token cap
+type UsageCapError struct {
+	Summary *models.LLMUsageSummary
+}
+
+func (e *UsageCapError) Error() string {
+	return fmt.Sprintf("monthly AI token cap of %d reached", e.Summary.TokenCap)
+}
+
+// Response is the 402 body for the error
+func (e *UsageCapError) Response() models.UsageCapResponse {
+	return models.UsageCapResponse{
+		Error:   "token_cap_reached",
+		Message: "Monthly AI token cap reached; usage resets at the start of next month",
+		Usage:   e.Summary,
+	}
+}
+
+// ===== Context =====
+
+type usageScopeKey struct{}
+type tokenSinkKey struct{}
+
+// usageScope says on whose behalf, and for what, provider calls are made
+type usageScope struct {
+	userID    string
+	operation string
+}
+
+// WithUsageUser attributes the LLM and embedding calls made with ctx to userID
+func WithUsageUser(ctx context.Context, userID string) context.Context {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	scope.userID = userID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// withOperation labels the calls made with ctx, e.g. "summary" or "compose"
+func withOperation(ctx context.Context, operation string) context.Context {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	scope.operation = operation
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func usageScopeFrom(ctx context.Context) usageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope
+}
+
+// tokenUsage is what a provider reports for one call
+type tokenUsage struct {
+	prompt     int
+	completion int
+}
+
+// reportTokens hands the usage block of a provider response to the meter wrapping the call,
+// if any
+func reportTokens(ctx context.Context, prompt, completion int) {
+	if sink, ok := ctx.Value(tokenSinkKey{}).(*tokenUsage); ok {
+		sink.prompt += prompt
+		sink.completion += completion
+	}
+}
+
+// ===== Pricing =====
+
+// modelPrice is USD per million tokens
+type modelPrice struct {
+	prompt     float64
+	completion float64
+}
+
+// modelPrices are list prices by model name prefix; the longest matching prefix wins and
+// unknown models cost 0
+var modelPrices = map[string]modelPrice{
+	"gpt-3.5-turbo":          {0.50, 1.50},
+	"gpt-4o-mini":            {0.15, 0.60},
+	"gpt-4o":                 {2.50, 10.00},
+	"gpt-4.1-mini":           {0.40, 1.60},
+	"gpt-4.1":                {2.00, 8.00},
+	"gemini-1.5-flash":       {0.075, 0.30},
+	"gemini-1.5-pro":         {1.25, 5.00},
+	"gemini-2.0-flash":       {0.10, 0.40},
+	"claude-3-haiku":         {0.25, 1.25},
+	"claude-3-5-haiku":       {0.80, 4.00},
+	"claude-3-5-sonnet":      {3.00, 15.00},
+	"text-embedding-ada-002": {0.10, 0},
+	"text-embedding-3-small": {0.02, 0},
+	"text-embedding-3-large": {0.13, 0},
+}
+
+// EstimateCost returns the USD list price of a call to model
+func EstimateCost(model string, promptTokens, completionTokens int) float64 {
+	model = strings.ToLower(model)
+	best := ""
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0
+	}
+	p := modelPrices[best]
+	return (float64(promptTokens)*p.prompt + float64(completionTokens)*p.completion) / 1e6
+}
+
+// monthPeriod returns the UTC calendar month containing now
+func monthPeriod(now time.Time) (from, to time.Time) {
+	now = now.UTC()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// ===== Meter =====
+
+// UsageMeter records the token usage of every LLM and embedding call and enforces an
+// optional monthly per-user token cap. Providers are wrapped with Provider/Embeddings; the
+// user comes from WithUsageUser on the call's context.
+type UsageMeter struct {
+	repo       *repository.LLMUsageRepository
+	monthlyCap int64 // 0 means unlimited
+}
+
+// NewUsageMeter creates a meter; monthlyCap <= 0 disables the cap
+func NewUsageMeter(repo *repository.LLMUsageRepository, monthlyCap int64) *UsageMeter {
+	if monthlyCap < 0 {
+		monthlyCap = 0
+	}
+	return &UsageMeter{repo: repo, monthlyCap: monthlyCap}
+}
+
+// Summary returns userID's usage for the current month
+func (m *UsageMeter) Summary(ctx context.Context, userID string) (*models.LLMUsageSummary, error) {
+	from, to := monthPeriod(time.Now())
+	ops, err := m.repo.TotalsByOperation(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return summarizeUsage(from, to, ops, m.monthlyCap), nil
+}
+
+// summarizeUsage adds up the per-operation totals of a period
+func summarizeUsage(from, to time.Time, ops []models.OperationUsage, monthlyCap int64) *models.LLMUsageSummary {
+	s := &models.LLMUsageSummary{
+		Month:       from.Format("2006-01"),
+		PeriodStart: from,
+		PeriodEnd:   to,
+		Operations:  ops,
+	}
+	if s.Operations == nil {
+		s.Operations = []models.OperationUsage{}
+	}
+	sort.SliceStable(s.Operations, func(i, j int) bool {
+		return s.Operations[i].TotalTokens > s.Operations[j].TotalTokens
+	})
+	for _, op := range s.Operations {
+		s.Calls += op.Calls
+		s.PromptTokens += op.PromptTokens
+		s.CompletionTokens += op.CompletionTokens
+		s.TotalTokens += op.TotalTokens
+		s.CostEstimate += op.CostEstimate
+	}
+	if monthlyCap > 0 {
+		s.TokenCap = monthlyCap
+		remaining := monthlyCap - s.TotalTokens
+		if remaining < 0 {
+			remaining = 0
+		}
+		s.RemainingTokens = &remaining
+	}
+	return s
+}
+
+// Check returns a *UsageCapError when userID has reached the monthly cap
+func (m *UsageMeter) Check(ctx context.Context, userID string) error {
+	if m.monthlyCap == 0 || userID == "" {
+		return nil
+	}
+	from, to := monthPeriod(time.Now())
+	used, err := m.repo.TotalTokens(ctx, userID, from, to)
+	if err != nil {
+		return err
+	}
+	if used < m.monthlyCap {
+		return nil
+	}
+	summary, err := m.Summary(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return &UsageCapError{Summary: summary}
+}
+
+// call runs fn with a token sink and records what the provider reported. Calls on behalf of
+// a user at their cap are refused.
+func (m *UsageMeter) call(ctx context.Context, provider, model, defaultOperation string, fn func(ctx context.Context) error) error {
+	scope := usageScopeFrom(ctx)
+	if err := m.Check(ctx, scope.userID); err != nil {
+		return err
+	}
+
+	used := &tokenUsage{}
+	err := fn(context.WithValue(ctx, tokenSinkKey{}, used))
+	if used.prompt == 0 && used.completion == 0 {
+		return err
+	}
+
+	operation := scope.operation
+	if operation == "" {
+		operation = defaultOperation
+	}
+	record := &models.LLMUsage{
+		UserID:           scope.userID,
+		Provider:         provider,
+		Model:            model,
+		Operation:        operation,
+		PromptTokens:     used.prompt,
+		CompletionTokens: used.completion,
+		CostEstimate:     EstimateCost(model, used.prompt, used.completion),
+		Timestamp:        time.Now(),
+	}
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usageRecordTimeout)
+	defer cancel()
+	if rerr := m.repo.Insert(recordCtx, record); rerr != nil {
+		log.Printf("llm usage: failed to record %s call: %v", operation, rerr)
+	}
+	return err
+}
+
+// Provider wraps p so its calls are metered; nil stays nil so callers keep their local fallback
+func (m *UsageMeter) Provider(p LLMProvider) LLMProvider {
+	if p == nil {
+		return nil
+	}
+	return &meteredProvider{LLMProvider: p, meter: m}
+}
+
+type meteredProvider struct {
+	LLMProvider
+	meter *UsageMeter
+}
+
+func (p *meteredProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	var out string
+	err := p.meter.call(ctx, p.Name(), p.Model(), "other", func(ctx context.Context) error {
+		var err error
+		out, err = p.LLMProvider.Generate(ctx, req)
+		return err
+	})
+	return out, err
+}
+
+// Embeddings wraps e so its calls are metered. Gemini's embedContent reports no usage, so
+// only OpenAI embeddings show up in the records.
+func (m *UsageMeter) Embeddings(e EmbeddingService, provider, model string) EmbeddingService {
+	return &meteredEmbeddings{EmbeddingService: e, meter: m, provider: provider, model: model}
+}
+
+type meteredEmbeddings struct {
+	EmbeddingService
+	meter    *UsageMeter
+	provider string
+	model    string
+}
+
+func (e *meteredEmbeddings) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	var out []float32
+	err := e.meter.call(ctx, e.provider, e.model, "embedding", func(ctx context.Context) error {
+		var err error
+		out, err = e.EmbeddingService.GenerateEmbedding(ctx, text)
+		return err
+	})
+	return out, err
+}
+
+func (e *meteredEmbeddings) BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	var out [][]float32
+	err := e.meter.call(ctx, e.provider, e.model, "embedding", func(ctx context.Context) error {
+		var err error
+		out, err = e.EmbeddingService.BatchGenerateEmbeddings(ctx, texts)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		model              string
+		prompt, completion int
+		want               float64
+	}{
+		{"gpt-3.5-turbo", 1_000_000, 1_000_000, 2.00},
+		{"gpt-4o", 2000, 500, (2000*2.50 + 500*10.00) / 1e6},
+		// the longest prefix wins: gpt-4o-mini is not priced as gpt-4o
+		{"gpt-4o-mini-2024-07-18", 1_000_000, 0, 0.15},
+		{"GPT-4.1-mini", 0, 1_000_000, 1.60},
+		{"claude-3-haiku-20240307", 400, 100, (400*0.25 + 100*1.25) / 1e6},
+		{"text-embedding-3-small", 1_000_000, 0, 0.02},
+		{"my-local-model", 1_000_000, 1_000_000, 0},
+		{"gpt-4o", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateCost(tt.model, tt.prompt, tt.completion); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("EstimateCost(%q, %d, %d) = %v, want %v", tt.model, tt.prompt, tt.completion, got, tt.want)
+		}
+	}
+}
+
+func TestMonthPeriod(t *testing.T) {
+	hcm := time.FixedZone("ICT", 7*3600)
+	tests := []struct {
+		now      time.Time
+		from, to string
+	}{
+		{time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC), "2024-03-01", "2024-04-01"},
+		{time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC), "2024-12-01", "2025-01-01"},
+		// 1 March 05:00 in Ho Chi Minh City is still February in UTC
+		{time.Date(2024, 3, 1, 5, 0, 0, 0, hcm), "2024-02-01", "2024-03-01"},
+	}
+	for _, tt := range tests {
+		from, to := monthPeriod(tt.now)
+		if from.Format("2006-01-02") != tt.from || to.Format("2006-01-02") != tt.to || from.Location() != time.UTC {
+			t.Errorf("monthPeriod(%v) = %v, %v, want %s, %s in UTC", tt.now, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestSummarizeUsage(t *testing.T) {
+	from, to := monthPeriod(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC))
+	ops := []models.OperationUsage{
+		{Operation: "summary", Calls: 10, PromptTokens: 3000, CompletionTokens: 500, TotalTokens: 3500, CostEstimate: 0.002},
+		{Operation: "compose", Calls: 2, PromptTokens: 4000, CompletionTokens: 1500, TotalTokens: 5500, CostEstimate: 0.004},
+		{Operation: "embedding", Calls: 5, PromptTokens: 1000, TotalTokens: 1000, CostEstimate: 0.0001},
+	}
+
+	s := summarizeUsage(from, to, ops, 0)
+	if s.Month != "2024-03" || s.Calls != 17 || s.PromptTokens != 8000 || s.CompletionTokens != 2000 || s.TotalTokens != 10000 {
+		t.Errorf("summary = %+v", s)
+	}
+	if math.Abs(s.CostEstimate-0.0061) > 1e-12 {
+		t.Errorf("CostEstimate = %v, want 0.0061", s.CostEstimate)
+	}
+	if s.Operations[0].Operation != "compose" || s.Operations[1].Operation != "summary" || s.Operations[2].Operation != "embedding" {
+		t.Errorf("operations not sorted by tokens: %+v", s.Operations)
+	}
+	if s.TokenCap != 0 || s.RemainingTokens != nil {
+		t.Errorf("uncapped summary has cap %d, remaining %v", s.TokenCap, s.RemainingTokens)
+	}
+
+	if s := summarizeUsage(from, to, ops, 12000); s.TokenCap != 12000 || s.RemainingTokens == nil || *s.RemainingTokens != 2000 {
+		t.Errorf("capped summary = cap %d, remaining %v, want 12000 and 2000", s.TokenCap, s.RemainingTokens)
+	}
+	if s := summarizeUsage(from, to, ops, 8000); s.RemainingTokens == nil || *s.RemainingTokens != 0 {
+		t.Errorf("over-cap remaining = %v, want 0", s.RemainingTokens)
+	}
+	if s := summarizeUsage(from, to, nil, 0); s.Operations == nil || s.TotalTokens != 0 {
+		t.Errorf("empty summary = %+v, want an empty operations list", s)
+	}
+}
+
+// tokenLLM reports fixed token usage for each call, like a provider's usage block
+type tokenLLM struct {
+	stubLLM
+	prompt, completion int
+}
+
+func (p *tokenLLM) Model() string { return "gpt-4o-mini" }
+
+func (p *tokenLLM) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	reportTokens(ctx, p.prompt, p.completion)
+	return p.stubLLM.Generate(ctx, req)
+}
+
+func TestUsageMeterRecordsAndCaps(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	repo := repository.NewLLMUsageRepository(db)
+	inner := &tokenLLM{stubLLM: stubLLM{reply: "ok"}, prompt: 600, completion: 100}
+	meter := NewUsageMeter(repo, 1500)
+	llm := meter.Provider(inner)
+
+	userCtx := WithUsageUser(ctx, "u1")
+	for i := 0; i < 3; i++ {
+		// 700 tokens a call: the cap is checked before each call, so the third still runs
+		if _, err := llm.Generate(withOperation(userCtx, "summary"), LLMRequest{}); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	_, err := llm.Generate(withOperation(userCtx, "summary"), LLMRequest{})
+	var capErr *UsageCapError
+	if !errors.As(err, &capErr) {
+		t.Fatalf("call over the cap = %v, want *UsageCapError", err)
+	}
+	if n := inner.calls.Load(); n != 3 {
+		t.Errorf("provider calls = %d, want 3: capped calls must not reach it", n)
+	}
+	if s := capErr.Summary; s.TotalTokens != 2100 || s.TokenCap != 1500 || *s.RemainingTokens != 0 || s.Calls != 3 {
+		t.Errorf("cap summary = %+v", s)
+	}
+	if resp := capErr.Response(); resp.Error != "token_cap_reached" || resp.Usage != capErr.Summary {
+		t.Errorf("402 body = %+v", resp)
+	}
+
+	var record models.LLMUsage
+	if err := db.Collection("llm_usage").FindOne(ctx, bson.M{"userId": "u1"}).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Provider != "stub" || record.Model != "gpt-4o-mini" || record.Operation != "summary" ||
+		record.PromptTokens != 600 || record.CompletionTokens != 100 ||
+		math.Abs(record.CostEstimate-EstimateCost("gpt-4o-mini", 600, 100)) > 1e-12 {
+		t.Errorf("record = %+v", record)
+	}
+
+	// Other users, and work not done for a user, are not capped
+	if _, err := llm.Generate(WithUsageUser(ctx, "u2"), LLMRequest{}); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+	if _, err := llm.Generate(ctx, LLMRequest{}); err != nil {
+		t.Errorf("no user: %v", err)
+	}
+	n, err := db.Collection("llm_usage").CountDocuments(ctx, bson.M{"userId": "u2", "operation": "other"})
+	if err != nil || n != 1 {
+		t.Errorf("u2 records = %d (err %v), want one under the default operation", n, err)
+	}
+}
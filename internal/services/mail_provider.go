@@ -0,0 +1,70 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"fmt"
+)
+
+// MailProviderGmail is the provider of accounts linked through Google OAuth; it is also
+// assumed for users stored before the provider was recorded
+const MailProviderGmail = "gmail"
+
+// MailProvider is the mailbox backend of a linked account. GmailService is the only
+// implementation today; an Outlook (Graph) or IMAP backend registers under its own name.
+type MailProvider interface {
+	ListMailboxes(ctx context.Context, user *models.User) ([]models.Mailbox, error)
+	ListEmails(ctx context.Context, user *models.User, mailboxID string, page int, perPage int, unreadOnly bool, hasAttachmentsOnly bool, sortBy string, sortOrder string) (*EmailPage, error)
+	GetEmail(ctx context.Context, user *models.User, emailID string) (*models.Email, error)
+	SendEmail(ctx context.Context, user *models.User, email *models.Email) error
+	ModifyEmail(ctx context.Context, user *models.User, emailID string, addLabels, removeLabels []string) error
+	// ModifyEmailsBatch changes the labels of many messages at once, reporting each chunk the
+	// provider's batch limit splits them into
+	ModifyEmailsBatch(ctx context.Context, user *models.User, emailIDs []string, addLabels, removeLabels []string) ([]ModifyChunkResult, error)
+	// ListMessageIDs returns up to limit IDs of the messages in mailboxID, and whether more remain
+	ListMessageIDs(ctx context.Context, user *models.User, mailboxID string, unreadOnly bool, limit int) ([]string, bool, error)
+	GetAttachment(ctx context.Context, user *models.User, messageID, attachmentID string) ([]byte, error)
+	GetLabels(ctx context.Context, user *models.User) ([]models.GmailLabel, error)
+	// SearchEmails returns a page of matches, the next page token and the estimated total
+	SearchEmails(ctx context.Context, user *models.User, query string, pageToken string) ([]*models.Email, string, int, error)
+}
+
+var _ MailProvider = (*GmailService)(nil)
+
+// UnsupportedMailProviderError is returned for accounts linked to a provider no
+// implementation is registered for
+type UnsupportedMailProviderError struct {
+	Provider string
+}
+
+func (e *UnsupportedMailProviderError) Error() string {
+	return fmt.Sprintf("mail provider %q is not supported", e.Provider)
+}
+
+// MailProviders selects the MailProvider of a user's linked account
+type MailProviders struct {
+	providers map[string]MailProvider
+}
+
+// NewMailProviders creates the registry with gmail registered
+func NewMailProviders(gmail *GmailService) *MailProviders {
+	return &MailProviders{providers: map[string]MailProvider{MailProviderGmail: gmail}}
+}
+
+// Register adds or replaces the implementation for provider
+func (p *MailProviders) Register(provider string, impl MailProvider) {
+	p.providers[provider] = impl
+}
+
+// For returns the provider of user's linked account
+func (p *MailProviders) For(user *models.User) (MailProvider, error) {
+	name := user.MailProvider
+	if name == "" {
+		name = MailProviderGmail
+	}
+	impl, ok := p.providers[name]
+	if !ok {
+		return nil, &UnsupportedMailProviderError{Provider: name}
+	}
+	return impl, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Placeholders a summary prompt template may use
+var promptPlaceholders = map[string]string{
+	"body":     "the email text, HTML stripped",
+	"subject":  "the email subject",
+	"sender":   `the sender as "Name <address>"`,
+	"language": "the summary language, e.g. English",
+	"length":   "the length instruction of the requested summary length",
+}
+
+var promptPlaceholderRE = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.]+)\s*\}\}`)
+
+// defaultPromptTemplate is seeded as the default template; it says the same as the built-in
+// prompt of buildSummaryPrompt
+var defaultPromptTemplate = models.PromptTemplate{
+	Name:   "Default",
+	System: "You are a concise email summarizer. Always answer in {{language}}, regardless of the email's language.",
+	Prompt: "Summarize this email {{length}}. Write the summary in {{language}}:\n\n{{body}}",
+}
+
+// PromptTemplateError lists what is wrong with a template
+type PromptTemplateError struct {
+	Unknown     []string // placeholders that aren't in promptPlaceholders
+	MissingBody bool     // the prompt never includes the email
+}
+
+func (e *PromptTemplateError) Error() string {
+	var problems []string
+	if len(e.Unknown) > 0 {
+		known := make([]string, 0, len(promptPlaceholders))
+		for name := range promptPlaceholders {
+			known = append(known, "{{"+name+"}}")
+		}
+		sort.Strings(known)
+		problems = append(problems, fmt.Sprintf("unknown placeholder(s) %s (use %s)", strings.Join(e.Unknown, ", "), strings.Join(known, ", ")))
+	}
+	if e.MissingBody {
+		problems = append(problems, "the prompt must contain {{body}}")
+	}
+	return strings.Join(problems, "; ")
+}
+
+// ValidatePromptTemplate checks the placeholders of a system prompt and prompt pair
+func ValidatePromptTemplate(system, prompt string) error {
+	e := &PromptTemplateError{Unknown: unknownPlaceholders(system + "\n" + prompt)}
+	e.MissingBody = !usesPlaceholder(prompt, "body")
+	if len(e.Unknown) > 0 || e.MissingBody {
+		return e
+	}
+	return nil
+}
+
+func unknownPlaceholders(text string) []string {
+	var unknown []string
+	seen := map[string]bool{}
+	for _, m := range promptPlaceholderRE.FindAllStringSubmatch(text, -1) {
+		if _, ok := promptPlaceholders[m[1]]; !ok && !seen[m[1]] {
+			seen[m[1]] = true
+			unknown = append(unknown, "{{"+m[1]+"}}")
+		}
+	}
+	return unknown
+}
+
+func usesPlaceholder(text, name string) bool {
+	for _, m := range promptPlaceholderRE.FindAllStringSubmatch(text, -1) {
+		if m[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPromptTemplate replaces the placeholders of text with vars. Unknown placeholders are
+// an error rather than being sent to the model verbatim.
+func RenderPromptTemplate(text string, vars map[string]string) (string, error) {
+	if unknown := unknownPlaceholders(text); len(unknown) > 0 {
+		return "", &PromptTemplateError{Unknown: unknown}
+	}
+	return promptPlaceholderRE.ReplaceAllStringFunc(text, func(m string) string {
+		return vars[promptPlaceholderRE.FindStringSubmatch(m)[1]]
+	}), nil
+}
+
+// summaryEmail is what a template may say about the email besides its body
+type summaryEmail struct {
+	userID  string
+	subject string
+	sender  models.EmailAddress
+}
+
+// renderSummaryTemplate builds the provider request from tpl for the (resolved) options
+func renderSummaryTemplate(tpl *models.PromptTemplate, text string, email summaryEmail, o SummaryOptions) (LLMRequest, error) {
+	spec := summaryLengths[o.Length]
+	sender := email.sender.Email
+	if email.sender.Name != "" {
+		sender = fmt.Sprintf("%s <%s>", email.sender.Name, email.sender.Email)
+	}
+	vars := map[string]string{
+		"body":     text,
+		"subject":  email.subject,
+		"sender":   sender,
+		"language": summaryLanguageNames[o.Language],
+		"length":   spec.instruction,
+	}
+	system, err := RenderPromptTemplate(tpl.System, vars)
+	if err != nil {
+		return LLMRequest{}, err
+	}
+	prompt, err := RenderPromptTemplate(tpl.Prompt, vars)
+	if err != nil {
+		return LLMRequest{}, err
+	}
+	return LLMRequest{System: system, Prompt: prompt, MaxTokens: spec.maxTokens, Temperature: 0.2}, nil
+}
+
+// ===== Store =====
+
+// promptTemplateTTL bounds how long another instance's edits can go unnoticed; edits made
+// through this instance invalidate right away
+const promptTemplateTTL = 5 * time.Minute
+
+type promptTemplateEntry struct {
+	tpl       *models.PromptTemplate // nil: neither an active template nor a default
+	expiresAt time.Time
+}
+
+// PromptTemplateStore resolves the template each user's summaries are generated with, caching
+// the result in memory
+type PromptTemplateStore struct {
+	repo  *repository.PromptTemplateRepository
+	mu    sync.Mutex
+	items map[string]promptTemplateEntry
+}
+
+// NewPromptTemplateStore creates the store and seeds the default template
+func NewPromptTemplateStore(repo *repository.PromptTemplateRepository) *PromptTemplateStore {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := repo.EnsureDefault(ctx, &defaultPromptTemplate); err != nil {
+		fmt.Printf("failed to seed the default prompt template: %v\n", err)
+	}
+	return &PromptTemplateStore{repo: repo, items: make(map[string]promptTemplateEntry)}
+}
+
+// Active returns userID's active template or the default; nil means the built-in prompt.
+// Lookup errors are logged and not cached.
+func (s *PromptTemplateStore) Active(ctx context.Context, userID string) *models.PromptTemplate {
+	s.mu.Lock()
+	if entry, ok := s.items[userID]; ok && time.Now().Before(entry.expiresAt) {
+		s.mu.Unlock()
+		return entry.tpl
+	}
+	s.mu.Unlock()
+
+	tpl, err := s.repo.Active(ctx, userID)
+	if err != nil {
+		fmt.Printf("prompt template lookup failed, using the built-in prompt: %v\n", err)
+		return nil
+	}
+	s.mu.Lock()
+	s.items[userID] = promptTemplateEntry{tpl: tpl, expiresAt: time.Now().Add(promptTemplateTTL)}
+	s.mu.Unlock()
+	return tpl
+}
+
+// Invalidate drops the cached template of userID
+func (s *PromptTemplateStore) Invalidate(userID string) {
+	s.mu.Lock()
+	delete(s.items, userID)
+	s.mu.Unlock()
+}
+
+// InvalidateAll drops every cached template; the default is shared by all users
+func (s *PromptTemplateStore) InvalidateAll() {
+	s.mu.Lock()
+	s.items = make(map[string]promptTemplateEntry)
+	s.mu.Unlock()
+}
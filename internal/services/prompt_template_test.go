@@ -0,0 +1,155 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidatePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		system      string
+		prompt      string
+		wantUnknown []string
+		wantNoBody  bool
+	}{
+		{"default", defaultPromptTemplate.System, defaultPromptTemplate.Prompt, nil, false},
+		{"spaces inside braces", "", "Summarize {{ subject }} from {{sender}}:\n{{  body }}", nil, false},
+		{"body only in the system prompt", "Email: {{body}}", "Summarize it", nil, true},
+		{"unknown placeholders, reported once each", "{{tone}}", "{{body}} {{user.name}} {{tone}}", []string{"{{tone}}", "{{user.name}}"}, false},
+		{"both problems", "", "Summarize {{Body}}", []string{"{{Body}}"}, true},
+		{"single braces are text", "", "{body} {{body}}", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePromptTemplate(tt.system, tt.prompt)
+			if tt.wantUnknown == nil && !tt.wantNoBody {
+				if err != nil {
+					t.Errorf("error = %v, want none", err)
+				}
+				return
+			}
+			var tplErr *PromptTemplateError
+			if !errors.As(err, &tplErr) {
+				t.Fatalf("error = %v, want *PromptTemplateError", err)
+			}
+			if !reflect.DeepEqual(tplErr.Unknown, tt.wantUnknown) || tplErr.MissingBody != tt.wantNoBody {
+				t.Errorf("error = %+v, want unknown %v, missing body %v", tplErr, tt.wantUnknown, tt.wantNoBody)
+			}
+		})
+	}
+
+	err := ValidatePromptTemplate("", "{{tone}}")
+	want := "unknown placeholder(s) {{tone}} (use {{body}}, {{language}}, {{length}}, {{sender}}, {{subject}}); the prompt must contain {{body}}"
+	if err == nil || err.Error() != want {
+		t.Errorf("message = %v, want %q", err, want)
+	}
+}
+
+func TestRenderPromptTemplate(t *testing.T) {
+	got, err := RenderPromptTemplate("From {{sender}}: {{ subject }} / {{subject}} {{language}}", map[string]string{
+		"sender":  "Ann <ann@x.com>",
+		"subject": "Hi {{body}}", // values are not expanded again
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "From Ann <ann@x.com>: Hi {{body}} / Hi {{body}} "; got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+	if _, err := RenderPromptTemplate("{{body}} {{tone}}", nil); err == nil {
+		t.Error("unknown placeholder rendered")
+	}
+}
+
+func TestRenderSummaryTemplate(t *testing.T) {
+	const body = "The contract renewal is due next Monday."
+	opts := SummaryOptions{Language: SummaryLanguageVI, Length: SummaryLengthMedium}
+
+	// The seeded default asks the same as the built-in prompt
+	got, err := renderSummaryTemplate(&defaultPromptTemplate, body, summaryEmail{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := buildSummaryPrompt(body, opts); got != want {
+		t.Errorf("default template = %+v, built-in prompt = %+v", got, want)
+	}
+
+	tpl := &models.PromptTemplate{Prompt: "{{sender}} wrote about {{subject}}. Summarize {{length}}:\n{{body}}"}
+	email := summaryEmail{subject: "Renewal", sender: models.EmailAddress{Name: "Ann", Email: "ann@x.com"}}
+	got, err = renderSummaryTemplate(tpl, body, email, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Ann <ann@x.com> wrote about Renewal. Summarize " + summaryLengths[SummaryLengthMedium].instruction + ":\n" + body
+	if got.Prompt != want || got.System != "" || got.MaxTokens != summaryLengths[SummaryLengthMedium].maxTokens {
+		t.Errorf("request = %+v, want prompt %q", got, want)
+	}
+
+	email.sender.Name = ""
+	if got, _ := renderSummaryTemplate(tpl, body, email, opts); !strings.HasPrefix(got.Prompt, "ann@x.com wrote") {
+		t.Errorf("sender without a name rendered as %q", got.Prompt)
+	}
+}
+
+func TestSummaryPromptFallsBackToDefault(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	repo := repository.NewPromptTemplateRepository(db)
+	store := NewPromptTemplateStore(repo)
+	s := NewSummaryService(nil, nil, nil, nil, &stubLLM{reply: "ok"}, store).(*LocalSummaryService)
+
+	const body = "The contract renewal is due next Monday."
+	opts := SummaryOptions{Language: SummaryLanguageEN, Length: SummaryLengthShort}
+	builtin := buildSummaryPrompt(body, opts)
+	prompt := func(userID string) (LLMRequest, bool) {
+		return s.summaryPrompt(ctx, body, summaryEmail{userID: userID, subject: "Renewal"}, opts)
+	}
+
+	// Without a template of their own users get the seeded default
+	if req, templated := prompt("u1"); !templated || req != builtin {
+		t.Errorf("default: templated %v, request %+v", templated, req)
+	}
+
+	custom := &models.PromptTemplate{UserID: "u1", Name: "Terse", Prompt: "TL;DR of {{subject}}: {{body}}", Active: true}
+	if err := repo.Create(ctx, custom); err != nil {
+		t.Fatal(err)
+	}
+	store.Invalidate("u1")
+	if req, templated := prompt("u1"); !templated || req.Prompt != "TL;DR of Renewal: "+body {
+		t.Errorf("active template: templated %v, prompt %q", templated, req.Prompt)
+	}
+	if req, _ := prompt("u2"); req != builtin {
+		t.Errorf("another user's template was used: %+v", req)
+	}
+
+	if err := repo.Deactivate(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	store.Invalidate("u1")
+	if req, templated := prompt("u1"); !templated || req != builtin {
+		t.Errorf("after deactivating: templated %v, request %+v", templated, req)
+	}
+
+	// A stored template that no longer renders falls back to the built-in prompt
+	broken := &models.PromptTemplate{UserID: "u1", Name: "Old", Prompt: "{{body}} in a {{tone}} tone", Active: true}
+	if err := repo.Create(ctx, broken); err != nil {
+		t.Fatal(err)
+	}
+	store.Invalidate("u1")
+	if req, templated := prompt("u1"); templated || req != builtin {
+		t.Errorf("broken template: templated %v, request %+v", templated, req)
+	}
+
+	// Without a provider templates are never looked up
+	plain := NewSummaryService(nil, nil, nil, nil, nil, store).(*LocalSummaryService)
+	if _, templated := plain.summaryPrompt(ctx, body, summaryEmail{userID: "u1"}, opts); templated {
+		t.Error("template used without a provider")
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// pushRecordSize is the aes128gcm record size; the whole payload goes in one record
+	pushRecordSize = 4096
+	// pushMaxPayload keeps the encrypted body within the 4096 bytes push services accept
+	pushMaxPayload = pushRecordSize - 16 - 1 - 86
+	// pushVAPIDLifetime is how long a VAPID token is valid (push services allow up to 24h)
+	pushVAPIDLifetime = 12 * time.Hour
+)
+
+// ErrInvalidPushSubscription is returned for subscriptions push messages can't be sent to
+var ErrInvalidPushSubscription = errors.New("invalid push subscription")
+
+// PushService sends Web Push messages (RFC 8030) to users' browsers. Payloads are encrypted
+// with aes128gcm (RFC 8291) and requests carry a VAPID signature (RFC 8292). Subscriptions
+// the push service reports as gone are deleted.
+type PushService struct {
+	subs      *repository.PushSubscriptionRepository
+	key       *ecdsa.PrivateKey
+	publicKey string // base64url, the browser's applicationServerKey
+	subject   string
+	ttl       time.Duration
+	client    *http.Client
+}
+
+// NewPushService creates the push service from the VAPID settings. It returns nil (push
+// disabled) when no key pair is configured and an error when the keys are malformed.
+func NewPushService(cfg *config.Config, subs *repository.PushSubscriptionRepository) (*PushService, error) {
+	if !cfg.WebPushConfigured() {
+		return nil, nil
+	}
+	raw, err := decodePushKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	public, err := decodePushKey(cfg.VAPIDPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID_PUBLIC_KEY: %w", err)
+	}
+	derived, err := key.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(public, derived) {
+		return nil, errors.New("VAPID_PUBLIC_KEY does not match VAPID_PRIVATE_KEY")
+	}
+	return &PushService{
+		subs:      subs,
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(derived),
+		subject:   cfg.VAPIDSubject,
+		ttl:       cfg.WebPushTTL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (s *PushService) PublicKey() string {
+	return s.publicKey
+}
+
+// ValidateSubscription checks that messages can be encrypted for sub and sent to its endpoint
+func ValidateSubscription(sub *models.PushSubscription) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: endpoint must be an https URL", ErrInvalidPushSubscription)
+	}
+	public, err := decodePushKey(sub.Keys.P256dh)
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(public)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: p256dh is not a P-256 public key", ErrInvalidPushSubscription)
+	}
+	if auth, err := decodePushKey(sub.Keys.Auth); err != nil || len(auth) != 16 {
+		return fmt.Errorf("%w: auth must be 16 bytes", ErrInvalidPushSubscription)
+	}
+	return nil
+}
+
+// Notify sends msg to every browser userID subscribed. Failures are logged: a missed push
+// doesn't affect the change it reports. A nil service does nothing.
+func (s *PushService) Notify(ctx context.Context, userID string, msg models.PushMessage) {
+	if s == nil {
+		return
+	}
+	subs, err := s.subs.ListByUser(ctx, userID)
+	if err != nil {
+		log.Println("push: failed to load subscriptions:", err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("push: failed to encode message:", err)
+		return
+	}
+	for i := range subs {
+		sub := &subs[i]
+		status, err := s.send(ctx, sub, payload)
+		switch {
+		case status == http.StatusNotFound || status == http.StatusGone:
+			// The browser unsubscribed or the subscription expired
+			if err := s.subs.DeleteByEndpoint(ctx, sub.Endpoint); err != nil {
+				log.Println("push: failed to prune subscription:", err)
+			}
+		case err != nil:
+			log.Printf("push: failed to notify user %s: %v", userID, err)
+		}
+	}
+}
+
+// send posts one encrypted message and returns the push service's status code
+func (s *PushService) send(ctx context.Context, sub *models.PushSubscription, payload []byte) (int, error) {
+	if len(payload) > pushMaxPayload {
+		return 0, fmt.Errorf("payload of %d bytes exceeds %d", len(payload), pushMaxPayload)
+	}
+	body, err := encryptPushPayload(sub.Keys, payload)
+	if err != nil {
+		return 0, err
+	}
+	token, err := s.vapidToken(sub.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.publicKey)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("push service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return resp.StatusCode, nil
+}
+
+// vapidToken signs the ES256 JWT that identifies this server to the endpoint's push service
+func (s *PushService) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(pushVAPIDLifetime).Unix(),
+		"sub": s.subject,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(s.key)
+}
+
+// encryptPushPayload encrypts payload for the browser holding keys as a single aes128gcm
+// record (RFC 8291 section 3, RFC 8188 section 2)
+func encryptPushPayload(keys models.PushSubscriptionKeys, payload []byte) ([]byte, error) {
+	uaPublicRaw, err := decodePushKey(keys.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodePushKey(keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, err
+	}
+	// A fresh key pair and salt per message
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	shared, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicRaw) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, shared, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID (the sender's public key)
+	out := make([]byte, 0, 16+4+1+len(asPublic)+len(payload)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, pushRecordSize)
+	out = append(out, byte(len(asPublic)))
+	out = append(out, asPublic...)
+	// 0x02 marks the last (and only) record, without further padding
+	record := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(out, nonce, record, nil), nil
+}
+
+// decodePushKey decodes a base64url key, with or without padding
+func decodePushKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pushBrowser is the receiving side of a subscription: it holds the keys a real browser
+// would and decrypts what the push service delivers
+type pushBrowser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newPushBrowser(t *testing.T) *pushBrowser {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &pushBrowser{key: key, auth: auth}
+}
+
+func (b *pushBrowser) keys() models.PushSubscriptionKeys {
+	return models.PushSubscriptionKeys{
+		P256dh: base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+		Auth:   base64.RawURLEncoding.EncodeToString(b.auth),
+	}
+}
+
+// decrypt opens a single-record aes128gcm body (RFC 8291)
+func (b *pushBrowser) decrypt(body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("body too short")
+	}
+	salt, idLen := body[:16], int(body[20])
+	if binary.BigEndian.Uint32(body[16:20]) != pushRecordSize || len(body) < 21+idLen {
+		return nil, errors.New("bad header")
+	}
+	senderRaw, ciphertext := body[21:21+idLen], body[21+idLen:]
+	sender, err := ecdh.P256().NewPublicKey(senderRaw)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := b.key.ECDH(sender)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Key(sha256.New, shared, b.auth, "WebPush: info\x00"+string(b.key.PublicKey().Bytes())+string(senderRaw), 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 || record[len(record)-1] != 0x02 {
+		return nil, errors.New("missing last-record delimiter")
+	}
+	return record[:len(record)-1], nil
+}
+
+// newTestPushService creates a push service with a fresh VAPID key pair whose requests go
+// through client
+func newTestPushService(t *testing.T, subs *repository.PushSubscriptionRepository, client *http.Client) *PushService {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := key.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewPushService(&config.Config{
+		VAPIDPrivateKey: base64.RawURLEncoding.EncodeToString(private),
+		VAPIDPublicKey:  base64.RawURLEncoding.EncodeToString(public) + "=", // padding is accepted
+		VAPIDSubject:    "mailto:ops@example.com",
+		WebPushTTL:      time.Hour,
+	}, subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client = client
+	return s
+}
+
+// pushDelivery is one request a stubbed push endpoint received
+type pushDelivery struct {
+	path    string
+	header  http.Header
+	payload []byte
+	err     error
+}
+
+// stubPushEndpoint answers each path with its status; unknown paths get 201 Created
+func stubPushEndpoint(t *testing.T, browser *pushBrowser, statuses map[string]int) (*httptest.Server, func() []pushDelivery) {
+	var mu sync.Mutex
+	var got []pushDelivery
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payload, err := browser.decrypt(body)
+		mu.Lock()
+		got = append(got, pushDelivery{path: r.URL.Path, header: r.Header, payload: payload, err: err})
+		mu.Unlock()
+		status, ok := statuses[r.URL.Path]
+		if !ok {
+			status = http.StatusCreated
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []pushDelivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(got)
+	}
+}
+
+func TestPushSendEncryptsAndSigns(t *testing.T) {
+	browser := newPushBrowser(t)
+	srv, deliveries := stubPushEndpoint(t, browser, nil)
+	s := newTestPushService(t, nil, srv.Client())
+
+	sub := &models.PushSubscription{Endpoint: srv.URL + "/push/abc", Keys: browser.keys()}
+	payload := []byte(`{"type":"snooze_returned","title":"A snoozed email is back"}`)
+	if status, err := s.send(context.Background(), sub, payload); err != nil || status != http.StatusCreated {
+		t.Fatalf("send = %d, %v", status, err)
+	}
+
+	got := deliveries()
+	if len(got) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(got))
+	}
+	d := got[0]
+	if d.err != nil || string(d.payload) != string(payload) {
+		t.Fatalf("browser decrypted %q (err %v), want %q", d.payload, d.err, payload)
+	}
+	for name, want := range map[string]string{"Content-Encoding": "aes128gcm", "TTL": "3600", "Urgency": "high"} {
+		if v := d.header.Get(name); v != want {
+			t.Errorf("%s = %q, want %q", name, v, want)
+		}
+	}
+
+	// Authorization: vapid t=<JWT>, k=<public key>, signed with the VAPID key for the endpoint's origin
+	auth := strings.TrimPrefix(d.header.Get("Authorization"), "vapid ")
+	token, key, ok := strings.Cut(auth, ", k=")
+	token = strings.TrimPrefix(token, "t=")
+	if !ok || key != s.PublicKey() {
+		t.Fatalf("Authorization = %q", d.header.Get("Authorization"))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return &s.key.PublicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(srv.URL), jwt.WithExpirationRequired()); err != nil {
+		t.Fatalf("VAPID token: %v", err)
+	}
+	if claims["sub"] != "mailto:ops@example.com" {
+		t.Errorf("sub = %v", claims["sub"])
+	}
+
+	if _, err := s.send(context.Background(), sub, make([]byte, pushMaxPayload+1)); err == nil {
+		t.Error("send accepted a payload over the limit")
+	}
+}
+
+func TestNewPushServiceKeys(t *testing.T) {
+	if s, err := NewPushService(&config.Config{}, nil); s != nil || err != nil {
+		t.Errorf("without keys = %v, %v; want push disabled", s, err)
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	private, _ := key.Bytes()
+	mismatched, _ := other.PublicKey.Bytes()
+	if _, err := NewPushService(&config.Config{
+		VAPIDPrivateKey: base64.RawURLEncoding.EncodeToString(private),
+		VAPIDPublicKey:  base64.RawURLEncoding.EncodeToString(mismatched),
+	}, nil); err == nil {
+		t.Error("accepted a public key of another key pair")
+	}
+}
+
+func TestValidateSubscription(t *testing.T) {
+	keys := newPushBrowser(t).keys()
+	tests := []struct {
+		name string
+		sub  models.PushSubscription
+		ok   bool
+	}{
+		{"valid", models.PushSubscription{Endpoint: "https://push.example.com/abc", Keys: keys}, true},
+		{"http endpoint", models.PushSubscription{Endpoint: "http://push.example.com/abc", Keys: keys}, false},
+		{"bad p256dh", models.PushSubscription{Endpoint: "https://push.example.com/abc", Keys: models.PushSubscriptionKeys{P256dh: "AAAA", Auth: keys.Auth}}, false},
+		{"short auth", models.PushSubscription{Endpoint: "https://push.example.com/abc", Keys: models.PushSubscriptionKeys{P256dh: keys.P256dh, Auth: "AAAA"}}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateSubscription(&tt.sub)
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrInvalidPushSubscription)) {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestNotifyPrunesGoneSubscriptions(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	subs := repository.NewPushSubscriptionRepository(db)
+	browser := newPushBrowser(t)
+	srv, deliveries := stubPushEndpoint(t, browser, map[string]int{
+		"/gone":    http.StatusGone,
+		"/missing": http.StatusNotFound,
+		"/down":    http.StatusInternalServerError,
+	})
+	s := newTestPushService(t, subs, srv.Client())
+
+	for _, sub := range []*models.PushSubscription{
+		{UserID: "u1", Endpoint: srv.URL + "/ok"},
+		{UserID: "u1", Endpoint: srv.URL + "/gone"},
+		{UserID: "u1", Endpoint: srv.URL + "/missing"},
+		{UserID: "u1", Endpoint: srv.URL + "/down"},
+		{UserID: "u2", Endpoint: srv.URL + "/other"},
+	} {
+		sub.Keys = browser.keys()
+		if err := subs.Upsert(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := models.PushMessage{Type: models.NotificationSnoozeReturned, Title: "A snoozed email is back in your inbox", Body: "Invoice", EmailID: "e1"}
+	s.Notify(ctx, "u1", msg)
+
+	var paths []string
+	for _, d := range deliveries() {
+		paths = append(paths, d.path)
+		var got models.PushMessage
+		if d.err != nil || json.Unmarshal(d.payload, &got) != nil || got != msg {
+			t.Errorf("%s received %q (err %v)", d.path, d.payload, d.err)
+		}
+	}
+	slices.Sort(paths)
+	if want := []string{"/down", "/gone", "/missing", "/ok"}; !slices.Equal(paths, want) {
+		t.Errorf("delivered to %v, want %v", paths, want)
+	}
+
+	// 404 and 410 remove the subscription; other failures keep it for the next message
+	remaining, err := subs.ListByUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var endpoints []string
+	for _, sub := range remaining {
+		endpoints = append(endpoints, strings.TrimPrefix(sub.Endpoint, srv.URL))
+	}
+	slices.Sort(endpoints)
+	if want := []string{"/down", "/ok"}; !slices.Equal(endpoints, want) {
+		t.Errorf("u1 subscriptions = %v, want %v", endpoints, want)
+	}
+	if other, err := subs.ListByUser(ctx, "u2"); err != nil || len(other) != 1 {
+		t.Errorf("u2 subscriptions = %d (err %v), want 1", len(other), err)
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query translation sources
+const (
+	TranslationLLM   = "llm"
+	TranslationRules = "rules"
+)
+
+// QueryTranslation is a natural-language query rewritten as a Gmail search string
+type QueryTranslation struct {
+	Original string `json:"original"`
+	Query    string `json:"query"`
+	Source   string `json:"source"` // llm or rules
+}
+
+// QueryTranslationService turns queries like "invoices from ACME last month" into Gmail search
+// operators ("from:acme after:2024/05/01 before:2024/06/01 invoices"). The LLM is tried first
+// when configured; the rules handle date phrases, "from X" and attachments deterministically.
+type QueryTranslationService struct {
+	llm LLMProvider // nil uses the rules only
+}
+
+// NewQueryTranslationService creates the service; llm may be nil
+func NewQueryTranslationService(llm LLMProvider) *QueryTranslationService {
+	return &QueryTranslationService{llm: llm}
+}
+
+// Translate rewrites query for Gmail search. LLM failures and unusable answers fall back to
+// the rules.
+func (s *QueryTranslationService) Translate(ctx context.Context, query string) *QueryTranslation {
+	now := time.Now()
+	if s.llm != nil {
+		translated, err := s.llmTranslate(ctx, query, now)
+		if err == nil {
+			return &QueryTranslation{Original: query, Query: translated, Source: TranslationLLM}
+		}
+		log.Println("query translation failed, using rules:", err)
+	}
+	translated := TranslateQueryByRules(query, now)
+	if translated == "" {
+		// nothing but filler words; search for them as typed
+		translated = strings.TrimSpace(query)
+	}
+	return &QueryTranslation{Original: query, Query: translated, Source: TranslationRules}
+}
+
+// ===== LLM =====
+
+func (s *QueryTranslationService) llmTranslate(ctx context.Context, query string, now time.Time) (string, error) {
+	out, err := s.llm.Generate(withOperation(ctx, "query_translation"), LLMRequest{
+		System: `You convert email search requests into a Gmail search string. Use Gmail operators
+(from:, to:, subject:, has:attachment, is:unread, is:starred, after:YYYY/MM/DD, before:YYYY/MM/DD,
+newer_than:Nd) for constraints and plain words for the topic. Drop filler words.
+Answer with the search string only, on one line.`,
+		Prompt:      fmt.Sprintf("Today is %s (%s).\nRequest: %s", now.Format("2006/01/02"), now.Weekday(), query),
+		MaxTokens:   100,
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	translated := strings.TrimSpace(out)
+	translated = strings.TrimSpace(strings.TrimPrefix(translated, "Query:"))
+	translated = strings.TrimSpace(strings.Trim(translated, "`\""))
+	if translated == "" || strings.Contains(translated, "\n") || len(translated) > 500 {
+		return "", fmt.Errorf("unusable translation %q", out)
+	}
+	return translated, nil
+}
+
+// ===== Rules =====
+
+// queryFillerWords carry no search meaning in a natural-language query
+var queryFillerWords = map[string]bool{
+	"a": true, "an": true, "the": true, "my": true, "me": true, "all": true, "any": true,
+	"show": true, "find": true, "get": true, "list": true, "search": true, "please": true,
+	"email": true, "emails": true, "mail": true, "mails": true, "message": true, "messages": true,
+	"about": true, "for": true, "of": true, "with": true, "that": true, "which": true,
+}
+
+var monthNames = map[string]time.Month{
+	"january": time.January, "jan": time.January, "february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March, "april": time.April, "apr": time.April, "may": time.May,
+	"june": time.June, "jun": time.June, "july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August, "september": time.September, "sep": time.September,
+	"sept": time.September, "october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November, "december": time.December, "dec": time.December,
+}
+
+// TranslateQueryByRules rewrites query with Gmail operators, relative to now:
+//   - today, yesterday, this/last week (weeks start on Monday), this/last month, this/last
+//     year, in <month>, since <month> -> after:/before: dates (a month later than now means
+//     last year's)
+//   - last/past N days|weeks|months|years -> newer_than:
+//   - from X -> from:x
+//   - with attachment(s) -> has:attachment
+//
+// Filler words are dropped and the remaining words kept in order after the operators. The
+// first date phrase wins.
+func TranslateQueryByRules(query string, now time.Time) string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	words := strings.Fields(strings.ToLower(query))
+	for i := range words {
+		words[i] = strings.Trim(words[i], ",.;:!?\"'()")
+	}
+
+	var from, has string
+	var dates *queryDates
+	var terms []string
+	for i := 0; i < len(words); i++ {
+		if d, n := datePhrase(words[i:], today); n > 0 {
+			if dates == nil {
+				dates = d
+			}
+			i += n - 1
+			continue
+		}
+
+		word, next := words[i], ""
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+		switch {
+		case word == "from" && next != "" && !queryFillerWords[next]:
+			if _, n := datePhrase(words[i+1:], today); n > 0 {
+				// "from last week" is a date, not a sender
+				continue
+			}
+			if from == "" {
+				from = strings.TrimSuffix(next, "'s")
+			}
+			i++
+		case word == "with" && (next == "attachment" || next == "attachments"):
+			has = "attachment"
+			i++
+		case word == "" || queryFillerWords[word]:
+		default:
+			terms = append(terms, word)
+		}
+	}
+
+	var parts []string
+	if from != "" {
+		parts = append(parts, "from:"+from)
+	}
+	if has != "" {
+		parts = append(parts, "has:"+has)
+	}
+	if dates != nil {
+		if !dates.after.IsZero() {
+			parts = append(parts, "after:"+dates.after.Format("2006/01/02"))
+		}
+		if !dates.before.IsZero() {
+			parts = append(parts, "before:"+dates.before.Format("2006/01/02"))
+		}
+		if dates.newerThan != "" {
+			parts = append(parts, "newer_than:"+dates.newerThan)
+		}
+	}
+	return strings.Join(append(parts, terms...), " ")
+}
+
+// queryDates is the date range of a date phrase; zero times are open ends
+type queryDates struct {
+	after, before time.Time
+	newerThan     string // Gmail relative age, e.g. 7d or 2m
+}
+
+// datePhrase recognizes a date phrase at the start of words (lower-cased, punctuation trimmed)
+// and returns its range and how many words it used (0 when there is none)
+func datePhrase(words []string, today time.Time) (*queryDates, int) {
+	word := func(i int) string {
+		if i >= len(words) {
+			return ""
+		}
+		return words[i]
+	}
+	startOfWeek := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	startOfMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	startOfYear := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, today.Location())
+
+	switch w, next := word(0), word(1); {
+	case w == "today":
+		return &queryDates{after: today, before: today.AddDate(0, 0, 1)}, 1
+	case w == "yesterday":
+		return &queryDates{after: today.AddDate(0, 0, -1), before: today}, 1
+	case w == "this" && next == "week":
+		return &queryDates{after: startOfWeek}, 2
+	case w == "last" && next == "week":
+		return &queryDates{after: startOfWeek.AddDate(0, 0, -7), before: startOfWeek}, 2
+	case w == "this" && next == "month":
+		return &queryDates{after: startOfMonth}, 2
+	case w == "last" && next == "month":
+		return &queryDates{after: startOfMonth.AddDate(0, -1, 0), before: startOfMonth}, 2
+	case w == "this" && next == "year":
+		return &queryDates{after: startOfYear}, 2
+	case w == "last" && next == "year":
+		return &queryDates{after: startOfYear.AddDate(-1, 0, 0), before: startOfYear}, 2
+	case w == "last" || w == "past":
+		n, err := strconv.Atoi(next)
+		if err != nil || n <= 0 {
+			return nil, 0
+		}
+		switch strings.TrimSuffix(word(2), "s") {
+		case "day":
+			return &queryDates{newerThan: strconv.Itoa(n) + "d"}, 3
+		case "week":
+			return &queryDates{newerThan: strconv.Itoa(7*n) + "d"}, 3
+		case "month":
+			return &queryDates{newerThan: strconv.Itoa(n) + "m"}, 3
+		case "year":
+			return &queryDates{newerThan: strconv.Itoa(n) + "y"}, 3
+		}
+	case w == "in" || w == "during" || w == "since":
+		month, ok := monthNames[next]
+		if !ok {
+			return nil, 0
+		}
+		start := time.Date(today.Year(), month, 1, 0, 0, 0, 0, today.Location())
+		if start.After(today) {
+			start = start.AddDate(-1, 0, 0)
+		}
+		if w == "since" {
+			return &queryDates{after: start}, 2
+		}
+		return &queryDates{after: start, before: start.AddDate(0, 1, 0)}, 2
+	}
+	return nil, 0
+}
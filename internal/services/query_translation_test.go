@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranslateQueryByRules(t *testing.T) {
+	// A Wednesday; the week started on Monday 10 June
+	now := time.Date(2024, 6, 12, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"invoices from ACME last month", "from:acme after:2024/05/01 before:2024/06/01 invoices"},
+		{"show me emails from John's team today", "from:john after:2024/06/12 before:2024/06/13 team"},
+		{"standup yesterday", "after:2024/06/11 before:2024/06/12 standup"},
+		{"this week", "after:2024/06/10"},
+		{"reports last week", "after:2024/06/03 before:2024/06/10 reports"},
+		{"this month", "after:2024/06/01"},
+		{"this year taxes", "after:2024/01/01 taxes"},
+		{"last year taxes", "after:2023/01/01 before:2024/01/01 taxes"},
+		{"contracts with attachments in March", "has:attachment after:2024/03/01 before:2024/04/01 contracts"},
+		// A month later than now is last year's
+		{"receipts in December", "after:2023/12/01 before:2024/01/01 receipts"},
+		{"since jan", "after:2024/01/01"},
+		{"past 3 days", "newer_than:3d"},
+		{"last 2 weeks alerts", "newer_than:14d alerts"},
+		{"last 6 months", "newer_than:6m"},
+		{"past 1 year", "newer_than:1y"},
+		{"from last week", "after:2024/06/03 before:2024/06/10"},
+		// The first date phrase wins
+		{"today or yesterday", "after:2024/06/12 before:2024/06/13 or"},
+		{"the last 0 days", "last 0 days"},
+		{"in the office", "in office"},
+		{"find all the messages", ""},
+		{"Budget, Q3!", "budget q3"},
+	}
+	for _, tt := range tests {
+		if got := TranslateQueryByRules(tt.query, now); got != tt.want {
+			t.Errorf("TranslateQueryByRules(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateWithLLM(t *testing.T) {
+	tests := []struct {
+		name       string
+		reply      string
+		err        error
+		wantQuery  string
+		wantSource string
+	}{
+		{"answer used as is", "from:acme has:attachment invoices", nil, "from:acme has:attachment invoices", TranslationLLM},
+		{"label and quotes stripped", " Query: `from:acme invoices` ", nil, "from:acme invoices", TranslationLLM},
+		{"error falls back to the rules", "", errors.New("timeout"), "from:acme has:attachment invoices", TranslationRules},
+		{"empty answer falls back", "  ", nil, "from:acme has:attachment invoices", TranslationRules},
+		{"several lines fall back", "from:acme\ninvoices", nil, "from:acme has:attachment invoices", TranslationRules},
+		{"overlong answer falls back", strings.Repeat("x", 501), nil, "from:acme has:attachment invoices", TranslationRules},
+	}
+	const query = "invoices from ACME with attachments"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &stubLLM{reply: tt.reply, err: tt.err}
+			got := NewQueryTranslationService(llm).Translate(context.Background(), query)
+			if got.Original != query || got.Query != tt.wantQuery || got.Source != tt.wantSource {
+				t.Errorf("Translate = %+v, want %q from %s", got, tt.wantQuery, tt.wantSource)
+			}
+			if llm.calls.Load() != 1 {
+				t.Errorf("LLM called %d times, want once", llm.calls.Load())
+			}
+			today := time.Now().Format("2006/01/02")
+			if !strings.Contains(llm.last.Prompt, "Today is "+today) || !strings.HasSuffix(llm.last.Prompt, "Request: "+query) ||
+				llm.last.Temperature != 0 {
+				t.Errorf("request = %+v", llm.last)
+			}
+		})
+	}
+
+	// Without a provider only the rules run; filler alone is searched as typed
+	s := NewQueryTranslationService(nil)
+	if got := s.Translate(context.Background(), "  my emails "); got.Query != "my emails" || got.Source != TranslationRules {
+		t.Errorf("filler-only query = %+v", got)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// RuleService runs users' filing rules, the actions of their saved searches and their Kanban
+// rules on newly synced emails. The three are kept apart because they do different jobs, but
+// they run as one pass (see Apply), in this order:
+//   - filing rules: simple sender/subject/label conditions; they pick the column and add Gmail
+//     labels
+//   - saved search actions: the same, for emails matching a saved search's query and filters;
+//     they only pick the column when no filing rule did
+//   - Kanban rules: richer conditions (domain, subject regex, attachments) acting on the card
+//     itself (column, priority, snooze, skip board), only for emails still headed for the inbox
+//
+// The first column set wins and labels are added once, so overlapping rules can't fight.
+type RuleService struct {
+	rules       *repository.RuleRepository
+	kanbanRules *repository.KanbanRuleRepository
+	searches    *repository.SavedSearchRepository
+	gmail       *GmailService
+}
+
+// NewRuleService creates a rule service
+func NewRuleService(rules *repository.RuleRepository, kanbanRules *repository.KanbanRuleRepository, searches *repository.SavedSearchRepository, gmail *GmailService) *RuleService {
+	return &RuleService{rules: rules, kanbanRules: kanbanRules, searches: searches, gmail: gmail}
+}
+
+// EvaluateRules runs rules (in evaluation order) on e. The first matching rule that sets a
+// status decides the column; labels of all matching rules are added. A matching rule with
+// StopOnMatch ends the evaluation.
+func EvaluateRules(rules []models.Rule, e *models.Email) *models.RuleEvaluation {
+	eval := &models.RuleEvaluation{Matched: []models.Rule{}}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !rule.Matches(e) {
+			continue
+		}
+		eval.Matched = append(eval.Matched, *rule)
+		if eval.Status == "" {
+			eval.Status = rule.Action.SetStatus
+		}
+		if label := rule.Action.AddLabel; label != "" && !e.HasLabel(label) && !contains(eval.AddLabels, label) {
+			eval.AddLabels = append(eval.AddLabels, label)
+		}
+		if rule.StopOnMatch {
+			break
+		}
+	}
+	return eval
+}
+
+// EvaluateSavedSearches adds the actions of the saved searches e matches to eval, in the
+// order of searches. Rules come first: a search only sets the column when no rule did.
+func EvaluateSavedSearches(eval *models.RuleEvaluation, searches []models.SavedSearch, e *models.Email) {
+	for i := range searches {
+		search := &searches[i]
+		if search.Action.IsEmpty() || !SavedSearchMatches(search, e) {
+			continue
+		}
+		eval.MatchedSearches = append(eval.MatchedSearches, *search)
+		if eval.Status == "" {
+			eval.Status = search.Action.MoveToStatus
+		}
+		if label := search.Action.AddLabel; label != "" && !e.HasLabel(label) && !contains(eval.AddLabels, label) {
+			eval.AddLabels = append(eval.AddLabels, label)
+		}
+	}
+}
+
+// SavedSearchMatches reports whether e matches search's filters and query. Whatever the
+// search mode, the query is matched as words: each must appear in the subject, sender, body
+// or preview (case and accent insensitive).
+func SavedSearchMatches(search *models.SavedSearch, e *models.Email) bool {
+	if !search.Filters.Matches(e) {
+		return false
+	}
+	words := strings.Fields(strings.ToLower(utils.RemoveAccents(search.Query)))
+	if len(words) == 0 {
+		return true
+	}
+	text := strings.ToLower(utils.RemoveAccents(strings.Join([]string{
+		e.Subject, e.From.Name, e.From.Email, stripHTML(e.Body), e.Preview,
+	}, " ")))
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate runs userID's enabled rules and saved search actions on e without applying them
+func (s *RuleService) Evaluate(ctx context.Context, userID string, e *models.Email) (*models.RuleEvaluation, error) {
+	rules, searches, err := s.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	eval := EvaluateRules(rules, e)
+	EvaluateSavedSearches(eval, searches, e)
+	return eval, nil
+}
+
+func (s *RuleService) load(ctx context.Context, userID string) ([]models.Rule, []models.SavedSearch, error) {
+	rules, err := s.rules.List(ctx, userID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	searches, err := s.searches.List(ctx, userID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, searches, nil
+}
+
+// Apply runs user's rules and saved search actions on emails that are not stored yet: the
+// status is set on the email (stored on insert in place of the inbox) and labels are added in
+// Gmail. Emails still headed for the inbox then go through the Kanban rules (see
+// ApplyKanbanRule). Stored emails are never passed in, so a re-sync doesn't apply anything
+// twice. A failed label change is logged; the email is still stored.
+func (s *RuleService) Apply(ctx context.Context, user *models.User, emails []*models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	rules, searches, err := s.load(ctx, user.ID.Hex())
+	if err != nil {
+		return err
+	}
+	kanbanRules, err := s.kanbanRules.List(ctx, user.ID.Hex(), true)
+	if err != nil {
+		return err
+	}
+	if len(rules)+len(searches)+len(kanbanRules) == 0 {
+		return nil
+	}
+	matchers := CompileKanbanRules(kanbanRules)
+
+	now := time.Now()
+	for _, e := range emails {
+		eval := EvaluateRules(rules, e)
+		EvaluateSavedSearches(eval, searches, e)
+		if eval.Status != "" {
+			e.Status = eval.Status
+		}
+		if e.Status == "" || e.Status == models.StatusInbox {
+			if rule := matchers.First(e); rule != nil {
+				ApplyKanbanRule(e, rule, now)
+			}
+		}
+		if len(eval.AddLabels) == 0 {
+			continue
+		}
+		if err := s.gmail.ModifyEmail(ctx, user, e.ID, eval.AddLabels, nil); err != nil {
+			log.Println("rules: failed to label email:", e.ID, err)
+			continue
+		}
+		// new slice: the labels may be shared with the copy a handler returned
+		e.Labels = append(append([]string{}, e.Labels...), eval.AddLabels...)
+	}
+	return nil
+}
+
+// KanbanRuleMatchers are a user's enabled Kanban rules, compiled, in evaluation order
+type KanbanRuleMatchers []kanbanRuleMatcher
+
+type kanbanRuleMatcher struct {
+	rule  *models.KanbanRule
+	match func(e *models.Email) bool
+}
+
+// CompileKanbanRules compiles rules (in evaluation order); disabled rules and rules whose
+// subject pattern doesn't compile are left out
+func CompileKanbanRules(rules []models.KanbanRule) KanbanRuleMatchers {
+	var matchers KanbanRuleMatchers
+	for i := range rules {
+		if !rules[i].Enabled {
+			continue
+		}
+		match, err := rules[i].Conditions.Matcher()
+		if err != nil {
+			log.Println("kanban rules: skipping rule:", rules[i].ID.Hex(), err)
+			continue
+		}
+		matchers = append(matchers, kanbanRuleMatcher{rule: &rules[i], match: match})
+	}
+	return matchers
+}
+
+// First returns the first rule matching e, or nil
+func (m KanbanRuleMatchers) First(e *models.Email) *models.KanbanRule {
+	for _, matcher := range m {
+		if matcher.match(e) {
+			return matcher.rule
+		}
+	}
+	return nil
+}
+
+// ApplyKanbanRule sets rule's action on e, which is about to be stored: the column, the
+// priority, a snooze starting at now and whether it stays off the board. The rule is recorded
+// on the email.
+func ApplyKanbanRule(e *models.Email, rule *models.KanbanRule, now time.Time) {
+	action := rule.Action
+	if action.SetStatus != "" {
+		e.Status = action.SetStatus
+	}
+	if action.SetPriority != "" {
+		e.Priority = action.SetPriority
+	}
+	// validated when the rule was saved
+	if d, err := action.SnoozeDuration(); err == nil && d > 0 {
+		until := now.Add(d)
+		e.Status = models.StatusSnoozed
+		e.SnoozedUntil = &until
+	}
+	if action.SkipBoard {
+		e.SkipBoard = true
+	}
+	e.KanbanRuleID = rule.ID.Hex()
+}
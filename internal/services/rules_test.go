@@ -0,0 +1,202 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func ruleNames(rules []models.Rule) []string {
+	names := []string{}
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// overlappingRules all match an invoice from billing@acme.com, with clashing columns and the
+// same label more than once
+func overlappingRules() ([]models.Rule, []models.SavedSearch) {
+	rules := []models.Rule{
+		{Name: "bills", Enabled: true, Conditions: models.RuleConditions{Sender: "billing@"},
+			Action: models.RuleAction{SetStatus: models.StatusTodo, AddLabel: "Label_bills"}},
+		{Name: "off", Enabled: false, Conditions: models.RuleConditions{Sender: "billing@"},
+			Action: models.RuleAction{SetStatus: models.StatusDone, AddLabel: "Label_off"}},
+		{Name: "invoices", Enabled: true, Conditions: models.RuleConditions{Subject: "invoice"},
+			Action: models.RuleAction{SetStatus: models.StatusInProgress, AddLabel: "Label_bills"}},
+	}
+	searches := []models.SavedSearch{
+		{Name: "finance", Query: "invoice acme", Action: &models.SavedSearchAction{MoveToStatus: models.StatusDone, AddLabel: "Label_finance"}},
+		{Name: "no action", Query: "invoice"},
+		{Name: "bills again", Query: "billing", Action: &models.SavedSearchAction{AddLabel: "Label_bills"}},
+	}
+	return rules, searches
+}
+
+func invoiceEmail(labels ...string) *models.Email {
+	return &models.Email{
+		ID:      "m1",
+		Subject: "Invoice #42",
+		From:    models.EmailAddress{Name: "ACME", Email: "billing@acme.com"},
+		Labels:  labels,
+	}
+}
+
+func TestOverlappingRules(t *testing.T) {
+	rules, searches := overlappingRules()
+	evaluate := func(e *models.Email) *models.RuleEvaluation {
+		eval := EvaluateRules(rules, e)
+		EvaluateSavedSearches(eval, searches, e)
+		return eval
+	}
+
+	eval := evaluate(invoiceEmail("INBOX"))
+	// The first column wins, so rules beat saved searches; each label is added once
+	if eval.Status != models.StatusTodo || !slices.Equal(eval.AddLabels, []string{"Label_bills", "Label_finance"}) {
+		t.Errorf("evaluation = status %q, labels %v", eval.Status, eval.AddLabels)
+	}
+	if got := ruleNames(eval.Matched); !slices.Equal(got, []string{"bills", "invoices"}) {
+		t.Errorf("matched rules %v", got)
+	}
+	if len(eval.MatchedSearches) != 2 || eval.MatchedSearches[0].Name != "finance" || eval.MatchedSearches[1].Name != "bills again" {
+		t.Errorf("matched searches %+v", eval.MatchedSearches)
+	}
+
+	// Evaluating again gives the same answer
+	for i := 0; i < 10; i++ {
+		if again := evaluate(invoiceEmail("INBOX")); !reflect.DeepEqual(again, eval) {
+			t.Fatalf("evaluation %d = %+v, first was %+v", i+2, again, eval)
+		}
+	}
+
+	// Once the labels are on the email there is nothing left to add, and the column is the same
+	labeled := invoiceEmail(append([]string{"INBOX"}, eval.AddLabels...)...)
+	if again := evaluate(labeled); again.Status != models.StatusTodo || len(again.AddLabels) != 0 {
+		t.Errorf("on the labeled email: status %q, labels %v; want todo and none", again.Status, again.AddLabels)
+	}
+
+	// StopOnMatch ends the rules, not the saved searches
+	rules[0].StopOnMatch = true
+	eval = evaluate(invoiceEmail("INBOX"))
+	if got := ruleNames(eval.Matched); !slices.Equal(got, []string{"bills"}) || len(eval.MatchedSearches) != 2 {
+		t.Errorf("with StopOnMatch: rules %v, %d searches", got, len(eval.MatchedSearches))
+	}
+
+	// Without a matching rule the first saved search picks the column
+	eval = EvaluateRules(nil, invoiceEmail())
+	EvaluateSavedSearches(eval, searches, invoiceEmail())
+	if eval.Status != models.StatusDone {
+		t.Errorf("status from the saved search = %q, want done", eval.Status)
+	}
+}
+
+func TestSavedSearchMatches(t *testing.T) {
+	e := &models.Email{Subject: "Hóa đơn tháng 5", From: models.EmailAddress{Email: "billing@acme.com"}, Body: "<p>Total: <b>42</b></p>", IsRead: true}
+	read, unread := true, false
+	tests := []struct {
+		search models.SavedSearch
+		want   bool
+	}{
+		{models.SavedSearch{Query: "hoa don"}, true},
+		{models.SavedSearch{Query: "ACME total"}, true},
+		{models.SavedSearch{Query: "total refund"}, false},
+		{models.SavedSearch{Query: "<b>"}, false},
+		{models.SavedSearch{}, true},
+		{models.SavedSearch{Query: "acme", Filters: models.SearchFilters{IsRead: &read}}, true},
+		{models.SavedSearch{Query: "acme", Filters: models.SearchFilters{IsRead: &unread}}, false},
+	}
+	for _, tt := range tests {
+		if got := SavedSearchMatches(&tt.search, e); got != tt.want {
+			t.Errorf("SavedSearchMatches(%q, %+v) = %v, want %v", tt.search.Query, tt.search.Filters, got, tt.want)
+		}
+	}
+}
+
+// Apply only ever sees new emails, but running it twice on the same one must still not label
+// it twice or change the outcome
+func TestApplyIsIdempotent(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+
+	var (
+		mu       sync.Mutex
+		modified []string
+	)
+	gmailSvc, user := newFakeGmail(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/messages/"), "/modify")
+		if r.Method != http.MethodPost || !ok {
+			writeGmailError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		var req struct {
+			AddLabelIds []string `json:"addLabelIds"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		modified = append(modified, id+":"+strings.Join(req.AddLabelIds, ","))
+		mu.Unlock()
+		writeJSON(w, fakeMessage(id))
+	}), 1, 0)
+	userID := user.ID.Hex()
+
+	ruleRepo := repository.NewRuleRepository(db)
+	searchRepo := repository.NewSavedSearchRepository(db)
+	kanbanRepo := repository.NewKanbanRuleRepository(db)
+	rules, searches := overlappingRules()
+	for i := range rules {
+		rules[i].UserID, rules[i].Order = userID, i
+		if err := ruleRepo.Create(ctx, &rules[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range searches {
+		searches[i].UserID = userID
+		if err := searchRepo.Create(ctx, &searches[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Overlaps the filing rules for the invoice, which never reaches it, and files the newsletter
+	for i, c := range []models.KanbanRuleConditions{{SenderContains: "billing@"}, {DomainEquals: "news.com"}} {
+		rule := &models.KanbanRule{UserID: userID, Name: c.SenderContains + c.DomainEquals, Order: i, Enabled: true, Conditions: c,
+			Action: models.KanbanRuleAction{SetStatus: models.StatusDone, SetPriority: models.PriorityLow}}
+		if err := kanbanRepo.Create(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewRuleService(ruleRepo, kanbanRepo, searchRepo, gmailSvc)
+
+	invoice := invoiceEmail("INBOX")
+	news := &models.Email{ID: "m2", Subject: "Weekly digest", From: models.EmailAddress{Email: "hi@news.com"}, Labels: []string{"INBOX"}}
+	emails := []*models.Email{invoice, news}
+	if err := s.Apply(ctx, user, emails); err != nil {
+		t.Fatal(err)
+	}
+	first := []models.Email{*invoice, *news}
+	if !slices.Equal(modified, []string{"m1:Label_bills,Label_finance"}) {
+		t.Errorf("Gmail changes = %v, want the two labels added to m1 once", modified)
+	}
+	if invoice.Status != models.StatusTodo || invoice.KanbanRuleID != "" {
+		t.Errorf("invoice: status %q, kanban rule %q; want todo from the filing rule only", invoice.Status, invoice.KanbanRuleID)
+	}
+	if news.Status != models.StatusDone || news.Priority != models.PriorityLow || news.KanbanRuleID == "" {
+		t.Errorf("newsletter: status %q, priority %q, rule %q", news.Status, news.Priority, news.KanbanRuleID)
+	}
+
+	if err := s.Apply(ctx, user, emails); err != nil {
+		t.Fatal(err)
+	}
+	if len(modified) != 1 {
+		t.Errorf("second run changed Gmail again: %v", modified)
+	}
+	if !reflect.DeepEqual([]models.Email{*invoice, *news}, first) {
+		t.Errorf("second run changed the emails:\n%+v\nwas\n%+v", []models.Email{*invoice, *news}, first)
+	}
+}
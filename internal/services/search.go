@@ -0,0 +1,425 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rrfK damps the reciprocal rank fusion so the top ranks of one retriever don't drown out
+// agreement between retrievers (the usual value from the RRF paper)
+const rrfK = 60
+
+// ErrInvalidSearchSource is returned for a retriever name Hybrid doesn't know
+var ErrInvalidSearchSource = errors.New("unknown search source (use keyword, semantic or gmail)")
+
+// VectorSearchConfig selects Atlas Vector Search for semantic queries
+type VectorSearchConfig struct {
+	Enabled       bool
+	Index         string
+	NumCandidates int
+}
+
+// SearchService runs the keyword, semantic and Gmail retrievers and fuses their results
+type SearchService struct {
+	emails    *repository.EmailRepository
+	embedding EmbeddingService
+	gmail     *GmailService
+	vector    VectorSearchConfig
+	minScore  float64 // default minimum cosine similarity of semantic hits
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(emails *repository.EmailRepository, embedding EmbeddingService, gmail *GmailService, vector VectorSearchConfig, minScore float64) *SearchService {
+	return &SearchService{emails: emails, embedding: embedding, gmail: gmail, vector: vector, minScore: minScore}
+}
+
+// UsesVectorSearch reports whether semantic queries go to Atlas Vector Search
+func (s *SearchService) UsesVectorSearch() bool {
+	return s.vector.Enabled && s.vector.Index != ""
+}
+
+// ===== Retrievers =====
+
+// SemanticResult is the outcome of a semantic query
+type SemanticResult struct {
+	Hits []models.ScoredEmail
+	// Embedded emails the query was compared against
+	Searched int64
+}
+
+// Semantic returns userID's emails closest in meaning to query, best first, with cosine
+// similarity scores; hits below minScore are dropped. Atlas Vector Search is used when
+// enabled; on error (missing index, not on Atlas) the embedded emails are scored in memory.
+func (s *SearchService) Semantic(ctx context.Context, userID, query string, filters *models.SearchFilters, limit int, minScore float64) (*SemanticResult, error) {
+	queryEmbedding, err := s.embedding.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	var res *SemanticResult
+	if s.UsesVectorSearch() {
+		res, err = s.vectorSearch(ctx, userID, queryEmbedding, filters, limit)
+		if err != nil {
+			log.Println("vector search failed, scoring in memory:", err)
+		}
+	}
+	if res == nil {
+		if res, err = s.bruteForceSearch(ctx, userID, queryEmbedding, filters, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	// hits are sorted, so the first one under the threshold ends the relevant results
+	for i, hit := range res.Hits {
+		if hit.Score < minScore {
+			res.Hits = res.Hits[:i]
+			break
+		}
+	}
+	return res, nil
+}
+
+// MinScore is the default minimum cosine similarity of semantic results
+func (s *SearchService) MinScore() float64 {
+	return s.minScore
+}
+
+// vectorSearch asks the Atlas index for the nearest emails. Filters are applied afterwards
+// (the index only knows userId), so it over-fetches when filtering. Scores are converted back
+// to cosine similarity so they match the in-memory path. Searched counts all of the user's
+// embedded emails, filters aside.
+func (s *SearchService) vectorSearch(ctx context.Context, userID string, queryEmbedding []float32, filters *models.SearchFilters, limit int) (*SemanticResult, error) {
+	fetch := limit
+	if filters != nil && *filters != (models.SearchFilters{}) {
+		fetch = limit * 4
+	}
+	hits, err := s.emails.VectorSearch(ctx, userID, queryEmbedding, s.vector.Index, s.vector.NumCandidates, fetch)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.ScoredEmail, 0, len(hits))
+	for _, hit := range hits {
+		if !filters.Matches(&hit.Email) {
+			continue
+		}
+		hit.Score = 2*hit.Score - 1
+		results = append(results, hit)
+		if len(results) == limit {
+			break
+		}
+	}
+	searched, err := s.emails.CountEmbedded(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &SemanticResult{Hits: results, Searched: searched}, nil
+}
+
+// bruteForceSearch loads every embedded email of the user and ranks them by cosine similarity,
+// scoring chunked emails by their best chunk
+func (s *SearchService) bruteForceSearch(ctx context.Context, userID string, queryEmbedding []float32, filters *models.SearchFilters, limit int) (*SemanticResult, error) {
+	emails, err := s.emails.GetAllWithEmbeddings(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch emails: %w", err)
+	}
+
+	if err := checkEmbeddingDimensions(emails, len(queryEmbedding)); err != nil {
+		return nil, err
+	}
+
+	scored := make([]models.ScoredEmail, 0, len(emails))
+	for i := range emails {
+		if len(emails[i].Embedding) == 0 || !filters.Matches(&emails[i]) {
+			continue
+		}
+		score := EmailSimilarity(queryEmbedding, &emails[i])
+		emails[i].Embedding, emails[i].EmbeddingChunks = nil, nil
+		scored = append(scored, models.ScoredEmail{Email: emails[i], Score: float64(score)})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	searched := int64(len(scored))
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	return &SemanticResult{Hits: scored, Searched: searched}, nil
+}
+
+// Keyword returns userID's stored emails matching the words of query, most relevant first
+func (s *SearchService) Keyword(ctx context.Context, userID, query string, filters *models.SearchFilters, limit int) ([]models.ScoredEmail, error) {
+	return s.emails.KeywordSearch(ctx, userID, query, filters, limit)
+}
+
+// Gmail searches the whole mailbox through the Gmail API. The filters become search
+// operators where Gmail has one and are checked again on the results. Gmail doesn't score
+// results, so Score is 0 and only the order counts.
+func (s *SearchService) Gmail(ctx context.Context, user *models.User, query string, filters *models.SearchFilters, limit int) ([]models.ScoredEmail, error) {
+	emails, _, _, err := s.gmail.SearchEmails(ctx, user, query+GmailFilterOperators(filters), "")
+	if err != nil {
+		return nil, err
+	}
+	if filters != nil && filters.Status != "" {
+		// Gmail doesn't know the Kanban column; emails not stored yet are in the inbox
+		ids := make([]string, len(emails))
+		for i, e := range emails {
+			ids[i] = e.ID
+		}
+		stored, err := s.emails.GetByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range emails {
+			if st, ok := stored[e.ID]; ok {
+				e.Status = st.Status
+			}
+		}
+	}
+	results := make([]models.ScoredEmail, 0, len(emails))
+	for _, e := range emails {
+		if !filters.Matches(e) {
+			continue
+		}
+		results = append(results, models.ScoredEmail{Email: *e})
+		if len(results) == limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// GmailFilterOperators renders filters as Gmail search operators, with a leading space.
+// Only system labels are pushed down: Gmail's label: wants names, user labels are stored by ID.
+func GmailFilterOperators(f *models.SearchFilters) string {
+	if f == nil {
+		return ""
+	}
+	var ops []string
+	if f.DateFrom != nil {
+		ops = append(ops, fmt.Sprintf("after:%d", f.DateFrom.Unix()))
+	}
+	if f.DateTo != nil {
+		ops = append(ops, fmt.Sprintf("before:%d", f.DateTo.Unix()))
+	}
+	if sender := strings.TrimSpace(f.Sender); sender != "" {
+		ops = append(ops, fmt.Sprintf("from:(%s)", strings.ReplaceAll(sender, ")", "")))
+	}
+	if f.Label != "" && !strings.HasPrefix(f.Label, "Label_") {
+		ops = append(ops, "label:"+strings.ToLower(f.Label))
+	}
+	if f.HasAttachment != nil {
+		if *f.HasAttachment {
+			ops = append(ops, "has:attachment")
+		} else {
+			ops = append(ops, "-has:attachment")
+		}
+	}
+	if f.MailboxID != "" && !strings.HasPrefix(f.MailboxID, "Label_") {
+		ops = append(ops, "label:"+strings.ToLower(f.MailboxID))
+	}
+	if f.IsRead != nil {
+		if *f.IsRead {
+			ops = append(ops, "is:read")
+		} else {
+			ops = append(ops, "is:unread")
+		}
+	}
+	// Status (the Kanban column) only exists locally and is checked on the results
+	if len(ops) == 0 {
+		return ""
+	}
+	return " " + strings.Join(ops, " ")
+}
+
+// ===== Hybrid =====
+
+// Hybrid runs the requested retrievers in parallel and fuses their rankings. A failing
+// retriever is reported in Errors; the call only fails when all of them do.
+func (s *SearchService) Hybrid(ctx context.Context, user *models.User, req *models.HybridSearchRequest) (*models.HybridSearchResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	// Retrieve deeper than we return so fusion can promote results found by several retrievers
+	depth := limit * 2
+	if depth < 20 {
+		depth = 20
+	}
+
+	sources := req.Sources
+	if len(sources) == 0 {
+		sources = []string{models.RetrieverKeyword, models.RetrieverSemantic, models.RetrieverGmail}
+	}
+	for _, source := range sources {
+		switch source {
+		case models.RetrieverKeyword, models.RetrieverSemantic, models.RetrieverGmail:
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSearchSource, source)
+		}
+	}
+	userID := user.ID.Hex()
+	filters := &req.Filters
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		rankings = map[string][]models.ScoredEmail{}
+		errs     = map[string]string{}
+	)
+	for _, source := range sources {
+		var retrieve func() ([]models.ScoredEmail, error)
+		switch source {
+		case models.RetrieverKeyword:
+			retrieve = func() ([]models.ScoredEmail, error) { return s.Keyword(ctx, userID, req.Query, filters, depth) }
+		case models.RetrieverSemantic:
+			retrieve = func() ([]models.ScoredEmail, error) {
+				res, err := s.Semantic(ctx, userID, req.Query, filters, depth, s.minScore)
+				if err != nil {
+					return nil, err
+				}
+				return res.Hits, nil
+			}
+		default:
+			retrieve = func() ([]models.ScoredEmail, error) { return s.Gmail(ctx, user, req.Query, filters, depth) }
+		}
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			hits, err := retrieve()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[source] = err.Error()
+				return
+			}
+			rankings[source] = hits
+		}(source)
+	}
+	wg.Wait()
+
+	if len(rankings) == 0 {
+		return nil, fmt.Errorf("all retrievers failed: %v", errs)
+	}
+
+	results := FuseRankings(rankings, rrfK)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	resp := &models.HybridSearchResponse{
+		Query:   req.Query,
+		Results: results,
+		Total:   len(results),
+	}
+	if len(errs) > 0 {
+		resp.Errors = errs
+	}
+	return resp, nil
+}
+
+// FuseRankings merges ranked lists with reciprocal rank fusion: each email scores
+// sum(1 / (k + rank)) over the lists it appears in (rank is 1-based), so emails several
+// retrievers agree on rise to the top. Duplicates within a list keep their best rank. Each
+// list's scores are min-max normalized to 0-1 for display; a list without scores (Gmail) or
+// with a single hit is scored by position instead. Ties go to the newer email.
+func FuseRankings(rankings map[string][]models.ScoredEmail, k int) []models.HybridSearchResult {
+	byID := map[string]*models.HybridSearchResult{}
+	var order []string
+
+	// Iterate retrievers in a fixed order so equal emails from different lists merge the same way
+	sources := make([]string, 0, len(rankings))
+	for source := range rankings {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		hits := rankings[source]
+		normalized := normalizeScores(hits)
+		for i := range hits {
+			id := hits[i].ID
+			res, ok := byID[id]
+			if !ok {
+				email := hits[i].Email
+				res = &models.HybridSearchResult{
+					Email:  &email,
+					Ranks:  map[string]int{},
+					Scores: map[string]float64{},
+				}
+				byID[id] = res
+				order = append(order, id)
+			}
+			if _, seen := res.Ranks[source]; seen {
+				continue
+			}
+			rank := i + 1
+			res.Ranks[source] = rank
+			res.Scores[source] = normalized[i]
+			res.Score += 1 / float64(k+rank)
+		}
+	}
+
+	results := make([]models.HybridSearchResult, 0, len(order))
+	for _, id := range order {
+		res := byID[id]
+		res.MatchedBy = make([]string, 0, len(res.Ranks))
+		for source := range res.Ranks {
+			res.MatchedBy = append(res.MatchedBy, source)
+		}
+		sort.Slice(res.MatchedBy, func(i, j int) bool {
+			ri, rj := res.Ranks[res.MatchedBy[i]], res.Ranks[res.MatchedBy[j]]
+			if ri != rj {
+				return ri < rj
+			}
+			return res.MatchedBy[i] < res.MatchedBy[j]
+		})
+		results = append(results, *res)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if !results[i].Email.ReceivedAt.Equal(results[j].Email.ReceivedAt) {
+			return results[i].Email.ReceivedAt.After(results[j].Email.ReceivedAt)
+		}
+		return results[i].Email.ID < results[j].Email.ID
+	})
+	return results
+}
+
+// normalizeScores min-max scales the scores of one ranked list to 0-1. Lists whose scores
+// are all equal (no scores, or one hit) fall back to 1 - i/n by position.
+func normalizeScores(hits []models.ScoredEmail) []float64 {
+	out := make([]float64, len(hits))
+	if len(hits) == 0 {
+		return out
+	}
+	lo, hi := hits[0].Score, hits[0].Score
+	for _, h := range hits {
+		if h.Score < lo {
+			lo = h.Score
+		}
+		if h.Score > hi {
+			hi = h.Score
+		}
+	}
+	for i, h := range hits {
+		if hi > lo {
+			out[i] = (h.Score - lo) / (hi - lo)
+		} else {
+			out[i] = 1 - float64(i)/float64(len(hits))
+		}
+	}
+	return out
+}
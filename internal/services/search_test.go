@@ -0,0 +1,195 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fixedEmbedder embeds each text as the vector registered for it, else as query
+type fixedEmbedder struct {
+	query   []float32
+	vectors map[string][]float32
+}
+
+func (e *fixedEmbedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	if v, ok := e.vectors[text]; ok {
+		return v, nil
+	}
+	return e.query, nil
+}
+
+func (e *fixedEmbedder) BatchGenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = e.GenerateEmbedding(ctx, text)
+	}
+	return vectors, nil
+}
+
+func (e *fixedEmbedder) GetDimension() int { return len(e.query) }
+
+func (e *fixedEmbedder) ModelName() string { return "fixed" }
+
+func TestUsesVectorSearch(t *testing.T) {
+	tests := []struct {
+		vector VectorSearchConfig
+		want   bool
+	}{
+		{VectorSearchConfig{Enabled: true, Index: "email_embedding_index"}, true},
+		{VectorSearchConfig{Enabled: true}, false},
+		{VectorSearchConfig{Index: "email_embedding_index"}, false},
+		{VectorSearchConfig{}, false},
+	}
+	for _, tt := range tests {
+		if got := NewSearchService(nil, nil, nil, tt.vector, 0).UsesVectorSearch(); got != tt.want {
+			t.Errorf("UsesVectorSearch(%+v) = %v, want %v", tt.vector, got, tt.want)
+		}
+	}
+}
+
+// semanticFixture stores emails of u1 at known cosine similarities to the query [1, 0]
+func semanticFixture(t *testing.T, repo *repository.EmailRepository) {
+	t.Helper()
+	now := time.Now()
+	for _, e := range []*models.Email{
+		{ID: "exact", Subject: "exact", Embedding: []float32{1, 0}},                   // 1
+		{ID: "close", Subject: "close", Embedding: []float32{0.8, 0.6}, IsRead: true}, // 0.8
+		{ID: "far", Subject: "far", Embedding: []float32{0, 1}},                       // 0
+		{ID: "opposite", Subject: "opposite", Embedding: []float32{-1, 0}},            // -1
+		{ID: "deleted", Subject: "deleted", Embedding: []float32{1, 0}, DeletedAt: &now},
+		{ID: "unembedded", Subject: "unembedded"},
+	} {
+		e.UserID, e.MailboxID = "u1", "INBOX"
+		if err := repo.CreateEmail(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := &models.Email{ID: "other", UserID: "u2", MailboxID: "INBOX", Embedding: []float32{1, 0}}
+	if err := repo.CreateEmail(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unreadOnly leaves out "close", the only read email of semanticFixture
+var unreadOnly = &models.SearchFilters{IsRead: new(bool)}
+
+func hitIDs(hits []models.ScoredEmail) string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// A plain MongoDB has no $vectorSearch: with vector search enabled Semantic must still answer
+// from the in-memory scan, with the same results as when it is disabled
+func TestSemanticFallsBackToInMemory(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	repo := repository.NewEmailRepository(db)
+	semanticFixture(t, repo)
+	embedder := &fixedEmbedder{query: []float32{1, 0}}
+
+	for _, vector := range []VectorSearchConfig{{}, {Enabled: true, Index: "email_embedding_index", NumCandidates: 100}} {
+		s := NewSearchService(repo, embedder, nil, vector, 0)
+		res, err := s.Semantic(ctx, "u1", "contract", nil, 10, -1)
+		if err != nil {
+			t.Fatalf("vector search %v: %v", vector.Enabled, err)
+		}
+		if got := hitIDs(res.Hits); got != "exact,close,far,opposite" || res.Searched != 4 {
+			t.Errorf("vector search %v: hits %s of %d searched", vector.Enabled, got, res.Searched)
+		}
+
+		res, err = s.Semantic(ctx, "u1", "contract", unreadOnly, 1, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(res.Hits); got != "exact" {
+			t.Errorf("vector search %v with filters: hits %s", vector.Enabled, got)
+		}
+	}
+
+	// Errors of the in-memory scan are not swallowed by the fallback
+	s := NewSearchService(repo, &fixedEmbedder{query: []float32{1, 0, 0}}, nil, VectorSearchConfig{Enabled: true, Index: "email_embedding_index"}, 0)
+	if _, err := s.Semantic(ctx, "u1", "contract", nil, 10, 0); !errors.Is(err, ErrEmbeddingDimensionMismatch) {
+		t.Errorf("dimension mismatch = %v, want ErrEmbeddingDimensionMismatch", err)
+	}
+}
+
+// TestAtlasVectorSearch runs Semantic against a real Atlas Vector Search index; it needs an
+// Atlas cluster at ATLAS_TEST_URI and takes up to a few minutes while the index builds
+func TestAtlasVectorSearch(t *testing.T) {
+	db := testutil.Atlas(t)
+	ctx := context.Background()
+	repo := repository.NewEmailRepository(db)
+	semanticFixture(t, repo)
+
+	const index = "email_embedding_index"
+	model := mongo.SearchIndexModel{
+		Definition: bson.M{"fields": []bson.M{
+			{"type": "vector", "path": "embedding", "numDimensions": 2, "similarity": "cosine"},
+			{"type": "filter", "path": "userId"},
+		}},
+		Options: options.SearchIndexes().SetName(index).SetType("vectorSearch"),
+	}
+	if _, err := db.Collection("emails").SearchIndexes().CreateOne(ctx, model); err != nil {
+		t.Fatal(err)
+	}
+	waitQueryable(t, db.Collection("emails"), index)
+
+	s := NewSearchService(repo, &fixedEmbedder{query: []float32{1, 0}}, nil, VectorSearchConfig{Enabled: true, Index: index, NumCandidates: 100}, 0)
+	res, err := s.Semantic(ctx, "u1", "contract", nil, 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(res.Hits); got != "exact,close,far,opposite" || res.Searched != 4 {
+		t.Errorf("hits %s of %d searched, want exact,close,far,opposite of 4", got, res.Searched)
+	}
+	// Atlas' normalized score is converted back to cosine similarity
+	for i, want := range []float64{1, 0.8, 0, -1} {
+		if i < len(res.Hits) && (res.Hits[i].Score < want-1e-3 || res.Hits[i].Score > want+1e-3) {
+			t.Errorf("%s score = %v, want %v", res.Hits[i].ID, res.Hits[i].Score, want)
+		}
+	}
+
+	res, err = s.Semantic(ctx, "u1", "contract", unreadOnly, 2, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(res.Hits); got != "exact" {
+		t.Errorf("filtered hits %s, want exact", got)
+	}
+}
+
+func waitQueryable(t *testing.T, coll *mongo.Collection, index string) {
+	t.Helper()
+	ctx := context.Background()
+	deadline := time.Now().Add(3 * time.Minute)
+	for time.Now().Before(deadline) {
+		cursor, err := coll.SearchIndexes().List(ctx, options.SearchIndexes().SetName(index))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var indexes []struct {
+			Queryable bool `bson:"queryable"`
+		}
+		if err := cursor.All(ctx, &indexes); err != nil {
+			t.Fatal(err)
+		}
+		if len(indexes) == 1 && indexes[0].Queryable {
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+	t.Fatalf("search index %s not queryable after 3 minutes", index)
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/utils"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// frequentSenderLimit is how many of the user's most frequent sender domains are compared
+// against for lookalikes
+const frequentSenderLimit = 200
+
+// llmSecurityThreshold is the heuristic score from which the optional LLM check runs;
+// obviously clean mail is not worth a request
+const llmSecurityThreshold = 20
+
+// SecurityAnalysisService scores emails for phishing and spam risk. The heuristics always
+// run; when an LLM provider is configured and llmCheck is on, borderline and risky emails
+// are also reviewed by the model and the higher score wins.
+type SecurityAnalysisService struct {
+	llm      LLMProvider // nil without a provider
+	llmCheck bool
+}
+
+// NewSecurityAnalysisService creates the service; llm may be nil
+func NewSecurityAnalysisService(llm LLMProvider, llmCheck bool) *SecurityAnalysisService {
+	return &SecurityAnalysisService{llm: llm, llmCheck: llmCheck}
+}
+
+// FrequentSenderLimit is how many frequent sender domains callers should load for Analyze
+func (s *SecurityAnalysisService) FrequentSenderLimit() int {
+	return frequentSenderLimit
+}
+
+// Analyze scores e. knownDomains are the sender domains the user frequently receives mail
+// from, used to spot lookalikes.
+func (s *SecurityAnalysisService) Analyze(ctx context.Context, e *models.Email, knownDomains []string) *models.SecurityAnalysis {
+	score, reasons := scoreSecurityHeuristics(e, knownDomains)
+	analysis := &models.SecurityAnalysis{AnalyzedAt: time.Now()}
+
+	if s.llm != nil && s.llmCheck && score >= llmSecurityThreshold {
+		llmScore, reason, err := s.llmRisk(ctx, e)
+		if err != nil {
+			fmt.Printf("security LLM check failed, using heuristics only: %v\n", err)
+		} else {
+			analysis.LLMChecked = true
+			if llmScore > score {
+				score = llmScore
+			}
+			if reason != "" {
+				reasons = append(reasons, "AI review: "+reason)
+			}
+		}
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	if reasons == nil {
+		reasons = []string{}
+	}
+	analysis.RiskScore = score
+	analysis.RiskLevel = riskLevel(score)
+	analysis.Reasons = reasons
+	return analysis
+}
+
+func riskLevel(score int) string {
+	switch {
+	case score >= 60:
+		return models.RiskHigh
+	case score >= 30:
+		return models.RiskMedium
+	default:
+		return models.RiskLow
+	}
+}
+
+// ===== Heuristics =====
+
+var (
+	// Brands commonly impersonated in display names
+	impersonatedBrands = []string{"paypal", "apple", "microsoft", "google", "amazon", "netflix", "facebook", "instagram", "dhl", "fedex", "ups", "docusign", "dropbox", "binance", "coinbase", "vietcombank", "techcombank", "momo", "shopee"}
+	paymentKeywordRE   = regexp.MustCompile(`(?i)\b(verify your (account|identity)|confirm your (account|identity|password)|account (suspended|locked|will be closed)|unusual (sign[- ]in|activity)|update (your )?(payment|billing)|payment (failed|declined)|wire transfer|gift cards?|bank details|crypto(currency)? wallet|bitcoin|reset your password|tài khoản .{0,20}(bị khóa|tạm khóa)|xác minh tài khoản|chuyển khoản)`)
+	urgencyKeywordRE   = regexp.MustCompile(`(?i)\b(urgent|immediately|within 24 hours|final notice|act now|khẩn|ngay lập tức)`)
+	ipLinkRE           = regexp.MustCompile(`(?i)https?://\d{1,3}(\.\d{1,3}){3}([:/]|\b)`)
+	emailInTextRE      = regexp.MustCompile(`[\w.+-]+@([\w-]+\.)+[\w-]+`)
+)
+
+// scoreSecurityHeuristics returns an uncapped risk score and the reasons behind it:
+// +30 display name showing another address, +25 display name naming a brand the sender
+// domain doesn't belong to, +20 Reply-To on another domain (+10 more when it is free mail
+// while the sender isn't), +35 lookalike of a frequent sender domain, +15 per payment/account
+// keyword pattern (max 30), +10 urgency together with such a keyword, +25 links to raw IPs.
+func scoreSecurityHeuristics(e *models.Email, knownDomains []string) (int, []string) {
+	score := 0
+	var reasons []string
+	_, senderDomain := splitAddress(e.From.Email)
+	name := strings.ToLower(e.From.Name)
+
+	// Display name vs sender domain
+	if m := emailInTextRE.FindString(name); m != "" {
+		if _, shown := splitAddress(m); shown != "" && !sameOrgDomain(shown, senderDomain) {
+			score += 30
+			reasons = append(reasons, fmt.Sprintf("Display name shows %s but the message was sent from %s", m, senderDomain))
+		}
+	} else {
+		for _, brand := range impersonatedBrands {
+			if containsWord(name, brand) && !strings.Contains(senderDomain, brand) {
+				score += 25
+				reasons = append(reasons, fmt.Sprintf("Display name mentions %q but the sender domain is %s", brand, senderDomain))
+				break
+			}
+		}
+	}
+
+	// Reply-To on another domain
+	for _, rt := range e.ReplyTo {
+		_, replyDomain := splitAddress(rt.Email)
+		if replyDomain == "" || sameOrgDomain(replyDomain, senderDomain) {
+			continue
+		}
+		score += 20
+		reason := fmt.Sprintf("Replies go to %s, not the sender's domain %s", rt.Email, senderDomain)
+		if freeMailDomains[replyDomain] && !freeMailDomains[senderDomain] {
+			score += 10
+			reason += " (a free mail account)"
+		}
+		reasons = append(reasons, reason)
+		break
+	}
+
+	// Lookalike of a domain the user actually corresponds with
+	if lookalike := lookalikeDomain(senderDomain, knownDomains); lookalike != "" {
+		score += 35
+		reasons = append(reasons, fmt.Sprintf("Sender domain %s looks like %s", senderDomain, lookalike))
+	}
+
+	// Payment / account keywords
+	text := e.Subject + "\n" + e.Preview + "\n" + stripHTML(e.Body)
+	if matches := paymentKeywordRE.FindAllString(text, -1); len(matches) > 0 {
+		distinct := map[string]bool{}
+		for _, m := range matches {
+			distinct[strings.ToLower(m)] = true
+		}
+		points := 15 * len(distinct)
+		if points > 30 {
+			points = 30
+		}
+		score += points
+		reasons = append(reasons, fmt.Sprintf("Asks about payments or account access (%q)", matches[0]))
+		if urgencyKeywordRE.MatchString(text) {
+			score += 10
+			reasons = append(reasons, "Pressures for an urgent response")
+		}
+	}
+
+	// Links pointing at raw IP addresses (the body is still HTML here)
+	if ipLinkRE.MatchString(e.Body) || ipLinkRE.MatchString(e.Preview) {
+		score += 25
+		reasons = append(reasons, "Contains links to a raw IP address")
+	}
+
+	return score, reasons
+}
+
+// lookalikeDomain returns the known domain that domain imitates: one or two edits away
+// (paypa1.com, rnicrosoft.com), but not the domain itself
+func lookalikeDomain(domain string, knownDomains []string) string {
+	if len(domain) < 5 {
+		return ""
+	}
+	for _, known := range knownDomains {
+		if known == domain {
+			// mail from the domain itself: not a lookalike whatever else is similar
+			return ""
+		}
+	}
+	for _, known := range knownDomains {
+		if len(known) < 5 || sameOrgDomain(known, domain) || freeMailDomains[domain] {
+			continue
+		}
+		maxEdits := 1
+		if len(known) >= 10 {
+			maxEdits = 2
+		}
+		if d := utils.Levenshtein(domain, known); d > 0 && d <= maxEdits {
+			return known
+		}
+	}
+	return ""
+}
+
+// sameOrgDomain reports whether a and b are equal or one is a subdomain of the other
+func sameOrgDomain(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+// containsWord reports whether word appears in s delimited by non-letters
+func containsWord(s, word string) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		if (start == 0 || !isASCIILetter(s[start-1])) && (end == len(s) || !isASCIILetter(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// ===== LLM check =====
+
+type llmSecurityVerdict struct {
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+func (s *SecurityAnalysisService) llmRisk(ctx context.Context, e *models.Email) (int, string, error) {
+	text := stripHTML(e.Body)
+	if strings.TrimSpace(text) == "" {
+		text = e.Preview
+	}
+	if r := []rune(text); len(r) > 2000 {
+		text = string(r[:2000])
+	}
+	replyTo := ""
+	if len(e.ReplyTo) > 0 {
+		replyTo = e.ReplyTo[0].Email
+	}
+
+	out, err := s.llm.Generate(withOperation(ctx, "security"), LLMRequest{
+		System: `You are an email security analyst. Rate how likely the email is phishing or a scam from 0 (safe) to 100 (certainly malicious).
+Reply with JSON only, no code fences: {"score": number, "reason": "one short sentence"}.`,
+		Prompt:      fmt.Sprintf("From: %s <%s>\nReply-To: %s\nSubject: %s\n\n%s", e.From.Name, e.From.Email, replyTo, e.Subject, text),
+		MaxTokens:   120,
+		Temperature: 0,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	out = strings.TrimSpace(out)
+	if m := jsonFenceRE.FindStringSubmatch(out); m != nil {
+		out = m[1]
+	}
+	var v llmSecurityVerdict
+	if err := utils.ParseJSON(out, &v); err != nil {
+		return 0, "", fmt.Errorf("unexpected security verdict %q", out)
+	}
+	if v.Score < 0 || v.Score > 100 {
+		return 0, "", fmt.Errorf("security score %d out of range", v.Score)
+	}
+	return v.Score, strings.TrimSpace(v.Reason), nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// knownSenders are the user's frequent sender domains in the fixtures below
+var knownSenders = []string{"paypal.com", "acme-corp.com", "vietcombank.com.vn", "github.com"}
+
+func TestSecurityHeuristicFixtures(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       models.Email
+		wantScore   int
+		wantLevel   string
+		wantReasons []string // substrings, in order
+	}{
+		{
+			name:      "colleague",
+			email:     models.Email{From: models.EmailAddress{Name: "Bob", Email: "bob@acme-corp.com"}, Subject: "Lunch?", Body: "See you at noon."},
+			wantScore: 0, wantLevel: models.RiskLow,
+		},
+		{
+			name:      "real PayPal receipt",
+			email:     models.Email{From: models.EmailAddress{Name: "PayPal", Email: "service@mail.paypal.com"}, Subject: "Your receipt", Body: "Thanks for your payment."},
+			wantScore: 0, wantLevel: models.RiskLow,
+		},
+		{
+			name: "Reply-To within the organization",
+			email: models.Email{From: models.EmailAddress{Email: "bob@acme-corp.com"}, ReplyTo: []models.EmailAddress{{Email: "support@help.acme-corp.com"}},
+				Subject: "Ticket update"},
+			wantScore: 0, wantLevel: models.RiskLow,
+		},
+		{
+			name: "PayPal phishing",
+			email: models.Email{
+				From:    models.EmailAddress{Name: "PayPal Support", Email: "service@paypa1.com"},
+				ReplyTo: []models.EmailAddress{{Email: "paypal.help@gmail.com"}},
+				Subject: "Account suspended",
+				Body:    `<p>Your account suspended. Verify your account within 24 hours at <a href="http://192.168.4.20/login">PayPal</a></p>`,
+			},
+			// 25 brand + 30 free-mail Reply-To + 35 lookalike + 30 keywords + 10 urgency + 25 IP link, capped
+			wantScore: 100, wantLevel: models.RiskHigh,
+			wantReasons: []string{`mentions "paypal"`, "paypal.help@gmail.com", "(a free mail account)", "paypa1.com looks like paypal.com",
+				"payments or account access", "urgent response", "raw IP address"},
+		},
+		{
+			name:        "display name shows another address",
+			email:       models.Email{From: models.EmailAddress{Name: "billing@acme-corp.com", Email: "x@evil.io"}, Subject: "Invoice"},
+			wantScore:   30,
+			wantLevel:   models.RiskMedium,
+			wantReasons: []string{"Display name shows billing@acme-corp.com but the message was sent from evil.io"},
+		},
+		{
+			name:        "lookalike two edits away",
+			email:       models.Email{From: models.EmailAddress{Email: "noreply@githbu.com"}, Subject: "New sign-in"},
+			wantScore:   35,
+			wantLevel:   models.RiskMedium,
+			wantReasons: []string{"githbu.com looks like github.com"},
+		},
+		{
+			name: "Vietnamese account scam",
+			email: models.Email{From: models.EmailAddress{Name: "Vietcombank", Email: "canhbao@vietcombank-alert.com"},
+				Subject: "Tài khoản của bạn bị khóa", Body: "Vui lòng xác minh tài khoản ngay lập tức."},
+			wantScore: 40, wantLevel: models.RiskMedium,
+			wantReasons: []string{"payments or account access", "urgent response"},
+		},
+		{
+			name:        "one payment keyword, no pressure",
+			email:       models.Email{From: models.EmailAddress{Email: "billing@shop.example"}, Subject: "Please update your payment method"},
+			wantScore:   15,
+			wantLevel:   models.RiskLow,
+			wantReasons: []string{"payments or account access"},
+		},
+		{
+			name:        "raw IP link",
+			email:       models.Email{From: models.EmailAddress{Email: "ops@acme-corp.com"}, Body: `Dashboard: <a href="http://10.0.0.1:8080/x">here</a>`},
+			wantScore:   25,
+			wantLevel:   models.RiskLow,
+			wantReasons: []string{"raw IP address"},
+		},
+	}
+
+	s := NewSecurityAnalysisService(nil, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := s.Analyze(context.Background(), &tt.email, knownSenders)
+			if a.RiskScore != tt.wantScore || a.RiskLevel != tt.wantLevel {
+				t.Errorf("score = %d (%s), want %d (%s); reasons %q", a.RiskScore, a.RiskLevel, tt.wantScore, tt.wantLevel, a.Reasons)
+			}
+			joined := strings.Join(a.Reasons, "\n")
+			rest := joined
+			for _, want := range tt.wantReasons {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Errorf("reasons %q lack %q (or have it out of order)", a.Reasons, want)
+					break
+				}
+				rest = rest[i+len(want):]
+			}
+			if len(tt.wantReasons) == 0 && len(a.Reasons) != 0 {
+				t.Errorf("reasons = %q, want none", a.Reasons)
+			}
+			if a.Reasons == nil || a.LLMChecked {
+				t.Errorf("Reasons nil = %v, LLMChecked = %v", a.Reasons == nil, a.LLMChecked)
+			}
+		})
+	}
+}
+
+func TestLookalikeDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"paypa1.com", "paypal.com"},
+		{"rnicrosoft.com", ""}, // not a frequent sender here
+		{"paypal.com", ""},
+		{"mail.paypal.com", ""},
+		{"githuv.com", "github.com"},
+		{"gmail.com", ""},
+		{"a.io", ""},
+	}
+	for _, tt := range tests {
+		if got := lookalikeDomain(tt.domain, knownSenders); got != tt.want {
+			t.Errorf("lookalikeDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		s, word string
+		want    bool
+	}{
+		{"paypal support", "paypal", true},
+		{"team apple", "apple", true},
+		{"snapple drinks", "apple", false},
+		{"ups-delivery", "ups", true},
+		{"groups and ups", "ups", true},
+		{"groups", "ups", false},
+	}
+	for _, tt := range tests {
+		if got := containsWord(tt.s, tt.word); got != tt.want {
+			t.Errorf("containsWord(%q, %q) = %v, want %v", tt.s, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestSecurityLLMCheck(t *testing.T) {
+	// 30 from the heuristics: over the LLM threshold
+	suspicious := &models.Email{From: models.EmailAddress{Name: "billing@acme-corp.com", Email: "x@evil.io"}, Subject: "Invoice"}
+	clean := &models.Email{From: models.EmailAddress{Name: "Bob", Email: "bob@acme-corp.com"}, Subject: "Lunch?"}
+
+	tests := []struct {
+		name        string
+		llm         *stubLLM
+		llmCheck    bool
+		email       *models.Email
+		wantScore   int
+		wantChecked bool
+		wantCalls   int32
+	}{
+		{"higher LLM score wins", &stubLLM{reply: `{"score": 90, "reason": "Impersonates the billing team"}`}, true, suspicious, 90, true, 1},
+		{"lower LLM score keeps the heuristics", &stubLLM{reply: "```json\n{\"score\": 5, \"reason\": \"Looks fine\"}\n```"}, true, suspicious, 30, true, 1},
+		{"clean mail skips the LLM", &stubLLM{reply: `{"score": 90}`}, true, clean, 0, false, 0},
+		{"LLM check off", &stubLLM{reply: `{"score": 90}`}, false, suspicious, 30, false, 0},
+		{"LLM error", &stubLLM{err: errors.New("timeout")}, true, suspicious, 30, false, 1},
+		{"out of range verdict", &stubLLM{reply: `{"score": 150}`}, true, suspicious, 30, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSecurityAnalysisService(tt.llm, tt.llmCheck).Analyze(context.Background(), tt.email, knownSenders)
+			if a.RiskScore != tt.wantScore || a.LLMChecked != tt.wantChecked {
+				t.Errorf("score = %d, LLMChecked = %v, want %d, %v", a.RiskScore, a.LLMChecked, tt.wantScore, tt.wantChecked)
+			}
+			if n := tt.llm.calls.Load(); n != tt.wantCalls {
+				t.Errorf("LLM calls = %d, want %d", n, tt.wantCalls)
+			}
+			if tt.wantChecked && !strings.HasPrefix(a.Reasons[len(a.Reasons)-1], "AI review: ") {
+				t.Errorf("reasons = %q, want the AI review last", a.Reasons)
+			}
+		})
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/repository"
 	"context"
+	"errors"
 	"log"
 	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // StartSnoozeWorker starts a background goroutine that periodically checks for snoozed emails
-// that are due and restores them to Inbox. The worker stops when ctx is done.
-func StartSnoozeWorker(ctx context.Context, interval time.Duration, repo *repository.EmailRepository) {
+// that are due and restores them to Inbox; recurring snoozes are moved to their next
+// occurrence instead. Each wake-up notifies the user, in the app and through Web Push (push
+// may be nil); restored emails are also sent to the user's webhook (webhooks may be nil).
+// The worker stops when ctx is done.
+func StartSnoozeWorker(ctx context.Context, interval time.Duration, repo *repository.EmailRepository, notifications *repository.NotificationRepository, push *PushService, webhooks *WebhookService) {
 	ticker := time.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
@@ -27,12 +33,58 @@ func StartSnoozeWorker(ctx context.Context, interval time.Duration, repo *reposi
 					continue
 				}
 				for _, e := range due {
-					// restore to inbox and clear snoozedUntil via UpdateStatus
-					if err := repo.UpdateStatus(ctx, e.ID, string(models.StatusInbox)); err != nil {
-						log.Println("snooze worker: failed to restore email:", e.ID, err)
-					}
+					wakeSnoozed(ctx, repo, notifications, push, webhooks, e, now)
 				}
 			}
 		}
 	}()
 }
+
+// wakeSnoozed handles one due snooze: a recurring one is snoozed again until its next
+// occurrence, any other is restored to Inbox (clearing snoozedUntil via UpdateStatus). The
+// user is notified once the email is updated.
+func wakeSnoozed(ctx context.Context, repo *repository.EmailRepository, notifications *repository.NotificationRepository, push *PushService, webhooks *WebhookService, e models.Email, now time.Time) {
+	kind := models.NotificationSnoozeReturned
+	if models.ValidSnoozeRecurrence(e.SnoozeRecurrence) && e.SnoozedUntil != nil {
+		next := e.SnoozeRecurrence.Next(*e.SnoozedUntil, now)
+		if err := repo.Resnooze(ctx, e.ID, *e.SnoozedUntil, next); err != nil {
+			// ErrNoDocuments: the user moved or re-snoozed the card meanwhile
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Println("snooze worker: failed to re-snooze email:", e.ID, err)
+			}
+			return
+		}
+		kind = models.NotificationSnoozeRecurred
+	} else if err := repo.UpdateStatus(ctx, e.ID, string(models.StatusInbox)); err != nil {
+		log.Println("snooze worker: failed to restore email:", e.ID, err)
+		return
+	}
+
+	if e.UserID == "" {
+		return
+	}
+	if notifications != nil {
+		if err := notifications.Create(ctx, &models.Notification{
+			UserID:  e.UserID,
+			Type:    kind,
+			EmailID: e.ID,
+			Subject: e.Subject,
+		}); err != nil {
+			log.Println("snooze worker: failed to notify user:", e.UserID, err)
+		}
+	}
+	title := "A snoozed email is back in your inbox"
+	if kind == models.NotificationSnoozeRecurred {
+		title = "A recurring snooze is due"
+	}
+	push.Notify(ctx, e.UserID, models.PushMessage{Type: kind, Title: title, Body: e.Subject, EmailID: e.ID})
+	if kind == models.NotificationSnoozeReturned {
+		webhooks.Emit(ctx, e.UserID, models.WebhookEmailUnsnoozed, models.WebhookEmailChange{
+			EmailID:    e.ID,
+			Subject:    e.Subject,
+			From:       e.From.Email,
+			FromStatus: models.StatusSnoozed,
+			ToStatus:   models.StatusInbox,
+		})
+	}
+}
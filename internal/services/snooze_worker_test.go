@@ -0,0 +1,128 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWakeSnoozed(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := repository.NewEmailRepository(db)
+	notifications := repository.NewNotificationRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	due := now.Add(-time.Hour)
+	emails := []interface{}{
+		bson.M{"_id": "daily", "userId": "u1", "subject": "Standup notes", "status": "snoozed", "snoozedUntil": due, "snoozeRecurrence": "daily"},
+		bson.M{"_id": "weekly-late", "userId": "u1", "subject": "Report", "status": "snoozed", "snoozedUntil": due.AddDate(0, 0, -15), "snoozeRecurrence": "weekly"},
+		bson.M{"_id": "once", "userId": "u1", "subject": "Reminder", "status": "snoozed", "snoozedUntil": due, "snoozePreset": "tomorrow_morning"},
+		bson.M{"_id": "later", "userId": "u1", "status": "snoozed", "snoozedUntil": now.Add(time.Hour), "snoozeRecurrence": "daily"},
+	}
+	if _, err := db.Collection("emails").InsertMany(ctx, emails); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := repo.ListSnoozedDue(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 3 {
+		t.Fatalf("ListSnoozedDue returned %d emails, want 3", len(listed))
+	}
+	for _, e := range listed {
+		wakeSnoozed(ctx, repo, notifications, nil, nil, e, now)
+	}
+
+	get := func(id string) *models.Email {
+		t.Helper()
+		e, err := repo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// Recurring snoozes stay snoozed until their next occurrence
+	if e := get("daily"); e.Status != models.StatusSnoozed || e.SnoozedUntil == nil || !e.SnoozedUntil.Equal(due.AddDate(0, 0, 1)) {
+		t.Errorf("daily: status %q, snoozedUntil %v; want snoozed until %v", e.Status, e.SnoozedUntil, due.AddDate(0, 0, 1))
+	}
+	if e := get("weekly-late"); e.Status != models.StatusSnoozed || e.SnoozedUntil == nil || !e.SnoozedUntil.Equal(due.AddDate(0, 0, 6)) {
+		t.Errorf("weekly-late: status %q, snoozedUntil %v; want snoozed until %v", e.Status, e.SnoozedUntil, due.AddDate(0, 0, 6))
+	}
+	if e := get("daily"); e.SnoozeRecurrence != models.SnoozeDaily {
+		t.Errorf("daily: recurrence %q was not kept", e.SnoozeRecurrence)
+	}
+
+	// A one-off snooze returns to the inbox and loses its snooze fields
+	if e := get("once"); e.Status != models.StatusInbox || e.SnoozedUntil != nil || e.SnoozePreset != "" {
+		t.Errorf("once: status %q, snoozedUntil %v, preset %q; want restored to inbox", e.Status, e.SnoozedUntil, e.SnoozePreset)
+	}
+	if e := get("later"); e.SnoozedUntil == nil || !e.SnoozedUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("later: snoozedUntil changed to %v", e.SnoozedUntil)
+	}
+
+	list, _, err := notifications.List(ctx, "u1", "", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]models.NotificationType{}
+	for _, n := range list {
+		kinds[n.EmailID] = n.Type
+	}
+	want := map[string]models.NotificationType{
+		"daily":       models.NotificationSnoozeRecurred,
+		"weekly-late": models.NotificationSnoozeRecurred,
+		"once":        models.NotificationSnoozeReturned,
+	}
+	if len(kinds) != len(want) {
+		t.Errorf("notifications = %v, want %v", kinds, want)
+	}
+	for id, kind := range want {
+		if kinds[id] != kind {
+			t.Errorf("%s: notification %q, want %q", id, kinds[id], kind)
+		}
+	}
+}
+
+func TestWakeSnoozedAfterManualMove(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := repository.NewEmailRepository(db)
+	notifications := repository.NewNotificationRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	due := now.Add(-time.Hour)
+	if _, err := db.Collection("emails").InsertOne(ctx, bson.M{
+		"_id": "daily", "userId": "u1", "status": "snoozed", "snoozedUntil": due, "snoozeRecurrence": "daily",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := repo.ListSnoozedDue(ctx, now)
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("ListSnoozedDue = %d emails, %v", len(listed), err)
+	}
+
+	// The user moves the card between the listing and the wake-up: the recurrence ends
+	if err := repo.UpdateStatus(ctx, "daily", string(models.StatusTodo)); err != nil {
+		t.Fatal(err)
+	}
+	wakeSnoozed(ctx, repo, notifications, nil, nil, listed[0], now)
+
+	e, err := repo.GetByID(ctx, "daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != models.StatusTodo || e.SnoozedUntil != nil || e.SnoozeRecurrence != "" {
+		t.Errorf("status %q, snoozedUntil %v, recurrence %q; want the manual move kept", e.Status, e.SnoozedUntil, e.SnoozeRecurrence)
+	}
+	if n, _ := notifications.CountUnread(ctx, "u1"); n != 0 {
+		t.Errorf("%d notifications sent for a card the user moved", n)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Summary languages
+const (
+	SummaryLanguageAuto = "auto"
+	SummaryLanguageEN   = "en"
+	SummaryLanguageVI   = "vi"
+)
+
+// Summary lengths
+const (
+	SummaryLengthShort    = "short"
+	SummaryLengthMedium   = "medium"
+	SummaryLengthDetailed = "detailed"
+)
+
+// SummaryOptions controls the language and size of a generated summary.
+// Zero values mean "auto" and "short" (the card default).
+type SummaryOptions struct {
+	Language string `json:"language"`
+	Length   string `json:"length"`
+}
+
+// summaryLengthSpec maps a length to prompt wording, LLM token budget and extractive limits
+type summaryLengthSpec struct {
+	instruction  string
+	maxTokens    int
+	topSentences int
+	maxChars     int
+}
+
+var summaryLengths = map[string]summaryLengthSpec{
+	SummaryLengthShort:    {"in 1-2 very short sentences (max 100 characters total). Be extremely concise", 80, 2, 120},
+	SummaryLengthMedium:   {"in 2-3 sentences (max 300 characters total), keeping the main request or decision", 160, 3, 300},
+	SummaryLengthDetailed: {"in up to 5 sentences covering the key points, requests and deadlines", 320, 5, 600},
+}
+
+var summaryLanguageNames = map[string]string{
+	SummaryLanguageEN: "English",
+	SummaryLanguageVI: "Vietnamese",
+}
+
+// Normalize fills defaults and validates the options
+func (o SummaryOptions) Normalize() (SummaryOptions, error) {
+	o.Language = strings.ToLower(strings.TrimSpace(o.Language))
+	o.Length = strings.ToLower(strings.TrimSpace(o.Length))
+	if o.Language == "" {
+		o.Language = SummaryLanguageAuto
+	}
+	if o.Length == "" {
+		o.Length = SummaryLengthShort
+	}
+	if _, ok := summaryLanguageNames[o.Language]; !ok && o.Language != SummaryLanguageAuto {
+		return o, fmt.Errorf("invalid language %q (use auto, en or vi)", o.Language)
+	}
+	if _, ok := summaryLengths[o.Length]; !ok {
+		return o, fmt.Errorf("invalid length %q (use short, medium or detailed)", o.Length)
+	}
+	return o, nil
+}
+
+// resolve replaces "auto" with the language detected from text
+func (o SummaryOptions) resolve(text string) SummaryOptions {
+	if o.Language == SummaryLanguageAuto {
+		o.Language = detectLanguage(text)
+	}
+	return o
+}
+
+// buildSummaryPrompt returns the provider request for the (resolved) options
+func buildSummaryPrompt(text string, o SummaryOptions) LLMRequest {
+	spec := summaryLengths[o.Length]
+	lang := summaryLanguageNames[o.Language]
+	return LLMRequest{
+		System:      fmt.Sprintf("You are a concise email summarizer. Always answer in %s, regardless of the email's language.", lang),
+		Prompt:      fmt.Sprintf("Summarize this email %s. Write the summary in %s:\n\n%s", spec.instruction, lang, text),
+		MaxTokens:   spec.maxTokens,
+		Temperature: 0.2,
+	}
+}
+
+// vietnameseLetters are letters that only occur in Vietnamese among the languages we see
+// (base letters with horn/breve/stroke plus tone-marked vowels)
+const vietnameseLetters = "ăâđêôơưàảãạằẳẵặầẩẫậèẻẽẹềểễệìỉĩịòỏõọồổỗộờởỡợùủũụừửữựỳỷỹỵ"
+
+// detectLanguage returns "vi" when Vietnamese-specific letters make up a noticeable share of
+// the letters in text, otherwise "en"
+func detectLanguage(text string) string {
+	letters, vietnamese := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if strings.ContainsRune(vietnameseLetters, unicode.ToLower(r)) {
+			vietnamese++
+		}
+	}
+	// Vietnamese prose has diacritics on roughly a third of its letters; 5% tolerates names
+	// and quoted English
+	if letters > 0 && vietnamese*20 >= letters {
+		return SummaryLanguageVI
+	}
+	return SummaryLanguageEN
+}
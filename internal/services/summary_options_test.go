@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBuildSummaryPromptCombinations(t *testing.T) {
+	const english = "The contract renewal is due next Monday. Legal needs the signed copy by Friday."
+	const vietnamese = "Hợp đồng thuê nhà sẽ hết hạn vào thứ Hai tới. Vui lòng gửi bản ký trước thứ Sáu."
+
+	languages := []struct {
+		language string
+		body     string
+		wantName string
+	}{
+		{SummaryLanguageEN, vietnamese, "English"},
+		{SummaryLanguageVI, english, "Vietnamese"},
+		{SummaryLanguageAuto, english, "English"},
+		{SummaryLanguageAuto, vietnamese, "Vietnamese"},
+	}
+	lengths := []struct {
+		length      string
+		instruction string
+		maxTokens   int
+	}{
+		{SummaryLengthShort, "in 1-2 very short sentences (max 100 characters total)", 80},
+		{SummaryLengthMedium, "in 2-3 sentences (max 300 characters total)", 160},
+		{SummaryLengthDetailed, "in up to 5 sentences covering the key points", 320},
+	}
+
+	for _, lang := range languages {
+		for _, l := range lengths {
+			name := lang.language + "/" + l.length + "/" + lang.wantName
+			opts, err := SummaryOptions{Language: lang.language, Length: l.length}.Normalize()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			req := buildSummaryPrompt(lang.body, opts.resolve(lang.body))
+
+			if !strings.Contains(req.System, "Always answer in "+lang.wantName) {
+				t.Errorf("%s: system prompt %q doesn't ask for %s", name, req.System, lang.wantName)
+			}
+			if !strings.Contains(req.Prompt, "Summarize this email "+l.instruction) {
+				t.Errorf("%s: prompt %q lacks the %s instruction", name, req.Prompt, l.length)
+			}
+			if !strings.Contains(req.Prompt, "Write the summary in "+lang.wantName+":") {
+				t.Errorf("%s: prompt %q doesn't name %s", name, req.Prompt, lang.wantName)
+			}
+			if !strings.HasSuffix(req.Prompt, "\n\n"+lang.body) {
+				t.Errorf("%s: prompt doesn't end with the email", name)
+			}
+			if req.MaxTokens != l.maxTokens {
+				t.Errorf("%s: MaxTokens = %d, want %d", name, req.MaxTokens, l.maxTokens)
+			}
+			for _, other := range lengths {
+				if other.length != l.length && strings.Contains(req.Prompt, other.instruction) {
+					t.Errorf("%s: prompt also has the %s instruction", name, other.length)
+				}
+			}
+		}
+	}
+}
+
+func TestSummaryOptionsNormalize(t *testing.T) {
+	tests := []struct {
+		in      SummaryOptions
+		want    SummaryOptions
+		wantErr bool
+	}{
+		{SummaryOptions{}, SummaryOptions{Language: "auto", Length: "short"}, false},
+		{SummaryOptions{Language: " VI ", Length: "Detailed"}, SummaryOptions{Language: "vi", Length: "detailed"}, false},
+		{SummaryOptions{Language: "fr"}, SummaryOptions{}, true},
+		{SummaryOptions{Length: "long"}, SummaryOptions{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.in.Normalize()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Normalize(%+v) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("Normalize(%+v) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Please review the attached invoice.", "en"},
+		{"Xin chào, vui lòng xem hóa đơn đính kèm.", "vi"},
+		{"Meeting with Nguyễn about the Q3 roadmap, budget, hiring and the offsite agenda.", "en"},
+		{"", "en"},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// Without a provider each length caps the extractive summary
+func TestExtractiveSummaryLengths(t *testing.T) {
+	text := strings.Repeat("The budget review covers marketing, sales and hiring plans for the next quarter. ", 10)
+	s := NewSummaryService(nil, nil, nil, nil, nil, nil)
+	prev := 0
+	for _, length := range []string{SummaryLengthShort, SummaryLengthMedium, SummaryLengthDetailed} {
+		got, err := s.SummarizeText(context.Background(), text, SummaryOptions{Length: length})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limit := summaryLengths[length].maxChars; len(got) > limit || len(got) <= prev {
+			t.Errorf("%s summary is %d chars, want more than %d and at most %d", length, len(got), prev, limit)
+		}
+		prev = len(got)
+	}
+}
@@ -1,51 +1,76 @@
 package services
 
 import (
+	"aiemailbox-be/internal/models"
 	"aiemailbox-be/internal/repository"
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"html"
-	"io"
-	"net/http"
 	"regexp"
 	"sort"
 	"strings"
-	"time"
+	"sync/atomic"
 )
 
 // SummaryService provides summary generation for emails.
 type SummaryService interface {
-	SummarizeText(ctx context.Context, text string) (string, error)
-	SummarizeAndSave(ctx context.Context, emailID string) (string, error)
+	SummarizeText(ctx context.Context, text string, opts SummaryOptions) (string, error)
+	SummarizeAndSave(ctx context.Context, emailID string, opts SummaryOptions) (string, error)
+	SummarizeThread(ctx context.Context, userID, threadID string) (*models.ThreadSummary, error)
+	CacheStats() SummaryCacheStats
 }
 
-// LocalSummaryService implements SummaryService with a local extractor and optional OpenAI provider.
+// SummaryCacheStats counts summary cache lookups since startup
+type SummaryCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// LocalSummaryService implements SummaryService with a local extractor and an optional LLM provider.
 type LocalSummaryService struct {
-	repo     *repository.EmailRepository
-	apiKey   string
-	provider string
-	model    string
-	client   *http.Client
+	repo  *repository.EmailRepository
+	llm   LLMProvider
+	cache *repository.SummaryCacheRepository // nil disables caching
+	// Thread summaries are stored per thread; threads fills in messages missing locally
+	threadSummaries *repository.ThreadSummaryRepository
+	threads         ThreadSource
+	// Prompt templates of the users; nil always uses the built-in prompt
+	templates *PromptTemplateStore
+
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
 }
 
-// NewSummaryService creates a new summary service. If apiKey is empty, it runs purely local extractor.
-func NewSummaryService(repo *repository.EmailRepository, apiKey, provider, model string) SummaryService {
+// NewSummaryService creates a new summary service. llm may be nil, in which case it runs purely
+// the local extractor. LLM summaries are
+// cached by body hash and model when cache is non-nil. Thread summaries are stored in
+// threadSummaries and threads (optional) loads conversations that are not fully cached.
+// templates (optional) supplies the user's prompt template for LLM email summaries.
+func NewSummaryService(repo *repository.EmailRepository, cache *repository.SummaryCacheRepository, threadSummaries *repository.ThreadSummaryRepository, threads ThreadSource, llm LLMProvider, templates *PromptTemplateStore) SummaryService {
 	return &LocalSummaryService{
-		repo:     repo,
-		apiKey:   apiKey,
-		provider: strings.ToLower(provider),
-		model:    model,
-		client: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+		repo:            repo,
+		llm:             llm,
+		cache:           cache,
+		threadSummaries: threadSummaries,
+		threads:         threads,
+		templates:       templates,
 	}
 }
 
-// SummarizeAndSave fetches an email by id, generates a summary and saves it to DB.
-func (s *LocalSummaryService) SummarizeAndSave(ctx context.Context, emailID string) (string, error) {
+// CacheStats returns the summary cache hit/miss counters
+func (s *LocalSummaryService) CacheStats() SummaryCacheStats {
+	return SummaryCacheStats{Hits: s.cacheHits.Load(), Misses: s.cacheMisses.Load()}
+}
+
+// SummarizeAndSave fetches an email by id, generates a summary and saves it to DB together
+// with the options used (with "auto" resolved to the detected language).
+func (s *LocalSummaryService) SummarizeAndSave(ctx context.Context, emailID string, opts SummaryOptions) (string, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return "", err
+	}
 	email, err := s.repo.GetByID(ctx, emailID)
 	if err != nil {
 		return "", err
@@ -58,167 +83,108 @@ func (s *LocalSummaryService) SummarizeAndSave(ctx context.Context, emailID stri
 
 	// Clean HTML
 	text = stripHTML(text)
+	opts = opts.resolve(text)
 
-	summary, err := s.SummarizeText(ctx, text)
+	meta := summaryEmail{userID: email.UserID, subject: email.Subject, sender: email.From}
+	summary, err := s.summarizeCached(ctx, text, meta, opts)
 	if err != nil {
 		return "", err
 	}
-	if err := s.repo.SetSummary(ctx, emailID, summary); err != nil {
+	if err := s.repo.SetSummary(ctx, emailID, summary, opts.Language, opts.Length); err != nil {
 		return "", err
 	}
 	return summary, nil
 }
 
-// SummarizeText returns a summary for given text. If an API key is present and provider is supported, it will call the provider.
-func (s *LocalSummaryService) SummarizeText(ctx context.Context, text string) (string, error) {
+// summarizeCached looks up LLM summaries by the SHA-256 of the normalized text before calling
+// the provider. Extractive fallbacks are free and never cached.
+func (s *LocalSummaryService) summarizeCached(ctx context.Context, text string, meta summaryEmail, opts SummaryOptions) (string, error) {
 	if strings.TrimSpace(text) == "" {
 		return "", nil
 	}
-
-	// If API key present, attempt provider call
-	if s.apiKey != "" {
-		switch s.provider {
-		case "gemini":
-			summ, err := s.callGemini(ctx, text)
-			if err == nil && strings.TrimSpace(summ) != "" {
-				return summ, nil
-			}
-			fmt.Printf("Gemini summary failed, falling back: %v\n", err)
-		case "", "openai":
-			summ, err := s.callOpenAI(ctx, text)
-			if err == nil && strings.TrimSpace(summ) != "" {
-				return summ, nil
-			}
-		}
+	req, templated := s.summaryPrompt(ctx, text, meta, opts)
+	if s.cache == nil || s.llm == nil {
+		summary, _ := s.summarize(ctx, text, req, opts)
+		return summary, nil
 	}
 
-	// Local extractive summarizer (free) - limited to ~120 chars to fit 3 lines on card
-	return extractiveSummary(text, 2, 120), nil
-}
-
-// callGemini calls Google Gemini API. Returns summary or error.
-func (s *LocalSummaryService) callGemini(ctx context.Context, text string) (string, error) {
-	// Use configured model or default to gemini-1.5-flash for speed and efficiency
-	model := s.model
-	if model == "" {
-		model = "gemini-1.5-flash"
+	hash := bodyHash(text)
+	if templated {
+		// A template may add the subject or sender, and its edits must not hit old summaries
+		hash = bodyHash(req.System + "\n" + req.Prompt)
 	}
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, s.apiKey)
-
-	reqBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": "Summarize this email in 1-2 very short sentences (max 100 characters total). Be extremely concise:\n\n" + text},
-				},
-			},
-		},
-		"generationConfig": map[string]interface{}{
-			"temperature":     0.2,
-			"maxOutputTokens": 80,
-		},
+	// The options are part of the key: a short English summary doesn't answer a detailed Vietnamese request
+	model := s.llm.Name() + "/" + s.llm.Model() + "/" + opts.Language + "/" + opts.Length
+	if cached, ok, err := s.cache.Get(ctx, hash, model); err != nil {
+		fmt.Printf("Summary cache lookup failed: %v\n", err)
+	} else if ok {
+		s.cacheHits.Add(1)
+		return cached, nil
 	}
+	s.cacheMisses.Add(1)
 
-	b, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
+	summary, fromLLM := s.summarize(ctx, text, req, opts)
+	if fromLLM {
+		if err := s.cache.Put(ctx, hash, model, summary); err != nil {
+			fmt.Printf("Summary cache store failed: %v\n", err)
+		}
 	}
+	return summary, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
+// bodyHash returns the hex SHA-256 of text with whitespace collapsed
+func bodyHash(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
 
-	resp, err := s.client.Do(req)
+// SummarizeText returns a summary for given text. If an LLM provider is configured it is tried first.
+func (s *LocalSummaryService) SummarizeText(ctx context.Context, text string, opts SummaryOptions) (string, error) {
+	opts, err := opts.Normalize()
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var parsed struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return "", err
-	}
-
-	if len(parsed.Candidates) > 0 && len(parsed.Candidates[0].Content.Parts) > 0 {
-		return strings.TrimSpace(parsed.Candidates[0].Content.Parts[0].Text), nil
+	if strings.TrimSpace(text) == "" {
+		return "", nil
 	}
-	return "", errors.New("no content in Gemini response")
+	opts = opts.resolve(text)
+	req, _ := s.summaryPrompt(ctx, text, summaryEmail{}, opts)
+	summary, _ := s.summarize(ctx, text, req, opts)
+	return summary, nil
 }
 
-// callOpenAI calls OpenAI Chat Completions API (simple implementation). Returns summary or error.
-func (s *LocalSummaryService) callOpenAI(ctx context.Context, text string) (string, error) {
-	type message struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}
-	model := s.model
-	if model == "" {
-		model = "gpt-3.5-turbo"
-	}
-	reqBody := map[string]interface{}{
-		"model": model,
-		"messages": []message{
-			{Role: "system", Content: "You are a concise email summarizer. Return a very short summary (1-2 sentences, max 100 characters)."},
-			{Role: "user", Content: "Summarize this email in 1-2 very short sentences (max 100 chars):\n\n" + text},
-		},
-		"max_tokens":  80,
-		"temperature": 0.2,
+// summaryPrompt renders the user's active prompt template (or the default template), falling
+// back to the built-in prompt without one. templated reports whether a template was used.
+func (s *LocalSummaryService) summaryPrompt(ctx context.Context, text string, meta summaryEmail, opts SummaryOptions) (req LLMRequest, templated bool) {
+	if s.templates != nil && s.llm != nil {
+		if tpl := s.templates.Active(ctx, meta.userID); tpl != nil {
+			req, err := renderSummaryTemplate(tpl, text, meta, opts)
+			if err == nil {
+				return req, true
+			}
+			fmt.Printf("prompt template %s failed, using the built-in prompt: %v\n", tpl.ID.Hex(), err)
+		}
 	}
+	return buildSummaryPrompt(text, opts), false
+}
 
-	b, _ := json.Marshal(reqBody)
-
-	// simple retry
-	var lastErr error
-	for attempt := 0; attempt < 2; attempt++ {
-		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(string(b)))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+s.apiKey)
-
-		resp, err := s.client.Do(req)
-		if err != nil {
-			lastErr = err
-			time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-			continue
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode >= 400 {
-			lastErr = errors.New(resp.Status)
-			time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
-			continue
-		}
-		var parsed struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
+// summarize sends req to the LLM provider and falls back to the extractive summarizer.
+// fromLLM reports whether the provider produced the summary.
+// opts must be normalized and resolved.
+func (s *LocalSummaryService) summarize(ctx context.Context, text string, req LLMRequest, opts SummaryOptions) (summary string, fromLLM bool) {
+	// If a provider is configured, attempt an LLM summary
+	if s.llm != nil {
+		summ, err := s.llm.Generate(withOperation(ctx, "summary"), req)
+		if err == nil && strings.TrimSpace(summ) != "" {
+			return summ, true
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-			lastErr = err
-			continue
-		}
-		if len(parsed.Choices) > 0 {
-			return strings.TrimSpace(parsed.Choices[0].Message.Content), nil
-		}
-		lastErr = errors.New("no choices in response")
+		fmt.Printf("%s summary failed, falling back: %v\n", s.llm.Name(), err)
 	}
-	return "", lastErr
+
+	// Local extractive summarizer (free); "short" is limited to ~120 chars to fit 3 lines on card.
+	// It copies sentences from the email, so it is always in the email's own language.
+	spec := summaryLengths[opts.Length]
+	return extractiveSummary(text, spec.topSentences, spec.maxChars), false
 }
 
 // ===== Extractive summarizer (simple, free) =====
@@ -226,18 +192,34 @@ func (s *LocalSummaryService) callOpenAI(ctx context.Context, text string) (stri
 var sentenceSplitRE = regexp.MustCompile(`(?m)([^.!?\n]+[.!?]?)`)
 
 func extractiveSummary(text string, topSentences int, maxChars int) string {
+	_, summary := ScoreExtractiveSentences(text, topSentences, maxChars)
+	return summary
+}
+
+// ScoredSentence is a single sentence considered by the extractive summarizer
+type ScoredSentence struct {
+	Index  int     `json:"index"`
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+	Chosen bool    `json:"chosen"`
+}
+
+// ScoreExtractiveSentences runs the extractive summarizer and returns every candidate
+// sentence (in original order) with its score and whether it made it into the summary,
+// along with the resulting summary. Useful for tuning topSentences/maxChars.
+func ScoreExtractiveSentences(text string, topSentences int, maxChars int) ([]ScoredSentence, string) {
 	text = strings.TrimSpace(text)
 	if text == "" {
-		return ""
+		return nil, ""
 	}
 	// split into sentences
 	matches := sentenceSplitRE.FindAllString(text, -1)
 	if len(matches) == 0 {
 		// fallback: truncate
 		if len(text) > maxChars {
-			return text[:maxChars]
+			return nil, text[:maxChars]
 		}
-		return text
+		return nil, text
 	}
 
 	// build frequency map
@@ -253,22 +235,25 @@ func extractiveSummary(text string, topSentences int, maxChars int) string {
 			totalWords++
 		}
 	}
+
+	sentences := make([]ScoredSentence, len(matches))
+	for i, s := range matches {
+		sentences[i] = ScoredSentence{Index: i, Text: strings.TrimSpace(s)}
+	}
+
 	if totalWords == 0 {
-		// fallback
+		// fallback: every sentence is used as-is
+		for i := range sentences {
+			sentences[i].Chosen = true
+		}
 		out := strings.Join(matches, " ")
 		if len(out) > maxChars {
-			return out[:maxChars]
+			return sentences, out[:maxChars]
 		}
-		return out
+		return sentences, out
 	}
 
 	// score sentences
-	type sscore struct {
-		idx   int
-		score float64
-		text  string
-	}
-	var scores []sscore
 	for i, s := range matches {
 		sc := 0.0
 		words := wordRE.FindAllString(strings.ToLower(s), -1)
@@ -278,32 +263,38 @@ func extractiveSummary(text string, topSentences int, maxChars int) string {
 		if len(words) > 0 {
 			sc = sc / float64(len(words))
 		}
-		scores = append(scores, sscore{idx: i, score: sc, text: strings.TrimSpace(s)})
+		sentences[i].Score = sc
 	}
 
 	// pick top sentences
-	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
-	if topSentences > len(scores) {
-		topSentences = len(scores)
+	ranked := make([]int, len(sentences))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return sentences[ranked[i]].Score > sentences[ranked[j]].Score })
+	if topSentences > len(ranked) {
+		topSentences = len(ranked)
 	}
-	chosen := scores[:topSentences]
+	chosen := ranked[:topSentences]
 	// restore original order
-	sort.Slice(chosen, func(i, j int) bool { return chosen[i].idx < chosen[j].idx })
+	sort.Ints(chosen)
 
 	var parts []string
 	outLen := 0
-	for _, c := range chosen {
-		if outLen+len(c.text) > maxChars && outLen > 0 {
+	for _, idx := range chosen {
+		c := sentences[idx]
+		if outLen+len(c.Text) > maxChars && outLen > 0 {
 			break
 		}
-		parts = append(parts, c.text)
-		outLen += len(c.text)
+		parts = append(parts, c.Text)
+		sentences[idx].Chosen = true
+		outLen += len(c.Text)
 	}
 	result := strings.Join(parts, " ")
 	if len(result) > maxChars {
 		result = result[:maxChars]
 	}
-	return strings.TrimSpace(result)
+	return sentences, strings.TrimSpace(result)
 }
 
 // stripHTML removes HTML tags, scripts, and styles from text
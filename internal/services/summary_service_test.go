@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestScoreExtractiveSentencesShape(t *testing.T) {
+	text := "The quarterly budget review is on Friday. Please send the budget numbers before the review. " +
+		"Lunch will be provided. The budget review covers marketing and sales."
+
+	sentences, summary := ScoreExtractiveSentences(text, 2, 200)
+	if len(sentences) != 4 {
+		t.Fatalf("got %d sentences, want 4: %+v", len(sentences), sentences)
+	}
+
+	chosen := 0
+	for i, s := range sentences {
+		if s.Index != i {
+			t.Errorf("sentence %d has index %d; sentences must keep their original order", i, s.Index)
+		}
+		if s.Text == "" || s.Text != strings.TrimSpace(s.Text) {
+			t.Errorf("sentence %d text %q is empty or untrimmed", i, s.Text)
+		}
+		if s.Score < 0 {
+			t.Errorf("sentence %d has negative score %v", i, s.Score)
+		}
+		if s.Chosen {
+			chosen++
+			if !strings.Contains(summary, s.Text) {
+				t.Errorf("chosen sentence %q missing from summary %q", s.Text, summary)
+			}
+		} else if strings.Contains(summary, s.Text) {
+			t.Errorf("unchosen sentence %q appears in summary %q", s.Text, summary)
+		}
+	}
+	if chosen != 2 {
+		t.Errorf("%d sentences chosen, want topSentences = 2", chosen)
+	}
+	// "Lunch will be provided." shares no frequent words and must rank below the budget sentences
+	if sentences[2].Chosen || sentences[2].Score >= sentences[0].Score {
+		t.Errorf("off-topic sentence scored %v (chosen %v), first sentence %v", sentences[2].Score, sentences[2].Chosen, sentences[0].Score)
+	}
+	if summary != extractiveSummary(text, 2, 200) {
+		t.Errorf("summary %q differs from extractiveSummary", summary)
+	}
+}
+
+func TestScoreExtractiveSentencesMaxChars(t *testing.T) {
+	text := "Alpha beta gamma delta epsilon. Alpha beta gamma zeta eta. Theta iota kappa alpha beta."
+	sentences, summary := ScoreExtractiveSentences(text, 3, 40)
+	if len(summary) > 40 {
+		t.Errorf("summary %q is longer than maxChars 40", summary)
+	}
+	chosen := 0
+	for _, s := range sentences {
+		if s.Chosen {
+			chosen++
+		}
+	}
+	if chosen == 0 || chosen == 3 {
+		t.Errorf("%d sentences chosen; maxChars should keep some but not all", chosen)
+	}
+}
+
+func TestScoreExtractiveSentencesEmpty(t *testing.T) {
+	sentences, summary := ScoreExtractiveSentences("   ", 2, 120)
+	if sentences != nil || summary != "" {
+		t.Errorf("got %+v, %q for blank text; want nil, empty", sentences, summary)
+	}
+}
+
+// stubLLM is an LLMProvider answering every request with reply (or err), counting calls
+type stubLLM struct {
+	reply string
+	err   error
+	model string // "stub-1" when empty
+	calls atomic.Int32
+	last  LLMRequest
+}
+
+func (p *stubLLM) Name() string { return "stub" }
+
+func (p *stubLLM) Model() string {
+	if p.model == "" {
+		return "stub-1"
+	}
+	return p.model
+}
+
+func (p *stubLLM) Generate(_ context.Context, req LLMRequest) (string, error) {
+	p.calls.Add(1)
+	p.last = req
+	return p.reply, p.err
+}
+
+func TestSummaryCache(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	llm := &stubLLM{reply: "Weekly digest of team news."}
+	s := NewSummaryService(nil, repository.NewSummaryCacheRepository(db), nil, nil, llm, nil).(*LocalSummaryService)
+
+	body := "This week the team shipped the new inbox. Please review the release notes before Friday."
+	opts, _ := SummaryOptions{Language: SummaryLanguageEN}.Normalize()
+	summarize := func(text string, opts SummaryOptions, wantCalls int32, wantStats SummaryCacheStats) {
+		t.Helper()
+		got, err := s.summarizeCached(ctx, text, summaryEmail{}, opts)
+		if err != nil || got != llm.reply {
+			t.Fatalf("summary = %q, %v, want %q", got, err, llm.reply)
+		}
+		if n := llm.calls.Load(); n != wantCalls {
+			t.Fatalf("LLM calls = %d, want %d", n, wantCalls)
+		}
+		if stats := s.CacheStats(); stats != wantStats {
+			t.Fatalf("cache stats = %+v, want %+v", stats, wantStats)
+		}
+	}
+
+	summarize(body, opts, 1, SummaryCacheStats{Misses: 1})
+	// Same body with different whitespace: a hit, the provider is not called again
+	summarize("  "+strings.ReplaceAll(body, " ", "\n "), opts, 1, SummaryCacheStats{Hits: 1, Misses: 1})
+	// Other options or another body: misses
+	detailed, _ := SummaryOptions{Language: SummaryLanguageEN, Length: SummaryLengthDetailed}.Normalize()
+	summarize(body, detailed, 2, SummaryCacheStats{Hits: 1, Misses: 2})
+	summarize(body+" Thanks.", opts, 3, SummaryCacheStats{Hits: 1, Misses: 3})
+
+	// Entries past the TTL are misses even before the TTL monitor deletes them
+	expired := time.Now().Add(-repository.SummaryCacheTTL - time.Hour)
+	if _, err := db.Collection("summary_cache").UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"createdAt": expired}}); err != nil {
+		t.Fatal(err)
+	}
+	summarize(body, opts, 4, SummaryCacheStats{Hits: 1, Misses: 4})
+	// and the regenerated summary is cached again
+	summarize(body, opts, 4, SummaryCacheStats{Hits: 2, Misses: 4})
+}
+
+func TestSummaryCacheSkipsFallback(t *testing.T) {
+	db := testutil.MongoDB(t)
+	llm := &stubLLM{err: errors.New("provider down")}
+	s := NewSummaryService(nil, repository.NewSummaryCacheRepository(db), nil, nil, llm, nil).(*LocalSummaryService)
+	opts, _ := SummaryOptions{Language: SummaryLanguageEN}.Normalize()
+	body := "The server migration finished overnight. No action is needed."
+
+	for i := 1; i <= 2; i++ {
+		if _, err := s.summarizeCached(context.Background(), body, summaryEmail{}, opts); err != nil {
+			t.Fatal(err)
+		}
+		if n := llm.calls.Load(); n != int32(i) {
+			t.Fatalf("LLM calls = %d, want %d: extractive fallbacks must not be cached", n, i)
+		}
+	}
+	if stats := s.CacheStats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("cache stats = %+v, want two misses", stats)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// summaryRetryBackoff is multiplied by the attempt number before a failed job runs again
+const summaryRetryBackoff = time.Minute
+
+// StartSummaryWorker starts a background goroutine that drains the persistent auto-summarize
+// queue. It processes at most one job per interval, which rate-limits LLM calls. Emails whose
+// text is shorter than minChars are skipped (the preview is enough), and jobs that keep failing
+// are marked failed after maxAttempts. New summaries are sent to the user's webhook (webhooks
+// may be nil). The worker stops when ctx is done.
+func StartSummaryWorker(ctx context.Context, interval time.Duration, minChars, maxAttempts int, jobs *repository.SummaryJobRepository, emailRepo *repository.EmailRepository, summary SummaryService, webhooks *WebhookService) {
+	// Jobs claimed before a crash or restart would otherwise stay in processing forever
+	if n, err := jobs.RequeueProcessing(ctx); err != nil {
+		log.Println("summary worker: failed to requeue interrupted jobs:", err)
+	} else if n > 0 {
+		log.Printf("summary worker: requeued %d interrupted jobs", n)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("summary worker: shutting down")
+				return
+			case <-ticker.C:
+				job, err := jobs.ClaimNext(ctx, time.Now())
+				if err != nil {
+					if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+						log.Println("summary worker: error claiming job:", err)
+					}
+					continue
+				}
+				runSummaryJob(ctx, job, minChars, maxAttempts, jobs, emailRepo, summary, webhooks)
+			}
+		}
+	}()
+}
+
+func runSummaryJob(ctx context.Context, job *models.SummaryJob, minChars, maxAttempts int, jobs *repository.SummaryJobRepository, emailRepo *repository.EmailRepository, summary SummaryService, webhooks *WebhookService) {
+	email, err := emailRepo.GetByID(ctx, job.EmailID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// email was cleaned up before its turn
+			_ = jobs.Finish(ctx, job.EmailID, models.JobSkipped)
+			return
+		}
+		retrySummaryJob(ctx, job, err, maxAttempts, jobs)
+		return
+	}
+
+	if email.Summary != "" {
+		_ = jobs.Finish(ctx, job.EmailID, models.JobDone)
+		return
+	}
+	if email.DeletedAt != nil {
+		_ = jobs.Finish(ctx, job.EmailID, models.JobSkipped)
+		return
+	}
+
+	text := strings.TrimSpace(email.Body)
+	if text == "" {
+		text = strings.TrimSpace(email.Preview)
+	}
+	if utf8.RuneCountInString(stripHTML(text)) < minChars {
+		_ = jobs.Finish(ctx, job.EmailID, models.JobSkipped)
+		return
+	}
+
+	summaryText, err := summary.SummarizeAndSave(WithUsageUser(ctx, job.UserID), job.EmailID, SummaryOptions{})
+	if err != nil {
+		retrySummaryJob(ctx, job, err, maxAttempts, jobs)
+		return
+	}
+	if err := jobs.Finish(ctx, job.EmailID, models.JobDone); err != nil {
+		log.Println("summary worker: failed to complete job:", job.EmailID, err)
+	}
+	webhooks.Emit(ctx, job.UserID, models.WebhookEmailSummarized, models.WebhookEmailChange{
+		EmailID: email.ID,
+		Subject: email.Subject,
+		From:    email.From.Email,
+		Summary: summaryText,
+	})
+}
+
+func retrySummaryJob(ctx context.Context, job *models.SummaryJob, cause error, maxAttempts int, jobs *repository.SummaryJobRepository) {
+	log.Printf("summary worker: job %s failed (attempt %d/%d): %v", job.EmailID, job.Attempts, maxAttempts, cause)
+	if err := jobs.Retry(ctx, job, cause, maxAttempts, summaryRetryBackoff); err != nil {
+		log.Println("summary worker: failed to reschedule job:", job.EmailID, err)
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrThreadNotFound is returned when a thread has no messages for the user
+var ErrThreadNotFound = errors.New("thread not found")
+
+const (
+	// threadChunkChars keeps each map step well inside the smallest provider context window
+	threadChunkChars = 12000
+	// threadMessageChars bounds one message in the transcript; long newsletters and logs
+	// would otherwise crowd out the rest of the conversation
+	threadMessageChars = 4000
+)
+
+// extractiveThreadModel marks summaries built without an LLM
+const extractiveThreadModel = "extractive"
+
+// quotedReplyRE matches the start of the quoted history most clients append to replies
+var quotedReplyRE = regexp.MustCompile(`(?im)^(on .{0,200} wrote:|vào .{0,200} đã viết:|-{2,}\s*original message\s*-{2,}|_{5,}|from: .+$)`)
+
+// ThreadSource loads a Gmail conversation when the local copy is missing or incomplete
+type ThreadSource interface {
+	Thread(ctx context.Context, userID, threadID string) ([]*models.Email, error)
+}
+
+// GmailThreadSource reads threads from the user's Gmail account
+type GmailThreadSource struct {
+	gmail *GmailService
+	users *repository.UserRepository
+}
+
+// NewGmailThreadSource creates a thread source backed by the Gmail API
+func NewGmailThreadSource(gmail *GmailService, users *repository.UserRepository) *GmailThreadSource {
+	return &GmailThreadSource{gmail: gmail, users: users}
+}
+
+func (g *GmailThreadSource) Thread(ctx context.Context, userID, threadID string) ([]*models.Email, error) {
+	user, err := g.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return g.gmail.GetThread(ctx, user, threadID)
+}
+
+// SummarizeThread returns the summary of a whole conversation. A stored summary is reused
+// while the thread's last message is unchanged; when new messages arrive the previous
+// summary is extended with them, and long threads are summarized chunk by chunk
+// (map-reduce) so no single request exceeds the provider's limit.
+func (s *LocalSummaryService) SummarizeThread(ctx context.Context, userID, threadID string) (*models.ThreadSummary, error) {
+	messages, err := s.threadMessages(ctx, userID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	last := messages[len(messages)-1]
+
+	model := extractiveThreadModel
+	if s.llm != nil {
+		model = s.llm.Name() + "/" + s.llm.Model()
+	}
+
+	var stored *models.ThreadSummary
+	if s.threadSummaries != nil {
+		stored, err = s.threadSummaries.Get(ctx, userID, threadID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		if stored != nil && stored.LastMessageID == last.ID && stored.Model == model {
+			return stored, nil
+		}
+	}
+
+	transcript := make([]string, len(messages))
+	for i, m := range messages {
+		transcript[i] = threadEntry(m)
+	}
+	lang := detectLanguage(strings.Join(transcript, "\n"))
+
+	var summary string
+	if s.llm == nil {
+		summary = extractiveThreadSummary(messages)
+	} else if prev := incrementalStart(stored, messages, model); prev > 0 {
+		summary, err = s.extendThreadSummary(ctx, stored.Summary, transcript[prev:], lang)
+	} else {
+		summary, err = s.mapReduceThread(ctx, transcript, lang)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &models.ThreadSummary{
+		UserID:        userID,
+		ThreadID:      threadID,
+		LastMessageID: last.ID,
+		MessageCount:  len(messages),
+		Summary:       strings.TrimSpace(summary),
+		Language:      lang,
+		Model:         model,
+	}
+	if s.threadSummaries != nil {
+		if err := s.threadSummaries.Put(ctx, ts); err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// threadMessages returns the thread oldest first. The local cache is used when it has the
+// full bodies; otherwise Gmail is asked, with the cached previews as a last resort.
+func (s *LocalSummaryService) threadMessages(ctx context.Context, userID, threadID string) ([]*models.Email, error) {
+	local, err := s.repo.GetByThreadID(ctx, userID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*models.Email, 0, len(local))
+	complete := len(local) > 0
+	for i := range local {
+		if local[i].HasLabel("TRASH") {
+			continue
+		}
+		if strings.TrimSpace(local[i].Body) == "" {
+			complete = false
+		}
+		messages = append(messages, &local[i])
+	}
+
+	if !complete && s.threads != nil {
+		remote, err := s.threads.Thread(ctx, userID, threadID)
+		switch {
+		case err == nil:
+			messages = messages[:0]
+			for _, m := range remote {
+				if !m.HasLabel("TRASH") {
+					messages = append(messages, m)
+				}
+			}
+		case len(messages) == 0:
+			return nil, fmt.Errorf("failed to load thread from Gmail: %w", err)
+		default:
+			fmt.Printf("Thread %s: Gmail fetch failed, summarizing cached previews: %v\n", threadID, err)
+		}
+	}
+	if len(messages) == 0 {
+		return nil, ErrThreadNotFound
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		if !messages[i].ReceivedAt.Equal(messages[j].ReceivedAt) {
+			return messages[i].ReceivedAt.Before(messages[j].ReceivedAt)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	return messages, nil
+}
+
+// incrementalStart returns the index of the first message after the stored summary's last
+// message, or 0 when the thread has to be summarized from scratch
+func incrementalStart(stored *models.ThreadSummary, messages []*models.Email, model string) int {
+	if stored == nil || stored.Model != model || stored.Summary == "" {
+		return 0
+	}
+	for i, m := range messages {
+		if m.ID == stored.LastMessageID && i < len(messages)-1 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// threadEntry renders one message for the transcript without its quoted history
+func threadEntry(e *models.Email) string {
+	text := stripHTML(e.Body)
+	if strings.TrimSpace(text) == "" {
+		text = e.Preview
+	}
+	if loc := quotedReplyRE.FindStringIndex(text); loc != nil && loc[0] > 0 {
+		text = text[:loc[0]]
+	}
+	text = strings.TrimSpace(text)
+	if r := []rune(text); len(r) > threadMessageChars {
+		text = string(r[:threadMessageChars]) + "…"
+	}
+
+	from := e.From.Email
+	if e.From.Name != "" {
+		from = e.From.Name + " <" + e.From.Email + ">"
+	}
+	return fmt.Sprintf("[%s] %s:\n%s", e.ReceivedAt.UTC().Format("2006-01-02 15:04"), from, text)
+}
+
+// chunkTranscript packs whole messages into chunks of at most threadChunkChars
+func chunkTranscript(entries []string) []string {
+	var chunks []string
+	var b strings.Builder
+	for _, e := range entries {
+		if b.Len() > 0 && b.Len()+len(e)+2 > threadChunkChars {
+			chunks = append(chunks, b.String())
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(e)
+	}
+	if b.Len() > 0 {
+		chunks = append(chunks, b.String())
+	}
+	return chunks
+}
+
+// mapReduceThread summarizes each chunk of the transcript, then combines the partial
+// summaries. Short threads take a single request.
+func (s *LocalSummaryService) mapReduceThread(ctx context.Context, transcript []string, lang string) (string, error) {
+	chunks := chunkTranscript(transcript)
+	if len(chunks) == 1 {
+		return s.generateThread(ctx, threadPrompt(lang, "Summarize this email conversation.", chunks[0]))
+	}
+
+	partials := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		intro := fmt.Sprintf("This is part %d of %d of a long email conversation. Summarize this part.", i+1, len(chunks))
+		partial, err := s.generateThread(ctx, threadPrompt(lang, intro, chunk))
+		if err != nil {
+			return "", err
+		}
+		partials[i] = fmt.Sprintf("Part %d:\n%s", i+1, partial)
+	}
+	return s.generateThread(ctx, threadPrompt(lang,
+		"These are summaries of consecutive parts of one email conversation. Combine them into a single summary of the whole conversation.",
+		strings.Join(partials, "\n\n")))
+}
+
+// extendThreadSummary updates a previous summary with the messages that arrived after it
+func (s *LocalSummaryService) extendThreadSummary(ctx context.Context, previous string, newEntries []string, lang string) (string, error) {
+	text := strings.Join(newEntries, "\n\n")
+	if len(text) > threadChunkChars {
+		// too much new mail to fit next to the old summary: condense it first
+		condensed, err := s.mapReduceThread(ctx, newEntries, lang)
+		if err != nil {
+			return "", err
+		}
+		text = condensed
+	}
+	return s.generateThread(ctx, threadPrompt(lang,
+		"Here is the summary of an email conversation so far, followed by new messages. Rewrite the summary so it covers the whole conversation including the new messages.",
+		"Summary so far:\n"+previous+"\n\nNew messages:\n"+text))
+}
+
+func (s *LocalSummaryService) generateThread(ctx context.Context, req LLMRequest) (string, error) {
+	out, err := s.llm.Generate(withOperation(ctx, "thread_summary"), req)
+	if err != nil {
+		return "", fmt.Errorf("%s thread summary failed: %w", s.llm.Name(), err)
+	}
+	if strings.TrimSpace(out) == "" {
+		return "", fmt.Errorf("%s returned an empty thread summary", s.llm.Name())
+	}
+	return out, nil
+}
+
+func threadPrompt(lang, instruction, text string) LLMRequest {
+	name := summaryLanguageNames[lang]
+	return LLMRequest{
+		System: fmt.Sprintf("You summarize email conversations. Always answer in %s. Mention who asked for what, "+
+			"decisions made, open questions and deadlines, in at most 6 sentences. Do not invent details.", name),
+		Prompt:      instruction + "\n\n" + text,
+		MaxTokens:   400,
+		Temperature: 0.2,
+	}
+}
+
+// extractiveThreadSummary picks the key sentences of the first message and the latest
+// replies, so the result shows both what the thread is about and where it stands
+func extractiveThreadSummary(messages []*models.Email) string {
+	spec := summaryLengths[SummaryLengthDetailed]
+	opening := stripHTML(messages[0].Body)
+	if strings.TrimSpace(opening) == "" {
+		opening = messages[0].Preview
+	}
+	summary := extractiveSummary(opening, 2, spec.maxChars/2)
+	if len(messages) == 1 {
+		return summary
+	}
+
+	latest := messages[len(messages)-1]
+	text := stripHTML(latest.Body)
+	if strings.TrimSpace(text) == "" {
+		text = latest.Preview
+	}
+	if loc := quotedReplyRE.FindStringIndex(text); loc != nil && loc[0] > 0 {
+		text = text[:loc[0]]
+	}
+	if reply := extractiveSummary(text, 2, spec.maxChars/2); reply != "" {
+		name := latest.From.Name
+		if name == "" {
+			name = latest.From.Email
+		}
+		summary = strings.TrimSpace(fmt.Sprintf("%s\nLatest (%s, %d messages): %s", summary, name, len(messages), reply))
+	}
+	return summary
+}
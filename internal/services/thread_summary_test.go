@@ -0,0 +1,120 @@
+package services
+
+import (
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func threadOf(ids ...string) []*models.Email {
+	messages := make([]*models.Email, len(ids))
+	for i, id := range ids {
+		messages[i] = &models.Email{ID: id}
+	}
+	return messages
+}
+
+func TestIncrementalStart(t *testing.T) {
+	stored := &models.ThreadSummary{LastMessageID: "m2", Summary: "So far", Model: "stub/stub-1"}
+	tests := []struct {
+		name     string
+		stored   *models.ThreadSummary
+		messages []*models.Email
+		model    string
+		want     int
+	}{
+		{"nothing stored", nil, threadOf("m1", "m2", "m3"), "stub/stub-1", 0},
+		{"one new message", stored, threadOf("m1", "m2", "m3"), "stub/stub-1", 2},
+		{"several new messages", stored, threadOf("m1", "m2", "m3", "m4"), "stub/stub-1", 2},
+		{"no new message", stored, threadOf("m1", "m2"), "stub/stub-1", 0},
+		{"last message gone", stored, threadOf("m1", "m3"), "stub/stub-1", 0},
+		{"other model", stored, threadOf("m1", "m2", "m3"), "stub/stub-2", 0},
+		{"empty summary", &models.ThreadSummary{LastMessageID: "m2", Model: "stub/stub-1"}, threadOf("m1", "m2", "m3"), "stub/stub-1", 0},
+	}
+	for _, tt := range tests {
+		if got := incrementalStart(tt.stored, tt.messages, tt.model); got != tt.want {
+			t.Errorf("%s: incrementalStart = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChunkTranscript(t *testing.T) {
+	entry := strings.Repeat("a", threadChunkChars/3)
+	chunks := chunkTranscript([]string{entry, entry, entry, entry})
+	if len(chunks) != 2 || chunks[0] != entry+"\n\n"+entry {
+		t.Fatalf("got %d chunks, want two of two whole messages", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > threadChunkChars {
+			t.Errorf("chunk %d is %d chars, over %d", i, len(c), threadChunkChars)
+		}
+	}
+}
+
+func TestSummarizeThreadRegeneratesOnlyForNewMessages(t *testing.T) {
+	db := testutil.MongoDB(t)
+	ctx := context.Background()
+	emails := repository.NewEmailRepository(db)
+	llm := &stubLLM{reply: "Lan asked for the report; Minh will send it Friday."}
+	s := NewSummaryService(emails, nil, repository.NewThreadSummaryRepository(db), nil, llm, nil).(*LocalSummaryService)
+
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	add := func(i int, body string) {
+		t.Helper()
+		e := &models.Email{ID: fmt.Sprintf("m%d", i), ThreadID: "t1", UserID: "u1", MailboxID: "INBOX",
+			From: models.EmailAddress{Email: "lan@example.com"}, Body: body, ReceivedAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := emails.CreateEmail(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summarize := func(wantCalls int32, wantLast string) *models.ThreadSummary {
+		t.Helper()
+		ts, err := s.SummarizeThread(ctx, "u1", "t1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := llm.calls.Load(); n != wantCalls {
+			t.Fatalf("LLM calls = %d, want %d", n, wantCalls)
+		}
+		if ts.LastMessageID != wantLast || ts.Summary != llm.reply {
+			t.Fatalf("summary = %+v, want one ending at %s", ts, wantLast)
+		}
+		return ts
+	}
+
+	add(1, "Could you send the quarterly report?")
+	add(2, "Sure, which format do you need?")
+	summarize(1, "m2")
+	if !strings.Contains(llm.last.Prompt, "Summarize this email conversation.") {
+		t.Errorf("first summary prompt = %q, want the whole conversation", llm.last.Prompt)
+	}
+
+	// Nothing new: the stored summary is served as is
+	if ts := summarize(1, "m2"); ts.MessageCount != 2 {
+		t.Errorf("MessageCount = %d, want 2", ts.MessageCount)
+	}
+
+	// A reply extends the stored summary with just that message
+	add(3, "PDF please, by Friday.")
+	if ts := summarize(2, "m3"); ts.MessageCount != 3 {
+		t.Errorf("MessageCount = %d, want 3", ts.MessageCount)
+	}
+	prompt := llm.last.Prompt
+	if !strings.Contains(prompt, "Summary so far:\n"+llm.reply) || !strings.Contains(prompt, "PDF please") ||
+		strings.Contains(prompt, "quarterly report") || strings.Contains(prompt, "which format") {
+		t.Errorf("incremental prompt = %q, want the old summary and only the new message", prompt)
+	}
+	summarize(2, "m3")
+
+	// Another model can't build on this summary: start over
+	llm.model = "stub-2"
+	summarize(3, "m3")
+	if !strings.Contains(llm.last.Prompt, "quarterly report") || strings.Contains(llm.last.Prompt, "Summary so far") {
+		t.Errorf("prompt after a model change = %q, want the whole conversation", llm.last.Prompt)
+	}
+}
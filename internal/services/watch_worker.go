@@ -0,0 +1,50 @@
+package services
+
+import (
+	"aiemailbox-be/internal/repository"
+	"context"
+	"log"
+	"time"
+)
+
+// StartWatchRenewalWorker starts a background goroutine that periodically re-issues Gmail
+// Users.Watch for users with push enabled whose watch expires within margin. Gmail watches
+// expire after ~7 days, so they must be renewed before that. Watches already due (e.g. after
+// downtime) are renewed right away rather than an interval later. The worker stops when ctx is done.
+func StartWatchRenewalWorker(ctx context.Context, interval, margin time.Duration, userRepo *repository.UserRepository, gmailService *GmailService) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		renewDueWatches(ctx, margin, userRepo, gmailService)
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("watch renewal worker: shutting down")
+				return
+			case <-ticker.C:
+				renewDueWatches(ctx, margin, userRepo, gmailService)
+			}
+		}
+	}()
+}
+
+// renewDueWatches renews every watch that is due. A failure for one user is logged and
+// does not stop renewal for the others.
+func renewDueWatches(ctx context.Context, margin time.Duration, userRepo *repository.UserRepository, gmailService *GmailService) {
+	due, err := userRepo.ListWatchesDue(ctx, time.Now().Add(margin))
+	if err != nil {
+		log.Println("watch renewal worker: error listing due watches:", err)
+		return
+	}
+	for i := range due {
+		user := &due[i]
+		expiry, historyID, err := gmailService.WatchMailbox(ctx, user)
+		if err != nil {
+			log.Println("watch renewal worker: failed to renew watch:", user.ID.Hex(), err)
+			continue
+		}
+		if err := userRepo.UpdateGmailWatch(ctx, user.ID.Hex(), expiry, historyID); err != nil {
+			log.Println("watch renewal worker: failed to store watch:", user.ID.Hex(), err)
+		}
+	}
+}
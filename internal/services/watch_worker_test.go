@@ -0,0 +1,78 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"aiemailbox-be/internal/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestRenewDueWatches(t *testing.T) {
+	db := testutil.MongoDB(t)
+	repo := repository.NewUserRepository(db, nil)
+	ctx := context.Background()
+	now := time.Now()
+	renewed := now.Add(7 * 24 * time.Hour).Truncate(time.Millisecond)
+
+	var calls atomic.Int32
+	s, _ := newFakeGmailConfig(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/gmail/v1/users/me/watch" {
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		var req gmail.WatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TopicName != "projects/p/topics/gmail" {
+			t.Errorf("watch request = %+v, %v", req, err)
+		}
+		calls.Add(1)
+		writeJSON(w, &gmail.WatchResponse{Expiration: renewed.UnixMilli(), HistoryId: 500})
+	}), &config.Config{GmailPubSubTopic: "projects/p/topics/gmail"})
+
+	later := now.Add(72 * time.Hour).Truncate(time.Millisecond)
+	users := map[string]*models.User{
+		"expired":   {GmailWatchEnabled: true, GmailWatchExpiry: now.Add(-time.Hour), GoogleRefreshToken: "1//a"},
+		"no expiry": {GmailWatchEnabled: true, GoogleRefreshToken: "1//b"},
+		"in margin": {GmailWatchEnabled: true, GmailWatchExpiry: now.Add(30 * time.Minute), GmailHistoryID: 42, GoogleRefreshToken: "1//c"},
+		"not due":   {GmailWatchEnabled: true, GmailWatchExpiry: later, GoogleRefreshToken: "1//d"},
+		"disabled":  {GmailWatchExpiry: now.Add(-time.Hour).Truncate(time.Millisecond), GoogleRefreshToken: "1//e"},
+		"no token":  {GmailWatchEnabled: true, GmailWatchExpiry: now.Add(-2 * time.Hour).Truncate(time.Millisecond)},
+	}
+	for name, u := range users {
+		u.Email = name + "@example.com"
+		u.Provider = "google"
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renewDueWatches(ctx, time.Hour, repo, s)
+
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Gmail watch calls = %d, want 3", n)
+	}
+	for name, u := range users {
+		got, err := repo.FindByID(ctx, u.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantExpiry, wantHistory := renewed, uint64(500)
+		switch name {
+		case "in margin":
+			// A known history ID is kept so no changes are skipped
+			wantHistory = 42
+		case "not due", "disabled", "no token":
+			wantExpiry, wantHistory = u.GmailWatchExpiry, 0
+		}
+		if !got.GmailWatchExpiry.Equal(wantExpiry) || got.GmailHistoryID != wantHistory {
+			t.Errorf("%s: expiry %v, history %d; want %v, %d", name, got.GmailWatchExpiry, got.GmailHistoryID, wantExpiry, wantHistory)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"aiemailbox-be/config"
+	"aiemailbox-be/internal/models"
+	"aiemailbox-be/internal/repository"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// webhookRetryBase is the backoff after the first failed attempt; it doubles on each retry
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = time.Hour
+	// webhookBatchSize caps the deliveries sent per worker tick
+	webhookBatchSize = 20
+)
+
+// ErrInvalidWebhookURL is returned for webhook URLs deliveries can't (or must not) be sent to
+var ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+
+// WebhookService queues board events for users' outbound webhooks and delivers them as
+// HMAC-SHA256 signed POSTs. A nil *WebhookService (webhooks disabled) ignores every event.
+type WebhookService struct {
+	hooks       *repository.WebhookRepository
+	deliveries  *repository.WebhookDeliveryRepository
+	emails      *repository.EmailRepository
+	client      *http.Client
+	maxAttempts int
+	// allowPrivate accepts plain http and local or private hosts (WEBHOOKS_ALLOW_PRIVATE)
+	allowPrivate bool
+}
+
+// NewWebhookService creates the webhook service, or returns nil when WEBHOOKS_ENABLED is off
+func NewWebhookService(cfg *config.Config, hooks *repository.WebhookRepository, deliveries *repository.WebhookDeliveryRepository, emails *repository.EmailRepository) *WebhookService {
+	if !cfg.WebhooksEnabled {
+		return nil
+	}
+	return &WebhookService{
+		hooks:        hooks,
+		deliveries:   deliveries,
+		emails:       emails,
+		client:       newWebhookClient(cfg.WebhooksAllowPrivate),
+		maxAttempts:  cfg.WebhookMaxAttempts,
+		allowPrivate: cfg.WebhooksAllowPrivate,
+	}
+}
+
+// newWebhookClient returns the client deliveries are sent with. Unless allowPrivate, every
+// connection is checked at dial time against the resolved address, so a public hostname
+// that resolves (or later rebinds) to a private address is refused too.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = webhookDialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy the guard would only see the proxy's address
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		// A redirect would send the signed payload somewhere the user didn't register
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl refuses connections to addresses that aren't public
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrInvalidWebhookURL, host)
+	}
+	return nil
+}
+
+// isPublicIP reports whether ip is none of loopback, private, link-local, multicast or
+// unspecified (IPv4-mapped IPv6 addresses are checked as IPv4)
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// ValidateURL checks that deliveries may be sent to raw: https with a public host. Hostnames
+// are checked again against their resolved address when a delivery connects.
+func (s *WebhookService) ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: must be an absolute URL", ErrInvalidWebhookURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in the URL are not allowed", ErrInvalidWebhookURL)
+	}
+	if s.allowPrivate {
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("%w: must be http or https", ErrInvalidWebhookURL)
+		}
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: must be https", ErrInvalidWebhookURL)
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: local hosts are not allowed", ErrInvalidWebhookURL)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("%w: private addresses are not allowed", ErrInvalidWebhookURL)
+	}
+	return nil
+}
+
+// NewWebhookSecret returns a random signing secret
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature value for body sent at timestamp:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit queues event for userID's webhook when it is enabled and subscribed to it. Failures
+// are logged: the board change already happened and must not fail because of an integration.
+func (s *WebhookService) Emit(ctx context.Context, userID string, event models.WebhookEvent, data models.WebhookEmailChange) {
+	if s == nil || userID == "" {
+		return
+	}
+	hook, err := s.hooks.Get(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println("webhooks: failed to load webhook:", userID, err)
+		}
+		return
+	}
+	if !hook.Wants(event) {
+		return
+	}
+	if _, err := s.enqueue(ctx, userID, event, data); err != nil {
+		log.Println("webhooks: failed to queue event:", event, userID, err)
+	}
+}
+
+// EmitActivity queues the webhook events of card activity entries: moves become email.moved
+// and summaries email.summarized. Other entries are ignored.
+func (s *WebhookService) EmitActivity(ctx context.Context, entries ...*models.CardActivity) {
+	if s == nil {
+		return
+	}
+	// Load each user's webhook once; bulk moves produce many entries
+	hooks := map[string]*models.Webhook{}
+	var wanted []*models.CardActivity
+	for _, a := range entries {
+		event, ok := activityWebhookEvent(a)
+		if !ok || a.UserID == "" {
+			continue
+		}
+		hook, seen := hooks[a.UserID]
+		if !seen {
+			var err error
+			hook, err = s.hooks.Get(ctx, a.UserID)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Println("webhooks: failed to load webhook:", a.UserID, err)
+			}
+			hooks[a.UserID] = hook
+		}
+		if hook != nil && hook.Wants(event) {
+			wanted = append(wanted, a)
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(wanted))
+	for _, a := range wanted {
+		ids = append(ids, a.EmailID)
+	}
+	emails, err := s.emails.GetByIDs(ctx, ids)
+	if err != nil {
+		// Send the events without subject/summary rather than not at all
+		log.Println("webhooks: failed to load emails:", err)
+	}
+	for _, a := range wanted {
+		event, _ := activityWebhookEvent(a)
+		data := models.WebhookEmailChange{EmailID: a.EmailID}
+		if event == models.WebhookEmailMoved {
+			data.FromStatus = a.FromStatus
+			data.ToStatus = a.ToStatus
+			data.Detail = a.Detail
+		}
+		if e, ok := emails[a.EmailID]; ok {
+			fillWebhookEmail(&data, &e, event == models.WebhookEmailSummarized)
+		}
+		if _, err := s.enqueue(ctx, a.UserID, event, data); err != nil {
+			log.Println("webhooks: failed to queue event:", event, a.UserID, err)
+		}
+	}
+}
+
+// Ping queues a webhook.ping delivery to userID's webhook, enabled or not, so the user can
+// check their receiver. Returns mongo.ErrNoDocuments when the user has no webhook.
+func (s *WebhookService) Ping(ctx context.Context, userID string) (*models.WebhookDelivery, error) {
+	if _, err := s.hooks.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.enqueue(ctx, userID, models.WebhookPing, models.WebhookEmailChange{})
+}
+
+// activityWebhookEvent maps a card activity entry to its webhook event
+func activityWebhookEvent(a *models.CardActivity) (models.WebhookEvent, bool) {
+	switch a.Type {
+	case models.CardActivityMove:
+		return models.WebhookEmailMoved, true
+	case models.CardActivitySummary:
+		return models.WebhookEmailSummarized, true
+	}
+	return "", false
+}
+
+// fillWebhookEmail copies what receivers need to identify e into data
+func fillWebhookEmail(data *models.WebhookEmailChange, e *models.Email, withSummary bool) {
+	data.Subject = e.Subject
+	data.From = e.From.Email
+	if withSummary {
+		data.Summary = e.Summary
+	}
+}
+
+// enqueue stores a pending delivery of event; its payload is fixed now so every retry sends
+// the same bytes
+func (s *WebhookService) enqueue(ctx context.Context, userID string, event models.WebhookEvent, data models.WebhookEmailChange) (*models.WebhookDelivery, error) {
+	id := primitive.NewObjectID()
+	body, err := json.Marshal(models.WebhookPayload{
+		ID:        id.Hex(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := &models.WebhookDelivery{ID: id, UserID: userID, Event: event, Payload: string(body)}
+	if err := s.deliveries.Enqueue(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// deliver sends one claimed delivery and records the outcome on it and on the webhook
+func (s *WebhookService) deliver(ctx context.Context, d *models.WebhookDelivery) {
+	hook, err := s.hooks.Get(ctx, d.UserID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		_ = s.deliveries.Finish(ctx, d.ID, models.DeliveryFailed, 0, "webhook was removed")
+		return
+	}
+	if err != nil {
+		s.retry(ctx, d, 0, err)
+		return
+	}
+	if !hook.Enabled && d.Event != models.WebhookPing {
+		_ = s.deliveries.Finish(ctx, d.ID, models.DeliveryFailed, 0, "webhook is disabled")
+		return
+	}
+
+	code, err := s.post(ctx, hook, d)
+	now := time.Now()
+	if err != nil {
+		if recErr := s.hooks.RecordAttempt(ctx, d.UserID, models.DeliveryFailed, code, err.Error(), now); recErr != nil {
+			log.Println("webhooks: failed to record attempt:", d.UserID, recErr)
+		}
+		s.retry(ctx, d, code, err)
+		return
+	}
+	if err := s.hooks.RecordAttempt(ctx, d.UserID, models.DeliveryDelivered, code, "", now); err != nil {
+		log.Println("webhooks: failed to record attempt:", d.UserID, err)
+	}
+	if err := s.deliveries.Finish(ctx, d.ID, models.DeliveryDelivered, code, ""); err != nil {
+		log.Println("webhooks: failed to complete delivery:", d.ID.Hex(), err)
+	}
+}
+
+// post sends the signed payload; any non-2xx answer is an error
+func (s *WebhookService) post(ctx context.Context, hook *models.Webhook, d *models.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AiEmailbox-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", string(d.Event))
+	req.Header.Set("X-Webhook-Delivery", d.ID.Hex())
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(hook.Secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retry reschedules a failed delivery with exponential backoff, or gives up on it
+func (s *WebhookService) retry(ctx context.Context, d *models.WebhookDelivery, code int, cause error) {
+	backoff := min(webhookRetryBase<<min(d.Attempts-1, 16), webhookRetryMax)
+	backoff = backoff/2 + mrand.N(backoff/2+1)
+	status, err := s.deliveries.Retry(ctx, d, code, cause.Error(), s.maxAttempts, backoff)
+	if err != nil {
+		log.Println("webhooks: failed to reschedule delivery:", d.ID.Hex(), err)
+		return
+	}
+	if status == models.DeliveryFailed {
+		log.Printf("webhooks: giving up on delivery %s after %d attempts: %v", d.ID.Hex(), d.Attempts, cause)
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartWebhookWorker starts a background goroutine that sends queued webhook deliveries.
+// Each tick sends up to webhookBatchSize due deliveries, one at a time; failed ones come back
+// after their backoff. The worker stops when ctx is done.
+func StartWebhookWorker(ctx context.Context, interval time.Duration, webhooks *WebhookService) {
+	// Deliveries claimed before a crash or restart would otherwise stay in processing forever
+	if n, err := webhooks.deliveries.RequeueProcessing(ctx); err != nil {
+		log.Println("webhook worker: failed to requeue interrupted deliveries:", err)
+	} else if n > 0 {
+		log.Printf("webhook worker: requeued %d interrupted deliveries", n)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("webhook worker: shutting down")
+				return
+			case <-ticker.C:
+				for range webhookBatchSize {
+					d, err := webhooks.deliveries.ClaimNext(ctx, time.Now())
+					if err != nil {
+						if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+							log.Println("webhook worker: error claiming delivery:", err)
+						}
+						break
+					}
+					webhooks.deliver(ctx, d)
+				}
+			}
+		}
+	}()
+}
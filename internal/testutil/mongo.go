@@ -0,0 +1,54 @@
+// Package testutil holds helpers shared by the tests of several packages.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDB returns a fresh database on the server at MONGODB_TEST_URI, dropped when the test
+// ends. The test is skipped when MONGODB_TEST_URI is unset.
+func MongoDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	return database(t, "MONGODB_TEST_URI")
+}
+
+// Atlas is like MongoDB for the Atlas cluster at ATLAS_TEST_URI, for tests of Atlas-only
+// features such as Vector Search
+func Atlas(t *testing.T) *mongo.Database {
+	t.Helper()
+	return database(t, "ATLAS_TEST_URI")
+}
+
+func database(t *testing.T, env string) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv(env)
+	if uri == "" {
+		t.Skip(env + " not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping MongoDB: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("aiemailbox_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return db
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// encryptedPrefix marks values produced by TokenCipher: "enc:<keyID>:<base64(nonce|ciphertext)>".
+// Values without it are treated as legacy plaintext.
+const encryptedPrefix = "enc:"
+
+// TokenCipher encrypts secrets at rest with AES-256-GCM. Each value is sealed with a key derived
+// from the master key and the owning user's ID, and the key ID is stored with the ciphertext so
+// master keys can be rotated while old values remain readable.
+type TokenCipher struct {
+	activeKeyID string
+	keys        map[string][]byte
+}
+
+// NewTokenCipher creates a cipher that encrypts with activeKeyID and can decrypt with any of keys.
+// Every key must be 32 bytes.
+func NewTokenCipher(activeKeyID string, keys map[string][]byte) (*TokenCipher, error) {
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKeyID)
+	}
+	for id, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(k))
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must not contain ':'", id)
+		}
+	}
+	return &TokenCipher{activeKeyID: activeKeyID, keys: keys}, nil
+}
+
+// IsEncrypted reports whether value was produced by a TokenCipher
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt seals plaintext for the given user. Empty and already-encrypted values are returned as-is.
+func (c *TokenCipher) Encrypt(userID, plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	aead, err := c.aead(c.activeKeyID, userID)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(userID))
+	return encryptedPrefix + c.activeKeyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value for the given user. Legacy plaintext (no prefix) is returned unchanged.
+func (c *TokenCipher) Decrypt(userID, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	rest := strings.TrimPrefix(value, encryptedPrefix)
+	keyID, payload, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, err := c.aead(keyID, userID)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(userID))
+	if err != nil {
+		return "", errors.New("failed to decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+// aead builds the AES-GCM instance for a user from the per-user key HMAC-SHA256(master, userID)
+func (c *TokenCipher) aead(keyID, userID string) (cipher.AEAD, error) {
+	master, ok := c.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", keyID)
+	}
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("google-token:" + userID))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadTokenCipher builds a TokenCipher from base64-encoded keys. It returns nil (encryption
+// disabled) when no active key ID is configured.
+func LoadTokenCipher(activeKeyID string, encodedKeys map[string]string) (*TokenCipher, error) {
+	if activeKeyID == "" {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(encodedKeys))
+	for id, encoded := range encodedKeys {
+		k, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = k
+	}
+	return NewTokenCipher(activeKeyID, keys)
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestTokenCipherRoundTrip(t *testing.T) {
+	c, err := NewTokenCipher("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"ya29.access-token", "1//refresh", "ünïcödé ✓", strings.Repeat("x", 4096)} {
+		enc, err := c.Encrypt("user-1", plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(enc, "enc:k1:") || strings.Contains(enc, plaintext) {
+			t.Fatalf("Encrypt(%q) = %q, want an enc:k1: ciphertext", plaintext, enc)
+		}
+		got, err := c.Decrypt("user-1", enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != plaintext {
+			t.Errorf("round trip = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestTokenCipherNonceIsRandom(t *testing.T) {
+	c, _ := NewTokenCipher("k1", map[string][]byte{"k1": testKey(1)})
+	a, _ := c.Encrypt("user-1", "token")
+	b, _ := c.Encrypt("user-1", "token")
+	if a == b {
+		t.Error("two encryptions of the same value are identical")
+	}
+}
+
+func TestTokenCipherPassThrough(t *testing.T) {
+	c, _ := NewTokenCipher("k1", map[string][]byte{"k1": testKey(1)})
+
+	// Legacy plaintext and empty values are read unchanged
+	for _, v := range []string{"", "ya29.legacy-plaintext"} {
+		got, err := c.Decrypt("user-1", v)
+		if err != nil || got != v {
+			t.Errorf("Decrypt(%q) = %q, %v; want it unchanged", v, got, err)
+		}
+	}
+
+	// Empty and already encrypted values are not encrypted again
+	if got, _ := c.Encrypt("user-1", ""); got != "" {
+		t.Errorf("Encrypt(\"\") = %q", got)
+	}
+	enc, _ := c.Encrypt("user-1", "token")
+	if got, _ := c.Encrypt("user-1", enc); got != enc {
+		t.Error("Encrypt re-encrypted a ciphertext")
+	}
+}
+
+func TestTokenCipherWrongKey(t *testing.T) {
+	c, _ := NewTokenCipher("k1", map[string][]byte{"k1": testKey(1)})
+	enc, _ := c.Encrypt("user-1", "token")
+	sealed, _ := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(enc, "enc:k1:"))
+	sealed[len(sealed)-1] ^= 0xff
+	tampered := "enc:k1:" + base64.RawStdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name   string
+		cipher func() *TokenCipher
+		userID string
+		value  string
+	}{
+		{"other master key with the same id", func() *TokenCipher {
+			o, _ := NewTokenCipher("k1", map[string][]byte{"k1": testKey(2)})
+			return o
+		}, "user-1", enc},
+		{"unknown key id", func() *TokenCipher {
+			o, _ := NewTokenCipher("k2", map[string][]byte{"k2": testKey(1)})
+			return o
+		}, "user-1", enc},
+		{"other user", func() *TokenCipher { return c }, "user-2", enc},
+		{"tampered ciphertext", func() *TokenCipher { return c }, "user-1", tampered},
+		{"bad base64", func() *TokenCipher { return c }, "user-1", "enc:k1:not base64!"},
+		{"no key id", func() *TokenCipher { return c }, "user-1", "enc:payload"},
+		{"too short", func() *TokenCipher { return c }, "user-1", "enc:k1:" + base64.RawStdEncoding.EncodeToString([]byte("short"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.cipher().Decrypt(tt.userID, tt.value); err == nil {
+				t.Errorf("Decrypt succeeded with %q", got)
+			}
+		})
+	}
+}
+
+func TestTokenCipherRotation(t *testing.T) {
+	old, _ := NewTokenCipher("k1", map[string][]byte{"k1": testKey(1)})
+	enc, _ := old.Encrypt("user-1", "token")
+
+	rotated, err := NewTokenCipher("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Decrypt("user-1", enc); err != nil || got != "token" {
+		t.Errorf("Decrypt with retired key = %q, %v", got, err)
+	}
+	if fresh, _ := rotated.Encrypt("user-1", "token"); !strings.HasPrefix(fresh, "enc:k2:") {
+		t.Errorf("Encrypt used %q, want the active key k2", fresh)
+	}
+}
+
+func TestNewTokenCipherValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		active string
+		keys   map[string][]byte
+	}{
+		{"missing active key", "k2", map[string][]byte{"k1": testKey(1)}},
+		{"short key", "k1", map[string][]byte{"k1": []byte("short")}},
+		{"colon in id", "k:1", map[string][]byte{"k:1": testKey(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTokenCipher(tt.active, tt.keys); err == nil {
+				t.Error("NewTokenCipher succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadTokenCipher(t *testing.T) {
+	c, err := LoadTokenCipher("", nil)
+	if err != nil || c != nil {
+		t.Errorf("LoadTokenCipher without key = %v, %v; want disabled", c, err)
+	}
+	if _, err := LoadTokenCipher("k1", map[string]string{"k1": "%%%"}); err == nil {
+		t.Error("LoadTokenCipher accepted invalid base64")
+	}
+	c, err = LoadTokenCipher("k1", map[string]string{"k1": base64.StdEncoding.EncodeToString(testKey(1))})
+	if err != nil || c == nil {
+		t.Fatalf("LoadTokenCipher = %v, %v", c, err)
+	}
+}
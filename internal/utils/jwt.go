@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -14,7 +16,7 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID, email, secret string, expiration time.Duration) (string, error) {
+func GenerateAccessToken(userID, email string, keys *JWTKeys, expiration time.Duration) (string, error) {
 	claims := &Claims{
 		UserID:    userID,
 		Email:     email,
@@ -25,11 +27,10 @@ func GenerateAccessToken(userID, email, secret string, expiration time.Duration)
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
 
-func GenerateRefreshToken(userID, email, secret string, expiration time.Duration) (string, error) {
+func GenerateRefreshToken(userID, email string, keys *JWTKeys, expiration time.Duration) (string, error) {
 	claims := &Claims{
 		UserID:    userID,
 		Email:     email,
@@ -40,17 +41,24 @@ func GenerateRefreshToken(userID, email, secret string, expiration time.Duration
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
 
-func ValidateToken(tokenString, secret string) (*Claims, error) {
+// HashToken is the SHA-256 (hex) of a token, the form refresh tokens are stored in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateToken verifies a token signed with keys. Tokens using any other algorithm are
+// rejected, so an RS256 public key can't be passed off as an HS256 secret.
+func ValidateToken(tokenString string, keys *JWTKeys) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method.Alg() != keys.Alg() {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(secret), nil
-	})
+		return keys.verifyKey, nil
+	}, jwt.WithValidMethods([]string{keys.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT signing algorithms (JWT_ALG)
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+)
+
+// JWTKeys signs and verifies the API's tokens with one algorithm: HS256 with a shared
+// secret, or RS256 with a private key whose public half other services can fetch as a JWKS
+type JWTKeys struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	// RS256 only: the public key and its RFC 7638 thumbprint, sent as the kid header
+	publicKey *rsa.PublicKey
+	keyID     string
+}
+
+// NewHS256Keys signs and verifies with secret
+func NewHS256Keys(secret string) *JWTKeys {
+	return &JWTKeys{method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+}
+
+// NewRS256Keys signs with the PEM private key (PKCS #1 or #8). publicPEM is optional; when
+// given it must be the private key's public half.
+func NewRS256Keys(privatePEM, publicPEM []byte) (*JWTKeys, error) {
+	private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWT private key: %w", err)
+	}
+	public := &private.PublicKey
+	if len(publicPEM) > 0 {
+		public, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT public key: %w", err)
+		}
+		if !public.Equal(&private.PublicKey) {
+			return nil, errors.New("JWT public key does not match the private key")
+		}
+	}
+	return &JWTKeys{
+		method:    jwt.SigningMethodRS256,
+		signKey:   private,
+		verifyKey: public,
+		publicKey: public,
+		keyID:     rsaThumbprint(public),
+	}, nil
+}
+
+// LoadJWTKeys builds the keys for alg (HS256 when empty): secret for HS256, the PEM files at
+// privateKeyPath and, optionally, publicKeyPath for RS256
+func LoadJWTKeys(alg, secret, privateKeyPath, publicKeyPath string) (*JWTKeys, error) {
+	switch strings.ToUpper(alg) {
+	case "", JWTAlgHS256:
+		return NewHS256Keys(secret), nil
+	case JWTAlgRS256:
+		if privateKeyPath == "" {
+			return nil, errors.New("JWT_PRIVATE_KEY_PATH is required for RS256")
+		}
+		privatePEM, err := os.ReadFile(privateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT private key: %w", err)
+		}
+		var publicPEM []byte
+		if publicKeyPath != "" {
+			if publicPEM, err = os.ReadFile(publicKeyPath); err != nil {
+				return nil, fmt.Errorf("read JWT public key: %w", err)
+			}
+		}
+		return NewRS256Keys(privatePEM, publicPEM)
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALG %q (use HS256 or RS256)", alg)
+	}
+}
+
+// Alg is the algorithm tokens are signed with
+func (k *JWTKeys) Alg() string {
+	return k.method.Alg()
+}
+
+// sign signs claims, adding the kid header for RS256
+func (k *JWTKeys) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.keyID != "" {
+		token.Header["kid"] = k.keyID
+	}
+	return token.SignedString(k.signKey)
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet is the body of the JWKS endpoint
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the keys other services can verify tokens with; empty for HS256, whose
+// secret must never be published
+func (k *JWTKeys) JWKS() JWKSet {
+	if k.publicKey == nil {
+		return JWKSet{Keys: []JWK{}}
+	}
+	n, e := rsaJWKParams(k.publicKey)
+	return JWKSet{Keys: []JWK{{Kty: "RSA", Use: "sig", Alg: k.Alg(), Kid: k.keyID, N: n, E: e}}}
+}
+
+// rsaJWKParams are the base64url modulus and exponent of key
+func rsaJWKParams(key *rsa.PublicKey) (n, e string) {
+	n = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	return n, e
+}
+
+// rsaThumbprint is the RFC 7638 thumbprint of key
+func rsaThumbprint(key *rsa.PublicKey) string {
+	n, e := rsaJWKParams(key)
+	// Members in lexicographic order, no whitespace
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: e, Kty: "RSA", N: n})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
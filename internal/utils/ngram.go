@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeSearchText lower-cases s, strips accents and keeps only its words (letters and
+// digits) separated by single spaces: "Hóa đơn: Tháng 5" -> "hoa don thang 5"
+func NormalizeSearchText(s string) string {
+	return strings.Join(SearchWords(RemoveAccents(s)), " ")
+}
+
+// SearchWords splits s into lower-cased words of letters and digits
+func SearchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// WordTrigrams returns the distinct trigrams of words, each word padded with a space on both
+// sides so its first and last letters count too ("don" -> " do", "don", "on "). Words that
+// differ by one edit share most of their trigrams, which makes them a cheap candidate filter
+// for edit-distance matching.
+func WordTrigrams(words []string) []string {
+	seen := map[string]bool{}
+	var grams []string
+	for _, w := range words {
+		padded := []rune(" " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			gram := string(padded[i : i+3])
+			if !seen[gram] {
+				seen[gram] = true
+				grams = append(grams, gram)
+			}
+		}
+	}
+	return grams
+}
@@ -1,6 +1,14 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrNoPasswordHash is returned by CheckPassword for accounts without a password, such as
+// those created through Google sign-in
+var ErrNoPasswordHash = errors.New("account has no password")
 
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -10,6 +18,10 @@ func HashPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
+// CheckPassword compares password with a stored bcrypt hash. An empty hash never matches.
 func CheckPassword(hashedPassword, password string) error {
+	if hashedPassword == "" {
+		return ErrNoPasswordHash
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
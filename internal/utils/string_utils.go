@@ -5,8 +5,13 @@ import (
 	"html"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 // SanitizeHTML strips HTML tags, script/style content, and decodes entities
@@ -33,6 +38,72 @@ func SanitizeHTML(s string) string {
 	return s
 }
 
+// Levenshtein returns the edit distance (insertions, deletions, substitutions) between a
+// and b, counted in runes
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// DamerauLevenshtein is Levenshtein that also counts swapping two adjacent runes as a single
+// edit ("recieve" -> "receive" is 1, not 2). It is the optimal string alignment variant: a
+// substring is never edited again after a transposition.
+func DamerauLevenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	// Three rows: i-2 (for transpositions), i-1 and i
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -40,74 +111,99 @@ func min(a, b int) int {
 	return b
 }
 
-// RemoveAccents removes Vietnamese accents from a string
+// stripMarks decomposes text (NFD), drops the combining marks and recomposes what is left.
+// A chain keeps state between calls, so each call needs its own.
+func stripMarks() transform.Transformer {
+	return transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+}
+
+// accentFolds are letters that are not a base letter plus a combining mark, so NFD leaves them
+// alone
+var accentFolds = map[rune]rune{
+	'đ': 'd', 'Đ': 'D',
+	'ł': 'l', 'Ł': 'L',
+	'ø': 'o', 'Ø': 'O',
+}
+
+// RemoveAccents removes diacritics from Latin letters ("Tiếng Việt" -> "Tieng Viet",
+// "café" -> "cafe", "Müller" -> "Muller")
 func RemoveAccents(s string) string {
-	// A basic mapping or using normalization libraries is needed.
-	// Since we can't easily import external text/* libs if not already in go.mod and verified,
-	// we'll implement a simple map-based replacer for common Vietnamese chars.
-	// Or relies on runic decomposition if standard lib supports it well enough.
-	// Let's use a simple mapping for reliability without adding heavy dependencies.
-
-	// Map of accented chars to unaccented
-	accents := map[rune]rune{
-		'á': 'a', 'à': 'a', 'ả': 'a', 'ã': 'a', 'ạ': 'a', 'ă': 'a', 'ắ': 'a', 'ằ': 'a', 'ẳ': 'a', 'ẵ': 'a', 'ặ': 'a', 'â': 'a', 'ấ': 'a', 'ầ': 'a', 'ẩ': 'a', 'ẫ': 'a', 'ậ': 'a',
-		'đ': 'd',
-		'é': 'e', 'è': 'e', 'ẻ': 'e', 'ẽ': 'e', 'ẹ': 'e', 'ê': 'e', 'ế': 'e', 'ề': 'e', 'ể': 'e', 'ễ': 'e', 'ệ': 'e',
-		'í': 'i', 'ì': 'i', 'ỉ': 'i', 'ĩ': 'i', 'ị': 'i',
-		'ó': 'o', 'ò': 'o', 'ỏ': 'o', 'õ': 'o', 'ọ': 'o', 'ô': 'o', 'ố': 'o', 'ồ': 'o', 'ổ': 'o', 'ỗ': 'o', 'ộ': 'o', 'ơ': 'o', 'ớ': 'o', 'ờ': 'o', 'ở': 'o', 'ỡ': 'o', 'ợ': 'o',
-		'ú': 'u', 'ù': 'u', 'ủ': 'u', 'ũ': 'u', 'ụ': 'u', 'ư': 'u', 'ứ': 'u', 'ừ': 'u', 'ử': 'u', 'ữ': 'u', 'ự': 'u',
-		'ý': 'y', 'ỳ': 'y', 'ỷ': 'y', 'ỹ': 'y', 'ỵ': 'y',
-		// Uppercase
-		'Á': 'A', 'À': 'A', 'Ả': 'A', 'Ã': 'A', 'Ạ': 'A', 'Ă': 'A', 'Ắ': 'A', 'Ằ': 'A', 'Ẳ': 'A', 'Ẵ': 'A', 'Ặ': 'A', 'Â': 'A', 'Ấ': 'A', 'Ầ': 'A', 'Ẩ': 'A', 'Ẫ': 'A', 'Ậ': 'A',
-		'Đ': 'D',
-		'É': 'E', 'È': 'E', 'Ẻ': 'E', 'Ẽ': 'E', 'Ẹ': 'E', 'Ê': 'E', 'Ế': 'E', 'Ề': 'E', 'Ể': 'E', 'Ễ': 'E', 'Ệ': 'E',
-		'Í': 'I', 'Ì': 'I', 'Ỉ': 'I', 'Ĩ': 'I', 'Ị': 'I',
-		'Ó': 'O', 'Ò': 'O', 'Ỏ': 'O', 'Õ': 'O', 'Ọ': 'O', 'Ô': 'O', 'Ố': 'O', 'Ồ': 'O', 'Ổ': 'O', 'Ỗ': 'O', 'Ộ': 'O', 'Ơ': 'O', 'Ớ': 'O', 'Ờ': 'O', 'Ở': 'O', 'Ỡ': 'O', 'Ợ': 'O',
-		'Ú': 'U', 'Ù': 'U', 'Ủ': 'U', 'Ũ': 'U', 'Ụ': 'U', 'Ư': 'U', 'Ứ': 'U', 'Ừ': 'U', 'Ử': 'U', 'Ữ': 'U', 'Ự': 'U',
-		'Ý': 'Y', 'Ỳ': 'Y', 'Ỷ': 'Y', 'Ỹ': 'Y', 'Ỵ': 'Y',
+	out, _, err := transform.String(stripMarks(), s)
+	if err != nil {
+		out = s
+	}
+	return strings.Map(func(r rune) rune {
+		if base, ok := accentFolds[r]; ok {
+			return base
+		}
+		return r
+	}, out)
+}
+
+// relaxedClasses maps a lowercase ASCII letter to a regex character class of the letter and
+// its accented lowercase forms in the Latin-1, Latin Extended and Vietnamese blocks, e.g.
+// 'n' -> "[nñńņňŉ...]". Letters without accented forms have no entry.
+var relaxedClasses = buildRelaxedClasses()
+
+func buildRelaxedClasses() map[rune]string {
+	ranges := [][2]rune{{0x00C0, 0x024F}, {0x1E00, 0x1EFF}}
+	forms := map[rune][]rune{}
+	for _, rg := range ranges {
+		for r := rg[0]; r <= rg[1]; r++ {
+			if !unicode.IsLower(r) {
+				continue
+			}
+			base := []rune(RemoveAccents(string(r)))
+			if len(base) != 1 || base[0] == r || base[0] < 'a' || base[0] > 'z' {
+				continue
+			}
+			forms[base[0]] = append(forms[base[0]], r)
+		}
+	}
+	classes := make(map[rune]string, len(forms))
+	for base, accented := range forms {
+		classes[base] = "[" + string(base) + string(accented) + "]"
 	}
+	return classes
+}
+
+// MaxRegexQueryLength is how many runes of a search query GenerateRelaxedRegex uses; the rest
+// is dropped so a huge query can't become a huge regex scan
+const MaxRegexQueryLength = 128
 
-	var sb strings.Builder
+// EscapeRegexLiteral escapes s so it matches literally in a Go or PCRE (MongoDB) regex. Every
+// ASCII character that is not a letter, digit or space is backslash-escaped, which both
+// engines read as the literal character.
+func EscapeRegexLiteral(s string) string {
+	var res strings.Builder
 	for _, r := range s {
-		if val, ok := accents[r]; ok {
-			sb.WriteRune(val)
-		} else {
-			sb.WriteRune(r)
+		if r < utf8.RuneSelf && r != ' ' && !unicode.IsLetter(r) && !unicode.IsDigit(r) && unicode.IsPrint(r) {
+			res.WriteByte('\\')
 		}
+		res.WriteRune(r)
 	}
-	return sb.String()
+	return res.String()
 }
 
+// GenerateRelaxedRegex builds an accent-insensitive pattern for s: accents in s are dropped
+// and each letter matches its accented forms, so "cafe" and "café" both match "Café". Use it
+// with case-insensitive matching. Everything else in s is escaped, so the pattern is a plain
+// sequence of literals and character classes with no quantifiers to backtrack on; s is cut
+// to MaxRegexQueryLength runes.
 func GenerateRelaxedRegex(s string) string {
-	s = strings.ToLower(s)
-	// Replace vowels with character classes
-	res := ""
+	s = strings.ToLower(RemoveAccents(s))
+	if utf8.RuneCountInString(s) > MaxRegexQueryLength {
+		s = string([]rune(s)[:MaxRegexQueryLength])
+	}
+	var res strings.Builder
 	for _, r := range s {
-		switch r {
-		case 'a':
-			res += "[aáàảãạăắằẳẵặâấầẩẫậ]"
-		case 'd':
-			res += "[dđ]"
-		case 'e':
-			res += "[eéèẻẽẹêếềểễệ]"
-		case 'i':
-			res += "[iíìỉĩị]"
-		case 'o':
-			res += "[oóòỏõọôốồổỗộơớờởỡợ]"
-		case 'u':
-			res += "[uúùủũụưứừửữự]"
-		case 'y':
-			res += "[yýỳỷỹỵ]"
-		default:
-			// Escape special regex chars if any (basic ones)
-			if strings.ContainsRune(".+*?^$()[]{}|\\", r) {
-				res += "\\" + string(r)
-			} else {
-				res += string(r)
-			}
+		if class, ok := relaxedClasses[r]; ok {
+			res.WriteString(class)
+			continue
 		}
+		res.WriteString(EscapeRegexLiteral(string(r)))
 	}
-	return res
+	return res.String()
 }
 
 // ToValidUTF8 cleans strings to ensure they are valid UTF-8
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeRegexLiteral(t *testing.T) {
+	inputs := []string{
+		`.*+?()[]{}|^$\`,
+		`a.b`,
+		`(a+)+$`,
+		`[^x]{2,}`,
+		`\d\w\s\Q\E`,
+		`user@example.com`,
+		`100% (urgent) #1`,
+		`tiếng việt`,
+	}
+	for _, in := range inputs {
+		re, err := regexp.Compile("^" + EscapeRegexLiteral(in) + "$")
+		if err != nil {
+			t.Errorf("EscapeRegexLiteral(%q) does not compile: %v", in, err)
+			continue
+		}
+		if !re.MatchString(in) {
+			t.Errorf("EscapeRegexLiteral(%q) = %q does not match the input literally", in, EscapeRegexLiteral(in))
+		}
+	}
+	if re := regexp.MustCompile(EscapeRegexLiteral("a.c")); re.MatchString("abc") {
+		t.Error(`escaped "a.c" matched "abc"`)
+	}
+}
+
+// assertNoOperators fails when pattern has an unescaped operator outside a character class:
+// only literals and classes may remain
+func assertNoOperators(t *testing.T, input, pattern string) {
+	t.Helper()
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '\\':
+			i++
+		case inClass:
+			inClass = ch != ']'
+		case ch == '[':
+			inClass = true
+		case strings.IndexByte("*+?{}()|^$.]", ch) >= 0:
+			t.Fatalf("GenerateRelaxedRegex(%.20q...) has operator %q at %d", input, ch, i)
+		}
+	}
+}
+
+func TestGenerateRelaxedRegexAdversarial(t *testing.T) {
+	inputs := []string{
+		strings.Repeat("(", 10000),
+		strings.Repeat("(((a*)*)*", 1000),
+		"(a+)+$",
+		"(x+x+)+y",
+		strings.Repeat("a", 100000) + "!",
+		strings.Repeat("é", 50000),
+		strings.Repeat(".*", 5000),
+		strings.Repeat("[", 500) + strings.Repeat("]", 500),
+		`\` + strings.Repeat(`\`, 999),
+	}
+	for _, in := range inputs {
+		pattern := GenerateRelaxedRegex(in)
+		assertNoOperators(t, in, pattern)
+
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			t.Fatalf("GenerateRelaxedRegex(%.20q...) does not compile: %v", in, err)
+		}
+		// The pattern is built from at most MaxRegexQueryLength runes of the query
+		if n := utf8.RuneCountInString(RemoveAccents(in)); n > MaxRegexQueryLength {
+			prefix := strings.ToLower(RemoveAccents(string([]rune(in)[:MaxRegexQueryLength])))
+			if !re.MatchString(prefix) {
+				t.Errorf("GenerateRelaxedRegex(%.20q...) does not match its capped prefix", in)
+			}
+		}
+
+		start := time.Now()
+		re.MatchString(strings.Repeat("a", 100000))
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("matching GenerateRelaxedRegex(%.20q...) took %v", in, d)
+		}
+	}
+}
+
+func TestGenerateRelaxedRegexAccents(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        bool
+	}{
+		{"cafe", "Café au lait", true},
+		{"café", "CAFE", true},
+		{"tieng viet", "Tiếng Việt", true},
+		{"muller", "Müller", true},
+		{"a.b", "axb", false},
+		{"a.b", "A.B", true},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile("(?i)" + GenerateRelaxedRegex(tt.query))
+		if got := re.MatchString(tt.text); got != tt.want {
+			t.Errorf("GenerateRelaxedRegex(%q) on %q = %v, want %v", tt.query, tt.text, got, tt.want)
+		}
+	}
+}
+
+// Searches run retrievers in parallel; run with -race
+func TestRemoveAccentsConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := RemoveAccents("Tiếng Việt, café, Müller"); got != "Tieng Viet, cafe, Muller" {
+					t.Errorf("RemoveAccents = %q", got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDamerauLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b        string
+		want        int
+		levenshtein int // plain Levenshtein, for comparison
+	}{
+		{"", "", 0, 0},
+		{"", "abc", 3, 3},
+		{"abc", "", 3, 3},
+		{"receive", "receive", 0, 0},
+		// transpositions: one edit instead of two
+		{"recieve", "receive", 1, 2},
+		{"teh", "the", 1, 2},
+		{"ab", "ba", 1, 2},
+		{"invocie", "invoice", 1, 2},
+		{"adress", "address", 1, 1},
+		{"acheive", "achieve", 1, 2},
+		{"abcdef", "badcfe", 3, 4},
+		// insertions and deletions
+		{"color", "colour", 1, 1},
+		{"colour", "color", 1, 1},
+		{"mail", "emails", 2, 2},
+		// substitutions
+		{"kitten", "sitten", 1, 1},
+		{"kitten", "sitting", 3, 3},
+		{"flaw", "lawn", 2, 2},
+		// optimal string alignment: a transposed pair is not edited again
+		{"ca", "abc", 3, 3},
+		// multibyte runes count as one
+		{"hóa", "hoa", 1, 1},
+		{"đơn", "dơn", 1, 1},
+		{"thông", "thôgn", 1, 2},
+		{"Việt", "Viêt", 1, 1},
+		{"nghỉ lễ", "nghỉ ễl", 1, 2},
+		{"tiếng", "tiếng", 0, 0},
+		{"日本語", "日語本", 1, 2},
+	}
+	for _, tt := range tests {
+		if got := DamerauLevenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("DamerauLevenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := DamerauLevenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("DamerauLevenshtein(%q, %q) = %d, want %d (not symmetric)", tt.b, tt.a, got, tt.want)
+		}
+		if got := Levenshtein(tt.a, tt.b); got != tt.levenshtein {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.levenshtein)
+		}
+	}
+}